@@ -0,0 +1,74 @@
+//Package backoff paces the reconnect attempts of the client, see fayec.WithRetryPolicy.
+package backoff
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+//Policy decides the delay before every reconnect attempt and when to give up
+type Policy interface {
+	//Delay returns the delay before the attempt, starting from 1. ok is false once the client should give up.
+	Delay(attempt int) (delay time.Duration, ok bool)
+}
+
+//Constant waits the same Interval before every attempt
+type Constant struct {
+	Interval time.Duration
+	//MaxAttempts gives up after this many attempts, 0 retries forever
+	MaxAttempts int
+}
+
+//Delay implements Policy
+func (c Constant) Delay(attempt int) (time.Duration, bool) {
+	if c.MaxAttempts > 0 && attempt > c.MaxAttempts {
+		return 0, false
+	}
+	return c.Interval, true
+}
+
+//Exponential multiplies the delay by Multiplier after every attempt, up to MaxInterval
+type Exponential struct {
+	//InitialInterval is the delay before the first attempt
+	InitialInterval time.Duration
+	//Multiplier grows the delay between two attempts, values below 1 are treated as 1
+	Multiplier float64
+	//MaxInterval caps the delay before the jitter, 0 doesn't cap it
+	MaxInterval time.Duration
+	//MaxAttempts gives up after this many attempts, 0 retries forever
+	MaxAttempts int
+	//Jitter randomizes the delays by up to this fraction, e.g. 0.2 waits between 80% and 120% of the delay,
+	//so the clients dropped together don't reconnect together
+	Jitter float64
+}
+
+//Default returns an exponential policy with jitter: 1s doubling up to 30s, 20% jitter, retrying forever
+func Default() *Exponential {
+	return &Exponential{
+		InitialInterval: time.Second,
+		Multiplier:      2,
+		MaxInterval:     30 * time.Second,
+		Jitter:          0.2,
+	}
+}
+
+//Delay implements Policy
+func (e *Exponential) Delay(attempt int) (time.Duration, bool) {
+	if e.MaxAttempts > 0 && attempt > e.MaxAttempts {
+		return 0, false
+	}
+	multiplier := math.Max(e.Multiplier, 1)
+	delay := float64(e.InitialInterval) * math.Pow(multiplier, float64(attempt-1))
+	if e.MaxInterval > 0 && delay > float64(e.MaxInterval) {
+		delay = float64(e.MaxInterval)
+	}
+	if e.Jitter > 0 {
+		delay += delay * e.Jitter * (2*rand.Float64() - 1)
+	}
+	//the overflow of math.Pow on many attempts without MaxInterval
+	if delay >= math.MaxInt64 {
+		return math.MaxInt64, true
+	}
+	return time.Duration(delay), true
+}
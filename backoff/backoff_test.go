@@ -0,0 +1,55 @@
+package backoff
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExponential_Delay(t *testing.T) {
+	e := &Exponential{InitialInterval: time.Second, Multiplier: 2, MaxInterval: 5 * time.Second, MaxAttempts: 5}
+	var tests = []struct {
+		attempt int
+		delay   time.Duration
+		ok      bool
+	}{
+		{1, time.Second, true},
+		{2, 2 * time.Second, true},
+		{3, 4 * time.Second, true},
+		{4, 5 * time.Second, true},
+		{5, 5 * time.Second, true},
+		{6, 0, false},
+	}
+	for _, tt := range tests {
+		delay, ok := e.Delay(tt.attempt)
+		if delay != tt.delay || ok != tt.ok {
+			t.Fatalf("attempt %d: expecting %v %v got: %v %v", tt.attempt, tt.delay, tt.ok, delay, ok)
+		}
+	}
+}
+
+func TestExponential_Jitter(t *testing.T) {
+	e := &Exponential{InitialInterval: time.Second, Multiplier: 2, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		delay, ok := e.Delay(2)
+		if !ok || delay < time.Second || delay > 3*time.Second {
+			t.Fatalf("expecting a delay between 1s and 3s got: %v", delay)
+		}
+	}
+}
+
+func TestExponential_Overflow(t *testing.T) {
+	e := &Exponential{InitialInterval: time.Second, Multiplier: 2}
+	if delay, ok := e.Delay(1000); !ok || delay <= 0 {
+		t.Fatalf("expecting a positive delay got: %v", delay)
+	}
+}
+
+func TestConstant_Delay(t *testing.T) {
+	c := Constant{Interval: time.Second, MaxAttempts: 2}
+	if delay, ok := c.Delay(2); delay != time.Second || !ok {
+		t.Fatalf("expecting 1s got: %v %v", delay, ok)
+	}
+	if _, ok := c.Delay(3); ok {
+		t.Fatal("expecting to give up after 2 attempts")
+	}
+}
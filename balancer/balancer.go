@@ -0,0 +1,173 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+//ErrNoEndpoints is returned when a balancer is created without endpoints
+var ErrNoEndpoints = errors.New("balancer has no endpoints")
+
+//Policy decides which endpoint the next client connects to
+type Policy int
+
+const (
+	//RoundRobin rotates the first endpoint tried on every connection
+	RoundRobin Policy = iota
+	//LeastConnections prefers the endpoint with the fewest clients connected through the balancer
+	LeastConnections
+)
+
+//ProbeFunc checks whether the endpoint is able to accept connections
+type ProbeFunc func(ctx context.Context, endpoint string) error
+
+type endpoint struct {
+	url       string
+	conns     int
+	unhealthy bool
+}
+
+//Balancer distributes the clients sharing it across a list of equivalent endpoints.
+//unhealthy endpoints, as reported by the probes, are only tried after the healthy ones.
+type Balancer struct {
+	mu        sync.Mutex
+	policy    Policy
+	endpoints []*endpoint
+	next      int
+}
+
+//New creates a balancer distributing the connections across the endpoints according to policy
+func New(endpoints []string, policy Policy) (*Balancer, error) {
+	if len(endpoints) == 0 {
+		return nil, ErrNoEndpoints
+	}
+	b := &Balancer{policy: policy}
+	for i := range endpoints {
+		b.endpoints = append(b.endpoints, &endpoint{url: endpoints[i]})
+	}
+	return b, nil
+}
+
+//Endpoints returns all the endpoints in the order a client should try them, the preferred first
+func (b *Balancer) Endpoints() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := len(b.endpoints)
+	ordered := make([]*endpoint, 0, n)
+	for i := 0; i < n; i++ {
+		ordered = append(ordered, b.endpoints[(b.next+i)%n])
+	}
+	b.next = (b.next + 1) % n
+
+	if b.policy == LeastConnections {
+		//stable, so endpoints with the same load keep the round robin order
+		for i := 1; i < n; i++ {
+			for j := i; j > 0 && ordered[j].conns < ordered[j-1].conns; j-- {
+				ordered[j], ordered[j-1] = ordered[j-1], ordered[j]
+			}
+		}
+	}
+
+	urls := make([]string, 0, n)
+	for _, healthy := range []bool{true, false} {
+		for i := range ordered {
+			if ordered[i].unhealthy != healthy {
+				urls = append(urls, ordered[i].url)
+			}
+		}
+	}
+	return urls
+}
+
+//Acquire records a client connected to the endpoint, release must be called when it disconnects
+func (b *Balancer) Acquire(url string) (release func()) {
+	e := b.endpoint(url)
+	if e == nil {
+		return func() {}
+	}
+	b.mu.Lock()
+	e.conns++
+	b.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			e.conns--
+			b.mu.Unlock()
+		})
+	}
+}
+
+//Probe checks all the endpoints concurrently and records their health
+func (b *Balancer) Probe(ctx context.Context, probe ProbeFunc) {
+	var wg sync.WaitGroup
+	for i := range b.endpoints {
+		wg.Add(1)
+		go func(e *endpoint) {
+			defer wg.Done()
+			err := probe(ctx, e.url)
+			b.mu.Lock()
+			e.unhealthy = err != nil
+			b.mu.Unlock()
+		}(b.endpoints[i])
+	}
+	wg.Wait()
+}
+
+//RunProbes probes the endpoints every interval until ctx is done, DialProbe is used if probe is nil
+func (b *Balancer) RunProbes(ctx context.Context, interval time.Duration, probe ProbeFunc) {
+	if probe == nil {
+		probe = DialProbe
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		b.Probe(ctx, probe)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (b *Balancer) endpoint(url string) *endpoint {
+	for i := range b.endpoints {
+		if b.endpoints[i].url == url {
+			return b.endpoints[i]
+		}
+	}
+	return nil
+}
+
+//defaultPorts are the ports dialed by DialProbe when the endpoint doesn't specify one
+var defaultPorts = map[string]string{
+	"ws":    "80",
+	"http":  "80",
+	"wss":   "443",
+	"https": "443",
+}
+
+//DialProbe reports an endpoint healthy if a tcp connection to its host can be established
+func DialProbe(ctx context.Context, endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	port := u.Port()
+	if port == "" {
+		port = defaultPorts[u.Scheme]
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
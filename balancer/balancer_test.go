@@ -0,0 +1,85 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestBalancer_RoundRobin(t *testing.T) {
+	b, err := New([]string{"ws://a", "ws://b", "ws://c"}, RoundRobin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{
+		{"ws://a", "ws://b", "ws://c"},
+		{"ws://b", "ws://c", "ws://a"},
+		{"ws://c", "ws://a", "ws://b"},
+		{"ws://a", "ws://b", "ws://c"},
+	}
+	for i := range expected {
+		if got := b.Endpoints(); !reflect.DeepEqual(got, expected[i]) {
+			t.Fatalf("pick %d: expecting %v got: %v", i, expected[i], got)
+		}
+	}
+}
+
+func TestBalancer_LeastConnections(t *testing.T) {
+	b, err := New([]string{"ws://a", "ws://b", "ws://c"}, LeastConnections)
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseA := b.Acquire("ws://a")
+	b.Acquire("ws://a")
+	b.Acquire("ws://b")
+
+	if got := b.Endpoints()[0]; got != "ws://c" {
+		t.Fatalf("expecting the least loaded endpoint first got: %s", got)
+	}
+	b.Acquire("ws://c")
+	releaseA()
+	releaseA()
+	//the release is idempotent, every endpoint has one connection and the round robin order is kept
+	if got := b.Endpoints(); !reflect.DeepEqual(got, []string{"ws://b", "ws://c", "ws://a"}) {
+		t.Fatalf("expecting the round robin order between equally loaded endpoints got: %v", got)
+	}
+}
+
+func TestBalancer_Probe(t *testing.T) {
+	b, err := New([]string{"ws://a", "ws://b", "ws://c"}, RoundRobin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Probe(context.Background(), func(ctx context.Context, endpoint string) error {
+		if endpoint == "ws://a" {
+			return errors.New("down")
+		}
+		return nil
+	})
+	if got := b.Endpoints(); !reflect.DeepEqual(got, []string{"ws://b", "ws://c", "ws://a"}) {
+		t.Fatalf("expecting the unhealthy endpoint last got: %v", got)
+	}
+}
+
+func TestDialProbe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	if err = DialProbe(context.Background(), "ws://"+addr+"/faye"); err != nil {
+		t.Fatalf("expecting the listening endpoint healthy got: %v", err)
+	}
+	l.Close()
+	if err = DialProbe(context.Background(), "ws://"+addr+"/faye"); err == nil {
+		t.Fatal("expecting the closed endpoint unhealthy")
+	}
+}
+
+func TestNew_NoEndpoints(t *testing.T) {
+	if _, err := New(nil, RoundRobin); err != ErrNoEndpoints {
+		t.Fatalf("expecting %v got: %v", ErrNoEndpoints, err)
+	}
+}
@@ -0,0 +1,91 @@
+package fayec
+
+import (
+	"github.com/thesyncim/faye/internal/dispatcher"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/subscription"
+	"sort"
+)
+
+//Batch collects the subscribes and publishes sent together by Client.Batch
+type Batch struct {
+	ops []*dispatcher.BatchOp
+}
+
+//BatchResult is the outcome of an operation of a batch, available once Client.Batch returns
+type BatchResult struct {
+	op *dispatcher.BatchOp
+}
+
+//Subscribe adds a subscribe to the batch
+func (b *Batch) Subscribe(subscription Channel) *BatchResult {
+	return b.add(&dispatcher.BatchOp{Subscribe: true, Channel: string(subscription)})
+}
+
+//Publish adds a publish to the batch
+func (b *Batch) Publish(subscription Channel, data message.Data) *BatchResult {
+	return b.add(&dispatcher.BatchOp{Channel: string(subscription), Data: data})
+}
+
+func (b *Batch) add(op *dispatcher.BatchOp) *BatchResult {
+	b.ops = append(b.ops, op)
+	return &BatchResult{op: op}
+}
+
+//Subscription returns the subscription created by a successful subscribe
+func (r *BatchResult) Subscription() *subscription.Subscription {
+	return r.op.Subscription
+}
+
+//Err returns the error of the operation
+func (r *BatchResult) Err() error {
+	return r.op.Err
+}
+
+//Batch sends the subscribes and publishes composed by fn in a single frame when fn returns, like CometD
+//startBatch/endBatch, and waits for all their responses. the first error is returned, the outcome of each
+//operation is available from its BatchResult. batched operations don't run through the middlewares.
+func (c *Client) Batch(fn func(b *Batch)) error {
+	var b Batch
+	fn(&b)
+	if len(b.ops) == 0 {
+		return nil
+	}
+	return c.dispatcher.Batch(b.ops)
+}
+
+//PublishBatch publishes every data to the channel in a single frame, in order, and waits for all the acks.
+//the first error is returned. like Batch, the publishes don't run through the middlewares.
+func (c *Client) PublishBatch(channel string, data []message.Data) error {
+	if len(data) == 0 {
+		return nil
+	}
+	ops := make([]*dispatcher.BatchOp, len(data))
+	for i := range data {
+		ops[i] = &dispatcher.BatchOp{Channel: channel, Data: data[i]}
+	}
+	return c.dispatcher.Batch(ops)
+}
+
+//PublishMulti publishes the data to each channel in a single frame, so the server receives them together,
+//and waits for all the acks. results holds the outcome of every channel, err is the first error in channel order.
+//like Batch, the publishes don't run through the middlewares.
+func (c *Client) PublishMulti(publishes map[string]message.Data) (results map[string]error, err error) {
+	channels := make([]string, 0, len(publishes))
+	for ch := range publishes {
+		channels = append(channels, ch)
+	}
+	sort.Strings(channels)
+	ops := make([]*dispatcher.BatchOp, len(channels))
+	for i, ch := range channels {
+		ops[i] = &dispatcher.BatchOp{Channel: ch, Data: publishes[ch]}
+	}
+	if len(ops) > 0 {
+		err = c.dispatcher.Batch(ops)
+	}
+	results = make(map[string]error, len(ops))
+	for _, op := range ops {
+		results[op.Channel] = op.Err
+	}
+	return results, err
+}
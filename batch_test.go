@@ -0,0 +1,94 @@
+package fayec
+
+import (
+	"github.com/thesyncim/faye/internal/dispatcher"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"testing"
+)
+
+//ackTransport acks the messages it sends, rejecting the publishes to /fail
+type ackTransport struct {
+	handlerTransport
+	clientID string
+	onMsg    func(msg *message.Message)
+	frames   [][]*message.Message
+}
+
+func (t *ackTransport) Name() string     { return "ack" }
+func (t *ackTransport) ClientID() string { return t.clientID }
+func (t *ackTransport) SetOnMessageReceivedHandler(onMsg func(msg *message.Message)) {
+	t.onMsg = onMsg
+}
+func (t *ackTransport) SendMessage(msg *message.Message) error {
+	return t.SendMessages([]*message.Message{msg})
+}
+func (t *ackTransport) SendMessages(msgs []*message.Message) error {
+	t.frames = append(t.frames, msgs)
+	for _, m := range msgs {
+		resp := &message.Message{Channel: m.Channel, Id: m.Id, Subscription: m.Subscription, Successful: true}
+		if m.Channel == "/fail" {
+			resp.Successful, resp.Error = false, "403::forbidden"
+		}
+		go t.onMsg(resp)
+	}
+	return nil
+}
+
+func TestClient_PublishMulti(t *testing.T) {
+	at := &ackTransport{clientID: "ack-client"}
+	d := dispatcher.NewDispatcher("fake://", transport.Options{}, message.Extensions{})
+	d.SetTransport(at)
+	c := &Client{dispatcher: d}
+
+	results, err := c.PublishMulti(map[string]message.Data{"/foo": 1, "/bar": 2, "/fail": 3})
+	if err == nil {
+		t.Fatal("expecting the /fail error")
+	}
+	if len(at.frames) != 1 || len(at.frames[0]) != 3 {
+		t.Fatalf("expecting the publishes sent in a single frame got: %v", at.frames)
+	}
+	var tests = []struct {
+		channel string
+		failed  bool
+	}{
+		{channel: "/foo", failed: false},
+		{channel: "/bar", failed: false},
+		{channel: "/fail", failed: true},
+	}
+	for _, tt := range tests {
+		if err, ok := results[tt.channel]; !ok || (err != nil) != tt.failed {
+			t.Fatalf("expecting %s failed %v got: %v", tt.channel, tt.failed, err)
+		}
+	}
+
+	if results, err = c.PublishMulti(nil); err != nil || len(results) != 0 {
+		t.Fatalf("expecting no results got: %v %v", results, err)
+	}
+}
+
+func TestClient_PublishBatch(t *testing.T) {
+	at := &ackTransport{clientID: "ack-client"}
+	d := dispatcher.NewDispatcher("fake://", transport.Options{}, message.Extensions{})
+	d.SetTransport(at)
+	c := &Client{dispatcher: d}
+
+	if err := c.PublishBatch("/foo", []message.Data{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if len(at.frames) != 1 || len(at.frames[0]) != 3 {
+		t.Fatalf("expecting the publishes sent in a single frame got: %v", at.frames)
+	}
+	for i, m := range at.frames[0] {
+		if m.Channel != "/foo" || m.Data != i+1 {
+			t.Fatalf("expecting %d published to /foo got: %+v", i+1, m)
+		}
+	}
+
+	if err := c.PublishBatch("/fail", []message.Data{1}); err == nil {
+		t.Fatal("expecting the /fail error")
+	}
+	if err := c.PublishBatch("/foo", nil); err != nil || len(at.frames) != 2 {
+		t.Fatalf("expecting nothing sent got: %v %d frames", err, len(at.frames))
+	}
+}
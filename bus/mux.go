@@ -0,0 +1,233 @@
+//Package bus lets several in-process consumers listen to the channels of a single client with independent
+//lifecycles. the mux keeps the minimal set of subscriptions on the server, e.g. a single /prices/** for listeners
+//of /prices/** and /prices/EURUSD, and fans the messages delivered out to the listeners locally:
+//
+//	mux := bus.NewMux(client)
+//	h1, _ := mux.Listen("/prices/**", onPrice)
+//	h2, _ := mux.Listen("/prices/EURUSD", onEURUSD)
+//	h1.Close() //the server subscription moves to /prices/EURUSD
+package bus
+
+import (
+	"errors"
+	fayec "github.com/thesyncim/faye"
+	"github.com/thesyncim/faye/internal/store"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/subscription"
+	"sort"
+	"sync"
+)
+
+//ErrClosed is returned by Listen once the mux is closed
+var ErrClosed = errors.New("bus: closed")
+
+//Mux multiplexes the listeners of a client over the fewest server subscriptions. the client is owned by the
+//application, a mux must be the only one subscribing the channels it listens to, so their subscriptions aren't
+//removed under it. a message may be missed or delivered twice while a wider subscription replaces narrower ones.
+//the subscriptions are queued as configured on the client, see fayec.WithChannelConfig.
+type Mux struct {
+	client *fayec.Client
+
+	//reconcileMu serializes the changes of the subscriptions, they wait for the server
+	reconcileMu sync.Mutex
+
+	mu        sync.Mutex
+	listeners map[*Listener]struct{}
+	remotes   map[string]*remote
+	seq       uint64
+	closed    bool
+}
+
+//remote is a subscription of the client shared by the listeners it covers
+type remote struct {
+	pattern string
+	//seq orders the remotes, the oldest one matching a channel delivers its messages
+	seq uint64
+	sub *subscription.Subscription
+}
+
+//Listener is a consumer of the mux, it receives the messages of its channel until closed
+type Listener struct {
+	mux       *Mux
+	pattern   string
+	onMessage func(msg *message.Message)
+}
+
+//NewMux creates a mux over client
+func NewMux(client *fayec.Client) *Mux {
+	return &Mux{
+		client:    client,
+		listeners: map[*Listener]struct{}{},
+		remotes:   map[string]*remote{},
+	}
+}
+
+//Listen calls onMessage with the messages delivered on the channel or wildcard pattern until the listener is
+//closed. the server is subscribed unless a subscription of the mux covers the channel already, onMessage is
+//called from the goroutine of the subscription delivering the message and must not block. the messages may be
+//shared with other listeners and must not be modified.
+func (m *Mux) Listen(channel fayec.Channel, onMessage func(msg *message.Message)) (*Listener, error) {
+	m.reconcileMu.Lock()
+	defer m.reconcileMu.Unlock()
+	l := &Listener{mux: m, pattern: string(channel), onMessage: onMessage}
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, ErrClosed
+	}
+	m.listeners[l] = struct{}{}
+	m.mu.Unlock()
+
+	if err := m.reconcile(); err != nil {
+		m.mu.Lock()
+		delete(m.listeners, l)
+		m.mu.Unlock()
+		//drop a subscription made for the listener before the error
+		m.reconcile()
+		return nil, err
+	}
+	return l, nil
+}
+
+//Pattern returns the channel or wildcard pattern listened to
+func (l *Listener) Pattern() fayec.Channel {
+	return fayec.Channel(l.pattern)
+}
+
+//Close stops the delivery to the listener, the server subscriptions no longer needed are removed and the
+//narrower ones still needed by the other listeners are made
+func (l *Listener) Close() error {
+	m := l.mux
+	m.reconcileMu.Lock()
+	defer m.reconcileMu.Unlock()
+	m.mu.Lock()
+	_, ok := m.listeners[l]
+	delete(m.listeners, l)
+	m.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return m.reconcile()
+}
+
+//Subscriptions returns the patterns subscribed on the server, sorted
+func (m *Mux) Subscriptions() []fayec.Channel {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	patterns := make([]fayec.Channel, 0, len(m.remotes))
+	for pattern := range m.remotes {
+		patterns = append(patterns, fayec.Channel(pattern))
+	}
+	sort.Slice(patterns, func(i, j int) bool { return patterns[i] < patterns[j] })
+	return patterns
+}
+
+//Close closes the listeners and removes the server subscriptions of the mux, the client stays connected
+func (m *Mux) Close() error {
+	m.reconcileMu.Lock()
+	defer m.reconcileMu.Unlock()
+	m.mu.Lock()
+	m.closed = true
+	m.listeners = map[*Listener]struct{}{}
+	m.mu.Unlock()
+	return m.reconcile()
+}
+
+//reconcile subscribes the patterns of the listeners not covered by another one and then removes the
+//subscriptions no longer needed, so the listeners never lack one. reconcileMu must be held
+func (m *Mux) reconcile() error {
+	m.mu.Lock()
+	wanted := m.wanted()
+	var missing []string
+	for pattern := range wanted {
+		if _, ok := m.remotes[pattern]; !ok {
+			missing = append(missing, pattern)
+		}
+	}
+	m.mu.Unlock()
+
+	var errs []error
+	for _, pattern := range missing {
+		//registered first so the messages delivered once acknowledged are fanned out
+		m.mu.Lock()
+		m.seq++
+		r := &remote{pattern: pattern, seq: m.seq}
+		m.remotes[pattern] = r
+		m.mu.Unlock()
+		sub, err := m.client.SubscribeRaw(fayec.Channel(pattern), func(msg *message.Message) {
+			m.deliver(r, msg)
+		})
+		m.mu.Lock()
+		if err != nil {
+			delete(m.remotes, pattern)
+		} else {
+			r.sub = sub
+		}
+		m.mu.Unlock()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		//keep the subscriptions in place, the listeners they cover lack their wider one
+		return errors.Join(errs...)
+	}
+
+	m.mu.Lock()
+	var stale []*remote
+	for pattern, r := range m.remotes {
+		if !wanted[pattern] {
+			stale = append(stale, r)
+			delete(m.remotes, pattern)
+		}
+	}
+	m.mu.Unlock()
+	for _, r := range stale {
+		errs = append(errs, r.sub.Unsubscribe())
+	}
+	return errors.Join(errs...)
+}
+
+//wanted returns the patterns of the listeners not covered by the pattern of another listener. mu must be held
+func (m *Mux) wanted() map[string]bool {
+	wanted := map[string]bool{}
+	for l := range m.listeners {
+		covered := false
+		for other := range m.listeners {
+			if other.pattern != l.pattern && store.Covers(other.pattern, l.pattern) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			wanted[l.pattern] = true
+		}
+	}
+	return wanted
+}
+
+//deliver fans msg out to the listeners of its channel. the client delivers msg to every subscription matching it,
+//only the oldest one fans it out
+func (m *Mux) deliver(r *remote, msg *message.Message) {
+	m.mu.Lock()
+	if m.remotes[r.pattern] != r {
+		m.mu.Unlock()
+		return
+	}
+	for pattern, other := range m.remotes {
+		if other.seq < r.seq && store.Covers(pattern, msg.Channel) {
+			m.mu.Unlock()
+			return
+		}
+	}
+	var listeners []*Listener
+	for l := range m.listeners {
+		if store.Covers(l.pattern, msg.Channel) {
+			listeners = append(listeners, l)
+		}
+	}
+	m.mu.Unlock()
+	for _, l := range listeners {
+		l.onMessage(msg)
+	}
+}
@@ -0,0 +1,120 @@
+package bus
+
+import (
+	fayec "github.com/thesyncim/faye"
+	"github.com/thesyncim/faye/fayeserver"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport/inproc"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newMux(t *testing.T, endpoint string) (*Mux, *fayeserver.Server) {
+	srv := fayeserver.NewServer()
+	t.Cleanup(inproc.Listen(endpoint, srv))
+	client, err := fayec.NewClient("inproc://"+endpoint, fayec.WithTransportName("inproc"),
+		fayec.WithChannelConfig(fayec.ChannelConfig{Pattern: "/**", BufferSize: 10}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Disconnect() })
+	return NewMux(client), srv
+}
+
+func listen(t *testing.T, m *Mux, channel fayec.Channel) (*Listener, chan *message.Message) {
+	received := make(chan *message.Message, 10)
+	l, err := m.Listen(channel, func(msg *message.Message) {
+		received <- msg
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l, received
+}
+
+func expectSubscriptions(t *testing.T, m *Mux, expected ...fayec.Channel) {
+	t.Helper()
+	if got := m.Subscriptions(); len(got)+len(expected) > 0 && !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expecting subscriptions %v got: %v", expected, got)
+	}
+}
+
+//expectDelivered expects a single delivery of data on received
+func expectDelivered(t *testing.T, received chan *message.Message, data string) {
+	t.Helper()
+	select {
+	case msg := <-received:
+		if msg.Data != data {
+			t.Fatalf("expecting %s got: %v", data, msg.Data)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expecting %s delivered", data)
+	}
+	expectNone(t, received)
+}
+
+func expectNone(t *testing.T, received chan *message.Message) {
+	t.Helper()
+	select {
+	case msg := <-received:
+		t.Fatalf("expecting no delivery got: %v", msg.Data)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestMux_Listen(t *testing.T) {
+	m, srv := newMux(t, "bus-listen")
+	defer m.Close()
+
+	eurusd, eurusdReceived := listen(t, m, "/prices/EURUSD")
+	expectSubscriptions(t, m, "/prices/EURUSD")
+	all, allReceived := listen(t, m, "/prices/**")
+	expectSubscriptions(t, m, "/prices/**")
+	if _, err := m.Listen("/prices/EURUSD", func(*message.Message) {}); err != nil {
+		t.Fatal(err)
+	}
+	expectSubscriptions(t, m, "/prices/**")
+
+	if err := srv.Publish("/prices/EURUSD", "1.08"); err != nil {
+		t.Fatal(err)
+	}
+	expectDelivered(t, eurusdReceived, "1.08")
+	expectDelivered(t, allReceived, "1.08")
+	if err := srv.Publish("/prices/GBPUSD", "1.27"); err != nil {
+		t.Fatal(err)
+	}
+	expectDelivered(t, allReceived, "1.27")
+	expectNone(t, eurusdReceived)
+
+	//the narrower subscription is restored for the listeners left
+	if err := all.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expectSubscriptions(t, m, "/prices/EURUSD")
+	if err := srv.Publish("/prices/EURUSD", "1.09"); err != nil {
+		t.Fatal(err)
+	}
+	expectDelivered(t, eurusdReceived, "1.09")
+	expectNone(t, allReceived)
+
+	if err := eurusd.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expectSubscriptions(t, m, "/prices/EURUSD")
+}
+
+func TestMux_Close(t *testing.T) {
+	m, _ := newMux(t, "bus-close")
+	listen(t, m, "/foo")
+	listen(t, m, "/bar/*")
+	expectSubscriptions(t, m, "/bar/*", "/foo")
+
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expectSubscriptions(t, m)
+	if _, err := m.Listen("/foo", func(*message.Message) {}); err != ErrClosed {
+		t.Fatalf("expecting ErrClosed got: %v", err)
+	}
+}
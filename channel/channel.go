@@ -0,0 +1,161 @@
+package channel
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+//ErrInvalidChannel is returned when a channel name is not a valid Bayeux channel or wildcard pattern
+var ErrInvalidChannel = errors.New("invalid channel name")
+
+//ErrMetaChannel is returned when subscribing or publishing to a /meta channel, reserved to the protocol
+var ErrMetaChannel = errors.New("meta channels are reserved to the protocol")
+
+//ErrWildcardPublish is returned when publishing to a wildcard pattern
+var ErrWildcardPublish = errors.New("can't publish to a wildcard channel")
+
+//Channel represents a Bayeux channel name, e.g. /foo/bar, or a wildcard pattern, e.g. /foo/* or /foo/**
+type Channel string
+
+//validName matches the channels in the format /foo/432/bar
+var validName = regexp.MustCompile(`^\/(((([a-z]|[A-Z])|[0-9])|(\-|\_|\!|\~|\(|\)|\$|\@)))+(\/(((([a-z]|[A-Z])|[0-9])|(\-|\_|\!|\~|\(|\)|\$|\@)))+)*$`)
+
+//validPattern matches the wildcard patterns in the format /foo/* or /foo/**
+var validPattern = regexp.MustCompile(`^(\/(((([a-z]|[A-Z])|[0-9])|(\-|\_|\!|\~|\(|\)|\$|\@)))+)*\/\*{1,2}$`)
+
+//New validates name as a channel or wildcard pattern
+func New(name string) (Channel, error) {
+	c := Channel(name)
+	if !c.IsValid() {
+		return "", ErrInvalidChannel
+	}
+	return c, nil
+}
+
+//NewPublish validates name as a channel messages can be published to, wildcard patterns are rejected
+func NewPublish(name string) (Channel, error) {
+	c := Channel(name)
+	if !c.IsPublishable() {
+		return "", ErrInvalidChannel
+	}
+	return c, nil
+}
+
+//Must is like New but panics if name is not valid, for channels known at compile time
+func Must(name string) Channel {
+	c, err := New(name)
+	if err != nil {
+		panic(err.Error() + " `" + name + "`")
+	}
+	return c
+}
+
+//Validate returns an ErrInvalidChannel describing why name is not a valid channel or wildcard pattern,
+//e.g. a missing leading / or an empty segment
+func Validate(name string) error {
+	if Channel(name).IsValid() {
+		return nil
+	}
+	return fmt.Errorf("%w: `%s` %s", ErrInvalidChannel, name, invalidReason(name))
+}
+
+//invalidReason tells why name doesn't match validName nor validPattern
+func invalidReason(name string) string {
+	if name == "" {
+		return "is empty"
+	}
+	if name[0] != '/' {
+		return "must start with /"
+	}
+	segments := strings.Split(name[1:], "/")
+	for i, segment := range segments {
+		switch {
+		case segment == "":
+			return "has an empty segment"
+		case segment == "*" || segment == "**":
+			if i != len(segments)-1 {
+				return "has a wildcard before the last segment"
+			}
+		default:
+			for _, r := range segment {
+				if !isNameRune(r) {
+					return fmt.Sprintf("has the invalid character %q", r)
+				}
+			}
+		}
+	}
+	return "is invalid"
+}
+
+//isNameRune reports whether r is allowed in the segments of the channel names, see validName
+func isNameRune(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_!~()$@", r)
+}
+
+//ValidateSubscribe returns an error describing why name can't be subscribed to
+func ValidateSubscribe(name string) error {
+	c := Channel(name)
+	if err := Validate(name); err != nil {
+		return err
+	}
+	switch {
+	case c.IsMeta():
+		return fmt.Errorf("%w: `%s`", ErrMetaChannel, name)
+	}
+	return nil
+}
+
+//ValidatePublish returns an error describing why messages can't be published to name
+func ValidatePublish(name string) error {
+	c := Channel(name)
+	switch {
+	case c.IsWild() && c.IsValid():
+		return fmt.Errorf("%w: `%s`", ErrWildcardPublish, name)
+	case !c.IsPublishable():
+		return Validate(name)
+	case c.IsMeta():
+		return fmt.Errorf("%w: `%s`", ErrMetaChannel, name)
+	}
+	return nil
+}
+
+func (c Channel) String() string {
+	return string(c)
+}
+
+//IsValid reports whether c is a valid channel or wildcard pattern
+func (c Channel) IsValid() bool {
+	return validName.MatchString(string(c)) || validPattern.MatchString(string(c))
+}
+
+//IsPublishable reports whether c is a valid channel that is not a wildcard pattern
+func (c Channel) IsPublishable() bool {
+	return validName.MatchString(string(c))
+}
+
+//IsMeta reports whether c is a /meta channel, reserved to the protocol
+func (c Channel) IsMeta() bool {
+	return c == "/meta" || strings.HasPrefix(string(c), "/meta/")
+}
+
+//IsService reports whether c is a /service channel, used for request-response messages not broadcast to subscribers
+func (c Channel) IsService() bool {
+	return c == "/service" || strings.HasPrefix(string(c), "/service/")
+}
+
+//IsWild reports whether c is a wildcard pattern, either /foo/* or /foo/**
+func (c Channel) IsWild() bool {
+	return strings.HasSuffix(string(c), "/*") || strings.HasSuffix(string(c), "/**")
+}
+
+//Parent returns the channel one segment up, e.g. /foo for /foo/bar and /foo/*,
+//the empty channel is returned for top level channels
+func (c Channel) Parent() Channel {
+	i := strings.LastIndex(string(c), "/")
+	if i <= 0 {
+		return ""
+	}
+	return c[:i]
+}
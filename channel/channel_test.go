@@ -0,0 +1,139 @@
+package channel
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name        string
+		valid       bool
+		publishable bool
+	}{
+		{name: "/foo", valid: true, publishable: true},
+		{name: "/foo/bar-1", valid: true, publishable: true},
+		{name: "/foo/*", valid: true},
+		{name: "/foo/**", valid: true},
+		{name: "/**", valid: true},
+		{name: "foo"},
+		{name: "/foo/"},
+		{name: "/foo/*/bar"},
+		{name: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.name); (err == nil) != tt.valid {
+				t.Errorf("New(%q) error = %v, want valid %v", tt.name, err, tt.valid)
+			}
+			if _, err := NewPublish(tt.name); (err == nil) != tt.publishable {
+				t.Errorf("NewPublish(%q) error = %v, want publishable %v", tt.name, err, tt.publishable)
+			}
+		})
+	}
+}
+
+func TestChannel_Predicates(t *testing.T) {
+	tests := []struct {
+		channel Channel
+		meta    bool
+		service bool
+		wild    bool
+		parent  Channel
+	}{
+		{channel: "/foo/bar", parent: "/foo"},
+		{channel: "/foo", parent: ""},
+		{channel: "/foo/**", wild: true, parent: "/foo"},
+		{channel: "/meta/connect", meta: true, parent: "/meta"},
+		{channel: "/metadata", parent: ""},
+		{channel: "/service/echo", service: true, parent: "/service"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.channel.String(), func(t *testing.T) {
+			if got := tt.channel.IsMeta(); got != tt.meta {
+				t.Errorf("IsMeta() = %v, want %v", got, tt.meta)
+			}
+			if got := tt.channel.IsService(); got != tt.service {
+				t.Errorf("IsService() = %v, want %v", got, tt.service)
+			}
+			if got := tt.channel.IsWild(); got != tt.wild {
+				t.Errorf("IsWild() = %v, want %v", got, tt.wild)
+			}
+			if got := tt.channel.Parent(); got != tt.parent {
+				t.Errorf("Parent() = %v, want %v", got, tt.parent)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name         string
+		subscribeErr error
+		publishErr   error
+	}{
+		{name: "/foo/bar"},
+		{name: "/foo/**", publishErr: ErrWildcardPublish},
+		{name: "/meta/connect", subscribeErr: ErrMetaChannel, publishErr: ErrMetaChannel},
+		{name: "/meta/**", subscribeErr: ErrMetaChannel, publishErr: ErrWildcardPublish},
+		{name: "/foo/", subscribeErr: ErrInvalidChannel, publishErr: ErrInvalidChannel},
+		{name: "foo", subscribeErr: ErrInvalidChannel, publishErr: ErrInvalidChannel},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateSubscribe(tt.name); !errors.Is(err, tt.subscribeErr) || (err == nil) != (tt.subscribeErr == nil) {
+				t.Errorf("ValidateSubscribe() = %v, want %v", err, tt.subscribeErr)
+			}
+			if err := ValidatePublish(tt.name); !errors.Is(err, tt.publishErr) || (err == nil) != (tt.publishErr == nil) {
+				t.Errorf("ValidatePublish() = %v, want %v", err, tt.publishErr)
+			}
+		})
+	}
+}
+
+func TestValidate_Reason(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"/foo/bar", ""},
+		{"/foo/**", ""},
+		{"", "invalid channel name: `` is empty"},
+		{"foo/bar", "invalid channel name: `foo/bar` must start with /"},
+		{"/foo//bar", "invalid channel name: `/foo//bar` has an empty segment"},
+		{"/foo/", "invalid channel name: `/foo/` has an empty segment"},
+		{"/foo/*/bar", "invalid channel name: `/foo/*/bar` has a wildcard before the last segment"},
+		{"/foo bar", "invalid channel name: `/foo bar` has the invalid character ' '"},
+		{"/foo/b*", "invalid channel name: `/foo/b*` has the invalid character '*'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.name)
+			if tt.expected == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidChannel) || err.Error() != tt.expected {
+				t.Fatalf("Validate() = %v, want %s", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestConfig_QueueSize(t *testing.T) {
+	tests := []struct {
+		bufferSize int
+		expected   int
+	}{
+		{0, DefaultBufferSize},
+		{-1, 0},
+		{10, 10},
+	}
+	for _, tt := range tests {
+		if size := (Config{BufferSize: tt.bufferSize}).QueueSize(); size != tt.expected {
+			t.Fatalf("QueueSize() with BufferSize %d = %d, want %d", tt.bufferSize, size, tt.expected)
+		}
+	}
+}
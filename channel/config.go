@@ -0,0 +1,46 @@
+package channel
+
+//OverflowPolicy defines what happens when a subscription delivery queue is full
+type OverflowPolicy int
+
+const (
+	//DropNewest discards the incoming message, this is the default policy
+	DropNewest OverflowPolicy = iota
+	//DropOldest discards the oldest queued message to make room for the incoming one
+	DropOldest
+	//Block waits until the subscriber consumes the queue, stalling the delivery to all subscriptions
+	Block
+)
+
+//DefaultBufferSize is the number of deliveries queued for each subscription when the config doesn't set BufferSize
+const DefaultBufferSize = 100
+
+//Config represents the quality of service of the channels matching Pattern.
+//the zero value keeps the default behaviour: publishes wait for the server ack, up to DefaultBufferSize
+//deliveries are queued for each subscription, duplicated deliveries are not filtered.
+type Config struct {
+	//Pattern is the channel name or wildcard pattern (/foo/*, /foo/**) the config applies to
+	Pattern string
+	//SkipAck makes publishes to the channel return as soon as the message is sent, without waiting for the server ack
+	SkipAck bool
+	//BufferSize is the number of deliveries queued for each subscription before the Overflow policy applies,
+	//DefaultBufferSize when 0. a negative size leaves the deliveries unbuffered, dropped when the subscriber
+	//is not ready
+	BufferSize int
+	//Overflow is the policy applied when the subscription queue is full
+	Overflow OverflowPolicy
+	//Dedup discards deliveries whose message id was recently delivered to the same subscription
+	Dedup bool
+}
+
+//QueueSize returns the number of deliveries queued for each subscription, see BufferSize
+func (c Config) QueueSize() int {
+	switch {
+	case c.BufferSize == 0:
+		return DefaultBufferSize
+	case c.BufferSize < 0:
+		return 0
+	default:
+		return c.BufferSize
+	}
+}
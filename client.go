@@ -1,28 +1,344 @@
 package fayec
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"github.com/thesyncim/faye/backoff"
+	"github.com/thesyncim/faye/balancer"
+	"github.com/thesyncim/faye/channel"
+	"github.com/thesyncim/faye/clock"
+	"github.com/thesyncim/faye/codec"
+	"github.com/thesyncim/faye/compression"
+	"github.com/thesyncim/faye/credentials"
+	"github.com/thesyncim/faye/idgen"
 	"github.com/thesyncim/faye/internal/dispatcher"
 	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/metrics"
+	"github.com/thesyncim/faye/statestore"
 	"github.com/thesyncim/faye/subscription"
 	"github.com/thesyncim/faye/transport"
+	_ "github.com/thesyncim/faye/transport/longpolling"
 	_ "github.com/thesyncim/faye/transport/websocket"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
 )
 
+//ErrAckTimeout is returned by PublishWithTimeout when the server does not acknowledge the publish in time.
+var ErrAckTimeout = dispatcher.ErrAckTimeout
+
+//ErrReconnectNone is returned by every operation once the server advised the client not to reconnect.
+var ErrReconnectNone = dispatcher.ErrReconnectNone
+
+//ErrReconnectFailed is returned by every operation once the client gave up reconnecting after MaxRetries attempts.
+var ErrReconnectFailed = dispatcher.ErrReconnectFailed
+
+//ErrRehandshake is the cause reported to OnReconnectAttempt when the server advises the client to handshake again.
+var ErrRehandshake = dispatcher.ErrRehandshake
+
+//ErrServerDisconnect is the cause reported to OnReconnectAttempt when the server disconnects the client,
+//or reported to OnError when the connection is driven by the application.
+var ErrServerDisconnect = dispatcher.ErrServerDisconnect
+
+//ErrDisconnected is returned by the operations attempted after Disconnect.
+var ErrDisconnected = dispatcher.ErrDisconnected
+
+//ErrNoEndpoint is returned when neither the url passed to NewClient nor WithEndpoints give an endpoint.
+var ErrNoEndpoint = dispatcher.ErrNoEndpoint
+
+//ErrMultipleClients is the cause reported to OnReconnectAttempt when the client handshakes again because another
+//connection uses its clientId, see WithMultipleClientsRehandshake.
+var ErrMultipleClients = dispatcher.ErrMultipleClients
+
+//ErrMessageDropped is reported to OnError when a message is dropped because the subscription queue is full.
+var ErrMessageDropped = dispatcher.ErrMessageDropped
+
+//ErrQueueFull is returned by the publishes and subscribes that don't fit in the outgoing queue, see WithOutgoingQueue.
+var ErrQueueFull = dispatcher.ErrQueueFull
+
+//ErrRateLimited is returned by the operations exceeding the rate limit with the RateLimitReject policy, see WithRateLimit.
+var ErrRateLimited = dispatcher.ErrRateLimited
+
+//ErrExtensionDropped is returned by the operations whose message is dropped by an extension, see AddExtension.
+var ErrExtensionDropped = message.ErrDropped
+
+//ErrNotService is returned by Request for the channels outside /service.
+var ErrNotService = dispatcher.ErrNotService
+
+//ErrResponseTimeout is returned by SendRawWithResponse when the server doesn't respond in time.
+var ErrResponseTimeout = dispatcher.ErrResponseTimeout
+
+//ErrUnsubscribeTimeout is returned by Unsubscribe when the server doesn't confirm it in time, see WithUnsubscribeTimeout.
+var ErrUnsubscribeTimeout = dispatcher.ErrUnsubscribeTimeout
+
+//ErrClosing is returned by the publishes, subscribes, batches and requests attempted while Close runs.
+var ErrClosing = dispatcher.ErrClosing
+
+//ErrScheduleCanceled is the error of a publish canceled before its deadline, see PublishAt.
+var ErrScheduleCanceled = dispatcher.ErrScheduleCanceled
+
+//ErrHandshakeTimeout is returned when the server doesn't answer the handshake in time, see WithHandshakeTimeout.
+var ErrHandshakeTimeout = dispatcher.ErrHandshakeTimeout
+
+//ErrSubscribeTimeout is returned by Subscribe when the server doesn't confirm it in time, see WithSubscribeTimeout.
+var ErrSubscribeTimeout = dispatcher.ErrSubscribeTimeout
+
+//ErrPayloadTooLarge is returned when publishing a binary payload larger than the limit, see WithBinaryLimits.
+var ErrPayloadTooLarge = dispatcher.ErrPayloadTooLarge
+
+//ErrUnexpectedMessage is reported to OnError when the server sends a message unrelated to any request.
+var ErrUnexpectedMessage = dispatcher.ErrUnexpectedMessage
+
+//ErrInvalidMessage is reported to OnError when the server sends a message that isn't a valid Bayeux envelope.
+var ErrInvalidMessage = dispatcher.ErrInvalidMessage
+
+//ErrStagedRestore is returned by NewClientFromState for the clients created WithStagedConnect.
+var ErrStagedRestore = errors.New("the state can't be restored with a staged connect")
+
+//ErrTimeout is matched by errors.Is on the errors of the operations that timed out, e.g. ErrAckTimeout.
+var ErrTimeout = dispatcher.ErrTimeout
+
+//ErrConnectionClosed is matched by errors.Is on the errors of the operations attempted once the client is
+//terminally disconnected, e.g. ErrDisconnected, ErrReconnectNone or ErrReconnectFailed.
+var ErrConnectionClosed = dispatcher.ErrConnectionClosed
+
+//ErrHandshakeDenied is matched by errors.Is on the errors of the handshakes the server rejected.
+var ErrHandshakeDenied = dispatcher.ErrHandshakeDenied
+
+//ErrSubscriptionFailed is matched by errors.Is on the errors of the subscribes the server rejected.
+var ErrSubscriptionFailed = dispatcher.ErrSubscriptionFailed
+
+//SubscriptionError is returned by Subscribe when the server rejects the subscribe, see errors.As.
+type SubscriptionError = dispatcher.SubscriptionError
+
+//BayeuxError is the error sent by the server, with its code, arguments and description, see errors.As.
+type BayeuxError = message.Error
+
+//ErrInvalidChannel is returned by Subscribe and Publish for malformed channel names.
+var ErrInvalidChannel = channel.ErrInvalidChannel
+
+//ErrMetaChannel is returned by Subscribe and Publish for /meta channels, reserved to the protocol.
+var ErrMetaChannel = channel.ErrMetaChannel
+
+//ErrWildcardPublish is returned by Publish for wildcard channels.
+var ErrWildcardPublish = channel.ErrWildcardPublish
+
+//PanicError is returned or reported in place of a panic in a message handler or an extension.
+type PanicError = message.PanicError
+
+//Channel represents a channel name or wildcard pattern, see channel.New to validate it upfront.
+type Channel = channel.Channel
+
+//ReconnectAttempt describes an attempt to restore the connection, see OnReconnectAttempt.
+type ReconnectAttempt = dispatcher.ReconnectAttempt
+
+//ServerInfo describes the server as negotiated by the handshake, see ServerInfo. when the server doesn't support
+//the transport of the client, the client handshakes again with another registered transport it supports.
+type ServerInfo = dispatcher.ServerInfo
+
+//SessionInfo describes the session established with the server, see Session.
+type SessionInfo = dispatcher.SessionInfo
+
+//SubscriptionInfo is a snapshot of a subscription, see Subscriptions.
+type SubscriptionInfo = subscription.Info
+
+//State represents the lifecycle of the client session, see State and OnStateChange.
+type State = dispatcher.State
+
+const (
+	//StateUnconnected is the state before the first handshake, or after it failed.
+	StateUnconnected = dispatcher.StateUnconnected
+	//StateConnecting is the state while handshaking, or reconnecting after the connection was lost.
+	StateConnecting = dispatcher.StateConnecting
+	//StateConnected is the state once the server accepted the handshake.
+	StateConnected = dispatcher.StateConnected
+	//StateDisconnected is the final state, after Disconnect or once the client gave up reconnecting.
+	StateDisconnected = dispatcher.StateDisconnected
+	//StateSuspended is the state while the session is suspended, see Client.Suspend.
+	StateSuspended = dispatcher.StateSuspended
+)
+
+//EventType identifies a transition of the client lifecycle, see Client.On.
+type EventType = dispatcher.EventType
+
+const (
+	//EventHandshake is emitted with the successful handshake response.
+	EventHandshake = dispatcher.EventHandshake
+	//EventConnected is emitted when the session becomes connected, after a handshake or a reconnection.
+	EventConnected = dispatcher.EventConnected
+	//EventDisconnected is emitted once, when the client is terminally disconnected.
+	EventDisconnected = dispatcher.EventDisconnected
+	//EventReconnectScheduled is emitted before every reconnect attempt, with its delay and endpoint.
+	EventReconnectScheduled = dispatcher.EventReconnectScheduled
+	//EventSubscriptionAdded is emitted once the server acknowledged a subscription.
+	EventSubscriptionAdded = dispatcher.EventSubscriptionAdded
+	//EventSubscriptionRemoved is emitted when a subscription is removed, unsubscribed or dropped.
+	EventSubscriptionRemoved = dispatcher.EventSubscriptionRemoved
+	//EventMessageSent is emitted with every message handed to the transport.
+	EventMessageSent = dispatcher.EventMessageSent
+	//EventMessageReceived is emitted with every message received, once the incoming extensions passed it on.
+	EventMessageReceived = dispatcher.EventMessageReceived
+	//EventError is emitted with the asynchronous errors not returned to a caller.
+	EventError = dispatcher.EventError
+)
+
+//Event describes a transition of the client lifecycle, only the fields relevant to its Type are set.
+type Event = dispatcher.Event
+
+//QueuePolicy decides what happens to a publish or subscribe queued while the outgoing queue is full,
+//see WithOutgoingQueue.
+type QueuePolicy = dispatcher.QueuePolicy
+
+const (
+	//QueueBlock waits for room in the queue until the operation context is done.
+	QueueBlock = dispatcher.QueueBlock
+	//QueueDropOldest fails the oldest operation queued with ErrQueueFull.
+	QueueDropOldest = dispatcher.QueueDropOldest
+	//QueueDropNew fails the operation with ErrQueueFull.
+	QueueDropNew = dispatcher.QueueDropNew
+)
+
+//RateLimitPolicy decides what happens to a publish or subscribe exceeding the rate limit, see WithRateLimitPolicy.
+type RateLimitPolicy = dispatcher.RateLimitPolicy
+
+const (
+	//RateLimitBlock waits until the operation can be sent or its context is done.
+	RateLimitBlock = dispatcher.RateLimitBlock
+	//RateLimitReject fails the operation with ErrRateLimited.
+	RateLimitReject = dispatcher.RateLimitReject
+)
+
+//ResubscribePolicy decides what happens to a subscription whose channel the server rejects while it is restored
+//on a new session, see WithResubscribePolicy.
+type ResubscribePolicy = subscription.ResubscribePolicy
+
+const (
+	//DropOnReject closes the subscription with the error, reported to OnError.
+	DropOnReject = subscription.DropOnReject
+	//FailOnReject terminates the client with the error.
+	FailOnReject = subscription.FailOnReject
+	//RetryOnReject keeps the subscription and subscribes again at the pace of the retry policy.
+	RetryOnReject = subscription.RetryOnReject
+)
+
+//PauseMode decides what happens to the messages of a paused subscription, see Subscription.Pause.
+type PauseMode = subscription.PauseMode
+
+const (
+	//PauseBuffer keeps queuing the messages while paused, the default.
+	PauseBuffer = subscription.PauseBuffer
+	//PauseUnsubscribe unsubscribes the channel on the server while paused.
+	PauseUnsubscribe = subscription.PauseUnsubscribe
+)
+
+//DeliveryMode is the delivery guarantee of a subscription, see WithDelivery.
+type DeliveryMode = subscription.DeliveryMode
+
+const (
+	//AtMostOnce delivers the messages as received, the default.
+	AtMostOnce = subscription.AtMostOnce
+	//AtLeastOnce requests the messages missed when the channel is subscribed again and drops the duplicates.
+	AtLeastOnce = subscription.AtLeastOnce
+)
+
+//ScheduledPublish is a publish held until its deadline, see PublishAt. Cancel removes it, Done is closed once
+//it was sent and acknowledged, failed or canceled, and Err returns its error.
+type ScheduledPublish = dispatcher.Scheduled
+
+//ChannelConfig represents the quality of service of the channels matching its Pattern.
+type ChannelConfig = channel.Config
+
 type options struct {
-	transport     transport.Transport
-	transportOpts transport.Options
-	extensions    message.Extensions
+	transport      transport.Transport
+	transportName  string
+	transportOpts  transport.Options
+	extensions     message.Extensions
+	pipes          []message.Pipe
+	channelConfigs []ChannelConfig
+	replayBuffer   int
+	queueSize      int
+	queuePolicy    QueuePolicy
+	retryPolicy    backoff.Policy
+	resubscribe    ResubscribePolicy
+	slowConsumer   time.Duration
+	workers        int
+	idGenerator    idgen.Generator
+	credentials    credentials.Provider
+	logger         *slog.Logger
+	metrics        metrics.Collector
+
+	beforeHandshake   []func(m *message.Message)
+	handshakeComplete []func(resp *message.Message)
+	metaObservers     []func(msg *message.Message)
+
+	staged         bool
+	manualConnect  bool
+	connectTimeout *time.Duration
+	channelPrefix  string
+	balancer       *balancer.Balancer
+	failover       []string
+	middlewares    []Middleware
+	parseMode      message.ParseMode
+	numberMode     message.NumberMode
+	keepRawData    bool
+
+	//multipleClientsRehandshake handshakes again on multiple-clients advice
+	multipleClientsRehandshake bool
+	compression                []compression.Codec
+	//unsubscribeTimeout is set by WithUnsubscribeTimeout, the dispatcher default applies when nil
+	unsubscribeTimeout *time.Duration
+
+	publishTimeout time.Duration
+	publishRetries int
+	//idleSuspend and wakeInterval are set by WithSuspendOnIdle
+	idleSuspend  time.Duration
+	wakeInterval time.Duration
+	//ackExtension enables the CometD acknowledged messages extension
+	ackExtension bool
+	//handshakeTimeout, subscribeTimeout and requestTimeout bound the meta operations, zero doesn't
+	handshakeTimeout time.Duration
+	subscribeTimeout time.Duration
+	requestTimeout   time.Duration
+	//maxBinarySize and chunkSize are set by WithBinaryLimits
+	maxBinarySize int
+	chunkSize     int
+	//rateLimit, rateBurst, ratePolicy and rateSubscribes are set by WithRateLimit and WithRateLimitPolicy
+	rateLimit      float64
+	rateBurst      int
+	ratePolicy     RateLimitPolicy
+	rateSubscribes bool
 }
 
+//defaultTransport is the transport of the clients that don't set one
+const defaultTransport = "websocket"
+
 var defaultOpts = options{
-	transport: transport.GetTransport("websocket"),
+	transportName: defaultTransport,
+}
+
+//validate checks the options before the client allocates anything, see WithChannelConfig and WithChannelPrefix
+func (o *options) validate() error {
+	for i := range o.channelConfigs {
+		if !subscription.IsValidSubscriptionName(o.channelConfigs[i].Pattern) {
+			return subscription.ErrInvalidChannelName
+		}
+	}
+	if o.channelPrefix != "" && !subscription.IsValidPublishName(o.channelPrefix) {
+		return subscription.ErrInvalidChannelName
+	}
+	return nil
 }
 
 //https://faye.jcoglan.com/architecture.html
 type client interface {
 	Disconnect() error
-	Subscribe(subscription string) (*subscription.Subscription, error)
-	Publish(subscription string, message message.Data) error
+	Subscribe(subscription Channel, opts ...SubscribeOption) (*subscription.Subscription, error)
+	Publish(subscription Channel, message message.Data) error
 
 	//SetOnTransportDownHandler(onTransportDown func(err error))
 	//SetOnTransportUpHandler(onTransportUp func())
@@ -33,52 +349,608 @@ type Option func(*options)
 
 var _ client = (*Client)(nil)
 
+//errorsBuffer is the number of errors queued by the Errors channel before the new ones are dropped
+const errorsBuffer = 64
+
 // Client represents a client connection to an faye server.
+//its methods are safe for concurrent use, e.g. publishing and subscribing from many goroutines.
 type Client struct {
 	opts       options
 	dispatcher *dispatcher.Dispatcher
+	//op runs the operations through the middlewares
+	op Operation
+
+	errorsOnce sync.Once
+	errors     chan error
+	//fatal receives the error terminating the client, see Err
+	fatal chan error
 }
 
 //NewClient creates a new faye client with the provided options and connect to the specified url.
+//the url can be a srv://_faye._tcp.example.com/faye (or srvs:// for wss) name, in that case the targets
+//are resolved using DNS SRV records and tried in priority and weight order.
 func NewClient(url string, opts ...Option) (*Client, error) {
 	var c Client
 	c.opts = defaultOpts
 	for _, opt := range opts {
 		opt(&c.opts)
 	}
+	if err := c.opts.validate(); err != nil {
+		return nil, err
+	}
+	if c.opts.transport == nil {
+		t, err := transport.New(c.opts.transportName)
+		if err != nil {
+			return nil, err
+		}
+		c.opts.transport = t
+	}
 
+	//each client counts its own coercions
+	c.opts.transportOpts.Parser = &message.Parser{
+		Mode:        c.opts.parseMode,
+		Numbers:     c.opts.numberMode,
+		KeepRawData: c.opts.keepRawData,
+	}
+	c.op = chain(c.operation, c.opts.middlewares)
 	c.dispatcher = dispatcher.NewDispatcher(url, c.opts.transportOpts, c.opts.extensions)
 	c.dispatcher.SetTransport(c.opts.transport)
-	err := c.dispatcher.Connect()
-	if err != nil {
+	for i := range c.opts.pipes {
+		c.dispatcher.AddExtension(c.opts.pipes[i])
+	}
+	c.fatal = make(chan error, 1)
+	c.dispatcher.OnDisconnect(func(err error) {
+		if err != dispatcher.ErrDisconnected {
+			c.fatal <- err
+		}
+		close(c.fatal)
+	})
+	//validated already
+	c.dispatcher.SetChannelConfigs(c.opts.channelConfigs)
+	c.dispatcher.SetChannelPrefix(c.opts.channelPrefix)
+	c.dispatcher.SetFailoverEndpoints(c.opts.failover)
+	if c.opts.balancer != nil {
+		c.dispatcher.SetBalancer(c.opts.balancer)
+	}
+	c.dispatcher.SetReplayBuffer(c.opts.replayBuffer)
+	c.dispatcher.SetQueue(c.opts.queueSize, c.opts.queuePolicy)
+	c.dispatcher.SetRetryPolicy(c.opts.retryPolicy)
+	c.dispatcher.SetResubscribePolicy(c.opts.resubscribe)
+	c.dispatcher.SetSlowConsumerThreshold(c.opts.slowConsumer)
+	c.dispatcher.SetWorkers(c.opts.workers)
+	c.dispatcher.SetIDGenerator(c.opts.idGenerator)
+	c.dispatcher.SetCredentials(c.opts.credentials)
+	c.dispatcher.SetLogger(c.opts.logger)
+	c.dispatcher.SetMetrics(c.opts.metrics)
+	c.dispatcher.SetManualConnect(c.opts.manualConnect)
+	c.dispatcher.SetMultipleClientsRehandshake(c.opts.multipleClientsRehandshake)
+	c.dispatcher.SetCompression(c.opts.compression)
+	c.dispatcher.SetPublishTimeout(c.opts.publishTimeout)
+	c.dispatcher.SetPublishRetries(c.opts.publishRetries)
+	c.dispatcher.SetIdleSuspend(c.opts.idleSuspend, c.opts.wakeInterval)
+	c.dispatcher.SetAckExtension(c.opts.ackExtension)
+	if c.opts.connectTimeout != nil {
+		c.dispatcher.SetConnectTimeout(*c.opts.connectTimeout)
+	}
+	c.dispatcher.SetHandshakeTimeout(c.opts.handshakeTimeout)
+	c.dispatcher.SetSubscribeTimeout(c.opts.subscribeTimeout)
+	c.dispatcher.SetRequestTimeout(c.opts.requestTimeout)
+	c.dispatcher.SetBinaryLimits(c.opts.maxBinarySize, c.opts.chunkSize)
+	c.dispatcher.SetRateLimit(c.opts.rateLimit, c.opts.rateBurst, c.opts.ratePolicy, c.opts.rateSubscribes)
+	if c.opts.unsubscribeTimeout != nil {
+		c.dispatcher.SetUnsubscribeTimeout(*c.opts.unsubscribeTimeout)
+	} else if c.opts.requestTimeout > 0 {
+		c.dispatcher.SetUnsubscribeTimeout(c.opts.requestTimeout)
+	}
+	for i := range c.opts.beforeHandshake {
+		c.dispatcher.OnBeforeHandshake(c.opts.beforeHandshake[i])
+	}
+	for i := range c.opts.handshakeComplete {
+		c.dispatcher.OnHandshakeComplete(c.opts.handshakeComplete[i])
+	}
+	for i := range c.opts.metaObservers {
+		c.dispatcher.OnMeta(c.opts.metaObservers[i])
+	}
+	if c.opts.staged {
+		return &c, nil
+	}
+	if err := c.dispatcher.Start(); err != nil {
+		//the connection dialed and the session accepted are not handed to anyone
+		c.dispatcher.Abort(err)
 		return nil, err
 	}
 
 	return &c, nil
 }
 
+//NewClientFromState is like NewClient but resumes the client whose state was saved in store, e.g. by a process
+//that crashed: the channels are subscribed again, requesting the messages following the last ones delivered when
+//WithReplayBuffer is set or by the AtLeastOnce subscriptions, and the publishes left pending are sent. the state
+//of the client is then saved to store whenever it changes. the subscriptions restored are returned in the order
+//they were created, the channels the server rejects are left out and their errors returned joined, along with the
+//client.
+func NewClientFromState(url string, store statestore.Store, opts ...Option) (*Client, []*subscription.Subscription, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.staged {
+		return nil, nil, ErrStagedRestore
+	}
+	state, err := store.Load()
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := NewClient(url, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.dispatcher.RestoreReplayIDs(state.ReplayIDs)
+	var (
+		subs []*subscription.Subscription
+		errs []error
+	)
+	for _, name := range state.Subscriptions {
+		//the channels with a replay id keep being tracked
+		mode := AtMostOnce
+		if _, ok := state.ReplayIDs[name]; ok {
+			mode = AtLeastOnce
+		}
+		sub, err := c.Subscribe(Channel(name), WithDelivery(mode))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		subs = append(subs, sub)
+	}
+	if err = c.dispatcher.SendPending(context.Background(), state.Pending); err != nil {
+		errs = append(errs, err)
+	}
+	c.dispatcher.SetStateStore(store)
+	return c, subs, errors.Join(errs...)
+}
+
+//Handshake dials the server and negotiates the connection, returning the server handshake response.
+//it is only needed for clients created WithStagedConnect, Connect must be called next.
+func (c *Client) Handshake(ctx context.Context) (*message.Message, error) {
+	return c.dispatcher.Handshake(ctx)
+}
+
+//Connect establishes the connection after a successful Handshake, returning the server connect response.
+//it is only needed for clients created WithStagedConnect, the next connects are sent by the client.
+func (c *Client) Connect(ctx context.Context) (*message.Message, error) {
+	return c.dispatcher.Connect(ctx)
+}
+
+//Subscriptions returns a snapshot of the subscriptions of the client, oldest first.
+func (c *Client) Subscriptions() []SubscriptionInfo {
+	return c.dispatcher.Subscriptions()
+}
+
+//Resubscribe subscribes again the channels of the subscriptions and waits for the server confirmations. it is
+//meant for clients driving their connection, e.g. WithManualConnect, after a Handshake established a new
+//session: the automatic reconnect resubscribes on its own. the subscriptions of the channels rejected are
+//closed, see Subscription.OnError, and their errors are returned joined.
+func (c *Client) Resubscribe(ctx context.Context) error {
+	return c.dispatcher.Resubscribe(ctx)
+}
+
+//Poll issues a single /meta/connect and waits for its response, messages delivered in the meantime are
+//dispatched to the subscriptions. it is meant for clients created WithManualConnect, which must keep
+//polling for the session to stay alive and, depending on the transport, for responses to be read.
+func (c *Client) Poll(ctx context.Context) (*message.Message, error) {
+	return c.dispatcher.Connect(ctx)
+}
+
+//SubscriptionMiddleware transforms, filters or drops the messages of a single subscription before they are
+//queued, see WithSubscriptionMiddleware
+type SubscriptionMiddleware = subscription.Middleware
+
+//SubscribeOption sets the options of a subscribe, such as its middlewares
+type SubscribeOption func(req *Request)
+
+//WithSubscriptionMiddleware runs the middlewares in order on every message received for the subscription, e.g.
+//to validate, decrypt or deduplicate the payloads of a channel. a middleware returning nil or an error drops the
+//message, the errors are reported to OnError.
+func WithSubscriptionMiddleware(middlewares ...SubscriptionMiddleware) SubscribeOption {
+	return func(req *Request) {
+		req.Middlewares = append(req.Middlewares, middlewares...)
+	}
+}
+
+//WithFilter delivers only the messages the predicate returns true for, e.g. the ones whose data has the type
+//order. the filters are evaluated in order with the middlewares, before the messages are queued.
+func WithFilter(predicate func(msg *message.Message) bool) SubscribeOption {
+	return WithSubscriptionMiddleware(subscription.Filter(predicate))
+}
+
+//WithSubscriptionResubscribePolicy overrides the policy of WithResubscribePolicy for the subscription
+func WithSubscriptionResubscribePolicy(policy ResubscribePolicy) SubscribeOption {
+	return func(req *Request) {
+		req.ResubscribePolicy = policy
+	}
+}
+
+//WithDelivery sets the delivery guarantee of the subscription. AtLeastOnce keeps the id of the last message
+//delivered on the channel and requests the ones following it from replay capable servers whenever the channel is
+//subscribed again, e.g. on a new session, and drops the messages delivered twice by id. combine it with
+//WithAckExtension so the server delivers again the messages lost with a connection, and with NewClientFromState
+//so the ids survive a restart. the wildcard subscriptions are deduplicated but not replayed.
+func WithDelivery(mode DeliveryMode) SubscribeOption {
+	return func(req *Request) {
+		req.Delivery = mode
+	}
+}
+
+//WithPauseMode sets what happens to the messages received while the subscription is paused, see
+//Subscription.Pause: PauseBuffer keeps them queued up to the BufferSize of WithChannelConfig, PauseUnsubscribe
+//stops the server from sending them until the subscription resumes.
+func WithPauseMode(mode PauseMode) SubscribeOption {
+	return func(req *Request) {
+		req.PauseMode = mode
+	}
+}
+
+//WithLifetime removes the subscription when ctx is done, so a forgotten handler doesn't keep the channel
+//subscribed forever: the handlers return and the subscription Context is canceled. unsubscribe errors are
+//reported to OnError.
+func WithLifetime(ctx context.Context) SubscribeOption {
+	return func(req *Request) {
+		req.Lifetime = ctx
+	}
+}
+
 //Subscribe informs the server that messages published to that channel are delivered to itself.
-func (c *Client) Subscribe(subscription string) (*subscription.Subscription, error) {
-	return c.dispatcher.Subscribe(subscription)
+func (c *Client) Subscribe(subscription Channel, opts ...SubscribeOption) (*subscription.Subscription, error) {
+	return c.SubscribeCtx(context.Background(), subscription, opts...)
+}
+
+//SubscribeCtx is like Subscribe but gives up waiting for the server acknowledgement when ctx is done,
+//returning the context error. ctx is passed to the middlewares, it doesn't bound the subscription once
+//acknowledged, see WithLifetime.
+func (c *Client) SubscribeCtx(ctx context.Context, subscription Channel, opts ...SubscribeOption) (*subscription.Subscription, error) {
+	req := &Request{Kind: OpSubscribe, Channel: subscription}
+	for _, opt := range opts {
+		opt(req)
+	}
+	if err := c.do(ctx, req); err != nil {
+		return nil, err
+	}
+	return req.Subscription, nil
+}
+
+//SubscribeFunc is like Subscribe but calls onMessage from an internal goroutine with every message delivered,
+//until the subscription is removed, e.g. with Subscription.Unsubscribe. it returns once the server acknowledged
+//the subscribe. a panic in onMessage stops the delivery and is reported to OnError.
+func (c *Client) SubscribeFunc(subscription Channel, onMessage func(channel string, msg message.Data), opts ...SubscribeOption) (*subscription.Subscription, error) {
+	sub, err := c.Subscribe(subscription, opts...)
+	if err != nil {
+		return nil, err
+	}
+	c.dispatcher.HandleMessages(sub, onMessage)
+	return sub, nil
+}
+
+//SubscribeFiltered is like SubscribeFunc but onMessage only receives the messages the predicate returns true for,
+//see WithFilter. every subscription of a channel has its own filters and handler, the server subscription is shared.
+func (c *Client) SubscribeFiltered(subscription Channel, predicate func(msg *message.Message) bool, onMessage func(channel string, msg message.Data), opts ...SubscribeOption) (*subscription.Subscription, error) {
+	return c.SubscribeFunc(subscription, onMessage, append([]SubscribeOption{WithFilter(predicate)}, opts...)...)
+}
+
+//SubscribeRaw is like SubscribeFunc but onMessage receives the whole messages delivered instead of their data,
+//e.g. to read their id, ext or clientId. the messages may be shared with other subscriptions and must not be modified.
+func (c *Client) SubscribeRaw(subscription Channel, onMessage func(msg *message.Message), opts ...SubscribeOption) (*subscription.Subscription, error) {
+	sub, err := c.Subscribe(subscription, opts...)
+	if err != nil {
+		return nil, err
+	}
+	c.dispatcher.HandleRawMessages(sub, onMessage)
+	return sub, nil
+}
+
+//Unsubscribe removes all the subscriptions whose channel is covered by the channel or wildcard pattern,
+//e.g. /chat/** removes /chat/foo, /chat/foo/bar and /chat/*. the server is notified in a single batch.
+func (c *Client) Unsubscribe(pattern Channel) error {
+	return c.do(context.Background(), &Request{Kind: OpUnsubscribe, Channel: pattern})
 }
 
-//Publish publishes events on a channel by sending event messages, the server MAY  respond to a publish event
-//if this feature is supported by the server use the OnPublishResponse to get the publish status.
-func (c *Client) Publish(subscription string, data message.Data) (err error) {
-	return c.dispatcher.Publish(subscription, data)
+//UnsubscribeAll removes all subscriptions, the server is notified in a single batch.
+func (c *Client) UnsubscribeAll() error {
+	return c.Unsubscribe("/**")
 }
 
-//Disconnect closes all subscriptions and inform the server to remove any client-related state.
-//any subsequent method call to the client object will result in undefined behaviour.
+//Publish publishes events on a channel by sending event messages and returns the server response to that
+//message, correlated by its id. publishes to the channels configured with SkipAck return once sent.
+func (c *Client) Publish(subscription Channel, data message.Data) (err error) {
+	return c.PublishWithTimeout(subscription, data, 0)
+}
+
+//PublishJSON publishes v encoded as json, e.g. a struct, without converting it to a map first.
+//encoding errors are returned before anything is sent.
+func (c *Client) PublishJSON(subscription Channel, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.Publish(subscription, json.RawMessage(data))
+}
+
+//PublishWithTimeout is like Publish but gives up waiting for the server acknowledgement after timeout,
+//returning ErrAckTimeout. An acknowledgement arriving after the timeout is discarded.
+func (c *Client) PublishWithTimeout(subscription Channel, data message.Data, timeout time.Duration) error {
+	return c.do(context.Background(), &Request{Kind: OpPublish, Channel: subscription, Data: data, Timeout: timeout})
+}
+
+//PublishWithAck is like PublishCtx but always waits for the server response to the publish, even on the
+//channels configured with SkipAck, e.g. for the occasional message whose delivery matters on a fast channel.
+//see WithPublishTimeout and WithPublishRetries to bound the wait and retry the publishes lost on reconnect.
+func (c *Client) PublishWithAck(ctx context.Context, subscription Channel, data message.Data) error {
+	return c.do(ctx, &Request{Kind: OpPublish, Channel: subscription, Data: data, RequireAck: true})
+}
+
+//PublishCtx is like Publish but gives up waiting for the server acknowledgement when ctx is done,
+//returning the context error. ctx is passed to the middlewares and the context extensions.
+func (c *Client) PublishCtx(ctx context.Context, subscription Channel, data message.Data) error {
+	return c.do(ctx, &Request{Kind: OpPublish, Channel: subscription, Data: data})
+}
+
+//PublishAt holds the publish until t and then publishes the data as Publish does, the clock of WithClock tells
+//the time. a publish due while the connection is restored is queued until it is, see WithOutgoingQueue. the
+//publishes still scheduled when the client is terminated fail with the error, they are not kept across processes.
+func (c *Client) PublishAt(subscription Channel, data message.Data, t time.Time) (*ScheduledPublish, error) {
+	if err := channel.ValidatePublish(string(subscription)); err != nil {
+		return nil, err
+	}
+	return c.dispatcher.Schedule(t, func(ctx context.Context) error {
+		return c.do(ctx, &Request{Kind: OpPublish, Channel: subscription, Data: data})
+	})
+}
+
+//PublishAfter is like PublishAt but publishes once the delay elapsed
+func (c *Client) PublishAfter(subscription Channel, data message.Data, delay time.Duration) (*ScheduledPublish, error) {
+	return c.PublishAt(subscription, data, clock.Or(c.opts.transportOpts.Clock).Now().Add(delay))
+}
+
+//Close shuts the client down gracefully, unlike Disconnect: the publishes, subscribes, batches and requests
+//attempted meanwhile fail with ErrClosing, the queued publishes are sent and acknowledged, once reconnected if a
+//reconnection is in flight, the channels are unsubscribed, the server is informed, the connection is closed and
+//the running SubscribeFunc and SubscribeRaw handlers return. every step is bounded by ctx, the client is
+//disconnected anyway once it is done, e.g. on a signal:
+//
+//	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+//	defer stop()
+//	<-ctx.Done()
+//	closeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+//	defer cancel()
+//	client.Close(closeCtx)
+func (c *Client) Close(ctx context.Context) error {
+	return c.dispatcher.Close(ctx)
+}
+
+//Request publishes data to a /service channel and returns the data of the reply the server delivers to this
+//client, correlated by message id. it gives up when ctx is done, e.g. context.WithTimeout bounds the wait.
+func (c *Client) Request(ctx context.Context, service Channel, data message.Data) (message.Data, error) {
+	return c.dispatcher.Request(ctx, string(service), data)
+}
+
+//SendRaw sends a message as is, after applying the outgoing extensions, for non-standard meta or service
+//messages not modeled by the client API. Id and ClientId are set if empty, the server response is discarded.
+func (c *Client) SendRaw(m *message.Message) error {
+	return c.dispatcher.SendRaw(m)
+}
+
+//SendRawWithResponse is like SendRaw but returns the server response correlated by message id,
+//waiting at most timeout (zero waits forever) before returning ErrResponseTimeout.
+func (c *Client) SendRawWithResponse(m *message.Message, timeout time.Duration) (*message.Message, error) {
+	return c.dispatcher.SendRawWithResponse(m, timeout)
+}
+
+//Disconnect waits for the publishes in flight, informs the server to remove any client-related state and waits
+//for its response, then closes the connection and all subscriptions. both waits are bounded by a few seconds.
+//the operations attempted afterwards fail with ErrDisconnected.
 func (c *Client) Disconnect() error {
 	return c.dispatcher.Disconnect()
 }
 
+//DisconnectCtx is like Disconnect but gives up waiting for the publishes in flight and the server response
+//when ctx is done, the client is disconnected anyway.
+func (c *Client) DisconnectCtx(ctx context.Context) error {
+	return c.dispatcher.DisconnectCtx(ctx)
+}
+
+//Suspend drops the connection to the server but remembers the subscriptions, e.g. to save the battery of an idle
+//mobile client. the session is resumed transparently by the next publish, subscribe or request, their handlers
+//receive nothing meanwhile. see WithSuspendOnIdle to suspend it automatically.
+func (c *Client) Suspend(ctx context.Context) error {
+	return c.dispatcher.Suspend(ctx)
+}
+
+//Resume handshakes again and restores the subscriptions of a suspended session, it is a no-op otherwise.
+func (c *Client) Resume(ctx context.Context) error {
+	return c.dispatcher.Resume(ctx)
+}
+
+//State returns the current state of the client session.
+func (c *Client) State() State {
+	return c.dispatcher.State()
+}
+
+//OnStateChange registers a handler called on every state change of the client session.
+func (c *Client) OnStateChange(onChange func(from, to State)) {
+	c.dispatcher.OnStateChange(onChange)
+}
+
+//OnDisconnect registers a handler called once the client becomes terminally disconnected,
+//e.g. when the server advises reconnect none. pending operations fail with the same error.
+func (c *Client) OnDisconnect(onDisconnect func(err error)) {
+	c.dispatcher.OnDisconnect(onDisconnect)
+}
+
+//OnReconnectAttempt registers a handler called before every attempt to restore a connection that went down,
+//with the attempt number, the delay before it, the error of the previous attempt and the endpoint tried.
+func (c *Client) OnReconnectAttempt(onAttempt func(attempt ReconnectAttempt)) {
+	c.dispatcher.OnReconnectAttempt(onAttempt)
+}
+
+//OnRetry registers a handler called before every reconnect attempt with the attempt number, starting from 1,
+//and the error of the previous attempt. see OnReconnectAttempt for the delay and the endpoint.
+func (c *Client) OnRetry(onRetry func(attempt int, err error)) {
+	c.dispatcher.OnReconnectAttempt(func(attempt ReconnectAttempt) {
+		onRetry(attempt.Attempt, attempt.Err)
+	})
+}
+
+//OnConnectionLost registers a handler called with the cause when the connection is lost, before the client
+//starts reconnecting. see OnReconnectAttempt and OnReconnect.
+func (c *Client) OnConnectionLost(onLost func(err error)) {
+	c.dispatcher.OnConnectionLost(onLost)
+}
+
+//OnReconnect registers a handler called once the connection is restored: the client handshook again
+//and resubscribed its channels.
+func (c *Client) OnReconnect(onReconnect func()) {
+	c.dispatcher.OnReconnect(onReconnect)
+}
+
+//Advice returns the last advice received from the server, e.g. the interval and the timeout of the connects,
+//the zero value if none was received yet
+func (c *Client) Advice() message.Advise {
+	if advice := c.dispatcher.Advice(); advice != nil {
+		return *advice
+	}
+	return message.Advise{}
+}
+
+//OnAdvice registers a handler called with every advice received from the server, e.g. to alert when the server
+//advises reconnect none
+func (c *Client) OnAdvice(onAdvice func(advice message.Advise)) {
+	c.dispatcher.OnAdvice(onAdvice)
+}
+
+//OnMultipleClients registers a handler called with every server advice reporting that another connection
+//is using the clientId of the client, see WithMultipleClientsRehandshake
+func (c *Client) OnMultipleClients(onMultipleClients func(advice *message.Advise)) {
+	c.dispatcher.OnMultipleClients(onMultipleClients)
+}
+
+//OnMeta registers a read-only observer called with every /meta/** message received from the server, such as
+//the handshake, connect and subscribe responses, to monitor the protocol without writing an extension.
+func (c *Client) OnMeta(observer func(msg *message.Message)) {
+	c.dispatcher.OnMeta(observer)
+}
+
+//InterceptOutgoing registers an interceptor called with every message the client sends after the handshake,
+//as it goes on the wire, returning false suppresses the message. it is meant for tests asserting what the
+//application publishes: suppressed publishes and subscribes are acknowledged locally as if the server accepted them.
+func (c *Client) InterceptOutgoing(interceptor func(m *message.Message) bool) {
+	c.dispatcher.InterceptOutgoing(interceptor)
+}
+
+//AddExtension appends an extension run on every message sent and received, in the pipeline of the ones provided
+//with the options, after them. unlike those, it can pass the message on later or drop it, see message.Pipe. the
+//operation whose message is dropped fails with ErrExtensionDropped. ext is notified once added if it implements
+//message.AddedHook.
+func (c *Client) AddExtension(ext message.Pipe) {
+	c.dispatcher.AddExtension(ext)
+}
+
+//RemoveExtension removes an extension added with AddExtension, it returns false if ext wasn't added. ext is
+//notified once removed if it implements message.RemovedHook.
+func (c *Client) RemoveExtension(ext message.Pipe) bool {
+	return c.dispatcher.RemoveExtension(ext)
+}
+
+//OnError registers a handler called with the errors that don't disconnect the client,
+//e.g. transport errors or unexpected messages sent by the server, which are discarded.
+func (c *Client) OnError(onError func(err error)) {
+	c.dispatcher.OnError(onError)
+}
+
+//Errors returns a channel receiving the errors reported to OnError and the error that disconnects the client,
+//e.g. ErrReconnectFailed, for applications handling them in a select loop. errors are dropped while the channel
+//is full and it is never closed.
+func (c *Client) Errors() <-chan error {
+	c.errorsOnce.Do(func() {
+		c.errors = make(chan error, errorsBuffer)
+		report := func(err error) {
+			select {
+			case c.errors <- err:
+			default:
+			}
+		}
+		c.dispatcher.OnError(report)
+		c.dispatcher.OnDisconnect(report)
+	})
+	return c.errors
+}
+
+//Err returns a channel receiving the error that terminally disconnects the client, e.g. ErrReconnectFailed, for
+//applications restarting it. the channel is closed once the client is disconnected, without error after Disconnect.
+func (c *Client) Err() <-chan error {
+	return c.fatal
+}
+
+//Pending returns the number of publishes and subscribes queued until the connection is restored.
+func (c *Client) Pending() int {
+	return c.dispatcher.Pending()
+}
+
+//Coercions returns how many times the server quirks were coerced while parsing its messages, see WithParseMode
+func (c *Client) Coercions() message.Coercions {
+	return c.opts.transportOpts.Parser.Coercions()
+}
+
+//ServerInfo returns the protocol versions, the connection types and the ext field of the last handshake
+//response of the server
+func (c *Client) ServerInfo() ServerInfo {
+	return c.dispatcher.ServerInfo()
+}
+
+//ID returns the clientId assigned by the server, e.g. for debugging or server side auditing. it is empty before the
+//handshake and changes when the client handshakes again.
+func (c *Client) ID() string {
+	return c.dispatcher.ClientID()
+}
+
+//Session returns the clientId, the time of the last handshake, the negotiated transport, the endpoint and the
+//number of reconnects of the current session
+func (c *Client) Session() SessionInfo {
+	return c.dispatcher.Session()
+}
+
+//HandshakeInfo returns the http status, headers and negotiated subprotocol of the transport connection handshake,
+//e.g. the websocket upgrade response
+func (c *Client) HandshakeInfo() transport.HandshakeInfo {
+	return c.dispatcher.HandshakeInfo()
+}
+
+//OnReplayGap registers a handler called when the server can't replay the messages published on channel
+//after lastID, e.g. because they are no longer retained. the subscription continues from the current position
+//and the application must recover the lost messages by other means.
+func (c *Client) OnReplayGap(onGap func(channel string, lastID string, err error)) {
+	c.dispatcher.OnReplayGap(onGap)
+}
+
+//OnSlowConsumer registers a handler called when the queue of a subscription stayed full for the threshold of
+//WithSlowConsumerThreshold, once until its queue has room again. the handler runs on the goroutine reading the
+//messages and must not block, e.g. a subscription is paused in PauseUnsubscribe mode or unsubscribed from
+//another goroutine.
+func (c *Client) OnSlowConsumer(onSlow func(sub *subscription.Subscription, queued int, full time.Duration)) {
+	c.dispatcher.OnSlowConsumer(onSlow)
+}
+
+//On registers a handler called with every event of type t, with the message and the subscription involved and
+//the time of the transition. the handler runs on the goroutine causing the event and must not block, the
+//returned func removes it.
+func (c *Client) On(t EventType, handler func(e Event)) (remove func()) {
+	return c.dispatcher.On(t, handler)
+}
+
 //WithOutExtension append the provided outgoing extension to the the default transport options
 //extensions run in the order that they are provided
 func WithOutExtension(extension message.Extension) Option {
 	return func(o *options) {
-		o.extensions.Out = append(o.extensions.Out, extension)
+		o.extensions.Out = append(o.extensions.Out, extension.WithContext())
 	}
 }
 
@@ -86,8 +958,8 @@ func WithOutExtension(extension message.Extension) Option {
 //extensions run in the order that they are provided
 func WithExtension(inExt message.Extension, outExt message.Extension) Option {
 	return func(o *options) {
-		o.extensions.In = append(o.extensions.In, inExt)
-		o.extensions.Out = append(o.extensions.Out, outExt)
+		o.extensions.In = append(o.extensions.In, inExt.WithContext())
+		o.extensions.Out = append(o.extensions.Out, outExt.WithContext())
 	}
 }
 
@@ -95,13 +967,524 @@ func WithExtension(inExt message.Extension, outExt message.Extension) Option {
 //extensions run in the order that they are provided
 func WithInExtension(extension message.Extension) Option {
 	return func(o *options) {
-		o.extensions.In = append(o.extensions.In, extension)
+		o.extensions.In = append(o.extensions.In, extension.WithContext())
+	}
+}
+
+//WithContextExtension appends extensions receiving the context of the operation, e.g. the deadline of Handshake
+//or the trace context, and the message.ClientInfo. either extension can be nil.
+//extensions run in the order that they are provided
+func WithContextExtension(inExt message.ContextExtension, outExt message.ContextExtension) Option {
+	return func(o *options) {
+		if inExt != nil {
+			o.extensions.In = append(o.extensions.In, inExt)
+		}
+		if outExt != nil {
+			o.extensions.Out = append(o.extensions.Out, outExt)
+		}
+	}
+}
+
+//WithPipeExtension appends an extension that can pass the messages on later or drop them, see message.Pipe,
+//e.g. extensions.NewAuth(token, nil). it runs from the handshake on, after the extensions of the other options,
+//as if added with AddExtension before connecting.
+func WithPipeExtension(ext message.Pipe) Option {
+	return func(o *options) {
+		o.pipes = append(o.pipes, ext)
 	}
 }
 
-//WithTransport sets the client transport to be used to communicate with server.
+//WithTransport sets the client transport to be used to communicate with server, the instance must not be
+//shared with other clients, e.g. WithTransport(streaming.New()).
 func WithTransport(t transport.Transport) Option {
 	return func(o *options) {
 		o.transport = t
 	}
 }
+
+//WithTransportName makes the client create a new instance of the transport registered with the name,
+//see transport.Register. websocket is used by default.
+func WithTransportName(name string) Option {
+	return func(o *options) {
+		o.transport = nil
+		o.transportName = name
+	}
+}
+
+//WithChannelConfig sets the quality of service (ack, buffering, overflow policy, dedup) of the channels
+//matching each config pattern. configs are evaluated in the order they are provided, the first match is used.
+func WithChannelConfig(configs ...ChannelConfig) Option {
+	return func(o *options) {
+		o.channelConfigs = append(o.channelConfigs, configs...)
+	}
+}
+
+//WithReplayBuffer keeps the ids of the last size messages delivered on each channel.
+//when subscribing again to a channel of a replay capable server only the missing messages are requested,
+//already delivered messages replayed by the server are discarded.
+func WithReplayBuffer(size int) Option {
+	return func(o *options) {
+		o.replayBuffer = size
+	}
+}
+
+//WithOutgoingQueue bounds the queue holding the publishes and subscribes while the connection is restored,
+//they are sent in a single batch once reconnected. policy applies when size operations are queued already,
+//the queue isn't bounded by default.
+func WithOutgoingQueue(size int, policy QueuePolicy) Option {
+	return func(o *options) {
+		o.queueSize = size
+		o.queuePolicy = policy
+	}
+}
+
+//WithRateLimit paces the publishes at msgsPerSec messages per second, allowing bursts of burst messages, so the
+//server doesn't throttle or disconnect the session under publish bursts. the publishes exceeding it wait by
+//default, see WithRateLimitPolicy.
+func WithRateLimit(msgsPerSec float64, burst int) Option {
+	return func(o *options) {
+		o.rateLimit = msgsPerSec
+		o.rateBurst = burst
+	}
+}
+
+//WithRateLimitPolicy sets what happens to the operations exceeding the rate limit, RateLimitBlock by default.
+//subscribes paces the subscribes too.
+func WithRateLimitPolicy(policy RateLimitPolicy, subscribes bool) Option {
+	return func(o *options) {
+		o.ratePolicy = policy
+		o.rateSubscribes = subscribes
+	}
+}
+
+//WithLogger logs the activity of the client to logger: the messages sent, received and delivered at debug level
+//with their channel, id and the clientId, the handshakes and reconnects at info level, the connections lost and
+//the operations rejected by the server at warn level and the errors reported to OnError at error level.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+//WithMetrics reports the messages sent and received, the publish latencies, the reconnects, the subscriptions
+//and the outgoing queue depth to collector, e.g. a metrics/prometheus collector.
+func WithMetrics(collector metrics.Collector) Option {
+	return func(o *options) {
+		o.metrics = collector
+	}
+}
+
+//WithRetryPolicy paces the attempts to restore a lost connection with policy, e.g. backoff.Default().
+//by default the client waits the RetryInterval of the transport options before each attempt, and gives up
+//after their MaxRetries attempts if set. the interval advised by the server is waited when it is longer.
+func WithRetryPolicy(policy backoff.Policy) Option {
+	return func(o *options) {
+		o.retryPolicy = policy
+	}
+}
+
+//WithResubscribePolicy sets what happens to the subscriptions whose channel the server rejects when they are
+//restored on a new session, e.g. the authorization expired or the channel was deleted: DropOnReject, the
+//default, FailOnReject or RetryOnReject, paced by WithRetryPolicy. see WithSubscriptionResubscribePolicy.
+func WithResubscribePolicy(policy ResubscribePolicy) Option {
+	return func(o *options) {
+		o.resubscribe = policy
+	}
+}
+
+//WithSlowConsumerThreshold reports the subscriptions whose queue stays full for threshold to OnSlowConsumer, their
+//handlers don't keep up with the messages of the channel. the queues are sized by the BufferSize of
+//WithChannelConfig, the unbuffered ones are not reported.
+func WithSlowConsumerThreshold(threshold time.Duration) Option {
+	return func(o *options) {
+		o.slowConsumer = threshold
+	}
+}
+
+//WithWorkers bounds the number of SubscribeFunc and SubscribeRaw handlers running at the same time to n, the
+//messages of a subscription are still handled one at a time and in order, the deliveries waiting for a worker
+//are queued up to the BufferSize of WithChannelConfig.
+func WithWorkers(n int) Option {
+	return func(o *options) {
+		o.workers = n
+	}
+}
+
+//WithIDGenerator sets the generator of the ids of all the messages sent, e.g. idgen.UUID{} so the ids don't
+//collide across client restarts. the ids count from 1 by default.
+func WithIDGenerator(g idgen.Generator) Option {
+	return func(o *options) {
+		o.idGenerator = g
+	}
+}
+
+//WithOnBeforeHandshake registers a hook called with every handshake message before it is sent,
+//and before the outgoing extensions run, e.g. to inject short lived credentials in the ext field.
+func WithOnBeforeHandshake(hook func(m *message.Message)) Option {
+	return func(o *options) {
+		o.beforeHandshake = append(o.beforeHandshake, hook)
+	}
+}
+
+//WithOnHandshakeComplete registers a hook called with every successful handshake response,
+//e.g. to capture the server capabilities advertised in the ext field.
+func WithOnHandshakeComplete(hook func(resp *message.Message)) Option {
+	return func(o *options) {
+		o.handshakeComplete = append(o.handshakeComplete, hook)
+	}
+}
+
+//WithOnMeta registers a read-only observer of the /meta/** messages received from the server, like OnMeta,
+//before the client connects so the first handshake response is observed too.
+func WithOnMeta(observer func(msg *message.Message)) Option {
+	return func(o *options) {
+		o.metaObservers = append(o.metaObservers, observer)
+	}
+}
+
+//WithStagedConnect makes NewClient return without connecting, the application drives the connection
+//calling Handshake and then Connect, e.g. to run a custom authentication flow between them.
+func WithStagedConnect() Option {
+	return func(o *options) {
+		o.staged = true
+	}
+}
+
+//WithManualConnect disables the automatic /meta/connect cycle, the application drives it calling Poll,
+//e.g. from a test harness or another event loop.
+func WithManualConnect() Option {
+	return func(o *options) {
+		o.manualConnect = true
+	}
+}
+
+//WithMultipleClientsRehandshake makes the client handshake again for a fresh clientId when the server advice
+//reports another connection using its clientId, instead of only backing off its connects
+func WithMultipleClientsRehandshake() Option {
+	return func(o *options) {
+		o.multipleClientsRehandshake = true
+	}
+}
+
+//WithPollRequestTimeout sets the client side timeout of the requests issued by the polling transports,
+//by default it is derived from the server advised timeout.
+func WithPollRequestTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.transportOpts.PollRequestTimeout = timeout
+	}
+}
+
+//WithMinPollInterval sets the minimum delay between two polls of the polling transports.
+func WithMinPollInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.transportOpts.MinPollInterval = interval
+	}
+}
+
+//WithMaxBatchSize bounds the messages the long-polling transport posts in a request. the messages sent while a
+//request is in flight are queued and posted together once it returns, so a busy publisher doesn't open a
+//request per message, by default a request carries all the messages queued.
+func WithMaxBatchSize(n int) Option {
+	return func(o *options) {
+		o.transportOpts.MaxBatchSize = n
+	}
+}
+
+//WithAdviceConflictPolicy sets whether the server advice or the local polling limits win when they conflict,
+//transport.PreferLocalLimits by default.
+func WithAdviceConflictPolicy(policy transport.AdvicePolicy) Option {
+	return func(o *options) {
+		o.transportOpts.AdviceConflict = policy
+	}
+}
+
+//WithConnectTimeout asks the server to hold every /meta/connect at most timeout before responding,
+//sent as the connect request advice timeout. zero asks for an immediate response.
+func WithConnectTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.connectTimeout = &timeout
+	}
+}
+
+//WithUnsubscribeTimeout sets how long Unsubscribe waits for the server confirmation before returning
+//ErrUnsubscribeTimeout, 10s by default. zero waits forever. the subscriptions are removed locally anyway.
+func WithUnsubscribeTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.unsubscribeTimeout = &timeout
+	}
+}
+
+//WithHandshakeTimeout bounds the wait for the handshake responses, the handshake fails with ErrHandshakeTimeout,
+//matched by ErrTimeout, once it expires. it overrides WithRequestTimeout.
+func WithHandshakeTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.handshakeTimeout = timeout
+	}
+}
+
+//WithSubscribeTimeout bounds the wait for the subscribe confirmations, the subscribe fails with
+//ErrSubscribeTimeout, matched by ErrTimeout, once it expires. it overrides WithRequestTimeout.
+func WithSubscribeTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.subscribeTimeout = timeout
+	}
+}
+
+//WithRequestTimeout bounds the wait for the responses to the meta operations without a timeout of their own: the
+//handshake, the subscribes, the unsubscribes and the disconnect. the operations timing out return an error matched
+//by ErrTimeout and leave the connection usable, unless the transport lost it meanwhile, in that case the client
+//reconnects.
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.requestTimeout = timeout
+	}
+}
+
+//WithPublishTimeout bounds the wait for the acknowledgement of PublishWithAck, which returns ErrAckTimeout,
+//matched by ErrTimeout, once it expires. with WithPublishRetries, it bounds every attempt.
+func WithPublishTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.publishTimeout = timeout
+	}
+}
+
+//WithPublishRetries makes PublishWithAck send an unacknowledged publish again, at most retries times, once the
+//connection is restored or WithPublishTimeout expired, so a publish lost with the connection isn't dropped. every
+//attempt keeps the original message id for the server to discard the duplicates.
+func WithPublishRetries(retries int) Option {
+	return func(o *options) {
+		o.publishRetries = retries
+	}
+}
+
+//WithAckExtension enables the CometD acknowledged messages extension, negotiated during the handshake: the client
+//acknowledges the batches of messages received on every /meta/connect, and the server delivers again the ones
+//not acknowledged once the connection is restored, so none is lost with the connection. a message may be
+//delivered twice, see ChannelConfig.Dedup to drop the duplicates. it has no effect on servers not supporting it.
+func WithAckExtension() Option {
+	return func(o *options) {
+		o.ackExtension = true
+	}
+}
+
+//WithBinaryLimits bounds the size of the message.BinaryData payloads, the larger publishes fail with
+//ErrPayloadTooLarge, 0 doesn't bound them. the payloads larger than chunkSize are published in several messages
+//of chunkSize bytes, e.g. to stay below the message size limit of the server, and gathered before the delivery.
+//0 doesn't split them. the subscribers of the channel must be faye clients too.
+func WithBinaryLimits(maxSize, chunkSize int) Option {
+	return func(o *options) {
+		o.maxBinarySize = maxSize
+		o.chunkSize = chunkSize
+	}
+}
+
+//WithSuspendOnIdle suspends the session once no message was published nor delivered for idle, see
+//Client.Suspend. if wake is positive the suspended session also resumes after wake, to receive the messages
+//the server may have retained meanwhile, and is suspended again once idle.
+func WithSuspendOnIdle(idle, wake time.Duration) Option {
+	return func(o *options) {
+		o.idleSuspend = idle
+		o.wakeInterval = wake
+	}
+}
+
+//WithHeaders sets the headers of the websocket upgrade and of the polling requests, e.g. an Authorization header
+//required by the server, see WithHeaderFunc for headers that change.
+func WithHeaders(headers http.Header) Option {
+	return func(o *options) {
+		o.transportOpts.Headers = headers
+	}
+}
+
+//WithHeaderFunc sets a function returning headers added on every connection and polling request, e.g. to refresh
+//an expiring token when the client reconnects. a failure fails the connection, which is retried.
+func WithHeaderFunc(headerFunc func() (http.Header, error)) Option {
+	return func(o *options) {
+		o.transportOpts.HeaderFunc = headerFunc
+	}
+}
+
+//CredentialsProvider returns the token authenticating the client, it is requested before every handshake so
+//short lived tokens are refreshed, see WithCredentials and extensions.Auth.Credentials
+type CredentialsProvider = credentials.Provider
+
+//ErrTokenExpired is the cause of the reconnect when the server responds 401::token expired, see OnReconnectAttempt.
+var ErrTokenExpired = dispatcher.ErrTokenExpired
+
+//WithCredentials sends the token of p as a bearer Authorization header of the connections and polling requests,
+//next to the headers of WithHeaders and WithHeaderFunc. the token is requested before every handshake, including
+//the ones of the reconnects, and the client handshakes again when the server responds 401::token expired.
+//see extensions.Auth to send the token in the handshake ext instead.
+func WithCredentials(p CredentialsProvider) Option {
+	return func(o *options) {
+		o.credentials = p
+	}
+}
+
+//WithCookieJar sets the jar sending the cookies of the client and storing the ones set by the server,
+//e.g. a jar holding the session cookies of a prior login. an in memory jar is used by default.
+func WithCookieJar(jar http.CookieJar) Option {
+	return func(o *options) {
+		o.transportOpts.Cookies = jar
+	}
+}
+
+//WithTLSConfig sets the tls configuration of the connections to wss:// and https:// endpoints, e.g. the root CAs
+//of a private PKI or a client certificate, see WithTLSServerName to only override the server name.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(o *options) {
+		o.transportOpts.TLS = cfg
+	}
+}
+
+//WithDialTimeout bounds the time to establish a connection, including the TLS and websocket handshakes
+//for the websocket transport.
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.transportOpts.DialDeadline = timeout
+	}
+}
+
+//WithReadWriteTimeout bounds the reads and the writes of every websocket frame, 0 doesn't bound them.
+//the read timeout must exceed the connect timeout advised by the server, see WithKeepAlive to detect a silent server.
+func WithReadWriteTimeout(read, write time.Duration) Option {
+	return func(o *options) {
+		o.transportOpts.ReadDeadline = read
+		o.transportOpts.WriteDeadline = write
+	}
+}
+
+//WithKeepAlive makes the websocket transport ping the server every interval, the connection is restored
+//when the server doesn't answer a ping within timeout, e.g. when it went silent behind a proxy.
+func WithKeepAlive(interval, timeout time.Duration) Option {
+	return func(o *options) {
+		o.transportOpts.KeepAliveInterval = interval
+		o.transportOpts.KeepAliveTimeout = timeout
+	}
+}
+
+//WithProxy connects through the proxy at proxyURL instead of the one configured by the HTTP_PROXY,
+//HTTPS_PROXY and NO_PROXY environment variables, a nil url connects directly.
+func WithProxy(proxyURL *url.URL) Option {
+	return func(o *options) {
+		o.transportOpts.Proxy = http.ProxyURL(proxyURL)
+	}
+}
+
+//WithTLSServerName overrides the TLS server name independently of the dialed host, e.g. when dialing an ip
+//address or through a tunnel where the certificate names don't match the dial target.
+func WithTLSServerName(serverName string) Option {
+	return func(o *options) {
+		o.transportOpts.ServerName = serverName
+	}
+}
+
+//WithH2C makes the polling transports speak HTTP/2 with prior knowledge to plain http endpoints,
+//multiplexing all the requests of the client over a single connection.
+func WithH2C() Option {
+	return func(o *options) {
+		o.transportOpts.H2C = true
+	}
+}
+
+//WithChannelPrefix namespaces all the channels of the client under prefix, e.g. /myapp, so multiple applications
+//can share a server: subscribes, unsubscribes and publishes are prefixed and the prefix is stripped on delivery.
+//channel configs and subscription names use the unprefixed channels.
+func WithChannelPrefix(prefix string) Option {
+	return func(o *options) {
+		o.channelPrefix = prefix
+	}
+}
+
+//WithEndpoints adds the endpoints the client fails over to, in order, when the url passed to NewClient is
+//unreachable or rejects the handshake. the reconnects rotate through all of them and resubscribe the channels.
+//the url can be empty to only use the endpoints, see WithBalancer to spread many clients across endpoints.
+func WithEndpoints(endpoints ...string) Option {
+	return func(o *options) {
+		o.failover = append(o.failover, endpoints...)
+	}
+}
+
+//WithBalancer makes the client connect to the endpoints of the balancer instead of the url passed to NewClient,
+//failing over in the balancer order. clients sharing a balancer are distributed across its endpoints,
+//run balancer.RunProbes to keep new connections away from unhealthy endpoints.
+func WithBalancer(b *balancer.Balancer) Option {
+	return func(o *options) {
+		o.balancer = b
+	}
+}
+
+//WithNetDialContext sets the function creating the network connections of all the transports,
+//e.g. to connect through a tunnel or a jump host, or to intercept the connections in tests.
+func WithNetDialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) Option {
+	return func(o *options) {
+		o.transportOpts.NetDialContext = dial
+	}
+}
+
+//WithGzipRequests makes the polling transports gzip the request bodies of at least threshold bytes,
+//the servers must accept Content-Encoding: gzip. responses are always requested compressed.
+func WithGzipRequests(threshold int) Option {
+	return func(o *options) {
+		o.transportOpts.GzipRequestThreshold = threshold
+	}
+}
+
+//WithCompression advertises the codecs during the handshake, in order of preference. when the server confirms one
+//the data of the messages is compressed with it for the rest of the session, otherwise it is sent as is.
+func WithCompression(codecs ...compression.Codec) Option {
+	return func(o *options) {
+		o.compression = append(o.compression, codecs...)
+	}
+}
+
+//WithWebsocketCompression negotiates the permessage-deflate extension on the websocket connections, the frames
+//are compressed when the server accepts it. see WithGzipRequests for the polling transports and WithCompression
+//to compress the data of the messages whatever the transport.
+func WithWebsocketCompression() Option {
+	return func(o *options) {
+		o.transportOpts.WebsocketCompression = true
+	}
+}
+
+//WithClock makes the client and transport timers use c, e.g. a clock.Fake advanced by the tests
+//instead of waiting for the retry intervals and timeouts.
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.transportOpts.Clock = c
+	}
+}
+
+//WithParseMode sets how the messages violating the Bayeux spec are handled: message.Lenient, the default,
+//coerces the common server quirks and counts them (see Coercions), message.Strict rejects the messages and
+//reports them to OnError.
+func WithParseMode(mode message.ParseMode) Option {
+	return func(o *options) {
+		o.parseMode = mode
+	}
+}
+
+//WithNumberMode sets how the numbers of the message data are decoded, message.Float64 by default.
+//use message.UseNumber or message.PreserveIntegers when the data carries 64 bit ids, float64 corrupts
+//the integers above 2^53.
+func WithNumberMode(mode message.NumberMode) Option {
+	return func(o *options) {
+		o.numberMode = mode
+	}
+}
+
+//WithRawData keeps the data of the messages received as sent by the server, so Message.DecodeData and
+//subscription.OnTyped decode it into the user types directly instead of encoding the generic data again
+func WithRawData() Option {
+	return func(o *options) {
+		o.keepRawData = true
+	}
+}
+
+//WithCodec encodes and decodes the messages with c instead of encoding/json, e.g. jsoniter.New() for throughput
+//or msgpack.New() for servers speaking MessagePack. the parse and number modes only apply to the default codec.
+func WithCodec(c codec.Codec) Option {
+	return func(o *options) {
+		o.transportOpts.Codec = c
+	}
+}
@@ -0,0 +1,668 @@
+package fayec
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/thesyncim/faye/channel"
+	"github.com/thesyncim/faye/fayeserver"
+	"github.com/thesyncim/faye/internal/dispatcher"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/statestore"
+	"github.com/thesyncim/faye/transport"
+	"github.com/thesyncim/faye/transport/inproc"
+	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClient_PublishJSON(t *testing.T) {
+	var published *Request
+	c := &Client{op: func(ctx context.Context, req *Request) error {
+		published = req
+		return nil
+	}}
+
+	type payload struct {
+		Text string `json:"text"`
+	}
+	if err := c.PublishJSON("/foo", payload{Text: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if data, ok := published.Data.(json.RawMessage); !ok || string(data) != `{"text":"hello"}` {
+		t.Fatalf("expecting the json encoded payload got: %v", published.Data)
+	}
+
+	published = nil
+	if err := c.PublishJSON("/foo", make(chan int)); err == nil {
+		t.Fatal("expecting the encoding error")
+	}
+	if published != nil {
+		t.Fatal("expecting nothing published on encoding errors")
+	}
+}
+
+//handlerTransport only records the handlers set by the dispatcher, the other methods are not implemented
+type handlerTransport struct {
+	transport.Transport
+	onError func(err error)
+}
+
+func (t *handlerTransport) SetOnMessageReceivedHandler(onMsg func(msg *message.Message)) {}
+func (t *handlerTransport) SetOnTransportDownHandler(callback func(error))               {}
+func (t *handlerTransport) SetOnErrorHandler(onError func(err error))                    { t.onError = onError }
+
+func TestClient_Errors(t *testing.T) {
+	ht := &handlerTransport{}
+	d := dispatcher.NewDispatcher("fake://", transport.Options{}, message.Extensions{})
+	d.SetTransport(ht)
+	c := &Client{dispatcher: d}
+
+	errs := c.Errors()
+	if c.Errors() != errs {
+		t.Fatal("expecting the same channel")
+	}
+	failure := errors.New("transport failure")
+	for i := 0; i < errorsBuffer+1; i++ {
+		ht.onError(failure)
+	}
+	if len(errs) != errorsBuffer {
+		t.Fatalf("expecting %d queued errors got: %d", errorsBuffer, len(errs))
+	}
+	if err := <-errs; err != failure {
+		t.Fatalf("expecting %v got: %v", failure, err)
+	}
+}
+
+func TestNewClient_TransportName(t *testing.T) {
+	_, err := NewClient("ws://localhost", WithTransportName("unknown"))
+	if !errors.Is(err, transport.ErrUnknownTransport) {
+		t.Fatalf("expecting %v got: %v", transport.ErrUnknownTransport, err)
+	}
+}
+
+//recordingTransport records the Init and Close of the transport it wraps
+type recordingTransport struct {
+	transport.Transport
+	inits, closes int32
+}
+
+func (t *recordingTransport) Init(endpoint string, options *transport.Options) error {
+	atomic.AddInt32(&t.inits, 1)
+	return t.Transport.Init(endpoint, options)
+}
+
+func (t *recordingTransport) Close() error {
+	atomic.AddInt32(&t.closes, 1)
+	return t.Transport.(transport.Closer).Close()
+}
+
+func TestNewClient_Failures(t *testing.T) {
+	denied := errors.New("denied")
+	defer inproc.Listen("client-failures", fayeserver.NewServer(fayeserver.WithAuthenticator(func(r *http.Request, m *message.Message) error {
+		return denied
+	})))()
+	newTransport := func() *recordingTransport {
+		inner, err := transport.New("inproc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &recordingTransport{Transport: inner}
+	}
+
+	//invalid options fail before dialing
+	rt := newTransport()
+	if _, err := NewClient("inproc://client-failures", WithTransport(rt), WithChannelPrefix("prefix")); err == nil {
+		t.Fatal("expecting the invalid prefix rejected")
+	}
+	if atomic.LoadInt32(&rt.inits) != 0 {
+		t.Fatal("expecting the transport not initialized")
+	}
+
+	//the connection dialed for a rejected handshake is closed
+	rt = newTransport()
+	if _, err := NewClient("inproc://client-failures", WithTransport(rt)); err == nil {
+		t.Fatal("expecting the handshake rejected")
+	}
+	if atomic.LoadInt32(&rt.closes) != 1 {
+		t.Fatalf("expecting the transport closed once got: %d", atomic.LoadInt32(&rt.closes))
+	}
+}
+
+func TestClient_Operations(t *testing.T) {
+	at := &ackTransport{clientID: "ack-client"}
+	d := dispatcher.NewDispatcher("fake://", transport.Options{}, message.Extensions{})
+	d.SetTransport(at)
+	if err := d.SetChannelConfigs([]channel.Config{{Pattern: "/foo", BufferSize: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	c := &Client{dispatcher: d}
+	c.op = chain(c.operation, nil)
+
+	sub, err := c.Subscribe("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at.onMsg(&message.Message{Channel: "/foo", Data: "hello"})
+	if msg := <-sub.MsgChannel(); msg.Data != "hello" {
+		t.Fatalf("expecting hello got %v", msg.Data)
+	}
+
+	if err := c.Publish("/foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Unsubscribe("/foo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Publish("/fail", "bar"); err == nil {
+		t.Fatal("expecting the rejected publish to fail")
+	}
+
+	var channels []string
+	for _, frame := range at.frames {
+		for _, m := range frame {
+			channels = append(channels, m.Channel)
+		}
+	}
+	want := []string{"/meta/subscribe", "/foo", "/meta/unsubscribe", "/fail"}
+	if len(channels) != len(want) {
+		t.Fatalf("expecting %v got %v", want, channels)
+	}
+	for i := range want {
+		if channels[i] != want[i] {
+			t.Fatalf("expecting %v got %v", want, channels)
+		}
+	}
+}
+
+func TestClient_Ctx(t *testing.T) {
+	type key struct{}
+	var seen []interface{}
+	c := &Client{op: func(ctx context.Context, req *Request) error {
+		seen = append(seen, ctx.Value(key{}))
+		return nil
+	}}
+
+	ctx := context.WithValue(context.Background(), key{}, "value")
+	if _, err := c.SubscribeCtx(ctx, "/foo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.PublishCtx(ctx, "/foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 2 || seen[0] != "value" || seen[1] != "value" {
+		t.Fatalf("expecting the context passed to the operations got: %v", seen)
+	}
+}
+
+func TestClient_SubscribeLifetime(t *testing.T) {
+	defer inproc.Listen("client-lifetime", fayeserver.NewServer())()
+	client, err := NewClient("inproc://client-lifetime", WithTransportName("inproc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect()
+
+	//the ack ctx doesn't bound the subscription, the lifetime does
+	ackCtx, cancelAck := context.WithCancel(context.Background())
+	lifetime, cancel := context.WithCancel(context.Background())
+	sub, err := client.SubscribeCtx(ackCtx, "/foo", WithLifetime(lifetime))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancelAck()
+	if sub.Context().Err() != nil {
+		t.Fatal("expecting the subscription to outlive the ack ctx")
+	}
+	cancel()
+	select {
+	case <-sub.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expecting the subscription removed with its lifetime")
+	}
+}
+
+func TestClient_Inproc(t *testing.T) {
+	defer inproc.Listen("client-test", fayeserver.NewServer())()
+
+	client, err := NewClient("inproc://client-test", WithTransportName("inproc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect()
+	received := make(chan message.Data, 1)
+	if _, err = client.SubscribeFunc("/foo", func(channel string, data message.Data) {
+		received <- data
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Publish("/foo", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case data := <-received:
+		if data != "hello" {
+			t.Fatalf("expecting hello got: %v", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expecting the publish delivered")
+	}
+}
+
+func TestClient_SubscribeRaw(t *testing.T) {
+	defer inproc.Listen("client-raw-test", fayeserver.NewServer())()
+
+	client, err := NewClient("inproc://client-raw-test", WithTransportName("inproc"),
+		WithChannelConfig(ChannelConfig{Pattern: "/foo", BufferSize: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect()
+	received := make(chan *message.Message, 1)
+	if _, err = client.SubscribeRaw("/foo", func(msg *message.Message) {
+		received <- msg
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Publish("/foo", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-received:
+		//the server keeps the id of the publish
+		if msg.Channel != "/foo" || msg.Data != "hello" || msg.Id == "" {
+			t.Fatalf("expecting the whole message delivered got: %#v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expecting the publish delivered")
+	}
+}
+
+func TestClient_SubscriptionMiddleware(t *testing.T) {
+	defer inproc.Listen("client-middleware-test", fayeserver.NewServer())()
+
+	client, err := NewClient("inproc://client-middleware-test", WithTransportName("inproc"),
+		WithChannelConfig(ChannelConfig{Pattern: "/foo", BufferSize: 10}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect()
+	//drops the messages without string data
+	validate := func(msg *message.Message) (*message.Message, error) {
+		if _, ok := msg.Data.(string); !ok {
+			return nil, nil
+		}
+		return msg, nil
+	}
+	received := make(chan message.Data, 10)
+	if _, err = client.SubscribeFunc("/foo", func(channel string, data message.Data) {
+		received <- data
+	}, WithSubscriptionMiddleware(validate)); err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range []message.Data{1.0, "hello"} {
+		if err = client.Publish("/foo", data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case data := <-received:
+		if data != "hello" {
+			t.Fatalf("expecting the invalid message dropped got: %v", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expecting the publish delivered")
+	}
+}
+
+func TestClient_SuspendResume(t *testing.T) {
+	defer inproc.Listen("client-suspend-test", fayeserver.NewServer())()
+
+	client, err := NewClient("inproc://client-suspend-test", WithTransportName("inproc"),
+		WithChannelConfig(ChannelConfig{Pattern: "/foo", BufferSize: 10}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect()
+	received := make(chan message.Data, 10)
+	if _, err = client.SubscribeFunc("/foo", func(channel string, data message.Data) {
+		received <- data
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Suspend(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if client.State() != StateSuspended {
+		t.Fatalf("expecting the client suspended got: %v", client.State())
+	}
+	//the publish resumes the session and the subscription is restored
+	if err = client.Publish("/foo", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if client.State() != StateConnected {
+		t.Fatalf("expecting the client resumed got: %v", client.State())
+	}
+	select {
+	case data := <-received:
+		if data != "hello" {
+			t.Fatalf("expecting hello got: %v", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expecting the publish delivered after resuming")
+	}
+}
+
+func TestClient_Session(t *testing.T) {
+	defer inproc.Listen("client-session-test", fayeserver.NewServer())()
+
+	before := time.Now()
+	client, err := NewClient("inproc://client-session-test", WithTransportName("inproc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect()
+	session := client.Session()
+	if client.ID() == "" || session.ClientID != client.ID() {
+		t.Fatalf("expecting the clientId assigned got: %q %q", client.ID(), session.ClientID)
+	}
+	if session.Handshaked.Before(before) || session.Handshaked.After(time.Now()) {
+		t.Fatalf("expecting the handshake time got: %v", session.Handshaked)
+	}
+	if session.Transport != "inproc" || session.Endpoint != "inproc://client-session-test" || session.Reconnects != 0 {
+		t.Fatalf("expecting the session of the connection got: %+v", session)
+	}
+}
+
+func TestClient_SubscribeFiltered(t *testing.T) {
+	defer inproc.Listen("client-filtered-test", fayeserver.NewServer())()
+
+	client, err := NewClient("inproc://client-filtered-test", WithTransportName("inproc"),
+		WithChannelConfig(ChannelConfig{Pattern: "/events", BufferSize: 10}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect()
+	ofType := func(kind string) func(msg *message.Message) bool {
+		return func(msg *message.Message) bool {
+			data, _ := msg.Data.(map[string]interface{})
+			return data["type"] == kind
+		}
+	}
+	orders, refunds := make(chan message.Data, 10), make(chan message.Data, 10)
+	for kind, received := range map[string]chan message.Data{"order": orders, "refund": refunds} {
+		received := received
+		if _, err = client.SubscribeFiltered("/events", ofType(kind), func(channel string, data message.Data) {
+			received <- data
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, kind := range []string{"refund", "order"} {
+		if err = client.Publish("/events", map[string]interface{}{"type": kind}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for kind, received := range map[string]chan message.Data{"order": orders, "refund": refunds} {
+		select {
+		case data := <-received:
+			if data.(map[string]interface{})["type"] != kind {
+				t.Fatalf("expecting the %s delivered got: %v", kind, data)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expecting the %s delivered", kind)
+		}
+		select {
+		case data := <-received:
+			t.Fatalf("expecting only the %s delivered got: %v", kind, data)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+}
+
+func TestClient_BinaryData(t *testing.T) {
+	defer inproc.Listen("client-binary-test", fayeserver.NewServer())()
+
+	client, err := NewClient("inproc://client-binary-test", WithTransportName("inproc"),
+		WithChannelConfig(ChannelConfig{Pattern: "/files", BufferSize: 10}), WithBinaryLimits(16, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect()
+	received := make(chan message.Data, 10)
+	if _, err = client.SubscribeFunc("/files", func(channel string, data message.Data) {
+		received <- data
+	}); err != nil {
+		t.Fatal(err)
+	}
+	payload := message.BinaryData{0, 1, 2, 0xff, 0xfe, 5, 6, 7, 8, 9}
+	if err = client.Publish("/files", payload); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case data := <-received:
+		if !reflect.DeepEqual(data, payload) {
+			t.Fatalf("expecting the payload delivered got: %v", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expecting the payload delivered")
+	}
+	if err = client.Publish("/files", make(message.BinaryData, 17)); !errors.Is(err, ErrPayloadTooLarge) {
+		t.Fatalf("expecting ErrPayloadTooLarge got: %v", err)
+	}
+}
+
+func TestClient_RateLimit(t *testing.T) {
+	defer inproc.Listen("client-ratelimit-test", fayeserver.NewServer())()
+
+	client, err := NewClient("inproc://client-ratelimit-test", WithTransportName("inproc"),
+		WithRateLimit(0.001, 2), WithRateLimitPolicy(RateLimitReject, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect()
+	for i := 0; i < 2; i++ {
+		if err = client.Publish("/foo", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = client.Publish("/foo", 2); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expecting ErrRateLimited got: %v", err)
+	}
+	if _, err = client.Subscribe("/foo"); err != nil {
+		t.Fatalf("expecting the subscribes not limited got: %v", err)
+	}
+}
+
+func TestNewClientFromState(t *testing.T) {
+	defer inproc.Listen("client-state-test", fayeserver.NewServer())()
+
+	store := statestore.NewMemory()
+	if err := store.Save(&statestore.State{Subscriptions: []string{"/foo", "/bar"}}); err != nil {
+		t.Fatal(err)
+	}
+	client, subs, err := NewClientFromState("inproc://client-state-test", store, WithTransportName("inproc"),
+		WithChannelConfig(ChannelConfig{Pattern: "/foo", BufferSize: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect()
+	if len(subs) != 2 || subs[0].Name() != "/foo" || subs[1].Name() != "/bar" {
+		t.Fatalf("expecting /foo and /bar restored got: %v", subs)
+	}
+	if err = client.Publish("/foo", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-subs[0].MsgChannel():
+		if msg.Data != "hello" {
+			t.Fatalf("expecting hello got: %v", msg.Data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expecting the publish delivered")
+	}
+
+	if err = subs[1].Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		state, err := store.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reflect.DeepEqual(state.Subscriptions, []string{"/foo"}) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expecting /foo saved got: %v", state.Subscriptions)
+		}
+	}
+
+	if _, _, err = NewClientFromState("inproc://client-state-test", store, WithStagedConnect()); err != ErrStagedRestore {
+		t.Fatalf("expecting ErrStagedRestore got: %v", err)
+	}
+}
+
+//adviseNone is a server extension advising the clients not to reconnect when they publish on /stop
+type adviseNone struct{}
+
+func (adviseNone) Incoming(m *message.Message, next func(m *message.Message)) { next(m) }
+func (adviseNone) Outgoing(m *message.Message, next func(m *message.Message)) {
+	if m.Channel == "/stop" {
+		m.Advice = &message.Advise{Reconnect: message.ReconnectNone}
+	}
+	next(m)
+}
+
+func TestClient_Err(t *testing.T) {
+	server := fayeserver.NewServer()
+	server.AddExtension(adviseNone{})
+	defer inproc.Listen("client-err-test", server)()
+
+	tests := []struct {
+		name     string
+		teardown func(c *Client) error
+		err      error
+	}{
+		{name: "disconnect", teardown: func(c *Client) error { return c.Disconnect() }},
+		{name: "reconnect none", teardown: func(c *Client) error {
+			c.Publish("/stop", "now")
+			return nil
+		}, err: ErrReconnectNone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient("inproc://client-err-test", WithTransportName("inproc"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Disconnect()
+			select {
+			case err := <-client.Err():
+				t.Fatalf("expecting nothing before the client is disconnected got: %v", err)
+			default:
+			}
+			if err = tt.teardown(client); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case err := <-client.Err():
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("expecting %v got: %v", tt.err, err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("expecting the termination surfaced")
+			}
+			if _, ok := <-client.Err(); ok {
+				t.Fatal("expecting the channel closed")
+			}
+		})
+	}
+}
+
+func TestClient_ExtensionsOrder(t *testing.T) {
+	defer inproc.Listen("client-extensions-test", fayeserver.NewServer())()
+
+	var mu sync.Mutex
+	var ran []string
+	record := func(name string) message.Extension {
+		return func(m *message.Message) {
+			if m.Channel != message.MetaHandshake {
+				return
+			}
+			mu.Lock()
+			ran = append(ran, name)
+			mu.Unlock()
+		}
+	}
+	client, err := NewClient("inproc://client-extensions-test", WithTransportName("inproc"),
+		WithExtension(record("in 1"), record("out 1")),
+		WithOutExtension(record("out 2")),
+		WithInExtension(record("in 2")),
+		WithExtension(record("in 3"), record("out 3")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect()
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{"out 1", "out 2", "out 3", "in 1", "in 2", "in 3"}
+	if !reflect.DeepEqual(ran, expected) {
+		t.Fatalf("expecting %v got: %v", expected, ran)
+	}
+}
+
+func TestClient_PublishAfter(t *testing.T) {
+	defer inproc.Listen("client-schedule-test", fayeserver.NewServer())()
+
+	client, err := NewClient("inproc://client-schedule-test", WithTransportName("inproc"),
+		WithChannelConfig(ChannelConfig{Pattern: "/foo", BufferSize: 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect()
+	received := make(chan message.Data, 2)
+	if _, err = client.SubscribeFunc("/foo", func(channel string, data message.Data) {
+		received <- data
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	later, err := client.PublishAfter("/foo", "later", 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	canceled, err := client.PublishAfter("/foo", "canceled", 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !canceled.Cancel() || canceled.Err() != ErrScheduleCanceled || canceled.Cancel() {
+		t.Fatalf("expecting the publish canceled once got: %v", canceled.Err())
+	}
+	select {
+	case data := <-received:
+		if data != "later" || time.Since(start) < 20*time.Millisecond {
+			t.Fatalf("expecting the publish delivered after its delay got: %v after %v", data, time.Since(start))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expecting the scheduled publish delivered")
+	}
+	<-later.Done()
+	if later.Err() != nil || later.Cancel() {
+		t.Fatalf("expecting the publish acknowledged got: %v", later.Err())
+	}
+
+	pending, err := client.PublishAt("/foo", "never", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Disconnect()
+	if <-pending.Done(); pending.Err() != ErrDisconnected {
+		t.Fatalf("expecting the pending publish failed with ErrDisconnected got: %v", pending.Err())
+	}
+}
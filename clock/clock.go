@@ -0,0 +1,58 @@
+//Package clock abstracts the time used by the timers of the client, so the tests can drive them with Fake
+//instead of sleeping.
+package clock
+
+import (
+	"time"
+)
+
+//Clock tells the time and creates timers
+type Clock interface {
+	//Now returns the current time
+	Now() time.Time
+	//NewTimer creates a timer sending the time on its channel after d
+	NewTimer(d time.Duration) Timer
+	//AfterFunc calls f in its own goroutine after d, the timer has no channel
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+//Timer is a single event timer, see time.Timer
+type Timer interface {
+	//C returns the channel receiving the time when the timer fires, nil for AfterFunc timers
+	C() <-chan time.Time
+	//Stop prevents the timer from firing, it returns false if the timer already fired or was stopped
+	Stop() bool
+}
+
+//Real is the system clock
+var Real Clock = realClock{}
+
+//Or returns c, or Real if c is nil
+func Or(c Clock) Clock {
+	if c == nil {
+		return Real
+	}
+	return c
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return realTimer{time.AfterFunc(d, f)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
@@ -0,0 +1,114 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+//Fake is a clock that only moves when Advance is called, the timers expiring meanwhile fire in order
+type Fake struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+var _ Clock = (*Fake)(nil)
+
+//NewFake returns a fake clock set to now
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	return f.addTimer(d, make(chan time.Time, 1), nil)
+}
+
+//AfterFunc calls fn from Advance once the timer expires, in the goroutine calling Advance
+func (f *Fake) AfterFunc(d time.Duration, fn func()) Timer {
+	return f.addTimer(d, nil, fn)
+}
+
+//Timers returns the number of timers waiting to fire, so a test can wait for the code under test to set
+//its timer before advancing the clock
+func (f *Fake) Timers() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.timers)
+}
+
+//Advance moves the clock forward by d and fires the timers expiring until then
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	end := f.now.Add(d)
+	for {
+		sort.SliceStable(f.timers, func(i, j int) bool {
+			return f.timers[i].when.Before(f.timers[j].when)
+		})
+		if len(f.timers) == 0 || f.timers[0].when.After(end) {
+			break
+		}
+		t := f.timers[0]
+		f.timers = f.timers[1:]
+		f.now = t.when
+		//the timer may set new timers, fire it unlocked
+		f.mu.Unlock()
+		t.fire()
+		f.mu.Lock()
+	}
+	f.now = end
+	f.mu.Unlock()
+}
+
+func (f *Fake) addTimer(d time.Duration, c chan time.Time, fn func()) *fakeTimer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t := &fakeTimer{clock: f, when: f.now.Add(d), c: c, fn: fn}
+	f.timers = append(f.timers, t)
+	return t
+}
+
+//stop removes the timer, it returns false if it isn't pending
+func (f *Fake) stop(t *fakeTimer) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.timers {
+		if f.timers[i] == t {
+			f.timers = append(f.timers[:i], f.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTimer struct {
+	clock *Fake
+	when  time.Time
+	c     chan time.Time
+	fn    func()
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	return t.clock.stop(t)
+}
+
+func (t *fakeTimer) fire() {
+	if t.fn != nil {
+		t.fn()
+		return
+	}
+	select {
+	case t.c <- t.when:
+	default:
+	}
+}
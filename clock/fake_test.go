@@ -0,0 +1,59 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake_Advance(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := NewFake(start)
+
+	var fired []string
+	f.AfterFunc(2*time.Second, func() {
+		fired = append(fired, "func")
+		//timers set while firing fire in the same Advance if they expire
+		f.AfterFunc(time.Second, func() {
+			fired = append(fired, "nested")
+		})
+	})
+	timer := f.NewTimer(time.Second)
+	stopped := f.NewTimer(time.Second)
+	if !stopped.Stop() || stopped.Stop() {
+		t.Fatal("expecting only the first Stop to stop the timer")
+	}
+	if n := f.Timers(); n != 2 {
+		t.Fatalf("expecting 2 pending timers got: %d", n)
+	}
+
+	f.Advance(500 * time.Millisecond)
+	select {
+	case <-timer.C():
+		t.Fatal("expecting the timer not fired yet")
+	default:
+	}
+
+	f.Advance(3 * time.Second)
+	select {
+	case when := <-timer.C():
+		if !when.Equal(start.Add(time.Second)) {
+			t.Fatalf("expecting the expiration time got: %v", when)
+		}
+	default:
+		t.Fatal("expecting the timer fired")
+	}
+	if len(fired) != 2 || fired[0] != "func" || fired[1] != "nested" {
+		t.Fatalf("expecting func then nested got: %v", fired)
+	}
+	if timer.Stop() {
+		t.Fatal("expecting Stop to return false on a fired timer")
+	}
+	if now := f.Now(); !now.Equal(start.Add(3500 * time.Millisecond)) {
+		t.Fatalf("expecting the clock advanced got: %v", now)
+	}
+	select {
+	case <-stopped.C():
+		t.Fatal("expecting the stopped timer not to fire")
+	default:
+	}
+}
@@ -0,0 +1,273 @@
+//Package cluster groups clients connected to the same servers, e.g. over different transports or endpoints, so the
+//subscriptions are established once, on the active client, and their messages fanned in to a single handler.
+//when the active client loses its connection, a connected standby is promoted and the subscriptions move to it.
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	fayec "github.com/thesyncim/faye"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/subscription"
+	"sync"
+)
+
+//ErrNoClient is returned by Subscribe when no client of the cluster is connected
+var ErrNoClient = errors.New("cluster: no client connected")
+
+//ErrClosed is returned by Subscribe once the cluster is closed
+var ErrClosed = errors.New("cluster: closed")
+
+//Cluster fans in the messages of its subscriptions from the active client, the clients are owned by the
+//application which creates and disconnects them. the messages may be delivered twice while a subscription
+//moves to another client.
+type Cluster struct {
+	clients []*fayec.Client
+
+	mu     sync.Mutex
+	active *fayec.Client
+	//down are the clients that lost their connection and didn't restore it yet
+	down   map[*fayec.Client]bool
+	subs   map[*Subscription]struct{}
+	closed bool
+
+	//failoverMu serializes the promotions
+	failoverMu sync.Mutex
+
+	onPromote []func(client *fayec.Client)
+	onError   []func(err error)
+}
+
+//Subscription is a subscription of the cluster, established on its active client
+type Subscription struct {
+	cluster   *Cluster
+	channel   fayec.Channel
+	onMessage func(channel string, msg message.Data)
+
+	//sub is the subscription of the active client, guarded by the cluster mu
+	sub    *subscription.Subscription
+	client *fayec.Client
+}
+
+//New groups the clients, the first connected one becomes active. the handlers registered on the clients stay
+//registered for their lifetime, a client belongs to a single cluster.
+func New(clients ...*fayec.Client) *Cluster {
+	c := &Cluster{
+		clients: clients,
+		down:    map[*fayec.Client]bool{},
+		subs:    map[*Subscription]struct{}{},
+	}
+	for _, client := range clients {
+		client := client
+		client.OnConnectionLost(func(err error) {
+			c.lost(client)
+		})
+		client.OnDisconnect(func(err error) {
+			c.lost(client)
+		})
+		client.OnReconnect(func() {
+			c.restored(client)
+		})
+	}
+	return c
+}
+
+//OnPromote registers a handler called with the client promoted once the subscriptions moved to it
+func (c *Cluster) OnPromote(onPromote func(client *fayec.Client)) {
+	c.mu.Lock()
+	c.onPromote = append(c.onPromote, onPromote)
+	c.mu.Unlock()
+}
+
+//OnError registers a handler called with the errors of the subscriptions failing to move to a promoted client
+func (c *Cluster) OnError(onError func(err error)) {
+	c.mu.Lock()
+	c.onError = append(c.onError, onError)
+	c.mu.Unlock()
+}
+
+//Active returns the client the subscriptions are established on, nil if none is connected yet
+func (c *Cluster) Active() *fayec.Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.activeClient()
+}
+
+//activeClient returns the active client, electing the first connected one if there is none. mu must be held
+func (c *Cluster) activeClient() *fayec.Client {
+	if c.active == nil {
+		c.active = c.standby(nil)
+	}
+	return c.active
+}
+
+//standby returns the first connected client other than except, nil if there is none. mu must be held
+func (c *Cluster) standby(except *fayec.Client) *fayec.Client {
+	for _, client := range c.clients {
+		if client != except && !c.down[client] && client.State() == fayec.StateConnected {
+			return client
+		}
+	}
+	return nil
+}
+
+//Subscribe subscribes to the channel on the active client, onMessage is called with the messages delivered
+//until the subscription is removed, whichever client delivers them
+func (c *Cluster) Subscribe(channel fayec.Channel, onMessage func(channel string, msg message.Data)) (*Subscription, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, ErrClosed
+	}
+	client := c.activeClient()
+	c.mu.Unlock()
+	if client == nil {
+		return nil, ErrNoClient
+	}
+	s := &Subscription{cluster: c, channel: channel, onMessage: onMessage}
+	sub, err := client.SubscribeFunc(channel, onMessage)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		sub.Unsubscribe()
+		return nil, ErrClosed
+	}
+	s.sub, s.client = sub, client
+	c.subs[s] = struct{}{}
+	if c.active != client {
+		//a promotion ran meanwhile, move the subscription too
+		go c.move(s, c.active)
+	}
+	return s, nil
+}
+
+//Channel returns the channel subscribed
+func (s *Subscription) Channel() fayec.Channel {
+	return s.channel
+}
+
+//Unsubscribe removes the subscription from the cluster and the client it is established on
+func (s *Subscription) Unsubscribe() error {
+	c := s.cluster
+	c.mu.Lock()
+	_, ok := c.subs[s]
+	delete(c.subs, s)
+	sub := s.sub
+	c.mu.Unlock()
+	if !ok || sub == nil {
+		return nil
+	}
+	return sub.Unsubscribe()
+}
+
+//Close removes the subscriptions of the cluster, the clients stay connected
+func (c *Cluster) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	var subs []*subscription.Subscription
+	for s := range c.subs {
+		if s.sub != nil {
+			subs = append(subs, s.sub)
+		}
+	}
+	c.subs = map[*Subscription]struct{}{}
+	c.mu.Unlock()
+	var errs []error
+	for _, sub := range subs {
+		errs = append(errs, sub.Unsubscribe())
+	}
+	return errors.Join(errs...)
+}
+
+//lost promotes a standby when the active client loses its connection
+func (c *Cluster) lost(client *fayec.Client) {
+	c.mu.Lock()
+	c.down[client] = true
+	active := c.active == client && !c.closed
+	c.mu.Unlock()
+	if active {
+		go c.failover(client)
+	}
+}
+
+//restored makes a client that restored its connection eligible again for a promotion
+func (c *Cluster) restored(client *fayec.Client) {
+	c.mu.Lock()
+	delete(c.down, client)
+	c.mu.Unlock()
+}
+
+//failover moves the subscriptions of the failed client to a connected standby. without standby, the failed
+//client keeps them and restores them itself if it reconnects
+func (c *Cluster) failover(failed *fayec.Client) {
+	c.failoverMu.Lock()
+	defer c.failoverMu.Unlock()
+	c.mu.Lock()
+	if c.active != failed || c.closed {
+		c.mu.Unlock()
+		return
+	}
+	promoted := c.standby(failed)
+	if promoted == nil {
+		c.mu.Unlock()
+		return
+	}
+	c.active = promoted
+	subs := make([]*Subscription, 0, len(c.subs))
+	for s := range c.subs {
+		subs = append(subs, s)
+	}
+	onPromote := c.onPromote
+	c.mu.Unlock()
+
+	for _, s := range subs {
+		c.move(s, promoted)
+	}
+	for i := range onPromote {
+		onPromote[i](promoted)
+	}
+}
+
+//move subscribes s on client and removes it from the client it was established on
+func (c *Cluster) move(s *Subscription, client *fayec.Client) {
+	c.mu.Lock()
+	previous := s.sub
+	moved := s.client == client
+	c.mu.Unlock()
+	if moved {
+		return
+	}
+	sub, err := client.SubscribeFunc(s.channel, s.onMessage)
+	if err != nil {
+		c.report(fmt.Errorf("cluster: move `%s`: %w", s.channel, err))
+		return
+	}
+	c.mu.Lock()
+	_, ok := c.subs[s]
+	if ok {
+		s.sub, s.client = sub, client
+	}
+	c.mu.Unlock()
+	if !ok {
+		//unsubscribed meanwhile
+		sub.Unsubscribe()
+		return
+	}
+	if previous != nil {
+		//the failed client mustn't restore it when it reconnects
+		go previous.Unsubscribe()
+	}
+}
+
+//report calls the error handlers
+func (c *Cluster) report(err error) {
+	c.mu.Lock()
+	onError := c.onError
+	c.mu.Unlock()
+	for i := range onError {
+		onError[i](err)
+	}
+}
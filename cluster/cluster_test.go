@@ -0,0 +1,90 @@
+package cluster
+
+import (
+	fayec "github.com/thesyncim/faye"
+	"github.com/thesyncim/faye/fayeserver"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport/inproc"
+	"testing"
+	"time"
+)
+
+func newClient(t *testing.T, endpoint string) *fayec.Client {
+	client, err := fayec.NewClient(endpoint, fayec.WithTransportName("inproc"),
+		fayec.WithChannelConfig(fayec.ChannelConfig{Pattern: "/foo", BufferSize: 10}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestCluster_Failover(t *testing.T) {
+	srv := fayeserver.NewServer()
+	defer inproc.Listen("cluster-a", srv)()
+	defer inproc.Listen("cluster-b", srv)()
+	a, b := newClient(t, "inproc://cluster-a"), newClient(t, "inproc://cluster-b")
+	defer b.Disconnect()
+
+	c := New(a, b)
+	defer c.Close()
+	promoted := make(chan *fayec.Client, 1)
+	c.OnPromote(func(client *fayec.Client) {
+		promoted <- client
+	})
+	received := make(chan message.Data, 10)
+	if _, err := c.Subscribe("/foo", func(channel string, data message.Data) {
+		received <- data
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if c.Active() != a {
+		t.Fatal("expecting the first client active")
+	}
+	expectOnce := func(data string) {
+		t.Helper()
+		if err := srv.Publish("/foo", data); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case got := <-received:
+			if got != data {
+				t.Fatalf("expecting %s got: %v", data, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expecting %s delivered", data)
+		}
+		select {
+		case got := <-received:
+			t.Fatalf("expecting a single delivery got: %v", got)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	expectOnce("1")
+
+	a.Disconnect()
+	select {
+	case client := <-promoted:
+		if client != b || c.Active() != b {
+			t.Fatal("expecting the standby promoted")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expecting a promotion")
+	}
+	expectOnce("2")
+}
+
+func TestCluster_NoClient(t *testing.T) {
+	srv := fayeserver.NewServer()
+	defer inproc.Listen("cluster-none", srv)()
+	client := newClient(t, "inproc://cluster-none")
+	client.Disconnect()
+
+	c := New(client)
+	if _, err := c.Subscribe("/foo", func(string, message.Data) {}); err != ErrNoClient {
+		t.Fatalf("expecting ErrNoClient got: %v", err)
+	}
+	c.Close()
+	if _, err := c.Subscribe("/foo", func(string, message.Data) {}); err != ErrClosed {
+		t.Fatalf("expecting ErrClosed got: %v", err)
+	}
+}
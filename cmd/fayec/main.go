@@ -0,0 +1,155 @@
+//Command fayec publishes to and subscribes to the channels of a faye server, e.g. to debug it:
+//
+//	fayec sub ws://localhost:8000/faye /foo /bar/*
+//	fayec pub ws://localhost:8000/faye /foo '{"k":"v"}'
+//
+//sub prints the messages delivered as JSON lines until interrupted, pub publishes the data, parsed as JSON or sent
+//as a string otherwise, and waits for the server acknowledgement. run fayec -h for the flags.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/thesyncim/faye"
+	"github.com/thesyncim/faye/extensions"
+	"github.com/thesyncim/faye/message"
+	_ "github.com/thesyncim/faye/transport/eventsource"
+	_ "github.com/thesyncim/faye/transport/streaming"
+	_ "github.com/thesyncim/faye/transport/websocketctx"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+//errUsage is returned for invalid command lines, the usage is printed already
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := run(ctx, os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if err != errUsage && err != flag.ErrHelp {
+			fmt.Fprintln(os.Stderr, "fayec:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+//config holds the flags shared by the commands
+type config struct {
+	token     string
+	transport string
+	verbose   bool
+	count     int
+	timeout   time.Duration
+}
+
+//run runs the command line args, the messages are written to stdout and the usage and logs to stderr
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	var cfg config
+	flags := flag.NewFlagSet("fayec", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&cfg.token, "token", "", "token sent in ext.auth of the handshakes and subscribes")
+	flags.StringVar(&cfg.transport, "transport", "websocket", "transport connecting to the server, e.g. long-polling")
+	flags.BoolVar(&cfg.verbose, "v", false, "log the activity of the client to stderr")
+	flags.IntVar(&cfg.count, "n", 0, "sub: exit after n messages, 0 never does")
+	flags.DurationVar(&cfg.timeout, "timeout", 10*time.Second, "bound the handshake and the publish acknowledgement")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: fayec [flags] sub <url> <channel>...")
+		fmt.Fprintln(stderr, "       fayec [flags] pub <url> <channel> <data>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	switch {
+	case len(args) >= 3 && args[0] == "sub":
+		return subscribe(ctx, cfg, args[1], args[2:], stdout, stderr)
+	case len(args) == 4 && args[0] == "pub":
+		return publish(ctx, cfg, args[1], args[2], args[3], stderr)
+	}
+	flags.Usage()
+	return errUsage
+}
+
+//connect creates a client connected to url, with the auth extension running from the handshake on. the
+//connection lasts until the client is closed
+func connect(cfg config, url string, stderr io.Writer) (*fayec.Client, error) {
+	opts := []fayec.Option{fayec.WithTransportName(cfg.transport), fayec.WithHandshakeTimeout(cfg.timeout)}
+	if cfg.token != "" {
+		opts = append(opts, fayec.WithPipeExtension(extensions.NewAuth(cfg.token, nil)))
+	}
+	if cfg.verbose {
+		opts = append(opts, fayec.WithLogger(slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+	}
+	return fayec.NewClient(url, opts...)
+}
+
+//closeClient closes the client gracefully, waiting at most timeout
+func closeClient(client *fayec.Client, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	client.Close(ctx)
+}
+
+//subscribe prints the messages delivered on the channels as JSON lines until ctx is done or count messages
+//were printed
+func subscribe(ctx context.Context, cfg config, url string, channels []string, stdout, stderr io.Writer) error {
+	client, err := connect(cfg, url, stderr)
+	if err != nil {
+		return err
+	}
+	defer closeClient(client, cfg.timeout)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	received := make(chan *message.Message)
+	for _, name := range channels {
+		if _, err = client.SubscribeRaw(fayec.Channel(name), func(msg *message.Message) {
+			select {
+			case received <- msg:
+			case <-ctx.Done():
+			}
+		}); err != nil {
+			return err
+		}
+	}
+	enc := json.NewEncoder(stdout)
+	for printed := 0; cfg.count == 0 || printed < cfg.count; printed++ {
+		select {
+		case msg := <-received:
+			if err = enc.Encode(msg); err != nil {
+				return err
+			}
+		case err = <-client.Err():
+			return err
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
+
+//publish publishes the data on the channel and waits for the server acknowledgement
+func publish(ctx context.Context, cfg config, url string, channel string, data string, stderr io.Writer) error {
+	client, err := connect(cfg, url, stderr)
+	if err != nil {
+		return err
+	}
+	defer closeClient(client, cfg.timeout)
+
+	var payload message.Data
+	if err = json.Unmarshal([]byte(data), &payload); err != nil {
+		payload = data
+	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.timeout)
+	defer cancel()
+	return client.PublishWithAck(ctx, fayec.Channel(channel), payload)
+}
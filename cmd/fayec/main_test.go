@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/thesyncim/faye/fayeserver"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport/inproc"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun_PubSub(t *testing.T) {
+	defer inproc.Listen("fayec-cmd-test", fayeserver.NewServer())()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var out bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		done <- run(ctx, []string{"-transport", "inproc", "-n", "1", "sub", "inproc://fayec-cmd-test", "/foo"}, &out, io.Discard)
+	}()
+
+	//published until the subscriber prints it, it may not be subscribed yet
+	for printed := false; !printed; {
+		if err := run(ctx, []string{"-transport", "inproc", "pub", "inproc://fayec-cmd-test", "/foo", `{"k":"v"}`}, io.Discard, io.Discard); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+			printed = true
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expecting 1 line got: %q", out.String())
+	}
+	var msg message.Message
+	if err := json.Unmarshal([]byte(lines[0]), &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Channel != "/foo" || !reflect.DeepEqual(msg.Data, map[string]interface{}{"k": "v"}) {
+		t.Fatalf("expecting the data published on /foo got: %s", lines[0])
+	}
+}
+
+func TestRun_SubConnectCycles(t *testing.T) {
+	//the session expires unless the subscriber keeps connecting
+	server := fayeserver.NewServer(fayeserver.WithTimeout(10*time.Millisecond), fayeserver.WithSessionTimeout(20*time.Millisecond),
+		fayeserver.WithAuthenticator(func(r *http.Request, m *message.Message) error {
+			if ext, _ := m.Ext.(map[string]interface{}); ext == nil || !reflect.DeepEqual(ext["auth"], map[string]interface{}{"token": "secret"}) {
+				return errors.New("invalid token")
+			}
+			return nil
+		}))
+	defer inproc.Listen("fayec-cmd-cycles-test", server)()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var out bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		done <- run(ctx, []string{"-transport", "inproc", "-token", "secret", "-n", "1", "sub", "inproc://fayec-cmd-cycles-test", "/foo"}, &out, io.Discard)
+	}()
+	for server.Clients() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	//several session timeouts pass before the publish
+	time.Sleep(200 * time.Millisecond)
+	if err := run(ctx, []string{"-transport", "inproc", "-token", "secret", "pub", "inproc://fayec-cmd-cycles-test", "/foo", "bar"}, io.Discard, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expecting the subscriber still receiving")
+	}
+	if !strings.Contains(out.String(), `"data":"bar"`) {
+		t.Fatalf("expecting the publish printed got: %q", out.String())
+	}
+}
+
+func TestRun_Usage(t *testing.T) {
+	var stderr bytes.Buffer
+	if err := run(context.Background(), []string{"pub", "inproc://fayec-cmd-test"}, io.Discard, &stderr); err != errUsage {
+		t.Fatalf("expecting errUsage got: %v", err)
+	}
+	if !strings.Contains(stderr.String(), "usage: fayec") {
+		t.Fatalf("expecting the usage printed got: %q", stderr.String())
+	}
+}
@@ -0,0 +1,58 @@
+package codec
+
+import (
+	"encoding/json"
+	"github.com/thesyncim/faye/message"
+	"strings"
+)
+
+//Codec encodes the batches of messages sent to the server and decodes the batches received,
+//register it with fayec.WithCodec. the server must speak the same wire format.
+type Codec interface {
+	//Name identifies the codec, e.g. json
+	Name() string
+	//ContentType is the media type of the encoded batches, sent as the Content-Type of the polling requests
+	ContentType() string
+	Marshal(msgs []message.Message) ([]byte, error)
+	Unmarshal(b []byte) ([]message.Message, error)
+}
+
+//PointerMarshaler is implemented by the codecs encoding the messages in place, without copying them into a batch
+//of values first, transport.Options.Encode prefers it to Marshal
+type PointerMarshaler interface {
+	MarshalPointers(msgs []*message.Message) ([]byte, error)
+}
+
+//JSON is the default codec, it encodes with encoding/json and decodes with the Parser, a lenient one if nil
+type JSON struct {
+	Parser *message.Parser
+}
+
+var (
+	_ Codec            = JSON{}
+	_ PointerMarshaler = JSON{}
+)
+
+func (JSON) Name() string { return "json" }
+
+func (JSON) ContentType() string { return "application/json" }
+
+func (JSON) Marshal(msgs []message.Message) ([]byte, error) {
+	return json.Marshal(msgs)
+}
+
+func (JSON) MarshalPointers(msgs []*message.Message) ([]byte, error) {
+	return json.Marshal(msgs)
+}
+
+func (c JSON) Unmarshal(b []byte) ([]message.Message, error) {
+	if c.Parser == nil {
+		return (&message.Parser{}).Parse(b)
+	}
+	return c.Parser.Parse(b)
+}
+
+//IsJSON reports whether c encodes to json, sent in websocket text frames, the other codecs use binary frames
+func IsJSON(c Codec) bool {
+	return strings.HasSuffix(c.ContentType(), "json")
+}
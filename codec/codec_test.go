@@ -0,0 +1,47 @@
+package codec
+
+import (
+	"github.com/thesyncim/faye/message"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	c := JSON{Parser: &message.Parser{Numbers: message.PreserveIntegers}}
+	b, err := c.Marshal([]message.Message{{Channel: "/foo", Id: "1", Data: map[string]interface{}{"n": 9007199254740993}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := c.Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || msgs[0].Channel != "/foo" || msgs[0].Id != "1" {
+		t.Fatalf("expecting the message back got: %+v", msgs)
+	}
+	if n := msgs[0].Data.(map[string]interface{})["n"]; n != int64(9007199254740993) {
+		t.Fatalf("expecting the parser number mode got: %v", n)
+	}
+}
+
+func TestIsJSON(t *testing.T) {
+	var tests = []struct {
+		contentType string
+		expected    bool
+	}{
+		{"application/json", true},
+		{"application/vnd.faye+json", true},
+		{"application/msgpack", false},
+	}
+	for _, tt := range tests {
+		if got := IsJSON(contentType(tt.contentType)); got != tt.expected {
+			t.Errorf("%s: expecting %v got: %v", tt.contentType, tt.expected, got)
+		}
+	}
+}
+
+type contentType string
+
+func (c contentType) Name() string                                 { return string(c) }
+func (c contentType) ContentType() string                          { return string(c) }
+func (contentType) Marshal(msgs []message.Message) ([]byte, error) { return nil, nil }
+func (contentType) Unmarshal(b []byte) ([]message.Message, error)  { return nil, nil }
@@ -0,0 +1,52 @@
+package jsoniter
+
+import (
+	"bytes"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/thesyncim/faye/codec"
+	"github.com/thesyncim/faye/message"
+)
+
+//Codec encodes the messages as json with json-iterator, faster than encoding/json on large batches.
+//unlike the default codec the server quirks, e.g. numeric ids, aren't coerced and fail the batch.
+type Codec struct {
+	api jsoniter.API
+}
+
+var (
+	_ codec.Codec            = (*Codec)(nil)
+	_ codec.PointerMarshaler = (*Codec)(nil)
+)
+
+//New creates a json-iterator codec compatible with encoding/json
+func New() *Codec {
+	return &Codec{api: jsoniter.ConfigCompatibleWithStandardLibrary}
+}
+
+func (c *Codec) Name() string { return "json" }
+
+func (c *Codec) ContentType() string { return "application/json" }
+
+func (c *Codec) Marshal(msgs []message.Message) ([]byte, error) {
+	return c.api.Marshal(msgs)
+}
+
+func (c *Codec) MarshalPointers(msgs []*message.Message) ([]byte, error) {
+	return c.api.Marshal(msgs)
+}
+
+//Unmarshal decodes a json array of messages, or a single message sent alone
+func (c *Codec) Unmarshal(b []byte) ([]message.Message, error) {
+	if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '{' {
+		var m message.Message
+		if err := c.api.Unmarshal(b, &m); err != nil {
+			return nil, err
+		}
+		return []message.Message{m}, nil
+	}
+	var msgs []message.Message
+	if err := c.api.Unmarshal(b, &msgs); err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
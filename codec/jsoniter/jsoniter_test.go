@@ -0,0 +1,37 @@
+package jsoniter
+
+import (
+	"github.com/thesyncim/faye/message"
+	"testing"
+	"time"
+)
+
+func TestCodec(t *testing.T) {
+	c := New()
+	b, err := c.Marshal([]message.Message{{Channel: "/foo", Id: "1", Data: "hello"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `[{"channel":"/foo","id":"1","data":"hello"}]` {
+		t.Fatalf("expecting the encoding/json output got: %s", b)
+	}
+
+	var tests = []struct {
+		name  string
+		batch string
+	}{
+		{"array", `[{"channel":"/meta/connect","successful":true,"advice":{"interval":500,"timeout":30000}}]`},
+		{"single message", `{"channel":"/meta/connect","successful":true,"advice":{"interval":500,"timeout":30000}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgs, err := c.Unmarshal([]byte(tt.batch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(msgs) != 1 || !msgs[0].Successful || msgs[0].Advice.Timeout != 30*time.Second {
+				t.Fatalf("expecting the connect response got: %+v", msgs)
+			}
+		})
+	}
+}
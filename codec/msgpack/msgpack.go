@@ -0,0 +1,129 @@
+package msgpack
+
+import (
+	"github.com/thesyncim/faye/codec"
+	"github.com/thesyncim/faye/message"
+	"github.com/vmihailenco/msgpack/v5"
+	"time"
+)
+
+//Codec encodes the messages as MessagePack maps keyed like their json fields, the advice interval and timeout
+//in milliseconds. it suits servers speaking MessagePack over websocket binary frames or polling requests.
+type Codec struct{}
+
+var _ codec.Codec = Codec{}
+
+//New creates a MessagePack codec
+func New() Codec {
+	return Codec{}
+}
+
+func (Codec) Name() string { return "msgpack" }
+
+func (Codec) ContentType() string { return "application/msgpack" }
+
+func (Codec) Marshal(msgs []message.Message) ([]byte, error) {
+	batch := make([]wireMessage, len(msgs))
+	for i := range msgs {
+		batch[i] = toWire(&msgs[i])
+	}
+	return msgpack.Marshal(batch)
+}
+
+func (Codec) Unmarshal(b []byte) ([]message.Message, error) {
+	var batch []wireMessage
+	if err := msgpack.Unmarshal(b, &batch); err != nil {
+		return nil, err
+	}
+	msgs := make([]message.Message, len(batch))
+	for i := range batch {
+		msgs[i] = fromWire(&batch[i])
+	}
+	return msgs, nil
+}
+
+//wireMessage mirrors message.Message with the msgpack keys
+type wireMessage struct {
+	Channel                  string      `msgpack:"channel,omitempty"`
+	Version                  string      `msgpack:"version,omitempty"`
+	SupportedConnectionTypes []string    `msgpack:"supportedConnectionTypes,omitempty"`
+	ConnectionType           string      `msgpack:"connectionType,omitempty"`
+	MinimumVersion           string      `msgpack:"minimumVersion,omitempty"`
+	Successful               bool        `msgpack:"successful,omitempty"`
+	Ext                      interface{} `msgpack:"ext,omitempty"`
+	Id                       string      `msgpack:"id,omitempty"`
+	ClientId                 string      `msgpack:"clientId,omitempty"`
+	Advice                   *wireAdvice `msgpack:"advice,omitempty"`
+	Data                     interface{} `msgpack:"data,omitempty"`
+	Timestamp                uint64      `msgpack:"timestamp,omitempty"`
+	AuthSuccessful           bool        `msgpack:"authSuccessful,omitempty"`
+	Error                    string      `msgpack:"error,omitempty"`
+	Subscription             string      `msgpack:"subscription,omitempty"`
+}
+
+//wireAdvice carries the durations in milliseconds as the json advice
+type wireAdvice struct {
+	Reconnect       string   `msgpack:"reconnect,omitempty"`
+	Interval        int64    `msgpack:"interval,omitempty"`
+	Timeout         int64    `msgpack:"timeout"`
+	MultipleClients bool     `msgpack:"multiple-clients,omitempty"`
+	Hosts           []string `msgpack:"hosts,omitempty"`
+}
+
+func toWire(m *message.Message) wireMessage {
+	w := wireMessage{
+		Channel:                  m.Channel,
+		Version:                  m.Version,
+		SupportedConnectionTypes: m.SupportedConnectionTypes,
+		ConnectionType:           m.ConnectionType,
+		MinimumVersion:           m.MinimumVersion,
+		Successful:               m.Successful,
+		Ext:                      m.Ext,
+		Id:                       m.Id,
+		ClientId:                 m.ClientId,
+		Data:                     m.Data,
+		Timestamp:                m.Timestamp,
+		AuthSuccessful:           m.AuthSuccessful,
+		Error:                    m.Error,
+		Subscription:             m.Subscription,
+	}
+	if a := m.Advice; a != nil {
+		w.Advice = &wireAdvice{
+			Reconnect:       string(a.Reconnect),
+			Interval:        int64(a.Interval / time.Millisecond),
+			Timeout:         int64(a.Timeout / time.Millisecond),
+			MultipleClients: a.MultipleClients,
+			Hosts:           a.Hosts,
+		}
+	}
+	return w
+}
+
+func fromWire(w *wireMessage) message.Message {
+	m := message.Message{
+		Channel:                  w.Channel,
+		Version:                  w.Version,
+		SupportedConnectionTypes: w.SupportedConnectionTypes,
+		ConnectionType:           w.ConnectionType,
+		MinimumVersion:           w.MinimumVersion,
+		Successful:               w.Successful,
+		Ext:                      w.Ext,
+		Id:                       w.Id,
+		ClientId:                 w.ClientId,
+		Data:                     w.Data,
+		Timestamp:                w.Timestamp,
+		AuthSuccessful:           w.AuthSuccessful,
+		Error:                    w.Error,
+		Subscription:             w.Subscription,
+	}
+	if a := w.Advice; a != nil {
+		m.Advice = &message.Advise{
+			Reconnect:       message.Reconnect(a.Reconnect),
+			Interval:        time.Duration(a.Interval) * time.Millisecond,
+			Timeout:         time.Duration(a.Timeout) * time.Millisecond,
+			MultipleClients: a.MultipleClients,
+			Hosts:           a.Hosts,
+		}
+	}
+	return m
+}
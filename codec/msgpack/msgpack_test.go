@@ -0,0 +1,37 @@
+package msgpack
+
+import (
+	"github.com/thesyncim/faye/message"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCodec(t *testing.T) {
+	c := New()
+	sent := []message.Message{
+		{Channel: message.MetaConnect, Id: "1", ClientId: "abc", Successful: true,
+			Advice: &message.Advise{Reconnect: message.ReconnectRetry, Interval: 500 * time.Millisecond, Timeout: 30 * time.Second}},
+		{Channel: "/foo", Data: map[string]interface{}{"text": "hello"}, Ext: map[string]interface{}{"token": "t"}},
+	}
+	b, err := c.Marshal(sent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := c.Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("expecting 2 messages got: %d", len(msgs))
+	}
+	if m := msgs[0]; m.Id != "1" || m.ClientId != "abc" || !m.Successful || !reflect.DeepEqual(m.Advice, sent[0].Advice) {
+		t.Fatalf("expecting the connect response back got: %+v", m)
+	}
+	if text := msgs[1].Data.(map[string]interface{})["text"]; text != "hello" {
+		t.Fatalf("expecting hello got: %v", text)
+	}
+	if token := msgs[1].Ext.(map[string]interface{})["token"]; token != "t" {
+		t.Fatalf("expecting the ext back got: %v", msgs[1].Ext)
+	}
+}
@@ -0,0 +1,84 @@
+package compression
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+)
+
+//Codec compresses the data of the messages, the client advertises the codecs it supports during the handshake
+//and uses the one the server confirms for the rest of the session
+type Codec interface {
+	//Name identifies the codec in the handshake ext, e.g. gzip
+	Name() string
+	Compress(b []byte) ([]byte, error)
+	Decompress(b []byte) ([]byte, error)
+}
+
+var (
+	//Gzip compresses the data with gzip
+	Gzip Codec = gzipCodec{}
+	//Deflate compresses the data with raw deflate
+	Deflate Codec = deflateCodec{}
+)
+
+//Select returns the codec named name, ok is false if none matches
+func Select(codecs []Codec, name string) (codec Codec, ok bool) {
+	for i := range codecs {
+		if codecs[i].Name() == name {
+			return codecs[i], true
+		}
+	}
+	return nil, false
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string { return "gzip" }
+
+func (gzipCodec) Compress(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCodec) Decompress(b []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+type deflateCodec struct{}
+
+func (deflateCodec) Name() string { return "deflate" }
+
+func (deflateCodec) Compress(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(b); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (deflateCodec) Decompress(b []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(b))
+	defer r.Close()
+	return io.ReadAll(r)
+}
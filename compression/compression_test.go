@@ -0,0 +1,48 @@
+package compression
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCodecs(t *testing.T) {
+	var tests = []struct {
+		codec Codec
+		name  string
+	}{
+		{codec: Gzip, name: "gzip"},
+		{codec: Deflate, name: "deflate"},
+	}
+	payload := bytes.Repeat([]byte(`{"price":42}`), 100)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.codec.Name() != tt.name {
+				t.Fatalf("expecting name %s got: %s", tt.name, tt.codec.Name())
+			}
+			compressed, err := tt.codec.Compress(payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(compressed) >= len(payload) {
+				t.Fatalf("expecting the payload compressed got %d bytes", len(compressed))
+			}
+			got, err := tt.codec.Decompress(compressed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, payload) {
+				t.Fatalf("expecting %s got: %s", payload, got)
+			}
+		})
+	}
+}
+
+func TestSelect(t *testing.T) {
+	codecs := []Codec{Gzip, Deflate}
+	if codec, ok := Select(codecs, "deflate"); !ok || codec != Deflate {
+		t.Fatalf("expecting deflate got: %v", codec)
+	}
+	if _, ok := Select(codecs, "br"); ok {
+		t.Fatal("expecting no codec for an unknown name")
+	}
+}
@@ -0,0 +1,240 @@
+//Package conformance verifies that a transport.Transport speaks the Bayeux protocol as the dispatcher expects, against
+//a scriptable server fixture instead of a live faye server: canned handshake rejections, advice variations,
+//out of order responses and malformed frames. see Run, e.g. in a test of the transport package:
+//
+//	func TestConformance(t *testing.T) {
+//		conformance.Run(t, mytransport.New, "ws")
+//	}
+package conformance
+
+import (
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"github.com/thesyncim/faye/message"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+//ClientID is the clientId assigned by the default handshake handler of the Server
+const ClientID = "conformance-client"
+
+//Handler returns the responses to a message received by the Server, in order
+type Handler func(m *message.Message) []*message.Message
+
+//Server is a Bayeux server fixture speaking websocket and http long-polling, scripted per channel with Handle.
+//by default it accepts the handshakes, answers the connects right away and acknowledges every other message.
+//the websocket responses are written one per frame, the polling ones in the body of the request.
+type Server struct {
+	upgrader websocket.Upgrader
+
+	mu       sync.Mutex
+	handlers map[string]Handler
+	received []*message.Message
+	//reorder reverses the responses of every batch, see Reorder
+	reorder bool
+	//conns are the websocket connections, frames are pushed to them
+	conns map[*websocket.Conn]*sync.Mutex
+	//pushed are the frames waiting for the next polling connect, see Push
+	pushed [][]byte
+
+	connects int64
+}
+
+var _ http.Handler = (*Server)(nil)
+
+//NewServer creates a Server with the default handlers
+func NewServer() *Server {
+	return &Server{
+		handlers: map[string]Handler{},
+		conns:    map[*websocket.Conn]*sync.Mutex{},
+	}
+}
+
+//Handle scripts the responses to the messages of the channel, e.g. Reject(...) for message.MetaHandshake
+func (s *Server) Handle(channel string, h Handler) {
+	s.mu.Lock()
+	s.handlers[channel] = h
+	s.mu.Unlock()
+}
+
+//Reorder makes the server respond to the messages of a batch in the reverse order
+func (s *Server) Reorder(reorder bool) {
+	s.mu.Lock()
+	s.reorder = reorder
+	s.mu.Unlock()
+}
+
+//Received returns the messages received so far, in order
+func (s *Server) Received() []*message.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*message.Message(nil), s.received...)
+}
+
+//Push sends a raw frame, e.g. a malformed one or a delivery, to the websocket connections. without websocket
+//connection it is the body of the response to the next polling request carrying a /meta/connect, in place of
+//the responses to the batch.
+func (s *Server) Push(frame []byte) {
+	s.mu.Lock()
+	if len(s.conns) == 0 {
+		s.pushed = append(s.pushed, frame)
+		s.mu.Unlock()
+		return
+	}
+	conns := make(map[*websocket.Conn]*sync.Mutex, len(s.conns))
+	for conn, mu := range s.conns {
+		conns[conn] = mu
+	}
+	s.mu.Unlock()
+	for conn, mu := range conns {
+		mu.Lock()
+		conn.WriteMessage(websocket.TextMessage, frame)
+		mu.Unlock()
+	}
+}
+
+//ServeHTTP upgrades the websocket requests and answers the polling ones
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		s.serveWebsocket(w, r)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	msgs, connect := s.respond(body)
+	if connect {
+		s.mu.Lock()
+		var frame []byte
+		if len(s.pushed) > 0 {
+			frame, s.pushed = s.pushed[0], s.pushed[1:]
+		}
+		s.mu.Unlock()
+		if frame != nil {
+			w.Write(frame)
+			return
+		}
+	}
+	if msgs == nil {
+		msgs = []*message.Message{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(msgs)
+}
+
+func (s *Server) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	mu := &sync.Mutex{}
+	s.mu.Lock()
+	s.conns[conn] = mu
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		msgs, _ := s.respond(data)
+		mu.Lock()
+		for i := range msgs {
+			conn.WriteJSON([]*message.Message{msgs[i]})
+		}
+		mu.Unlock()
+	}
+}
+
+//respond returns the responses to a batch, connect is true if it carries a /meta/connect
+func (s *Server) respond(data []byte) (resps []*message.Message, connect bool) {
+	var parser message.Parser
+	msgs, _ := parser.Parse(data)
+	s.mu.Lock()
+	reorder := s.reorder
+	s.mu.Unlock()
+	for i := range msgs {
+		m := &msgs[i]
+		if m.Channel == message.MetaConnect {
+			connect = true
+		}
+		s.mu.Lock()
+		s.received = append(s.received, m)
+		h, ok := s.handlers[m.Channel]
+		s.mu.Unlock()
+		if !ok {
+			h = s.defaultHandler
+		}
+		resps = append(resps, h(m)...)
+	}
+	if reorder {
+		for i, j := 0, len(resps)-1; i < j; i, j = i+1, j-1 {
+			resps[i], resps[j] = resps[j], resps[i]
+		}
+	}
+	return resps, connect
+}
+
+//defaultHandler accepts the handshakes, answers the connects and acknowledges the other messages
+func (s *Server) defaultHandler(m *message.Message) []*message.Message {
+	switch m.Channel {
+	case message.MetaHandshake:
+		return []*message.Message{{
+			Channel:                  m.Channel,
+			Id:                       m.Id,
+			Version:                  "1.0",
+			SupportedConnectionTypes: []string{"websocket", "long-polling"},
+			ClientId:                 ClientID,
+			Successful:               true,
+		}}
+	case message.MetaConnect:
+		n := atomic.AddInt64(&s.connects, 1)
+		return []*message.Message{{
+			Channel:    m.Channel,
+			Id:         m.Id,
+			ClientId:   m.ClientId,
+			Successful: true,
+			Advice:     &message.Advise{Reconnect: message.ReconnectRetry, Interval: 0, Timeout: 0},
+			Ext:        map[string]interface{}{"connect": strconv.FormatInt(n, 10)},
+		}}
+	}
+	return []*message.Message{Ack(m)}
+}
+
+//Ack returns the successful response to m
+func Ack(m *message.Message) *message.Message {
+	return &message.Message{Channel: m.Channel, Id: m.Id, ClientId: m.ClientId, Subscription: m.Subscription, Successful: true}
+}
+
+//Reject is a Handler responding unsuccessfully with the Bayeux error, e.g. 401::unauthorized, and the advice if not nil
+func Reject(err string, advice *message.Advise) Handler {
+	return func(m *message.Message) []*message.Message {
+		return []*message.Message{{
+			Channel:      m.Channel,
+			Id:           m.Id,
+			ClientId:     m.ClientId,
+			Subscription: m.Subscription,
+			Error:        err,
+			Advice:       advice,
+		}}
+	}
+}
+
+//Advise is a Handler acknowledging the messages with the advice
+func Advise(advice message.Advise) Handler {
+	return func(m *message.Message) []*message.Message {
+		resp := Ack(m)
+		resp.Advice = &advice
+		return []*message.Message{resp}
+	}
+}
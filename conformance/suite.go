@@ -0,0 +1,257 @@
+package conformance
+
+import (
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+//timeout bounds the wait for the messages expected by the suite
+const timeout = 2 * time.Second
+
+//Run exercises the transports created by newTransport against a Server, the endpoint scheme is ws or http
+//depending on how the transport reaches it
+func Run(t *testing.T, newTransport func() transport.Transport, scheme string) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, h *harness)
+	}{
+		{name: "handshake", run: testHandshake},
+		{name: "handshake rejected", run: testHandshakeRejected},
+		{name: "connect advice", run: testConnectAdvice},
+		{name: "out of order responses", run: testOutOfOrder},
+		{name: "malformed frame", run: testMalformedFrame},
+		{name: "disconnect", run: testDisconnect},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := NewServer()
+			hs := httptest.NewServer(srv)
+			defer hs.Close()
+			h := &harness{
+				srv:      srv,
+				tr:       newTransport(),
+				endpoint: scheme + strings.TrimPrefix(hs.URL, "http"),
+				msgs:     make(chan *message.Message, 100),
+				errs:     make(chan error, 100),
+			}
+			tt.run(t, h)
+			if closer, ok := h.tr.(transport.Closer); ok {
+				closer.Close()
+			}
+		})
+	}
+}
+
+//harness is a transport under test and the Server it is connected to
+type harness struct {
+	srv      *Server
+	tr       transport.Transport
+	endpoint string
+	msgs     chan *message.Message
+	errs     chan error
+}
+
+//init initializes the transport and records the messages and errors it reports
+func (h *harness) init(t *testing.T) {
+	t.Helper()
+	h.tr.SetOnMessageReceivedHandler(func(msg *message.Message) {
+		h.msgs <- msg
+	})
+	h.tr.SetOnErrorHandler(func(err error) {
+		h.errs <- err
+	})
+	h.tr.SetOnTransportDownHandler(func(err error) {})
+	h.tr.SetOnTransportUpHandler(func() {})
+	if err := h.tr.Init(h.endpoint, &transport.Options{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//handshake initializes the transport and handshakes successfully
+func (h *harness) handshake(t *testing.T) {
+	t.Helper()
+	h.init(t)
+	resp, err := h.tr.Handshake(&message.Message{Channel: message.MetaHandshake, Version: "1.0", Id: "hs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Successful {
+		t.Fatalf("expecting the handshake successful got: %+v", resp)
+	}
+}
+
+//connect sends a connect message, the response is dispatched
+func (h *harness) connect(t *testing.T, id string) {
+	t.Helper()
+	if err := h.tr.Connect(&message.Message{Channel: message.MetaConnect, ClientId: h.tr.ClientID(), ConnectionType: h.tr.Name(), Id: id}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//expect returns the first message dispatched matching the predicate, skipping the others
+func (h *harness) expect(t *testing.T, what string, match func(msg *message.Message) bool) *message.Message {
+	t.Helper()
+	deadline := time.After(timeout)
+	for {
+		select {
+		case msg := <-h.msgs:
+			if match(msg) {
+				return msg
+			}
+		case <-deadline:
+			t.Fatalf("expecting %s dispatched", what)
+		}
+	}
+}
+
+//received reports whether the server received a message on the channel
+func (h *harness) received(channel string) bool {
+	for _, msg := range h.srv.Received() {
+		if msg.Channel == channel {
+			return true
+		}
+	}
+	return false
+}
+
+func testHandshake(t *testing.T, h *harness) {
+	h.handshake(t)
+	if h.tr.ClientID() != ClientID {
+		t.Fatalf("expecting the clientId %s got: %q", ClientID, h.tr.ClientID())
+	}
+	if h.tr.ConnectionState() != transport.StateConnected {
+		t.Fatalf("expecting the transport connected got: %v", h.tr.ConnectionState())
+	}
+	received := h.srv.Received()
+	if len(received) != 1 || received[0].Channel != message.MetaHandshake || received[0].Version != "1.0" {
+		t.Fatalf("expecting the handshake received got: %+v", received)
+	}
+}
+
+func testHandshakeRejected(t *testing.T, h *harness) {
+	h.srv.Handle(message.MetaHandshake, Reject("401::unauthorized", &message.Advise{Reconnect: message.ReconnectNone}))
+	h.init(t)
+	resp, err := h.tr.Handshake(&message.Message{Channel: message.MetaHandshake, Version: "1.0", Id: "hs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Successful || resp.Error != "401::unauthorized" {
+		t.Fatalf("expecting the handshake rejected got: %+v", resp)
+	}
+	if resp.Advice == nil || resp.Advice.Reconnect != message.ReconnectNone {
+		t.Fatalf("expecting the advice returned got: %+v", resp.Advice)
+	}
+	if h.tr.ClientID() != "" {
+		t.Fatalf("expecting no clientId got: %q", h.tr.ClientID())
+	}
+}
+
+func testConnectAdvice(t *testing.T, h *harness) {
+	advices := []message.Advise{
+		{Reconnect: message.ReconnectRetry, Interval: 10 * time.Millisecond, Timeout: time.Second},
+		{Reconnect: message.ReconnectHandshake, Interval: time.Second},
+		{Reconnect: message.ReconnectRetry, MultipleClients: true, Hosts: []string{"localhost"}},
+		{Reconnect: message.ReconnectNone},
+	}
+	h.handshake(t)
+	for i, advice := range advices {
+		h.srv.Handle(message.MetaConnect, Advise(advice))
+		id := "connect" + strconv.Itoa(i)
+		h.connect(t, id)
+		msg := h.expect(t, "the connect response", func(msg *message.Message) bool {
+			return msg.Id == id
+		})
+		if msg.Advice == nil || !reflect.DeepEqual(*msg.Advice, advice) {
+			t.Fatalf("expecting the advice %+v got: %+v", advice, msg.Advice)
+		}
+	}
+}
+
+func testOutOfOrder(t *testing.T, h *harness) {
+	h.handshake(t)
+	h.connect(t, "connect")
+	h.expect(t, "the connect response", func(msg *message.Message) bool {
+		return msg.Id == "connect"
+	})
+	h.srv.Reorder(true)
+	err := h.tr.SendMessages([]*message.Message{
+		{Channel: message.MetaSubscribe, ClientId: h.tr.ClientID(), Subscription: "/a", Id: "1"},
+		{Channel: message.MetaSubscribe, ClientId: h.tr.ClientID(), Subscription: "/b", Id: "2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for len(ids) < 2 {
+		msg := h.expect(t, "the subscribe responses", func(msg *message.Message) bool {
+			return msg.Channel == message.MetaSubscribe
+		})
+		ids = append(ids, msg.Id)
+	}
+	if ids[0] != "2" || ids[1] != "1" {
+		t.Fatalf("expecting the responses dispatched in the order received got: %v", ids)
+	}
+	subs := h.tr.Subscriptions()
+	sort.Strings(subs)
+	if len(subs) != 2 || subs[0] != "/a" || subs[1] != "/b" {
+		t.Fatalf("expecting the subscriptions tracked got: %v", subs)
+	}
+}
+
+func testMalformedFrame(t *testing.T, h *harness) {
+	h.handshake(t)
+	h.connect(t, "connect")
+	h.expect(t, "the connect response", func(msg *message.Message) bool {
+		return msg.Id == "connect"
+	})
+	h.srv.Push([]byte(`[{"channel":"/foo",`))
+	h.srv.Push([]byte(`[{"channel":"/foo","data":"bar"}]`))
+	//the polling transports receive the frames in the responses to the next connects
+	h.connect(t, "connect1")
+	select {
+	case err := <-h.errs:
+		if err == nil {
+			t.Fatal("expecting the decoding error reported")
+		}
+	case <-time.After(timeout):
+		t.Fatal("expecting the malformed frame reported")
+	}
+	h.connect(t, "connect2")
+	msg := h.expect(t, "the delivery following the malformed frame", func(msg *message.Message) bool {
+		return msg.Channel == "/foo"
+	})
+	if msg.Data != "bar" {
+		t.Fatalf("expecting the data bar got: %v", msg.Data)
+	}
+}
+
+func testDisconnect(t *testing.T, h *harness) {
+	h.handshake(t)
+	h.connect(t, "connect")
+	h.expect(t, "the connect response", func(msg *message.Message) bool {
+		return msg.Id == "connect"
+	})
+	if err := h.tr.Disconnect(&message.Message{Channel: message.MetaDisconnect, ClientId: h.tr.ClientID(), Id: "disconnect"}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(timeout)
+	for h.tr.ConnectionState() != transport.StateDisconnected {
+		if time.Now().After(deadline) {
+			t.Fatalf("expecting the transport disconnected got: %v", h.tr.ConnectionState())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for !h.received(message.MetaDisconnect) {
+		if time.Now().After(deadline) {
+			t.Fatal("expecting the server informed of the disconnect")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
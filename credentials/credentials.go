@@ -0,0 +1,29 @@
+//Package credentials provides the tokens authenticating the client, see fayec.WithCredentials and extensions.Auth.
+package credentials
+
+import (
+	"context"
+)
+
+//Provider returns the token authenticating the client. it is called before every handshake, including the ones
+//of the reconnects, so short lived tokens such as JWTs or OAuth access tokens are refreshed rather than fixed
+//when the client is created. it must be safe for concurrent use.
+type Provider interface {
+	Token(ctx context.Context) (string, error)
+}
+
+//Func adapts a function to a Provider
+type Func func(ctx context.Context) (string, error)
+
+//Token implements Provider
+func (f Func) Token(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+//Static is a Provider returning the same token forever
+type Static string
+
+//Token implements Provider
+func (s Static) Token(context.Context) (string, error) {
+	return string(s), nil
+}
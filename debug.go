@@ -0,0 +1,40 @@
+package fayec
+
+import (
+	"encoding/json"
+	"expvar"
+	"github.com/thesyncim/faye/internal/dispatcher"
+	"net/http"
+)
+
+//Snapshot is the state of the client internals at a point in time: the session, the subscriptions, the messages
+//waiting for a response, the queues and the last errors. it is encoded as json by DebugHandler and DebugVar.
+type Snapshot = dispatcher.Snapshot
+
+//ErrorRecord is an error reported to OnError, see Snapshot.
+type ErrorRecord = dispatcher.ErrorRecord
+
+//DebugSnapshot returns the state of the client internals, e.g. to diagnose a stuck subscription in production.
+func (c *Client) DebugSnapshot() Snapshot {
+	return c.dispatcher.DebugSnapshot()
+}
+
+//DebugHandler returns a handler serving the DebugSnapshot as json, e.g. mounted on an internal debug server:
+//
+//	mux.Handle("/debug/fayec", client.DebugHandler())
+func (c *Client) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(c.DebugSnapshot())
+	})
+}
+
+//DebugVar returns an expvar.Var of the DebugSnapshot, served under /debug/vars once published, e.g.
+//expvar.Publish("fayec", client.DebugVar()). expvar.Publish panics if the name is taken.
+func (c *Client) DebugVar() expvar.Var {
+	return expvar.Func(func() interface{} {
+		return c.DebugSnapshot()
+	})
+}
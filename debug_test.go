@@ -0,0 +1,72 @@
+package fayec
+
+import (
+	"encoding/json"
+	"github.com/thesyncim/faye/fayeserver"
+	"github.com/thesyncim/faye/transport/inproc"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClient_DebugSnapshot(t *testing.T) {
+	defer inproc.Listen("client-debug-test", fayeserver.NewServer())()
+
+	client, err := NewClient("inproc://client-debug-test", WithTransportName("inproc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect()
+	if _, err = client.Subscribe("/foo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.PublishAfter("/foo", "later", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	client.DebugHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/fayec", nil))
+	var snapshot map[string]interface{}
+	if err = json.Unmarshal(rec.Body.Bytes(), &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if snapshot["State"] != "connected" || snapshot["Scheduled"] != 1.0 {
+		t.Fatalf("expecting the connected state and the scheduled publish got: %s", rec.Body)
+	}
+	subs, _ := snapshot["Subscriptions"].([]interface{})
+	if len(subs) != 1 || subs[0].(map[string]interface{})["State"] != "active" {
+		t.Fatalf("expecting the active subscription got: %s", rec.Body)
+	}
+	session, _ := snapshot["Session"].(map[string]interface{})
+	if session["ClientID"] != client.ID() || session["ClientID"] == "" {
+		t.Fatalf("expecting the session got: %s", rec.Body)
+	}
+}
+
+func TestClient_DebugSnapshotErrors(t *testing.T) {
+	defer inproc.Listen("client-debug-errors-test", fayeserver.NewServer())()
+
+	client, err := NewClient("inproc://client-debug-errors-test", WithTransportName("inproc"),
+		WithChannelConfig(ChannelConfig{Pattern: "/foo", BufferSize: -1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect()
+	//the subscription queue is unbuffered and has no reader, the delivery is dropped and reported
+	if _, err = client.Subscribe("/foo"); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Publish("/foo", "dropped"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(client.DebugSnapshot().Errors) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expecting the dropped delivery recorded")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if record := client.DebugSnapshot().Errors[0]; record.Channel != "/foo" || record.Time.IsZero() {
+		t.Fatalf("expecting the error of /foo recorded got: %+v", record)
+	}
+}
@@ -0,0 +1,181 @@
+package extensions
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/thesyncim/faye/clock"
+	"github.com/thesyncim/faye/credentials"
+	"github.com/thesyncim/faye/message"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//authExt is the ext field holding the authentication data
+const authExt = "auth"
+
+//ErrInvalidSignature is reported to Auth.OnInvalid for the deliveries whose signature doesn't verify
+var ErrInvalidSignature = errors.New("invalid signature")
+
+//Auth attaches authentication data to ext.auth of the outgoing /meta/handshake and /meta/subscribe messages, and
+//of the publishes if SignPublishes is set: the Token, the Fields and, when Secret is set, an HMAC-SHA256 signature
+//with its timestamp, see Sign. it implements message.Pipe, register it with fayec.WithPipeExtension or
+//fayec.Client.AddExtension.
+//messages with an ext that isn't a map are left untouched.
+type Auth struct {
+	//Token is sent as ext.auth.token when not empty
+	Token string
+	//Credentials, when set, provides the token in place of Token. it is requested on every handshake and the
+	//token sent until the next one, a failure drops the handshake which fails and is retried by the reconnect
+	Credentials credentials.Provider
+	//Fields are added to ext.auth, e.g. the user id expected by the server
+	Fields map[string]interface{}
+	//Secret signs the messages when not empty
+	Secret []byte
+	//SignPublishes signs the publishes too
+	SignPublishes bool
+	//VerifyDeliveries drops the messages delivered without a valid signature, it requires the Secret
+	VerifyDeliveries bool
+	//MaxSkew rejects the deliveries signed longer ago than MaxSkew, zero accepts any timestamp
+	MaxSkew time.Duration
+	//Clock timestamps the signatures, nil uses the system clock
+	Clock clock.Clock
+	//OnInvalid, when set, is called with the deliveries dropped and the reason
+	OnInvalid func(m *message.Message, err error)
+
+	//token is the last token of Credentials
+	mu    sync.Mutex
+	token string
+}
+
+var _ message.Pipe = (*Auth)(nil)
+
+//NewAuth creates an Auth extension sending the token and signing with the secret, either can be empty
+func NewAuth(token string, secret []byte) *Auth {
+	return &Auth{Token: token, Secret: secret}
+}
+
+//Outgoing attaches the authentication data
+func (a *Auth) Outgoing(m *message.Message, next func(m *message.Message)) {
+	if a.authenticates(m) {
+		token, err := a.currentToken(m)
+		if err != nil {
+			next(nil)
+			return
+		}
+		if ext, ok := extMap(m); ok {
+			auth := map[string]interface{}{}
+			for k, v := range a.Fields {
+				auth[k] = v
+			}
+			if token != "" {
+				auth["token"] = token
+			}
+			if len(a.Secret) > 0 {
+				ts := clock.Or(a.Clock).Now().UnixNano() / int64(time.Millisecond)
+				auth["timestamp"] = ts
+				auth["signature"] = Sign(a.Secret, m, ts)
+			}
+			ext[authExt] = auth
+			m.Ext = ext
+		}
+	}
+	next(m)
+}
+
+//Incoming verifies the signature of the deliveries if VerifyDeliveries is set
+func (a *Auth) Incoming(m *message.Message, next func(m *message.Message)) {
+	if a.VerifyDeliveries && message.IsEventDelivery(m) {
+		if err := a.verify(m); err != nil {
+			if a.OnInvalid != nil {
+				a.OnInvalid(m, err)
+			}
+			next(nil)
+			return
+		}
+	}
+	next(m)
+}
+
+//currentToken returns the token sent with m, the Credentials are asked for a new one on handshakes
+func (a *Auth) currentToken(m *message.Message) (string, error) {
+	if a.Credentials == nil {
+		return a.Token, nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if m.Channel == message.MetaHandshake || a.token == "" {
+		token, err := a.Credentials.Token(context.Background())
+		if err != nil {
+			return "", err
+		}
+		a.token = token
+	}
+	return a.token, nil
+}
+
+func (a *Auth) authenticates(m *message.Message) bool {
+	switch m.Channel {
+	case message.MetaHandshake, message.MetaSubscribe:
+		return true
+	}
+	return a.SignPublishes && !message.IsMetaMessage(m)
+}
+
+func (a *Auth) verify(m *message.Message) error {
+	ext, _ := m.Ext.(map[string]interface{})
+	auth, _ := ext[authExt].(map[string]interface{})
+	signature, _ := auth["signature"].(string)
+	ts, ok := timestamp(auth["timestamp"])
+	if signature == "" || !ok {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(Sign(a.Secret, m, ts))) {
+		return ErrInvalidSignature
+	}
+	if a.MaxSkew > 0 {
+		signed := time.Unix(0, ts*int64(time.Millisecond))
+		if skew := clock.Or(a.Clock).Now().Sub(signed); skew > a.MaxSkew || skew < -a.MaxSkew {
+			return ErrInvalidSignature
+		}
+	}
+	return nil
+}
+
+//Sign returns the hex encoded HMAC-SHA256 of the channel, subscription and json encoded data of m followed by
+//the timestamp in milliseconds, each terminated by a newline, for servers to verify the signatures sent by Auth
+func Sign(secret []byte, m *message.Message, timestamp int64) string {
+	data, _ := json.Marshal(m.Data)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(m.Channel + "\n" + m.Subscription + "\n"))
+	mac.Write(data)
+	mac.Write([]byte("\n" + strconv.FormatInt(timestamp, 10) + "\n"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+//extMap returns the ext of m as a map, creating it if empty
+func extMap(m *message.Message) (map[string]interface{}, bool) {
+	if m.Ext == nil {
+		return map[string]interface{}{}, true
+	}
+	ext, ok := m.Ext.(map[string]interface{})
+	return ext, ok
+}
+
+//timestamp reads a timestamp set by Outgoing or decoded from json
+func timestamp(v interface{}) (int64, bool) {
+	switch ts := v.(type) {
+	case int64:
+		return ts, true
+	case float64:
+		return int64(ts), true
+	case json.Number:
+		n, err := ts.Int64()
+		return n, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,148 @@
+package extensions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/thesyncim/faye/clock"
+	"github.com/thesyncim/faye/credentials"
+	"github.com/thesyncim/faye/message"
+	"testing"
+	"time"
+)
+
+//passThrough runs m through the pipe, returning the message passed on, nil if dropped
+func passThrough(out bool, a *Auth, m *message.Message) *message.Message {
+	var passed *message.Message
+	next := func(m *message.Message) { passed = m }
+	if out {
+		a.Outgoing(m, next)
+	} else {
+		a.Incoming(m, next)
+	}
+	return passed
+}
+
+func TestAuth_Outgoing(t *testing.T) {
+	fake := clock.NewFake(time.Unix(10, 0))
+	a := &Auth{Token: "token", Secret: []byte("secret"), Fields: map[string]interface{}{"user": "u1"}, Clock: fake}
+
+	tests := []struct {
+		name   string
+		m      *message.Message
+		signed bool
+	}{
+		{name: "handshake", m: &message.Message{Channel: message.MetaHandshake}, signed: true},
+		{name: "subscribe", m: &message.Message{Channel: message.MetaSubscribe, Subscription: "/foo"}, signed: true},
+		{name: "keeps the ext", m: &message.Message{Channel: message.MetaSubscribe, Ext: map[string]interface{}{"a": 1}}, signed: true},
+		{name: "connect", m: &message.Message{Channel: message.MetaConnect}},
+		{name: "publish", m: &message.Message{Channel: "/foo", Data: "bar"}},
+		{name: "ext not a map", m: &message.Message{Channel: message.MetaHandshake, Ext: "opaque"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := passThrough(true, a, tt.m)
+			ext, _ := m.Ext.(map[string]interface{})
+			auth, ok := ext[authExt].(map[string]interface{})
+			if ok != tt.signed {
+				t.Fatalf("expecting auth data %v got: %v", tt.signed, m.Ext)
+			}
+			if !ok {
+				return
+			}
+			if auth["token"] != "token" || auth["user"] != "u1" || auth["timestamp"] != int64(10000) {
+				t.Fatalf("unexpected auth data: %v", auth)
+			}
+			if auth["signature"] != Sign(a.Secret, m, 10000) {
+				t.Fatalf("unexpected signature: %v", auth["signature"])
+			}
+			if tt.name == "keeps the ext" && ext["a"] != 1 {
+				t.Fatalf("expecting the ext fields kept got: %v", ext)
+			}
+		})
+	}
+}
+
+func TestAuth_Credentials(t *testing.T) {
+	var calls int
+	a := &Auth{Credentials: credentials.Func(func(ctx context.Context) (string, error) {
+		calls++
+		if calls == 3 {
+			return "", errors.New("token endpoint unavailable")
+		}
+		return fmt.Sprintf("token-%d", calls), nil
+	})}
+	tokenOf := func(m *message.Message) interface{} {
+		ext, _ := m.Ext.(map[string]interface{})
+		auth, _ := ext[authExt].(map[string]interface{})
+		return auth["token"]
+	}
+
+	if m := passThrough(true, a, &message.Message{Channel: message.MetaHandshake}); tokenOf(m) != "token-1" {
+		t.Fatalf("expecting the handshake to get a token got: %v", m.Ext)
+	}
+	if m := passThrough(true, a, &message.Message{Channel: message.MetaSubscribe}); tokenOf(m) != "token-1" || calls != 1 {
+		t.Fatalf("expecting the subscribe to reuse the token got: %v", m.Ext)
+	}
+	if m := passThrough(true, a, &message.Message{Channel: message.MetaHandshake}); tokenOf(m) != "token-2" {
+		t.Fatalf("expecting the handshake to refresh the token got: %v", m.Ext)
+	}
+	if m := passThrough(true, a, &message.Message{Channel: message.MetaHandshake}); m != nil {
+		t.Fatalf("expecting the handshake dropped when the token can't be refreshed got: %v", m.Ext)
+	}
+}
+
+func TestAuth_Incoming(t *testing.T) {
+	fake := clock.NewFake(time.Unix(10, 0))
+	publisher := &Auth{Secret: []byte("secret"), SignPublishes: true, Clock: fake}
+	var invalid int
+	subscriber := &Auth{Secret: []byte("secret"), VerifyDeliveries: true, MaxSkew: time.Minute, Clock: fake,
+		OnInvalid: func(m *message.Message, err error) {
+			invalid++
+		}}
+
+	//signs a publish and decodes it as the subscriber receives it
+	delivery := func(data string, tamper func(m *message.Message)) *message.Message {
+		m := passThrough(true, publisher, &message.Message{Channel: "/foo", Data: data})
+		if tamper != nil {
+			tamper(m)
+		}
+		b, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded message.Message
+		if err = json.Unmarshal(b, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		return &decoded
+	}
+
+	tests := []struct {
+		name  string
+		m     *message.Message
+		valid bool
+	}{
+		{name: "signed", m: delivery("bar", nil), valid: true},
+		{name: "tampered", m: delivery("bar", func(m *message.Message) { m.Data = "baz" })},
+		{name: "unsigned", m: &message.Message{Channel: "/foo", Data: "bar"}},
+		{name: "meta", m: &message.Message{Channel: message.MetaConnect, Successful: true}, valid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if passed := passThrough(false, subscriber, tt.m); (passed != nil) != tt.valid {
+				t.Fatalf("expecting valid %v got: %v", tt.valid, passed)
+			}
+		})
+	}
+
+	signed := delivery("bar", nil)
+	fake.Advance(2 * time.Minute)
+	if passThrough(false, subscriber, signed) != nil {
+		t.Fatal("expecting the expired signature rejected")
+	}
+	if invalid != 3 {
+		t.Fatalf("expecting 3 invalid deliveries got: %d", invalid)
+	}
+}
@@ -0,0 +1,229 @@
+//Package crypto encrypts the data of the publishes end to end, so the servers relaying them only see ciphertext:
+//the data is encoded to json, sealed with an AEAD and sent as a base64 string, the key id and the nonce in
+//ext.crypto. the deliveries carrying ext.crypto are opened with the key of their id. the channel is authenticated
+//with the data, a ciphertext replayed on another channel doesn't open. register it with fayec.Client.AddExtension.
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/thesyncim/faye/internal/store"
+	"github.com/thesyncim/faye/message"
+)
+
+//ext is the ext key holding the key id and the nonce of the encrypted messages
+const ext = "crypto"
+
+//ErrUnknownKey is returned by the KeyProvider for the key ids it doesn't know
+var ErrUnknownKey = errors.New("crypto: unknown key")
+
+//ErrNotEncrypted is reported to OnInvalid for the plaintext deliveries dropped, see Crypto.Required
+var ErrNotEncrypted = errors.New("crypto: message not encrypted")
+
+//AEAD creates the cipher sealing the data with the key, e.g. AESGCM or chacha20poly1305.New of
+//golang.org/x/crypto
+type AEAD func(key []byte) (cipher.AEAD, error)
+
+//AESGCM is the AES-GCM AEAD, the key is 16, 24 or 32 bytes long for AES-128, AES-192 or AES-256
+func AESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+//KeyProvider provides the keys, rotating the current one keeps the previous ones available to open the messages
+//still in flight
+type KeyProvider interface {
+	//Current returns the key sealing the publishes and its id
+	Current() (id string, key []byte, err error)
+	//Key returns the key of the id, ErrUnknownKey if there is none
+	Key(id string) ([]byte, error)
+}
+
+//Keys is a KeyProvider of fixed keys indexed by id, CurrentID is the id of the key sealing the publishes
+type Keys struct {
+	CurrentID string
+	Keys      map[string][]byte
+}
+
+var _ KeyProvider = Keys{}
+
+//Current returns the key of CurrentID
+func (k Keys) Current() (string, []byte, error) {
+	key, err := k.Key(k.CurrentID)
+	return k.CurrentID, key, err
+}
+
+//Key returns the key of the id
+func (k Keys) Key(id string) ([]byte, error) {
+	key, ok := k.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, id)
+	}
+	return key, nil
+}
+
+//Crypto seals the data of the publishes and opens the data of the deliveries, it implements message.Pipe
+type Crypto struct {
+	//Keys provides the keys
+	Keys KeyProvider
+	//AEAD creates the ciphers, nil uses AESGCM
+	AEAD AEAD
+	//Channels are the channels or wildcard patterns whose publishes are sealed, e.g. /secure/**, nil seals all
+	Channels []string
+	//Required drops the plaintext deliveries of the Channels
+	Required bool
+	//OnInvalid, when set, is called with the messages dropped and the reason: the publishes that can't be sealed,
+	//the deliveries that don't open or, with Required, aren't sealed
+	OnInvalid func(m *message.Message, err error)
+}
+
+var _ message.Pipe = (*Crypto)(nil)
+
+//New creates a Crypto extension sealing all the publishes with AES-GCM and the keys
+func New(keys KeyProvider) *Crypto {
+	return &Crypto{Keys: keys}
+}
+
+//envelope is the ext of the sealed messages
+type envelope struct {
+	KeyID string `json:"kid"`
+	Nonce []byte `json:"nonce"`
+}
+
+//Outgoing seals the data of the publishes, a publish that can't be sealed is dropped and fails
+func (c *Crypto) Outgoing(m *message.Message, next func(m *message.Message)) {
+	if message.IsMetaMessage(m) || !c.covers(m.Channel) {
+		next(m)
+		return
+	}
+	if err := c.seal(m); err != nil {
+		c.invalid(m, err)
+		next(nil)
+		return
+	}
+	next(m)
+}
+
+//Incoming opens the data of the sealed deliveries, the ones that don't open are dropped
+func (c *Crypto) Incoming(m *message.Message, next func(m *message.Message)) {
+	if !message.IsEventDelivery(m) {
+		next(m)
+		return
+	}
+	var env envelope
+	err := m.GetExt(ext, &env)
+	if errors.Is(err, message.ErrExtNotFound) {
+		if !c.Required || !c.covers(m.Channel) {
+			next(m)
+			return
+		}
+		err = ErrNotEncrypted
+	}
+	var opened *message.Message
+	if err == nil {
+		opened, err = c.open(m, env)
+	}
+	if err != nil {
+		c.invalid(m, err)
+		next(nil)
+		return
+	}
+	next(opened)
+}
+
+//seal replaces the data of m with its sealed json encoding and sets the envelope
+func (c *Crypto) seal(m *message.Message) error {
+	id, key, err := c.Keys.Current()
+	if err != nil {
+		return err
+	}
+	aead, err := c.aead(key)
+	if err != nil {
+		return err
+	}
+	plaintext, err := json.Marshal(m.Data)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := aead.Seal(nil, nonce, plaintext, []byte(m.Channel))
+	m.Data = base64.StdEncoding.EncodeToString(sealed)
+	m.SetExt(ext, envelope{KeyID: id, Nonce: nonce})
+	return nil
+}
+
+//open returns a copy of m with the data opened, the envelope removed, m may be shared and is left untouched
+func (c *Crypto) open(m *message.Message, env envelope) (*message.Message, error) {
+	key, err := c.Keys.Key(env.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := c.aead(key)
+	if err != nil {
+		return nil, err
+	}
+	data, _ := m.Data.(string)
+	sealed, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("crypto: %w", err)
+	}
+	if len(env.Nonce) != aead.NonceSize() {
+		return nil, errors.New("crypto: invalid nonce")
+	}
+	plaintext, err := aead.Open(nil, env.Nonce, sealed, []byte(m.Channel))
+	if err != nil {
+		return nil, fmt.Errorf("crypto: %w", err)
+	}
+	opened := *m
+	opened.Data = nil
+	if err = json.Unmarshal(plaintext, &opened.Data); err != nil {
+		return nil, fmt.Errorf("crypto: %w", err)
+	}
+	opened.Ext = nil
+	if fields, ok := m.Ext.(map[string]interface{}); ok {
+		copied := make(map[string]interface{}, len(fields))
+		for k, v := range fields {
+			copied[k] = v
+		}
+		opened.Ext = copied
+		opened.DeleteExt(ext)
+	}
+	return &opened, nil
+}
+
+func (c *Crypto) aead(key []byte) (cipher.AEAD, error) {
+	if c.AEAD == nil {
+		return AESGCM(key)
+	}
+	return c.AEAD(key)
+}
+
+//covers reports whether the publishes of the channel are sealed
+func (c *Crypto) covers(channel string) bool {
+	if c.Channels == nil {
+		return true
+	}
+	for _, pattern := range c.Channels {
+		if store.Covers(pattern, channel) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Crypto) invalid(m *message.Message, err error) {
+	if c.OnInvalid != nil {
+		c.OnInvalid(m, err)
+	}
+}
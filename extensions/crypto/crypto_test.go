@@ -0,0 +1,147 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/thesyncim/faye/message"
+	"strings"
+	"testing"
+)
+
+//passThrough runs m through the pipe, returning the message passed on, nil if dropped
+func passThrough(out bool, c *Crypto, m *message.Message) *message.Message {
+	var passed *message.Message
+	next := func(m *message.Message) { passed = m }
+	if out {
+		c.Outgoing(m, next)
+	} else {
+		c.Incoming(m, next)
+	}
+	return passed
+}
+
+//relay encodes m and decodes it as a subscriber receives it
+func relay(t *testing.T, m *message.Message) *message.Message {
+	t.Helper()
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded message.Message
+	if err = json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	return &decoded
+}
+
+var testKeys = Keys{CurrentID: "k2", Keys: map[string][]byte{
+	"k1": bytes.Repeat([]byte{1}, 32),
+	"k2": bytes.Repeat([]byte{2}, 32),
+}}
+
+func TestCrypto_RoundTrip(t *testing.T) {
+	c := New(testKeys)
+	data := map[string]interface{}{"card": "4242", "amount": 10.0}
+	sealed := passThrough(true, c, &message.Message{Channel: "/payments", Data: data, Ext: map[string]interface{}{"other": "kept"}})
+	b, _ := json.Marshal(sealed)
+	if strings.Contains(string(b), "4242") {
+		t.Fatalf("expecting the data sealed got: %s", b)
+	}
+	var env envelope
+	if err := sealed.GetExt(ext, &env); err != nil || env.KeyID != "k2" {
+		t.Fatalf("expecting the current key id in the envelope got: %+v, %v", env, err)
+	}
+
+	received := relay(t, sealed)
+	opened := passThrough(false, c, received)
+	if opened == nil {
+		t.Fatal("expecting the delivery opened")
+	}
+	decoded, _ := opened.Data.(map[string]interface{})
+	if decoded["card"] != "4242" || decoded["amount"] != 10.0 {
+		t.Fatalf("expecting the data opened got: %v", opened.Data)
+	}
+	var other string
+	if err := opened.GetExt("other", &other); err != nil || other != "kept" {
+		t.Fatalf("expecting the other ext kept got: %q, %v", other, err)
+	}
+	if err := opened.GetExt(ext, &env); !errors.Is(err, message.ErrExtNotFound) {
+		t.Fatalf("expecting the envelope removed got: %v", err)
+	}
+	if received.Data == opened.Data {
+		t.Fatal("expecting the delivery left untouched")
+	}
+	if passThrough(true, c, &message.Message{Channel: message.MetaSubscribe, Subscription: "/payments"}).Ext != nil {
+		t.Fatal("expecting the meta messages left untouched")
+	}
+}
+
+func TestCrypto_Incoming(t *testing.T) {
+	var invalid []error
+	subscriber := &Crypto{Keys: testKeys, Channels: []string{"/secure/**"}, Required: true,
+		OnInvalid: func(m *message.Message, err error) {
+			invalid = append(invalid, err)
+		}}
+
+	//seals a publish with the key and relays it to the subscriber
+	delivery := func(keyID string, tamper func(m *message.Message)) *message.Message {
+		publisher := New(Keys{CurrentID: keyID, Keys: testKeys.Keys})
+		m := passThrough(true, publisher, &message.Message{Channel: "/secure/foo", Data: "bar"})
+		if tamper != nil {
+			tamper(m)
+		}
+		return relay(t, m)
+	}
+	tests := []struct {
+		name  string
+		m     *message.Message
+		valid bool
+		err   error
+	}{
+		{name: "sealed", m: delivery("k2", nil), valid: true},
+		{name: "previous key", m: delivery("k1", nil), valid: true},
+		{name: "unknown key", m: delivery("k1", func(m *message.Message) {
+			var env envelope
+			m.GetExt(ext, &env)
+			env.KeyID = "k3"
+			m.SetExt(ext, env)
+		}), err: ErrUnknownKey},
+		{name: "other channel", m: delivery("k2", func(m *message.Message) { m.Channel = "/secure/bar" })},
+		{name: "tampered", m: delivery("k2", func(m *message.Message) { m.Data = m.Data.(string)[1:] })},
+		{name: "plaintext", m: &message.Message{Channel: "/secure/foo", Data: "bar"}, err: ErrNotEncrypted},
+		{name: "plaintext not covered", m: &message.Message{Channel: "/public", Data: "bar"}, valid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invalid = nil
+			passed := passThrough(false, subscriber, tt.m)
+			if (passed != nil) != tt.valid {
+				t.Fatalf("expecting valid %v got: %v", tt.valid, passed)
+			}
+			if !tt.valid && len(invalid) != 1 {
+				t.Fatalf("expecting the delivery reported got: %v", invalid)
+			}
+			if tt.err != nil && !errors.Is(invalid[0], tt.err) {
+				t.Fatalf("expecting %v got: %v", tt.err, invalid[0])
+			}
+		})
+	}
+}
+
+func TestCrypto_Outgoing(t *testing.T) {
+	var invalid error
+	c := &Crypto{Keys: Keys{CurrentID: "missing"}, Channels: []string{"/secure/*"},
+		OnInvalid: func(m *message.Message, err error) {
+			invalid = err
+		}}
+	if m := passThrough(true, c, &message.Message{Channel: "/public", Data: "bar"}); m == nil || m.Data != "bar" {
+		t.Fatalf("expecting the channels not covered left untouched got: %v", m)
+	}
+	if m := passThrough(true, c, &message.Message{Channel: "/secure/foo", Data: "bar"}); m != nil {
+		t.Fatalf("expecting the publish dropped got: %v", m)
+	}
+	if !errors.Is(invalid, ErrUnknownKey) {
+		t.Fatalf("expecting ErrUnknownKey got: %v", invalid)
+	}
+}
@@ -0,0 +1,145 @@
+//Package dedup drops the deliveries already received, e.g. redelivered by the server after a reconnect: the
+//last ids seen on every channel are remembered, or the keys extracted from the messages, and a delivery with a
+//known one is dropped silently. register it with fayec.Client.AddExtension.
+package dedup
+
+import (
+	"container/list"
+	"github.com/thesyncim/faye/message"
+	"sync"
+)
+
+//DefaultSize is the number of keys remembered per channel by the extensions created with a size of 0
+const DefaultSize = 1000
+
+//Dedup drops the duplicate deliveries, it implements message.Pipe
+type Dedup struct {
+	size int
+	key  func(m *message.Message) string
+
+	mu         sync.Mutex
+	channels   map[string]*lru
+	suppressed map[string]uint64
+	onDup      []func(m *message.Message)
+}
+
+var _ message.Pipe = (*Dedup)(nil)
+
+//New creates an extension remembering the ids of the last size deliveries of every channel, DefaultSize if 0
+func New(size int) *Dedup {
+	return NewWithKey(size, nil)
+}
+
+//NewWithKey is like New but deduplicates the deliveries by the key returned by key, e.g. an id carried in the
+//data when the server assigns a new message id to the redeliveries. the messages with an empty key are always
+//delivered. a nil key uses the message id.
+func NewWithKey(size int, key func(m *message.Message) string) *Dedup {
+	if size <= 0 {
+		size = DefaultSize
+	}
+	if key == nil {
+		key = func(m *message.Message) string { return m.Id }
+	}
+	return &Dedup{size: size, key: key, channels: map[string]*lru{}, suppressed: map[string]uint64{}}
+}
+
+//OnDuplicate registers a handler called with every duplicate dropped
+func (d *Dedup) OnDuplicate(onDup func(m *message.Message)) {
+	d.mu.Lock()
+	d.onDup = append(d.onDup, onDup)
+	d.mu.Unlock()
+}
+
+//Suppressed returns the number of duplicates dropped on every channel
+func (d *Dedup) Suppressed() map[string]uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	suppressed := make(map[string]uint64, len(d.suppressed))
+	for channel, n := range d.suppressed {
+		suppressed[channel] = n
+	}
+	return suppressed
+}
+
+//Total returns the number of duplicates dropped on all the channels
+func (d *Dedup) Total() uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var total uint64
+	for _, n := range d.suppressed {
+		total += n
+	}
+	return total
+}
+
+//Reset forgets the keys seen on the channel, e.g. once unsubscribed
+func (d *Dedup) Reset(channel string) {
+	d.mu.Lock()
+	delete(d.channels, channel)
+	d.mu.Unlock()
+}
+
+//Outgoing passes the messages sent through
+func (d *Dedup) Outgoing(m *message.Message, next func(m *message.Message)) {
+	next(m)
+}
+
+//Incoming drops the deliveries whose key was seen recently on their channel
+func (d *Dedup) Incoming(m *message.Message, next func(m *message.Message)) {
+	if !message.IsEventDelivery(m) {
+		next(m)
+		return
+	}
+	key := d.key(m)
+	if key == "" {
+		next(m)
+		return
+	}
+	d.mu.Lock()
+	seen := d.channels[m.Channel]
+	if seen == nil {
+		seen = newLRU(d.size)
+		d.channels[m.Channel] = seen
+	}
+	duplicate := seen.add(key)
+	var onDup []func(m *message.Message)
+	if duplicate {
+		d.suppressed[m.Channel]++
+		onDup = d.onDup
+	}
+	d.mu.Unlock()
+	if !duplicate {
+		next(m)
+		return
+	}
+	for i := range onDup {
+		onDup[i](m)
+	}
+	next(nil)
+}
+
+//lru is a bounded set of keys evicting the least recently seen one
+type lru struct {
+	size  int
+	order *list.List
+	keys  map[string]*list.Element
+}
+
+func newLRU(size int) *lru {
+	return &lru{size: size, order: list.New(), keys: map[string]*list.Element{}}
+}
+
+//add reports whether key is in the set, marking it as the most recently seen, adding it otherwise
+func (l *lru) add(key string) bool {
+	if e, ok := l.keys[key]; ok {
+		l.order.MoveToFront(e)
+		return true
+	}
+	l.keys[key] = l.order.PushFront(key)
+	if l.order.Len() > l.size {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.keys, oldest.Value.(string))
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package dedup
+
+import (
+	"github.com/thesyncim/faye/message"
+	"testing"
+)
+
+// passed runs m through the incoming extension, reporting whether it was passed on
+func passed(d *Dedup, m *message.Message) bool {
+	var out *message.Message
+	d.Incoming(m, func(m *message.Message) { out = m })
+	return out != nil
+}
+
+func TestDedup_Incoming(t *testing.T) {
+	d := New(2)
+	var dropped []string
+	d.OnDuplicate(func(m *message.Message) {
+		dropped = append(dropped, m.Id)
+	})
+	tests := []struct {
+		name   string
+		m      *message.Message
+		passed bool
+	}{
+		{name: "first", m: &message.Message{Channel: "/foo", Id: "1", Data: "a"}, passed: true},
+		{name: "duplicate", m: &message.Message{Channel: "/foo", Id: "1", Data: "a"}},
+		{name: "other channel", m: &message.Message{Channel: "/bar", Id: "1", Data: "a"}, passed: true},
+		{name: "second", m: &message.Message{Channel: "/foo", Id: "2", Data: "b"}, passed: true},
+		//1 is the most recently seen, 2 is evicted by 3
+		{name: "recent duplicate", m: &message.Message{Channel: "/foo", Id: "1", Data: "a"}},
+		{name: "third", m: &message.Message{Channel: "/foo", Id: "3", Data: "c"}, passed: true},
+		{name: "evicted", m: &message.Message{Channel: "/foo", Id: "2", Data: "b"}, passed: true},
+		{name: "without id", m: &message.Message{Channel: "/foo", Data: "d"}, passed: true},
+		{name: "without id again", m: &message.Message{Channel: "/foo", Data: "d"}, passed: true},
+		{name: "meta", m: &message.Message{Channel: message.MetaConnect, Id: "1", Successful: true}, passed: true},
+		{name: "meta again", m: &message.Message{Channel: message.MetaConnect, Id: "1", Successful: true}, passed: true},
+	}
+	for _, tt := range tests {
+		if got := passed(d, tt.m); got != tt.passed {
+			t.Fatalf("%s: expecting passed %v got: %v", tt.name, tt.passed, got)
+		}
+	}
+	if len(dropped) != 2 || d.Total() != 2 {
+		t.Fatalf("expecting 2 duplicates dropped got: %v, %d", dropped, d.Total())
+	}
+	if suppressed := d.Suppressed(); suppressed["/foo"] != 2 || suppressed["/bar"] != 0 {
+		t.Fatalf("expecting the duplicates counted per channel got: %v", suppressed)
+	}
+	d.Reset("/foo")
+	if !passed(d, &message.Message{Channel: "/foo", Id: "1", Data: "a"}) {
+		t.Fatal("expecting the keys forgotten by Reset")
+	}
+}
+
+func TestDedup_Key(t *testing.T) {
+	d := NewWithKey(0, func(m *message.Message) string {
+		data, _ := m.Data.(map[string]interface{})
+		key, _ := data["eventId"].(string)
+		return key
+	})
+	if !passed(d, &message.Message{Channel: "/foo", Id: "1", Data: map[string]interface{}{"eventId": "e1"}}) {
+		t.Fatal("expecting the first delivery passed")
+	}
+	//redelivered with a new message id
+	if passed(d, &message.Message{Channel: "/foo", Id: "2", Data: map[string]interface{}{"eventId": "e1"}}) {
+		t.Fatal("expecting the redelivery dropped")
+	}
+}
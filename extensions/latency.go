@@ -0,0 +1,140 @@
+package extensions
+
+import (
+	"github.com/thesyncim/faye/clock"
+	"github.com/thesyncim/faye/message"
+	"sort"
+	"sync"
+	"time"
+)
+
+//DefaultLatencyBuckets are the upper bounds of the round trip histograms used when NewLatency gets none
+var DefaultLatencyBuckets = []time.Duration{
+	time.Millisecond, 2500 * time.Microsecond, 5 * time.Millisecond, 10 * time.Millisecond,
+	25 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond,
+	500 * time.Millisecond, time.Second, 2500 * time.Millisecond, 5 * time.Second,
+}
+
+//maxPendingPublishes bounds the publishes waiting for their ack or echo, the ones beyond it are not measured
+const maxPendingPublishes = 10000
+
+//LatencyStats is the round trip histogram of a channel
+type LatencyStats struct {
+	Count uint64
+	Sum   time.Duration
+	Min   time.Duration
+	Max   time.Duration
+	//Buckets are the upper bounds of the histogram, Counts[i] is the number of round trips up to Buckets[i]
+	//and the last count, one more than the buckets, the number of the slower ones
+	Buckets []time.Duration
+	Counts  []uint64
+}
+
+//Mean returns the mean round trip, 0 if none was measured
+func (s LatencyStats) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Sum / time.Duration(s.Count)
+}
+
+//Latency measures the round trip of the publishes: the outgoing extension timestamps them and the incoming one
+//records the time elapsed when their ack, or their echo if it comes first, is received. register it with
+//fayec.WithExtension(l.InExtension, l.OutExtension).
+type Latency struct {
+	clock   clock.Clock
+	buckets []time.Duration
+
+	mu       sync.Mutex
+	pending  map[string]time.Time
+	channels map[string]*LatencyStats
+	onSample []func(channel string, rtt time.Duration)
+}
+
+//NewLatency creates a latency extension with the histogram buckets, DefaultLatencyBuckets if none.
+//a nil clock uses the system clock.
+func NewLatency(c clock.Clock, buckets ...time.Duration) *Latency {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = append([]time.Duration(nil), buckets...)
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i] < buckets[j] })
+	return &Latency{
+		clock:    clock.Or(c),
+		buckets:  buckets,
+		pending:  map[string]time.Time{},
+		channels: map[string]*LatencyStats{},
+	}
+}
+
+//OnSample registers a handler called with every round trip measured, e.g. to feed a metrics system
+func (l *Latency) OnSample(onSample func(channel string, rtt time.Duration)) {
+	l.mu.Lock()
+	l.onSample = append(l.onSample, onSample)
+	l.mu.Unlock()
+}
+
+//OutExtension timestamps the outgoing publishes
+func (l *Latency) OutExtension(m *message.Message) {
+	if message.IsMetaMessage(m) || m.Id == "" {
+		return
+	}
+	l.mu.Lock()
+	if len(l.pending) < maxPendingPublishes {
+		l.pending[m.Id] = l.clock.Now()
+	}
+	l.mu.Unlock()
+}
+
+//InExtension records the round trip of the publish acknowledged or echoed by m
+func (l *Latency) InExtension(m *message.Message) {
+	if message.IsMetaMessage(m) || m.Id == "" {
+		return
+	}
+	l.mu.Lock()
+	sent, ok := l.pending[m.Id]
+	if !ok {
+		l.mu.Unlock()
+		return
+	}
+	delete(l.pending, m.Id)
+	rtt := l.clock.Now().Sub(sent)
+	l.record(m.Channel, rtt)
+	onSample := l.onSample
+	l.mu.Unlock()
+
+	for i := range onSample {
+		onSample[i](m.Channel, rtt)
+	}
+}
+
+//record adds the round trip to the channel histogram, l.mu must be held
+func (l *Latency) record(channel string, rtt time.Duration) {
+	stats, ok := l.channels[channel]
+	if !ok {
+		stats = &LatencyStats{Buckets: l.buckets, Counts: make([]uint64, len(l.buckets)+1), Min: rtt}
+		l.channels[channel] = stats
+	}
+	stats.Count++
+	stats.Sum += rtt
+	if rtt < stats.Min {
+		stats.Min = rtt
+	}
+	if rtt > stats.Max {
+		stats.Max = rtt
+	}
+	stats.Counts[sort.Search(len(l.buckets), func(i int) bool { return rtt <= l.buckets[i] })]++
+}
+
+//Stats returns a snapshot of the round trip histograms by channel
+func (l *Latency) Stats() map[string]LatencyStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	snapshot := make(map[string]LatencyStats, len(l.channels))
+	for channel, stats := range l.channels {
+		s := *stats
+		s.Counts = append([]uint64(nil), stats.Counts...)
+		snapshot[channel] = s
+	}
+	return snapshot
+}
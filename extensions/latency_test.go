@@ -0,0 +1,51 @@
+package extensions
+
+import (
+	"github.com/thesyncim/faye/clock"
+	"github.com/thesyncim/faye/message"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLatency(t *testing.T) {
+	fake := clock.NewFake(time.Unix(0, 0))
+	l := NewLatency(fake, 10*time.Millisecond, 100*time.Millisecond)
+	var samples []time.Duration
+	l.OnSample(func(channel string, rtt time.Duration) {
+		samples = append(samples, rtt)
+	})
+
+	var tests = []struct {
+		id  string
+		rtt time.Duration
+	}{
+		{id: "1", rtt: 5 * time.Millisecond},
+		{id: "2", rtt: 50 * time.Millisecond},
+		{id: "3", rtt: time.Second},
+	}
+	for _, tt := range tests {
+		l.OutExtension(&message.Message{Channel: "/foo", Id: tt.id, Data: "bar"})
+		fake.Advance(tt.rtt)
+		l.InExtension(&message.Message{Channel: "/foo", Id: tt.id, Successful: true})
+		//the echo of an acknowledged publish is not measured again
+		l.InExtension(&message.Message{Channel: "/foo", Id: tt.id, Data: "bar"})
+	}
+	//meta messages are not measured
+	l.OutExtension(&message.Message{Channel: message.MetaConnect, Id: "4"})
+	l.InExtension(&message.Message{Channel: message.MetaConnect, Id: "4"})
+
+	stats := l.Stats()["/foo"]
+	if stats.Count != 3 || stats.Min != 5*time.Millisecond || stats.Max != time.Second {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if expected := []uint64{1, 1, 1}; !reflect.DeepEqual(stats.Counts, expected) {
+		t.Fatalf("expecting counts %v got: %v", expected, stats.Counts)
+	}
+	if mean := stats.Mean(); mean != 1055*time.Millisecond/3 {
+		t.Fatalf("expecting mean %v got: %v", 1055*time.Millisecond/3, mean)
+	}
+	if len(samples) != 3 || len(l.Stats()) != 1 {
+		t.Fatalf("expecting 3 samples on a single channel got: %v %v", samples, l.Stats())
+	}
+}
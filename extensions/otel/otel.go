@@ -0,0 +1,172 @@
+//Package otel propagates the OpenTelemetry trace context across the faye hop: the outgoing publishes carry the
+//context of the operation in ext.trace, e.g. {"ext":{"trace":{"traceparent":"00-..."}}}, and the deliveries
+//continue the trace of their publisher. it records a span from every publish to its acknowledgement and from
+//every subscribe to the first message delivered on it. register it with
+//fayec.WithContextExtension(t.InExtension, t.OutExtension).
+package otel
+
+import (
+	"context"
+	"github.com/thesyncim/faye/internal/store"
+	"github.com/thesyncim/faye/message"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"sync"
+)
+
+//ext is the ext key carrying the trace context of the publishes
+const ext = "trace"
+
+//instrumentation is the name of the tracer
+const instrumentation = "github.com/thesyncim/faye/extensions/otel"
+
+//maxPending bounds the spans waiting for their acknowledgement or first message, the ones beyond it end right away
+const maxPending = 10000
+
+//Tracing creates the spans of the publishes, the subscribes and the deliveries and propagates their context
+type Tracing struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+
+	mu sync.Mutex
+	//publishes are the publish spans by message id, ended by the acknowledgement
+	publishes map[string]trace.Span
+	//subscribes are the subscribe spans by message id, waiting for the confirmation
+	subscribes map[string]trace.Span
+	//firstMessages are the confirmed subscribe spans by subscription, ended by the first delivery
+	firstMessages map[string]trace.Span
+}
+
+//New creates a Tracing extension with the tracer provider and the propagator, nil uses the global ones
+func New(tp trace.TracerProvider, propagator propagation.TextMapPropagator) *Tracing {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	if propagator == nil {
+		propagator = otel.GetTextMapPropagator()
+	}
+	return &Tracing{
+		tracer:        tp.Tracer(instrumentation),
+		propagator:    propagator,
+		publishes:     map[string]trace.Span{},
+		subscribes:    map[string]trace.Span{},
+		firstMessages: map[string]trace.Span{},
+	}
+}
+
+//OutExtension starts the spans of the publishes and the subscribes, child of the span of ctx, and injects the
+//context of the publishes in their ext
+func (t *Tracing) OutExtension(ctx context.Context, m *message.Message) {
+	switch {
+	case m.Channel == message.MetaSubscribe:
+		_, span := t.tracer.Start(ctx, "subscribe "+m.Subscription, trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.String("faye.channel", m.Subscription)))
+		t.track(t.subscribes, m.Id, span)
+	case !message.IsMetaMessage(m):
+		ctx, span := t.tracer.Start(ctx, "publish "+m.Channel, trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(attribute.String("faye.channel", m.Channel), attribute.String("faye.message_id", m.Id)))
+		carrier := propagation.MapCarrier{}
+		t.propagator.Inject(ctx, carrier)
+		m.SetExt(ext, map[string]string(carrier))
+		t.track(t.publishes, m.Id, span)
+	}
+}
+
+//InExtension ends the spans of the acknowledged publishes and confirmed subscribes, and records the deliveries
+//in the trace of their publisher
+func (t *Tracing) InExtension(ctx context.Context, m *message.Message) {
+	switch {
+	case m.Channel == message.MetaSubscribe:
+		span, ok := t.untrack(t.subscribes, m.Id)
+		if !ok {
+			return
+		}
+		if !m.Successful {
+			end(span, m)
+			return
+		}
+		t.mu.Lock()
+		previous := t.firstMessages[m.Subscription]
+		t.mu.Unlock()
+		if previous != nil {
+			previous.End()
+		}
+		t.track(t.firstMessages, m.Subscription, span)
+	case message.IsEventDelivery(m):
+		t.deliver(ctx, m)
+	case message.IsEventPublish(m):
+		if span, ok := t.untrack(t.publishes, m.Id); ok {
+			end(span, m)
+		}
+	}
+}
+
+//deliver records the delivery span and ends the subscribe spans waiting for it
+func (t *Tracing) deliver(ctx context.Context, m *message.Message) {
+	_, span := t.tracer.Start(Extract(ctx, m, t.propagator), "receive "+m.Channel,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attribute.String("faye.channel", m.Channel), attribute.String("faye.message_id", m.Id)))
+	span.End()
+
+	var first []trace.Span
+	t.mu.Lock()
+	for pattern, span := range t.firstMessages {
+		if store.Covers(pattern, m.Channel) {
+			first = append(first, span)
+			delete(t.firstMessages, pattern)
+		}
+	}
+	t.mu.Unlock()
+	for i := range first {
+		first[i].End()
+	}
+}
+
+//Extract returns a copy of ctx carrying the trace context of the message, e.g. to continue the trace of the
+//publisher in a fayec.Client.SubscribeRaw handler. a nil propagator uses the global one.
+func Extract(ctx context.Context, m *message.Message, propagator propagation.TextMapPropagator) context.Context {
+	if propagator == nil {
+		propagator = otel.GetTextMapPropagator()
+	}
+	var carrier map[string]string
+	if m.GetExt(ext, &carrier) != nil {
+		return ctx
+	}
+	return propagator.Extract(ctx, propagation.MapCarrier(carrier))
+}
+
+//track records a span waiting for its end, it ends right away if too many are waiting
+func (t *Tracing) track(spans map[string]trace.Span, key string, span trace.Span) {
+	t.mu.Lock()
+	if len(spans) >= maxPending {
+		t.mu.Unlock()
+		span.End()
+		return
+	}
+	spans[key] = span
+	t.mu.Unlock()
+}
+
+//untrack removes the span of the key, ok is false if none is waiting
+func (t *Tracing) untrack(spans map[string]trace.Span, key string) (span trace.Span, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	span, ok = spans[key]
+	delete(spans, key)
+	return span, ok
+}
+
+//end ends the span with the outcome of the server response
+func end(span trace.Span, resp *message.Message) {
+	if !resp.Successful {
+		desc := resp.Error
+		if desc == "" {
+			desc = "rejected"
+		}
+		span.SetStatus(codes.Error, desc)
+	}
+	span.End()
+}
@@ -0,0 +1,150 @@
+package otel
+
+import (
+	"context"
+	"crypto/rand"
+	"github.com/thesyncim/faye/message"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+	"go.opentelemetry.io/otel/trace/noop"
+	"sync"
+	"testing"
+)
+
+//recorder is a TracerProvider recording the spans ended
+type recorder struct {
+	embedded.TracerProvider
+
+	mu    sync.Mutex
+	ended []*span
+}
+
+//tracer is the tracer of a recorder
+type tracer struct {
+	embedded.Tracer
+	rec *recorder
+}
+
+//span is a recorded span
+type span struct {
+	noop.Span
+	rec         *recorder
+	name        string
+	spanContext trace.SpanContext
+	parent      trace.SpanContext
+	status      codes.Code
+	description string
+}
+
+func (r *recorder) Tracer(name string, options ...trace.TracerOption) trace.Tracer {
+	return tracer{rec: r}
+}
+
+func (t tracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	parent := trace.SpanContextFromContext(ctx)
+	traceID := parent.TraceID()
+	if !traceID.IsValid() {
+		rand.Read(traceID[:])
+	}
+	var spanID trace.SpanID
+	rand.Read(spanID[:])
+	s := &span{rec: t.rec, name: name, parent: parent, spanContext: trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	})}
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+func (s *span) SpanContext() trace.SpanContext { return s.spanContext }
+
+func (s *span) SetStatus(code codes.Code, description string) {
+	s.status, s.description = code, description
+}
+
+func (s *span) End(options ...trace.SpanEndOption) {
+	s.rec.mu.Lock()
+	s.rec.ended = append(s.rec.ended, s)
+	s.rec.mu.Unlock()
+}
+
+func newTracing() (*Tracing, *recorder) {
+	rec := &recorder{}
+	return New(rec, propagation.TraceContext{}), rec
+}
+
+//ended returns the ended span of the name
+func ended(t *testing.T, rec *recorder, name string) *span {
+	t.Helper()
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	for _, s := range rec.ended {
+		if s.name == name {
+			return s
+		}
+	}
+	t.Fatalf("expecting the span %s ended", name)
+	return nil
+}
+
+func TestTracing_Publish(t *testing.T) {
+	tracing, rec := newTracing()
+	ctx, parent := rec.Tracer("test").Start(context.Background(), "parent")
+
+	m := &message.Message{Channel: "/foo", Data: "bar", Id: "1"}
+	tracing.OutExtension(ctx, m)
+	var carrier map[string]string
+	if err := m.GetExt("trace", &carrier); err != nil || carrier["traceparent"] == "" {
+		t.Fatalf("expecting the trace context injected got: %v", m.Ext)
+	}
+	if len(rec.ended) != 0 {
+		t.Fatal("expecting the publish span ended by the acknowledgement")
+	}
+	tracing.InExtension(context.Background(), &message.Message{Channel: "/foo", Id: "1", Successful: true})
+	publish := ended(t, rec, "publish /foo")
+	if publish.parent.SpanID() != parent.SpanContext().SpanID() || publish.status == codes.Error {
+		t.Fatalf("expecting the publish span child of the operation got: %v", publish.parent)
+	}
+
+	//the subscriber continues the trace of the publisher
+	tracing.InExtension(context.Background(), &message.Message{Channel: "/foo", Data: "bar", Id: "1", Ext: m.Ext})
+	receive := ended(t, rec, "receive /foo")
+	if receive.parent.SpanID() != publish.spanContext.SpanID() || receive.spanContext.TraceID() != parent.SpanContext().TraceID() {
+		t.Fatalf("expecting the delivery span child of the publish got: %v", receive.parent)
+	}
+	if got := Extract(context.Background(), m, propagation.TraceContext{}); trace.SpanContextFromContext(got).SpanID() != publish.spanContext.SpanID() {
+		t.Fatal("expecting the trace context extracted from the message")
+	}
+}
+
+func TestTracing_PublishRejected(t *testing.T) {
+	tracing, rec := newTracing()
+	tracing.OutExtension(context.Background(), &message.Message{Channel: "/foo", Data: "bar", Id: "1"})
+	tracing.InExtension(context.Background(), &message.Message{Channel: "/foo", Id: "1", Error: "403::forbidden"})
+	if span := ended(t, rec, "publish /foo"); span.status != codes.Error || span.description != "403::forbidden" {
+		t.Fatalf("expecting the rejection recorded got: %v", span.status)
+	}
+}
+
+func TestTracing_SubscribeFirstMessage(t *testing.T) {
+	tracing, rec := newTracing()
+	tracing.OutExtension(context.Background(), &message.Message{Channel: message.MetaSubscribe, Subscription: "/foo/*", Id: "1"})
+	tracing.InExtension(context.Background(), &message.Message{Channel: message.MetaSubscribe, Subscription: "/foo/*", Id: "1", Successful: true})
+	tracing.InExtension(context.Background(), &message.Message{Channel: "/bar", Data: "baz"})
+	for _, span := range rec.ended {
+		if span.name == "subscribe /foo/*" {
+			t.Fatal("expecting the subscribe span waiting for a message of the subscription")
+		}
+	}
+	tracing.InExtension(context.Background(), &message.Message{Channel: "/foo/bar", Data: "baz"})
+	ended(t, rec, "subscribe /foo/*")
+
+	//a rejected subscribe ends right away
+	tracing.OutExtension(context.Background(), &message.Message{Channel: message.MetaSubscribe, Subscription: "/secret", Id: "2"})
+	tracing.InExtension(context.Background(), &message.Message{Channel: message.MetaSubscribe, Subscription: "/secret", Id: "2", Error: "403::forbidden"})
+	if span := ended(t, rec, "subscribe /secret"); span.status != codes.Error {
+		t.Fatalf("expecting the rejection recorded got: %v", span.status)
+	}
+}
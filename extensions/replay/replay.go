@@ -0,0 +1,117 @@
+//Package replay implements the replay extension of the Salesforce Streaming API and of the other CometD servers
+//retaining the events: every event carries a replayId in data.event.replayId, the subscribes ask the server to
+//redeliver the events following the last one received, so none is lost across reconnects. register it with
+//fayec.WithExtension(r.InExtension, r.OutExtension).
+package replay
+
+import (
+	"encoding/json"
+	"github.com/thesyncim/faye/message"
+	"strconv"
+	"sync"
+)
+
+//ext is the ext key of the handshakes and subscribes
+const ext = "replay"
+
+const (
+	//Newest subscribes to the events published from now on
+	Newest int64 = -1
+	//All subscribes to all the events retained by the server
+	All int64 = -2
+)
+
+//Replay tracks the last replayId received on each channel and stamps it on the subscribes
+type Replay struct {
+	mu sync.Mutex
+	//from is sent for the channels without an id
+	from      int64
+	ids       map[string]int64
+	supported bool
+}
+
+//New creates a replay extension subscribing the channels without history from from, Newest or All
+func New(from int64) *Replay {
+	return &Replay{from: from, ids: map[string]int64{}}
+}
+
+//Set sets the replayId the channel is subscribed from, e.g. the last id stored by a previous run
+func (r *Replay) Set(channel string, replayID int64) {
+	r.mu.Lock()
+	r.ids[channel] = replayID
+	r.mu.Unlock()
+}
+
+//LastID returns the replayId of the last event received on the channel, ok is false if none was received
+//or set
+func (r *Replay) LastID(channel string) (replayID int64, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	replayID, ok = r.ids[channel]
+	return replayID, ok
+}
+
+//Supported reports whether the server confirmed the replay support in its handshake response
+func (r *Replay) Supported() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.supported
+}
+
+//OutExtension advertises the replay support in the handshakes, and stamps the subscribes with the replayId
+//to redeliver the events from
+func (r *Replay) OutExtension(m *message.Message) {
+	switch m.Channel {
+	case message.MetaHandshake:
+		m.SetExt(ext, true)
+	case message.MetaSubscribe:
+		r.mu.Lock()
+		replayID, ok := r.ids[m.Subscription]
+		if !ok {
+			replayID = r.from
+		}
+		r.mu.Unlock()
+		m.SetExt(ext, map[string]int64{m.Subscription: replayID})
+	}
+}
+
+//InExtension records the replay support of the server and the replayId of the events received
+func (r *Replay) InExtension(m *message.Message) {
+	if m.Channel == message.MetaHandshake {
+		fields, _ := m.Ext.(map[string]interface{})
+		supported, _ := fields[ext].(bool)
+		r.mu.Lock()
+		r.supported = supported
+		r.mu.Unlock()
+		return
+	}
+	if !message.IsEventDelivery(m) {
+		return
+	}
+	if replayID, ok := eventReplayID(m.Data); ok {
+		r.Set(m.Channel, replayID)
+	}
+}
+
+//eventReplayID returns data.event.replayId, the number type depends on the parsing options of the client
+func eventReplayID(data message.Data) (int64, bool) {
+	if raw, ok := data.(json.RawMessage); ok {
+		var decoded interface{}
+		if err := json.Unmarshal(raw, &decoded); err != nil {
+			return 0, false
+		}
+		data = decoded
+	}
+	fields, _ := data.(map[string]interface{})
+	event, _ := fields["event"].(map[string]interface{})
+	switch id := event["replayId"].(type) {
+	case float64:
+		return int64(id), true
+	case int64:
+		return id, true
+	case json.Number:
+		replayID, err := strconv.ParseInt(string(id), 10, 64)
+		return replayID, err == nil
+	}
+	return 0, false
+}
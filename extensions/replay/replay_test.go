@@ -0,0 +1,54 @@
+package replay
+
+import (
+	"encoding/json"
+	"github.com/thesyncim/faye/message"
+	"reflect"
+	"testing"
+)
+
+func TestReplay_Handshake(t *testing.T) {
+	r := New(Newest)
+	hs := &message.Message{Channel: message.MetaHandshake}
+	r.OutExtension(hs)
+	if !reflect.DeepEqual(hs.Ext, map[string]interface{}{"replay": true}) {
+		t.Fatalf("expecting the replay support advertised got: %v", hs.Ext)
+	}
+	r.InExtension(&message.Message{Channel: message.MetaHandshake, Ext: map[string]interface{}{"replay": true}})
+	if !r.Supported() {
+		t.Fatal("expecting the server replay support recorded")
+	}
+}
+
+func TestReplay_Subscribe(t *testing.T) {
+	r := New(All)
+	r.Set("/topic/stored", 7)
+	var tests = []struct {
+		delivery *message.Message
+		channel  string
+		expected int64
+	}{
+		//no event received yet
+		{nil, "/topic/foo", All},
+		{nil, "/topic/stored", 7},
+		{&message.Message{Channel: "/topic/foo", Data: map[string]interface{}{"event": map[string]interface{}{"replayId": float64(12)}}}, "/topic/foo", 12},
+		{&message.Message{Channel: "/topic/foo", Data: map[string]interface{}{"event": map[string]interface{}{"replayId": json.Number("13")}}}, "/topic/foo", 13},
+		{&message.Message{Channel: "/topic/foo", Data: json.RawMessage(`{"event":{"replayId":14}}`)}, "/topic/foo", 14},
+		//the events without replayId are ignored
+		{&message.Message{Channel: "/topic/foo", Data: map[string]interface{}{"payload": "bar"}}, "/topic/foo", 14},
+	}
+	for _, tt := range tests {
+		if tt.delivery != nil {
+			r.InExtension(tt.delivery)
+		}
+		sub := &message.Message{Channel: message.MetaSubscribe, Subscription: tt.channel, Ext: map[string]interface{}{"auth": "token"}}
+		r.OutExtension(sub)
+		expected := map[string]interface{}{"auth": "token", "replay": map[string]int64{tt.channel: tt.expected}}
+		if !reflect.DeepEqual(sub.Ext, expected) {
+			t.Fatalf("expecting %v got: %v", expected, sub.Ext)
+		}
+	}
+	if id, ok := r.LastID("/topic/foo"); !ok || id != 14 {
+		t.Fatalf("expecting the last replayId 14 got: %d %v", id, ok)
+	}
+}
@@ -0,0 +1,143 @@
+package fayeserver
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/thesyncim/faye/message"
+	"net/http"
+	"sort"
+	"time"
+)
+
+//ErrUnknownClient is returned by Disconnect for a clientId the server has no session for
+var ErrUnknownClient = errors.New("unknown client")
+
+//SessionInfo is a snapshot of a session, see Sessions
+type SessionInfo struct {
+	ClientID string
+	//Channels are the channels and patterns subscribed, sorted
+	Channels []string
+	//Queued is the number of deliveries waiting for the client to connect
+	Queued  int
+	Created time.Time
+	//LastSeen is the last time the client sent a message
+	LastSeen time.Time
+}
+
+//Sessions returns a snapshot of the sessions, oldest first
+func (s *Server) Sessions() []SessionInfo {
+	s.mu.Lock()
+	infos := make([]SessionInfo, 0, len(s.sessions))
+	sessions := make([]*session, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		info := SessionInfo{ClientID: sess.id, Created: sess.created, Channels: make([]string, 0, len(sess.channels))}
+		for name := range sess.channels {
+			info.Channels = append(info.Channels, name)
+		}
+		sort.Strings(info.Channels)
+		infos = append(infos, info)
+		sessions = append(sessions, sess)
+	}
+	s.mu.Unlock()
+	for i, sess := range sessions {
+		sess.mu.Lock()
+		infos[i].Queued = len(sess.queue)
+		infos[i].LastSeen = sess.seen
+		sess.mu.Unlock()
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if !infos[i].Created.Equal(infos[j].Created) {
+			return infos[i].Created.Before(infos[j].Created)
+		}
+		return infos[i].ClientID < infos[j].ClientID
+	})
+	return infos
+}
+
+//Subscriptions maps the channels and patterns subscribed to the clientIds of the sessions subscribed, sorted
+func (s *Server) Subscriptions() map[string][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subscriptions := make(map[string][]string, len(s.subscriptions))
+	for name, sessions := range s.subscriptions {
+		ids := make([]string, 0, len(sessions))
+		for sess := range sessions {
+			ids = append(ids, sess.id)
+		}
+		sort.Strings(ids)
+		subscriptions[name] = ids
+	}
+	return subscriptions
+}
+
+//Disconnect removes the session of the client, the connect it holds is answered with the reconnect none advice
+//so it doesn't handshake again. it returns ErrUnknownClient if there is no such session.
+func (s *Server) Disconnect(clientID string) error {
+	s.mu.Lock()
+	sess, ok := s.sessions[clientID]
+	s.mu.Unlock()
+	if !ok {
+		return ErrUnknownClient
+	}
+	s.removeSession(sess, &message.Advise{Reconnect: message.ReconnectNone})
+	return nil
+}
+
+//AdminHandler serves the admin operations as JSON to the requests authorize accepts, the others are answered
+//401 Unauthorized. authorize is required, e.g. checking a bearer token:
+//
+//	mux.Handle("/admin/", http.StripPrefix("/admin", server.AdminHandler(authorize)))
+//
+//	GET  /sessions                  Sessions
+//	GET  /subscriptions             Subscriptions
+//	POST /disconnect?clientId=id    Disconnect
+//	POST /shutdown?interval=5s      Shutdown, advising the clients to handshake again after the interval
+func (s *Server) AdminHandler(authorize func(r *http.Request) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authorize == nil || !authorize(r) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		method := http.MethodPost
+		switch r.URL.Path {
+		case "/sessions", "/subscriptions":
+			method = http.MethodGet
+		case "/disconnect", "/shutdown":
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != method {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var result interface{}
+		switch r.URL.Path {
+		case "/sessions":
+			result = s.Sessions()
+		case "/subscriptions":
+			result = s.Subscriptions()
+		case "/disconnect":
+			if err := s.Disconnect(r.URL.Query().Get("clientId")); err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case "/shutdown":
+			var interval time.Duration
+			if v := r.URL.Query().Get("interval"); v != "" {
+				var err error
+				if interval, err = time.ParseDuration(v); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+			s.Shutdown(&message.Advise{Reconnect: message.ReconnectHandshake, Interval: interval})
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
+}
@@ -0,0 +1,105 @@
+package fayeserver
+
+import (
+	"encoding/json"
+	"errors"
+	fayec "github.com/thesyncim/faye"
+	"github.com/thesyncim/faye/message"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestServer_Admin(t *testing.T) {
+	server := NewServer()
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+	defer server.Close()
+	admin := httptest.NewServer(server.AdminHandler(func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Bearer admin"
+	}))
+	defer admin.Close()
+	request := func(method, path string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, admin.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer admin")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	client, err := fayec.NewClient(srv.URL, fayec.WithTransportName("long-polling"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect()
+	if _, err = client.Subscribe("/foo"); err != nil {
+		t.Fatal(err)
+	}
+	sessions := server.Sessions()
+	if len(sessions) != 1 || sessions[0].ClientID != client.ID() || !reflect.DeepEqual(sessions[0].Channels, []string{"/foo"}) {
+		t.Fatalf("expecting the session of the client got: %+v", sessions)
+	}
+	if subscriptions := server.Subscriptions(); !reflect.DeepEqual(subscriptions, map[string][]string{"/foo": {client.ID()}}) {
+		t.Fatalf("expecting the subscription of the client got: %v", subscriptions)
+	}
+
+	unauthorized, err := http.Get(admin.URL + "/sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unauthorized.Body.Close()
+	if unauthorized.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expecting the request unauthorized got: %d", unauthorized.StatusCode)
+	}
+	resp := request(http.MethodGet, "/sessions")
+	var listed []SessionInfo
+	err = json.NewDecoder(resp.Body).Decode(&listed)
+	resp.Body.Close()
+	if err != nil || len(listed) != 1 || listed[0].ClientID != client.ID() {
+		t.Fatalf("expecting the session listed got: %+v %v", listed, err)
+	}
+
+	//the client is told not to handshake again
+	resp = request(http.MethodPost, "/disconnect?clientId="+client.ID())
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expecting the client disconnected got: %d", resp.StatusCode)
+	}
+	select {
+	case err = <-client.Err():
+		if !errors.Is(err, fayec.ErrReconnectNone) {
+			t.Fatalf("expecting %v got: %v", fayec.ErrReconnectNone, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expecting the client disconnected by the server")
+	}
+	if err = server.Disconnect(client.ID()); err != ErrUnknownClient {
+		t.Fatalf("expecting %v got: %v", ErrUnknownClient, err)
+	}
+
+	resp = request(http.MethodPost, "/shutdown?interval=1s")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent || handshake(server).Error != errClosed {
+		t.Fatalf("expecting the server shut down got: %d", resp.StatusCode)
+	}
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	server := NewServer()
+	resp := handshake(server)
+	sess, _ := server.session(resp.ClientId)
+	held := &message.Message{Channel: message.MetaConnect, ClientId: resp.ClientId, Successful: true}
+
+	advice := &message.Advise{Reconnect: message.ReconnectHandshake, Interval: time.Second}
+	if err := server.Shutdown(advice); err != nil {
+		t.Fatal(err)
+	}
+	if answered := sess.answer(held); answered.Advice != advice || held.Advice != nil {
+		t.Fatalf("expecting the connect held answered with the shutdown advice got: %+v", answered)
+	}
+}
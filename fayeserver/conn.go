@@ -0,0 +1,65 @@
+package fayeserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/thesyncim/faye/message"
+)
+
+//ErrConnClosed is returned by the Conn methods once it is closed
+var ErrConnClosed = errors.New("connection closed")
+
+//Conn is an in process connection to the server exchanging json encoded batches of messages like a websocket,
+//see transport/inproc
+type Conn struct {
+	server   *Server
+	c        *conn
+	received chan []byte
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+//Dial opens an in process connection to the server
+func (s *Server) Dial() *Conn {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Conn{server: s, received: make(chan []byte, 64), ctx: ctx, cancel: cancel}
+	c.c = &conn{send: func(msgs []*message.Message) error {
+		b, err := json.Marshal(msgs)
+		if err != nil {
+			return err
+		}
+		select {
+		case c.received <- b:
+			return nil
+		case <-ctx.Done():
+			return ErrConnClosed
+		}
+	}}
+	return c
+}
+
+//Write sends a batch of messages to the server, the responses are read with Read
+func (c *Conn) Write(b []byte) error {
+	if c.ctx.Err() != nil {
+		return ErrConnClosed
+	}
+	c.server.receive(c.ctx, c.c, b)
+	return nil
+}
+
+//Read waits for the next batch of messages sent by the server
+func (c *Conn) Read() ([]byte, error) {
+	select {
+	case b := <-c.received:
+		return b, nil
+	case <-c.ctx.Done():
+		return nil, ErrConnClosed
+	}
+}
+
+//Close closes the connection, a blocked Read returns ErrConnClosed
+func (c *Conn) Close() error {
+	c.cancel()
+	return nil
+}
@@ -0,0 +1,57 @@
+package fayeserver
+
+import (
+	"github.com/thesyncim/faye/clock"
+	"github.com/thesyncim/faye/internal/store"
+	"github.com/thesyncim/faye/message"
+	"time"
+)
+
+//Retention is the policy of the deliveries queued for the clients between their connects on the channels
+//matching Pattern, see WithRetention
+type Retention struct {
+	//Pattern is a channel name or a pattern such as /foo/* or /foo/**
+	Pattern string
+	//MaxQueued bounds the deliveries of the policy queued per client, the oldest one is dropped for the new one.
+	//0 leaves them bounded by the queue size only, see WithQueueSize
+	MaxQueued int
+	//MaxAge drops the deliveries queued for longer, 0 keeps them until they are sent
+	MaxAge time.Duration
+	//Ephemeral deliveries are only queued for the clients connected, the others miss them instead of getting
+	//them on their next connect
+	Ephemeral bool
+}
+
+//WithRetention sets the policies of the deliveries queued for the clients, the first one whose pattern matches
+//the channel applies. the deliveries dropped by a policy are reported to WithOnDrop.
+func WithRetention(policies ...Retention) Option {
+	return func(o *options) {
+		o.retention = append(o.retention, policies...)
+	}
+}
+
+//retention returns the policy of the deliveries on channel, nil if none matches
+func (s *Server) retention(channel string) *Retention {
+	for i := range s.opts.retention {
+		if store.Covers(s.opts.retention[i].Pattern, channel) {
+			return &s.opts.retention[i]
+		}
+	}
+	return nil
+}
+
+//drain returns the deliveries queued for sess, reporting the ones expired
+func (s *Server) drain(sess *session) []*message.Message {
+	queue, expired := sess.drain(clock.Or(s.opts.clock).Now())
+	s.dropped(sess, expired)
+	return queue
+}
+
+func (s *Server) dropped(sess *session, msgs []*message.Message) {
+	if s.opts.onDrop == nil {
+		return
+	}
+	for _, m := range msgs {
+		s.opts.onDrop(sess.id, m)
+	}
+}
@@ -0,0 +1,433 @@
+//Package fayeserver implements the server half of the Bayeux protocol over the websocket and long-polling
+//transports, so a faye stack can run in process, e.g. in the tests of the applications using fayec.
+package fayeserver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/gorilla/websocket"
+	"github.com/thesyncim/faye/channel"
+	"github.com/thesyncim/faye/clock"
+	"github.com/thesyncim/faye/internal/store"
+	"github.com/thesyncim/faye/message"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//the errors sent to the clients, in the code::description format of the Bayeux spec
+const (
+	errUnknownClient  = "401::unknown client"
+	errInvalidChannel = "405::invalid channel"
+	errUnknownMeta    = "404::unknown meta channel"
+	errClosed         = "503::server closed"
+	//errDenied prefixes the errors of the authenticator
+	errDenied = "403::"
+)
+
+//ErrServerClosed is returned by Publish once the server is closed, the handshakes are rejected too
+var ErrServerClosed = errors.New("server closed")
+
+const (
+	defaultTimeout        = 30 * time.Second
+	defaultSessionTimeout = time.Minute
+	defaultQueueSize      = 1000
+)
+
+//Server serves the websocket and long-polling transports on the same endpoint,
+//e.g. http.Handle("/faye", fayeserver.NewServer())
+type Server struct {
+	opts     options
+	upgrader websocket.Upgrader
+	//pipeline runs the extensions on the messages received and sent, see AddExtension
+	pipeline message.Pipeline
+
+	mu       sync.Mutex
+	closed   bool
+	sessions map[string]*session
+	//subscriptions maps the channels and patterns subscribed to the sessions subscribed
+	subscriptions map[string]map[*session]bool
+}
+
+type options struct {
+	timeout        time.Duration
+	interval       time.Duration
+	sessionTimeout time.Duration
+	checkOrigin    func(r *http.Request) bool
+	clock          clock.Clock
+	authenticate   func(r *http.Request, m *message.Message) error
+	queueSize      int
+	onDrop         func(clientID string, m *message.Message)
+	retention      []Retention
+}
+
+//Option configures a Server
+type Option func(*options)
+
+//WithTimeout sets how long the /meta/connect messages are held when there is nothing to deliver, 30s by default.
+//it is advised to the clients along with the interval.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+//WithInterval sets the interval advised to the clients between a connect response and the next connect
+func WithInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.interval = interval
+	}
+}
+
+//WithSessionTimeout sets how long a client can go without connecting before its session and
+//subscriptions are removed, one minute by default
+func WithSessionTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.sessionTimeout = timeout
+	}
+}
+
+//WithCheckOrigin sets the function validating the Origin header of the websocket upgrades,
+//the same origin policy of gorilla/websocket is used by default
+func WithCheckOrigin(checkOrigin func(r *http.Request) bool) Option {
+	return func(o *options) {
+		o.checkOrigin = checkOrigin
+	}
+}
+
+//WithAuthenticator sets the function authenticating the handshakes, with the HTTP request carrying them: the
+//websocket upgrade or the long-polling post, nil for the in process connections. a handshake it returns an
+//error for is rejected with the error, e.g. 403::invalid token, and the client isn't given a session.
+func WithAuthenticator(authenticate func(r *http.Request, m *message.Message) error) Option {
+	return func(o *options) {
+		o.authenticate = authenticate
+	}
+}
+
+//WithQueueSize sets how many deliveries a session queues while its client isn't connected, 1000 by default.
+//once it is full the oldest delivery is dropped for the new one, see WithOnDrop. 0 leaves the queues unbounded.
+//WithRetention sets the policies of particular channels.
+func WithQueueSize(size int) Option {
+	return func(o *options) {
+		o.queueSize = size
+	}
+}
+
+//WithOnDrop sets the function called with the deliveries dropped from the full queue of a client, see WithQueueSize
+//and WithRetention
+func WithOnDrop(onDrop func(clientID string, m *message.Message)) Option {
+	return func(o *options) {
+		o.onDrop = onDrop
+	}
+}
+
+//WithClock makes the server timers use c, e.g. a clock.Fake in the tests
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+//NewServer creates a server with the provided options
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		opts: options{
+			timeout:        defaultTimeout,
+			sessionTimeout: defaultSessionTimeout,
+			queueSize:      defaultQueueSize,
+		},
+		sessions:      map[string]*session{},
+		subscriptions: map[string]map[*session]bool{},
+	}
+	for _, opt := range opts {
+		opt(&s.opts)
+	}
+	s.upgrader.CheckOrigin = s.opts.checkOrigin
+	return s
+}
+
+//AddExtension appends an extension running on every message received, before it is processed, and on every
+//message sent, responses and deliveries. dropping an incoming message leaves it unanswered.
+func (s *Server) AddExtension(ext message.Pipe) {
+	s.pipeline.Add(ext)
+}
+
+//RemoveExtension removes an extension added with AddExtension, it returns false if it wasn't added
+func (s *Server) RemoveExtension(ext message.Pipe) bool {
+	return s.pipeline.Remove(ext)
+}
+
+//Handler creates a server serving the websocket and long-polling transports on the path it is mounted on,
+//e.g. mux.Handle("/faye", fayeserver.Handler(fayeserver.WithAuthenticator(auth))), for the applications that
+//only relay the messages of their clients. use NewServer to publish from the process too.
+func Handler(opts ...Option) http.Handler {
+	return NewServer(opts...)
+}
+
+//ServeHTTP upgrades the websocket requests and answers the long-polling ones
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		s.serveWebsocket(w, r)
+		return
+	}
+	s.servePolling(w, r)
+}
+
+//Publish delivers data to the clients subscribed to the channel
+func (s *Server) Publish(name string, data message.Data) error {
+	if err := channel.ValidatePublish(name); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return ErrServerClosed
+	}
+	s.route(&message.Message{Channel: name, Data: data})
+	return nil
+}
+
+//Clients returns the number of sessions
+func (s *Server) Clients() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+//Close removes all the sessions, their connections are closed and the connects held answered
+func (s *Server) Close() error {
+	return s.Shutdown(nil)
+}
+
+//Shutdown is like Close but the connects held are answered with advice when it is not nil, e.g. so the clients
+//handshake again with another instance: &message.Advise{Reconnect: message.ReconnectHandshake, Interval: time.Second}
+func (s *Server) Shutdown(advice *message.Advise) error {
+	s.mu.Lock()
+	s.closed = true
+	sessions := make([]*session, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+	s.mu.Unlock()
+	for i := range sessions {
+		s.removeSession(sessions[i], advice)
+	}
+	return nil
+}
+
+//handle processes a message received, reply is called with the response unless an extension drops it.
+//the transports hold the successful /meta/connect responses, see session.hold
+func (s *Server) handle(ctx context.Context, m *message.Message, reply func(resp *message.Message)) {
+	m, err := message.Await(ctx, m, s.pipeline.Incoming)
+	if err != nil {
+		return
+	}
+	resp := &message.Message{Channel: m.Channel, Id: m.Id, ClientId: m.ClientId, Subscription: m.Subscription}
+	//an extension rejects a message by setting its error
+	if m.Error != "" {
+		resp.Error = m.Error
+		s.send(resp, reply)
+		return
+	}
+	switch m.Channel {
+	case message.MetaHandshake:
+		if err = s.authenticate(ctx, m); err != nil {
+			resp.Error = errDenied + err.Error()
+			break
+		}
+		sess, ok := s.newSession()
+		if !ok {
+			resp.Error = errClosed
+			resp.Advice = &message.Advise{Reconnect: message.ReconnectNone}
+			break
+		}
+		resp.Version = "1.0"
+		resp.MinimumVersion = "1.0"
+		resp.SupportedConnectionTypes = []string{"websocket", "long-polling", "inproc"}
+		resp.ClientId = sess.id
+		resp.Successful = true
+		resp.Advice = s.advice()
+	case message.MetaConnect:
+		if _, ok := s.session(m.ClientId); !ok {
+			s.unknownClient(resp)
+			break
+		}
+		//the transport holds the response, see session.hold
+		resp.Successful = true
+		resp.Advice = s.advice()
+	case message.MetaSubscribe, message.MetaUnsubscribe:
+		sess, ok := s.session(m.ClientId)
+		if !ok {
+			s.unknownClient(resp)
+			break
+		}
+		if err = channel.ValidateSubscribe(m.Subscription); err != nil {
+			resp.Error = errInvalidChannel
+			break
+		}
+		if m.Channel == message.MetaSubscribe {
+			s.subscribe(sess, m.Subscription)
+		} else {
+			s.unsubscribe(sess, m.Subscription)
+		}
+		resp.Successful = true
+	case message.MetaDisconnect:
+		sess, ok := s.session(m.ClientId)
+		if !ok {
+			s.unknownClient(resp)
+			break
+		}
+		s.removeSession(sess, nil)
+		resp.Successful = true
+	default:
+		if channel.Channel(m.Channel).IsMeta() {
+			resp.Error = errUnknownMeta
+			break
+		}
+		if _, ok := s.session(m.ClientId); !ok {
+			s.unknownClient(resp)
+			break
+		}
+		if err = channel.ValidatePublish(m.Channel); err != nil {
+			resp.Error = errInvalidChannel
+			break
+		}
+		if !channel.Channel(m.Channel).IsService() {
+			s.route(&message.Message{Channel: m.Channel, Data: m.Data, Id: m.Id, Ext: m.Ext})
+		}
+		resp.Successful = true
+	}
+	s.send(resp, reply)
+}
+
+//authenticate runs the authenticator on a handshake, with the HTTP request of ctx, see withRequest
+func (s *Server) authenticate(ctx context.Context, m *message.Message) error {
+	if s.opts.authenticate == nil {
+		return nil
+	}
+	r, _ := ctx.Value(requestKey{}).(*http.Request)
+	return s.opts.authenticate(r, m)
+}
+
+//send runs the outgoing extensions on m and passes it to reply unless it is dropped
+func (s *Server) send(m *message.Message, reply func(resp *message.Message)) {
+	if m, err := message.Await(context.Background(), m, s.pipeline.Outgoing); err == nil {
+		reply(m)
+	}
+}
+
+//unknownClient fails resp for a clientId the server doesn't know, the client must handshake again
+func (s *Server) unknownClient(resp *message.Message) {
+	resp.Error = errUnknownClient
+	resp.Advice = &message.Advise{Reconnect: message.ReconnectHandshake, Interval: s.opts.interval}
+}
+
+func (s *Server) advice() *message.Advise {
+	return &message.Advise{Reconnect: message.ReconnectRetry, Interval: s.opts.interval, Timeout: s.opts.timeout}
+}
+
+//route delivers m to the sessions subscribed to a channel or pattern matching its channel, once per session
+func (s *Server) route(m *message.Message) {
+	s.mu.Lock()
+	recipients := map[*session]bool{}
+	for pattern, sessions := range s.subscriptions {
+		if !store.Covers(pattern, m.Channel) {
+			continue
+		}
+		for sess := range sessions {
+			recipients[sess] = true
+		}
+	}
+	s.mu.Unlock()
+	retention := s.retention(m.Channel)
+	for sess := range recipients {
+		delivery := *m
+		s.send(&delivery, s.deliverTo(sess, retention))
+	}
+}
+
+//deliverTo returns the reply queueing the deliveries of sess under retention, reporting the ones dropped
+func (s *Server) deliverTo(sess *session, retention *Retention) func(m *message.Message) {
+	return func(m *message.Message) {
+		q := queued{m: m, at: clock.Or(s.opts.clock).Now(), retention: retention}
+		s.dropped(sess, sess.deliver(q, s.opts.queueSize))
+	}
+}
+
+func (s *Server) subscribe(sess *session, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.subscriptions[name] == nil {
+		s.subscriptions[name] = map[*session]bool{}
+	}
+	s.subscriptions[name][sess] = true
+	sess.channels[name] = true
+}
+
+func (s *Server) unsubscribe(sess *session, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(sess.channels, name)
+	delete(s.subscriptions[name], sess)
+	if len(s.subscriptions[name]) == 0 {
+		delete(s.subscriptions, name)
+	}
+}
+
+//newSession registers a session with a new clientId, removed if it doesn't connect within the session timeout.
+//it returns false once the server is closed
+func (s *Server) newSession() (*session, bool) {
+	id := make([]byte, 16)
+	rand.Read(id)
+	sess := newSession(hex.EncodeToString(id), clock.Or(s.opts.clock).Now())
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, false
+	}
+	s.sessions[sess.id] = sess
+	s.mu.Unlock()
+	s.touch(sess)
+	return sess, true
+}
+
+//session returns the session of the clientId, extending its lifetime
+func (s *Server) session(clientID string) (*session, bool) {
+	s.mu.Lock()
+	sess, ok := s.sessions[clientID]
+	s.mu.Unlock()
+	if ok {
+		s.touch(sess)
+	}
+	return sess, ok
+}
+
+//touch restarts the session timeout, the held connects count as activity
+func (s *Server) touch(sess *session) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	sess.seen = clock.Or(s.opts.clock).Now()
+	if sess.expiry != nil {
+		sess.expiry.Stop()
+	}
+	sess.expiry = clock.Or(s.opts.clock).AfterFunc(s.opts.sessionTimeout+s.opts.timeout, func() {
+		s.removeSession(sess, nil)
+	})
+}
+
+//removeSession removes the session and its subscriptions and closes it, see session.close
+func (s *Server) removeSession(sess *session, advice *message.Advise) {
+	s.mu.Lock()
+	delete(s.sessions, sess.id)
+	for name := range sess.channels {
+		delete(s.subscriptions[name], sess)
+		if len(s.subscriptions[name]) == 0 {
+			delete(s.subscriptions, name)
+		}
+	}
+	s.mu.Unlock()
+	sess.close(advice)
+}
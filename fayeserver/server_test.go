@@ -0,0 +1,246 @@
+package fayeserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	fayec "github.com/thesyncim/faye"
+	"github.com/thesyncim/faye/clock"
+	"github.com/thesyncim/faye/message"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+//rejectPrivate is an extension rejecting the subscriptions to /private
+type rejectPrivate struct{}
+
+func (rejectPrivate) Incoming(m *message.Message, next func(m *message.Message)) {
+	if m.Channel == message.MetaSubscribe && m.Subscription == "/private" {
+		m.Error = "403::forbidden"
+	}
+	next(m)
+}
+
+func (rejectPrivate) Outgoing(m *message.Message, next func(m *message.Message)) {
+	next(m)
+}
+
+//expectMessage waits for a message delivered on msgs
+func expectMessage(t *testing.T, msgs <-chan message.Data, expected message.Data) {
+	t.Helper()
+	select {
+	case data := <-msgs:
+		if data != expected {
+			t.Fatalf("expecting %v got: %v", expected, data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expecting %v delivered", expected)
+	}
+}
+
+func TestServer(t *testing.T) {
+	var tests = []struct {
+		transport string
+		endpoint  func(url string) string
+	}{
+		{"websocket", func(url string) string { return "ws" + strings.TrimPrefix(url, "http") }},
+		{"long-polling", func(url string) string { return url }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.transport, func(t *testing.T) {
+			server := NewServer()
+			server.AddExtension(rejectPrivate{})
+			srv := httptest.NewServer(server)
+			defer srv.Close()
+			defer server.Close()
+
+			subscriber, err := fayec.NewClient(tt.endpoint(srv.URL), fayec.WithTransportName(tt.transport))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer subscriber.Disconnect()
+			publisher, err := fayec.NewClient(tt.endpoint(srv.URL), fayec.WithTransportName(tt.transport))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer publisher.Disconnect()
+
+			msgs := make(chan message.Data, 10)
+			if _, err = subscriber.SubscribeFunc("/foo/*", func(channel string, data message.Data) {
+				msgs <- data
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if err = publisher.Publish("/foo/bar", "hello"); err != nil {
+				t.Fatal(err)
+			}
+			expectMessage(t, msgs, "hello")
+			if err = server.Publish("/foo/baz", "from the server"); err != nil {
+				t.Fatal(err)
+			}
+			expectMessage(t, msgs, "from the server")
+
+			if _, err = subscriber.Subscribe("/private"); err == nil || err.Error() != "403::forbidden" {
+				t.Fatalf("expecting the subscription rejected got: %v", err)
+			}
+			if err = publisher.Disconnect(); err != nil {
+				t.Fatal(err)
+			}
+			if server.Clients() != 1 {
+				t.Fatalf("expecting a single client left got: %d", server.Clients())
+			}
+		})
+	}
+}
+
+func TestServer_UnknownClient(t *testing.T) {
+	srv := httptest.NewServer(NewServer())
+	defer srv.Close()
+
+	body, _ := json.Marshal([]message.Message{{Channel: message.MetaConnect, ClientId: "unknown", Id: "1"}})
+	resp, err := http.Post(srv.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var msgs []message.Message
+	if err = json.NewDecoder(resp.Body).Decode(&msgs); err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || msgs[0].Successful || msgs[0].Error != errUnknownClient || msgs[0].Advice.Reconnect != message.ReconnectHandshake {
+		t.Fatalf("expecting the client advised to handshake got: %+v", msgs)
+	}
+}
+
+func TestHandler_Authenticator(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/faye", Handler(WithAuthenticator(func(r *http.Request, m *message.Message) error {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			return errors.New("invalid token")
+		}
+		return nil
+	})))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	handshake := func(token string) error {
+		client, err := fayec.NewClient(srv.URL+"/faye", fayec.WithTransportName("long-polling"), fayec.WithStagedConnect(),
+			fayec.WithHeaders(http.Header{"Authorization": {"Bearer " + token}}))
+		if err != nil {
+			return err
+		}
+		defer client.Disconnect()
+		_, err = client.Handshake(context.Background())
+		return err
+	}
+	if err := handshake("secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := handshake("wrong"); err == nil || !strings.Contains(err.Error(), "403::invalid token") {
+		t.Fatalf("expecting the handshake rejected got: %v", err)
+	}
+}
+
+//handshake handles a handshake on s and returns the response
+func handshake(s *Server) *message.Message {
+	var resp *message.Message
+	s.handle(context.Background(), &message.Message{Channel: message.MetaHandshake, Id: "1"}, func(m *message.Message) {
+		resp = m
+	})
+	return resp
+}
+
+func TestServer_QueueSize(t *testing.T) {
+	var dropped []message.Data
+	server := NewServer(WithQueueSize(2), WithOnDrop(func(clientID string, m *message.Message) {
+		dropped = append(dropped, m.Data)
+	}))
+	defer server.Close()
+
+	resp := handshake(server)
+	if !resp.Successful {
+		t.Fatalf("expecting a successful handshake got: %+v", resp)
+	}
+	server.handle(context.Background(), &message.Message{Channel: message.MetaSubscribe, ClientId: resp.ClientId,
+		Subscription: "/foo"}, func(*message.Message) {})
+	for _, data := range []string{"a", "b", "c"} {
+		if err := server.Publish("/foo", data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(dropped) != 1 || dropped[0] != "a" {
+		t.Fatalf("expecting the oldest delivery dropped got: %v", dropped)
+	}
+	sess, _ := server.session(resp.ClientId)
+	queue := server.drain(sess)
+	if len(queue) != 2 || queue[0].Data != "b" || queue[1].Data != "c" {
+		t.Fatalf("expecting the newest deliveries queued got: %+v", queue)
+	}
+}
+
+func TestServer_Retention(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	var dropped []message.Data
+	server := NewServer(WithClock(c), WithSessionTimeout(time.Hour), WithOnDrop(func(clientID string, m *message.Message) {
+		dropped = append(dropped, m.Data)
+	}), WithRetention(
+		Retention{Pattern: "/age/*", MaxAge: time.Minute},
+		Retention{Pattern: "/capped", MaxQueued: 1},
+		Retention{Pattern: "/live/**", Ephemeral: true},
+	))
+	defer server.Close()
+
+	resp := handshake(server)
+	for _, name := range []string{"/age/a", "/capped", "/live/a/b", "/other"} {
+		server.handle(context.Background(), &message.Message{Channel: message.MetaSubscribe, ClientId: resp.ClientId,
+			Subscription: name}, func(*message.Message) {})
+	}
+	sess, _ := server.session(resp.ClientId)
+	publish := func(channel, data string) {
+		t.Helper()
+		if err := server.Publish(channel, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	publish("/age/a", "expired")
+	publish("/capped", "replaced")
+	publish("/capped", "capped")
+	//nothing is connected to get it
+	publish("/live/a/b", "missed")
+	detach := sess.attach()
+	publish("/live/a/b", "live")
+	detach()
+	publish("/other", "other")
+	c.Advance(2 * time.Minute)
+
+	queue := server.drain(sess)
+	var data []message.Data
+	for _, m := range queue {
+		data = append(data, m.Data)
+	}
+	if !reflect.DeepEqual(data, []message.Data{"capped", "live", "other"}) {
+		t.Fatalf("expecting the deliveries retained got: %v", data)
+	}
+	if !reflect.DeepEqual(dropped, []message.Data{"replaced", "missed", "expired"}) {
+		t.Fatalf("expecting the deliveries dropped by their policy got: %v", dropped)
+	}
+}
+
+func TestServer_Closed(t *testing.T) {
+	server := NewServer()
+	if err := server.Close(); err != nil {
+		t.Fatal(err)
+	}
+	resp := handshake(server)
+	if resp.Successful || resp.Error != errClosed || server.Clients() != 0 {
+		t.Fatalf("expecting the handshake rejected got: %+v", resp)
+	}
+	if err := server.Publish("/foo", "bar"); err != ErrServerClosed {
+		t.Fatalf("expecting %v got: %v", ErrServerClosed, err)
+	}
+}
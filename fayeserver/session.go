@@ -0,0 +1,196 @@
+package fayeserver
+
+import (
+	"context"
+	"github.com/thesyncim/faye/clock"
+	"github.com/thesyncim/faye/message"
+	"sync"
+	"time"
+)
+
+//session is the state of a client between its handshake and its disconnect
+type session struct {
+	id      string
+	created time.Time
+	//channels are the channels and patterns subscribed, guarded by Server.mu
+	channels map[string]bool
+
+	mu sync.Mutex
+	//queue holds the deliveries until the transport sends them
+	queue  []queued
+	closed bool
+	//connected counts the connects held and the connections pushing the deliveries, see attach
+	connected int
+	//seen is the last time the client sent a message, see Server.touch
+	seen time.Time
+	//advice replaces the advice of the connects held once the session is closed, see answer
+	advice *message.Advise
+	//expiry removes the session when the client stops connecting, see Server.touch
+	expiry clock.Timer
+	//pending is signaled when deliveries are queued
+	pending chan struct{}
+	//done is closed when the session is removed
+	done chan struct{}
+}
+
+func newSession(id string, now time.Time) *session {
+	return &session{
+		id:       id,
+		created:  now,
+		seen:     now,
+		channels: map[string]bool{},
+		pending:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+//queued is a delivery waiting for the transport
+type queued struct {
+	m  *message.Message
+	at time.Time
+	//retention is the policy of the channel of m, nil for the default one
+	retention *Retention
+}
+
+//expired tells if the retention of q drops it at now
+func (q queued) expired(now time.Time) bool {
+	return q.retention != nil && q.retention.MaxAge > 0 && now.Sub(q.at) >= q.retention.MaxAge
+}
+
+//deliver queues a delivery for the transport, see drain. the deliveries expired, the oldest one of the
+//retention of q once it queues MaxQueued and the oldest one once limit deliveries are queued are dropped and
+//returned, a limit <= 0 leaves the queue unbounded. an ephemeral delivery is dropped if the client isn't connected
+func (sess *session) deliver(q queued, limit int) (dropped []*message.Message) {
+	sess.mu.Lock()
+	if sess.closed {
+		sess.mu.Unlock()
+		return nil
+	}
+	if q.retention != nil && q.retention.Ephemeral && sess.connected == 0 {
+		sess.mu.Unlock()
+		return []*message.Message{q.m}
+	}
+	dropped = sess.expire(q.at)
+	if q.retention != nil && q.retention.MaxQueued > 0 {
+		count, oldest := 0, -1
+		for i := range sess.queue {
+			if sess.queue[i].retention == q.retention {
+				if oldest < 0 {
+					oldest = i
+				}
+				count++
+			}
+		}
+		if count >= q.retention.MaxQueued {
+			dropped = append(dropped, sess.queue[oldest].m)
+			sess.queue = append(sess.queue[:oldest], sess.queue[oldest+1:]...)
+		}
+	}
+	if limit > 0 && len(sess.queue) >= limit {
+		dropped = append(dropped, sess.queue[0].m)
+		sess.queue[0] = queued{}
+		sess.queue = sess.queue[1:]
+	}
+	sess.queue = append(sess.queue, q)
+	sess.mu.Unlock()
+	select {
+	case sess.pending <- struct{}{}:
+	default:
+	}
+	return dropped
+}
+
+//expire removes the deliveries expired at now from the queue and returns them, sess.mu must be held
+func (sess *session) expire(now time.Time) (expired []*message.Message) {
+	kept := sess.queue[:0]
+	for _, q := range sess.queue {
+		if q.expired(now) {
+			expired = append(expired, q.m)
+			continue
+		}
+		kept = append(kept, q)
+	}
+	for i := len(kept); i < len(sess.queue); i++ {
+		sess.queue[i] = queued{}
+	}
+	sess.queue = kept
+	return expired
+}
+
+//drain returns the deliveries queued and empties the queue, the ones expired at now are returned apart
+func (sess *session) drain(now time.Time) (queue, expired []*message.Message) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	expired = sess.expire(now)
+	for _, q := range sess.queue {
+		queue = append(queue, q.m)
+	}
+	sess.queue = nil
+	return queue, expired
+}
+
+//attach counts the client as connected until detach is called, so the ephemeral deliveries are queued for it
+func (sess *session) attach() (detach func()) {
+	sess.mu.Lock()
+	sess.connected++
+	sess.mu.Unlock()
+	return func() {
+		sess.mu.Lock()
+		sess.connected--
+		sess.mu.Unlock()
+	}
+}
+
+//hold waits until the timeout expires, ctx is done or the session is closed. with untilPending the wait
+//also ends when deliveries are queued, so a long-polling connect returns them right away
+func (sess *session) hold(ctx context.Context, c clock.Clock, timeout time.Duration, untilPending bool) {
+	if untilPending {
+		sess.mu.Lock()
+		queued := len(sess.queue) > 0
+		sess.mu.Unlock()
+		if queued {
+			return
+		}
+	}
+	defer sess.attach()()
+	var pending chan struct{}
+	if untilPending {
+		pending = sess.pending
+	}
+	timer := clock.Or(c).NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+	case <-pending:
+	case <-ctx.Done():
+	case <-sess.done:
+	}
+}
+
+//answer returns the response of a connect held, with the advice the session was closed with if any
+func (sess *session) answer(resp *message.Message) *message.Message {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if !sess.closed || sess.advice == nil {
+		return resp
+	}
+	answered := *resp
+	answered.Advice = sess.advice
+	return &answered
+}
+
+//close discards the deliveries queued and ends the connects held, they are answered with advice if not nil
+func (sess *session) close(advice *message.Advise) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.closed {
+		return
+	}
+	sess.closed = true
+	sess.advice = advice
+	sess.queue = nil
+	if sess.expiry != nil {
+		sess.expiry.Stop()
+	}
+	close(sess.done)
+}
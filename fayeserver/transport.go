@@ -0,0 +1,172 @@
+package fayeserver
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"github.com/thesyncim/faye/message"
+	"io"
+	"net/http"
+	"sync"
+)
+
+//requestKey is the context key of the HTTP request carrying the messages, see withRequest
+type requestKey struct{}
+
+//withRequest returns the context of r carrying r, for the authenticator
+func withRequest(r *http.Request) context.Context {
+	return context.WithValue(r.Context(), requestKey{}, r)
+}
+
+//conn is a connection the responses and deliveries are written to as they come, e.g. a websocket
+type conn struct {
+	mu sync.Mutex
+	//send writes a batch of messages, calls are serialized by mu
+	send func(msgs []*message.Message) error
+	//pushing is the session whose deliveries are pushed on the connection
+	pushing *session
+}
+
+func (c *conn) write(msgs []*message.Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.send(msgs)
+}
+
+//serveWebsocket reads the message batches of the connection until it is closed, see receive
+func (s *Server) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		//the upgrader responded with the error
+		return
+	}
+	defer ws.Close()
+	ctx, cancel := context.WithCancel(withRequest(r))
+	defer cancel()
+
+	c := &conn{send: func(msgs []*message.Message) error {
+		return ws.WriteJSON(msgs)
+	}}
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		s.receive(ctx, c, data)
+	}
+}
+
+//receive handles a batch of messages received on c. the deliveries are pushed as they are published,
+//the connects are held for the timeout
+func (s *Server) receive(ctx context.Context, c *conn, data []byte) {
+	var parser message.Parser
+	msgs, _ := parser.Parse(data)
+	for i := range msgs {
+		s.handle(ctx, &msgs[i], func(resp *message.Message) {
+			if resp.Channel != message.MetaConnect || !resp.Successful {
+				c.write([]*message.Message{resp})
+				return
+			}
+			sess, ok := s.session(resp.ClientId)
+			if !ok {
+				return
+			}
+			s.push(ctx, c, sess)
+			go func() {
+				sess.hold(ctx, s.opts.clock, s.opts.timeout, false)
+				if ctx.Err() == nil {
+					c.write([]*message.Message{sess.answer(resp)})
+				}
+			}()
+		})
+	}
+}
+
+//push writes the deliveries of the session to the connection until ctx is done or the session is closed
+func (s *Server) push(ctx context.Context, c *conn, sess *session) {
+	c.mu.Lock()
+	started := c.pushing == sess
+	c.pushing = sess
+	c.mu.Unlock()
+	if started {
+		return
+	}
+	go func() {
+		defer sess.attach()()
+		for {
+			if queue := s.drain(sess); len(queue) > 0 {
+				if err := c.write(queue); err != nil {
+					return
+				}
+			}
+			select {
+			case <-sess.pending:
+			case <-sess.done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+//servePolling answers a batch of messages posted, a successful connect is held until there are deliveries
+//to return along with its response or the timeout expires
+func (s *Server) servePolling(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer zr.Close()
+		body = zr
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var parser message.Parser
+	msgs, err := parser.Parse(b)
+	if err != nil && len(msgs) == 0 {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var (
+		resps   []*message.Message
+		connect *message.Message
+	)
+	ctx := withRequest(r)
+	for i := range msgs {
+		s.handle(ctx, &msgs[i], func(resp *message.Message) {
+			if resp.Channel == message.MetaConnect && resp.Successful {
+				connect = resp
+				return
+			}
+			resps = append(resps, resp)
+		})
+	}
+	if connect != nil {
+		if sess, ok := s.session(connect.ClientId); ok {
+			sess.hold(r.Context(), s.opts.clock, s.opts.timeout, true)
+			resps = append(resps, s.drain(sess)...)
+			connect = sess.answer(connect)
+		}
+		resps = append(resps, connect)
+	}
+	if r.Context().Err() != nil {
+		return
+	}
+	if resps == nil {
+		resps = []*message.Message{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resps)
+}
@@ -0,0 +1,68 @@
+//Package idgen generates the ids of the messages sent by the client, see fayec.WithIDGenerator.
+package idgen
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+	"sync/atomic"
+)
+
+//Generator returns a new message id on every call, it must be safe for concurrent use
+type Generator interface {
+	Next() string
+}
+
+//Counter numbers the messages from 1, this is the default generator.
+//the ids restart with every client, and reveal how many messages were sent.
+type Counter struct {
+	n uint64
+}
+
+//Next implements Generator
+func (c *Counter) Next() string {
+	return strconv.FormatUint(atomic.AddUint64(&c.n, 1), 10)
+}
+
+//UUID returns random version 4 UUIDs, e.g. 0b8f5c9e-3c1a-4d2e-9f7b-6a5d4c3b2a19
+type UUID struct{}
+
+//Next implements Generator
+func (UUID) Next() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	var s [36]byte
+	hex.Encode(s[0:8], b[0:4])
+	s[8] = '-'
+	hex.Encode(s[9:13], b[4:6])
+	s[13] = '-'
+	hex.Encode(s[14:18], b[6:8])
+	s[18] = '-'
+	hex.Encode(s[19:23], b[8:10])
+	s[23] = '-'
+	hex.Encode(s[24:], b[10:])
+	return string(s[:])
+}
+
+//defaultRandomSize is the number of random bytes of the Random ids when Size is not set
+const defaultRandomSize = 16
+
+//Random returns Size random bytes encoded in unpadded url safe base64
+type Random struct {
+	//Size is the number of random bytes, 16 when 0
+	Size int
+}
+
+//Next implements Generator
+func (r Random) Next() string {
+	size := r.Size
+	if size <= 0 {
+		size = defaultRandomSize
+	}
+	b := make([]byte, size)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
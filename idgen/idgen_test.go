@@ -0,0 +1,53 @@
+package idgen
+
+import (
+	"regexp"
+	"sync"
+	"testing"
+)
+
+func TestCounter(t *testing.T) {
+	c := &Counter{}
+	for _, expected := range []string{"1", "2", "3"} {
+		if id := c.Next(); id != expected {
+			t.Fatalf("expecting %s got: %s", expected, id)
+		}
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	var tests = []struct {
+		name   string
+		gen    Generator
+		format *regexp.Regexp
+	}{
+		{"counter", &Counter{}, regexp.MustCompile(`^[1-9][0-9]*$`)},
+		{"uuid", UUID{}, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)},
+		{"random", Random{}, regexp.MustCompile(`^[A-Za-z0-9_-]{22}$`)},
+		{"random 6", Random{Size: 6}, regexp.MustCompile(`^[A-Za-z0-9_-]{8}$`)},
+	}
+	for _, tt := range tests {
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		seen := map[string]bool{}
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					id := tt.gen.Next()
+					mu.Lock()
+					seen[id] = true
+					mu.Unlock()
+					if !tt.format.MatchString(id) {
+						t.Errorf("%s: unexpected id %s", tt.name, id)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		if len(seen) != 800 {
+			t.Fatalf("%s: expecting 800 distinct ids got: %d", tt.name, len(seen))
+		}
+	}
+}
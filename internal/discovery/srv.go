@@ -0,0 +1,67 @@
+package discovery
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+//ErrNoRecords is returned when a SRV name doesn't resolve to any target
+var ErrNoRecords = errors.New("no SRV records found")
+
+//srvSchemes maps the SRV endpoint schemes to the scheme used to dial the resolved targets
+var srvSchemes = map[string]string{
+	"srv":  "ws",
+	"srvs": "wss",
+}
+
+//LookupSRV resolves the SRV records of name.
+//the records must be sorted by priority and randomized by weight within a priority (RFC 2782),
+//as done by net.LookupSRV.
+var LookupSRV = func(name string) ([]*net.SRV, error) {
+	_, addrs, err := net.LookupSRV("", "", name)
+	return addrs, err
+}
+
+//IsSRV reports whether the endpoint must be resolved using DNS SRV records,
+//e.g. srv://_faye._tcp.example.com/faye or srvs:// for TLS targets
+func IsSRV(endpoint string) bool {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return false
+	}
+	_, ok := srvSchemes[u.Scheme]
+	return ok
+}
+
+//ResolveSRV resolves a SRV endpoint into the list of endpoints to try, in order.
+//the path and query of the SRV endpoint are preserved on every target.
+func ResolveSRV(endpoint string) ([]string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	scheme, ok := srvSchemes[u.Scheme]
+	if !ok {
+		return nil, errors.New("invalid SRV endpoint scheme `" + u.Scheme + "`")
+	}
+
+	records, err := LookupSRV(u.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrNoRecords
+	}
+
+	endpoints := make([]string, 0, len(records))
+	for i := range records {
+		target := *u
+		target.Scheme = scheme
+		target.Host = net.JoinHostPort(strings.TrimSuffix(records[i].Target, "."), strconv.Itoa(int(records[i].Port)))
+		endpoints = append(endpoints, target.String())
+	}
+	return endpoints, nil
+}
@@ -0,0 +1,74 @@
+package discovery
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestResolveSRV(t *testing.T) {
+	defer func(lookup func(name string) ([]*net.SRV, error)) {
+		LookupSRV = lookup
+	}(LookupSRV)
+	LookupSRV = func(name string) ([]*net.SRV, error) {
+		if name != "_faye._tcp.example.com" {
+			return nil, nil
+		}
+		return []*net.SRV{
+			{Target: "a.example.com.", Port: 8000, Priority: 10, Weight: 5},
+			{Target: "b.example.com.", Port: 8001, Priority: 20, Weight: 5},
+		}, nil
+	}
+
+	tests := []struct {
+		name     string
+		endpoint string
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name:     "srv",
+			endpoint: "srv://_faye._tcp.example.com/faye",
+			want:     []string{"ws://a.example.com:8000/faye", "ws://b.example.com:8001/faye"},
+		},
+		{
+			name:     "srvs with query",
+			endpoint: "srvs://_faye._tcp.example.com/faye?token=1",
+			want:     []string{"wss://a.example.com:8000/faye?token=1", "wss://b.example.com:8001/faye?token=1"},
+		},
+		{
+			name:     "no records",
+			endpoint: "srv://_faye._tcp.unknown.com/faye",
+			wantErr:  true,
+		},
+		{
+			name:     "not srv",
+			endpoint: "ws://example.com/faye",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveSRV(tt.endpoint)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveSRV() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ResolveSRV() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsSRV(t *testing.T) {
+	for endpoint, want := range map[string]bool{
+		"srv://_faye._tcp.example.com/faye":  true,
+		"srvs://_faye._tcp.example.com/faye": true,
+		"ws://example.com/faye":              false,
+		"wss://example.com/faye":             false,
+	} {
+		if got := IsSRV(endpoint); got != want {
+			t.Errorf("IsSRV(%s) = %v, want %v", endpoint, got, want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package dispatcher
+
+import (
+	"github.com/thesyncim/faye/message"
+)
+
+//ackExt is the ext key of the CometD acknowledged messages extension: the client asks for it on
+///meta/handshake with {"ext":{"ack":true}} and the server confirms it the same way. the server then numbers the
+//batches of messages delivered with the /meta/connect responses, {"ext":{"ack":42}}, and the client sends back
+//the last batch number received on the next /meta/connect. the batches not acknowledged are delivered again
+//once the connection is restored.
+const ackExt = "ack"
+
+//SetAckExtension enables the CometD acknowledged messages extension, see ackExt. it must be called before Start.
+func (d *Dispatcher) SetAckExtension(enabled bool) {
+	d.ackMu.Lock()
+	d.ackEnabled = enabled
+	d.ackMu.Unlock()
+}
+
+//AckEnabled reports whether the server confirmed the acknowledged messages extension
+func (d *Dispatcher) AckEnabled() bool {
+	d.ackMu.Lock()
+	defer d.ackMu.Unlock()
+	return d.ackNegotiated
+}
+
+//advertiseAck asks for the acknowledged messages extension in the handshake message, a new session starts
+//without batch
+func (d *Dispatcher) advertiseAck(m *message.Message) {
+	d.ackMu.Lock()
+	defer d.ackMu.Unlock()
+	if !d.ackEnabled {
+		return
+	}
+	d.ackNegotiated = false
+	d.ackBatch = 0
+	m.SetExt(ackExt, true)
+}
+
+//handshakeAck records whether the server confirmed the acknowledged messages extension
+func (d *Dispatcher) handshakeAck(resp *message.Message) {
+	var confirmed bool
+	resp.GetExt(ackExt, &confirmed)
+	d.ackMu.Lock()
+	d.ackNegotiated = d.ackEnabled && confirmed
+	d.ackMu.Unlock()
+}
+
+//acknowledge adds the last batch number received to the /meta/connect message
+func (d *Dispatcher) acknowledge(m *message.Message) {
+	d.ackMu.Lock()
+	defer d.ackMu.Unlock()
+	if d.ackNegotiated {
+		m.SetExt(ackExt, d.ackBatch)
+	}
+}
+
+//recordAckBatch records the batch number of a successful /meta/connect response, the messages of the batch
+//were dispatched before it
+func (d *Dispatcher) recordAckBatch(msg *message.Message) {
+	if msg.Channel != message.MetaConnect || !msg.Successful {
+		return
+	}
+	var batch int64
+	if msg.GetExt(ackExt, &batch) != nil {
+		return
+	}
+	d.ackMu.Lock()
+	if d.ackNegotiated {
+		d.ackBatch = batch
+	}
+	d.ackMu.Unlock()
+}
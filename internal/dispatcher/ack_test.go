@@ -0,0 +1,71 @@
+package dispatcher
+
+import (
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDispatcher_AckExtension(t *testing.T) {
+	tests := []struct {
+		name         string
+		enabled      bool
+		handshakeExt interface{}
+		expectAck    bool
+	}{
+		{name: "negotiated", enabled: true, handshakeExt: map[string]interface{}{"ack": true}, expectAck: true},
+		{name: "not supported by the server", enabled: true},
+		{name: "disabled", handshakeExt: map[string]interface{}{"ack": true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var connects int32
+			ft := &fakeTransport{handshakeExt: tt.handshakeExt}
+			ft.onHandshake = func(m *message.Message) {
+				var requested bool
+				if err := m.GetExt("ack", &requested); (err == nil && requested) != tt.enabled {
+					t.Errorf("expecting the extension requested %v got: %v", tt.enabled, m.Ext)
+				}
+			}
+			//the first connect response carries the batch 3, the next connects are held
+			ft.reply = func(ft *fakeTransport, m *message.Message) {
+				if m.Channel == message.MetaConnect && atomic.AddInt32(&connects, 1) == 1 {
+					go ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Successful: true, Ext: map[string]interface{}{"ack": 3.0}})
+				}
+			}
+			d := NewDispatcher("fake://", transport.Options{}, message.Extensions{})
+			d.SetTransport(ft)
+			d.SetAckExtension(tt.enabled)
+			if err := d.Start(); err != nil {
+				t.Fatal(err)
+			}
+			defer d.Disconnect()
+			if d.AckEnabled() != tt.expectAck {
+				t.Fatalf("expecting the extension negotiated %v", tt.expectAck)
+			}
+			deadline := time.Now().Add(time.Second)
+			for len(sentOn(ft, message.MetaConnect)) < 2 {
+				if time.Now().After(deadline) {
+					t.Fatal("expecting the next connect sent")
+				}
+				time.Sleep(time.Millisecond)
+			}
+			connectMsgs := sentOn(ft, message.MetaConnect)
+			for i, expected := range []int64{0, 3} {
+				var batch int64
+				err := connectMsgs[i].GetExt("ack", &batch)
+				if !tt.expectAck {
+					if err == nil {
+						t.Fatalf("expecting no batch acknowledged got: %v", connectMsgs[i].Ext)
+					}
+					continue
+				}
+				if err != nil || batch != expected {
+					t.Fatalf("expecting the batch %d acknowledged got: %v", expected, connectMsgs[i].Ext)
+				}
+			}
+		})
+	}
+}
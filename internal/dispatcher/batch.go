@@ -0,0 +1,103 @@
+package dispatcher
+
+import (
+	"context"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/subscription"
+)
+
+//BatchOp is a subscribe or a publish sent within a batch
+type BatchOp struct {
+	//Subscribe is true to subscribe to Channel, otherwise Data is published to Channel
+	Subscribe bool
+	Channel   string
+	Data      message.Data
+
+	//Subscription and Err are set once the batch completes
+	Subscription *subscription.Subscription
+	Err          error
+}
+
+//batchPending is the state of a prepared batch operation
+type batchPending struct {
+	sub   *pendingSubscribe
+	pubID string
+	ack   chan error
+}
+
+//Batch sends the operations in a single frame and waits for all their responses,
+//the outcome of every operation is set on it and the first error is returned
+func (d *Dispatcher) Batch(ops []*BatchOp) error {
+	if err := d.closingErr(); err != nil {
+		return err
+	}
+	if err := d.wake(context.Background()); err != nil {
+		return err
+	}
+	msgs := make([]*message.Message, 0, len(ops))
+	pending := make([]batchPending, len(ops))
+	subscribes := 0
+	for i, op := range ops {
+		if op.Subscribe {
+			p, err := d.prepareSubscribe(op.Channel, subscription.AtMostOnce, nil)
+			if err != nil {
+				op.Err = err
+				continue
+			}
+			pending[i].sub = p
+			if p.m != nil {
+				msgs = append(msgs, p.m)
+				subscribes++
+			}
+			continue
+		}
+		m, ack, err := d.preparePublish(op.Channel, op.Data, false)
+		if err != nil {
+			op.Err = err
+			continue
+		}
+		if err = d.applyOut(context.Background(), m); err != nil {
+			d.removePublishACK(m.Id)
+			op.Err = err
+			continue
+		}
+		pending[i].pubID, pending[i].ack = m.Id, ack
+		msgs = append(msgs, m)
+	}
+
+	if len(msgs) > 0 {
+		err := d.throttle(context.Background(), len(msgs)-subscribes, subscribes)
+		if err == nil {
+			err = d.transport.SendMessages(msgs)
+		}
+		if err != nil {
+			for i, op := range ops {
+				if pending[i].sub != nil {
+					d.cancelSubscribe(pending[i].sub, err)
+				}
+				if pending[i].ack != nil {
+					d.removePublishACK(pending[i].pubID)
+				}
+				if op.Err == nil {
+					op.Err = err
+				}
+			}
+			return err
+		}
+	}
+
+	for i, op := range ops {
+		switch {
+		case pending[i].sub != nil:
+			op.Subscription, op.Err = d.awaitSubscribe(context.Background(), pending[i].sub)
+		case pending[i].ack != nil:
+			op.Err = d.awaitPublish(context.Background(), pending[i].pubID, pending[i].ack, 0)
+		}
+	}
+	for _, op := range ops {
+		if op.Err != nil {
+			return op.Err
+		}
+	}
+	return nil
+}
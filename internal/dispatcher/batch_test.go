@@ -0,0 +1,48 @@
+package dispatcher
+
+import (
+	"github.com/thesyncim/faye/message"
+	"testing"
+)
+
+func TestDispatcher_Batch(t *testing.T) {
+	d, ft := newTestDispatcher(t, func(ft *fakeTransport, m *message.Message) {
+		switch {
+		case m.Channel == message.MetaSubscribe:
+			ackSubscriptions(ft, m)
+		case m.Channel == "/denied":
+			go ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Successful: false, Error: "403::forbidden"})
+		case !message.IsMetaMessage(m):
+			go ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Successful: true})
+		}
+	})
+
+	ops := []*BatchOp{
+		{Subscribe: true, Channel: "/foo"},
+		{Channel: "/foo", Data: "a"},
+		{Channel: "/denied", Data: "b"},
+		{Subscribe: true, Channel: "/bar/"},
+	}
+	if err := d.Batch(ops); err == nil {
+		t.Fatal("expecting the first operation error")
+	}
+
+	ft.mu.Lock()
+	batches := ft.batches
+	ft.mu.Unlock()
+	if len(batches) != 1 || len(batches[0]) != 3 {
+		t.Fatalf("expecting the valid operations sent in a single frame got: %v", batches)
+	}
+	if ops[0].Err != nil || ops[0].Subscription == nil || ops[0].Subscription.Name() != "/foo" {
+		t.Fatalf("expecting the subscription to /foo got: %v", ops[0].Err)
+	}
+	if ops[1].Err != nil {
+		t.Fatalf("expecting the publish acknowledged got: %v", ops[1].Err)
+	}
+	if ops[2].Err == nil {
+		t.Fatal("expecting the publish to be rejected")
+	}
+	if ops[3].Err == nil {
+		t.Fatal("expecting the invalid subscription to fail")
+	}
+}
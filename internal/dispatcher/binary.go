@@ -0,0 +1,180 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/thesyncim/faye/internal/event"
+	"github.com/thesyncim/faye/message"
+	"time"
+)
+
+//ErrPayloadTooLarge is returned when publishing a binary payload larger than the limit, see SetBinaryLimits
+var ErrPayloadTooLarge = errors.New("binary payload too large")
+
+const (
+	//maxAssemblies bounds the chunked payloads being received at the same time, the chunks of the others are dropped
+	maxAssemblies = 100
+	//maxChunks bounds the chunks of a payload, whatever the count announced by the publisher
+	maxChunks = 1 << 16
+	//assemblyTimeout is how long the chunks of a payload are kept waiting for the missing ones, e.g. lost during
+	//a reconnection
+	assemblyTimeout = time.Minute
+)
+
+//binaryChunk is the data of a publish carrying a chunk of a binary payload
+type binaryChunk struct {
+	data  message.BinaryData
+	frame message.BinaryFrame
+}
+
+//assembly gathers the chunks of a binary payload received on channel since started
+type assembly struct {
+	channel string
+	started time.Time
+	count   int
+	chunks  map[int]message.BinaryData
+	size    int
+}
+
+//SetBinaryLimits bounds the size of the binary payloads published and received, 0 doesn't, and splits the ones
+//larger than chunkSize in chunks of chunkSize published in order, 0 doesn't. the chunks are gathered before
+//the delivery, the subscribers receive the whole payload.
+func (d *Dispatcher) SetBinaryLimits(maxSize, chunkSize int) {
+	d.binaryMu.Lock()
+	d.maxBinarySize = maxSize
+	d.chunkSize = chunkSize
+	d.binaryMu.Unlock()
+}
+
+//binaryLimits returns the limits set by SetBinaryLimits
+func (d *Dispatcher) binaryLimits() (maxSize, chunkSize int) {
+	d.binaryMu.Lock()
+	defer d.binaryMu.Unlock()
+	return d.maxBinarySize, d.chunkSize
+}
+
+//publishBinary publishes a binary payload, in chunks if it is larger than the chunk size. ok is false if the
+//payload is published as a single message.
+func (d *Dispatcher) publishBinary(ctx context.Context, subscription string, data message.BinaryData, timeout time.Duration, requireAck bool) (ok bool, err error) {
+	maxSize, chunkSize := d.binaryLimits()
+	if maxSize > 0 && len(data) > maxSize {
+		return true, fmt.Errorf("%w: %d bytes, the limit is %d", ErrPayloadTooLarge, len(data), maxSize)
+	}
+	if chunkSize <= 0 || len(data) <= chunkSize {
+		return false, nil
+	}
+	frame := message.BinaryFrame{ID: d.nextMsgID(), Count: (len(data) + chunkSize - 1) / chunkSize}
+	for frame.Index = 0; frame.Index < frame.Count; frame.Index++ {
+		end := (frame.Index + 1) * chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk := binaryChunk{data: data[frame.Index*chunkSize : end], frame: frame}
+		if err = d.publish(ctx, subscription, chunk, timeout, requireAck); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+//encodeBinary encodes the binary data of a publish, see message.BinaryData
+func encodeBinary(m *message.Message) {
+	if chunk, ok := m.Data.(binaryChunk); ok {
+		m.Data = chunk.data
+		message.EncodeBinary(m, chunk.frame)
+		return
+	}
+	message.EncodeBinary(m, message.BinaryFrame{})
+}
+
+//decodeBinary decodes the binary data of a delivery and gathers the chunks of the payloads, ok is false until
+//the last chunk is received
+func (d *Dispatcher) decodeBinary(msg *message.Message) (*message.Message, bool) {
+	frame, binary, err := message.DecodeBinary(msg)
+	if err != nil {
+		d.events.Publish(event.Event{Type: event.Error, Err: err, Message: msg})
+		return nil, false
+	}
+	if !binary || !frame.Chunked() {
+		return msg, true
+	}
+	data, err := d.assemble(msg.Channel, frame, msg.Data.(message.BinaryData))
+	if err != nil {
+		d.events.Publish(event.Event{Type: event.Error, Err: err, Message: msg})
+		return nil, false
+	}
+	if data == nil {
+		return nil, false
+	}
+	m := *msg
+	m.Id = frame.ID
+	m.Data = data
+	return &m, true
+}
+
+//assemble records a chunk, it returns the whole payload once all its chunks are received
+func (d *Dispatcher) assemble(channel string, frame message.BinaryFrame, chunk message.BinaryData) (message.BinaryData, error) {
+	if frame.Index < 0 || frame.Index >= frame.Count {
+		return nil, fmt.Errorf("binary: chunk %d of %d", frame.Index, frame.Count)
+	}
+	key := channel + " " + frame.ID
+	d.binaryMu.Lock()
+	defer d.binaryMu.Unlock()
+	//every chunk holds a byte at least
+	if frame.Count > maxChunks || d.maxBinarySize > 0 && frame.Count > d.maxBinarySize {
+		delete(d.assemblies, key)
+		return nil, fmt.Errorf("%w: payload %s announces %d chunks", ErrPayloadTooLarge, frame.ID, frame.Count)
+	}
+	now := d.clock().Now()
+	d.expireAssemblies(now)
+	a, ok := d.assemblies[key]
+	if !ok {
+		if len(d.assemblies) >= maxAssemblies {
+			return nil, fmt.Errorf("binary: too many chunked payloads in flight, payload %s dropped", frame.ID)
+		}
+		a = &assembly{channel: channel, started: now, count: frame.Count, chunks: map[int]message.BinaryData{}}
+		d.assemblies[key] = a
+	}
+	if _, dup := a.chunks[frame.Index]; frame.Count != a.count || dup {
+		delete(d.assemblies, key)
+		return nil, fmt.Errorf("binary: inconsistent chunk %d of payload %s", frame.Index, frame.ID)
+	}
+	a.chunks[frame.Index] = chunk
+	a.size += len(chunk)
+	if d.maxBinarySize > 0 && a.size > d.maxBinarySize {
+		delete(d.assemblies, key)
+		return nil, fmt.Errorf("%w: payload %s exceeds %d bytes", ErrPayloadTooLarge, frame.ID, d.maxBinarySize)
+	}
+	if len(a.chunks) < a.count {
+		return nil, nil
+	}
+	delete(d.assemblies, key)
+	data := make(message.BinaryData, 0, a.size)
+	for i := 0; i < a.count; i++ {
+		data = append(data, a.chunks[i]...)
+	}
+	return data, nil
+}
+
+//expireAssemblies drops the payloads whose chunks are missing for longer than assemblyTimeout, binaryMu must be held
+func (d *Dispatcher) expireAssemblies(now time.Time) {
+	for key, a := range d.assemblies {
+		if now.Sub(a.started) >= assemblyTimeout {
+			delete(d.assemblies, key)
+		}
+	}
+}
+
+//dropAssemblies drops the payloads being received on the channels no subscription matches anymore, all of them
+//once the client is terminated
+func (d *Dispatcher) dropAssemblies() {
+	terminated := d.terminated() != nil
+	d.binaryMu.Lock()
+	defer d.binaryMu.Unlock()
+	for key, a := range d.assemblies {
+		if terminated || len(d.store.Match(a.channel)) == 0 {
+			delete(d.assemblies, key)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package dispatcher
+
+import (
+	"bytes"
+	"errors"
+	"github.com/thesyncim/faye/channel"
+	"github.com/thesyncim/faye/clock"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"strconv"
+	"testing"
+	"time"
+)
+
+//echo acknowledges the subscribes and the publishes, and delivers the publishes back
+func echo(ft *fakeTransport, m *message.Message) {
+	ackAll(ft, m)
+	if !message.IsMetaMessage(m) {
+		go ft.deliver(&message.Message{Channel: m.Channel, Data: m.Data, Id: m.Id, Ext: m.Ext})
+	}
+}
+
+func TestDispatcher_BinaryData(t *testing.T) {
+	payload := message.BinaryData("0123456789")
+	tests := []struct {
+		name      string
+		chunkSize int
+		messages  int
+	}{
+		{name: "single message", messages: 1},
+		{name: "chunked", chunkSize: 4, messages: 3},
+		{name: "exact chunk", chunkSize: 10, messages: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, ft := newTestDispatcher(t, echo)
+			defer d.Disconnect()
+			d.SetBinaryLimits(0, tt.chunkSize)
+			if err := d.SetChannelConfigs([]channel.Config{{Pattern: "/files", BufferSize: 10}}); err != nil {
+				t.Fatal(err)
+			}
+			sub, err := d.Subscribe("/files")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = d.Publish("/files", payload); err != nil {
+				t.Fatal(err)
+			}
+			if sent := sentOn(ft, "/files"); len(sent) != tt.messages {
+				t.Fatalf("expecting %d messages sent got: %d", tt.messages, len(sent))
+			}
+			select {
+			case msg := <-sub.MsgChannel():
+				if data, _ := msg.Data.(message.BinaryData); !bytes.Equal(data, payload) {
+					t.Fatalf("expecting the payload delivered got: %v", msg.Data)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("expecting the payload delivered")
+			}
+			select {
+			case msg := <-sub.MsgChannel():
+				t.Fatalf("expecting a single delivery got: %v", msg.Data)
+			case <-time.After(20 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestDispatcher_BinaryLimits(t *testing.T) {
+	d, ft := newTestDispatcher(t, echo)
+	defer d.Disconnect()
+	d.SetBinaryLimits(8, 4)
+	if err := d.Publish("/files", message.BinaryData("0123456789")); !errors.Is(err, ErrPayloadTooLarge) {
+		t.Fatalf("expecting ErrPayloadTooLarge got: %v", err)
+	}
+	if len(sentOn(ft, "/files")) != 0 {
+		t.Fatal("expecting nothing sent")
+	}
+
+	//the chunks received beyond the limit are dropped
+	errs := make(chan error, 10)
+	d.OnError(func(err error) {
+		errs <- err
+	})
+	for i := 0; i < 3; i++ {
+		m := &message.Message{Channel: "/files", Data: message.BinaryData("0123"), Id: "c"}
+		message.EncodeBinary(m, message.BinaryFrame{ID: "big", Index: i, Count: 3})
+		ft.deliver(m)
+	}
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrPayloadTooLarge) {
+			t.Fatalf("expecting ErrPayloadTooLarge got: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expecting the oversized payload reported")
+	}
+}
+
+//deliverChunk delivers the chunk index of the payload id, announced in count chunks
+func deliverChunk(ft *fakeTransport, id string, index, count int) {
+	m := &message.Message{Channel: "/files", Data: message.BinaryData("0123")}
+	message.EncodeBinary(m, message.BinaryFrame{ID: id, Index: index, Count: count})
+	ft.deliver(m)
+}
+
+func TestDispatcher_BinaryLostChunks(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	ft := &fakeTransport{reply: ackAll}
+	d := NewDispatcher("fake://", transport.Options{Clock: fake}, message.Extensions{})
+	d.SetTransport(ft)
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Disconnect()
+	sub, err := d.Subscribe("/files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []error
+	d.OnError(func(err error) {
+		errs = append(errs, err)
+	})
+
+	//the second chunks are lost
+	for i := 0; i < maxAssemblies; i++ {
+		deliverChunk(ft, "lost"+strconv.Itoa(i), 0, 2)
+	}
+	deliverChunk(ft, "next", 0, 2)
+	if len(errs) != 1 {
+		t.Fatalf("expecting the payload dropped while the others are in flight got: %v", errs)
+	}
+	//the incomplete payloads expire
+	fake.Advance(assemblyTimeout)
+	deliverChunk(ft, "next", 0, 2)
+	deliverChunk(ft, "next", 1, 2)
+	select {
+	case msg := <-sub.MsgChannel():
+		if data, _ := msg.Data.(message.BinaryData); string(data) != "01230123" {
+			t.Fatalf("expecting the payload delivered got: %v", msg.Data)
+		}
+	default:
+		t.Fatalf("expecting the payload delivered once the lost ones expired got: %v", errs)
+	}
+
+	//the payloads of the channels unsubscribed are dropped
+	deliverChunk(ft, "unsubscribed", 0, 2)
+	if err = sub.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	d.binaryMu.Lock()
+	assemblies := len(d.assemblies)
+	d.binaryMu.Unlock()
+	if assemblies != 0 {
+		t.Fatalf("expecting the payloads dropped got: %d", assemblies)
+	}
+}
+
+func TestDispatcher_BinaryChunkCount(t *testing.T) {
+	d, ft := newTestDispatcher(t, ackAll)
+	defer d.Disconnect()
+	if _, err := d.Subscribe("/files"); err != nil {
+		t.Fatal(err)
+	}
+	var errs []error
+	d.OnError(func(err error) {
+		errs = append(errs, err)
+	})
+	deliverChunk(ft, "huge", 0, 1<<30)
+	d.SetBinaryLimits(8, 0)
+	deliverChunk(ft, "large", 0, 9)
+	if len(errs) != 2 || !errors.Is(errs[0], ErrPayloadTooLarge) || !errors.Is(errs[1], ErrPayloadTooLarge) {
+		t.Fatalf("expecting the payloads rejected got: %v", errs)
+	}
+}
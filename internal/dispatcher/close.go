@@ -0,0 +1,95 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+//ErrClosing is returned by the publishes, subscribes, batches and requests attempted while Close runs
+var ErrClosing = errors.New("client is closing")
+
+//Close shuts the client down gracefully: the new publishes, subscribes, batches and requests fail with ErrClosing,
+//the scheduled ones too, the outgoing queue is drained, once reconnected if a reconnection is in flight, and the
+//publishes in flight acknowledged, the channels are unsubscribed, the server is informed with /meta/disconnect,
+//the connection is closed and the handlers running return. every step is bounded by ctx, the client is
+//disconnected anyway and ctx.Err() is returned if it is done first. called from a handler, it waits for the
+//handler to return until ctx is done.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	if d.terminated() == nil {
+		atomic.StoreInt32(&d.closing, 1)
+		d.clearSchedule(ErrClosing)
+	}
+	var errs []error
+	if !d.Connected() {
+		//the messages queued during a reconnection are sent once it completes
+		d.awaitQueue(ctx)
+	}
+	if d.Connected() {
+		d.drain(ctx)
+		errs = append(errs, d.unsubscribeAll(ctx))
+	}
+	errs = append(errs, d.DisconnectCtx(ctx))
+	errs = append(errs, d.awaitHandlers(ctx))
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return errors.Join(errs...)
+}
+
+//closingErr returns ErrClosing while Close runs, the operations attempted once it completed fail with ErrDisconnected
+func (d *Dispatcher) closingErr() error {
+	if atomic.LoadInt32(&d.closing) == 1 && d.terminated() == nil {
+		return ErrClosing
+	}
+	return nil
+}
+
+//drain waits until the outgoing queue is sent and the publishes in flight are acknowledged, or ctx is done
+func (d *Dispatcher) drain(ctx context.Context) {
+	d.awaitQueue(ctx)
+	d.flush(ctx)
+}
+
+//awaitQueue waits until the outgoing queue is sent, ctx is done or the client is disconnected
+func (d *Dispatcher) awaitQueue(ctx context.Context) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for d.Pending() > 0 && d.terminated() == nil {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+//unsubscribeAll removes the subscriptions, giving up waiting for the server when ctx is done
+func (d *Dispatcher) unsubscribeAll(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- d.UnsubscribePattern("/**")
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//awaitHandlers waits for the handlers of the subscriptions to return, see handle
+func (d *Dispatcher) awaitHandlers(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		d.handlers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,151 @@
+package dispatcher
+
+import (
+	"context"
+	"github.com/thesyncim/faye/channel"
+	"github.com/thesyncim/faye/message"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDispatcher_Close(t *testing.T) {
+	d, ft := newTestDispatcher(t, ackSubscriptions)
+	if err := d.SetChannelConfigs([]channel.Config{{Pattern: "/foo", BufferSize: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := d.Subscribe("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handling := make(chan struct{})
+	release := make(chan struct{})
+	d.HandleMessages(sub, func(channel string, data message.Data) {
+		close(handling)
+		<-release
+	})
+	ft.deliver(&message.Message{Channel: "/foo", Data: "1"})
+	<-handling
+
+	//the publish in flight is acknowledged before the channels are unsubscribed
+	ft.mu.Lock()
+	sent := len(ft.sent)
+	ft.mu.Unlock()
+	published := make(chan error, 1)
+	go func() {
+		published <- d.Publish("/foo", "2")
+	}()
+	waitSent(t, ft, sent+1)
+	publish := lastSent(ft)
+	closed := make(chan error, 1)
+	go func() {
+		closed <- d.Close(context.Background())
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if err = d.Publish("/foo", "3"); err != ErrClosing {
+		t.Fatalf("expecting ErrClosing got: %v", err)
+	}
+	if countChannel(ft, message.MetaUnsubscribe) != 0 {
+		t.Fatal("expecting the publish in flight awaited")
+	}
+	ft.deliver(&message.Message{Channel: "/foo", Id: publish.Id, Successful: true})
+	if err = <-published; err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case err = <-closed:
+		t.Fatalf("expecting Close to wait for the handler got: %v", err)
+	default:
+	}
+	close(release)
+	select {
+	case err = <-closed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expecting Close to return once the handler returned")
+	}
+	if countChannel(ft, message.MetaUnsubscribe) != 1 || countChannel(ft, message.MetaDisconnect) != 1 {
+		t.Fatal("expecting the channel unsubscribed and the server informed")
+	}
+	if err = d.Publish("/foo", "4"); err != ErrDisconnected {
+		t.Fatalf("expecting ErrDisconnected once closed got: %v", err)
+	}
+}
+
+func TestDispatcher_CloseCtx(t *testing.T) {
+	d, _ := newTestDispatcher(t, ackSubscriptions)
+	sub, err := d.Subscribe("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handling := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	d.HandleRawMessages(sub, func(msg *message.Message) {
+		close(handling)
+		<-release
+	})
+	if _, err = d.Schedule(time.Now().Add(time.Hour), func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	//the handler is blocked, only the deadline ends the wait
+	sub.MsgChannel() <- &message.Message{Channel: "/foo"}
+	<-handling
+	if err = d.Close(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expecting the deadline exceeded got: %v", err)
+	}
+	if d.terminated() != ErrDisconnected || d.Scheduled() != 0 {
+		t.Fatal("expecting the client disconnected anyway")
+	}
+}
+
+func TestDispatcher_CloseReconnecting(t *testing.T) {
+	d, ft, fake := reconnectingDispatcher(t, 1, QueueBlock)
+	results := make(chan string, 1)
+	queuePublish(d, "queued", 0, results)
+	for d.Pending() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	ft.mu.Lock()
+	sent := len(ft.sent)
+	ft.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	closed := make(chan error, 1)
+	go func() {
+		closed <- d.Close(ctx)
+	}()
+	for atomic.LoadInt32(&d.closing) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := d.Batch([]*BatchOp{{Channel: "/foo", Data: "batched"}}); err != ErrClosing {
+		t.Fatalf("expecting ErrClosing got: %v", err)
+	}
+	if _, err := d.Request(ctx, "/service/foo", "request"); err != ErrClosing {
+		t.Fatalf("expecting ErrClosing got: %v", err)
+	}
+
+	//the queued publish is sent once reconnected, before the server is informed
+	fake.Advance(time.Second)
+	select {
+	case published := <-results:
+		if published != "queued" {
+			t.Fatalf("expecting the queued publish sent got: %s", published)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expecting the queue drained")
+	}
+	<-closed
+	if published := publishedData(ft, sent); len(published) != 1 || published[0] != "queued" {
+		t.Fatalf("expecting the queued publish sent got: %v", published)
+	}
+	if countChannel(ft, message.MetaDisconnect) != 1 {
+		t.Fatal("expecting the server informed")
+	}
+}
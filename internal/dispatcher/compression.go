@@ -0,0 +1,117 @@
+package dispatcher
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/thesyncim/faye/compression"
+	"github.com/thesyncim/faye/message"
+)
+
+//compressionExt is the ext key negotiating the payload compression: the client lists the codecs it supports
+//on /meta/handshake, e.g. {"ext":{"compression":["gzip","deflate"]}}, and the server confirms the one to use
+//with {"ext":{"compression":"gzip"}}. the compressed messages carry the base64 encoded data and the codec name
+//in the same ext key.
+const compressionExt = "compression"
+
+//SetCompression sets the codecs advertised during the handshake, in order of preference
+func (d *Dispatcher) SetCompression(codecs []compression.Codec) {
+	d.compressionMu.Lock()
+	d.codecs = codecs
+	d.compressionMu.Unlock()
+}
+
+//Compression returns the codec negotiated with the server, nil if the messages are not compressed
+func (d *Dispatcher) Compression() compression.Codec {
+	d.compressionMu.Lock()
+	defer d.compressionMu.Unlock()
+	return d.codec
+}
+
+//advertiseCompression adds the supported codecs to the handshake message
+func (d *Dispatcher) advertiseCompression(m *message.Message) {
+	d.compressionMu.Lock()
+	defer d.compressionMu.Unlock()
+	if len(d.codecs) == 0 {
+		return
+	}
+	names := make([]string, len(d.codecs))
+	for i := range d.codecs {
+		names[i] = d.codecs[i].Name()
+	}
+	m.SetExt(compressionExt, names)
+}
+
+//handshakeCompression enables the codec confirmed by the server handshake response, if any
+func (d *Dispatcher) handshakeCompression(resp *message.Message) {
+	ext, _ := resp.Ext.(map[string]interface{})
+	name, _ := ext[compressionExt].(string)
+	d.compressionMu.Lock()
+	d.codec, _ = compression.Select(d.codecs, name)
+	d.compressionMu.Unlock()
+}
+
+//applyOut encodes the binary data of m, runs the outgoing extensions on it and compresses its data
+func (d *Dispatcher) applyOut(ctx context.Context, m *message.Message) error {
+	if !message.IsMetaMessage(m) {
+		encodeBinary(m)
+	}
+	if err := d.outgoing(ctx, m); err != nil {
+		return err
+	}
+	return d.compress(m)
+}
+
+//compress replaces the data of m with its compressed form when a codec was negotiated
+func (d *Dispatcher) compress(m *message.Message) error {
+	codec := d.Compression()
+	if codec == nil || m.Data == nil || message.IsMetaMessage(m) {
+		return nil
+	}
+	b, err := json.Marshal(m.Data)
+	if err != nil {
+		return err
+	}
+	if b, err = codec.Compress(b); err != nil {
+		return fmt.Errorf("compress: %w", err)
+	}
+	m.Data = base64.StdEncoding.EncodeToString(b)
+	m.SetExt(compressionExt, codec.Name())
+	return nil
+}
+
+//decompress restores the data of a message compressed by the server
+func (d *Dispatcher) decompress(m *message.Message) error {
+	ext, _ := m.Ext.(map[string]interface{})
+	name, ok := ext[compressionExt].(string)
+	if !ok || message.IsMetaMessage(m) {
+		return nil
+	}
+	d.compressionMu.Lock()
+	codec, ok := compression.Select(d.codecs, name)
+	d.compressionMu.Unlock()
+	if !ok {
+		return fmt.Errorf("decompress: unknown codec `%s`", name)
+	}
+	encoded, ok := m.Data.(string)
+	if !ok {
+		return fmt.Errorf("decompress: %s data must be a string", name)
+	}
+	b, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("decompress: %w", err)
+	}
+	if b, err = codec.Decompress(b); err != nil {
+		return fmt.Errorf("decompress: %w", err)
+	}
+	if m.Data, err = d.transportOpts.DecodeData(b); err != nil {
+		return fmt.Errorf("decompress: %w", err)
+	}
+	//the raw data kept by the parser is the compressed one
+	if m.RawData != nil {
+		m.RawData = b
+	}
+	delete(ext, compressionExt)
+	return nil
+}
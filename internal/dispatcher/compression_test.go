@@ -0,0 +1,137 @@
+package dispatcher
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/thesyncim/faye/channel"
+	"github.com/thesyncim/faye/compression"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"reflect"
+	"testing"
+	"time"
+)
+
+//compressedData returns the data of a message compressed with codec
+func compressedData(t *testing.T, codec compression.Codec, data message.Data) string {
+	b, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err = codec.Compress(b); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func newCompressionDispatcher(t *testing.T, confirmed string, reply func(ft *fakeTransport, m *message.Message)) (*Dispatcher, *fakeTransport, *[]interface{}) {
+	var advertised []interface{}
+	ft := &fakeTransport{
+		handshakeExt: map[string]interface{}{compressionExt: confirmed},
+		onHandshake: func(m *message.Message) {
+			ext, _ := m.Ext.(map[string]interface{})
+			for _, name := range ext[compressionExt].([]string) {
+				advertised = append(advertised, name)
+			}
+		},
+		reply: reply,
+	}
+	d := NewDispatcher("fake://", transport.Options{}, message.Extensions{})
+	d.SetTransport(ft)
+	d.SetCompression([]compression.Codec{compression.Gzip, compression.Deflate})
+	if err := d.SetChannelConfigs([]channel.Config{{Pattern: "/foo", BufferSize: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return d, ft, &advertised
+}
+
+func TestDispatcher_CompressionNegotiated(t *testing.T) {
+	var published message.Data
+	d, ft, advertised := newCompressionDispatcher(t, "deflate", func(ft *fakeTransport, m *message.Message) {
+		ackSubscriptions(ft, m)
+		if m.Channel == "/foo" {
+			published = m.Data
+			go ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Successful: true})
+		}
+	})
+	if !reflect.DeepEqual(*advertised, []interface{}{"gzip", "deflate"}) {
+		t.Fatalf("expecting the codecs advertised in order got: %v", *advertised)
+	}
+	if codec := d.Compression(); codec != compression.Deflate {
+		t.Fatalf("expecting deflate negotiated got: %v", codec)
+	}
+
+	if err := d.PublishWithTimeout("/foo", "bar", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if published != compressedData(t, compression.Deflate, "bar") {
+		t.Fatalf("expecting the data compressed got: %v", published)
+	}
+
+	sub, err := d.Subscribe("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ft.deliver(&message.Message{
+		Channel: "/foo",
+		Data:    compressedData(t, compression.Deflate, map[string]interface{}{"price": 42}),
+		Ext:     map[string]interface{}{compressionExt: "deflate"},
+	})
+	select {
+	case msg := <-sub.MsgChannel():
+		if !reflect.DeepEqual(msg.Data, map[string]interface{}{"price": float64(42)}) {
+			t.Fatalf("expecting the data decompressed got: %v", msg.Data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expecting the message delivered")
+	}
+}
+
+func TestDispatcher_CompressionNotConfirmed(t *testing.T) {
+	var published message.Data
+	d, _, _ := newCompressionDispatcher(t, "", func(ft *fakeTransport, m *message.Message) {
+		if m.Channel == "/foo" {
+			published = m.Data
+			go ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Successful: true})
+		}
+	})
+	if codec := d.Compression(); codec != nil {
+		t.Fatalf("expecting no codec got: %v", codec)
+	}
+	if err := d.PublishWithTimeout("/foo", "bar", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if published != "bar" {
+		t.Fatalf("expecting the data sent as is got: %v", published)
+	}
+}
+
+func TestDispatcher_CompressionMalformed(t *testing.T) {
+	d, ft, _ := newCompressionDispatcher(t, "gzip", ackSubscriptions)
+	errCh := make(chan error, 1)
+	d.OnError(func(err error) {
+		errCh <- err
+	})
+	sub, err := d.Subscribe("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ft.deliver(&message.Message{Channel: "/foo", Data: "not compressed", Ext: map[string]interface{}{compressionExt: "gzip"}})
+
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Fatal("expecting the decompression error")
+		}
+	default:
+		t.Fatal("expecting the decompression error reported")
+	}
+	select {
+	case msg := <-sub.MsgChannel():
+		t.Fatalf("expecting the message dropped got: %v", msg.Data)
+	default:
+	}
+}
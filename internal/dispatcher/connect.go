@@ -0,0 +1,64 @@
+package dispatcher
+
+import (
+	"errors"
+	"fmt"
+	"github.com/thesyncim/faye/clock"
+	"github.com/thesyncim/faye/internal/event"
+	"github.com/thesyncim/faye/message"
+	"sync/atomic"
+	"time"
+)
+
+//connectResponse handles the response to an automatic /meta/connect: failures are reported to the error
+//handlers and the next connect is sent after the advised interval. the reconnect and handshake advice
+//are handled by onAdvice, an expired token by onTokenExpired.
+func (d *Dispatcher) connectResponse(msg *message.Message) {
+	if !msg.Successful {
+		err := msg.GetError()
+		if err == nil {
+			err = errors.New("connect failed")
+		}
+		d.events.Publish(event.Event{Type: event.Error, Err: fmt.Errorf("connect: %w", err), Message: msg})
+	}
+	advice := d.Advice()
+	if advice != nil && advice.Reconnect == message.ReconnectHandshake || tokenExpired(msg) {
+		return
+	}
+	interval, _ := d.transportOpts.PollTiming(advice)
+	if advice != nil && advice.MultipleClients {
+		if d.rehandshakeMultipleClients() {
+			return
+		}
+		interval = d.multipleClientsBackoff(interval)
+	}
+	d.scheduleConnect(interval)
+}
+
+//staleConnect reports whether msg responds to a /meta/connect other than the last one sent, e.g. held by the server
+//across a reconnect. acting on it would run a second connect loop. the responses without id are taken as current.
+func (d *Dispatcher) staleConnect(msg *message.Message) bool {
+	id, _ := d.connectID.Load().(string)
+	return msg.Id != "" && msg.Id != id
+}
+
+//clock returns the clock driving the timers, see transport.Options.Clock
+func (d *Dispatcher) clock() clock.Clock {
+	return clock.Or(d.transportOpts.Clock)
+}
+
+//scheduleConnect sends the next /meta/connect after interval, unless the application drives the connection
+//or the client terminated meanwhile
+func (d *Dispatcher) scheduleConnect(interval time.Duration) {
+	if d.manualConnect {
+		return
+	}
+	d.clock().AfterFunc(interval, func() {
+		if d.terminated() != nil || atomic.LoadInt32(&d.disconnecting) == 1 {
+			return
+		}
+		if err := d.transport.Connect(d.connectMessage()); err != nil {
+			d.events.Publish(event.Event{Type: event.Error, Err: fmt.Errorf("connect: %w", err)})
+		}
+	})
+}
@@ -0,0 +1,210 @@
+package dispatcher
+
+import (
+	"errors"
+	"github.com/thesyncim/faye/clock"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDispatcher_ConnectLoop(t *testing.T) {
+	var responses int32
+	d, ft := newTestDispatcher(t, func(ft *fakeTransport, m *message.Message) {
+		if m.Channel == message.MetaConnect && atomic.AddInt32(&responses, 1) <= 3 {
+			advice := &message.Advise{Reconnect: message.ReconnectRetry, Interval: time.Millisecond}
+			go ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Successful: true, Advice: advice})
+		}
+	})
+	//the connect sent by Start and one after every response
+	waitSent(t, ft, 4)
+	if d.terminated() != nil {
+		t.Fatal("expecting the client connected")
+	}
+}
+
+func TestDispatcher_ConnectInterval(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	ft := &fakeTransport{reply: func(ft *fakeTransport, m *message.Message) {
+		if m.Channel == message.MetaConnect {
+			advice := &message.Advise{Reconnect: message.ReconnectRetry, Interval: 30 * time.Second, Timeout: time.Minute}
+			go ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Successful: true, Advice: advice})
+		}
+	}}
+	d := NewDispatcher("fake://", transport.Options{Clock: fake}, message.Extensions{})
+	d.SetTransport(ft)
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	//the next connect waits for the advised interval
+	for fake.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	fake.Advance(29 * time.Second)
+	if n := countChannel(ft, message.MetaConnect); n != 1 {
+		t.Fatalf("expecting a single connect before the interval got: %d", n)
+	}
+	fake.Advance(time.Second)
+	waitSent(t, ft, 2)
+	if last := lastSent(ft); last.Channel != message.MetaConnect {
+		t.Fatalf("expecting another connect got: %s", last.Channel)
+	}
+}
+
+func countChannel(ft *fakeTransport, channel string) int {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	n := 0
+	for _, m := range ft.sent {
+		if m.Channel == channel {
+			n++
+		}
+	}
+	return n
+}
+
+func TestDispatcher_ConnectRehandshake(t *testing.T) {
+	var handshakes, connects int32
+	ft := &fakeTransport{
+		onHandshake: func(m *message.Message) {
+			atomic.AddInt32(&handshakes, 1)
+		},
+		reply: func(ft *fakeTransport, m *message.Message) {
+			if m.Channel == message.MetaConnect && atomic.AddInt32(&connects, 1) == 1 {
+				advice := &message.Advise{Reconnect: message.ReconnectHandshake}
+				go ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Error: "402::unknown client", Advice: advice})
+			}
+		},
+	}
+	d := NewDispatcher("fake://", transport.Options{RetryInterval: time.Millisecond}, message.Extensions{})
+	d.SetTransport(ft)
+	errCh := make(chan error, 1)
+	d.OnError(func(err error) {
+		select {
+		case errCh <- err:
+		default:
+		}
+	})
+	attempts := make(chan ReconnectAttempt, 1)
+	d.OnReconnectAttempt(func(attempt ReconnectAttempt) {
+		select {
+		case attempts <- attempt:
+		default:
+		}
+	})
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-errCh:
+		if !strings.Contains(err.Error(), "402::unknown client") {
+			t.Fatalf("expecting the connect error got: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expecting the connect failure to be reported")
+	}
+	select {
+	case attempt := <-attempts:
+		if !errors.Is(attempt.Err, ErrRehandshake) {
+			t.Fatalf("expecting %v got: %v", ErrRehandshake, attempt.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expecting a reconnect attempt")
+	}
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&handshakes) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("expecting a new handshake")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDispatcher_MultipleClients(t *testing.T) {
+	var tests = []struct {
+		name        string
+		rehandshake bool
+		handshakes  int32
+	}{
+		{name: "backoff", rehandshake: false, handshakes: 1},
+		{name: "rehandshake", rehandshake: true, handshakes: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var handshakes, connects int32
+			ft := &fakeTransport{
+				onHandshake: func(m *message.Message) {
+					atomic.AddInt32(&handshakes, 1)
+				},
+				reply: func(ft *fakeTransport, m *message.Message) {
+					if m.Channel == message.MetaConnect && atomic.AddInt32(&connects, 1) == 1 {
+						advice := &message.Advise{Reconnect: message.ReconnectRetry, MultipleClients: true}
+						go ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Successful: true, Advice: advice})
+					}
+				},
+			}
+			d := NewDispatcher("fake://", transport.Options{RetryInterval: 50 * time.Millisecond}, message.Extensions{})
+			d.SetTransport(ft)
+			d.SetMultipleClientsRehandshake(tt.rehandshake)
+			notified := make(chan *message.Advise, 1)
+			d.OnMultipleClients(func(advice *message.Advise) {
+				notified <- advice
+			})
+			if err := d.Start(); err != nil {
+				t.Fatal(err)
+			}
+
+			var at time.Time
+			select {
+			case advice := <-notified:
+				at = time.Now()
+				if !advice.MultipleClients {
+					t.Fatal("expecting the multiple-clients advice")
+				}
+			case <-time.After(time.Second):
+				t.Fatal("expecting the multiple clients handler called")
+			}
+			//the next connect waits at least the retry interval
+			waitSent(t, ft, 2)
+			if elapsed := time.Since(at); elapsed < 40*time.Millisecond {
+				t.Fatalf("expecting the connect delayed got: %v", elapsed)
+			}
+			if got := atomic.LoadInt32(&handshakes); got != tt.handshakes {
+				t.Fatalf("expecting %d handshakes got: %d", tt.handshakes, got)
+			}
+		})
+	}
+}
+
+func TestDispatcher_StaleConnectResponse(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	ft := &fakeTransport{}
+	d := NewDispatcher("fake://", transport.Options{Clock: fake}, message.Extensions{})
+	d.SetTransport(ft)
+	errs := make(chan error, 1)
+	d.OnError(func(err error) {
+		errs <- err
+	})
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	connect := lastSent(ft)
+
+	//the response to a connect of the previous session doesn't start another connect loop
+	ft.deliver(&message.Message{Channel: message.MetaConnect, Id: "stale", Successful: true})
+	if err := <-errs; !errors.Is(err, ErrUnexpectedMessage) {
+		t.Fatalf("expecting ErrUnexpectedMessage got: %v", err)
+	}
+	if fake.Timers() != 0 {
+		t.Fatal("expecting no connect scheduled")
+	}
+	ft.deliver(&message.Message{Channel: message.MetaConnect, Id: connect.Id, Successful: true})
+	if fake.Timers() != 1 {
+		t.Fatal("expecting the next connect scheduled")
+	}
+}
@@ -0,0 +1,71 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/thesyncim/faye/credentials"
+	"github.com/thesyncim/faye/message"
+	"net/http"
+	"strings"
+)
+
+//ErrTokenExpired is the cause of the reconnect when the server responds 401::token expired: the client
+//handshakes again, with a new token, unless the application drives the connection
+var ErrTokenExpired = errors.New("server reported the token expired")
+
+//SetCredentials sends the token of p as a bearer Authorization header of the connections and polling requests,
+//next to the headers of Options.HeaderFunc. the token is requested before every handshake, including the one
+//following a 401::token expired response, see ErrTokenExpired. it must be called before Start.
+func (d *Dispatcher) SetCredentials(p credentials.Provider) {
+	d.credentials = p
+	if p == nil {
+		return
+	}
+	headerFunc := d.transportOpts.HeaderFunc
+	d.transportOpts.HeaderFunc = func() (http.Header, error) {
+		headers := http.Header{}
+		if headerFunc != nil {
+			h, err := headerFunc()
+			if err != nil {
+				return nil, err
+			}
+			headers = h.Clone()
+		}
+		if token, _ := d.token.Load().(string); token != "" {
+			headers.Set("Authorization", "Bearer "+token)
+		}
+		return headers, nil
+	}
+}
+
+//refreshCredentials requests a new token from the credentials provider, before dialing for a handshake
+func (d *Dispatcher) refreshCredentials(ctx context.Context) error {
+	if d.credentials == nil {
+		return nil
+	}
+	token, err := d.credentials.Token(ctx)
+	if err != nil {
+		return fmt.Errorf("credentials: %w", err)
+	}
+	d.token.Store(token)
+	return nil
+}
+
+//tokenExpired reports whether the server rejected msg because the token expired
+func tokenExpired(msg *message.Message) bool {
+	if msg.Error == "" {
+		return false
+	}
+	e := message.ParseError(msg.Error)
+	return e.Code == 401 && strings.EqualFold(strings.TrimSpace(e.Description), "token expired")
+}
+
+//onTokenExpired handshakes again when the server reports the token expired, the handshake gets a new token
+//from the credentials provider, the Options.HeaderFunc or the extensions
+func (d *Dispatcher) onTokenExpired(msg *message.Message) {
+	if !tokenExpired(msg) || d.manualConnect || d.terminated() != nil {
+		return
+	}
+	go d.reconnect(ErrTokenExpired)
+}
@@ -0,0 +1,91 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/thesyncim/faye/credentials"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDispatcher_Credentials(t *testing.T) {
+	var calls int32
+	provider := credentials.Func(func(ctx context.Context) (string, error) {
+		return fmt.Sprintf("token-%d", atomic.AddInt32(&calls, 1)), nil
+	})
+	opts := transport.Options{
+		RetryInterval: time.Millisecond,
+		HeaderFunc: func() (http.Header, error) {
+			return http.Header{"X-Client": {"test"}}, nil
+		},
+	}
+	d := NewDispatcher("fake://", opts, message.Extensions{})
+	handshakes := make(chan http.Header, 2)
+	ft := &fakeTransport{onHandshake: func(m *message.Message) {
+		headers, err := d.transportOpts.HeaderFunc()
+		if err != nil {
+			t.Error(err)
+		}
+		handshakes <- headers
+	}}
+	d.SetTransport(ft)
+	d.SetCredentials(provider)
+	var causes []error
+	d.OnReconnectAttempt(func(attempt ReconnectAttempt) {
+		causes = append(causes, attempt.Err)
+	})
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if headers := <-handshakes; headers.Get("Authorization") != "Bearer token-1" || headers.Get("X-Client") != "test" {
+		t.Fatalf("expecting the token next to the headers got: %v", headers)
+	}
+
+	ft.deliver(&message.Message{Channel: message.MetaConnect, Error: "401::token expired"})
+	select {
+	case headers := <-handshakes:
+		if headers.Get("Authorization") != "Bearer token-2" {
+			t.Fatalf("expecting the token refreshed got: %v", headers)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expecting the client to handshake again")
+	}
+	if len(causes) != 1 || !errors.Is(causes[0], ErrTokenExpired) {
+		t.Fatalf("expecting the reconnect caused by ErrTokenExpired got: %v", causes)
+	}
+}
+
+func TestDispatcher_CredentialsError(t *testing.T) {
+	d := NewDispatcher("fake://", transport.Options{}, message.Extensions{})
+	d.SetTransport(&fakeTransport{})
+	unavailable := errors.New("token endpoint unavailable")
+	d.SetCredentials(credentials.Func(func(ctx context.Context) (string, error) {
+		return "", unavailable
+	}))
+	if err := d.Start(); !errors.Is(err, unavailable) {
+		t.Fatalf("expecting the credentials error got: %v", err)
+	}
+}
+
+func TestTokenExpired(t *testing.T) {
+	var tests = []struct {
+		err      string
+		expected bool
+	}{
+		{"401::token expired", true},
+		{"401::Token Expired", true},
+		{"401::unknown client", false},
+		{"403::token expired", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := tokenExpired(&message.Message{Error: tt.err}); got != tt.expected {
+			t.Fatalf("%s: expecting %v got: %v", tt.err, tt.expected, got)
+		}
+	}
+}
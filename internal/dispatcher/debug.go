@@ -0,0 +1,84 @@
+package dispatcher
+
+import (
+	"github.com/thesyncim/faye/internal/event"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/subscription"
+	"time"
+)
+
+//debugErrors is the number of errors kept for the snapshots, see Snapshot.Errors
+const debugErrors = 16
+
+//Snapshot is the state of the client internals at a point in time, for debugging, see DebugSnapshot
+type Snapshot struct {
+	//Taken is when the snapshot was taken
+	Taken time.Time
+	//State is the state of the session
+	State State
+	Session SessionInfo
+	//Advice is the last advice of the server, nil if none was received
+	Advice *message.Advise
+	//Subscriptions are the subscriptions, oldest first
+	Subscriptions []subscription.Info
+	//PendingSubscribes, PendingPublishes and PendingRequests count the meta and raw messages, the publishes and
+	//the requests sent and waiting for the server response
+	PendingSubscribes int
+	PendingPublishes  int
+	PendingRequests   int
+	//Queued is the number of operations queued until the connection is restored, see SetQueue
+	Queued int
+	//Scheduled is the number of operations held until their deadline, see Schedule
+	Scheduled int
+	//Errors are the last errors reported to the error handlers, oldest first
+	Errors []ErrorRecord
+}
+
+//ErrorRecord is an error reported to the error handlers
+type ErrorRecord struct {
+	Time  time.Time
+	Error string
+	//Channel is the channel the error relates to, if any
+	Channel string
+}
+
+//recordError keeps the last errors for the snapshots
+func (d *Dispatcher) recordError(e event.Event) {
+	d.errorsMu.Lock()
+	if len(d.errors) == debugErrors {
+		copy(d.errors, d.errors[1:])
+		d.errors = d.errors[:debugErrors-1]
+	}
+	d.errors = append(d.errors, ErrorRecord{Time: e.Time, Error: e.Err.Error(), Channel: e.Channel})
+	d.errorsMu.Unlock()
+}
+
+//DebugSnapshot returns the state of the client internals, e.g. to diagnose a stuck subscription. it is safe for
+//concurrent use, the counts are taken one after the other and may be slightly inconsistent.
+func (d *Dispatcher) DebugSnapshot() Snapshot {
+	s := Snapshot{
+		Taken:         time.Now(),
+		State:         d.State(),
+		Session:       d.Session(),
+		Advice:        d.Advice(),
+		Subscriptions: d.Subscriptions(),
+		Queued:        d.Pending(),
+		Scheduled:     d.Scheduled(),
+	}
+	d.pendingSubsMu.Lock()
+	s.PendingSubscribes = len(d.pendingSubs)
+	d.pendingSubsMu.Unlock()
+	d.publishACKmu.Lock()
+	s.PendingPublishes = len(d.publishACK)
+	d.publishACKmu.Unlock()
+	d.rawMu.Lock()
+	s.PendingRequests = len(d.rawPending)
+	d.rawMu.Unlock()
+	d.requestMu.Lock()
+	s.PendingRequests += len(d.requests)
+	d.requestMu.Unlock()
+	d.errorsMu.Lock()
+	s.Errors = append([]ErrorRecord(nil), d.errors...)
+	d.errorsMu.Unlock()
+	return s
+}
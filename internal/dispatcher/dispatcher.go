@@ -1,15 +1,67 @@
 package dispatcher
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/thesyncim/faye/backoff"
+	"github.com/thesyncim/faye/balancer"
+	"github.com/thesyncim/faye/channel"
+	"github.com/thesyncim/faye/clock"
+	"github.com/thesyncim/faye/compression"
+	"github.com/thesyncim/faye/credentials"
+	"github.com/thesyncim/faye/idgen"
+	"github.com/thesyncim/faye/internal/discovery"
+	"github.com/thesyncim/faye/internal/event"
 	"github.com/thesyncim/faye/internal/store"
+	"github.com/thesyncim/faye/internal/version"
 	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/metrics"
 	"github.com/thesyncim/faye/subscription"
 	"github.com/thesyncim/faye/transport"
-	"log"
-	"strconv"
+	"log/slog"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
+)
+
+//ErrAckTimeout is returned when the server does not acknowledge a publish within the requested timeout
+var ErrAckTimeout error = &kindError{msg: "publish acknowledgement timeout", kind: ErrTimeout}
+
+//ErrReconnectNone is returned by any operation once the server advised reconnect none,
+//the client is terminally disconnected and must not retry or handshake again.
+var ErrReconnectNone error = &kindError{msg: "server advised reconnect none, client disconnected", kind: ErrConnectionClosed}
+
+//ErrHandshakeFailed is returned when the server rejects the handshake without an error description
+var ErrHandshakeFailed error = &kindError{msg: "handshake failed", kind: ErrHandshakeDenied}
+
+//ErrUnexpectedMessage is reported to the error handlers when the server sends a message the client can't relate
+//to any request, e.g. a subscribe response to an unknown subscription. the message is discarded.
+var ErrUnexpectedMessage = errors.New("unexpected message from server")
+
+//ErrServerDisconnect is the cause of the reconnect, or the error reported when the application drives
+//the connection, when the server disconnects the client without being asked to
+var ErrServerDisconnect = errors.New("disconnected by the server")
+
+//ErrNoEndpoint is returned when the client has no endpoint to connect to
+var ErrNoEndpoint = errors.New("no endpoint")
+
+//ErrDisconnected is returned by the operations attempted after Disconnect
+var ErrDisconnected error = &kindError{msg: "client disconnected", kind: ErrConnectionClosed}
+
+//ErrUnsubscribeTimeout is returned when the server doesn't confirm an unsubscribe in time, see SetUnsubscribeTimeout.
+//the subscription is removed locally anyway.
+var ErrUnsubscribeTimeout error = &kindError{msg: "unsubscribe confirmation timeout", kind: ErrTimeout}
+
+const (
+	//disconnectTimeout bounds the wait for the publishes in flight and the disconnect response
+	disconnectTimeout = 5 * time.Second
+	//defaultUnsubscribeTimeout bounds the wait for the unsubscribe responses, see SetUnsubscribeTimeout
+	defaultUnsubscribeTimeout = 10 * time.Second
+	//flushInterval is the interval Disconnect checks the publishes in flight at
+	flushInterval = 10 * time.Millisecond
 )
 
 type Dispatcher struct {
@@ -18,87 +70,814 @@ type Dispatcher struct {
 	transport     transport.Transport
 	transportOpts transport.Options
 
-	msgID *uint64
+	//ids generates the message ids, see SetIDGenerator
+	ids idgen.Generator
 
-	extensions message.Extensions
+	//credentials provides the token sent in the Authorization header, refreshed before every handshake.
+	//see SetCredentials
+	credentials credentials.Provider
+	token       atomic.Value //type string
+
+	//pipeline runs the extensions provided to NewDispatcher, then the ones added with AddExtension
+	pipeline message.Pipeline
 
 	//map requestID
 	pendingSubs   map[string]chan error //todo wrap in structure
 	pendingSubsMu sync.Mutex
-	store         *store.SubscriptionsStore
+	//subscribing holds the channels with a subscribe in flight and the confirmations of the subscribes
+	//coalesced with it, guarded by pendingSubsMu
+	subscribing map[string][]chan error
+
+	store *store.SubscriptionsStore
 
 	publishACKmu sync.Mutex
 	publishACK   map[string]chan error
 
-	clientID string
+	//workers bounds the handlers running at the same time, nil doesn't bound them. see SetWorkers
+	workers chan struct{}
+
+	//requests are the service requests waiting for their reply, see Request
+	requestMu sync.Mutex
+	requests  map[string]chan *message.Message
+
+	advice atomic.Value //type *message.Advise
+
+	//terminalErr is set once the client can't be used anymore, terminal is closed then
+	terminalMu  sync.Mutex
+	terminalErr error
+	terminal    chan struct{}
+
+	events *event.Bus
+	//errors are the last errors reported, see DebugSnapshot
+	errorsMu sync.Mutex
+	errors   []ErrorRecord
+
+	qosMu              sync.Mutex
+	channelConfigs     []channel.Config
+	channelConfigCache map[string]channel.Config
+	dedup              map[*subscription.Subscription]*idWindow
+	//slowThreshold is how long a queue stays full before its subscription is reported, see SetSlowConsumerThreshold
+	slowThreshold time.Duration
+	fullQueues    map[*subscription.Subscription]*fullQueue
+
+	//paused are the channels unsubscribed on the server while their subscriptions are paused, see pauseOnServer
+	pauseMu sync.Mutex
+	paused  map[string]bool
+
+	replayMu      sync.Mutex
+	replaySize    int
+	replayCapable bool
+	replay        map[string]*replayBuffer
+
+	rawMu      sync.Mutex
+	rawPending map[string]chan *message.Message
+
+	//queue holds the messages sent while the connection is restored, see SetQueue
+	queueMu      sync.Mutex
+	queue        []*queuedMessage
+	queueSize    int
+	queuePolicy  QueuePolicy
+	queueDrained chan struct{}
+
+	//manualConnect disables the automatic /meta/connect, the application polls with Connect
+	manualConnect bool
+	//balancer picks the endpoint when set, release returns the connection to it
+	balancer  *balancer.Balancer
+	releaseMu sync.Mutex
+	release   func()
+	//dialed is the endpoint the transport is initialized with, guarded by releaseMu
+	dialed string
+	//failover are the endpoints tried after endpoint, see SetFailoverEndpoints
+	failover []string
+
+	//metrics receives the measures of the client, see SetMetrics
+	metrics metrics.Collector
+	//serverInfo is the *ServerInfo of the last handshake response
+	serverInfo atomic.Value
+	//logger logs the activity of the client when set, see SetLogger
+	logger *slog.Logger
+	//retryPolicy paces the reconnect attempts, see SetRetryPolicy
+	retryPolicy backoff.Policy
+	//resubscribePolicy applies to the subscriptions rejected when restored, see SetResubscribePolicy
+	resubscribePolicy subscription.ResubscribePolicy
+	//schedule holds the operations of Schedule, scheduleTimer is armed for the earliest deadline
+	scheduleMu    sync.Mutex
+	schedule      schedule
+	scheduleTimer clock.Timer
+	//reconnecting is set while the reconnect loop runs, reconnectDone is closed when it ends
+	reconnecting  int32
+	reconnectMu   sync.Mutex
+	reconnectDone chan struct{}
+	//disconnecting is set by Disconnect, the /meta/disconnect messages received afterwards are expected
+	disconnecting int32
+	//closing is set by Close, the new operations fail with ErrClosing
+	closing int32
+	//handlers counts the handlers of the subscriptions running, see handle
+	handlers sync.WaitGroup
+	//state is the State of the session, see setState
+	state int32
+
+	//prefix namespaces the application channels on the server, see SetChannelPrefix
+	prefix string
+	//connectTimeout is sent as advice on /meta/connect when set, asking the server for a different hold timeout
+	connectTimeout *time.Duration
+	//unsubscribeTimeout bounds the wait for the unsubscribe responses, zero waits forever
+	unsubscribeTimeout time.Duration
+	//multipleClientsRehandshake handshakes again for a new clientId on multiple-clients advice
+	multipleClientsRehandshake bool
+
+	//interceptors inspect the outgoing messages, see InterceptOutgoing
+	interceptMu  sync.RWMutex
+	interceptors []Interceptor
+
+	//codecs are advertised during the handshake, codec is the one confirmed by the server
+	compressionMu sync.Mutex
+	codecs        []compression.Codec
+	codec         compression.Codec
+
+	//publishTimeout and publishRetries bound the acknowledgements of PublishWithAck, see SetPublishTimeout
+	publishTimeout time.Duration
+	publishRetries int
+
+	//suspended is set while the session is suspended, see Suspend. lastActive is the time of the last activity
+	//in unix nanoseconds, the idle timer suspends the session once it is older than idleTimeout
+	suspendMu    sync.Mutex
+	suspended    int32
+	idleTimeout  time.Duration
+	wakeInterval time.Duration
+	lastActive   int64
+	idleTimer    clock.Timer
+	wakeTimer    clock.Timer
+
+	//handshaked is the time of the last successful handshake in unix nanoseconds, reconnects counts the
+	//connections restored, see Session
+	handshaked int64
+	reconnects int64
+
+	//ackEnabled asks for the acknowledged messages extension, ackNegotiated is set once the server confirmed it
+	//and ackBatch is the last batch number received, see SetAckExtension
+	ackMu         sync.Mutex
+	ackEnabled    bool
+	ackNegotiated bool
+	ackBatch      int64
+
+	//handshakeTimeout, subscribeTimeout and requestTimeout bound the meta operations, see SetRequestTimeout
+	handshakeTimeout time.Duration
+	subscribeTimeout time.Duration
+	requestTimeout   time.Duration
+
+	//maxBinarySize and chunkSize bound the binary payloads, assemblies gathers their chunks, see SetBinaryLimits
+	binaryMu      sync.Mutex
+	maxBinarySize int
+	chunkSize     int
+	assemblies    map[string]*assembly
+
+	//limiter paces the outgoing messages when set, see SetRateLimit
+	limiter *rateLimiter
+
+	//stateChanged schedules a save of the state, see SetStateStore
+	stateChanged chan struct{}
+	//connectID is the id of the last /meta/connect sent, the responses to the previous ones are stale
+	connectID atomic.Value //type string
 }
 
 func NewDispatcher(endpoint string, tOpts transport.Options, ext message.Extensions) *Dispatcher {
-	var msgID uint64
-	return &Dispatcher{
+	d := &Dispatcher{
 		endpoint:      endpoint,
-		msgID:         &msgID,
+		ids:           &idgen.Counter{},
 		store:         store.NewStore(100),
 		transportOpts: tOpts,
-		extensions:    ext,
 		publishACK:    map[string]chan error{},
+		requests:      map[string]chan *message.Message{},
 		pendingSubs:   map[string]chan error{},
+		subscribing:   map[string][]chan error{},
+		events:        event.NewBus(),
+		dedup:         map[*subscription.Subscription]*idWindow{},
+		fullQueues:    map[*subscription.Subscription]*fullQueue{},
+		paused:        map[string]bool{},
+		rawPending:    map[string]chan *message.Message{},
+		assemblies:    map[string]*assembly{},
+		metrics:       metrics.Nop{},
+		stateChanged:  make(chan struct{}, 1),
+		terminal:      make(chan struct{}),
+
+		unsubscribeTimeout: defaultUnsubscribeTimeout,
+	}
+	d.events.Subscribe(event.Advice, d.onAdvice)
+	d.events.Subscribe(event.TransportDown, d.onTransportDown)
+	d.events.Subscribe(event.Error, d.recordError)
+	d.store.OnChange(d.subscriptionsChanged)
+	for _, pipe := range ext.Pipes() {
+		d.pipeline.Add(pipe)
 	}
+	return d
 }
 
+//Start dials the server, handshakes and connects, without waiting for the connect response
 //todo allow multiple transports
-func (d *Dispatcher) Connect() error {
-	var err error
-	if err = d.transport.Init(d.endpoint, &d.transportOpts); err != nil {
+func (d *Dispatcher) Start() error {
+	d.setState(StateConnecting)
+	if _, err := d.dialHandshake(context.Background()); err != nil {
+		d.handshakeFailed()
 		return err
 	}
+	d.watchIdle()
+	if d.manualConnect {
+		return nil
+	}
+	return d.transport.Connect(d.connectMessage())
+}
 
-	if err = d.metaHandshake(); err != nil {
+//Abort gives up the client after Start failed with err: the session the server accepted, if any, is
+//disconnected, the transport is closed and the dispatcher terminated with err
+func (d *Dispatcher) Abort(err error) {
+	if d.terminated() != nil {
+		return
+	}
+	atomic.StoreInt32(&d.disconnecting, 1)
+	closer, closable := d.closer()
+	if d.transport.ClientID() != "" {
+		//e.g. the first /meta/connect failed, don't leave the session behind
+		ctx, cancel := context.WithTimeout(context.Background(), d.disconnectWait())
+		m := &message.Message{
+			Channel:  message.MetaDisconnect,
+			ClientId: d.transport.ClientID(),
+			Id:       d.nextMsgID(),
+		}
+		if closable {
+			d.sendDisconnect(ctx, m)
+		} else {
+			transport.DisconnectCtx(ctx, d.transport, m)
+		}
+		cancel()
+	}
+	if closable {
+		closer.Close()
+	}
+	d.releaseEndpoint()
+	d.terminate(err)
+}
+
+//SetManualConnect disables the automatic /meta/connect, the connection is driven by calling Connect
+func (d *Dispatcher) SetManualConnect(manual bool) {
+	d.manualConnect = manual
+}
+
+//Handshake dials the server and negotiates the connection, returning the server handshake response
+func (d *Dispatcher) Handshake(ctx context.Context) (*message.Message, error) {
+	var resp *message.Message
+	d.setState(StateConnecting)
+	err := withContext(ctx, func() (err error) {
+		resp, err = d.dialHandshake(ctx)
 		return err
+	})
+	if err != nil {
+		if d.logger != nil {
+			d.logger.Warn("handshake failed", slog.String("endpoint", d.endpoint), slog.Any("error", err))
+		}
+		d.handshakeFailed()
+		return nil, err
 	}
-	return d.metaConnect()
+	return resp, nil
 }
 
-func (d *Dispatcher) metaHandshake() error {
-	m := &message.Message{
-		Channel:                  message.MetaHandshake,
-		Version:                  "1.0",                        //todo const
-		SupportedConnectionTypes: []string{d.transport.Name()}, //todo list all tranports
+//handshakeFailed moves the session back to unconnected after a failed Start or Handshake, unless it is reconnecting
+func (d *Dispatcher) handshakeFailed() {
+	if atomic.LoadInt32(&d.reconnecting) == 0 {
+		d.setState(StateUnconnected)
 	}
-	d.extensions.ApplyOutExtensions(m)
-	handshakeResp, err := d.transport.Handshake(m)
+}
+
+//Connect establishes the connection after a successful Handshake and waits for the connect response, the next
+//connects are sent automatically unless SetManualConnect is set
+func (d *Dispatcher) Connect(ctx context.Context) (*message.Message, error) {
+	if err := d.terminated(); err != nil {
+		return nil, err
+	}
+	m := d.connectMessage()
+	respCh := d.awaitResponse(m.Id)
+	if err := transport.ConnectCtx(ctx, d.transport, m); err != nil {
+		d.cancelResponse(m.Id)
+		return nil, err
+	}
+	select {
+	case resp, ok := <-respCh:
+		if !ok {
+			return nil, d.terminated()
+		}
+		if !resp.Successful {
+			return resp, resp.GetError()
+		}
+		if !d.manualConnect {
+			//the waiter took the response from routeMessage, keep the connect cycle going
+			d.connectResponse(resp)
+		}
+		return resp, nil
+	case <-ctx.Done():
+		d.cancelResponse(m.Id)
+		return nil, ctx.Err()
+	}
+}
+
+//dialHandshake initializes the transport and handshakes, failing over to the next endpoint until one is
+//reachable and accepts the handshake
+func (d *Dispatcher) dialHandshake(ctx context.Context) (resp *message.Message, err error) {
+	endpoints, err := d.endpoints()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if err = d.refreshCredentials(ctx); err != nil {
+		return nil, err
+	}
+	for i := range endpoints {
+		if err = d.dialEndpoint(endpoints[i]); err != nil {
+			continue
+		}
+		resp, err = d.metaHandshake(ctx)
+		if err == nil || ctx.Err() != nil || d.terminated() != nil {
+			return resp, err
+		}
 	}
-	d.extensions.ApplyInExtensions(handshakeResp)
-	if handshakeResp.GetError() != nil {
+	return nil, err
+}
+
+//SetFailoverEndpoints sets the endpoints tried in order after the endpoint of the dispatcher, when it is
+//unreachable or rejects the handshake. they are ignored when a balancer is set.
+func (d *Dispatcher) SetFailoverEndpoints(endpoints []string) {
+	d.failover = endpoints
+}
+
+//dialEndpoint initializes the transport connected to the endpoint
+func (d *Dispatcher) dialEndpoint(endpoint string) error {
+	if err := d.transport.Init(endpoint, &d.transportOpts); err != nil {
 		return err
 	}
-	d.clientID = handshakeResp.ClientId
+	d.releaseMu.Lock()
+	d.dialed = endpoint
+	d.releaseMu.Unlock()
+	atomic.StoreInt32(&d.disconnecting, 0)
+	d.acquire(endpoint)
 	return nil
 }
 
-func (d *Dispatcher) metaConnect() error {
+//SetBalancer makes the dispatcher pick the endpoint from the balancer instead of its endpoint
+func (d *Dispatcher) SetBalancer(b *balancer.Balancer) {
+	d.balancer = b
+}
+
+//acquire reports the connection to the endpoint to the balancer, releasing the previous one
+func (d *Dispatcher) acquire(endpoint string) {
+	if d.balancer == nil {
+		return
+	}
+	release := d.balancer.Acquire(endpoint)
+	d.releaseMu.Lock()
+	previous := d.release
+	d.release = release
+	d.releaseMu.Unlock()
+	if previous != nil {
+		previous()
+	}
+}
+
+//releaseEndpoint reports to the balancer that the client is no longer connected
+func (d *Dispatcher) releaseEndpoint() {
+	d.releaseMu.Lock()
+	release := d.release
+	d.release = nil
+	d.releaseMu.Unlock()
+	if release != nil {
+		release()
+	}
+}
+
+//withContext runs fn and returns its error, or the context error if it is done first.
+//fn keeps running in background when the context is done first.
+func withContext(ctx context.Context, fn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//endpoints returns the endpoints to try in order, from the balancer if set.
+//SRV endpoints are resolved on every call
+func (d *Dispatcher) endpoints() ([]string, error) {
+	if d.balancer != nil {
+		return d.balancer.Endpoints(), nil
+	}
+	var endpoints []string
+	switch {
+	case discovery.IsSRV(d.endpoint):
+		resolved, err := discovery.ResolveSRV(d.endpoint)
+		if err != nil && len(d.failover) == 0 {
+			return nil, err
+		}
+		endpoints = resolved
+	case d.endpoint != "":
+		endpoints = []string{d.endpoint}
+	}
+	endpoints = append(endpoints, d.failover...)
+	if len(endpoints) == 0 {
+		return nil, ErrNoEndpoint
+	}
+	return endpoints, nil
+}
+
+//metaHandshake negotiates the connection, ctx is passed to the extensions. the client handshakes again with
+//another transport when the server doesn't support the current one, see fallbackHandshake
+func (d *Dispatcher) metaHandshake(ctx context.Context) (*message.Message, error) {
+	return d.handshake(ctx, true)
+}
+
+//handshake sends the handshake with the current transport, falling back to another one if fallback is set
+func (d *Dispatcher) handshake(ctx context.Context, fallback bool) (*message.Message, error) {
+	m := &message.Message{
+		Channel:                  message.MetaHandshake,
+		Version:                  BayeuxVersion,
+		SupportedConnectionTypes: d.connectionTypes(),
+	}
+	m.SetExt("client", version.ClientExt())
+	d.advertiseCompression(m)
+	d.advertiseAck(m)
+	d.setState(StateConnecting)
+	d.events.Publish(event.Event{Type: event.BeforeHandshake, Message: m})
+	if err := d.outgoing(ctx, m); err != nil {
+		return nil, err
+	}
+	handshakeResp, err := d.sendHandshake(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	if handshakeResp, err = message.Await(d.extensionContext(ctx), handshakeResp, d.pipeline.Incoming); err != nil {
+		return nil, err
+	}
+	d.observeMeta(handshakeResp)
+	d.recordServerInfo(handshakeResp)
+	d.handshakeReplay(handshakeResp)
+	d.handshakeCompression(handshakeResp)
+	d.handshakeAck(handshakeResp)
+	if handshakeResp.Advice != nil {
+		d.handleAdvice(handshakeResp.Advice)
+	}
+	if err = d.terminated(); err != nil {
+		return handshakeResp, err
+	}
+	if !handshakeResp.Successful {
+		d.logRejected("handshake rejected", handshakeResp)
+		if err = handshakeResp.GetError(); err == nil {
+			err = ErrHandshakeFailed
+		} else {
+			err = &kindError{msg: err.Error(), kind: ErrHandshakeDenied, err: err}
+		}
+		return handshakeResp, err
+	}
+	if fallback && !supports(handshakeResp.SupportedConnectionTypes, d.transport.Name()) {
+		if resp, ok := d.fallbackHandshake(ctx, handshakeResp.SupportedConnectionTypes); ok {
+			return resp, nil
+		}
+	}
+	atomic.StoreInt64(&d.handshaked, d.clock().Now().UnixNano())
+	d.setState(StateConnected)
+	d.events.Publish(event.Event{Type: event.HandshakeComplete, Message: handshakeResp})
+	return handshakeResp, nil
+}
+
+//OnBeforeHandshake registers a hook called with every handshake message before the outgoing extensions run
+func (d *Dispatcher) OnBeforeHandshake(hook func(m *message.Message)) {
+	d.events.Subscribe(event.BeforeHandshake, func(e event.Event) {
+		hook(e.Message)
+	})
+}
+
+//OnHandshakeComplete registers a hook called with every successful handshake response
+func (d *Dispatcher) OnHandshakeComplete(hook func(resp *message.Message)) {
+	d.events.Subscribe(event.HandshakeComplete, func(e event.Event) {
+		hook(e.Message)
+	})
+}
+
+//handleAdvice stores the last advice received from the server and notifies the listeners
+func (d *Dispatcher) handleAdvice(advice *message.Advise) {
+	d.advice.Store(advice)
+	d.events.Publish(event.Event{Type: event.Advice, Advice: advice})
+}
+
+//onAdvice acts on the advice received from the server
+func (d *Dispatcher) onAdvice(e event.Event) {
+	if atomic.LoadInt32(&d.disconnecting) == 1 {
+		//it concerns the session the client is dropping, e.g. the response to a /meta/connect held meanwhile
+		return
+	}
+	switch e.Advice.Reconnect {
+	case message.ReconnectRetry:
+		//the next /meta/connect is sent after advice.Interval, see connectResponse
+	case message.ReconnectHandshake:
+		//the server forgot the client, handshake again with a new connection
+		if !d.manualConnect && d.terminated() == nil {
+			go d.reconnect(ErrRehandshake)
+		}
+	case message.ReconnectNone:
+		//a client MUST respect reconnect advice none and MUST NOT automatically retry or handshake
+		d.terminate(ErrReconnectNone)
+		return
+	}
+	if e.Advice.MultipleClients {
+		d.onMultipleClients(e.Advice)
+	}
+}
+
+//HandshakeInfo returns the http response to the transport connection handshake
+func (d *Dispatcher) HandshakeInfo() transport.HandshakeInfo {
+	return d.transport.HandshakeInfo()
+}
+
+//Advice returns the last advice received from the server, nil if none was received yet
+func (d *Dispatcher) Advice() *message.Advise {
+	advice, _ := d.advice.Load().(*message.Advise)
+	return advice
+}
+
+//OnAdvice registers a handler called with every advice received from the server, after the client acted on it
+func (d *Dispatcher) OnAdvice(onAdvice func(advice message.Advise)) {
+	d.events.Subscribe(event.Advice, func(e event.Event) {
+		onAdvice(*e.Advice)
+	})
+}
+
+//terminate marks the dispatcher as terminally disconnected, fails all pending operations,
+//closes the subscriptions and publishes the Disconnected event. only the first call has effect.
+func (d *Dispatcher) terminate(err error) {
+	d.terminalMu.Lock()
+	if d.terminalErr != nil {
+		d.terminalMu.Unlock()
+		return
+	}
+	d.terminalErr = err
+	close(d.terminal)
+	d.terminalMu.Unlock()
+	d.releaseEndpoint()
+
+	d.pendingSubsMu.Lock()
+	for id, confirmCh := range d.pendingSubs {
+		confirmCh <- err
+		delete(d.pendingSubs, id)
+	}
+	d.pendingSubsMu.Unlock()
+
+	d.publishACKmu.Lock()
+	for id, ack := range d.publishACK {
+		ack <- err
+		close(ack)
+		delete(d.publishACK, id)
+	}
+	d.publishACKmu.Unlock()
+
+	d.rawMu.Lock()
+	for id, respCh := range d.rawPending {
+		close(respCh)
+		delete(d.rawPending, id)
+	}
+	d.rawMu.Unlock()
+	d.closeRequests()
+
+	d.queueMu.Lock()
+	queue := d.drainQueue()
+	d.queueMu.Unlock()
+	completeQueue(queue, err)
+	d.clearSchedule(err)
+
+	subs := d.store.Covered("/**")
+	d.store.RemoveAll()
+	d.dropAssemblies()
+	closeErr := err
+	if err == ErrDisconnected {
+		//closed on purpose
+		closeErr = nil
+	}
+	for i := range subs {
+		subs[i].Close(closeErr)
+		d.events.Publish(event.Event{Type: event.SubscriptionRemoved, Err: closeErr, Channel: subs[i].Name(), Subscription: subs[i]})
+	}
+
+	d.setState(StateDisconnected)
+	d.events.Publish(event.Event{Type: event.Disconnected, Err: err})
+}
+
+//terminated returns the error that terminated the dispatcher, nil if it is still usable
+func (d *Dispatcher) terminated() error {
+	d.terminalMu.Lock()
+	defer d.terminalMu.Unlock()
+	return d.terminalErr
+}
+
+//Connected reports whether the client has a clientId and is neither reconnecting, suspended nor terminated
+func (d *Dispatcher) Connected() bool {
+	return d.transport.ClientID() != "" && atomic.LoadInt32(&d.reconnecting) == 0 && !d.Suspended() && d.terminated() == nil
+}
+
+//SubscriptionActive reports whether a subscription to the channel name is confirmed by the server
+func (d *Dispatcher) SubscriptionActive(name string) bool {
+	subs := d.store.Covered(name)
+	for i := range subs {
+		if subs[i].Name() == name && subs[i].State() == subscription.StateActive {
+			return true
+		}
+	}
+	return false
+}
+
+//Subscriptions returns a snapshot of the subscriptions, oldest first
+func (d *Dispatcher) Subscriptions() []subscription.Info {
+	subs := d.store.Covered("/**")
+	infos := make([]subscription.Info, len(subs))
+	for i := range subs {
+		infos[i] = subs[i].Info()
+	}
+	sort.SliceStable(infos, func(i, j int) bool {
+		if !infos[i].Created.Equal(infos[j].Created) {
+			return infos[i].Created.Before(infos[j].Created)
+		}
+		return infos[i].Channel < infos[j].Channel
+	})
+	return infos
+}
+
+//OnDisconnect registers a handler called once when the client becomes terminally disconnected
+func (d *Dispatcher) OnDisconnect(onDisconnect func(err error)) {
+	d.events.Subscribe(event.Disconnected, func(e event.Event) {
+		onDisconnect(e.Err)
+	})
+}
+
+//OnError registers a handler called with the non fatal errors, e.g. transport errors or unexpected server messages
+func (d *Dispatcher) OnError(onError func(err error)) {
+	d.events.Subscribe(event.Error, func(e event.Event) {
+		onError(e.Err)
+	})
+}
+
+func (d *Dispatcher) connectMessage() *message.Message {
 	m := &message.Message{
 		Channel:        message.MetaConnect,
-		ClientId:       d.clientID,
+		ClientId:       d.transport.ClientID(),
 		ConnectionType: d.transport.Name(),
 		Id:             d.nextMsgID(),
 	}
-	return d.transport.Connect(m)
+	if d.connectTimeout != nil {
+		m.Advice = &message.Advise{Timeout: *d.connectTimeout}
+	}
+	d.acknowledge(m)
+	d.connectID.Store(m.Id)
+	return m
+}
+
+//SetConnectTimeout sets the hold timeout requested to the server on every /meta/connect
+func (d *Dispatcher) SetConnectTimeout(timeout time.Duration) {
+	d.connectTimeout = &timeout
+}
+
+//SetUnsubscribeTimeout sets how long the unsubscribes wait for the server confirmation before returning
+//ErrUnsubscribeTimeout, 10s by default. zero waits forever.
+func (d *Dispatcher) SetUnsubscribeTimeout(timeout time.Duration) {
+	d.unsubscribeTimeout = timeout
 }
 
 func (d *Dispatcher) Disconnect() error {
+	return d.DisconnectCtx(context.Background())
+}
+
+//DisconnectCtx is like Disconnect but gives up waiting for the publishes in flight and the server response
+//when ctx is done, the client is disconnected anyway
+func (d *Dispatcher) DisconnectCtx(ctx context.Context) error {
+	if d.terminated() != nil {
+		return nil
+	}
+	if d.stopSuspended() {
+		//the server dropped the session already
+		d.terminate(ErrDisconnected)
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, d.disconnectWait())
+	defer cancel()
+	atomic.StoreInt32(&d.disconnecting, 1)
+	d.flush(ctx)
+
 	m := &message.Message{
 		Channel:  message.MetaDisconnect,
-		ClientId: d.clientID,
+		ClientId: d.transport.ClientID(),
 		Id:       d.nextMsgID(),
 	}
-	return d.transport.Disconnect(m)
+	var err error
+	if closer, ok := d.closer(); ok {
+		err = d.sendDisconnect(ctx, m)
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	} else {
+		err = transport.DisconnectCtx(ctx, d.transport, m)
+	}
+	d.releaseEndpoint()
+	d.terminate(ErrDisconnected)
+	return err
+}
+
+//flush waits until the publishes in flight are acknowledged, or ctx is done
+func (d *Dispatcher) flush(ctx context.Context) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		d.publishACKmu.Lock()
+		pending := len(d.publishACK)
+		d.publishACKmu.Unlock()
+		if pending == 0 {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+//sendDisconnect sends the /meta/disconnect message and waits for the server response until ctx is done
+func (d *Dispatcher) sendDisconnect(ctx context.Context, m *message.Message) error {
+	respCh := d.awaitResponse(m.Id)
+	if err := d.transport.SendMessage(m); err != nil {
+		d.cancelResponse(m.Id)
+		return err
+	}
+	select {
+	case resp, ok := <-respCh:
+		if ok && !resp.Successful {
+			return resp.GetError()
+		}
+	case <-ctx.Done():
+		d.cancelResponse(m.Id)
+	}
+	return nil
+}
+
+//closer returns the transport if it can close its connection without sending /meta/disconnect itself
+func (d *Dispatcher) closer() (transport.Closer, bool) {
+	t := d.transport
+	if it, ok := t.(*interceptTransport); ok {
+		t = it.Transport
+	}
+	c, ok := t.(transport.Closer)
+	return c, ok
+}
+
+//serverDisconnect handles a /meta/disconnect received from the server. unless the client asked for it, the server
+//dropped the session: the client handshakes again as the reconnect advice allows, see onAdvice.
+func (d *Dispatcher) serverDisconnect(msg *message.Message) {
+	if atomic.LoadInt32(&d.disconnecting) == 1 || d.Suspended() || d.terminated() != nil {
+		return
+	}
+	if d.manualConnect {
+		d.events.Publish(event.Event{Type: event.Error, Err: ErrServerDisconnect, Message: msg})
+		return
+	}
+	go d.reconnect(ErrServerDisconnect)
 }
 
 func (d *Dispatcher) dispatchMessage(msg *message.Message) {
-	d.extensions.ApplyInExtensions(msg)
+	if d.terminated() != nil {
+		return
+	}
+	d.logMessage("receive", msg)
+	d.metrics.MessageReceived()
+	if err := d.decompress(msg); err != nil {
+		d.events.Publish(event.Event{Type: event.Error, Err: err, Message: msg})
+		return
+	}
+	d.incoming(msg)
+}
+
+//routeMessage hands a message received, once the incoming extensions ran, to the operation or the
+//subscriptions waiting for it
+func (d *Dispatcher) routeMessage(msg *message.Message) {
+	d.observeMeta(msg)
+
+	if msg.Advice != nil {
+		d.handleAdvice(msg.Advice)
+		if d.terminated() != nil {
+			return
+		}
+	}
+	d.onTokenExpired(msg)
+	d.recordAckBatch(msg)
+
+	if d.rawResponse(msg) || d.serviceReply(msg) {
+		return
+	}
 
 	if message.IsMetaMessage(msg) {
 		//handle it
@@ -107,22 +886,51 @@ func (d *Dispatcher) dispatchMessage(msg *message.Message) {
 			//handle MetaSubscribe resp
 			d.pendingSubsMu.Lock()
 			confirmCh, ok := d.pendingSubs[msg.Id]
+			delete(d.pendingSubs, msg.Id)
 			d.pendingSubsMu.Unlock()
 			if !ok {
-				panic("BUG: subscription not registered `" + msg.Subscription + "`")
+				d.events.Publish(event.Event{
+					Type:    event.Error,
+					Err:     fmt.Errorf("%w: subscribe response for `%s`", ErrUnexpectedMessage, msg.Subscription),
+					Message: msg,
+				})
+				return
 			}
 
 			if !msg.Successful {
-				if msg.GetError() == nil {
-					//inject the error if the server returns unsuccessful without error
-					msg.Error = fmt.Sprintf("susbscription `%s` failed", msg.Subscription)
+				d.logRejected("subscribe rejected", msg)
+				err := &SubscriptionError{Channel: strings.TrimPrefix(msg.Subscription, d.prefix), Err: msg.GetError()}
+				if bayeux, ok := err.Err.(*message.Error); ok {
+					err.Code = bayeux.Code
 				}
-				confirmCh <- msg.GetError()
-				//v2
+				confirmCh <- err
 			} else {
 				confirmCh <- nil
 			}
 			return
+		case message.MetaConnect:
+			//the responses to Connect were routed to it already
+			if d.staleConnect(msg) {
+				d.events.Publish(event.Event{
+					Type:    event.Error,
+					Err:     fmt.Errorf("%w: stale connect response `%s`", ErrUnexpectedMessage, msg.Id),
+					Message: msg,
+				})
+				return
+			}
+			d.connectResponse(msg)
+			return
+		case message.MetaDisconnect:
+			d.serverDisconnect(msg)
+			return
+		case message.MetaUnsubscribe:
+			//the awaited responses were routed to Unsubscribe already
+			d.events.Publish(event.Event{
+				Type:    event.Error,
+				Err:     fmt.Errorf("%w: unsubscribe response for `%s`", ErrUnexpectedMessage, msg.Subscription),
+				Message: msg,
+			})
+			return
 		}
 	}
 	//is Event Message
@@ -130,25 +938,38 @@ func (d *Dispatcher) dispatchMessage(msg *message.Message) {
 	// 1. Publish
 	// 2. Delivery
 	if message.IsEventDelivery(msg) {
+		var ok bool
+		if msg, ok = d.appMessage(msg); !ok {
+			return
+		}
+		if msg, ok = d.decodeBinary(msg); !ok {
+			return
+		}
+		if d.recordDelivery(msg) {
+			//already delivered, replayed by the server
+			return
+		}
+		d.touch()
 		subscriptions := d.store.Match(msg.Channel)
 		//send to all listeners
-		log.Println(subscriptions, msg)
+		d.logMessage("deliver", msg)
 		for i := range subscriptions {
 			if subscriptions[i].MsgChannel() != nil {
-				select {
-				case subscriptions[i].MsgChannel() <- msg:
-				default:
-					log.Println("subscription has no listeners") //todo remove
-				}
+				d.deliver(subscriptions[i], msg)
 			}
 		}
 		return
 	}
 
 	if message.IsEventPublish(msg) {
+		//the ack is removed from the pending list on first delivery, late or duplicated acks are dropped
 		d.publishACKmu.Lock()
 		publishACK, ok := d.publishACK[msg.Id]
+		delete(d.publishACK, msg.Id)
 		d.publishACKmu.Unlock()
+		if !msg.Successful {
+			d.logRejected("publish rejected", msg)
+		}
 		if ok {
 			publishACK <- msg.GetError()
 			close(publishACK)
@@ -158,104 +979,556 @@ func (d *Dispatcher) dispatchMessage(msg *message.Message) {
 }
 
 func (d *Dispatcher) SetTransport(t transport.Transport) {
-	t.SetOnMessageReceivedHandler(d.dispatchMessage)
-	d.transport = t
+	t.SetOnMessageReceivedHandler(d.receive)
+	t.SetOnTransportDownHandler(func(err error) {
+		d.events.Publish(event.Event{Type: event.TransportDown, Err: err})
+	})
+	t.SetOnErrorHandler(func(err error) {
+		d.events.Publish(event.Event{Type: event.Error, Err: err})
+	})
+	d.transport = &interceptTransport{Transport: t, d: d}
+}
+
+//SetIDGenerator makes the messages use the ids of g, it must be called before Start. nil restores the counter.
+func (d *Dispatcher) SetIDGenerator(g idgen.Generator) {
+	if g == nil {
+		g = &idgen.Counter{}
+	}
+	d.ids = g
 }
 
 func (d *Dispatcher) nextMsgID() string {
-	return strconv.Itoa(int(atomic.AddUint64(d.msgID, 1)))
+	return d.ids.Next()
 }
 
-//sendMessage send applies the out extensions and sends a message throught the transport
-func (d *Dispatcher) sendMessage(m *message.Message) error {
-	d.extensions.ApplyOutExtensions(m)
+//sendMessage send applies the out extensions, compresses the data and sends a message throught the transport
+func (d *Dispatcher) sendMessage(ctx context.Context, m *message.Message) error {
+	if err := d.applyOut(ctx, m); err != nil {
+		return err
+	}
 	return d.transport.SendMessage(m)
 }
 
+//extensionContext returns ctx carrying the client info passed to the extensions
+func (d *Dispatcher) extensionContext(ctx context.Context) context.Context {
+	return message.ContextWithClientInfo(ctx, message.ClientInfo{
+		ClientID:  d.transport.ClientID(),
+		Endpoint:  d.endpoint,
+		Transport: d.transport.Name(),
+	})
+}
+
 func (d *Dispatcher) Subscribe(channel string) (*subscription.Subscription, error) {
-	id := d.nextMsgID()
-	m := &message.Message{
-		Channel:      message.MetaSubscribe,
-		ClientId:     d.clientID,
-		Subscription: channel,
-		Id:           id,
+	return d.SubscribeCtx(context.Background(), channel)
+}
+
+//SubscribeCtx is like Subscribe but stops waiting for the server acknowledgement when ctx is done, returning
+//the context error. the subscription acknowledged afterwards is removed. the middlewares are run on its messages.
+func (d *Dispatcher) SubscribeCtx(ctx context.Context, channel string, middlewares ...subscription.Middleware) (*subscription.Subscription, error) {
+	return d.SubscribeDelivery(ctx, channel, subscription.AtMostOnce, middlewares...)
+}
+
+//SubscribeDelivery is like SubscribeCtx with the delivery guarantee of the subscription. the channels of the
+//AtLeastOnce subscriptions keep the id of their last delivery, see trackDeliveries, so the server replays the
+//messages following it when they are subscribed again
+func (d *Dispatcher) SubscribeDelivery(ctx context.Context, channel string, mode subscription.DeliveryMode, middlewares ...subscription.Middleware) (*subscription.Subscription, error) {
+	if err := d.closingErr(); err != nil {
+		return nil, err
+	}
+	if err := d.wake(ctx); err != nil {
+		return nil, err
 	}
+	p, err := d.prepareSubscribe(channel, mode, middlewares)
+	if err != nil {
+		return nil, err
+	}
+	if p.m != nil {
+		if err = d.throttle(ctx, 0, 1); err == nil {
+			err = d.send(ctx, p.m)
+		}
+		if err != nil {
+			d.cancelSubscribe(p, err)
+			return nil, err
+		}
+	}
+	return d.awaitSubscribe(ctx, p)
+}
 
-	if err := d.transport.SendMessage(m); err != nil {
+//pendingSubscribe is a subscribe registered and waiting to be sent, m is nil when the subscribe is coalesced
+//with a server subscription of the same channel, existing or in flight
+type pendingSubscribe struct {
+	m            *message.Message
+	sub          *subscription.Subscription
+	confirmation chan error
+	lastID       string
+	replaying    bool
+}
+
+//prepareSubscribe builds the subscribe message and registers it, so the response can't arrive
+//before we wait for it
+func (d *Dispatcher) prepareSubscribe(name string, mode subscription.DeliveryMode, middlewares []subscription.Middleware) (*pendingSubscribe, error) {
+	if err := d.terminated(); err != nil {
 		return nil, err
 	}
+	if err := channel.ValidateSubscribe(name); err != nil {
+		return nil, err
+	}
+	inMsgCh := make(chan *message.Message, d.channelConfig(name).QueueSize())
+	sub, err := subscription.NewSubscription(name, d.Unsubscribe, inMsgCh)
+	if err != nil {
+		return nil, err
+	}
+	//set before the subscription is registered, so they see all its messages
+	sub.Use(middlewares...)
+	sub.SetDeliveryMode(mode)
+	sub.SetPauser(d.pauseOnServer)
+	if mode == subscription.AtLeastOnce {
+		d.trackDeliveries(name)
+	}
+	p := &pendingSubscribe{sub: sub, confirmation: make(chan error, 1)}
+
+	d.pendingSubsMu.Lock()
+	defer d.pendingSubsMu.Unlock()
+	//the server subscription is shared by all the local subscriptions of the channel, unless they are paused
+	if d.store.Count(name) > 0 && !d.resumeChannel(name) {
+		p.confirmation <- nil
+		return p, nil
+	}
+	if followers, ok := d.subscribing[name]; ok {
+		d.subscribing[name] = append(followers, p.confirmation)
+		return p, nil
+	}
+	d.subscribing[name] = nil
+
+	p.m = &message.Message{
+		Channel:      message.MetaSubscribe,
+		ClientId:     d.transport.ClientID(),
+		Subscription: d.serverChannel(name),
+		Id:           d.nextMsgID(),
+	}
+	//request only the messages we missed since the last delivery
+	p.lastID, p.replaying = d.replayFrom(name)
+	if p.replaying {
+		p.m.SetExt(replayExt, map[string]interface{}{p.m.Subscription: p.lastID})
+	}
+	d.pendingSubs[p.m.Id] = p.confirmation
+	return p, nil
+}
 
-	inMsgCh := make(chan *message.Message, 0)
-	subscriptionConfirmation := make(chan error)
+//cancelSubscribe unregisters a subscribe that couldn't be sent, the coalesced subscribes fail with err
+func (d *Dispatcher) cancelSubscribe(p *pendingSubscribe, err error) {
+	if p.m == nil {
+		return
+	}
+	d.pendingSubsMu.Lock()
+	delete(d.pendingSubs, p.m.Id)
+	d.pendingSubsMu.Unlock()
+	d.endSubscribe(p.sub.Name(), nil, err)
+}
 
+//endSubscribe completes the server subscribe of the channel, sub is added to the store if not nil.
+//the subscribes coalesced while it was in flight are notified with err.
+func (d *Dispatcher) endSubscribe(name string, sub *subscription.Subscription, err error) {
 	d.pendingSubsMu.Lock()
-	d.pendingSubs[id] = subscriptionConfirmation
+	if sub != nil {
+		d.store.Add(sub)
+		sub.SetState(subscription.StateActive)
+	}
+	followers := d.subscribing[name]
+	delete(d.subscribing, name)
 	d.pendingSubsMu.Unlock()
+	if sub != nil {
+		d.events.Publish(event.Event{Type: event.SubscriptionAdded, Channel: name, Subscription: sub})
+	}
+	for i := range followers {
+		followers[i] <- err
+	}
+}
+
+//awaitSubscribe waits for the server to confirm the subscribe
+func (d *Dispatcher) awaitSubscribe(ctx context.Context, p *pendingSubscribe) (*subscription.Subscription, error) {
+	timeoutCh, stop := d.subscribeDeadline()
+	defer stop()
+	select {
+	case err := <-p.confirmation:
+		return d.completeSubscribe(ctx, p, err)
+	case <-ctx.Done():
+		go d.abandonSubscribe(p)
+		return nil, ctx.Err()
+	case <-timeoutCh:
+		go d.abandonSubscribe(p)
+		d.metaTimedOut(ErrSubscribeTimeout)
+		return nil, ErrSubscribeTimeout
+	}
+}
 
-	sub, err := subscription.NewSubscription(channel, d.Unsubscribe, inMsgCh)
+//abandonSubscribe waits for the outcome of a subscribe nobody waits for anymore, removing the subscription
+//if it succeeds
+func (d *Dispatcher) abandonSubscribe(p *pendingSubscribe) {
+	sub, err := d.completeSubscribe(context.Background(), p, <-p.confirmation)
 	if err != nil {
-		return nil, err
+		return
+	}
+	if err = d.Unsubscribe(sub); err != nil && d.terminated() == nil {
+		d.events.Publish(event.Event{Type: event.Error, Err: err})
+	}
+}
+
+//completeSubscribe registers the subscription once the server answered the subscribe with err, a subscribe
+//the server can't replay is sent again with ctx
+func (d *Dispatcher) completeSubscribe(ctx context.Context, p *pendingSubscribe, err error) (*subscription.Subscription, error) {
+	if p.m == nil {
+		if err != nil {
+			return nil, err
+		}
+		d.store.Add(p.sub)
+		p.sub.SetState(subscription.StateActive)
+		d.events.Publish(event.Event{Type: event.SubscriptionAdded, Channel: p.sub.Name(), Subscription: p.sub})
+		return p.sub, nil
 	}
 
-	//todo timeout here
-	err = <-subscriptionConfirmation
+	name := p.sub.Name()
+	if err != nil && p.replaying && d.terminated() == nil {
+		//the server can't replay from lastID, subscribe again from the current position. the subscribes
+		//coalesced meanwhile wait for the outcome
+		d.replayGap(name, p.lastID, err)
+		p.replaying = false
+		p.m = &message.Message{
+			Channel:      message.MetaSubscribe,
+			ClientId:     d.transport.ClientID(),
+			Subscription: p.m.Subscription,
+			Id:           d.nextMsgID(),
+		}
+		d.pendingSubsMu.Lock()
+		d.pendingSubs[p.m.Id] = p.confirmation
+		d.pendingSubsMu.Unlock()
+		if err = d.send(ctx, p.m); err != nil {
+			d.cancelSubscribe(p, err)
+			return nil, err
+		}
+		return d.awaitSubscribe(ctx, p)
+	}
 	if err != nil {
-		//log.Println(err)
+		d.endSubscribe(name, nil, err)
 		return nil, err
 	}
-	d.store.Add(sub)
-	return sub, nil
-
+	d.endSubscribe(name, p.sub, nil)
+	return p.sub, nil
 }
 
 func (d *Dispatcher) Unsubscribe(sub *subscription.Subscription) error {
+	if err := d.terminated(); err != nil {
+		//all subscriptions were already closed
+		return err
+	}
 	//https://docs.cometd.org/current/reference/#_bayeux_meta_unsubscribe
-	d.store.Remove(sub)
-	//if this is last subscription we will send meta unsubscribe to the server
-	if d.store.Count(sub.Name()) == 0 {
-		d.publishACKmu.Lock()
-		delete(d.publishACK, sub.Name())
-		d.publishACKmu.Unlock()
-
-		m := &message.Message{
-			Channel:      message.MetaUnsubscribe,
-			Subscription: sub.Name(),
-			ClientId:     d.clientID,
-			Id:           d.nextMsgID(),
+	if !d.store.Remove(sub) {
+		//already unsubscribed
+		return nil
+	}
+	sub.SetState(subscription.StateUnsubscribing)
+	defer sub.SetState(subscription.StateClosed)
+	d.forgetSubscription(sub)
+	d.events.Publish(event.Event{Type: event.SubscriptionRemoved, Channel: sub.Name(), Subscription: sub})
+	//if this is last subscription we will send meta unsubscribe to the server, a suspended session has none
+	//and a paused channel is unsubscribed already
+	if d.store.Count(sub.Name()) == 0 && !d.resumeChannel(sub.Name()) && !d.Suspended() {
+		m := d.unsubscribeMessage(sub.Name())
+		respCh := d.awaitResponse(m.Id)
+		if err := d.transport.SendMessage(m); err != nil {
+			d.cancelResponse(m.Id)
+			return err
 		}
-		return d.transport.SendMessage(m)
+		timeoutCh, stop := d.unsubscribeDeadline()
+		defer stop()
+		return d.awaitUnsubscribe(m.Id, respCh, timeoutCh)
 	}
 
 	return nil
 }
 
+func (d *Dispatcher) unsubscribeMessage(name string) *message.Message {
+	return &message.Message{
+		Channel:      message.MetaUnsubscribe,
+		Subscription: d.serverChannel(name),
+		ClientId:     d.transport.ClientID(),
+		Id:           d.nextMsgID(),
+	}
+}
+
+//unsubscribeDeadline returns the channel fired once the unsubscribe timeout elapsed, nil if there is none.
+//stop releases its timer.
+func (d *Dispatcher) unsubscribeDeadline() (<-chan time.Time, func()) {
+	if d.unsubscribeTimeout <= 0 {
+		return nil, func() {}
+	}
+	timer := d.clock().NewTimer(d.unsubscribeTimeout)
+	return timer.C(), func() { timer.Stop() }
+}
+
+//awaitUnsubscribe waits for the server to confirm the unsubscribe of id until timeoutCh fires, the local
+//subscription is already closed so the late deliveries are dropped
+func (d *Dispatcher) awaitUnsubscribe(id string, respCh chan *message.Message, timeoutCh <-chan time.Time) error {
+	var resp *message.Message
+	select {
+	case m, ok := <-respCh:
+		if !ok {
+			return d.terminated()
+		}
+		resp = m
+	case <-timeoutCh:
+		d.cancelResponse(id)
+		d.metaTimedOut(ErrUnsubscribeTimeout)
+		return ErrUnsubscribeTimeout
+	}
+	if resp.Successful {
+		return nil
+	}
+	if err := resp.GetError(); err != nil {
+		return err
+	}
+	return fmt.Errorf("unsubscription `%s` failed", resp.Subscription)
+}
+
+//UnsubscribeOnDone unsubscribes sub when ctx is done, unless it was unsubscribed before.
+//errors are reported to the OnError handlers, nothing is reported once the dispatcher terminated.
+//the registration on ctx is released once sub is removed, so a long lived ctx doesn't keep it reachable
+func (d *Dispatcher) UnsubscribeOnDone(ctx context.Context, sub *subscription.Subscription) {
+	stop := context.AfterFunc(ctx, func() {
+		if err := d.Unsubscribe(sub); err != nil && d.terminated() == nil {
+			d.events.Publish(event.Event{Type: event.Error, Err: fmt.Errorf("unsubscribe `%s`: %w", sub.Name(), err), Channel: sub.Name()})
+		}
+	})
+	//the context of the subscription is canceled once it is removed, before Done is closed
+	context.AfterFunc(sub.Context(), func() {
+		stop()
+	})
+}
+
+//HandleMessages calls onMessage from a new goroutine with every message delivered to sub until it is removed,
+//a panic in onMessage stops the delivery and is reported as an event.Error
+func (d *Dispatcher) HandleMessages(sub *subscription.Subscription, onMessage func(channel string, msg message.Data)) {
+	d.handle(sub, func() error {
+		return sub.OnMessage(func(channel string, msg message.Data) {
+			d.work(func() { onMessage(channel, msg) })
+		})
+	})
+}
+
+//HandleRawMessages is like HandleMessages but onMessage receives the whole messages
+func (d *Dispatcher) HandleRawMessages(sub *subscription.Subscription, onMessage func(msg *message.Message)) {
+	d.handle(sub, func() error {
+		return sub.OnRawMessage(func(msg *message.Message) {
+			d.work(func() { onMessage(msg) })
+		})
+	})
+}
+
+//handle runs the delivery loop of sub from a new goroutine, its error is reported as an event.Error
+func (d *Dispatcher) handle(sub *subscription.Subscription, loop func() error) {
+	d.handlers.Add(1)
+	go func() {
+		defer d.handlers.Done()
+		if err := loop(); err != nil && d.terminated() == nil {
+			d.events.Publish(event.Event{Type: event.Error, Err: fmt.Errorf("subscription `%s`: %w", sub.Name(), err), Channel: sub.Name()})
+		}
+	}()
+}
+
+//UnsubscribePattern removes all subscriptions whose channel is covered by the pattern,
+//e.g. /chat/** removes /chat/foo and /chat/*. the server is notified in a single batch.
+func (d *Dispatcher) UnsubscribePattern(pattern string) error {
+	if err := d.terminated(); err != nil {
+		return err
+	}
+	if !subscription.IsValidSubscriptionName(pattern) {
+		return subscription.ErrInvalidChannelName
+	}
+
+	var msgs []*message.Message
+	var removed []*subscription.Subscription
+	subs := d.store.Covered(pattern)
+	for i := range subs {
+		if d.store.Remove(subs[i]) {
+			subs[i].SetState(subscription.StateUnsubscribing)
+			removed = append(removed, subs[i])
+		}
+		d.forgetSubscription(subs[i])
+	}
+	for i := range removed {
+		d.events.Publish(event.Event{Type: event.SubscriptionRemoved, Channel: removed[i].Name(), Subscription: removed[i]})
+	}
+	defer func() {
+		for i := range removed {
+			removed[i].SetState(subscription.StateClosed)
+		}
+	}()
+	notified := map[string]bool{}
+	for i := range subs {
+		name := subs[i].Name()
+		if notified[name] || d.store.Count(name) > 0 || d.resumeChannel(name) {
+			continue
+		}
+		notified[name] = true
+		msgs = append(msgs, d.unsubscribeMessage(name))
+	}
+	if len(msgs) == 0 || d.Suspended() {
+		return nil
+	}
+
+	responses := make([]chan *message.Message, len(msgs))
+	for i := range msgs {
+		responses[i] = d.awaitResponse(msgs[i].Id)
+	}
+	if err := d.transport.SendMessages(msgs); err != nil {
+		for i := range msgs {
+			d.cancelResponse(msgs[i].Id)
+		}
+		return err
+	}
+	timeoutCh, stop := d.unsubscribeDeadline()
+	defer stop()
+	var firstErr error
+	for i := range responses {
+		err := d.awaitUnsubscribe(msgs[i].Id, responses[i], timeoutCh)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if err == ErrUnsubscribeTimeout {
+			//the deadline is shared, the remaining responses are not awaited
+			for j := i + 1; j < len(msgs); j++ {
+				d.cancelResponse(msgs[j].Id)
+			}
+			break
+		}
+	}
+	return firstErr
+}
+
+//UnsubscribeAll removes all subscriptions, the server is notified in a single batch
+func (d *Dispatcher) UnsubscribeAll() error {
+	return d.UnsubscribePattern("/**")
+}
+
 func (d *Dispatcher) Publish(subscription string, data message.Data) (err error) {
-	id := d.nextMsgID()
+	return d.PublishWithTimeout(subscription, data, 0)
+}
 
-	m := &message.Message{
-		Channel:  subscription,
+//PublishWithTimeout publishes the data and waits at most timeout for the server acknowledgement.
+//ErrAckTimeout is returned if the ack doesn't arrive in time, a zero timeout waits forever.
+func (d *Dispatcher) PublishWithTimeout(subscription string, data message.Data, timeout time.Duration) (err error) {
+	return d.PublishCtx(context.Background(), subscription, data, timeout)
+}
+
+//PublishCtx is like PublishWithTimeout but stops waiting for the server acknowledgement when ctx is done,
+//returning the context error. ctx is also passed to the outgoing extensions.
+func (d *Dispatcher) PublishCtx(ctx context.Context, subscription string, data message.Data, timeout time.Duration) (err error) {
+	return d.publish(ctx, subscription, data, timeout, false)
+}
+
+//PublishWithAck is like PublishCtx but waits for the server acknowledgement even if the channel is configured
+//to skip it
+func (d *Dispatcher) PublishWithAck(ctx context.Context, subscription string, data message.Data, timeout time.Duration) (err error) {
+	return d.publish(ctx, subscription, data, timeout, true)
+}
+
+func (d *Dispatcher) publish(ctx context.Context, subscription string, data message.Data, timeout time.Duration, requireAck bool) (err error) {
+	if err = d.closingErr(); err != nil {
+		return err
+	}
+	if err = d.wake(ctx); err != nil {
+		return err
+	}
+	if binary, ok := data.(message.BinaryData); ok {
+		if chunked, err := d.publishBinary(ctx, subscription, binary, timeout, requireAck); chunked {
+			return err
+		}
+	}
+	if err = d.throttle(ctx, 1, 0); err != nil {
+		return err
+	}
+	m, ack, err := d.preparePublish(subscription, data, requireAck)
+	if err != nil {
+		return err
+	}
+	start := d.clock().Now()
+	var reconnected <-chan struct{}
+	if requireAck && d.publishRetries > 0 {
+		//watched before sending, so a reconnect during the send is seen too
+		var stop func()
+		reconnected, stop = d.watchReconnects()
+		defer stop()
+	}
+	if err = d.applyOut(ctx, m); err == nil {
+		err = d.send(ctx, m)
+	}
+	if err != nil {
+		d.removePublishACK(m.Id)
+		return err
+	}
+	if ack == nil {
+		return nil
+	}
+	if requireAck && timeout <= 0 {
+		timeout = d.publishTimeout
+	}
+	if reconnected != nil {
+		err = d.awaitPublishRetrying(ctx, m, ack, timeout, reconnected)
+	} else {
+		err = d.awaitPublish(ctx, m.Id, ack, timeout)
+	}
+	if err != nil {
+		return err
+	}
+	d.metrics.PublishAcknowledged(d.clock().Now().Sub(start))
+	return nil
+}
+
+//preparePublish builds the publish message and registers its ack, ack is nil if the channel skips it
+//and requireAck is false
+func (d *Dispatcher) preparePublish(subscription string, data message.Data, requireAck bool) (m *message.Message, ack chan error, err error) {
+	if err = d.terminated(); err != nil {
+		return nil, nil, err
+	}
+	if err = channel.ValidatePublish(subscription); err != nil {
+		return nil, nil, err
+	}
+	m = &message.Message{
+		Channel:  d.serverChannel(subscription),
 		Data:     data,
-		ClientId: d.clientID,
-		Id:       id,
+		ClientId: d.transport.ClientID(),
+		Id:       d.nextMsgID(),
+	}
+	if !requireAck && d.channelConfig(subscription).SkipAck {
+		return m, nil, nil
 	}
 
-	//ack from server
-	ack := make(chan error)
+	//ack from server, buffered so the read loop never blocks on a publisher that gave up
+	ack = make(chan error, 1)
 	d.publishACKmu.Lock()
-	d.publishACK[id] = ack
+	d.publishACK[m.Id] = ack
 	d.publishACKmu.Unlock()
+	return m, ack, nil
+}
 
-	if err = d.sendMessage(m); err != nil {
-		return err
+//awaitPublish waits at most timeout for the ack of the publish id
+func (d *Dispatcher) awaitPublish(ctx context.Context, id string, ack chan error, timeout time.Duration) (err error) {
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := d.clock().NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C()
 	}
 
-	select { //todo timeout
+	select {
 	case err = <-ack:
+	case <-timeoutCh:
+		err = ErrAckTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
 	}
 
-	d.publishACKmu.Lock()
-	delete(d.publishACK, id)
-	d.publishACKmu.Unlock()
+	d.removePublishACK(id)
 
 	if err != nil { //todo retries
 		return err
@@ -263,3 +1536,9 @@ func (d *Dispatcher) Publish(subscription string, data message.Data) (err error)
 
 	return nil
 }
+
+func (d *Dispatcher) removePublishACK(id string) {
+	d.publishACKmu.Lock()
+	delete(d.publishACK, id)
+	d.publishACKmu.Unlock()
+}
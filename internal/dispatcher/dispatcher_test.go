@@ -0,0 +1,1257 @@
+package dispatcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/thesyncim/faye/balancer"
+	"github.com/thesyncim/faye/channel"
+	"github.com/thesyncim/faye/internal/version"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/subscription"
+	"github.com/thesyncim/faye/transport"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//fakeTransport is an in memory transport, reply is called for every message sent by the dispatcher
+type fakeTransport struct {
+	transport.Session
+
+	handshakeExt interface{}
+	onHandshake  func(m *message.Message)
+	endpoint     string
+	//connectionTypes are the connection types supported by the server, sent in the handshake response
+	connectionTypes []string
+	//initErrs are returned by the next calls to Init
+	initErrs        []error
+	onTransportDown func(err error)
+
+	mu      sync.Mutex
+	sent    []*message.Message
+	batches [][]*message.Message
+	reply   func(t *fakeTransport, m *message.Message)
+	onMsg   func(msg *message.Message)
+	//discard doesn't record the messages sent, e.g. for the benchmarks
+	discard bool
+}
+
+var _ transport.Transport = (*fakeTransport)(nil)
+
+func (t *fakeTransport) Name() string { return "fake" }
+func (t *fakeTransport) Init(endpoint string, options *transport.Options) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.endpoint = endpoint
+	if len(t.initErrs) > 0 {
+		err := t.initErrs[0]
+		t.initErrs = t.initErrs[1:]
+		return err
+	}
+	return nil
+}
+func (t *fakeTransport) Options() *transport.Options { return &transport.Options{} }
+func (t *fakeTransport) Handshake(msg *message.Message) (*message.Message, error) {
+	if t.onHandshake != nil {
+		t.onHandshake(msg)
+	}
+	resp := &message.Message{
+		Channel:                  message.MetaHandshake,
+		Successful:               true,
+		ClientId:                 "fake-client",
+		Ext:                      t.handshakeExt,
+		Version:                  BayeuxVersion,
+		SupportedConnectionTypes: t.connectionTypes,
+	}
+	t.Observe(resp)
+	return resp, nil
+}
+func (t *fakeTransport) Connect(msg *message.Message) error    { return t.SendMessage(msg) }
+func (t *fakeTransport) Disconnect(msg *message.Message) error { return t.SendMessage(msg) }
+func (t *fakeTransport) SendMessage(msg *message.Message) error {
+	t.mu.Lock()
+	if !t.discard {
+		t.sent = append(t.sent, msg)
+	}
+	reply := t.reply
+	t.mu.Unlock()
+	if reply != nil {
+		reply(t, msg)
+	}
+	return nil
+}
+func (t *fakeTransport) SendMessages(msgs []*message.Message) error {
+	t.mu.Lock()
+	t.batches = append(t.batches, msgs)
+	t.mu.Unlock()
+	for i := range msgs {
+		if err := t.SendMessage(msgs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func (t *fakeTransport) SetOnMessageReceivedHandler(onMsg func(msg *message.Message)) {
+	t.onMsg = onMsg
+}
+func (t *fakeTransport) SetOnTransportUpHandler(callback func()) {}
+func (t *fakeTransport) SetOnTransportDownHandler(callback func(error)) {
+	t.onTransportDown = callback
+}
+func (t *fakeTransport) SetOnErrorHandler(onError func(err error)) {}
+
+//deliver simulates a message received from the server
+func (t *fakeTransport) deliver(msg *message.Message) {
+	t.Observe(msg)
+	t.onMsg(msg)
+}
+
+func newTestDispatcher(t *testing.T, reply func(t *fakeTransport, m *message.Message)) (*Dispatcher, *fakeTransport) {
+	return connectTestDispatcher(t, &fakeTransport{reply: reply})
+}
+
+func connectTestDispatcher(t *testing.T, ft *fakeTransport) (*Dispatcher, *fakeTransport) {
+	d := NewDispatcher("fake://", transport.Options{}, message.Extensions{})
+	d.SetTransport(ft)
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return d, ft
+}
+
+//prefixedIDs numbers the messages after a prefix
+type prefixedIDs struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (g *prefixedIDs) Next() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.n++
+	return fmt.Sprintf("id-%d", g.n)
+}
+
+func TestDispatcher_IDGenerator(t *testing.T) {
+	ft := &fakeTransport{reply: ackSubscriptions}
+	d := NewDispatcher("fake://", transport.Options{}, message.Extensions{})
+	d.SetTransport(ft)
+	d.SetIDGenerator(&prefixedIDs{})
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Subscribe("/foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	for i, m := range ft.sent {
+		if expected := fmt.Sprintf("id-%d", i+1); m.Id != expected {
+			t.Fatalf("expecting the %s id %s got: %s", m.Channel, expected, m.Id)
+		}
+	}
+}
+
+func TestDispatcher_PublishAck(t *testing.T) {
+	d, _ := newTestDispatcher(t, func(ft *fakeTransport, m *message.Message) {
+		if m.Channel == "/foo" {
+			go ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Successful: true})
+		}
+	})
+
+	if err := d.PublishWithTimeout("/foo", "bar", time.Second); err != nil {
+		t.Fatalf("expecting nil error got: %v", err)
+	}
+}
+
+func TestDispatcher_PublishAckTimeout(t *testing.T) {
+	var lateAck *message.Message
+	d, ft := newTestDispatcher(t, func(ft *fakeTransport, m *message.Message) {
+		if m.Channel == "/foo" {
+			lateAck = &message.Message{Channel: m.Channel, Id: m.Id, Successful: true}
+		}
+	})
+
+	err := d.PublishWithTimeout("/foo", "bar", 10*time.Millisecond)
+	if err != ErrAckTimeout {
+		t.Fatalf("expecting ErrAckTimeout got: %v", err)
+	}
+
+	//a late ack must be discarded without blocking the read loop
+	done := make(chan struct{})
+	go func() {
+		ft.deliver(lateAck)
+		ft.deliver(lateAck)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("late ack blocked the dispatcher")
+	}
+
+	d.publishACKmu.Lock()
+	pending := len(d.publishACK)
+	d.publishACKmu.Unlock()
+	if pending != 0 {
+		t.Fatalf("expecting no pending acks got: %d", pending)
+	}
+}
+
+func TestDispatcher_AdviceReconnectNone(t *testing.T) {
+	d, ft := newTestDispatcher(t, nil)
+
+	var disconnectErr error
+	disconnected := make(chan struct{})
+	d.OnDisconnect(func(err error) {
+		disconnectErr = err
+		close(disconnected)
+	})
+
+	//pending operations waiting for the server
+	publishErr := make(chan error, 1)
+	go func() {
+		publishErr <- d.Publish("/foo", "bar")
+	}()
+	subscribeErr := make(chan error, 1)
+	go func() {
+		_, err := d.Subscribe("/foo")
+		subscribeErr <- err
+	}()
+	waitSent(t, ft, 3) //connect + publish + subscribe
+
+	ft.deliver(&message.Message{
+		Channel:    message.MetaConnect,
+		Successful: false,
+		Advice:     &message.Advise{Reconnect: message.ReconnectNone},
+	})
+
+	select {
+	case <-disconnected:
+	case <-time.After(time.Second):
+		t.Fatal("disconnect handler not called")
+	}
+	if disconnectErr != ErrReconnectNone {
+		t.Fatalf("expecting ErrReconnectNone got: %v", disconnectErr)
+	}
+	for _, errCh := range []chan error{publishErr, subscribeErr} {
+		select {
+		case err := <-errCh:
+			if err != ErrReconnectNone {
+				t.Fatalf("expecting ErrReconnectNone got: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("pending operation not failed")
+		}
+	}
+
+	//the client must not be used anymore
+	if err := d.Publish("/foo", "bar"); err != ErrReconnectNone {
+		t.Fatalf("expecting ErrReconnectNone got: %v", err)
+	}
+	if _, err := d.Subscribe("/foo"); err != ErrReconnectNone {
+		t.Fatalf("expecting ErrReconnectNone got: %v", err)
+	}
+	if d.Advice().Reconnect != message.ReconnectNone {
+		t.Fatalf("expecting advice to be stored got: %v", d.Advice())
+	}
+}
+
+func TestDispatcher_OnAdvice(t *testing.T) {
+	d, ft := newTestDispatcher(t, nil)
+	var observed []message.Advise
+	d.OnAdvice(func(advice message.Advise) {
+		observed = append(observed, advice)
+	})
+	advices := []message.Advise{
+		{Reconnect: message.ReconnectRetry, Interval: time.Second, Timeout: 30 * time.Second},
+		{Reconnect: message.ReconnectNone},
+	}
+	for i := range advices {
+		ft.deliver(&message.Message{Channel: message.MetaConnect, Successful: true, Advice: &advices[i]})
+	}
+	if !reflect.DeepEqual(observed, advices) {
+		t.Fatalf("expecting %v observed got: %v", advices, observed)
+	}
+	//the client acted on the advice before the handler
+	if err := d.terminated(); err != ErrReconnectNone {
+		t.Fatalf("expecting %v got: %v", ErrReconnectNone, err)
+	}
+}
+
+func TestDispatcher_AdviceRetryKeepsClient(t *testing.T) {
+	d, ft := newTestDispatcher(t, nil)
+	d.OnDisconnect(func(err error) {
+		t.Fatalf("unexpected disconnect: %v", err)
+	})
+
+	ft.deliver(&message.Message{
+		Channel:    message.MetaConnect,
+		Successful: true,
+		Advice:     &message.Advise{Reconnect: message.ReconnectRetry, Interval: time.Second},
+	})
+	if err := d.terminated(); err != nil {
+		t.Fatalf("expecting usable client got: %v", err)
+	}
+}
+
+//waitSent waits until the transport sent at least n messages
+func waitSent(t *testing.T, ft *fakeTransport, n int) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		ft.mu.Lock()
+		sent := len(ft.sent)
+		ft.mu.Unlock()
+		if sent >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("expecting %d messages sent", n)
+}
+
+func TestDispatcher_ClientIDFromTransport(t *testing.T) {
+	d, ft := newTestDispatcher(t, nil)
+	go d.PublishWithTimeout("/foo", "bar", 10*time.Millisecond)
+	waitSent(t, ft, 2)
+
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	for i := range ft.sent {
+		if ft.sent[i].ClientId != "fake-client" {
+			t.Fatalf("expecting clientId `fake-client` got: `%s`", ft.sent[i].ClientId)
+		}
+	}
+}
+
+func TestDispatcher_UnsubscribePattern(t *testing.T) {
+	d, ft := newTestDispatcher(t, ackSubscriptions)
+	for _, channel := range []string{"/chat/a", "/chat/b", "/chat/a", "/chat/*", "/news"} {
+		if _, err := d.Subscribe(channel); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := d.UnsubscribePattern("/chat/**"); err != nil {
+		t.Fatal(err)
+	}
+
+	ft.mu.Lock()
+	batches := ft.batches
+	ft.mu.Unlock()
+	if len(batches) != 1 {
+		t.Fatalf("expecting 1 batch got: %d", len(batches))
+	}
+	unsubscribed := map[string]bool{}
+	for _, m := range batches[0] {
+		if m.Channel != message.MetaUnsubscribe {
+			t.Fatalf("expecting unsubscribe got: %s", m.Channel)
+		}
+		unsubscribed[m.Subscription] = true
+	}
+	expected := map[string]bool{"/chat/a": true, "/chat/b": true, "/chat/*": true}
+	if !reflect.DeepEqual(unsubscribed, expected) {
+		t.Fatalf("expecting %v got: %v", expected, unsubscribed)
+	}
+	if len(d.store.Covered("/**")) != 1 {
+		t.Fatal("expecting only /news to remain subscribed")
+	}
+
+	if err := d.UnsubscribeAll(); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.store.Covered("/**")) != 0 {
+		t.Fatal("expecting no subscriptions")
+	}
+}
+
+func TestDispatcher_HandshakeClientExt(t *testing.T) {
+	ft := &fakeTransport{}
+	var handshake *message.Message
+	ft.onHandshake = func(m *message.Message) {
+		handshake = m
+	}
+	connectTestDispatcher(t, ft)
+
+	ext, _ := handshake.Ext.(map[string]interface{})
+	client, _ := ext["client"].(map[string]interface{})
+	if client["version"] != version.Version || client["name"] != version.Name {
+		t.Fatalf("expecting ext.client with the library version got: %v", handshake.Ext)
+	}
+}
+
+func TestDispatcher_HandshakeHooks(t *testing.T) {
+	ft := &fakeTransport{handshakeExt: map[string]interface{}{"capability": true}}
+	var sent *message.Message
+	ft.onHandshake = func(m *message.Message) {
+		sent = m
+	}
+	d := NewDispatcher("fake://", transport.Options{}, message.Extensions{
+		Out: []message.ContextExtension{func(_ context.Context, m *message.Message) {
+			//extensions run after the hook
+			if m.Channel == message.MetaHandshake && m.Ext.(map[string]interface{})["auth"] != "token" {
+				t.Fatal("expecting the hook to run before the extensions")
+			}
+		}},
+	})
+	d.SetTransport(ft)
+
+	var resp *message.Message
+	d.OnBeforeHandshake(func(m *message.Message) {
+		m.Ext.(map[string]interface{})["auth"] = "token"
+	})
+	d.OnHandshakeComplete(func(r *message.Message) {
+		resp = r
+	})
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	if sent.Ext.(map[string]interface{})["auth"] != "token" {
+		t.Fatal("expecting the handshake to be modified by the hook")
+	}
+	if resp == nil || resp.Ext.(map[string]interface{})["capability"] != true {
+		t.Fatalf("expecting the handshake response got: %v", resp)
+	}
+}
+
+func TestDispatcher_StagedConnect(t *testing.T) {
+	ft := &fakeTransport{reply: func(ft *fakeTransport, m *message.Message) {
+		if m.Channel == message.MetaConnect {
+			go ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Successful: true})
+		}
+	}}
+	d := NewDispatcher("fake://", transport.Options{}, message.Extensions{})
+	d.SetTransport(ft)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	hs, err := d.Handshake(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hs.ClientId != "fake-client" {
+		t.Fatalf("expecting handshake response got: %#v", hs)
+	}
+
+	resp, err := d.Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Channel != message.MetaConnect || !resp.Successful {
+		t.Fatalf("expecting connect response got: %#v", resp)
+	}
+	//only the first connect is driven by the application
+	deadline := time.Now().Add(time.Second)
+	for countChannel(ft, message.MetaConnect) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("expecting the next connect sent")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err = d.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDispatcher_ConnectContextDone(t *testing.T) {
+	d, _ := newTestDispatcher(t, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := d.Connect(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expecting context.DeadlineExceeded got: %v", err)
+	}
+}
+
+func TestDispatcher_ManualConnect(t *testing.T) {
+	ft := &fakeTransport{reply: func(ft *fakeTransport, m *message.Message) {
+		if m.Channel == message.MetaConnect {
+			go ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Successful: true})
+		}
+	}}
+	d := NewDispatcher("fake://", transport.Options{}, message.Extensions{})
+	d.SetTransport(ft)
+	d.SetManualConnect(true)
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	ft.mu.Lock()
+	sent := len(ft.sent)
+	ft.mu.Unlock()
+	if sent != 0 {
+		t.Fatalf("expecting no automatic connect got %d messages", sent)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := d.Connect(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitSent(t, ft, 2)
+}
+
+func TestDispatcher_ConnectTimeout(t *testing.T) {
+	for _, timeout := range []time.Duration{0, 5 * time.Second} {
+		ft := &fakeTransport{}
+		d := NewDispatcher("fake://", transport.Options{}, message.Extensions{})
+		d.SetTransport(ft)
+		d.SetConnectTimeout(timeout)
+		if err := d.Start(); err != nil {
+			t.Fatal(err)
+		}
+		waitSent(t, ft, 1)
+
+		b, err := json.Marshal(ft.sent[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := fmt.Sprintf(`"advice":{"timeout":%d}`, timeout/time.Millisecond)
+		if !strings.Contains(string(b), expected) {
+			t.Fatalf("expecting %s in %s", expected, b)
+		}
+	}
+}
+
+func TestDispatcher_UnexpectedSubscribeResponse(t *testing.T) {
+	d, ft := newTestDispatcher(t, nil)
+
+	errCh := make(chan error, 1)
+	d.OnError(func(err error) {
+		errCh <- err
+	})
+	ft.deliver(&message.Message{Channel: message.MetaSubscribe, Id: "unknown", Subscription: "/foo", Successful: true})
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, ErrUnexpectedMessage) {
+			t.Fatalf("expecting %v got: %v", ErrUnexpectedMessage, err)
+		}
+	default:
+		t.Fatal("expecting the unexpected response to be reported")
+	}
+}
+
+func TestDispatcher_ExtensionContext(t *testing.T) {
+	type ctxKey struct{}
+	var (
+		mu       sync.Mutex
+		seen     = map[string]context.Context{}
+		recordAs = func(dir string) message.ContextExtension {
+			return func(ctx context.Context, m *message.Message) {
+				mu.Lock()
+				seen[dir+m.Channel] = ctx
+				mu.Unlock()
+			}
+		}
+	)
+	ft := &fakeTransport{}
+	d := NewDispatcher("fake://", transport.Options{}, message.Extensions{
+		In:  []message.ContextExtension{recordAs("in")},
+		Out: []message.ContextExtension{recordAs("out")},
+	})
+	d.SetTransport(ft)
+
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), ctxKey{}, "trace"), time.Minute)
+	defer cancel()
+	if _, err := d.Handshake(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	out := seen["out"+message.MetaHandshake]
+	if out == nil {
+		t.Fatal("expecting the outgoing extension to run on the handshake")
+	}
+	if _, ok := out.Deadline(); !ok || out.Value(ctxKey{}) != "trace" {
+		t.Fatal("expecting the handshake context to be passed to the extension")
+	}
+	info, ok := message.ClientInfoFromContext(seen["in"+message.MetaHandshake])
+	if !ok || info.ClientID != "fake-client" || info.Endpoint != "fake://" {
+		t.Fatalf("unexpected client info: %+v", info)
+	}
+}
+
+func TestDispatcher_Balancer(t *testing.T) {
+	b, err := balancer.New([]string{"ws://a", "ws://b"}, balancer.LeastConnections)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ft := &fakeTransport{}
+	d := NewDispatcher("ws://ignored", transport.Options{}, message.Extensions{})
+	d.SetTransport(ft)
+	d.SetBalancer(b)
+	if err = d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if got := ft.endpoint; got != "ws://a" {
+		t.Fatalf("expecting the balancer endpoint got: %s", got)
+	}
+	if got := b.Endpoints()[0]; got != "ws://b" {
+		t.Fatalf("expecting the connection counted by the balancer got: %s first", got)
+	}
+
+	d.terminate(ErrReconnectNone)
+	if got := b.Endpoints()[0]; got != "ws://a" {
+		t.Fatalf("expecting the connection released got: %s first", got)
+	}
+}
+
+//rejectingTransport rejects the handshakes on the endpoint rejected
+type rejectingTransport struct {
+	*fakeTransport
+	rejected string
+}
+
+func (t *rejectingTransport) Handshake(msg *message.Message) (*message.Message, error) {
+	t.mu.Lock()
+	endpoint := t.endpoint
+	t.mu.Unlock()
+	if endpoint == t.rejected {
+		return &message.Message{Channel: message.MetaHandshake, Error: "403::forbidden"}, nil
+	}
+	return t.fakeTransport.Handshake(msg)
+}
+
+func TestDispatcher_FailoverEndpoints(t *testing.T) {
+	var tests = []struct {
+		endpoint string
+		//unreachable endpoints fail to dial
+		unreachable int
+		rejected    string
+		expected    string
+		err         error
+	}{
+		{"ws://a", 0, "", "ws://a", nil},
+		{"ws://a", 1, "", "ws://b", nil},
+		{"ws://a", 0, "ws://a", "ws://b", nil},
+		{"ws://a", 1, "ws://b", "ws://c", nil},
+		{"", 0, "", "ws://b", nil},
+		{"ws://a", 3, "", "", errors.New("unreachable")},
+	}
+	for _, tt := range tests {
+		ft := &fakeTransport{}
+		for i := 0; i < tt.unreachable; i++ {
+			ft.initErrs = append(ft.initErrs, errors.New("unreachable"))
+		}
+		d := NewDispatcher(tt.endpoint, transport.Options{}, message.Extensions{})
+		d.SetTransport(&rejectingTransport{fakeTransport: ft, rejected: tt.rejected})
+		d.SetFailoverEndpoints([]string{"ws://b", "ws://c"})
+		err := d.Start()
+		if tt.err != nil {
+			if err == nil || err.Error() != tt.err.Error() {
+				t.Fatalf("%+v: expecting %v got: %v", tt, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%+v: %v", tt, err)
+		}
+		if got := ft.endpoint; got != tt.expected {
+			t.Fatalf("%+v: expecting %s got: %s", tt, tt.expected, got)
+		}
+	}
+
+	d := NewDispatcher("", transport.Options{}, message.Extensions{})
+	d.SetTransport(&fakeTransport{})
+	if err := d.Start(); err != ErrNoEndpoint {
+		t.Fatalf("expecting %v got: %v", ErrNoEndpoint, err)
+	}
+}
+
+func TestDispatcher_ValidateChannels(t *testing.T) {
+	d, ft := newTestDispatcher(t, nil)
+	waitSent(t, ft, 1)
+
+	if err := d.Publish("/foo/*", "a"); !errors.Is(err, channel.ErrWildcardPublish) {
+		t.Fatalf("expecting %v got: %v", channel.ErrWildcardPublish, err)
+	}
+	if _, err := d.Subscribe("/meta/connect"); !errors.Is(err, channel.ErrMetaChannel) {
+		t.Fatalf("expecting %v got: %v", channel.ErrMetaChannel, err)
+	}
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	if len(ft.sent) != 1 {
+		t.Fatalf("expecting only the connect sent got: %d messages", len(ft.sent))
+	}
+}
+
+func TestDispatcher_SubscribeCoalescing(t *testing.T) {
+	release := make(chan struct{})
+	d, ft := newTestDispatcher(t, func(ft *fakeTransport, m *message.Message) {
+		if m.Channel == message.MetaSubscribe {
+			go func() {
+				<-release
+				ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Subscription: m.Subscription, Successful: true})
+			}()
+			return
+		}
+		ackSubscriptions(ft, m)
+	})
+	countSent := func(channel string) int {
+		ft.mu.Lock()
+		defer ft.mu.Unlock()
+		n := 0
+		for _, m := range ft.sent {
+			if m.Channel == channel {
+				n++
+			}
+		}
+		return n
+	}
+
+	//concurrent subscribes share the subscribe in flight
+	subs := make(chan *subscription.Subscription, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			sub, err := d.Subscribe("/foo")
+			if err != nil {
+				t.Error(err)
+			}
+			subs <- sub
+		}()
+	}
+	for countSent(message.MetaSubscribe) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	first, second := <-subs, <-subs
+
+	//and later ones the confirmed server subscription
+	third, err := d.Subscribe("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countSent(message.MetaSubscribe); n != 1 {
+		t.Fatalf("expecting a single server subscribe got: %d", n)
+	}
+
+	for i, sub := range []*subscription.Subscription{first, second, third} {
+		if err = sub.Unsubscribe(); err != nil {
+			t.Fatal(err)
+		}
+		expected := 0
+		if i == 2 {
+			expected = 1
+		}
+		if n := countSent(message.MetaUnsubscribe); n != expected {
+			t.Fatalf("expecting %d server unsubscribe after %d unsubscribes got: %d", expected, i+1, n)
+		}
+	}
+}
+
+func TestDispatcher_UnsubscribeOnDone(t *testing.T) {
+	d, ft := newTestDispatcher(t, ackSubscriptions)
+	unsubscribes := func() int {
+		ft.mu.Lock()
+		defer ft.mu.Unlock()
+		n := 0
+		for _, m := range ft.sent {
+			if m.Channel == message.MetaUnsubscribe && m.Subscription == "/foo" {
+				n++
+			}
+		}
+		return n
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sub, err := d.Subscribe("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.UnsubscribeOnDone(ctx, sub)
+
+	cancel()
+	if _, ok := <-sub.MsgChannel(); ok {
+		t.Fatal("expecting the subscription channel to be closed")
+	}
+	for unsubscribes() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	//unsubscribing again is a no-op
+	if err = sub.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	if n := unsubscribes(); n != 1 {
+		t.Fatalf("expecting a single unsubscribe got: %d", n)
+	}
+}
+
+//afterFuncContext is never done, it records the release of the funcs registered with context.AfterFunc
+type afterFuncContext struct {
+	context.Context
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func (c *afterFuncContext) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *afterFuncContext) AfterFunc(f func()) func() bool {
+	return func() bool {
+		close(c.stopped)
+		return true
+	}
+}
+
+func TestDispatcher_UnsubscribeOnDoneReleased(t *testing.T) {
+	d, _ := newTestDispatcher(t, ackSubscriptions)
+	sub, err := d.Subscribe("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &afterFuncContext{Context: context.Background(), done: make(chan struct{}), stopped: make(chan struct{})}
+	d.UnsubscribeOnDone(ctx, sub)
+
+	//removed otherwise, the ctx doesn't keep the subscription anymore
+	if err = sub.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ctx.stopped:
+	case <-time.After(time.Second):
+		t.Fatal("expecting the ctx registration released")
+	}
+}
+
+func TestDispatcher_UnsubscribeResponse(t *testing.T) {
+	d, ft := newTestDispatcher(t, func(ft *fakeTransport, m *message.Message) {
+		switch {
+		case m.Channel == message.MetaUnsubscribe && m.Subscription == "/denied":
+			go ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Subscription: m.Subscription, Error: "403::forbidden"})
+		default:
+			ackSubscriptions(ft, m)
+		}
+	})
+	var reported error
+	d.OnError(func(err error) {
+		reported = err
+	})
+
+	for _, name := range []string{"/foo", "/denied"} {
+		sub, err := d.Subscribe(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = sub.Unsubscribe()
+		if name == "/denied" && (err == nil || err.Error() != "403::forbidden") {
+			t.Fatalf("expecting the server error got: %v", err)
+		} else if name == "/foo" && err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := <-sub.MsgChannel(); ok {
+			t.Fatalf("expecting %s closed", name)
+		}
+	}
+
+	//a response nobody waits for is reported
+	ft.deliver(&message.Message{Channel: message.MetaUnsubscribe, Id: "unknown", Subscription: "/foo", Successful: true})
+	if !errors.Is(reported, ErrUnexpectedMessage) {
+		t.Fatalf("expecting ErrUnexpectedMessage got: %v", reported)
+	}
+}
+
+func TestDispatcher_UnsubscribeTimeout(t *testing.T) {
+	//the server never confirms the unsubscribes
+	d, _ := newTestDispatcher(t, func(ft *fakeTransport, m *message.Message) {
+		if m.Channel != message.MetaUnsubscribe {
+			ackSubscriptions(ft, m)
+		}
+	})
+	d.SetUnsubscribeTimeout(10 * time.Millisecond)
+
+	for _, unsubscribe := range []func(sub *subscription.Subscription) error{
+		(*subscription.Subscription).Unsubscribe,
+		func(*subscription.Subscription) error { return d.UnsubscribeAll() },
+	} {
+		sub, err := d.Subscribe("/foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = d.Subscribe("/bar"); err != nil {
+			t.Fatal(err)
+		}
+		if err = unsubscribe(sub); err != ErrUnsubscribeTimeout || !errors.Is(err, ErrTimeout) {
+			t.Fatalf("expecting ErrUnsubscribeTimeout got: %v", err)
+		}
+		if _, ok := <-sub.MsgChannel(); ok {
+			t.Fatal("expecting the subscription closed")
+		}
+		d.UnsubscribeAll()
+	}
+}
+
+func TestDispatcher_SubscribeConfirmation(t *testing.T) {
+	responses := make(chan *message.Message, 1)
+	d, ft := newTestDispatcher(t, func(ft *fakeTransport, m *message.Message) {
+		if m.Channel == message.MetaSubscribe {
+			responses <- &message.Message{Channel: m.Channel, Id: m.Id, Subscription: m.Subscription}
+		}
+	})
+
+	tests := []struct {
+		name       string
+		successful bool
+		err        string
+	}{
+		{name: "accepted", successful: true},
+		{name: "rejected", err: "subscription `/foo` failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			type result struct {
+				sub *subscription.Subscription
+				err error
+			}
+			done := make(chan result, 1)
+			go func() {
+				sub, err := d.Subscribe("/foo")
+				done <- result{sub, err}
+			}()
+
+			resp := <-responses
+			select {
+			case <-done:
+				t.Fatal("expecting Subscribe to wait for the server response")
+			case <-time.After(10 * time.Millisecond):
+			}
+			resp.Successful = tt.successful
+			ft.deliver(resp)
+
+			select {
+			case r := <-done:
+				if tt.successful && (r.err != nil || r.sub == nil) {
+					t.Fatalf("expecting the subscription got: %v", r.err)
+				}
+				if !tt.successful && (r.err == nil || r.err.Error() != tt.err) {
+					t.Fatalf("expecting %s got: %v", tt.err, r.err)
+				}
+				if r.sub != nil {
+					d.store.Remove(r.sub)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("expecting Subscribe to return once the server responds")
+			}
+		})
+	}
+}
+
+func TestDispatcher_SubscriptionState(t *testing.T) {
+	release := make(chan struct{})
+	d, _ := newTestDispatcher(t, func(ft *fakeTransport, m *message.Message) {
+		if m.Channel == message.MetaUnsubscribe {
+			go func() {
+				<-release
+				ackSubscriptions(ft, m)
+			}()
+			return
+		}
+		ackSubscriptions(ft, m)
+	})
+
+	sub, err := d.Subscribe("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := sub.State(); state != subscription.StateActive {
+		t.Fatalf("expecting active got: %v", state)
+	}
+
+	unsubscribed := make(chan error, 1)
+	go func() {
+		unsubscribed <- sub.Unsubscribe()
+	}()
+	for sub.State() != subscription.StateUnsubscribing {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	if err = <-unsubscribed; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-sub.Done():
+	default:
+		t.Fatalf("expecting closed got: %v", sub.State())
+	}
+
+	//subscriptions are closed when the client terminates
+	if sub, err = d.Subscribe("/bar"); err != nil {
+		t.Fatal(err)
+	}
+	d.terminate(ErrReconnectNone)
+	if state := sub.State(); state != subscription.StateClosed {
+		t.Fatalf("expecting closed got: %v", state)
+	}
+}
+
+func TestDispatcher_ExtensionPanic(t *testing.T) {
+	d, ft := newTestDispatcher(t, ackSubscriptions)
+	if err := d.SetChannelConfigs([]channel.Config{{Pattern: "/foo", BufferSize: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := d.Subscribe("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reported error
+	d.OnError(func(err error) {
+		reported = err
+	})
+	bad := func(_ context.Context, m *message.Message) {
+		if m.Data == "bad" {
+			panic("bad extension")
+		}
+	}
+	exts := message.Extensions{In: []message.ContextExtension{bad}, Out: []message.ContextExtension{bad}}
+	for _, pipe := range exts.Pipes() {
+		d.AddExtension(pipe)
+	}
+
+	var panicErr *message.PanicError
+	ft.deliver(&message.Message{Channel: "/foo", Data: "bad"})
+	if !errors.As(reported, &panicErr) {
+		t.Fatalf("expecting the panic reported got: %v", reported)
+	}
+	ft.deliver(&message.Message{Channel: "/foo", Data: "good"})
+	if msg := <-sub.MsgChannel(); msg.Data != "good" {
+		t.Fatalf("expecting the message failing the extension dropped got: %v", msg.Data)
+	}
+
+	if err = d.PublishWithTimeout("/foo", "bad", time.Second); !errors.As(err, &panicErr) {
+		t.Fatalf("expecting the panic returned got: %v", err)
+	}
+}
+
+func TestDispatcher_PublishCtx(t *testing.T) {
+	d, _ := newTestDispatcher(t, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := d.PublishCtx(ctx, "/foo", "bar", 0); err != context.DeadlineExceeded {
+		t.Fatalf("expecting context.DeadlineExceeded got: %v", err)
+	}
+	d.publishACKmu.Lock()
+	pending := len(d.publishACK)
+	d.publishACKmu.Unlock()
+	if pending != 0 {
+		t.Fatalf("expecting the ack to be forgotten got %d pending", pending)
+	}
+}
+
+func TestDispatcher_PublishWithAck(t *testing.T) {
+	d, _ := newTestDispatcher(t, func(ft *fakeTransport, m *message.Message) {
+		if m.Channel != "/metrics/cpu" {
+			return
+		}
+		resp := &message.Message{Channel: m.Channel, Id: m.Id, Successful: true}
+		if m.Data == "bad" {
+			resp.Successful, resp.Error = false, "400::bad"
+		}
+		go ft.deliver(resp)
+	})
+	if err := d.SetChannelConfigs([]channel.Config{{Pattern: "/metrics/**", SkipAck: true}}); err != nil {
+		t.Fatal(err)
+	}
+
+	//concurrent publishes get the response to their own message
+	var wg sync.WaitGroup
+	for _, data := range []string{"good", "bad", "good", "bad"} {
+		wg.Add(1)
+		go func(data string) {
+			defer wg.Done()
+			err := d.PublishWithAck(context.Background(), "/metrics/cpu", data, time.Second)
+			if (err != nil) != (data == "bad") {
+				t.Errorf("unexpected error for %s: %v", data, err)
+			}
+		}(data)
+	}
+	wg.Wait()
+
+	//the ack is awaited despite SkipAck
+	if err := d.PublishWithAck(context.Background(), "/metrics/mem", "1", 10*time.Millisecond); err != ErrAckTimeout {
+		t.Fatalf("expecting ErrAckTimeout got: %v", err)
+	}
+}
+
+func TestDispatcher_SubscribeCtx(t *testing.T) {
+	subscribed := make(chan *message.Message, 1)
+	d, ft := newTestDispatcher(t, func(ft *fakeTransport, m *message.Message) {
+		if m.Channel == message.MetaSubscribe {
+			subscribed <- m
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := d.SubscribeCtx(ctx, "/foo"); err != context.DeadlineExceeded {
+		t.Fatalf("expecting context.DeadlineExceeded got: %v", err)
+	}
+
+	//the subscription acknowledged late is removed
+	m := <-subscribed
+	ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Subscription: m.Subscription, Successful: true})
+	for {
+		if last := lastSent(ft); last.Channel == message.MetaUnsubscribe && last.Subscription == "/foo" {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if d.SubscriptionActive("/foo") {
+		t.Fatal("expecting no active subscription")
+	}
+}
+
+func lastSent(ft *fakeTransport) *message.Message {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	return ft.sent[len(ft.sent)-1]
+}
+
+func TestDispatcher_HandleMessages(t *testing.T) {
+	d, ft := newTestDispatcher(t, ackSubscriptions)
+	if err := d.SetChannelConfigs([]channel.Config{{Pattern: "/foo", BufferSize: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 1)
+	d.OnError(func(err error) {
+		errs <- err
+	})
+
+	sub, err := d.Subscribe("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan message.Data, 1)
+	d.HandleMessages(sub, func(channel string, msg message.Data) {
+		if msg == "boom" {
+			panic(msg)
+		}
+		received <- msg
+	})
+
+	ft.deliver(&message.Message{Channel: "/foo", Data: "hello"})
+	if msg := <-received; msg != "hello" {
+		t.Fatalf("expecting hello got %v", msg)
+	}
+	ft.deliver(&message.Message{Channel: "/foo", Data: "boom"})
+	var panicErr *message.PanicError
+	if err = <-errs; !errors.As(err, &panicErr) {
+		t.Fatalf("expecting a *message.PanicError got: %v", err)
+	}
+}
+
+func TestDispatcher_WildcardDelivery(t *testing.T) {
+	d, ft := newTestDispatcher(t, ackSubscriptions)
+	if err := d.SetChannelConfigs([]channel.Config{{Pattern: "/chat/**", BufferSize: 10}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Subscribe("/chat/*/bar"); err == nil {
+		t.Fatal("expecting an error for a wildcard in the middle of the channel")
+	}
+	all, err := d.Subscribe("/chat/**")
+	if err != nil {
+		t.Fatal(err)
+	}
+	children, err := d.Subscribe("/chat/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"/chat/foo", "/chat/foo/bar", "/chatroom", "/other/foo"} {
+		ft.deliver(&message.Message{Channel: name, Data: name})
+	}
+	if n := len(all.MsgChannel()); n != 2 {
+		t.Fatalf("expecting /chat/** to receive 2 messages got: %d", n)
+	}
+	if n := len(children.MsgChannel()); n != 1 {
+		t.Fatalf("expecting /chat/* to receive 1 message got: %d", n)
+	}
+	if msg := <-children.MsgChannel(); msg.Channel != "/chat/foo" {
+		t.Fatalf("expecting /chat/foo got: %s", msg.Channel)
+	}
+}
+
+func TestDispatcher_SubscriptionsSameChannel(t *testing.T) {
+	d, ft := newTestDispatcher(t, ackSubscriptions)
+	if err := d.SetChannelConfigs([]channel.Config{{Pattern: "/foo", BufferSize: 10}}); err != nil {
+		t.Fatal(err)
+	}
+	first, err := d.Subscribe("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := d.Subscribe("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//every subscription receives its own copy
+	ft.deliver(&message.Message{Channel: "/foo", Data: "a"})
+	if len(first.MsgChannel()) != 1 || len(second.MsgChannel()) != 1 {
+		t.Fatalf("expecting both subscriptions to receive the message got: %d, %d", len(first.MsgChannel()), len(second.MsgChannel()))
+	}
+
+	//and removing one leaves the other subscribed
+	if err = first.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	ft.deliver(&message.Message{Channel: "/foo", Data: "b"})
+	if len(second.MsgChannel()) != 2 {
+		t.Fatalf("expecting the remaining subscription to receive the message got: %d", len(second.MsgChannel()))
+	}
+	if !d.SubscriptionActive("/foo") {
+		t.Fatal("expecting /foo still subscribed")
+	}
+}
+
+func BenchmarkDispatcher_Publish(b *testing.B) {
+	d := NewDispatcher("fake://", transport.Options{}, message.Extensions{})
+	d.SetTransport(&fakeTransport{discard: true})
+	if err := d.SetChannelConfigs([]channel.Config{{Pattern: "/foo", SkipAck: true}}); err != nil {
+		b.Fatal(err)
+	}
+	if err := d.Start(); err != nil {
+		b.Fatal(err)
+	}
+	data := map[string]interface{}{"k": "v"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := d.Publish("/foo", data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDispatcher_Deliver(b *testing.B) {
+	ft := &fakeTransport{discard: true, reply: ackSubscriptions}
+	d := NewDispatcher("fake://", transport.Options{}, message.Extensions{})
+	d.SetTransport(ft)
+	if err := d.SetChannelConfigs([]channel.Config{{Pattern: "/**", BufferSize: 1, Overflow: channel.DropOldest}}); err != nil {
+		b.Fatal(err)
+	}
+	if err := d.Start(); err != nil {
+		b.Fatal(err)
+	}
+	//the delivery fans out to the subscriptions of the channel and of the wildcards matching it
+	for _, name := range []string{"/foo/bar", "/foo/bar", "/foo/*", "/foo/**", "/**", "/other"} {
+		if _, err := d.Subscribe(name); err != nil {
+			b.Fatal(err)
+		}
+	}
+	msg := &message.Message{Channel: "/foo/bar", Data: map[string]interface{}{"k": "v"}}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ft.deliver(msg)
+	}
+}
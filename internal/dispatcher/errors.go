@@ -0,0 +1,50 @@
+package dispatcher
+
+import (
+	"errors"
+	"fmt"
+)
+
+//ErrTimeout is matched by errors.Is on the errors of the operations that timed out, e.g. ErrAckTimeout
+var ErrTimeout = errors.New("timeout")
+
+//ErrConnectionClosed is matched by errors.Is on the errors of the operations attempted once the client is
+//terminally disconnected, e.g. ErrDisconnected or ErrReconnectFailed
+var ErrConnectionClosed = errors.New("connection closed")
+
+//ErrHandshakeDenied is matched by errors.Is on the errors of the handshakes the server rejected
+var ErrHandshakeDenied = errors.New("handshake denied")
+
+//ErrSubscriptionFailed is matched by errors.Is on the errors of the subscribes the server rejected, see SubscriptionError
+var ErrSubscriptionFailed = errors.New("subscription failed")
+
+//kindError is an error matching its kind with errors.Is, err is its cause if any
+type kindError struct {
+	msg  string
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string        { return e.msg }
+func (e *kindError) Is(target error) bool { return target == e.kind }
+func (e *kindError) Unwrap() error        { return e.err }
+
+//SubscriptionError is returned when the server rejects a subscribe, it matches ErrSubscriptionFailed
+type SubscriptionError struct {
+	//Channel is the channel subscribed
+	Channel string
+	//Code is the Bayeux code of the server error, 0 if the server didn't send one
+	Code int
+	//Err is the server error, a *message.Error, nil if the server didn't send one
+	Err error
+}
+
+func (e *SubscriptionError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("subscription `%s` failed", e.Channel)
+}
+
+func (e *SubscriptionError) Is(target error) bool { return target == ErrSubscriptionFailed }
+func (e *SubscriptionError) Unwrap() error        { return e.Err }
@@ -0,0 +1,58 @@
+package dispatcher
+
+import (
+	"errors"
+	"fmt"
+	"github.com/thesyncim/faye/message"
+	"testing"
+)
+
+func TestErrors_Kinds(t *testing.T) {
+	var tests = []struct {
+		err  error
+		kind error
+	}{
+		{ErrAckTimeout, ErrTimeout},
+		{ErrResponseTimeout, ErrTimeout},
+		{ErrDisconnected, ErrConnectionClosed},
+		{ErrReconnectNone, ErrConnectionClosed},
+		{fmt.Errorf("%w after 3 attempts", ErrReconnectFailed), ErrConnectionClosed},
+		{ErrHandshakeFailed, ErrHandshakeDenied},
+	}
+	for _, tt := range tests {
+		if !errors.Is(tt.err, tt.kind) {
+			t.Fatalf("expecting %v to be %v", tt.err, tt.kind)
+		}
+	}
+	if errors.Is(ErrAckTimeout, ErrConnectionClosed) {
+		t.Fatal("expecting the kinds told apart")
+	}
+}
+
+func TestDispatcher_SubscriptionError(t *testing.T) {
+	d, _ := newTestDispatcher(t, func(ft *fakeTransport, m *message.Message) {
+		if m.Channel == message.MetaSubscribe {
+			go ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Subscription: m.Subscription, Error: "403:" + m.Subscription + ":forbidden"})
+		}
+	})
+
+	_, err := d.Subscribe("/foo")
+	if !errors.Is(err, ErrSubscriptionFailed) {
+		t.Fatalf("expecting %v got: %v", ErrSubscriptionFailed, err)
+	}
+	var subErr *SubscriptionError
+	if !errors.As(err, &subErr) || subErr.Channel != "/foo" || subErr.Code != 403 {
+		t.Fatalf("expecting the subscription error of /foo with code 403 got: %+v", subErr)
+	}
+	var bayeux *message.Error
+	if !errors.As(err, &bayeux) || bayeux.Description != "forbidden" || err.Error() != "403:/foo:forbidden" {
+		t.Fatalf("expecting the server error got: %v", err)
+	}
+
+	if err = d.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Subscribe("/foo"); !errors.Is(err, ErrConnectionClosed) {
+		t.Fatalf("expecting %v got: %v", ErrConnectionClosed, err)
+	}
+}
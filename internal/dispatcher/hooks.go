@@ -0,0 +1,112 @@
+package dispatcher
+
+import (
+	"github.com/thesyncim/faye/internal/event"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/subscription"
+	"time"
+)
+
+//EventType identifies a transition of the client lifecycle, see On
+type EventType int
+
+const (
+	//EventHandshake is emitted with the successful handshake response Message
+	EventHandshake EventType = iota
+	//EventConnected is emitted when the session becomes connected, after a handshake or a reconnection
+	EventConnected
+	//EventDisconnected is emitted once, when the client is terminally disconnected. Err is the cause, nil after
+	//Disconnect
+	EventDisconnected
+	//EventReconnectScheduled is emitted before every reconnect Attempt to Endpoint, made after Delay. Err is
+	//the error of the previous attempt, or the cause of the reconnection for the first one
+	EventReconnectScheduled
+	//EventSubscriptionAdded is emitted once the server acknowledged the Subscription to Channel
+	EventSubscriptionAdded
+	//EventSubscriptionRemoved is emitted when the Subscription to Channel is removed. Err is set when the server
+	//dropped it or the client was disconnected by an error
+	EventSubscriptionRemoved
+	//EventMessageSent is emitted with every Message handed to the transport, once the outgoing extensions ran
+	EventMessageSent
+	//EventMessageReceived is emitted with every Message received, once the incoming extensions ran
+	EventMessageReceived
+	//EventError is emitted with the asynchronous errors not returned to a caller, Message is set when the error
+	//is tied to one
+	EventError
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventHandshake:
+		return "handshake"
+	case EventConnected:
+		return "connected"
+	case EventDisconnected:
+		return "disconnected"
+	case EventReconnectScheduled:
+		return "reconnect scheduled"
+	case EventSubscriptionAdded:
+		return "subscription added"
+	case EventSubscriptionRemoved:
+		return "subscription removed"
+	case EventMessageSent:
+		return "message sent"
+	case EventMessageReceived:
+		return "message received"
+	case EventError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+//eventTypes maps the lifecycle events to the internal ones they are built from
+var eventTypes = map[EventType]event.Type{
+	EventHandshake:           event.HandshakeComplete,
+	EventConnected:           event.StateChange,
+	EventDisconnected:        event.Disconnected,
+	EventReconnectScheduled:  event.ReconnectAttempt,
+	EventSubscriptionAdded:   event.SubscriptionAdded,
+	EventSubscriptionRemoved: event.SubscriptionRemoved,
+	EventMessageSent:         event.MessageSent,
+	EventMessageReceived:     event.MessageReceived,
+	EventError:               event.Error,
+}
+
+//Event describes a transition of the client lifecycle, only the fields relevant to the Type are set
+type Event struct {
+	Type         EventType
+	Time         time.Time
+	Message      *message.Message
+	Channel      string
+	Subscription *subscription.Subscription
+	Err          error
+	Attempt      int
+	Delay        time.Duration
+	Endpoint     string
+}
+
+//On registers a handler called on every event of type t, from the goroutine causing it: a slow handler slows
+//down the client. the returned func removes the handler
+func (d *Dispatcher) On(t EventType, handler func(e Event)) (remove func()) {
+	internal, ok := eventTypes[t]
+	if !ok {
+		return func() {}
+	}
+	return d.events.Subscribe(internal, func(e event.Event) {
+		if t == EventConnected && State(e.To) != StateConnected {
+			return
+		}
+		handler(Event{
+			Type:         t,
+			Time:         e.Time,
+			Message:      e.Message,
+			Channel:      e.Channel,
+			Subscription: e.Subscription,
+			Err:          e.Err,
+			Attempt:      e.Attempt,
+			Delay:        e.Delay,
+			Endpoint:     e.Endpoint,
+		})
+	})
+}
@@ -0,0 +1,112 @@
+package dispatcher
+
+import (
+	"github.com/thesyncim/faye/channel"
+	"github.com/thesyncim/faye/internal/event"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestDispatcher_On(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []string
+	)
+	d := NewDispatcher("fake://", transport.Options{}, message.Extensions{})
+	types := []EventType{EventHandshake, EventConnected, EventSubscriptionAdded, EventSubscriptionRemoved,
+		EventMessageSent, EventMessageReceived}
+	for _, typ := range types {
+		d.On(typ, func(e Event) {
+			if e.Type != typ || e.Time.IsZero() {
+				t.Errorf("expecting a timestamped %s event got: %+v", typ, e)
+			}
+			if e.Message == nil && e.Subscription == nil && e.Type != EventConnected {
+				t.Errorf("expecting the %s event to carry its message or subscription", typ)
+			}
+			if e.Channel == message.MetaConnect {
+				//sent by the connect loop at its own pace
+				return
+			}
+			mu.Lock()
+			events = append(events, typ.String()+" "+e.Channel)
+			mu.Unlock()
+		})
+	}
+	//removed handlers are not called anymore
+	remove := d.On(EventError, func(e Event) {
+		t.Errorf("unexpected error event: %v", e.Err)
+	})
+	remove()
+
+	ft := &fakeTransport{reply: ackSubscriptions}
+	d.SetTransport(ft)
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := d.Subscribe("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ft.deliver(&message.Message{Channel: "/foo", Data: "bar"})
+	if err := sub.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	d.events.Publish(event.Event{Type: event.Error, Err: ErrDisconnected})
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{
+		"message sent " + message.MetaHandshake,
+		"connected ",
+		"handshake ",
+		"message sent " + message.MetaSubscribe,
+		"message received " + message.MetaSubscribe,
+		"subscription added /foo",
+		"message received /foo",
+		"subscription removed /foo",
+		"message sent " + message.MetaUnsubscribe,
+		"message received " + message.MetaUnsubscribe,
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Fatalf("expecting events %q got: %q", expected, events)
+	}
+}
+
+//dropIncoming drops the messages received on /private
+type dropIncoming struct{}
+
+func (dropIncoming) Incoming(m *message.Message, next func(m *message.Message)) {
+	if m.Channel == "/private" {
+		next(nil)
+		return
+	}
+	next(m)
+}
+
+func (dropIncoming) Outgoing(m *message.Message, next func(m *message.Message)) {
+	next(m)
+}
+
+func TestDispatcher_OnMessageReceived(t *testing.T) {
+	d, ft := newTestDispatcher(t, ackSubscriptions)
+	d.AddExtension(tokenPipe{})
+	d.AddExtension(dropIncoming{})
+	var received []message.Data
+	d.On(EventMessageReceived, func(e Event) {
+		if !channel.Channel(e.Channel).IsMeta() {
+			received = append(received, e.Message.Data)
+		}
+	})
+	if _, err := d.Subscribe("/foo"); err != nil {
+		t.Fatal(err)
+	}
+	//only the messages the extensions pass on are received, as they pass them on
+	ft.deliver(&message.Message{Channel: "/private", Data: "dropped"})
+	ft.deliver(&message.Message{Channel: "/foo", Data: "hello"})
+	if !reflect.DeepEqual(received, []message.Data{"hello!"}) {
+		t.Fatalf("expecting the message passed on received got: %v", received)
+	}
+}
@@ -0,0 +1,108 @@
+package dispatcher
+
+import (
+	"context"
+	"github.com/thesyncim/faye/internal/event"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+)
+
+//Interceptor inspects an outgoing message before it is handed to the transport, returning false suppresses it
+type Interceptor func(m *message.Message) bool
+
+//InterceptOutgoing registers an interceptor called with every message sent after the handshake, once the
+//outgoing extensions ran. suppressed messages are acknowledged locally as if the server accepted them,
+//except /meta/connect which gets no response.
+func (d *Dispatcher) InterceptOutgoing(interceptor Interceptor) {
+	d.interceptMu.Lock()
+	d.interceptors = append(d.interceptors, interceptor)
+	d.interceptMu.Unlock()
+}
+
+//intercept runs the interceptors on m, it returns false if one of them suppressed it. the messages sent are logged and counted.
+func (d *Dispatcher) intercept(m *message.Message) bool {
+	d.interceptMu.RLock()
+	interceptors := d.interceptors
+	d.interceptMu.RUnlock()
+	for i := range interceptors {
+		if !interceptors[i](m) {
+			d.acknowledgeSuppressed(m)
+			return false
+		}
+	}
+	d.logMessage("send", m)
+	d.metrics.MessageSent()
+	d.events.Publish(event.Event{Type: event.MessageSent, Channel: m.Channel, Message: m})
+	return true
+}
+
+//acknowledgeSuppressed answers a suppressed message with a successful response, so the operation waiting for it
+//returns as if the message was sent
+func (d *Dispatcher) acknowledgeSuppressed(m *message.Message) {
+	if m.Id == "" || m.Channel == message.MetaConnect {
+		return
+	}
+	resp := &message.Message{Channel: m.Channel, Id: m.Id, ClientId: m.ClientId, Subscription: m.Subscription, Successful: true}
+	go d.receive(resp)
+}
+
+//interceptTransport runs the interceptors of the dispatcher on the messages sent through the transport
+type interceptTransport struct {
+	transport.Transport
+	d *Dispatcher
+}
+
+func (t *interceptTransport) Connect(msg *message.Message) error {
+	if !t.d.intercept(msg) {
+		return nil
+	}
+	return t.Transport.Connect(msg)
+}
+
+func (t *interceptTransport) Disconnect(msg *message.Message) error {
+	if !t.d.intercept(msg) {
+		return nil
+	}
+	return t.Transport.Disconnect(msg)
+}
+
+func (t *interceptTransport) HandshakeCtx(ctx context.Context, msg *message.Message) (*message.Message, error) {
+	t.d.logMessage("send", msg)
+	t.d.metrics.MessageSent()
+	t.d.events.Publish(event.Event{Type: event.MessageSent, Channel: msg.Channel, Message: msg})
+	return transport.HandshakeCtx(ctx, t.Transport, msg)
+}
+
+func (t *interceptTransport) ConnectCtx(ctx context.Context, msg *message.Message) error {
+	if !t.d.intercept(msg) {
+		return nil
+	}
+	return transport.ConnectCtx(ctx, t.Transport, msg)
+}
+
+func (t *interceptTransport) DisconnectCtx(ctx context.Context, msg *message.Message) error {
+	if !t.d.intercept(msg) {
+		return nil
+	}
+	return transport.DisconnectCtx(ctx, t.Transport, msg)
+}
+
+func (t *interceptTransport) SendMessage(msg *message.Message) error {
+	if !t.d.intercept(msg) {
+		return nil
+	}
+	return t.Transport.SendMessage(msg)
+}
+
+func (t *interceptTransport) SendMessages(msgs []*message.Message) error {
+	sent := msgs[:0:0]
+	for _, m := range msgs {
+		if t.d.intercept(m) {
+			sent = append(sent, m)
+		}
+	}
+	if len(sent) == 0 {
+		return nil
+	}
+	return t.Transport.SendMessages(sent)
+}
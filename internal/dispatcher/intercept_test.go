@@ -0,0 +1,52 @@
+package dispatcher
+
+import (
+	"github.com/thesyncim/faye/message"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDispatcher_InterceptOutgoing(t *testing.T) {
+	d, ft := newTestDispatcher(t, func(ft *fakeTransport, m *message.Message) {
+		if m.Channel == "/foo" || m.Channel == "/bar" {
+			go ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Successful: true})
+		}
+	})
+	var (
+		mu       sync.Mutex
+		captured []string
+	)
+	d.InterceptOutgoing(func(m *message.Message) bool {
+		mu.Lock()
+		captured = append(captured, m.Channel)
+		mu.Unlock()
+		return m.Channel != "/bar" && m.Channel != message.MetaSubscribe
+	})
+
+	if err := d.PublishWithTimeout("/foo", "a", time.Second); err != nil {
+		t.Fatalf("expecting nil error got: %v", err)
+	}
+	if err := d.PublishWithTimeout("/bar", "b", time.Second); err != nil {
+		t.Fatalf("expecting the suppressed publish acknowledged got: %v", err)
+	}
+	ops := []*BatchOp{{Channel: "/foo", Data: "c"}, {Channel: "/bar", Data: "d"}, {Subscribe: true, Channel: "/baz"}}
+	if err := d.Batch(ops); err != nil {
+		t.Fatalf("expecting nil error got: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{"/foo", "/bar", "/foo", "/bar", message.MetaSubscribe}
+	if !reflect.DeepEqual(captured, expected) {
+		t.Fatalf("expecting %v captured got: %v", expected, captured)
+	}
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	for _, m := range ft.sent {
+		if m.Channel == "/bar" || m.Channel == message.MetaSubscribe {
+			t.Fatal("expecting the suppressed messages not sent")
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package dispatcher
+
+import (
+	"github.com/thesyncim/faye/internal/event"
+	"github.com/thesyncim/faye/message"
+	"log/slog"
+)
+
+//SetLogger logs the activity of the client to l: the messages sent, received and delivered at debug level,
+//the handshakes and reconnects at info level, the connections lost and the rejected operations at warn level
+//and the asynchronous errors at error level. nil disables the logging, call it before Start.
+func (d *Dispatcher) SetLogger(l *slog.Logger) {
+	d.logger = l
+	if l == nil {
+		return
+	}
+	d.events.Subscribe(event.HandshakeComplete, func(e event.Event) {
+		l.Info("handshake complete", slog.String("clientId", e.Message.ClientId))
+	})
+	d.events.Subscribe(event.StateChange, func(e event.Event) {
+		l.Debug("state change", slog.String("from", State(e.From).String()), slog.String("to", State(e.To).String()))
+	})
+	d.events.Subscribe(event.TransportDown, func(e event.Event) {
+		l.Warn("transport down", slog.Any("error", e.Err))
+	})
+	d.events.Subscribe(event.ConnectionLost, func(e event.Event) {
+		l.Warn("connection lost", slog.Any("error", e.Err))
+	})
+	d.events.Subscribe(event.ReconnectAttempt, func(e event.Event) {
+		l.Info("reconnect attempt", slog.Int("attempt", e.Attempt), slog.Duration("delay", e.Delay),
+			slog.String("endpoint", e.Endpoint), slog.Any("error", e.Err))
+	})
+	d.events.Subscribe(event.Reconnected, func(e event.Event) {
+		l.Info("reconnected", slog.Int("attempt", e.Attempt), slog.String("endpoint", e.Endpoint),
+			slog.String("clientId", d.transport.ClientID()))
+	})
+	d.events.Subscribe(event.Error, func(e event.Event) {
+		attrs := []any{slog.Any("error", e.Err)}
+		if e.Message != nil {
+			attrs = append(attrs, messageAttrs(e.Message)...)
+		} else if e.Channel != "" {
+			attrs = append(attrs, slog.String("channel", e.Channel))
+		}
+		l.Error("client error", attrs...)
+	})
+	d.events.Subscribe(event.Disconnected, func(e event.Event) {
+		l.Info("disconnected", slog.Any("error", e.Err))
+	})
+}
+
+//logMessage logs m at debug level
+func (d *Dispatcher) logMessage(msg string, m *message.Message) {
+	if d.logger != nil {
+		d.logger.Debug(msg, messageAttrs(m)...)
+	}
+}
+
+//logRejected logs at warn level a message the server answered unsuccessfully
+func (d *Dispatcher) logRejected(msg string, m *message.Message) {
+	if d.logger != nil {
+		d.logger.Warn(msg, append(messageAttrs(m), slog.String("error", m.Error))...)
+	}
+}
+
+//messageAttrs returns the attributes identifying m in the logs
+func messageAttrs(m *message.Message) []any {
+	attrs := []any{slog.String("channel", m.Channel)}
+	if m.Id != "" {
+		attrs = append(attrs, slog.String("id", m.Id))
+	}
+	if m.ClientId != "" {
+		attrs = append(attrs, slog.String("clientId", m.ClientId))
+	}
+	if m.Subscription != "" {
+		attrs = append(attrs, slog.String("subscription", m.Subscription))
+	}
+	return attrs
+}
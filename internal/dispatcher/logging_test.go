@@ -0,0 +1,82 @@
+package dispatcher
+
+import (
+	"context"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+//recordHandler keeps the records logged, with their attributes formatted
+type recordHandler struct {
+	mu      sync.Mutex
+	records []map[string]string
+}
+
+func (h *recordHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h *recordHandler) Handle(_ context.Context, r slog.Record) error {
+	record := map[string]string{"msg": r.Message, "level": r.Level.String()}
+	r.Attrs(func(a slog.Attr) bool {
+		record[a.Key] = a.Value.String()
+		return true
+	})
+	h.mu.Lock()
+	h.records = append(h.records, record)
+	h.mu.Unlock()
+	return nil
+}
+func (h *recordHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *recordHandler) WithGroup(string) slog.Handler      { return h }
+
+//find returns the first record logged with msg
+func (h *recordHandler) find(msg string) map[string]string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, record := range h.records {
+		if record["msg"] == msg {
+			return record
+		}
+	}
+	return nil
+}
+
+func TestDispatcher_Logger(t *testing.T) {
+	h := &recordHandler{}
+	ft := &fakeTransport{reply: func(ft *fakeTransport, m *message.Message) {
+		if m.Channel == "/denied" {
+			go ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Error: "403::forbidden"})
+		}
+	}}
+	d := NewDispatcher("fake://", transport.Options{}, message.Extensions{})
+	d.SetTransport(ft)
+	d.SetLogger(slog.New(h))
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.PublishWithTimeout("/denied", "data", time.Second); err == nil {
+		t.Fatal("expecting the publish rejected")
+	}
+
+	var tests = []struct {
+		msg      string
+		expected map[string]string
+	}{
+		{"send", map[string]string{"level": "DEBUG", "channel": message.MetaHandshake}},
+		{"handshake complete", map[string]string{"level": "INFO", "clientId": "fake-client"}},
+		{"publish rejected", map[string]string{"level": "WARN", "channel": "/denied", "id": "2", "error": "403::forbidden"}},
+	}
+	for _, tt := range tests {
+		record := h.find(tt.msg)
+		if record == nil {
+			t.Fatalf("expecting %s logged", tt.msg)
+		}
+		for key, value := range tt.expected {
+			if record[key] != value {
+				t.Fatalf("%s: expecting %s=%s got: %v", tt.msg, key, value, record)
+			}
+		}
+	}
+}
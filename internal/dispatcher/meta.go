@@ -0,0 +1,26 @@
+package dispatcher
+
+import (
+	"fmt"
+	"github.com/thesyncim/faye/internal/event"
+	"github.com/thesyncim/faye/message"
+)
+
+//OnMeta registers a read-only observer called with every /meta/** message received from the server,
+//e.g. the handshake, connect and subscribe responses, after the incoming extensions ran.
+//the observer gets a copy of the message, a panic is reported to the error handlers.
+func (d *Dispatcher) OnMeta(observer func(msg *message.Message)) {
+	d.events.Subscribe(event.Meta, func(e event.Event) {
+		cp := *e.Message
+		if err := message.CatchPanic(func() { observer(&cp) }); err != nil {
+			d.events.Publish(event.Event{Type: event.Error, Err: fmt.Errorf("meta observer: %w", err), Message: e.Message})
+		}
+	})
+}
+
+//observeMeta notifies the meta observers of msg, if it is a meta message
+func (d *Dispatcher) observeMeta(msg *message.Message) {
+	if message.IsMetaMessage(msg) {
+		d.events.Publish(event.Event{Type: event.Meta, Message: msg})
+	}
+}
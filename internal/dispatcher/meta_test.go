@@ -0,0 +1,63 @@
+package dispatcher
+
+import (
+	"errors"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDispatcher_OnMeta(t *testing.T) {
+	d := NewDispatcher("fake://", transport.Options{}, message.Extensions{})
+	ft := &fakeTransport{reply: ackSubscriptions}
+	d.SetTransport(ft)
+	var (
+		mu       sync.Mutex
+		channels []string
+	)
+	d.OnMeta(func(msg *message.Message) {
+		mu.Lock()
+		channels = append(channels, msg.Channel)
+		mu.Unlock()
+		//observers can't alter the messages handled by the client
+		msg.Successful = false
+	})
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Subscribe("/foo"); err != nil {
+		t.Fatalf("expecting nil error got: %v", err)
+	}
+	d.dispatchMessage(&message.Message{Channel: "/foo", Data: "bar"})
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{message.MetaHandshake, message.MetaSubscribe}
+	if strings.Join(channels, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expecting observed %v got: %v", expected, channels)
+	}
+}
+
+func TestDispatcher_OnMetaPanic(t *testing.T) {
+	d, ft := newTestDispatcher(t, nil)
+	d.OnMeta(func(msg *message.Message) {
+		panic("boom")
+	})
+	errCh := make(chan error, 1)
+	d.OnError(func(err error) {
+		errCh <- err
+	})
+	ft.deliver(&message.Message{Channel: message.MetaConnect, Successful: true})
+
+	select {
+	case err := <-errCh:
+		var panicErr *message.PanicError
+		if !errors.As(err, &panicErr) || panicErr.Value != "boom" {
+			t.Fatalf("expecting the observer panic got: %v", err)
+		}
+	default:
+		t.Fatal("expecting the observer panic reported")
+	}
+}
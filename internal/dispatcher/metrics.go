@@ -0,0 +1,19 @@
+package dispatcher
+
+import (
+	"github.com/thesyncim/faye/metrics"
+)
+
+//SetMetrics reports the measures of the client to c, nil discards them. call it before Start.
+func (d *Dispatcher) SetMetrics(c metrics.Collector) {
+	if c == nil {
+		c = metrics.Nop{}
+	}
+	d.metrics = c
+}
+
+//subscriptionsChanged reports the change of the number of subscriptions, see SubscriptionsStore.OnChange
+func (d *Dispatcher) subscriptionsChanged(delta int) {
+	d.metrics.AddSubscriptions(delta)
+	d.stateChange()
+}
@@ -0,0 +1,83 @@
+package dispatcher
+
+import (
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"sync"
+	"testing"
+	"time"
+)
+
+//countingCollector counts the measures received
+type countingCollector struct {
+	mu            sync.Mutex
+	sent          int
+	received      int
+	publishes     int
+	reconnects    int
+	subscriptions int
+	queued        int
+}
+
+func (c *countingCollector) MessageSent()                      { c.add(&c.sent, 1) }
+func (c *countingCollector) MessageReceived()                  { c.add(&c.received, 1) }
+func (c *countingCollector) PublishAcknowledged(time.Duration) { c.add(&c.publishes, 1) }
+func (c *countingCollector) Reconnected()                      { c.add(&c.reconnects, 1) }
+func (c *countingCollector) AddSubscriptions(delta int)        { c.add(&c.subscriptions, delta) }
+func (c *countingCollector) AddQueued(delta int)               { c.add(&c.queued, delta) }
+
+func (c *countingCollector) get(counter *int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return *counter
+}
+
+func (c *countingCollector) add(counter *int, delta int) {
+	c.mu.Lock()
+	*counter += delta
+	c.mu.Unlock()
+}
+
+func TestDispatcher_Metrics(t *testing.T) {
+	ft := &fakeTransport{reply: func(ft *fakeTransport, m *message.Message) {
+		ackSubscriptions(ft, m)
+		if m.Channel == "/foo" {
+			go ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Successful: true})
+		}
+	}}
+	c := &countingCollector{}
+	d := NewDispatcher("fake://", transport.Options{}, message.Extensions{})
+	d.SetTransport(ft)
+	d.SetMetrics(c)
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := d.Subscribe("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Subscribe("/bar"); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.PublishWithTimeout("/foo", "data", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Unsubscribe(sub); err != nil {
+		t.Fatal(err)
+	}
+
+	//handshake, connect, 2 subscribes, publish and unsubscribe
+	if sent := c.get(&c.sent); sent != 6 {
+		t.Fatalf("expecting 6 messages sent got: %d", sent)
+	}
+	//2 subscribe acks, the publish ack and the unsubscribe ack
+	if received := c.get(&c.received); received != 4 {
+		t.Fatalf("expecting 4 messages received got: %d", received)
+	}
+	if publishes := c.get(&c.publishes); publishes != 1 {
+		t.Fatalf("expecting 1 publish latency got: %d", publishes)
+	}
+	if subscriptions := c.get(&c.subscriptions); subscriptions != 1 {
+		t.Fatalf("expecting 1 subscription got: %d", subscriptions)
+	}
+}
@@ -0,0 +1,48 @@
+package dispatcher
+
+import (
+	"errors"
+	"github.com/thesyncim/faye/internal/event"
+	"github.com/thesyncim/faye/message"
+	"time"
+)
+
+//ErrMultipleClients is the cause of the reconnect when the server reports another connection using the
+//same clientId and the client is set to handshake again, see SetMultipleClientsRehandshake
+var ErrMultipleClients = errors.New("server reported multiple clients")
+
+//SetMultipleClientsRehandshake makes the client handshake again for a fresh clientId when the server advice
+//reports multiple clients, by default the client keeps its clientId and only backs off its connects
+func (d *Dispatcher) SetMultipleClientsRehandshake(rehandshake bool) {
+	d.multipleClientsRehandshake = rehandshake
+}
+
+//OnMultipleClients registers a handler called with every advice reporting that another connection
+//is using the clientId of the client
+func (d *Dispatcher) OnMultipleClients(onMultipleClients func(advice *message.Advise)) {
+	d.events.Subscribe(event.MultipleClients, func(e event.Event) {
+		onMultipleClients(e.Advice)
+	})
+}
+
+//onMultipleClients notifies the handlers and handshakes again when configured to
+func (d *Dispatcher) onMultipleClients(advice *message.Advise) {
+	d.events.Publish(event.Event{Type: event.MultipleClients, Advice: advice})
+	if d.rehandshakeMultipleClients() {
+		go d.reconnect(ErrMultipleClients)
+	}
+}
+
+//rehandshakeMultipleClients reports whether the client handshakes again on multiple clients advice
+func (d *Dispatcher) rehandshakeMultipleClients() bool {
+	return d.multipleClientsRehandshake && !d.manualConnect && d.terminated() == nil
+}
+
+//multipleClientsBackoff delays the connects while another connection uses the clientId, so the two
+//clients don't hold the server alternately: the interval is at least the retry delay
+func (d *Dispatcher) multipleClientsBackoff(interval time.Duration) time.Duration {
+	if backoff, _ := d.retryDelay(1); interval < backoff {
+		return backoff
+	}
+	return interval
+}
@@ -0,0 +1,97 @@
+package dispatcher
+
+import (
+	"context"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+)
+
+//BayeuxVersion is the version of the protocol sent in the handshakes
+const BayeuxVersion = "1.0"
+
+//ServerInfo describes the server as negotiated by the handshake
+type ServerInfo struct {
+	//Version is the protocol version of the server
+	Version string
+	//MinimumVersion is the oldest protocol version the server supports
+	MinimumVersion string
+	//SupportedConnectionTypes are the transports the server supports
+	SupportedConnectionTypes []string
+	//Ext is the ext field of the handshake response, nil if it isn't an object
+	Ext map[string]interface{}
+}
+
+//ServerInfo returns the server info of the last handshake response, the zero value before the first handshake
+func (d *Dispatcher) ServerInfo() ServerInfo {
+	if info, ok := d.serverInfo.Load().(*ServerInfo); ok {
+		return *info
+	}
+	return ServerInfo{}
+}
+
+func (d *Dispatcher) recordServerInfo(resp *message.Message) {
+	ext, _ := resp.Ext.(map[string]interface{})
+	d.serverInfo.Store(&ServerInfo{
+		Version:                  resp.Version,
+		MinimumVersion:           resp.MinimumVersion,
+		SupportedConnectionTypes: resp.SupportedConnectionTypes,
+		Ext:                      ext,
+	})
+}
+
+//connectionTypes returns the transports the client supports, the current one first and then the registered ones
+func (d *Dispatcher) connectionTypes() []string {
+	current := d.transport.Name()
+	types := []string{current}
+	for _, name := range transport.Names() {
+		if name != current {
+			types = append(types, name)
+		}
+	}
+	return types
+}
+
+//fallbackHandshake handshakes again with the first registered transport supported by the server, in the
+//order of the server. the current transport is closed once a handshake succeeds, it is kept if none does.
+func (d *Dispatcher) fallbackHandshake(ctx context.Context, supported []string) (*message.Message, bool) {
+	current := d.transport.(*interceptTransport).Transport
+	d.releaseMu.Lock()
+	endpoint := d.dialed
+	d.releaseMu.Unlock()
+	for _, name := range supported {
+		t, err := transport.New(name)
+		if err != nil {
+			continue
+		}
+		if err = t.Init(endpoint, &d.transportOpts); err != nil {
+			continue
+		}
+		d.SetTransport(t)
+		resp, err := d.handshake(ctx, false)
+		if err != nil {
+			if c, ok := t.(transport.Closer); ok {
+				c.Close()
+			}
+			continue
+		}
+		if c, ok := current.(transport.Closer); ok {
+			c.Close()
+		}
+		return resp, true
+	}
+	d.SetTransport(current)
+	return nil, false
+}
+
+//supports reports whether the connection types include name, an empty list supports any
+func supports(types []string, name string) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for i := range types {
+		if types[i] == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package dispatcher
+
+import (
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"reflect"
+	"testing"
+)
+
+//namedTransport is a fake transport registered under another name
+type namedTransport struct {
+	*fakeTransport
+	name string
+}
+
+func (t *namedTransport) Name() string { return t.name }
+
+func TestDispatcher_ServerInfo(t *testing.T) {
+	var types []string
+	ft := &fakeTransport{handshakeExt: map[string]interface{}{"ack": true}}
+	ft.onHandshake = func(m *message.Message) { types = m.SupportedConnectionTypes }
+	d, _ := connectTestDispatcher(t, ft)
+	info := d.ServerInfo()
+	if info.Version != BayeuxVersion || info.Ext["ack"] != true {
+		t.Fatalf("expecting the server info of the handshake got: %+v", info)
+	}
+	if len(types) == 0 || types[0] != "fake" {
+		t.Fatalf("expecting the current transport advertised first got: %v", types)
+	}
+}
+
+func TestDispatcher_TransportFallback(t *testing.T) {
+	fallback := &namedTransport{fakeTransport: &fakeTransport{connectionTypes: []string{"fake-fallback"}}, name: "fake-fallback"}
+	transport.Register(fallback.name, func() transport.Transport { return fallback })
+
+	var tests = []struct {
+		supported []string
+		expected  string
+	}{
+		//the server doesn't support the transport
+		{[]string{"unregistered", "fake-fallback"}, "fake-fallback"},
+		//no registered transport is supported, the client keeps its own
+		{[]string{"unregistered"}, "fake"},
+		{nil, "fake"},
+	}
+	for _, tt := range tests {
+		ft := &fakeTransport{connectionTypes: tt.supported}
+		d, _ := connectTestDispatcher(t, ft)
+		if name := d.transport.Name(); name != tt.expected {
+			t.Fatalf("supported %v: expecting the %s transport got: %s", tt.supported, tt.expected, name)
+		}
+		if tt.expected == "fake-fallback" {
+			if !reflect.DeepEqual(d.ServerInfo().SupportedConnectionTypes, []string{"fake-fallback"}) {
+				t.Fatalf("expecting the server info of the fallback handshake got: %+v", d.ServerInfo())
+			}
+			if connect := lastSent(fallback.fakeTransport); connect == nil || connect.Channel != message.MetaConnect {
+				t.Fatalf("expecting the connect sent with the fallback transport got: %+v", connect)
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package dispatcher
+
+import (
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/subscription"
+)
+
+//pauseOnServer is the subscription.Pauser of the subscriptions: the channel is unsubscribed on the server once all
+//its subscriptions are paused with subscription.PauseUnsubscribe, and subscribed again when one of them resumes.
+//the channels paused are not subscribed again on a new session until resumed
+func (d *Dispatcher) pauseOnServer(sub *subscription.Subscription, paused bool) error {
+	if err := d.terminated(); err != nil {
+		return err
+	}
+	name := sub.Name()
+	if !paused {
+		if !d.resumeChannel(name) || d.Suspended() {
+			return nil
+		}
+		return d.subscribeAgain(name, d.transport.ClientID())
+	}
+
+	d.pauseMu.Lock()
+	if d.paused[name] || !d.allPausedOnServer(name) {
+		d.pauseMu.Unlock()
+		return nil
+	}
+	d.paused[name] = true
+	d.pauseMu.Unlock()
+	if d.Suspended() {
+		//a suspended session has no subscriptions
+		return nil
+	}
+	m := d.unsubscribeMessage(name)
+	respCh := d.awaitResponse(m.Id)
+	if err := d.transport.SendMessages([]*message.Message{m}); err != nil {
+		d.cancelResponse(m.Id)
+		d.resumeChannel(name)
+		return err
+	}
+	timeoutCh, stop := d.unsubscribeDeadline()
+	defer stop()
+	return d.awaitUnsubscribe(m.Id, respCh, timeoutCh)
+}
+
+//allPausedOnServer reports whether all the subscriptions of the channel are paused with
+//subscription.PauseUnsubscribe
+func (d *Dispatcher) allPausedOnServer(name string) bool {
+	subs := d.store.Covered(name)
+	found := false
+	for _, sub := range subs {
+		if sub.Name() != name {
+			continue
+		}
+		if !sub.PausedOnServer() {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+//channelPaused reports whether the channel is unsubscribed on the server while its subscriptions are paused
+func (d *Dispatcher) channelPaused(name string) bool {
+	d.pauseMu.Lock()
+	defer d.pauseMu.Unlock()
+	return d.paused[name]
+}
+
+//resumeChannel forgets the pause of the channel, it returns false if the channel wasn't paused
+func (d *Dispatcher) resumeChannel(name string) bool {
+	d.pauseMu.Lock()
+	defer d.pauseMu.Unlock()
+	if !d.paused[name] {
+		return false
+	}
+	delete(d.paused, name)
+	return true
+}
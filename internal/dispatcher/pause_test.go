@@ -0,0 +1,63 @@
+package dispatcher
+
+import (
+	"context"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/subscription"
+	"testing"
+)
+
+func TestDispatcher_PauseUnsubscribe(t *testing.T) {
+	d, ft := newTestDispatcher(t, ackSubscriptions)
+	var subs []*subscription.Subscription
+	for i := 0; i < 2; i++ {
+		sub, err := d.Subscribe("/foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sub.SetPauseMode(subscription.PauseUnsubscribe)
+		subs = append(subs, sub)
+	}
+	expectSent := func(channel string, n int) {
+		t.Helper()
+		if got := countChannel(ft, channel); got != n {
+			t.Fatalf("expecting %d %s sent got: %d", n, channel, got)
+		}
+	}
+
+	//the channel is unsubscribed once all its subscriptions are paused
+	if err := subs[0].Pause(); err != nil {
+		t.Fatal(err)
+	}
+	expectSent(message.MetaUnsubscribe, 0)
+	if err := subs[1].Pause(); err != nil {
+		t.Fatal(err)
+	}
+	expectSent(message.MetaUnsubscribe, 1)
+
+	//and not restored on a new session until resumed
+	if err := d.Resubscribe(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expectSent(message.MetaSubscribe, 1)
+	if err := subs[0].Resume(); err != nil {
+		t.Fatal(err)
+	}
+	expectSent(message.MetaSubscribe, 2)
+	if err := subs[1].Resume(); err != nil {
+		t.Fatal(err)
+	}
+	expectSent(message.MetaSubscribe, 2)
+
+	//a paused channel is unsubscribed already
+	for _, sub := range subs {
+		sub.Pause()
+	}
+	expectSent(message.MetaUnsubscribe, 2)
+	for _, sub := range subs {
+		if err := sub.Unsubscribe(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectSent(message.MetaUnsubscribe, 2)
+}
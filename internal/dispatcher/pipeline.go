@@ -0,0 +1,58 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"github.com/thesyncim/faye/internal/event"
+	"github.com/thesyncim/faye/message"
+)
+
+//AddExtension appends ext to the extensions run on every message, after the ones provided to NewDispatcher.
+//it can be called at any time, the messages already in flight don't go through ext. ext is notified if it
+//implements message.AddedHook
+func (d *Dispatcher) AddExtension(ext message.Pipe) {
+	d.pipeline.Add(ext)
+}
+
+//RemoveExtension removes an extension added with AddExtension, it returns false if ext wasn't added. ext is
+//notified if it implements message.RemovedHook
+func (d *Dispatcher) RemoveExtension(ext message.Pipe) bool {
+	return d.pipeline.Remove(ext)
+}
+
+//outgoing runs m through the extensions, waiting until ctx is done for the ones passing it on later.
+//m is replaced by the message the extensions passed on, message.ErrDropped is returned if one dropped it.
+func (d *Dispatcher) outgoing(ctx context.Context, m *message.Message) error {
+	if d.pipeline.Len() == 0 {
+		return nil
+	}
+	out, err := message.Await(d.extensionContext(ctx), m, d.pipeline.Outgoing)
+	if err != nil {
+		return err
+	}
+	if out != m {
+		*m = *out
+	}
+	return nil
+}
+
+//incoming runs msg through the extensions and routes the message they pass on, if any, once it is published as
+//received. the context is only built if there are some
+func (d *Dispatcher) incoming(msg *message.Message) {
+	ctx := context.Background()
+	if d.pipeline.Len() > 0 {
+		ctx = d.extensionContext(ctx)
+	}
+	d.pipeline.Incoming(ctx, msg, func(out *message.Message, err error) {
+		if err == message.ErrDropped {
+			return
+		}
+		if err != nil {
+			//the extension may have left the message half processed
+			d.events.Publish(event.Event{Type: event.Error, Err: fmt.Errorf("incoming extension: %w", err), Message: msg})
+			return
+		}
+		d.events.Publish(event.Event{Type: event.MessageReceived, Channel: out.Channel, Message: out})
+		d.routeMessage(out)
+	})
+}
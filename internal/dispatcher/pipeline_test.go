@@ -0,0 +1,71 @@
+package dispatcher
+
+import (
+	"github.com/thesyncim/faye/channel"
+	"github.com/thesyncim/faye/message"
+	"testing"
+	"time"
+)
+
+//tokenPipe adds a token to the outgoing messages from another goroutine, drops the publishes to /private
+//and upper cases the data delivered
+type tokenPipe struct{}
+
+func (tokenPipe) Outgoing(m *message.Message, next func(m *message.Message)) {
+	if m.Channel == "/private" {
+		next(nil)
+		return
+	}
+	go func() {
+		m.Ext = map[string]interface{}{"token": "secret"}
+		next(m)
+	}()
+}
+
+func (tokenPipe) Incoming(m *message.Message, next func(m *message.Message)) {
+	if s, ok := m.Data.(string); ok {
+		m.Data = s + "!"
+	}
+	next(m)
+}
+
+func TestDispatcher_AddExtension(t *testing.T) {
+	d, ft := newTestDispatcher(t, func(ft *fakeTransport, m *message.Message) {
+		ackSubscriptions(ft, m)
+		if m.Channel == "/foo" {
+			go ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Successful: true})
+		}
+	})
+	if err := d.SetChannelConfigs([]channel.Config{{Pattern: "/foo", BufferSize: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	pipe := &tokenPipe{}
+	d.AddExtension(pipe)
+
+	sub, err := d.Subscribe("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Publish("/foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+	if ext, _ := lastSent(ft).Ext.(map[string]interface{}); ext["token"] != "secret" {
+		t.Fatalf("expecting the token added got: %v", lastSent(ft).Ext)
+	}
+	if err = d.Publish("/private", "bar"); err != message.ErrDropped {
+		t.Fatalf("expecting message.ErrDropped got: %v", err)
+	}
+
+	ft.deliver(&message.Message{Channel: "/foo", Data: "hello"})
+	if msg := <-sub.MsgChannel(); msg.Data != "hello!" {
+		t.Fatalf("expecting hello! got: %v", msg.Data)
+	}
+
+	if !d.RemoveExtension(pipe) {
+		t.Fatal("expecting the extension removed")
+	}
+	//the fake server doesn't ack /private
+	if err = d.PublishWithTimeout("/private", "bar", 10*time.Millisecond); err != ErrAckTimeout {
+		t.Fatalf("expecting the publish sent got: %v", err)
+	}
+}
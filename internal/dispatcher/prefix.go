@@ -0,0 +1,37 @@
+package dispatcher
+
+import (
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/subscription"
+	"strings"
+)
+
+//SetChannelPrefix namespaces the application channels under prefix, e.g. /myapp: the prefix is added to the
+//channels sent to the server and stripped from the deliveries, the subscriptions and the channel configs
+//use the application channels. deliveries outside the namespace are discarded.
+func (d *Dispatcher) SetChannelPrefix(prefix string) error {
+	if prefix != "" && !subscription.IsValidPublishName(prefix) {
+		return subscription.ErrInvalidChannelName
+	}
+	d.prefix = prefix
+	return nil
+}
+
+//serverChannel returns the server channel of the application channel
+func (d *Dispatcher) serverChannel(name string) string {
+	return d.prefix + name
+}
+
+//appMessage returns the delivery with the application channel,
+//ok is false if the channel is outside the application namespace
+func (d *Dispatcher) appMessage(msg *message.Message) (appMsg *message.Message, ok bool) {
+	if d.prefix == "" {
+		return msg, true
+	}
+	if !strings.HasPrefix(msg.Channel, d.prefix+"/") {
+		return nil, false
+	}
+	m := *msg
+	m.Channel = msg.Channel[len(d.prefix):]
+	return &m, true
+}
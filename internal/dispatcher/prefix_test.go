@@ -0,0 +1,60 @@
+package dispatcher
+
+import (
+	"github.com/thesyncim/faye/channel"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"testing"
+)
+
+func TestDispatcher_ChannelPrefix(t *testing.T) {
+	d, ft := newTestDispatcher(t, func(ft *fakeTransport, m *message.Message) {
+		ackSubscriptions(ft, m)
+		if !message.IsMetaMessage(m) {
+			go ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Successful: true})
+		}
+	})
+	if err := d.SetChannelPrefix("/myapp"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetChannelConfigs([]channel.Config{{Pattern: "/foo/**", BufferSize: 10}}); err != nil {
+		t.Fatal(err)
+	}
+
+	sub, err := d.Subscribe("/foo/**")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lastSubscribe(ft).Subscription; got != "/myapp/foo/**" {
+		t.Fatalf("expecting the prefixed subscription got: %s", got)
+	}
+	if sub.Name() != "/foo/**" {
+		t.Fatalf("expecting the application channel as subscription name got: %s", sub.Name())
+	}
+
+	if err = d.Publish("/foo/bar", "a"); err != nil {
+		t.Fatal(err)
+	}
+	ft.mu.Lock()
+	published := ft.sent[len(ft.sent)-1].Channel
+	ft.mu.Unlock()
+	if published != "/myapp/foo/bar" {
+		t.Fatalf("expecting the publish on the prefixed channel got: %s", published)
+	}
+
+	ft.deliver(&message.Message{Channel: "/myapp/foo/bar", Data: "a"})
+	ft.deliver(&message.Message{Channel: "/otherapp/foo/bar", Data: "b"})
+	if len(sub.MsgChannel()) != 1 {
+		t.Fatalf("expecting only the deliveries in the namespace got: %d", len(sub.MsgChannel()))
+	}
+	if msg := <-sub.MsgChannel(); msg.Channel != "/foo/bar" {
+		t.Fatalf("expecting the prefix stripped on delivery got: %s", msg.Channel)
+	}
+}
+
+func TestDispatcher_ChannelPrefixInvalid(t *testing.T) {
+	d := NewDispatcher("fake://", transport.Options{}, message.Extensions{})
+	if err := d.SetChannelPrefix("/myapp/**"); err == nil {
+		t.Fatal("expecting an error for a wildcard prefix")
+	}
+}
@@ -0,0 +1,74 @@
+package dispatcher
+
+import (
+	"context"
+	"github.com/thesyncim/faye/internal/event"
+	"github.com/thesyncim/faye/message"
+	"time"
+)
+
+//SetPublishTimeout bounds the wait for the acknowledgement of PublishWithAck when the call doesn't, 0 waits
+//forever. with retries, it bounds every attempt.
+func (d *Dispatcher) SetPublishTimeout(timeout time.Duration) {
+	d.publishTimeout = timeout
+}
+
+//SetPublishRetries makes PublishWithAck send an unacknowledged publish again, at most retries times, once the
+//connection is restored or its publish timeout expired. the publish keeps its message id, so the server can
+//discard the duplicates.
+func (d *Dispatcher) SetPublishRetries(retries int) {
+	d.publishRetries = retries
+}
+
+//watchReconnects returns a channel receiving a value when a reconnect completes, until stop is called
+func (d *Dispatcher) watchReconnects() (reconnected <-chan struct{}, stop func()) {
+	ch := make(chan struct{}, 1)
+	stop = d.events.Subscribe(event.Reconnected, func(e event.Event) {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	})
+	return ch, stop
+}
+
+//awaitPublishRetrying is like awaitPublish but sends m again with its id when the connection is restored or
+//timeout expires, up to publishRetries times. ErrAckTimeout is returned once the last attempt timed out.
+func (d *Dispatcher) awaitPublishRetrying(ctx context.Context, m *message.Message, ack chan error, timeout time.Duration, reconnected <-chan struct{}) error {
+	defer d.removePublishACK(m.Id)
+	retries := d.publishRetries
+	for {
+		var timeoutCh <-chan time.Time
+		var stop func() bool
+		if timeout > 0 {
+			timer := d.clock().NewTimer(timeout)
+			timeoutCh, stop = timer.C(), timer.Stop
+		}
+		retry := false
+		for !retry {
+			select {
+			case err := <-ack:
+				return err
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-timeoutCh:
+				if retries == 0 {
+					return ErrAckTimeout
+				}
+				retry = true
+			case <-reconnected:
+				//without retry left, the attempt in flight keeps waiting for its acknowledgement
+				retry = retries > 0
+			}
+		}
+		if stop != nil {
+			stop()
+		}
+		retries--
+		//the ack stays registered under the id until the first acknowledgement, whichever attempt it answers
+		m.ClientId = d.transport.ClientID()
+		if err := d.send(ctx, m); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//publishes returns the publishes to /foo sent so far
+func publishes(ft *fakeTransport) []*message.Message {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	var msgs []*message.Message
+	for _, m := range ft.sent {
+		if m.Channel == "/foo" {
+			msgs = append(msgs, m)
+		}
+	}
+	return msgs
+}
+
+func TestDispatcher_PublishRetryAfterReconnect(t *testing.T) {
+	var ack int32
+	ft := &fakeTransport{reply: func(ft *fakeTransport, m *message.Message) {
+		if m.Channel == "/foo" && atomic.LoadInt32(&ack) == 1 {
+			go ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Successful: true})
+		}
+	}}
+	d := NewDispatcher("fake://", transport.Options{RetryInterval: time.Millisecond}, message.Extensions{})
+	d.SetTransport(ft)
+	d.SetPublishRetries(1)
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	published := make(chan error, 1)
+	go func() {
+		published <- d.PublishWithAck(context.Background(), "/foo", "bar", 0)
+	}()
+	deadline := time.Now().Add(time.Second)
+	for len(publishes(ft)) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expecting the publish sent")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	//the publish is lost with the connection
+	atomic.StoreInt32(&ack, 1)
+	ft.onTransportDown(errors.New("connection reset"))
+
+	select {
+	case err := <-published:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expecting the publish sent again and acknowledged")
+	}
+	msgs := publishes(ft)
+	if len(msgs) != 2 || msgs[0].Id != msgs[1].Id {
+		t.Fatalf("expecting the publish sent again with its id got: %v", msgs)
+	}
+}
+
+func TestDispatcher_PublishTimeout(t *testing.T) {
+	d, ft := newTestDispatcher(t, nil)
+	d.SetPublishTimeout(10 * time.Millisecond)
+
+	if err := d.PublishWithAck(context.Background(), "/foo", "bar", 0); err != ErrAckTimeout {
+		t.Fatalf("expecting ErrAckTimeout without retries got: %v", err)
+	}
+	d.SetPublishRetries(2)
+	err := d.PublishWithAck(context.Background(), "/foo", "bar", 0)
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expecting a timeout got: %v", err)
+	}
+	msgs := publishes(ft)[1:]
+	if len(msgs) != 3 {
+		t.Fatalf("expecting the publish sent 3 times got: %d", len(msgs))
+	}
+	for i := range msgs {
+		if msgs[i].Id != msgs[0].Id {
+			t.Fatalf("expecting the publish sent with its id got: %s, %s", msgs[0].Id, msgs[i].Id)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package dispatcher
+
+import (
+	"errors"
+	"fmt"
+	"github.com/thesyncim/faye/channel"
+	"github.com/thesyncim/faye/internal/event"
+	"github.com/thesyncim/faye/internal/store"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/subscription"
+)
+
+//ErrMessageDropped is reported to the error handlers when a message is dropped because
+//the subscription queue is full, see channel.DropNewest
+var ErrMessageDropped = errors.New("message dropped")
+
+//dedupWindow is the number of message ids remembered per subscription when dedup is enabled
+const dedupWindow = 1000
+
+//idWindow remembers the last ids added to it
+type idWindow struct {
+	ids  map[string]struct{}
+	ring []string
+	next int
+}
+
+func newIDWindow(size int) *idWindow {
+	return &idWindow{
+		ids:  make(map[string]struct{}, size),
+		ring: make([]string, size),
+	}
+}
+
+//seen reports whether the id is in the window, adding it otherwise
+func (w *idWindow) seen(id string) bool {
+	if _, ok := w.ids[id]; ok {
+		return true
+	}
+	delete(w.ids, w.ring[w.next])
+	w.ring[w.next] = id
+	w.ids[id] = struct{}{}
+	w.next = (w.next + 1) % len(w.ring)
+	return false
+}
+
+//SetChannelConfigs sets the quality of service of the channels, the first config matching a channel is used
+func (d *Dispatcher) SetChannelConfigs(configs []channel.Config) error {
+	for i := range configs {
+		if !subscription.IsValidSubscriptionName(configs[i].Pattern) {
+			return subscription.ErrInvalidChannelName
+		}
+	}
+	d.qosMu.Lock()
+	d.channelConfigs = configs
+	d.channelConfigCache = map[string]channel.Config{}
+	d.qosMu.Unlock()
+	return nil
+}
+
+//channelConfig returns the config of the first pattern matching the channel, the zero config if none matches
+func (d *Dispatcher) channelConfig(name string) channel.Config {
+	d.qosMu.Lock()
+	defer d.qosMu.Unlock()
+	if len(d.channelConfigs) == 0 {
+		return channel.Config{}
+	}
+	if cfg, ok := d.channelConfigCache[name]; ok {
+		return cfg
+	}
+
+	var cfg channel.Config
+	n := store.NewName(name)
+	for i := range d.channelConfigs {
+		if n.Match(d.channelConfigs[i].Pattern) {
+			cfg = d.channelConfigs[i]
+			break
+		}
+	}
+	d.channelConfigCache[name] = cfg
+	return cfg
+}
+
+//isDuplicate reports whether the message id was recently delivered to the subscription
+func (d *Dispatcher) isDuplicate(sub *subscription.Subscription, id string) bool {
+	d.qosMu.Lock()
+	defer d.qosMu.Unlock()
+	window, ok := d.dedup[sub]
+	if !ok {
+		window = newIDWindow(dedupWindow)
+		d.dedup[sub] = window
+	}
+	return window.seen(id)
+}
+
+//forgetSubscription releases the qos state kept for the subscription and the payloads it was receiving
+func (d *Dispatcher) forgetSubscription(sub *subscription.Subscription) {
+	d.qosMu.Lock()
+	delete(d.dedup, sub)
+	delete(d.fullQueues, sub)
+	d.qosMu.Unlock()
+	d.dropAssemblies()
+}
+
+//deliver pushes the message to the subscription queue according to its channel config
+func (d *Dispatcher) deliver(sub *subscription.Subscription, msg *message.Message) {
+	if !d.accepts(sub, msg) {
+		return
+	}
+	cfg := d.channelConfig(sub.Name())
+	if (cfg.Dedup || sub.DeliveryMode() == subscription.AtLeastOnce) && msg.Id != "" && d.isDuplicate(sub, msg.Id) {
+		return
+	}
+	if msg = d.process(sub, msg); msg == nil {
+		return
+	}
+
+	d.checkSlowConsumer(sub, msg)
+	if !sub.Queue(msg, cfg.Overflow) {
+		d.events.Publish(event.Event{
+			Type:    event.Error,
+			Err:     fmt.Errorf("%w: subscription `%s` queue is full", ErrMessageDropped, sub.Name()),
+			Message: msg,
+			Channel: sub.Name(),
+		})
+	}
+}
+
+//accepts runs the filter of the subscription, a panic is reported to the error handlers and discards the message
+func (d *Dispatcher) accepts(sub *subscription.Subscription, msg *message.Message) (accepted bool) {
+	err := message.CatchPanic(func() { accepted = sub.Accepts(msg) })
+	if err != nil {
+		d.events.Publish(event.Event{Type: event.Error, Err: fmt.Errorf("subscription `%s` filter: %w", sub.Name(), err), Message: msg})
+		return false
+	}
+	return accepted
+}
+
+//process runs the middlewares of the subscription, nil is returned if they dropped the message. their errors and
+//panics are reported to the error handlers and drop the message
+func (d *Dispatcher) process(sub *subscription.Subscription, msg *message.Message) (processed *message.Message) {
+	var err error
+	if panicErr := message.CatchPanic(func() { processed, err = sub.Process(msg) }); panicErr != nil {
+		err = panicErr
+	}
+	if err != nil {
+		d.events.Publish(event.Event{Type: event.Error, Err: fmt.Errorf("subscription `%s` middleware: %w", sub.Name(), err), Message: msg, Channel: sub.Name()})
+		return nil
+	}
+	return processed
+}
@@ -0,0 +1,264 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"github.com/thesyncim/faye/channel"
+	"github.com/thesyncim/faye/message"
+	"strings"
+	"testing"
+	"time"
+)
+
+//ackSubscriptions replies successfully to every subscribe and unsubscribe request
+func ackSubscriptions(ft *fakeTransport, m *message.Message) {
+	if m.Channel == message.MetaSubscribe || m.Channel == message.MetaUnsubscribe {
+		go ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Subscription: m.Subscription, Successful: true})
+	}
+}
+
+func TestDispatcher_ChannelConfigSkipAck(t *testing.T) {
+	d, _ := newTestDispatcher(t, nil)
+	if err := d.SetChannelConfigs([]channel.Config{{Pattern: "/metrics/**", SkipAck: true}}); err != nil {
+		t.Fatal(err)
+	}
+
+	//the fake server never acks, only the configured channel must return
+	if err := d.PublishWithTimeout("/metrics/cpu", "1", time.Second); err != nil {
+		t.Fatalf("expecting nil error got: %v", err)
+	}
+	if err := d.PublishWithTimeout("/orders", "1", 10*time.Millisecond); err != ErrAckTimeout {
+		t.Fatalf("expecting ErrAckTimeout got: %v", err)
+	}
+}
+
+func TestDispatcher_ChannelConfigDropOldest(t *testing.T) {
+	d, ft := newTestDispatcher(t, ackSubscriptions)
+	err := d.SetChannelConfigs([]channel.Config{{Pattern: "/prices/*", BufferSize: 2, Overflow: channel.DropOldest}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := d.Subscribe("/prices/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, price := range []string{"1", "2", "3"} {
+		ft.deliver(&message.Message{Channel: "/prices/eur", Data: price})
+	}
+
+	var got []message.Data
+	for len(sub.MsgChannel()) > 0 {
+		got = append(got, (<-sub.MsgChannel()).Data)
+	}
+	if len(got) != 2 || got[0] != "2" || got[1] != "3" {
+		t.Fatalf("expecting the 2 newest prices got: %v", got)
+	}
+}
+
+func TestDispatcher_ChannelConfigDropNewest(t *testing.T) {
+	d, ft := newTestDispatcher(t, ackSubscriptions)
+	err := d.SetChannelConfigs([]channel.Config{{Pattern: "/prices/*", BufferSize: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := d.Subscribe("/prices/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reported error
+	d.OnError(func(err error) {
+		reported = err
+	})
+
+	for _, price := range []string{"1", "2"} {
+		ft.deliver(&message.Message{Channel: "/prices/eur", Data: price})
+	}
+	if !errors.Is(reported, ErrMessageDropped) {
+		t.Fatalf("expecting %v got: %v", ErrMessageDropped, reported)
+	}
+	if msg := <-sub.MsgChannel(); msg.Data != "1" {
+		t.Fatalf("expecting the first price got: %v", msg.Data)
+	}
+}
+
+func TestDispatcher_ChannelConfigDefault(t *testing.T) {
+	d, ft := newTestDispatcher(t, ackSubscriptions)
+	sub, err := d.Subscribe("/prices/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cap(sub.MsgChannel()) != channel.DefaultBufferSize {
+		t.Fatalf("expecting a queue of %d deliveries got: %d", channel.DefaultBufferSize, cap(sub.MsgChannel()))
+	}
+	//the deliveries are queued until the subscriber reads them
+	for _, price := range []string{"1", "2"} {
+		ft.deliver(&message.Message{Channel: "/prices/eur", Data: price})
+	}
+	for _, price := range []string{"1", "2"} {
+		if msg := <-sub.MsgChannel(); msg.Data != price {
+			t.Fatalf("expecting the price %s got: %v", price, msg.Data)
+		}
+	}
+
+	if err = d.SetChannelConfigs([]channel.Config{{Pattern: "/rates/*", BufferSize: -1}}); err != nil {
+		t.Fatal(err)
+	}
+	if sub, err = d.Subscribe("/rates/*"); err != nil {
+		t.Fatal(err)
+	}
+	if cap(sub.MsgChannel()) != 0 {
+		t.Fatalf("expecting unbuffered deliveries got a queue of: %d", cap(sub.MsgChannel()))
+	}
+}
+
+func TestDispatcher_ChannelConfigBlockUnsubscribe(t *testing.T) {
+	d, ft := newTestDispatcher(t, ackSubscriptions)
+	err := d.SetChannelConfigs([]channel.Config{{Pattern: "/prices/*", BufferSize: 1, Overflow: channel.Block}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := d.Subscribe("/prices/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.OnError(func(err error) {
+		t.Errorf("unexpected error: %v", err)
+	})
+
+	ft.deliver(&message.Message{Channel: "/prices/eur", Data: "1"})
+	delivered := make(chan struct{})
+	go func() {
+		defer close(delivered)
+		ft.deliver(&message.Message{Channel: "/prices/eur", Data: "2"})
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	//the blocked delivery gives up instead of sending on the closed channel
+	if err := sub.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-delivered:
+	case <-time.After(time.Second):
+		t.Fatal("expecting the blocked delivery to return")
+	}
+	if msg := <-sub.MsgChannel(); msg.Data != "1" {
+		t.Fatalf("expecting the first price got: %v", msg.Data)
+	}
+	if _, ok := <-sub.MsgChannel(); ok {
+		t.Fatal("expecting the channel closed")
+	}
+}
+
+func TestDispatcher_ChannelConfigDedup(t *testing.T) {
+	d, ft := newTestDispatcher(t, ackSubscriptions)
+	err := d.SetChannelConfigs([]channel.Config{{Pattern: "/orders", BufferSize: 10, Dedup: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := d.Subscribe("/orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"a", "b", "a", "c", "b"} {
+		ft.deliver(&message.Message{Channel: "/orders", Id: id, Data: id})
+	}
+
+	if len(sub.MsgChannel()) != 3 {
+		t.Fatalf("expecting 3 deliveries got: %d", len(sub.MsgChannel()))
+	}
+}
+
+func TestDispatcher_ChannelConfigInvalidPattern(t *testing.T) {
+	d, _ := newTestDispatcher(t, nil)
+	if err := d.SetChannelConfigs([]channel.Config{{Pattern: "/foo/**/bar"}}); err == nil {
+		t.Fatal("expecting error")
+	}
+}
+
+func TestDispatcher_SubscriptionFilter(t *testing.T) {
+	d, ft := newTestDispatcher(t, ackSubscriptions)
+	err := d.SetChannelConfigs([]channel.Config{{Pattern: "/prices/*", BufferSize: 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := d.Subscribe("/prices/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub.SetFilter(func(msg *message.Message) bool {
+		if msg.Data == "boom" {
+			panic("boom")
+		}
+		return msg.Channel == "/prices/eur"
+	})
+	var reported error
+	d.OnError(func(err error) {
+		reported = err
+	})
+
+	ft.deliver(&message.Message{Channel: "/prices/usd", Data: "1"})
+	ft.deliver(&message.Message{Channel: "/prices/eur", Data: "boom"})
+	ft.deliver(&message.Message{Channel: "/prices/eur", Data: "2"})
+	var panicErr *message.PanicError
+	if !errors.As(reported, &panicErr) {
+		t.Fatalf("expecting the filter panic reported got: %v", reported)
+	}
+	if n := len(sub.MsgChannel()); n != 1 {
+		t.Fatalf("expecting 1 message queued got: %d", n)
+	}
+	if msg := <-sub.MsgChannel(); msg.Data != "2" {
+		t.Fatalf("expecting the accepted message got: %v", msg.Data)
+	}
+}
+
+func TestDispatcher_SubscriptionMiddleware(t *testing.T) {
+	d, ft := newTestDispatcher(t, ackSubscriptions)
+	err := d.SetChannelConfigs([]channel.Config{{Pattern: "/prices/*", BufferSize: 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalid := errors.New("invalid price")
+	upper := func(msg *message.Message) (*message.Message, error) {
+		if msg.Data == "drop" {
+			return nil, nil
+		}
+		if msg.Data == "invalid" {
+			return nil, invalid
+		}
+		transformed := *msg
+		transformed.Data = strings.ToUpper(msg.Data.(string))
+		return &transformed, nil
+	}
+	sub, err := d.SubscribeCtx(context.Background(), "/prices/*", upper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the other subscriptions of the channel get the messages untouched
+	other, err := d.Subscribe("/prices/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reported error
+	d.OnError(func(err error) {
+		reported = err
+	})
+
+	for _, data := range []string{"drop", "invalid", "eur"} {
+		ft.deliver(&message.Message{Channel: "/prices/eur", Data: data})
+	}
+	if !errors.Is(reported, invalid) {
+		t.Fatalf("expecting the middleware error reported got: %v", reported)
+	}
+	if n := len(sub.MsgChannel()); n != 1 {
+		t.Fatalf("expecting 1 message queued got: %d", n)
+	}
+	if msg := <-sub.MsgChannel(); msg.Data != "EUR" {
+		t.Fatalf("expecting the transformed message got: %v", msg.Data)
+	}
+	if n := len(other.MsgChannel()); n != 3 {
+		t.Fatalf("expecting the messages of the other subscription untouched got: %d", n)
+	}
+}
@@ -0,0 +1,166 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"github.com/thesyncim/faye/message"
+	"sync/atomic"
+)
+
+//ErrQueueFull is returned by the publishes and subscribes that don't fit in the outgoing queue, see SetQueue
+var ErrQueueFull = errors.New("outgoing queue full")
+
+//QueuePolicy decides what happens to a message queued while the outgoing queue is full
+type QueuePolicy int
+
+const (
+	//QueueBlock waits for room in the queue until the operation context is done, this is the default policy
+	QueueBlock QueuePolicy = iota
+	//QueueDropOldest fails the oldest message queued with ErrQueueFull to make room
+	QueueDropOldest
+	//QueueDropNew fails the message with ErrQueueFull
+	QueueDropNew
+)
+
+//queuedMessage is a message waiting for the connection to be restored, result receives the outcome of its send
+type queuedMessage struct {
+	m      *message.Message
+	result chan error
+}
+
+//SetQueue bounds the outgoing queue holding the publishes and subscribes while the connection is restored,
+//size 0 doesn't bound it. policy applies when the queue is full.
+func (d *Dispatcher) SetQueue(size int, policy QueuePolicy) {
+	d.queueMu.Lock()
+	d.queueSize = size
+	d.queuePolicy = policy
+	d.queueMu.Unlock()
+}
+
+//Pending returns the number of messages waiting in the outgoing queue
+func (d *Dispatcher) Pending() int {
+	d.queueMu.Lock()
+	defer d.queueMu.Unlock()
+	return len(d.queue)
+}
+
+//send sends m, queueing it while the connection is restored. a failed send restores the connection, see resend
+func (d *Dispatcher) send(ctx context.Context, m *message.Message) error {
+	if !d.manualConnect && atomic.LoadInt32(&d.reconnecting) == 1 {
+		return d.enqueue(ctx, m)
+	}
+	if err := d.transport.SendMessage(m); err != nil {
+		return d.resend(ctx, m, err)
+	}
+	return nil
+}
+
+//enqueue queues m until the reconnect in flight completes and waits for its send, m is sent right away
+//if the reconnect completed meanwhile
+func (d *Dispatcher) enqueue(ctx context.Context, m *message.Message) error {
+	q := &queuedMessage{m: m, result: make(chan error, 1)}
+	for queued := false; !queued; {
+		d.queueMu.Lock()
+		if err := d.terminated(); err != nil {
+			d.queueMu.Unlock()
+			return err
+		}
+		if atomic.LoadInt32(&d.reconnecting) == 0 {
+			d.queueMu.Unlock()
+			m.ClientId = d.transport.ClientID()
+			return d.transport.SendMessage(m)
+		}
+		var dropped *queuedMessage
+		switch {
+		case d.queueSize <= 0 || len(d.queue) < d.queueSize:
+			d.queue = append(d.queue, q)
+			d.metrics.AddQueued(1)
+			d.stateChange()
+			queued = true
+		case d.queuePolicy == QueueDropNew:
+			d.queueMu.Unlock()
+			return ErrQueueFull
+		case d.queuePolicy == QueueDropOldest:
+			dropped = d.queue[0]
+			d.queue = append(d.queue[1:], q)
+			d.stateChange()
+			queued = true
+		}
+		if d.queueDrained == nil {
+			d.queueDrained = make(chan struct{})
+		}
+		drained := d.queueDrained
+		d.queueMu.Unlock()
+
+		if dropped != nil {
+			dropped.result <- ErrQueueFull
+		}
+		if !queued {
+			select {
+			case <-drained:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+
+	select {
+	case err := <-q.result:
+		return err
+	case <-ctx.Done():
+		d.dequeue(q)
+		return ctx.Err()
+	}
+}
+
+//dequeue removes q from the queue if it wasn't sent yet
+func (d *Dispatcher) dequeue(q *queuedMessage) {
+	d.queueMu.Lock()
+	defer d.queueMu.Unlock()
+	for i := range d.queue {
+		if d.queue[i] == q {
+			d.queue = append(d.queue[:i:i], d.queue[i+1:]...)
+			d.metrics.AddQueued(-1)
+			d.stateChange()
+			return
+		}
+	}
+}
+
+//drainQueue empties the queue and wakes up the operations blocked on a full queue, queueMu must be held
+func (d *Dispatcher) drainQueue() []*queuedMessage {
+	queue := d.queue
+	d.queue = nil
+	d.metrics.AddQueued(-len(queue))
+	d.stateChange()
+	if d.queueDrained != nil {
+		close(d.queueDrained)
+		d.queueDrained = nil
+	}
+	return queue
+}
+
+//flushQueue sends the messages queued during the reconnect in a single batch with the new clientId,
+//once the reconnect ended
+func (d *Dispatcher) flushQueue(queue []*queuedMessage) {
+	if len(queue) == 0 {
+		return
+	}
+	if err := d.terminated(); err != nil {
+		completeQueue(queue, err)
+		return
+	}
+	msgs := make([]*message.Message, len(queue))
+	for i := range queue {
+		queue[i].m.ClientId = d.transport.ClientID()
+		msgs[i] = queue[i].m
+	}
+	completeQueue(queue, d.transport.SendMessages(msgs))
+}
+
+//completeQueue completes the sends of the messages queued with err
+func completeQueue(queue []*queuedMessage, err error) {
+	for i := range queue {
+		queue[i].result <- err
+	}
+}
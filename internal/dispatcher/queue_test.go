@@ -0,0 +1,150 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"github.com/thesyncim/faye/channel"
+	"github.com/thesyncim/faye/clock"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"testing"
+	"time"
+)
+
+//reconnectingDispatcher returns a dispatcher whose reconnect waits for the fake clock to advance by a second
+func reconnectingDispatcher(t *testing.T, size int, policy QueuePolicy) (*Dispatcher, *fakeTransport, *clock.Fake) {
+	fake := clock.NewFake(time.Now())
+	ft := &fakeTransport{}
+	d := NewDispatcher("fake://", transport.Options{Clock: fake, RetryInterval: time.Second}, message.Extensions{})
+	d.SetTransport(ft)
+	if err := d.SetChannelConfigs([]channel.Config{{Pattern: "/foo", SkipAck: true}}); err != nil {
+		t.Fatal(err)
+	}
+	d.SetQueue(size, policy)
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	ft.onTransportDown(errors.New("connection reset"))
+	for fake.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	return d, ft, fake
+}
+
+//queuePublish publishes data in background once the queue holds queued messages, the outcome is sent to results
+func queuePublish(d *Dispatcher, data string, queued int, results chan<- string) {
+	for d.Pending() != queued {
+		time.Sleep(time.Millisecond)
+	}
+	go func() {
+		if err := d.Publish("/foo", data); err != nil {
+			results <- data + ": " + err.Error()
+			return
+		}
+		results <- data
+	}()
+}
+
+//publishedData returns the data published to /foo after the first n messages sent
+func publishedData(ft *fakeTransport, n int) []message.Data {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	var published []message.Data
+	for _, m := range ft.sent[n:] {
+		if m.Channel == "/foo" && m.ClientId != "" {
+			published = append(published, m.Data)
+		}
+	}
+	return published
+}
+
+func TestDispatcher_QueueOverflow(t *testing.T) {
+	var tests = []struct {
+		policy QueuePolicy
+		//dropped is the outcome of the publish dropped, published the data sent once reconnected
+		dropped   string
+		published string
+	}{
+		{QueueDropOldest, "first: " + ErrQueueFull.Error(), "second"},
+		{QueueDropNew, "second: " + ErrQueueFull.Error(), "first"},
+	}
+	for _, tt := range tests {
+		d, ft, fake := reconnectingDispatcher(t, 1, tt.policy)
+		results := make(chan string, 2)
+		queuePublish(d, "first", 0, results)
+		queuePublish(d, "second", 1, results)
+		if dropped := <-results; dropped != tt.dropped {
+			t.Fatalf("policy %v: expecting %s got: %s", tt.policy, tt.dropped, dropped)
+		}
+
+		ft.mu.Lock()
+		sent := len(ft.sent)
+		ft.mu.Unlock()
+		fake.Advance(time.Second)
+		select {
+		case published := <-results:
+			if published != tt.published {
+				t.Fatalf("policy %v: expecting %s published got: %s", tt.policy, tt.published, published)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("policy %v: expecting the queue flushed", tt.policy)
+		}
+		if d.Pending() != 0 {
+			t.Fatalf("policy %v: expecting the queue empty got: %d", tt.policy, d.Pending())
+		}
+		if published := publishedData(ft, sent); len(published) != 1 || published[0] != tt.published {
+			t.Fatalf("policy %v: expecting %s sent with the clientId got: %v", tt.policy, tt.published, published)
+		}
+	}
+}
+
+func TestDispatcher_QueueBlock(t *testing.T) {
+	d, ft, fake := reconnectingDispatcher(t, 1, QueueBlock)
+	results := make(chan string, 1)
+	queuePublish(d, "first", 0, results)
+	for d.Pending() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	//the publish waits for room until its context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := d.PublishCtx(ctx, "/foo", "second", 0); err != context.DeadlineExceeded {
+		t.Fatalf("expecting %v got: %v", context.DeadlineExceeded, err)
+	}
+
+	ft.mu.Lock()
+	sent := len(ft.sent)
+	ft.mu.Unlock()
+	fake.Advance(time.Second)
+	select {
+	case published := <-results:
+		if published != "first" {
+			t.Fatalf("expecting first published got: %s", published)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expecting the queue flushed")
+	}
+	if published := publishedData(ft, sent); len(published) != 1 || published[0] != "first" {
+		t.Fatalf("expecting first sent with the clientId got: %v", published)
+	}
+}
+
+func TestDispatcher_QueueTerminated(t *testing.T) {
+	d, _, _ := reconnectingDispatcher(t, 0, QueueBlock)
+	results := make(chan string, 1)
+	queuePublish(d, "data", 0, results)
+	for d.Pending() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	d.terminate(ErrReconnectNone)
+	select {
+	case result := <-results:
+		if expected := "data: " + ErrReconnectNone.Error(); result != expected {
+			t.Fatalf("expecting %s got: %s", expected, result)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expecting the queued publish to fail")
+	}
+}
@@ -0,0 +1,117 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+//ErrRateLimited is returned by the operations exceeding the rate limit with the RateLimitReject policy
+var ErrRateLimited = errors.New("rate limited")
+
+//RateLimitPolicy decides what happens to an operation exceeding the rate limit, see SetRateLimit
+type RateLimitPolicy int
+
+const (
+	//RateLimitBlock waits until the operation can be sent or its context is done, this is the default policy
+	RateLimitBlock RateLimitPolicy = iota
+	//RateLimitReject fails the operation with ErrRateLimited
+	RateLimitReject
+)
+
+//rateLimiter is a token bucket pacing the outgoing messages
+type rateLimiter struct {
+	policy     RateLimitPolicy
+	subscribes bool
+
+	mu    sync.Mutex
+	rate  float64
+	burst float64
+	//tokens are the messages that can be sent at last, it is negative while reservations are waiting
+	tokens float64
+	last   time.Time
+}
+
+//SetRateLimit paces the publishes at perSecond messages per second, in bursts of at most burst messages, 0
+//doesn't. subscribes paces the subscribes too. it must be called before Start.
+func (d *Dispatcher) SetRateLimit(perSecond float64, burst int, policy RateLimitPolicy, subscribes bool) {
+	if perSecond <= 0 {
+		d.limiter = nil
+		return
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	d.limiter = &rateLimiter{
+		policy:     policy,
+		subscribes: subscribes,
+		rate:       perSecond,
+		burst:      float64(burst),
+		tokens:     float64(burst),
+		last:       d.clock().Now(),
+	}
+}
+
+//throttle waits until n publishes and subscribes messages can be sent, according to the rate limit
+func (d *Dispatcher) throttle(ctx context.Context, publishes, subscribes int) error {
+	l := d.limiter
+	if l == nil {
+		return nil
+	}
+	n := publishes
+	if l.subscribes {
+		n += subscribes
+	}
+	if n == 0 {
+		return nil
+	}
+	wait, ok := l.reserve(d.clock().Now(), float64(n))
+	if !ok {
+		return ErrRateLimited
+	}
+	if wait <= 0 {
+		return nil
+	}
+	timer := d.clock().NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		l.cancel(float64(n))
+		return ctx.Err()
+	}
+}
+
+//reserve takes n tokens and returns how long to wait until they are available. ok is false if they aren't
+//available right away with the RateLimitReject policy, nothing is taken then.
+func (l *rateLimiter) reserve(now time.Time, n float64) (wait time.Duration, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if elapsed := now.Sub(l.last); elapsed > 0 {
+		l.tokens += elapsed.Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+		l.last = now
+	}
+	if l.policy == RateLimitReject && l.tokens < n {
+		return 0, false
+	}
+	l.tokens -= n
+	if l.tokens >= 0 {
+		return 0, true
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second)), true
+}
+
+//cancel returns the tokens of a reservation given up
+func (l *rateLimiter) cancel(n float64) {
+	l.mu.Lock()
+	l.tokens += n
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.mu.Unlock()
+}
@@ -0,0 +1,124 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"github.com/thesyncim/faye/clock"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Reserve(t *testing.T) {
+	start := time.Now()
+	tests := []struct {
+		name   string
+		policy RateLimitPolicy
+		after  []time.Duration
+		wait   []time.Duration
+		ok     []bool
+	}{
+		{
+			name:  "burst then wait",
+			after: []time.Duration{0, 0, 0, 0},
+			wait:  []time.Duration{0, 0, 500 * time.Millisecond, time.Second},
+			ok:    []bool{true, true, true, true},
+		},
+		{
+			name:  "refilled",
+			after: []time.Duration{0, 0, time.Second, 10 * time.Second, 10 * time.Second, 10 * time.Second},
+			wait:  []time.Duration{0, 0, 0, 0, 0, 500 * time.Millisecond},
+			ok:    []bool{true, true, true, true, true, true},
+		},
+		{
+			name:   "reject",
+			policy: RateLimitReject,
+			after:  []time.Duration{0, 0, 0, 500 * time.Millisecond},
+			wait:   []time.Duration{0, 0, 0, 0},
+			ok:     []bool{true, true, false, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &rateLimiter{policy: tt.policy, rate: 2, burst: 2, tokens: 2, last: start}
+			for i := range tt.after {
+				wait, ok := l.reserve(start.Add(tt.after[i]), 1)
+				if wait != tt.wait[i] || ok != tt.ok[i] {
+					t.Fatalf("reservation %d: expecting %v %v got: %v %v", i, tt.wait[i], tt.ok[i], wait, ok)
+				}
+			}
+		})
+	}
+}
+
+func TestDispatcher_RateLimit(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	d := NewDispatcher("fake://", transport.Options{Clock: fake}, message.Extensions{})
+	ft := &fakeTransport{reply: ackAll}
+	d.SetTransport(ft)
+	d.SetRateLimit(1, 1, RateLimitBlock, false)
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Disconnect()
+
+	if err := d.Publish("/foo", "1"); err != nil {
+		t.Fatal(err)
+	}
+	//the subscribes aren't paced
+	if _, err := d.Subscribe("/bar"); err != nil {
+		t.Fatal(err)
+	}
+	published := make(chan error, 1)
+	go func() {
+		published <- d.Publish("/foo", "2")
+	}()
+	for fake.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if n := len(sentOn(ft, "/foo")); n != 1 {
+		t.Fatalf("expecting the publish waiting got: %d sent", n)
+	}
+	fake.Advance(time.Second)
+	if err := <-published; err != nil {
+		t.Fatal(err)
+	}
+
+	//the waiting publish gives up with its context
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		published <- d.PublishCtx(ctx, "/foo", "3", 0)
+	}()
+	for fake.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-published; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expecting context.Canceled got: %v", err)
+	}
+	if n := len(sentOn(ft, "/foo")); n != 2 {
+		t.Fatalf("expecting the canceled publish not sent got: %d sent", n)
+	}
+}
+
+func TestDispatcher_RateLimitReject(t *testing.T) {
+	d, ft := newTestDispatcher(t, ackAll)
+	defer d.Disconnect()
+	d.SetRateLimit(0.001, 2, RateLimitReject, true)
+	if _, err := d.Subscribe("/bar"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Publish("/foo", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Publish("/foo", "2"); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expecting ErrRateLimited got: %v", err)
+	}
+	if _, err := d.Subscribe("/baz"); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expecting ErrRateLimited got: %v", err)
+	}
+	if len(sentOn(ft, "/foo")) != 1 || len(sentOn(ft, message.MetaSubscribe)) != 1 {
+		t.Fatal("expecting the rejected operations not sent")
+	}
+}
@@ -0,0 +1,96 @@
+package dispatcher
+
+import (
+	"context"
+	"github.com/thesyncim/faye/message"
+	"time"
+)
+
+//ErrResponseTimeout is returned when the server doesn't respond to a raw message within the requested timeout
+var ErrResponseTimeout error = &kindError{msg: "timeout waiting for the server response", kind: ErrTimeout}
+
+//SendRaw applies the out extensions and sends the message as is, the server response is discarded.
+//Id and ClientId are set if empty.
+func (d *Dispatcher) SendRaw(m *message.Message) error {
+	_, err := d.sendRaw(m)
+	return err
+}
+
+//SendRawWithResponse is like SendRaw but waits at most timeout for the server response with the same id,
+//a zero timeout waits forever. the response is not processed by the dispatcher.
+func (d *Dispatcher) SendRawWithResponse(m *message.Message, timeout time.Duration) (*message.Message, error) {
+	respCh, err := d.sendRaw(m)
+	if err != nil {
+		return nil, err
+	}
+
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := d.clock().NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C()
+	}
+
+	select {
+	case resp, ok := <-respCh:
+		if !ok {
+			return nil, d.terminated()
+		}
+		return resp, nil
+	case <-timeoutCh:
+		d.cancelResponse(m.Id)
+		return nil, ErrResponseTimeout
+	}
+}
+
+//sendRaw registers the message id so the response is routed to the returned channel and sends it
+func (d *Dispatcher) sendRaw(m *message.Message) (chan *message.Message, error) {
+	if err := d.terminated(); err != nil {
+		return nil, err
+	}
+	if m.Id == "" {
+		m.Id = d.nextMsgID()
+	}
+	if m.ClientId == "" && m.Channel != message.MetaHandshake {
+		m.ClientId = d.transport.ClientID()
+	}
+
+	respCh := d.awaitResponse(m.Id)
+	if err := d.sendMessage(context.Background(), m); err != nil {
+		d.cancelResponse(m.Id)
+		return nil, err
+	}
+	return respCh, nil
+}
+
+//awaitResponse registers the id so its response is routed to the returned channel instead of being dispatched,
+//the channel is closed if the dispatcher terminates
+func (d *Dispatcher) awaitResponse(id string) chan *message.Message {
+	respCh := make(chan *message.Message, 1)
+	d.rawMu.Lock()
+	d.rawPending[id] = respCh
+	d.rawMu.Unlock()
+	return respCh
+}
+
+//cancelResponse stops waiting for the response to id, a late response is dropped
+func (d *Dispatcher) cancelResponse(id string) {
+	d.rawMu.Lock()
+	delete(d.rawPending, id)
+	d.rawMu.Unlock()
+}
+
+//rawResponse routes the response of a raw message to its sender, it returns false if msg is not one
+func (d *Dispatcher) rawResponse(msg *message.Message) bool {
+	if msg.Id == "" || message.IsEventDelivery(msg) {
+		return false
+	}
+	d.rawMu.Lock()
+	respCh, ok := d.rawPending[msg.Id]
+	delete(d.rawPending, msg.Id)
+	d.rawMu.Unlock()
+	if ok {
+		respCh <- msg
+	}
+	return ok
+}
@@ -0,0 +1,46 @@
+package dispatcher
+
+import (
+	"github.com/thesyncim/faye/message"
+	"testing"
+	"time"
+)
+
+func TestDispatcher_SendRawWithResponse(t *testing.T) {
+	d, _ := newTestDispatcher(t, func(ft *fakeTransport, m *message.Message) {
+		if m.Channel == "/service/echo" {
+			go ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Successful: true, Ext: m.Ext})
+		}
+	})
+
+	resp, err := d.SendRawWithResponse(&message.Message{Channel: "/service/echo", Ext: "custom"}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Successful || resp.Ext != "custom" {
+		t.Fatalf("unexpected response: %#v", resp)
+	}
+}
+
+func TestDispatcher_SendRawMeta(t *testing.T) {
+	//a raw subscribe response is routed to the sender instead of the subscription handling
+	d, _ := newTestDispatcher(t, ackSubscriptions)
+
+	m := &message.Message{Channel: message.MetaSubscribe, Subscription: "/foo"}
+	resp, err := d.SendRawWithResponse(m, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Id != m.Id || m.ClientId != "fake-client" {
+		t.Fatalf("expecting correlated response got: %#v", resp)
+	}
+}
+
+func TestDispatcher_SendRawTimeout(t *testing.T) {
+	d, _ := newTestDispatcher(t, nil)
+
+	_, err := d.SendRawWithResponse(&message.Message{Channel: "/service/none"}, 10*time.Millisecond)
+	if err != ErrResponseTimeout {
+		t.Fatalf("expecting ErrResponseTimeout got: %v", err)
+	}
+}
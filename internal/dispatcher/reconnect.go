@@ -0,0 +1,288 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/thesyncim/faye/backoff"
+	"github.com/thesyncim/faye/internal/event"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/subscription"
+	"sync/atomic"
+	"time"
+)
+
+//ErrReconnectFailed is returned by any operation once the client gave up reconnecting after MaxRetries attempts
+var ErrReconnectFailed error = &kindError{msg: "reconnect failed", kind: ErrConnectionClosed}
+
+//ErrRehandshake is the cause of the reconnect attempts when the server advises the client to handshake again
+var ErrRehandshake = errors.New("server advised to handshake again")
+
+//defaultRetryInterval is the delay between reconnect attempts when the options don't set one
+const defaultRetryInterval = time.Second
+
+//ReconnectAttempt describes an attempt to restore the connection after the transport went down
+type ReconnectAttempt struct {
+	//Attempt is the attempt number, starting from 1
+	Attempt int
+	//Delay is the time waited before the attempt
+	Delay time.Duration
+	//Err is the error of the previous attempt, or the error that brought the transport down for the first one
+	Err error
+	//Endpoint is the endpoint the attempt connects to
+	Endpoint string
+}
+
+//SetRetryPolicy paces the reconnect attempts with p, nil waits RetryInterval before each of the MaxRetries attempts
+func (d *Dispatcher) SetRetryPolicy(p backoff.Policy) {
+	d.retryPolicy = p
+}
+
+//OnReconnectAttempt registers a handler called before every reconnect attempt
+func (d *Dispatcher) OnReconnectAttempt(onAttempt func(attempt ReconnectAttempt)) {
+	d.events.Subscribe(event.ReconnectAttempt, func(e event.Event) {
+		onAttempt(ReconnectAttempt{Attempt: e.Attempt, Delay: e.Delay, Err: e.Err, Endpoint: e.Endpoint})
+	})
+}
+
+//OnConnectionLost registers a handler called with the cause when the connection is lost, before reconnecting
+func (d *Dispatcher) OnConnectionLost(onLost func(err error)) {
+	d.events.Subscribe(event.ConnectionLost, func(e event.Event) {
+		onLost(e.Err)
+	})
+}
+
+//OnReconnect registers a handler called once the connection is restored and the subscriptions are sent again
+func (d *Dispatcher) OnReconnect(onReconnect func()) {
+	d.events.Subscribe(event.Reconnected, func(e event.Event) {
+		onReconnect()
+	})
+}
+
+//onTransportDown reconnects in background, unless the application drives the connection
+func (d *Dispatcher) onTransportDown(e event.Event) {
+	if d.manualConnect || d.Suspended() || d.terminated() != nil {
+		return
+	}
+	go d.reconnect(e.Err)
+}
+
+//reconnect restores the connection, trying the endpoints in turn at the pace of the retry policy until it
+//succeeds, the client is terminated once the policy gives up. concurrent calls share the running
+//reconnect, see resend.
+func (d *Dispatcher) reconnect(cause error) {
+	if d.beginReconnect() {
+		d.reconnectLoop(cause)
+	}
+}
+
+//beginReconnect registers a reconnect in flight, it returns false if one is running already
+func (d *Dispatcher) beginReconnect() bool {
+	d.reconnectMu.Lock()
+	defer d.reconnectMu.Unlock()
+	if d.reconnectDone != nil {
+		return false
+	}
+	d.reconnectDone = make(chan struct{})
+	atomic.StoreInt32(&d.reconnecting, 1)
+	return true
+}
+
+//endReconnect resumes the operations waiting for the reconnect and flushes the outgoing queue
+func (d *Dispatcher) endReconnect() {
+	d.reconnectMu.Lock()
+	//no message is queued once the flag is cleared
+	d.queueMu.Lock()
+	atomic.StoreInt32(&d.reconnecting, 0)
+	queue := d.drainQueue()
+	d.queueMu.Unlock()
+	close(d.reconnectDone)
+	d.reconnectDone = nil
+	d.reconnectMu.Unlock()
+	d.flushQueue(queue)
+}
+
+//resend sends again a message the transport failed to send, after restoring the connection. the concurrent
+//operations failing the same way share a single reconnect, their messages are queued until it completes.
+func (d *Dispatcher) resend(ctx context.Context, m *message.Message, sendErr error) error {
+	if d.manualConnect || d.terminated() != nil {
+		return sendErr
+	}
+	if d.beginReconnect() {
+		go d.reconnectLoop(sendErr)
+	}
+	return d.enqueue(ctx, m)
+}
+
+//reconnectLoop runs the reconnect registered by beginReconnect
+func (d *Dispatcher) reconnectLoop(cause error) {
+	defer d.endReconnect()
+
+	d.events.Publish(event.Event{Type: event.ConnectionLost, Err: cause})
+	d.setState(StateConnecting)
+	err := cause
+	for attempt := 1; d.terminated() == nil; attempt++ {
+		delay, ok := d.retryDelay(attempt)
+		if !ok {
+			d.terminate(fmt.Errorf("%w after %d attempts: %v", ErrReconnectFailed, attempt-1, err))
+			return
+		}
+		var endpoint string
+		endpoints, resolveErr := d.endpoints()
+		if resolveErr == nil {
+			endpoint = endpoints[(attempt-1)%len(endpoints)]
+		}
+		d.events.Publish(event.Event{Type: event.ReconnectAttempt, Attempt: attempt, Delay: delay, Err: err, Endpoint: endpoint})
+		if !d.sleep(delay) {
+			return
+		}
+		if resolveErr != nil {
+			err = resolveErr
+			continue
+		}
+		if err = d.restore(endpoint); err == nil {
+			d.metrics.Reconnected()
+			atomic.AddInt64(&d.reconnects, 1)
+			d.events.Publish(event.Event{Type: event.Reconnected, Attempt: attempt, Endpoint: endpoint})
+			return
+		}
+	}
+}
+
+//sleep waits for delay, it returns false if the client is terminated meanwhile
+func (d *Dispatcher) sleep(delay time.Duration) bool {
+	timer := d.clock().NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return d.terminated() == nil
+	case <-d.terminal:
+		return false
+	}
+}
+
+//retryDelay returns the delay before a reconnect attempt: the delay of the retry policy, or the interval advised
+//by the server when it is longer. ok is false once the policy gives up.
+func (d *Dispatcher) retryDelay(attempt int) (delay time.Duration, ok bool) {
+	policy := d.retryPolicy
+	if policy == nil {
+		interval := d.transportOpts.RetryInterval
+		if interval <= 0 {
+			interval = defaultRetryInterval
+		}
+		policy = backoff.Constant{Interval: interval, MaxAttempts: d.transportOpts.MaxRetries}
+	}
+	if delay, ok = policy.Delay(attempt); !ok {
+		return 0, false
+	}
+	if advice := d.Advice(); advice != nil && advice.Interval > delay {
+		delay = advice.Interval
+	}
+	return delay, true
+}
+
+//restore refreshes the credentials, connects to the endpoint, handshakes and resubscribes the channels of the subscriptions
+func (d *Dispatcher) restore(endpoint string) error {
+	if err := d.refreshCredentials(context.Background()); err != nil {
+		return err
+	}
+	if err := d.dialEndpoint(endpoint); err != nil {
+		return err
+	}
+	if _, err := d.metaHandshake(context.Background()); err != nil {
+		return err
+	}
+	d.resubscribe()
+	return d.transport.Connect(d.connectMessage())
+}
+
+//Resubscribe subscribes again the channels of the subscriptions, for the applications driving the connection
+//to restore them after a Handshake established a new session. it waits for the server confirmations, the
+//channels rejected close their subscriptions as when reconnecting and their errors are returned joined.
+func (d *Dispatcher) Resubscribe(ctx context.Context) error {
+	if err := d.terminated(); err != nil {
+		return err
+	}
+	var errs []error
+	for _, result := range d.resubscribe() {
+		select {
+		case err := <-result:
+			errs = append(errs, err)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return errors.Join(errs...)
+}
+
+//resubscribe subscribes again the channels of the subscriptions, a new clientId has no subscriptions.
+//failures are reported to the error handlers and handled by the resubscribe policies. the returned
+//channels receive the outcome of each channel once confirmed.
+func (d *Dispatcher) resubscribe() []<-chan error {
+	subs := d.store.Covered("/**")
+	byName := map[string][]*subscription.Subscription{}
+	for i := range subs {
+		byName[subs[i].Name()] = append(byName[subs[i].Name()], subs[i])
+	}
+	seen := map[string]bool{}
+	var (
+		msgs          []*message.Message
+		confirmations []chan error
+		results       []<-chan error
+	)
+	for i := range subs {
+		name := subs[i].Name()
+		//the paused channels are subscribed when resumed
+		if seen[name] || d.channelPaused(name) {
+			continue
+		}
+		seen[name] = true
+		m := &message.Message{
+			Channel:      message.MetaSubscribe,
+			ClientId:     d.transport.ClientID(),
+			Subscription: d.serverChannel(name),
+			Id:           d.nextMsgID(),
+		}
+		//request the messages published while the connection was lost
+		lastID, replaying := d.replayFrom(name)
+		if replaying {
+			m.SetExt(replayExt, map[string]interface{}{m.Subscription: lastID})
+		}
+		clientID := m.ClientId
+		confirmation := make(chan error, 1)
+		d.pendingSubsMu.Lock()
+		d.pendingSubs[m.Id] = confirmation
+		d.pendingSubsMu.Unlock()
+		result := make(chan error, 1)
+		go func() {
+			err := <-confirmation
+			if err != nil && replaying && d.terminated() == nil {
+				//the server can't replay from lastID, subscribe again from the current position
+				d.replayGap(name, lastID, err)
+				err = d.subscribeAgain(name, clientID)
+			}
+			if err != nil && d.terminated() == nil {
+				err = fmt.Errorf("resubscribe `%s`: %w", name, err)
+				d.rejected(name, byName[name], err)
+			}
+			result <- err
+		}()
+		msgs = append(msgs, m)
+		confirmations = append(confirmations, confirmation)
+		results = append(results, result)
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	if err := d.transport.SendMessages(msgs); err != nil {
+		d.pendingSubsMu.Lock()
+		for i := range msgs {
+			if _, ok := d.pendingSubs[msgs[i].Id]; ok {
+				delete(d.pendingSubs, msgs[i].Id)
+				confirmations[i] <- err
+			}
+		}
+		d.pendingSubsMu.Unlock()
+	}
+	return results
+}
@@ -0,0 +1,414 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"github.com/thesyncim/faye/backoff"
+	"github.com/thesyncim/faye/channel"
+	"github.com/thesyncim/faye/clock"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/subscription"
+	"github.com/thesyncim/faye/transport"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDispatcher_ReconnectAttempts(t *testing.T) {
+	ft := &fakeTransport{reply: ackSubscriptions}
+	d := NewDispatcher("ws://a", transport.Options{RetryInterval: time.Millisecond}, message.Extensions{})
+	d.SetTransport(ft)
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Subscribe("/foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	attempts := make(chan ReconnectAttempt, 10)
+	d.OnReconnectAttempt(func(attempt ReconnectAttempt) {
+		attempts <- attempt
+	})
+	cause := errors.New("connection reset")
+	dialErr := errors.New("connection refused")
+	ft.mu.Lock()
+	ft.initErrs = []error{dialErr}
+	ft.mu.Unlock()
+	ft.onTransportDown(cause)
+
+	for i, expectedErr := range []error{cause, dialErr} {
+		select {
+		case attempt := <-attempts:
+			if attempt.Attempt != i+1 || attempt.Err != expectedErr || attempt.Endpoint != "ws://a" || attempt.Delay != time.Millisecond {
+				t.Fatalf("unexpected attempt %+v", attempt)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expecting attempt %d", i+1)
+		}
+	}
+
+	//the subscriptions are restored once reconnected
+	deadline := time.Now().Add(time.Second)
+	for {
+		ft.mu.Lock()
+		n := len(ft.batches)
+		ft.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expecting the subscriptions to be restored")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if sub := lastSubscribe(ft); sub.Subscription != "/foo" {
+		t.Fatalf("expecting /foo resubscribed got: %s", sub.Subscription)
+	}
+}
+
+func TestDispatcher_ReconnectMaxRetries(t *testing.T) {
+	ft := &fakeTransport{}
+	d := NewDispatcher("ws://a", transport.Options{RetryInterval: time.Millisecond, MaxRetries: 2}, message.Extensions{})
+	d.SetTransport(ft)
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	disconnected := make(chan error, 1)
+	d.OnDisconnect(func(err error) {
+		disconnected <- err
+	})
+	ft.mu.Lock()
+	ft.initErrs = []error{errors.New("refused"), errors.New("refused")}
+	ft.mu.Unlock()
+	ft.onTransportDown(errors.New("connection reset"))
+
+	select {
+	case err := <-disconnected:
+		if !errors.Is(err, ErrReconnectFailed) {
+			t.Fatalf("expecting %v got: %v", ErrReconnectFailed, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expecting the client disconnected after the retries")
+	}
+}
+
+func TestDispatcher_RetryPolicy(t *testing.T) {
+	ft := &fakeTransport{}
+	d := NewDispatcher("ws://a", transport.Options{RetryInterval: time.Hour}, message.Extensions{})
+	d.SetTransport(ft)
+	d.SetRetryPolicy(&backoff.Exponential{InitialInterval: time.Millisecond, Multiplier: 2, MaxAttempts: 3})
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	var delays []time.Duration
+	d.OnReconnectAttempt(func(attempt ReconnectAttempt) {
+		delays = append(delays, attempt.Delay)
+	})
+	disconnected := make(chan error, 1)
+	d.OnDisconnect(func(err error) {
+		disconnected <- err
+	})
+	ft.mu.Lock()
+	ft.initErrs = []error{errors.New("refused"), errors.New("refused"), errors.New("refused")}
+	ft.mu.Unlock()
+	ft.onTransportDown(errors.New("connection reset"))
+
+	select {
+	case err := <-disconnected:
+		if !errors.Is(err, ErrReconnectFailed) {
+			t.Fatalf("expecting %v got: %v", ErrReconnectFailed, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expecting the client disconnected once the policy gave up")
+	}
+	expected := []time.Duration{time.Millisecond, 2 * time.Millisecond, 4 * time.Millisecond}
+	if len(delays) != len(expected) {
+		t.Fatalf("expecting the delays %v got: %v", expected, delays)
+	}
+	for i := range expected {
+		if delays[i] != expected[i] {
+			t.Fatalf("expecting the delays %v got: %v", expected, delays)
+		}
+	}
+}
+
+func TestDispatcher_ServerDisconnect(t *testing.T) {
+	ft := &fakeTransport{}
+	d := NewDispatcher("ws://a", transport.Options{RetryInterval: time.Millisecond}, message.Extensions{})
+	d.SetTransport(ft)
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	attempts := make(chan ReconnectAttempt, 10)
+	d.OnReconnectAttempt(func(attempt ReconnectAttempt) {
+		attempts <- attempt
+	})
+
+	ft.deliver(&message.Message{Channel: message.MetaDisconnect, Successful: true})
+	select {
+	case attempt := <-attempts:
+		if !errors.Is(attempt.Err, ErrServerDisconnect) {
+			t.Fatalf("expecting %v got: %v", ErrServerDisconnect, attempt.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expecting the client to reconnect")
+	}
+	for atomic.LoadInt32(&d.reconnecting) == 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	//the response to our disconnect is expected
+	if err := d.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	ft.deliver(&message.Message{Channel: message.MetaDisconnect, Successful: true})
+	select {
+	case attempt := <-attempts:
+		t.Fatalf("unexpected attempt %+v", attempt)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestDispatcher_ResubscribeFailureClosesSubscriptions(t *testing.T) {
+	var reconnected int32
+	ft := &fakeTransport{reply: func(ft *fakeTransport, m *message.Message) {
+		if m.Channel == message.MetaSubscribe && atomic.LoadInt32(&reconnected) == 1 {
+			go ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Subscription: m.Subscription, Error: "403::forbidden"})
+			return
+		}
+		ackSubscriptions(ft, m)
+	}}
+	d := NewDispatcher("ws://a", transport.Options{RetryInterval: time.Millisecond}, message.Extensions{})
+	d.SetTransport(ft)
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := d.Subscribe("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reported := make(chan error, 1)
+	sub.OnError(func(err error) {
+		reported <- err
+	})
+
+	atomic.StoreInt32(&reconnected, 1)
+	ft.onTransportDown(errors.New("connection reset"))
+	select {
+	case <-sub.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expecting the subscription closed after the server refused it")
+	}
+	if _, ok := <-sub.MsgChannel(); ok {
+		t.Fatal("expecting the message channel closed")
+	}
+	var subErr *SubscriptionError
+	if err = <-reported; !errors.As(err, &subErr) || subErr.Code != 403 || sub.CloseErr() != err {
+		t.Fatalf("expecting the subscription error reported got: %v", err)
+	}
+}
+
+func TestDispatcher_Resubscribe(t *testing.T) {
+	var rejecting int32
+	ft := &fakeTransport{reply: func(ft *fakeTransport, m *message.Message) {
+		if m.Channel == message.MetaSubscribe && m.Subscription == "/bar" && atomic.LoadInt32(&rejecting) == 1 {
+			go ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Subscription: m.Subscription, Error: "403::forbidden"})
+			return
+		}
+		ackSubscriptions(ft, m)
+	}}
+	d, _ := connectTestDispatcher(t, ft)
+	if err := d.SetChannelConfigs([]channel.Config{{Pattern: "/foo", BufferSize: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	foo, err := d.Subscribe("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bar, err := d.Subscribe("/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ft.deliver(&message.Message{Channel: "/foo", Data: "1"})
+	ft.deliver(&message.Message{Channel: "/foo", Data: "2"})
+
+	infos := d.Subscriptions()
+	if len(infos) != 2 || infos[0].Channel != "/foo" || infos[1].Channel != "/bar" {
+		t.Fatalf("expecting the subscriptions oldest first got: %+v", infos)
+	}
+	if infos[0].State != subscription.StateActive || infos[0].Messages != 2 || infos[1].Messages != 0 {
+		t.Fatalf("expecting the active subscriptions with their message count got: %+v", infos)
+	}
+
+	atomic.StoreInt32(&rejecting, 1)
+	err = d.Resubscribe(context.Background())
+	var subErr *SubscriptionError
+	if !errors.As(err, &subErr) || subErr.Code != 403 || bar.CloseErr() == nil {
+		t.Fatalf("expecting the rejected channel reported got: %v", err)
+	}
+	if foo.State() != subscription.StateActive {
+		t.Fatalf("expecting /foo still active got: %v", foo.State())
+	}
+	ft.mu.Lock()
+	batch := ft.batches[len(ft.batches)-1]
+	ft.mu.Unlock()
+	if len(batch) != 2 {
+		t.Fatalf("expecting both channels subscribed again in a batch got: %d", len(batch))
+	}
+	if infos = d.Subscriptions(); len(infos) != 1 || infos[0].Channel != "/foo" {
+		t.Fatalf("expecting the rejected subscription removed got: %+v", infos)
+	}
+}
+
+func TestDispatcher_ReconnectClock(t *testing.T) {
+	var handshakes int32
+	ft := &fakeTransport{onHandshake: func(m *message.Message) {
+		atomic.AddInt32(&handshakes, 1)
+	}}
+	fake := clock.NewFake(time.Now())
+	d := NewDispatcher("ws://a", transport.Options{RetryInterval: time.Hour, Clock: fake}, message.Extensions{})
+	d.SetTransport(ft)
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	ft.onTransportDown(errors.New("connection reset"))
+	for fake.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&handshakes); n != 1 {
+		t.Fatalf("expecting the reconnect to wait for the retry interval got %d handshakes", n)
+	}
+	fake.Advance(time.Hour)
+	for atomic.LoadInt32(&handshakes) != 2 {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDispatcher_DisconnectDuringBackoff(t *testing.T) {
+	var handshakes int32
+	ft := &fakeTransport{onHandshake: func(m *message.Message) {
+		atomic.AddInt32(&handshakes, 1)
+	}}
+	fake := clock.NewFake(time.Now())
+	d := NewDispatcher("ws://a", transport.Options{RetryInterval: time.Hour, Clock: fake}, message.Extensions{})
+	d.SetTransport(ft)
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	ft.onTransportDown(errors.New("connection reset"))
+	for fake.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := d.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	//the pending reconnect gives up instead of opening a new session
+	fake.Advance(time.Hour)
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&d.reconnecting) == 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&handshakes); n != 1 {
+		t.Fatalf("expecting no handshake once disconnected got %d handshakes", n)
+	}
+}
+
+//brokenTransport fails the sends while broken, until the transport is initialized again
+type brokenTransport struct {
+	*fakeTransport
+	broken int32
+}
+
+func (t *brokenTransport) Init(endpoint string, options *transport.Options) error {
+	atomic.StoreInt32(&t.broken, 0)
+	return t.fakeTransport.Init(endpoint, options)
+}
+
+func (t *brokenTransport) SendMessage(msg *message.Message) error {
+	if atomic.LoadInt32(&t.broken) == 1 {
+		return errors.New("broken pipe")
+	}
+	return t.fakeTransport.SendMessage(msg)
+}
+
+func TestDispatcher_SingleFlightReconnect(t *testing.T) {
+	var handshakes int32
+	bt := &brokenTransport{fakeTransport: &fakeTransport{
+		onHandshake: func(m *message.Message) {
+			atomic.AddInt32(&handshakes, 1)
+		},
+		reply: func(ft *fakeTransport, m *message.Message) {
+			if m.Channel == "/foo" {
+				go ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Successful: true})
+			}
+		},
+	}}
+	d := NewDispatcher("fake://", transport.Options{RetryInterval: 10 * time.Millisecond}, message.Extensions{})
+	d.SetTransport(bt)
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	atomic.StoreInt32(&bt.broken, 1)
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- d.PublishWithTimeout("/foo", i, time.Second)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("expecting the publishes resumed after the reconnect got: %v", err)
+		}
+	}
+	if got := atomic.LoadInt32(&handshakes); got != 2 {
+		t.Fatalf("expecting a single handshake for all the publishes got: %d", got-1)
+	}
+}
+
+func TestDispatcher_ReconnectHooks(t *testing.T) {
+	ft := &fakeTransport{reply: ackSubscriptions}
+	d := NewDispatcher("ws://a", transport.Options{RetryInterval: time.Millisecond}, message.Extensions{})
+	d.SetTransport(ft)
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	//the server asks for a longer interval than the local retry interval
+	d.handleAdvice(&message.Advise{Reconnect: message.ReconnectRetry, Interval: 20 * time.Millisecond})
+
+	lost := make(chan error, 1)
+	d.OnConnectionLost(func(err error) {
+		lost <- err
+	})
+	attempts := make(chan ReconnectAttempt, 1)
+	d.OnReconnectAttempt(func(attempt ReconnectAttempt) {
+		attempts <- attempt
+	})
+	reconnected := make(chan struct{})
+	d.OnReconnect(func() {
+		close(reconnected)
+	})
+	cause := errors.New("connection reset")
+	ft.onTransportDown(cause)
+
+	if err := <-lost; err != cause {
+		t.Fatalf("expecting %v got: %v", cause, err)
+	}
+	if attempt := <-attempts; attempt.Delay != 20*time.Millisecond {
+		t.Fatalf("expecting the advised interval as delay got: %v", attempt.Delay)
+	}
+	select {
+	case <-reconnected:
+	case <-time.After(time.Second):
+		t.Fatal("expecting the reconnect handler called")
+	}
+}
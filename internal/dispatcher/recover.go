@@ -0,0 +1,36 @@
+package dispatcher
+
+import (
+	"errors"
+	"fmt"
+	"github.com/thesyncim/faye/internal/event"
+	"github.com/thesyncim/faye/message"
+	"strings"
+)
+
+//ErrInvalidMessage is reported to the error handlers when the server sends a message that isn't a valid Bayeux
+//envelope, e.g. a message without channel. the message is discarded.
+var ErrInvalidMessage = errors.New("invalid message from server")
+
+//receive handles the messages received by the transport. the invalid ones are discarded and a panic while
+//dispatching, e.g. in a callback, is reported instead of killing the read loop of the transport.
+func (d *Dispatcher) receive(msg *message.Message) {
+	if err := validateIncoming(msg); err != nil {
+		d.events.Publish(event.Event{Type: event.Error, Err: err, Message: msg})
+		return
+	}
+	if err := message.CatchPanic(func() { d.dispatchMessage(msg) }); err != nil {
+		d.events.Publish(event.Event{Type: event.Error, Err: fmt.Errorf("dispatch: %w", err), Message: msg})
+	}
+}
+
+//validateIncoming checks the envelope of a message received
+func validateIncoming(msg *message.Message) error {
+	switch {
+	case msg == nil:
+		return fmt.Errorf("%w: empty message", ErrInvalidMessage)
+	case !strings.HasPrefix(msg.Channel, "/"):
+		return fmt.Errorf("%w: channel `%s`", ErrInvalidMessage, msg.Channel)
+	}
+	return nil
+}
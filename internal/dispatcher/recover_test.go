@@ -0,0 +1,78 @@
+package dispatcher
+
+import (
+	"errors"
+	"github.com/thesyncim/faye/channel"
+	"github.com/thesyncim/faye/internal/event"
+	"github.com/thesyncim/faye/message"
+	"testing"
+	"time"
+)
+
+func TestDispatcher_ReceiveInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  *message.Message
+	}{
+		{name: "nil"},
+		{name: "no channel", msg: &message.Message{Data: "bar"}},
+		{name: "relative channel", msg: &message.Message{Channel: "foo", Data: "bar"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, ft := newTestDispatcher(t, nil)
+			defer d.Disconnect()
+			errs := make(chan error, 1)
+			d.OnError(func(err error) {
+				errs <- err
+			})
+			ft.onMsg(tt.msg)
+			select {
+			case err := <-errs:
+				if !errors.Is(err, ErrInvalidMessage) {
+					t.Fatalf("expecting ErrInvalidMessage got: %v", err)
+				}
+			default:
+				t.Fatal("expecting the invalid message reported")
+			}
+		})
+	}
+}
+
+func TestDispatcher_ReceivePanic(t *testing.T) {
+	d, ft := newTestDispatcher(t, ackSubscriptions)
+	defer d.Disconnect()
+	errs := make(chan error, 1)
+	d.OnError(func(err error) {
+		errs <- err
+	})
+	//a bug on the dispatch path
+	d.events.Subscribe(event.Meta, func(e event.Event) {
+		if e.Message.Channel == message.MetaUnsubscribe {
+			panic("boom")
+		}
+	})
+	ft.onMsg(&message.Message{Channel: message.MetaUnsubscribe, Successful: true})
+	var panicErr *message.PanicError
+	if err := <-errs; !errors.As(err, &panicErr) || panicErr.Value != "boom" {
+		t.Fatalf("expecting a *message.PanicError got: %v", err)
+	}
+
+	//the next messages are still dispatched
+	if err := d.SetChannelConfigs([]channel.Config{{Pattern: "/foo", BufferSize: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := d.Subscribe("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ft.deliver(&message.Message{Channel: "/foo", Data: "bar"})
+	select {
+	case msg := <-sub.MsgChannel():
+		if msg.Data != "bar" {
+			t.Fatalf("expecting bar got: %v", msg.Data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expecting the message delivered")
+	}
+}
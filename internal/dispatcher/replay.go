@@ -0,0 +1,128 @@
+package dispatcher
+
+import (
+	"encoding/json"
+	"github.com/thesyncim/faye/internal/event"
+	"github.com/thesyncim/faye/message"
+	"hash/fnv"
+	"strconv"
+)
+
+//replayExt is the ext key used to request the redelivery of the messages following an id, e.g.
+//{"ext":{"replay":{"/foo":"42"}}} on /meta/subscribe. servers advertise the support during the handshake
+//with {"ext":{"replay":true}}
+const replayExt = "replay"
+
+//replayBuffer remembers the messages recently delivered on a channel
+type replayBuffer struct {
+	recent *idWindow
+	lastID string
+}
+
+//SetReplayBuffer enables the replay buffer keeping the last size deliveries of each channel, 0 disables it
+func (d *Dispatcher) SetReplayBuffer(size int) {
+	d.replayMu.Lock()
+	d.replaySize = size
+	d.replay = map[string]*replayBuffer{}
+	d.replayMu.Unlock()
+}
+
+//trackDeliveries records the deliveries of the channel of an AtLeastOnce subscription even if the replay buffer
+//is disabled, the window defaults to the dedup one. the wildcard subscriptions are not replayed, their messages
+//are recorded by channel
+func (d *Dispatcher) trackDeliveries(channel string) {
+	d.replayMu.Lock()
+	defer d.replayMu.Unlock()
+	if d.replay == nil {
+		d.replay = map[string]*replayBuffer{}
+	}
+	if _, ok := d.replay[channel]; !ok {
+		d.replay[channel] = &replayBuffer{recent: newIDWindow(d.replayWindow())}
+	}
+}
+
+//replayWindow returns the number of deliveries remembered by channel. replayMu must be held
+func (d *Dispatcher) replayWindow() int {
+	if d.replaySize == 0 {
+		return dedupWindow
+	}
+	return d.replaySize
+}
+
+//OnReplayGap registers a handler called when the server can't replay the messages following lastID,
+//the messages delivered on channel in the meantime are lost
+func (d *Dispatcher) OnReplayGap(onGap func(channel string, lastID string, err error)) {
+	d.events.Subscribe(event.ReplayGap, func(e event.Event) {
+		onGap(e.Channel, e.MessageID, e.Err)
+	})
+}
+
+//handshakeReplay records whether the server supports replay from its handshake response ext
+func (d *Dispatcher) handshakeReplay(resp *message.Message) {
+	ext, _ := resp.Ext.(map[string]interface{})
+	capable, _ := ext[replayExt].(bool)
+	d.replayMu.Lock()
+	d.replayCapable = capable
+	d.replayMu.Unlock()
+}
+
+//recordDelivery adds the message to the channel replay buffer, or to the one tracked by trackDeliveries,
+//it returns true if the message was already delivered and must be discarded
+func (d *Dispatcher) recordDelivery(msg *message.Message) bool {
+	d.replayMu.Lock()
+	defer d.replayMu.Unlock()
+	buf, ok := d.replay[msg.Channel]
+	if !ok {
+		//only the channels tracked are recorded when the replay buffer is disabled
+		if d.replaySize == 0 {
+			return false
+		}
+		buf = &replayBuffer{recent: newIDWindow(d.replaySize)}
+		d.replay[msg.Channel] = buf
+	}
+	if buf.recent.seen(deliveryKey(msg)) {
+		return true
+	}
+	if msg.Id != "" {
+		buf.lastID = msg.Id
+		d.stateChange()
+	}
+	return false
+}
+
+//replayFrom returns the id of the last message delivered on a channel matching the subscription,
+//ok is false if the server is not replay capable or there is no history
+func (d *Dispatcher) replayFrom(subscription string) (lastID string, ok bool) {
+	d.replayMu.Lock()
+	defer d.replayMu.Unlock()
+	if !d.replayCapable {
+		return "", false
+	}
+	buf, ok := d.replay[subscription]
+	if !ok || buf.lastID == "" {
+		return "", false
+	}
+	return buf.lastID, true
+}
+
+//replayGap forgets the channel history and notifies the application that messages were lost
+func (d *Dispatcher) replayGap(channel string, lastID string, err error) {
+	d.replayMu.Lock()
+	if _, ok := d.replay[channel]; ok {
+		//restarted, the channel stays tracked
+		d.replay[channel] = &replayBuffer{recent: newIDWindow(d.replayWindow())}
+	}
+	d.replayMu.Unlock()
+	d.events.Publish(event.Event{Type: event.ReplayGap, Channel: channel, MessageID: lastID, Err: err})
+}
+
+//deliveryKey identifies a delivery by its id, or by its payload hash when the server doesn't send ids
+func deliveryKey(msg *message.Message) string {
+	if msg.Id != "" {
+		return msg.Id
+	}
+	b, _ := json.Marshal(msg.Data)
+	h := fnv.New64a()
+	h.Write(b)
+	return "#" + strconv.FormatUint(h.Sum64(), 16)
+}
@@ -0,0 +1,180 @@
+package dispatcher
+
+import (
+	"context"
+	"github.com/thesyncim/faye/channel"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/subscription"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newReplayDispatcher(t *testing.T, reply func(t *fakeTransport, m *message.Message)) (*Dispatcher, *fakeTransport) {
+	d, ft := connectTestDispatcher(t, &fakeTransport{
+		reply:        reply,
+		handshakeExt: map[string]interface{}{"replay": true},
+	})
+	d.SetReplayBuffer(10)
+	if err := d.SetChannelConfigs([]channel.Config{{Pattern: "/**", BufferSize: 10}}); err != nil {
+		t.Fatal(err)
+	}
+	return d, ft
+}
+
+func lastSubscribe(ft *fakeTransport) *message.Message {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	for i := len(ft.sent) - 1; i >= 0; i-- {
+		if ft.sent[i].Channel == message.MetaSubscribe {
+			return ft.sent[i]
+		}
+	}
+	return nil
+}
+
+func TestDispatcher_ReplayRequestsGap(t *testing.T) {
+	d, ft := newReplayDispatcher(t, ackSubscriptions)
+
+	sub, err := d.Subscribe("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastSubscribe(ft).Ext != nil {
+		t.Fatal("expecting no replay request without history")
+	}
+	ft.deliver(&message.Message{Channel: "/foo", Id: "1", Data: "a"})
+	ft.deliver(&message.Message{Channel: "/foo", Id: "2", Data: "b"})
+	if err = sub.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+
+	sub, err = d.Subscribe("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"replay": map[string]interface{}{"/foo": "2"}}
+	if !reflect.DeepEqual(lastSubscribe(ft).Ext, expected) {
+		t.Fatalf("expecting ext %v got: %v", expected, lastSubscribe(ft).Ext)
+	}
+
+	//the server replays from the requested id, duplicates are discarded
+	ft.deliver(&message.Message{Channel: "/foo", Id: "2", Data: "b"})
+	ft.deliver(&message.Message{Channel: "/foo", Id: "3", Data: "c"})
+	if len(sub.MsgChannel()) != 1 {
+		t.Fatalf("expecting 1 delivery got: %d", len(sub.MsgChannel()))
+	}
+	if msg := <-sub.MsgChannel(); msg.Id != "3" {
+		t.Fatalf("expecting message 3 got: %s", msg.Id)
+	}
+}
+
+func TestDispatcher_ReplayGap(t *testing.T) {
+	d, ft := newReplayDispatcher(t, func(ft *fakeTransport, m *message.Message) {
+		if m.Channel != message.MetaSubscribe {
+			ackSubscriptions(ft, m)
+			return
+		}
+		resp := &message.Message{Channel: m.Channel, Id: m.Id, Subscription: m.Subscription, Successful: true}
+		if m.Ext != nil {
+			resp.Successful = false
+			resp.Error = "400::replay id unavailable"
+		}
+		go ft.deliver(resp)
+	})
+
+	var gapChannel, gapID string
+	d.OnReplayGap(func(channel string, lastID string, err error) {
+		gapChannel, gapID = channel, lastID
+	})
+
+	sub, err := d.Subscribe("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ft.deliver(&message.Message{Channel: "/foo", Id: "7", Data: "a"})
+	if err = sub.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+
+	//the subscription set up by the caller continues from the current position
+	upper := func(msg *message.Message) (*message.Message, error) {
+		return &message.Message{Channel: msg.Channel, Id: msg.Id, Data: strings.ToUpper(msg.Data.(string))}, nil
+	}
+	sub, err = d.SubscribeDelivery(context.Background(), "/foo", subscription.AtLeastOnce, upper)
+	if err != nil {
+		t.Fatalf("expecting the subscription to continue after the gap got: %v", err)
+	}
+	if sub.DeliveryMode() != subscription.AtLeastOnce {
+		t.Fatalf("expecting the delivery mode kept got: %v", sub.DeliveryMode())
+	}
+	ft.deliver(&message.Message{Channel: "/foo", Id: "8", Data: "b"})
+	if msg := <-sub.MsgChannel(); msg.Data != "B" {
+		t.Fatalf("expecting the middleware kept got: %v", msg.Data)
+	}
+	if gapChannel != "/foo" || gapID != "7" {
+		t.Fatalf("expecting gap on /foo after 7 got: %s %s", gapChannel, gapID)
+	}
+	if lastSubscribe(ft).Ext != nil {
+		t.Fatal("expecting the last subscribe without replay request")
+	}
+}
+
+func TestDispatcher_ReplayNotCapable(t *testing.T) {
+	d, ft := newTestDispatcher(t, ackSubscriptions)
+	d.SetReplayBuffer(10)
+
+	sub, err := d.Subscribe("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ft.deliver(&message.Message{Channel: "/foo", Id: "1", Data: "a"})
+	if err = sub.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Subscribe("/foo"); err != nil {
+		t.Fatal(err)
+	}
+	if lastSubscribe(ft).Ext != nil {
+		t.Fatal("expecting no replay request to a server without replay support")
+	}
+}
+
+func TestDispatcher_AtLeastOnce(t *testing.T) {
+	d, ft := connectTestDispatcher(t, &fakeTransport{
+		reply:        ackSubscriptions,
+		handshakeExt: map[string]interface{}{"replay": true},
+	})
+	if err := d.SetChannelConfigs([]channel.Config{{Pattern: "/**", BufferSize: 10}}); err != nil {
+		t.Fatal(err)
+	}
+
+	sub, err := d.SubscribeDelivery(context.Background(), "/foo", subscription.AtLeastOnce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ft.deliver(&message.Message{Channel: "/foo", Id: "1", Data: "a"})
+	ft.deliver(&message.Message{Channel: "/foo", Id: "1", Data: "a"})
+	ft.deliver(&message.Message{Channel: "/foo", Id: "2", Data: "b"})
+	if len(sub.MsgChannel()) != 2 {
+		t.Fatalf("expecting 2 deliveries got: %d", len(sub.MsgChannel()))
+	}
+
+	//the channel is subscribed again from the last delivery without a replay buffer
+	if err = d.Resubscribe(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"replay": map[string]interface{}{"/foo": "2"}}
+	if !reflect.DeepEqual(lastSubscribe(ft).Ext, expected) {
+		t.Fatalf("expecting ext %v got: %v", expected, lastSubscribe(ft).Ext)
+	}
+
+	//the at most once subscriptions aren't tracked
+	if _, err = d.Subscribe("/bar"); err != nil {
+		t.Fatal(err)
+	}
+	ft.deliver(&message.Message{Channel: "/bar", Id: "3", Data: "c"})
+	if _, ok := d.replayFrom("/bar"); ok {
+		t.Fatal("expecting no replay of /bar")
+	}
+}
@@ -0,0 +1,130 @@
+package dispatcher
+
+import (
+	"fmt"
+	"github.com/thesyncim/faye/internal/event"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/subscription"
+)
+
+//SetResubscribePolicy sets what happens to the subscriptions whose channel the server rejects while they are
+//restored on a new session, subscription.DropOnReject by default. the subscriptions may set their own policy,
+//see subscription.Subscription.SetResubscribePolicy
+func (d *Dispatcher) SetResubscribePolicy(policy subscription.ResubscribePolicy) {
+	d.resubscribePolicy = policy
+}
+
+//resubscribePolicyOf returns the policy applying to sub
+func (d *Dispatcher) resubscribePolicyOf(sub *subscription.Subscription) subscription.ResubscribePolicy {
+	if policy := sub.ResubscribePolicy(); policy != subscription.ResubscribeDefault {
+		return policy
+	}
+	if d.resubscribePolicy == subscription.ResubscribeDefault {
+		return subscription.DropOnReject
+	}
+	return d.resubscribePolicy
+}
+
+//rejected applies the resubscribe policies to the subscriptions of the channel the server rejected with err,
+//a single subscription failing on reject terminates the client
+func (d *Dispatcher) rejected(name string, subs []*subscription.Subscription, err error) {
+	d.events.Publish(event.Event{Type: event.Error, Err: err, Channel: name})
+	var drop, retry []*subscription.Subscription
+	for _, sub := range subs {
+		switch d.resubscribePolicyOf(sub) {
+		case subscription.FailOnReject:
+			d.terminate(err)
+			return
+		case subscription.RetryOnReject:
+			retry = append(retry, sub)
+		default:
+			drop = append(drop, sub)
+		}
+	}
+	for _, sub := range drop {
+		d.dropRejected(sub, err)
+	}
+	for _, sub := range retry {
+		sub.SetState(subscription.StatePending)
+	}
+	if len(retry) > 0 {
+		go d.retrySubscribe(name, retry, d.transport.ClientID(), err)
+	}
+}
+
+//dropRejected removes a subscription the server dropped
+func (d *Dispatcher) dropRejected(sub *subscription.Subscription, err error) {
+	if d.store.Remove(sub) {
+		d.forgetSubscription(sub)
+		sub.Close(err)
+		d.events.Publish(event.Event{Type: event.SubscriptionRemoved, Err: err, Channel: sub.Name(), Subscription: sub})
+	}
+}
+
+//retrySubscribe subscribes the channel again at the pace of the retry policy until the server accepts it. it
+//stops once the subscriptions are removed or the session changes, a new session subscribes them again, and
+//drops them once the policy gives up
+func (d *Dispatcher) retrySubscribe(name string, subs []*subscription.Subscription, clientID string, err error) {
+	for attempt := 1; ; attempt++ {
+		delay, ok := d.retryDelay(attempt)
+		if !ok {
+			for _, sub := range subs {
+				d.dropRejected(sub, err)
+			}
+			return
+		}
+		if !d.sleep(delay) || d.transport.ClientID() != clientID {
+			return
+		}
+		pending := subs[:0]
+		for _, sub := range subs {
+			if sub.State() == subscription.StatePending {
+				pending = append(pending, sub)
+			}
+		}
+		if subs = pending; len(subs) == 0 {
+			return
+		}
+		if err = d.subscribeAgain(name, clientID); err == nil {
+			for _, sub := range subs {
+				sub.SetState(subscription.StateActive)
+			}
+			return
+		}
+		err = fmt.Errorf("resubscribe `%s`: %w", name, err)
+		d.events.Publish(event.Event{Type: event.Error, Err: err, Channel: name})
+	}
+}
+
+//subscribeAgain sends a subscribe of the channel for its existing subscriptions and waits for the server
+//confirmation
+func (d *Dispatcher) subscribeAgain(name string, clientID string) error {
+	m := &message.Message{
+		Channel:      message.MetaSubscribe,
+		ClientId:     clientID,
+		Subscription: d.serverChannel(name),
+		Id:           d.nextMsgID(),
+	}
+	confirmation := make(chan error, 1)
+	d.pendingSubsMu.Lock()
+	d.pendingSubs[m.Id] = confirmation
+	d.pendingSubsMu.Unlock()
+	unregister := func() {
+		d.pendingSubsMu.Lock()
+		delete(d.pendingSubs, m.Id)
+		d.pendingSubsMu.Unlock()
+	}
+	if err := d.transport.SendMessages([]*message.Message{m}); err != nil {
+		unregister()
+		return err
+	}
+	timeoutCh, stop := d.subscribeDeadline()
+	defer stop()
+	select {
+	case err := <-confirmation:
+		return err
+	case <-timeoutCh:
+		unregister()
+		return ErrSubscribeTimeout
+	}
+}
@@ -0,0 +1,76 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"github.com/thesyncim/faye/backoff"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/subscription"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//rejectFoo is a transport rejecting the subscribes of /foo while rejections is positive, decrementing it
+func rejectFoo(rejections *int32) *fakeTransport {
+	return &fakeTransport{reply: func(ft *fakeTransport, m *message.Message) {
+		if m.Channel == message.MetaSubscribe && m.Subscription == "/foo" && atomic.AddInt32(rejections, -1) >= 0 {
+			go ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Subscription: m.Subscription, Error: "403::forbidden"})
+			return
+		}
+		ackSubscriptions(ft, m)
+	}}
+}
+
+func TestDispatcher_ResubscribeRetry(t *testing.T) {
+	var rejections int32
+	d, _ := connectTestDispatcher(t, rejectFoo(&rejections))
+	d.SetRetryPolicy(backoff.Constant{Interval: time.Millisecond})
+	d.SetResubscribePolicy(subscription.RetryOnReject)
+	sub, err := d.Subscribe("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 10)
+	d.OnError(func(err error) {
+		errs <- err
+	})
+
+	atomic.StoreInt32(&rejections, 3)
+	if err = d.Resubscribe(context.Background()); err == nil {
+		t.Fatal("expecting the rejection returned")
+	}
+	deadline := time.Now().Add(time.Second)
+	for sub.State() != subscription.StateActive {
+		if time.Now().After(deadline) {
+			t.Fatalf("expecting the subscription active again got: %v", sub.State())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if len(errs) != 3 {
+		t.Fatalf("expecting every rejection reported got: %d", len(errs))
+	}
+	if sub.CloseErr() != nil || d.terminated() != nil {
+		t.Fatal("expecting the subscription kept")
+	}
+}
+
+func TestDispatcher_ResubscribeFail(t *testing.T) {
+	var rejections int32
+	d, _ := connectTestDispatcher(t, rejectFoo(&rejections))
+	foo, err := d.Subscribe("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	foo.SetResubscribePolicy(subscription.FailOnReject)
+
+	atomic.StoreInt32(&rejections, 1)
+	d.Resubscribe(context.Background())
+	var subErr *SubscriptionError
+	if err = d.terminated(); !errors.As(err, &subErr) || subErr.Code != 403 {
+		t.Fatalf("expecting the client terminated with the rejection got: %v", err)
+	}
+	if !errors.As(foo.CloseErr(), &subErr) {
+		t.Fatalf("expecting the subscription closed with the rejection got: %v", foo.CloseErr())
+	}
+}
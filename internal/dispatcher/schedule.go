@@ -0,0 +1,157 @@
+package dispatcher
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"time"
+)
+
+//ErrScheduleCanceled is the error of a scheduled operation canceled before its deadline, see Scheduled.Cancel
+var ErrScheduleCanceled = errors.New("scheduled operation canceled")
+
+//Scheduled is an operation held until its deadline, see Schedule
+type Scheduled struct {
+	d  *Dispatcher
+	at time.Time
+	op func(ctx context.Context) error
+
+	//index is the position in the schedule, -1 once it left it
+	index int
+	done  chan struct{}
+	err   error
+}
+
+//At returns the deadline of the operation
+func (s *Scheduled) At() time.Time {
+	return s.at
+}
+
+//Cancel removes the operation from the schedule, it returns false if it ran or was canceled already
+func (s *Scheduled) Cancel() bool {
+	d := s.d
+	d.scheduleMu.Lock()
+	if s.index < 0 {
+		d.scheduleMu.Unlock()
+		return false
+	}
+	heap.Remove(&d.schedule, s.index)
+	d.armSchedule()
+	d.scheduleMu.Unlock()
+	s.complete(ErrScheduleCanceled)
+	return true
+}
+
+//Done is closed once the operation ran, failed or was canceled
+func (s *Scheduled) Done() <-chan struct{} {
+	return s.done
+}
+
+//Err returns the error of the operation once Done is closed, ErrScheduleCanceled if it was canceled
+func (s *Scheduled) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+func (s *Scheduled) complete(err error) {
+	s.err = err
+	close(s.done)
+}
+
+//schedule is a min heap of the operations by deadline
+type schedule []*Scheduled
+
+func (s schedule) Len() int           { return len(s) }
+func (s schedule) Less(i, j int) bool { return s[i].at.Before(s[j].at) }
+func (s schedule) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+	s[i].index, s[j].index = i, j
+}
+func (s *schedule) Push(x interface{}) {
+	sc := x.(*Scheduled)
+	sc.index = len(*s)
+	*s = append(*s, sc)
+}
+func (s *schedule) Pop() interface{} {
+	old := *s
+	sc := old[len(old)-1]
+	old[len(old)-1] = nil
+	sc.index = -1
+	*s = old[:len(old)-1]
+	return sc
+}
+
+//Schedule holds op until at and then runs it from its own goroutine, e.g. a publish: sent while the
+//connection is restored, it waits in the outgoing queue like any other. the operations still scheduled
+//fail with the error terminating the client.
+func (d *Dispatcher) Schedule(at time.Time, op func(ctx context.Context) error) (*Scheduled, error) {
+	if err := d.terminated(); err != nil {
+		return nil, err
+	}
+	s := &Scheduled{d: d, at: at, op: op, done: make(chan struct{})}
+	d.scheduleMu.Lock()
+	heap.Push(&d.schedule, s)
+	if s.index == 0 {
+		d.armSchedule()
+	}
+	d.scheduleMu.Unlock()
+	return s, nil
+}
+
+//Scheduled returns the number of operations scheduled
+func (d *Dispatcher) Scheduled() int {
+	d.scheduleMu.Lock()
+	defer d.scheduleMu.Unlock()
+	return len(d.schedule)
+}
+
+//armSchedule arms the timer for the earliest deadline. scheduleMu must be held
+func (d *Dispatcher) armSchedule() {
+	if d.scheduleTimer != nil {
+		d.scheduleTimer.Stop()
+		d.scheduleTimer = nil
+	}
+	if len(d.schedule) == 0 {
+		return
+	}
+	delay := d.schedule[0].at.Sub(d.clock().Now())
+	if delay < 0 {
+		delay = 0
+	}
+	d.scheduleTimer = d.clock().AfterFunc(delay, d.runSchedule)
+}
+
+//runSchedule runs the operations past their deadline
+func (d *Dispatcher) runSchedule() {
+	now := d.clock().Now()
+	var due []*Scheduled
+	d.scheduleMu.Lock()
+	for len(d.schedule) > 0 && !d.schedule[0].at.After(now) {
+		due = append(due, heap.Pop(&d.schedule).(*Scheduled))
+	}
+	d.armSchedule()
+	d.scheduleMu.Unlock()
+	for _, s := range due {
+		go func(s *Scheduled) {
+			s.complete(s.op(context.Background()))
+		}(s)
+	}
+}
+
+//clearSchedule fails the operations scheduled with err
+func (d *Dispatcher) clearSchedule(err error) {
+	d.scheduleMu.Lock()
+	pending := make([]*Scheduled, 0, len(d.schedule))
+	for len(d.schedule) > 0 {
+		pending = append(pending, heap.Pop(&d.schedule).(*Scheduled))
+	}
+	d.armSchedule()
+	d.scheduleMu.Unlock()
+	for _, s := range pending {
+		s.complete(err)
+	}
+}
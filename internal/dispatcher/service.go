@@ -0,0 +1,105 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/thesyncim/faye/channel"
+	"github.com/thesyncim/faye/message"
+)
+
+//ErrNotService is returned by Request for the channels outside /service
+var ErrNotService = errors.New("not a service channel")
+
+//Request publishes data to a /service channel and waits for the reply delivered to this client with the
+//same message id, until ctx is done. the reply data is returned, or the error of the server response.
+func (d *Dispatcher) Request(ctx context.Context, name string, data message.Data) (message.Data, error) {
+	if err := d.terminated(); err != nil {
+		return nil, err
+	}
+	if err := d.closingErr(); err != nil {
+		return nil, err
+	}
+	if err := channel.ValidatePublish(name); err != nil {
+		return nil, err
+	}
+	if !channel.Channel(name).IsService() {
+		return nil, fmt.Errorf("%w: `%s`", ErrNotService, name)
+	}
+	if err := d.wake(ctx); err != nil {
+		return nil, err
+	}
+	if err := d.throttle(ctx, 1, 0); err != nil {
+		return nil, err
+	}
+	m := &message.Message{
+		Channel:  d.serverChannel(name),
+		Data:     data,
+		ClientId: d.transport.ClientID(),
+		Id:       d.nextMsgID(),
+	}
+	replyCh := make(chan *message.Message, 1)
+	d.requestMu.Lock()
+	d.requests[m.Id] = replyCh
+	d.requestMu.Unlock()
+
+	err := d.applyOut(ctx, m)
+	if err == nil {
+		err = d.send(ctx, m)
+	}
+	if err != nil {
+		d.cancelRequest(m.Id)
+		return nil, err
+	}
+
+	select {
+	case reply, ok := <-replyCh:
+		if !ok {
+			return nil, d.terminated()
+		}
+		if err = reply.GetError(); err != nil {
+			return nil, err
+		}
+		return reply.Data, nil
+	case <-ctx.Done():
+		d.cancelRequest(m.Id)
+		return nil, ctx.Err()
+	}
+}
+
+//cancelRequest stops waiting for the reply to id, a late reply is handled as any other message
+func (d *Dispatcher) cancelRequest(id string) {
+	d.requestMu.Lock()
+	delete(d.requests, id)
+	d.requestMu.Unlock()
+}
+
+//serviceReply routes the reply of a request to its sender, it returns false if msg is not one.
+//the acknowledgement of the request is consumed, the reply follows it unless the server rejected the request.
+func (d *Dispatcher) serviceReply(msg *message.Message) bool {
+	if msg.Id == "" || message.IsMetaMessage(msg) {
+		return false
+	}
+	d.requestMu.Lock()
+	defer d.requestMu.Unlock()
+	replyCh, ok := d.requests[msg.Id]
+	if !ok {
+		return false
+	}
+	if msg.Data == nil && msg.Successful {
+		return true
+	}
+	delete(d.requests, msg.Id)
+	replyCh <- msg
+	return true
+}
+
+//closeRequests fails the requests waiting for a reply, once the dispatcher terminated
+func (d *Dispatcher) closeRequests() {
+	d.requestMu.Lock()
+	defer d.requestMu.Unlock()
+	for id, replyCh := range d.requests {
+		close(replyCh)
+		delete(d.requests, id)
+	}
+}
@@ -0,0 +1,74 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"github.com/thesyncim/faye/message"
+	"testing"
+	"time"
+)
+
+func TestDispatcher_Request(t *testing.T) {
+	d, _ := newTestDispatcher(t, func(ft *fakeTransport, m *message.Message) {
+		switch m.Channel {
+		case "/service/echo":
+			//the acknowledgement precedes the reply
+			go func() {
+				ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Successful: true})
+				ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Data: m.Data})
+			}()
+		case "/service/denied":
+			go ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Error: "403::forbidden"})
+		}
+	})
+
+	var tests = []struct {
+		channel string
+		data    message.Data
+		err     string
+	}{
+		{"/service/echo", "ping", ""},
+		{"/service/denied", nil, "403::forbidden"},
+		{"/service/none", nil, context.DeadlineExceeded.Error()},
+		{"/foo", nil, "not a service channel: `/foo`"},
+		{"/service/*", nil, "can't publish to a wildcard channel: `/service/*`"},
+	}
+	for _, tt := range tests {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		data, err := d.Request(ctx, tt.channel, "ping")
+		cancel()
+		if tt.err == "" && (err != nil || data != tt.data) {
+			t.Fatalf("%s: expecting %v got: %v %v", tt.channel, tt.data, data, err)
+		}
+		if tt.err != "" && (err == nil || err.Error() != tt.err) {
+			t.Fatalf("%s: expecting %s got: %v", tt.channel, tt.err, err)
+		}
+	}
+	d.requestMu.Lock()
+	defer d.requestMu.Unlock()
+	if len(d.requests) != 0 {
+		t.Fatalf("expecting no request left got: %d", len(d.requests))
+	}
+}
+
+func TestDispatcher_RequestTerminated(t *testing.T) {
+	d, _ := newTestDispatcher(t, nil)
+	result := make(chan error, 1)
+	go func() {
+		_, err := d.Request(context.Background(), "/service/none", "ping")
+		result <- err
+	}()
+	for {
+		d.requestMu.Lock()
+		n := len(d.requests)
+		d.requestMu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	d.terminate(ErrReconnectNone)
+	if err := <-result; !errors.Is(err, ErrReconnectNone) {
+		t.Fatalf("expecting %v got: %v", ErrReconnectNone, err)
+	}
+}
@@ -0,0 +1,42 @@
+package dispatcher
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+//SessionInfo describes the session established with the server
+type SessionInfo struct {
+	//ClientID is the clientId assigned by the server, empty without session
+	ClientID string
+	//Handshaked is the time of the last successful handshake, zero before the first one
+	Handshaked time.Time
+	//Transport is the name of the transport negotiated by the last handshake
+	Transport string
+	//Endpoint is the url of the server the transport is connected to
+	Endpoint string
+	//Reconnects is the number of times the connection was restored after being lost
+	Reconnects int
+}
+
+//ClientID returns the clientId assigned by the server, empty without session
+func (d *Dispatcher) ClientID() string {
+	return d.transport.ClientID()
+}
+
+//Session returns the info of the current session, it is safe for concurrent use
+func (d *Dispatcher) Session() SessionInfo {
+	d.releaseMu.Lock()
+	endpoint := d.dialed
+	d.releaseMu.Unlock()
+	info := SessionInfo{
+		ClientID:   d.transport.ClientID(),
+		Transport:  d.transport.Name(),
+		Endpoint:   endpoint,
+		Reconnects: int(atomic.LoadInt64(&d.reconnects)),
+	}
+	if handshaked := atomic.LoadInt64(&d.handshaked); handshaked != 0 {
+		info.Handshaked = time.Unix(0, handshaked)
+	}
+	return info
+}
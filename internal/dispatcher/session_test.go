@@ -0,0 +1,42 @@
+package dispatcher
+
+import (
+	"errors"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"testing"
+	"time"
+)
+
+func TestDispatcher_Session(t *testing.T) {
+	ft := &fakeTransport{}
+	d := NewDispatcher("fake://", transport.Options{RetryInterval: time.Millisecond}, message.Extensions{})
+	d.SetTransport(ft)
+	if session := d.Session(); session.ClientID != "" || !session.Handshaked.IsZero() {
+		t.Fatalf("expecting no session before the handshake got: %+v", session)
+	}
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	session := d.Session()
+	if session.ClientID != "fake-client" || d.ClientID() != "fake-client" {
+		t.Fatalf("expecting the clientId of the handshake got: %+v", session)
+	}
+	if session.Transport != "fake" || session.Endpoint != "fake://" || session.Handshaked.IsZero() {
+		t.Fatalf("expecting the session negotiated got: %+v", session)
+	}
+
+	reconnected := make(chan struct{}, 1)
+	d.OnReconnect(func() {
+		reconnected <- struct{}{}
+	})
+	ft.onTransportDown(errors.New("connection reset"))
+	select {
+	case <-reconnected:
+	case <-time.After(time.Second):
+		t.Fatal("expecting the connection restored")
+	}
+	if reconnects := d.Session().Reconnects; reconnects != 1 {
+		t.Fatalf("expecting a reconnect counted got: %d", reconnects)
+	}
+}
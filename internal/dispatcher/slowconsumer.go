@@ -0,0 +1,67 @@
+package dispatcher
+
+import (
+	"github.com/thesyncim/faye/internal/event"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/subscription"
+	"time"
+)
+
+//fullQueue tracks a subscription queue found full
+type fullQueue struct {
+	since    time.Time
+	reported bool
+}
+
+//SetSlowConsumerThreshold reports the subscriptions whose queue stays full for threshold, their handlers don't
+//keep up with the messages and the ones received meanwhile are dropped or block the deliveries according to the
+//channel config. 0 disables the detection, the paused subscriptions are not reported. see OnSlowConsumer
+func (d *Dispatcher) SetSlowConsumerThreshold(threshold time.Duration) {
+	d.qosMu.Lock()
+	d.slowThreshold = threshold
+	d.qosMu.Unlock()
+}
+
+//OnSlowConsumer registers a handler called when the queue of a subscription stayed full for the threshold, once
+//until its queue has room again. queued is the size of the queue
+func (d *Dispatcher) OnSlowConsumer(onSlow func(sub *subscription.Subscription, queued int, full time.Duration)) {
+	d.events.Subscribe(event.SlowConsumer, func(e event.Event) {
+		onSlow(e.Subscription, cap(e.Subscription.MsgChannel()), e.Delay)
+	})
+}
+
+//checkSlowConsumer is called before msg is queued, it reports the subscription if its queue stayed full for the
+//threshold. the queues are checked as the messages arrive, a full queue receiving none isn't slowing anything
+func (d *Dispatcher) checkSlowConsumer(sub *subscription.Subscription, msg *message.Message) {
+	msgCh := sub.MsgChannel()
+	full := cap(msgCh) > 0 && len(msgCh) == cap(msgCh) && !sub.Paused()
+	now := d.clock().Now()
+	d.qosMu.Lock()
+	if d.slowThreshold <= 0 {
+		d.qosMu.Unlock()
+		return
+	}
+	q, ok := d.fullQueues[sub]
+	switch {
+	case !full:
+		delete(d.fullQueues, sub)
+		d.qosMu.Unlock()
+		return
+	case !ok:
+		d.fullQueues[sub] = &fullQueue{since: now}
+		d.qosMu.Unlock()
+		return
+	case q.reported || now.Sub(q.since) < d.slowThreshold:
+		d.qosMu.Unlock()
+		return
+	}
+	q.reported = true
+	d.qosMu.Unlock()
+	d.events.Publish(event.Event{
+		Type:         event.SlowConsumer,
+		Channel:      sub.Name(),
+		Message:      msg,
+		Delay:        now.Sub(q.since),
+		Subscription: sub,
+	})
+}
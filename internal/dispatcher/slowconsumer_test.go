@@ -0,0 +1,58 @@
+package dispatcher
+
+import (
+	"github.com/thesyncim/faye/channel"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/subscription"
+	"testing"
+	"time"
+)
+
+func TestDispatcher_SlowConsumer(t *testing.T) {
+	d, ft := newTestDispatcher(t, ackSubscriptions)
+	if err := d.SetChannelConfigs([]channel.Config{{Pattern: "/foo", BufferSize: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	d.SetSlowConsumerThreshold(time.Nanosecond)
+	var reported []*subscription.Subscription
+	d.OnSlowConsumer(func(sub *subscription.Subscription, queued int, full time.Duration) {
+		if queued != 1 || full <= 0 {
+			t.Errorf("expecting a full queue of 1 got: %d for %v", queued, full)
+		}
+		reported = append(reported, sub)
+	})
+	sub, err := d.Subscribe("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//found full by the second delivery, reported by the third
+	for i := 0; i < 4; i++ {
+		ft.deliver(&message.Message{Channel: "/foo", Data: i})
+		time.Sleep(time.Millisecond)
+	}
+	if len(reported) != 1 || reported[0] != sub {
+		t.Fatalf("expecting the subscription reported once got: %v", reported)
+	}
+
+	//reported again once the queue had room
+	<-sub.MsgChannel()
+	for i := 0; i < 3; i++ {
+		ft.deliver(&message.Message{Channel: "/foo", Data: i})
+		time.Sleep(time.Millisecond)
+	}
+	if len(reported) != 2 {
+		t.Fatalf("expecting the subscription reported again got: %d", len(reported))
+	}
+
+	//the paused subscriptions fill their queue on purpose
+	<-sub.MsgChannel()
+	sub.Pause()
+	for i := 0; i < 3; i++ {
+		ft.deliver(&message.Message{Channel: "/foo", Data: i})
+		time.Sleep(time.Millisecond)
+	}
+	if len(reported) != 2 {
+		t.Fatalf("expecting the paused subscription not reported got: %d", len(reported))
+	}
+}
@@ -0,0 +1,70 @@
+package dispatcher
+
+import (
+	"github.com/thesyncim/faye/internal/event"
+	"sync/atomic"
+)
+
+//State represents the lifecycle of the client session
+type State int32
+
+const (
+	//StateUnconnected is the state before the first handshake, or after it failed
+	StateUnconnected State = iota
+	//StateConnecting is the state while handshaking, or reconnecting after the connection was lost
+	StateConnecting
+	//StateConnected is the state once the server accepted the handshake
+	StateConnected
+	//StateDisconnected is the final state, after Disconnect or once the client gave up reconnecting
+	StateDisconnected
+	//StateSuspended is the state while the session is suspended, see Dispatcher.Suspend
+	StateSuspended
+)
+
+func (s State) String() string {
+	switch s {
+	case StateUnconnected:
+		return "unconnected"
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateDisconnected:
+		return "disconnected"
+	case StateSuspended:
+		return "suspended"
+	default:
+		return "unknown"
+	}
+}
+
+//MarshalText encodes the state as its name, e.g. in the json of a Snapshot
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+//State returns the current state of the session
+func (d *Dispatcher) State() State {
+	return State(atomic.LoadInt32(&d.state))
+}
+
+//setState moves the session to state, the disconnected state is final
+func (d *Dispatcher) setState(state State) {
+	for {
+		from := d.State()
+		if from == state || from == StateDisconnected {
+			return
+		}
+		if atomic.CompareAndSwapInt32(&d.state, int32(from), int32(state)) {
+			d.events.Publish(event.Event{Type: event.StateChange, From: int(from), To: int(state)})
+			return
+		}
+	}
+}
+
+//OnStateChange registers a handler called on every state change, from the goroutine causing it
+func (d *Dispatcher) OnStateChange(onChange func(from, to State)) {
+	d.events.Subscribe(event.StateChange, func(e event.Event) {
+		onChange(State(e.From), State(e.To))
+	})
+}
@@ -0,0 +1,91 @@
+package dispatcher
+
+import (
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+//closerTransport answers /meta/disconnect and records Close
+type closerTransport struct {
+	*fakeTransport
+	closed chan struct{}
+}
+
+func (t *closerTransport) Close() error {
+	close(t.closed)
+	return nil
+}
+
+func TestDispatcher_State(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		states []State
+	)
+	d := NewDispatcher("fake://", transport.Options{}, message.Extensions{})
+	d.OnStateChange(func(from, to State) {
+		mu.Lock()
+		states = append(states, to)
+		mu.Unlock()
+	})
+	if d.State() != StateUnconnected {
+		t.Fatalf("expecting %s got: %s", StateUnconnected, d.State())
+	}
+
+	pendingAck := make(chan *message.Message, 1)
+	ft := &fakeTransport{reply: func(ft *fakeTransport, m *message.Message) {
+		switch m.Channel {
+		case message.MetaDisconnect:
+			go ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Successful: true})
+		case "/foo":
+			pendingAck <- &message.Message{Channel: m.Channel, Id: m.Id, Successful: true}
+		}
+	}}
+	ct := &closerTransport{fakeTransport: ft, closed: make(chan struct{})}
+	d.SetTransport(ct)
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if d.State() != StateConnected {
+		t.Fatalf("expecting %s got: %s", StateConnected, d.State())
+	}
+
+	//the publish in flight is acknowledged before disconnecting
+	published := make(chan error, 1)
+	go func() {
+		published <- d.Publish("/foo", "bar")
+	}()
+	go func() {
+		ack := <-pendingAck
+		time.Sleep(20 * time.Millisecond)
+		ft.deliver(ack)
+	}()
+	waitSent(t, ft, 2)
+	if err := d.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-published; err != nil {
+		t.Fatalf("expecting the publish acknowledged got: %v", err)
+	}
+	select {
+	case <-ct.closed:
+	default:
+		t.Fatal("expecting the transport closed")
+	}
+	if last := lastSent(ft); last.Channel != message.MetaDisconnect {
+		t.Fatalf("expecting a single /meta/disconnect sent last got: %s", last.Channel)
+	}
+	if err := d.Publish("/foo", "bar"); err != ErrDisconnected {
+		t.Fatalf("expecting ErrDisconnected got: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []State{StateConnecting, StateConnected, StateDisconnected}
+	if !reflect.DeepEqual(states, expected) {
+		t.Fatalf("expecting states %v got: %v", expected, states)
+	}
+}
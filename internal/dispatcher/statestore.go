@@ -0,0 +1,118 @@
+package dispatcher
+
+import (
+	"context"
+	"github.com/thesyncim/faye/internal/event"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/statestore"
+)
+
+//SetStateStore saves the state of the client to s whenever it changes: the channels subscribed, the last replay
+//ids, recorded with SetReplayBuffer or for the AtLeastOnce subscriptions, and the publishes queued while the
+//connection is restored. the saves run in background, the changes made meanwhile are coalesced. the state is no
+//longer saved once the client is terminated, so a restarted process resumes the last session. call it once the
+//state was restored, see RestoreReplayIDs.
+func (d *Dispatcher) SetStateStore(s statestore.Store) {
+	done := make(chan struct{})
+	unsubscribe := d.events.Subscribe(event.Disconnected, func(event.Event) {
+		close(done)
+	})
+	d.stateChange()
+	go d.saveStates(s, done, unsubscribe)
+}
+
+//stateChange schedules a save of the state, it never blocks
+func (d *Dispatcher) stateChange() {
+	select {
+	case d.stateChanged <- struct{}{}:
+	default:
+		//a save is scheduled already and will see the change
+	}
+}
+
+//saveStates saves the state to s on every change until the client is terminated, the errors are reported to OnError
+func (d *Dispatcher) saveStates(s statestore.Store, done <-chan struct{}, unsubscribe func()) {
+	defer unsubscribe()
+	for {
+		select {
+		case <-done:
+			return
+		case <-d.stateChanged:
+		}
+		if d.terminated() != nil {
+			return
+		}
+		if err := s.Save(d.snapshotState()); err != nil {
+			d.events.Publish(event.Event{Type: event.Error, Err: err})
+		}
+	}
+}
+
+//snapshotState returns the current state of the client
+func (d *Dispatcher) snapshotState() *statestore.State {
+	state := &statestore.State{}
+	seen := map[string]bool{}
+	for _, info := range d.Subscriptions() {
+		if !seen[info.Channel] {
+			seen[info.Channel] = true
+			state.Subscriptions = append(state.Subscriptions, info.Channel)
+		}
+	}
+
+	d.replayMu.Lock()
+	for channel, buf := range d.replay {
+		if buf.lastID == "" {
+			continue
+		}
+		if state.ReplayIDs == nil {
+			state.ReplayIDs = map[string]string{}
+		}
+		state.ReplayIDs[channel] = buf.lastID
+	}
+	d.replayMu.Unlock()
+
+	d.queueMu.Lock()
+	for i := range d.queue {
+		//the subscribes are saved as subscriptions
+		if !message.IsMetaMessage(d.queue[i].m) {
+			state.Pending = append(state.Pending, d.queue[i].m)
+		}
+	}
+	d.queueMu.Unlock()
+	return state
+}
+
+//RestoreReplayIDs seeds the replay buffer with the ids of the last messages delivered by channel, e.g. saved by a
+//previous process, so the next subscribes request the messages following them, e.g. of the AtLeastOnce
+//subscriptions. the channels restored are recorded from then on even if the replay buffer is disabled.
+func (d *Dispatcher) RestoreReplayIDs(ids map[string]string) {
+	d.replayMu.Lock()
+	defer d.replayMu.Unlock()
+	if d.replay == nil {
+		d.replay = map[string]*replayBuffer{}
+	}
+	for channel, id := range ids {
+		buf, ok := d.replay[channel]
+		if !ok {
+			buf = &replayBuffer{recent: newIDWindow(d.replayWindow())}
+			d.replay[channel] = buf
+		}
+		buf.lastID = id
+	}
+}
+
+//SendPending sends the messages left pending by a previous process, as saved: their outgoing extensions ran
+//already. they get new ids and the clientId of the session, their acknowledgements are not awaited.
+func (d *Dispatcher) SendPending(ctx context.Context, msgs []*message.Message) error {
+	for _, m := range msgs {
+		if err := d.terminated(); err != nil {
+			return err
+		}
+		m.Id = d.nextMsgID()
+		m.ClientId = d.transport.ClientID()
+		if err := d.send(ctx, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
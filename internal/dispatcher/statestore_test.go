@@ -0,0 +1,76 @@
+package dispatcher
+
+import (
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/statestore"
+	"reflect"
+	"testing"
+	"time"
+)
+
+//awaitState waits until the state saved in s is expected
+func awaitState(t *testing.T, s statestore.Store, expected *statestore.State) {
+	deadline := time.Now().Add(time.Second)
+	for {
+		state, err := s.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reflect.DeepEqual(state, expected) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expecting state %+v got: %+v", expected, state)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDispatcher_StateStore(t *testing.T) {
+	d, ft := newReplayDispatcher(t, ackSubscriptions)
+	s := statestore.NewMemory()
+	d.SetStateStore(s)
+
+	sub, err := d.Subscribe("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Subscribe("/bar"); err != nil {
+		t.Fatal(err)
+	}
+	ft.deliver(&message.Message{Channel: "/foo", Id: "1", Data: "a"})
+	ft.deliver(&message.Message{Channel: "/foo", Id: "2", Data: "b"})
+	awaitState(t, s, &statestore.State{
+		Subscriptions: []string{"/foo", "/bar"},
+		ReplayIDs:     map[string]string{"/foo": "2"},
+	})
+
+	if err = sub.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	expected := &statestore.State{
+		Subscriptions: []string{"/bar"},
+		ReplayIDs:     map[string]string{"/foo": "2"},
+	}
+	awaitState(t, s, expected)
+
+	//the state of the last session is kept for the next process
+	if err = d.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	awaitState(t, s, expected)
+}
+
+func TestDispatcher_RestoreReplayIDs(t *testing.T) {
+	d, ft := newReplayDispatcher(t, ackSubscriptions)
+	d.RestoreReplayIDs(map[string]string{"/foo": "42"})
+
+	if _, err := d.Subscribe("/foo"); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"replay": map[string]interface{}{"/foo": "42"}}
+	if !reflect.DeepEqual(lastSubscribe(ft).Ext, expected) {
+		t.Fatalf("expecting ext %v got: %v", expected, lastSubscribe(ft).Ext)
+	}
+}
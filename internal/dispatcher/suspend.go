@@ -0,0 +1,160 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"github.com/thesyncim/faye/clock"
+	"github.com/thesyncim/faye/internal/event"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"sync/atomic"
+	"time"
+)
+
+//SetIdleSuspend suspends the session once no message was published nor delivered for idle, 0 never does. the
+//suspended session resumes on the next operation or, if wake is positive, wake after it was suspended, e.g. to
+//receive the messages retained by the server. it must be called before Start.
+func (d *Dispatcher) SetIdleSuspend(idle, wake time.Duration) {
+	d.idleTimeout = idle
+	d.wakeInterval = wake
+}
+
+//Suspended reports whether the session is suspended, see Suspend
+func (d *Dispatcher) Suspended() bool {
+	return atomic.LoadInt32(&d.suspended) == 1
+}
+
+//Suspend disconnects from the server but keeps the subscriptions, they are subscribed again by Resume. the
+//publishes in flight are awaited until ctx is done. the session resumes on the next operation needing the
+//server, e.g. a publish, suspending it again is a no-op.
+func (d *Dispatcher) Suspend(ctx context.Context) error {
+	d.suspendMu.Lock()
+	defer d.suspendMu.Unlock()
+	if err := d.terminated(); err != nil {
+		return err
+	}
+	if d.Suspended() {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, d.disconnectWait())
+	defer cancel()
+	d.flush(ctx)
+	atomic.StoreInt32(&d.suspended, 1)
+	//the connect loop stops and the server response isn't taken for a dropped session
+	atomic.StoreInt32(&d.disconnecting, 1)
+	m := &message.Message{
+		Channel:  message.MetaDisconnect,
+		ClientId: d.transport.ClientID(),
+		Id:       d.nextMsgID(),
+	}
+	var err error
+	if closer, ok := d.closer(); ok {
+		err = d.sendDisconnect(ctx, m)
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	} else {
+		err = transport.DisconnectCtx(ctx, d.transport, m)
+	}
+	d.releaseEndpoint()
+	stopTimer(d.idleTimer)
+	d.setState(StateSuspended)
+	if d.wakeInterval > 0 {
+		d.wakeTimer = d.clock().AfterFunc(d.wakeInterval, func() {
+			if err := d.Resume(context.Background()); err != nil && d.terminated() == nil {
+				d.events.Publish(event.Event{Type: event.Error, Err: fmt.Errorf("resume: %w", err)})
+			}
+		})
+	}
+	return err
+}
+
+//Resume handshakes again, subscribes again the channels of the subscriptions and connects, after Suspend. it is
+//a no-op if the session isn't suspended. the session stays suspended if it fails, the next operation retries.
+func (d *Dispatcher) Resume(ctx context.Context) error {
+	d.suspendMu.Lock()
+	defer d.suspendMu.Unlock()
+	if !d.Suspended() {
+		return nil
+	}
+	if err := d.terminated(); err != nil {
+		return err
+	}
+	stopTimer(d.wakeTimer)
+	err := withContext(ctx, func() (err error) {
+		_, err = d.dialHandshake(ctx)
+		return err
+	})
+	if err != nil {
+		d.setState(StateSuspended)
+		return err
+	}
+	atomic.StoreInt32(&d.disconnecting, 0)
+	atomic.StoreInt32(&d.suspended, 0)
+	d.resubscribe()
+	d.watchIdle()
+	if d.manualConnect {
+		return nil
+	}
+	return d.transport.Connect(d.connectMessage())
+}
+
+//wake resumes the suspended session before an operation needing the server
+func (d *Dispatcher) wake(ctx context.Context) error {
+	d.touch()
+	if !d.Suspended() {
+		return nil
+	}
+	return d.Resume(ctx)
+}
+
+//touch records an activity postponing the idle suspend
+func (d *Dispatcher) touch() {
+	if d.idleTimeout > 0 {
+		atomic.StoreInt64(&d.lastActive, d.clock().Now().UnixNano())
+	}
+}
+
+//watchIdle starts measuring the idle time of the session, see SetIdleSuspend
+func (d *Dispatcher) watchIdle() {
+	if d.idleTimeout <= 0 {
+		return
+	}
+	d.touch()
+	d.idleTimer = d.clock().AfterFunc(d.idleTimeout, d.checkIdle)
+}
+
+//checkIdle suspends the session if it was idle long enough, it checks again once it could be otherwise
+func (d *Dispatcher) checkIdle() {
+	if d.terminated() != nil || d.Suspended() {
+		return
+	}
+	idle := d.clock().Now().Sub(time.Unix(0, atomic.LoadInt64(&d.lastActive)))
+	if remaining := d.idleTimeout - idle; remaining > 0 || atomic.LoadInt32(&d.reconnecting) == 1 {
+		if remaining <= 0 {
+			remaining = d.idleTimeout
+		}
+		d.suspendMu.Lock()
+		d.idleTimer = d.clock().AfterFunc(remaining, d.checkIdle)
+		d.suspendMu.Unlock()
+		return
+	}
+	if err := d.Suspend(context.Background()); err != nil && d.terminated() == nil {
+		d.events.Publish(event.Event{Type: event.Error, Err: fmt.Errorf("suspend: %w", err)})
+	}
+}
+
+//stopSuspended stops the wake timer, it reports whether the session is suspended
+func (d *Dispatcher) stopSuspended() bool {
+	d.suspendMu.Lock()
+	defer d.suspendMu.Unlock()
+	stopTimer(d.wakeTimer)
+	return d.Suspended()
+}
+
+//stopTimer stops t if set
+func stopTimer(t clock.Timer) {
+	if t != nil {
+		t.Stop()
+	}
+}
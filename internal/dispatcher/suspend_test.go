@@ -0,0 +1,138 @@
+package dispatcher
+
+import (
+	"context"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/subscription"
+	"github.com/thesyncim/faye/transport"
+	"testing"
+	"time"
+)
+
+//ackAll acknowledges the subscribes, the unsubscribes and the publishes
+func ackAll(ft *fakeTransport, m *message.Message) {
+	ackSubscriptions(ft, m)
+	if !message.IsMetaMessage(m) {
+		go ft.deliver(&message.Message{Channel: m.Channel, Id: m.Id, Successful: true})
+	}
+}
+
+//sentOn returns the messages sent on the channel so far
+func sentOn(ft *fakeTransport, channel string) []*message.Message {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	var msgs []*message.Message
+	for _, m := range ft.sent {
+		if m.Channel == channel {
+			msgs = append(msgs, m)
+		}
+	}
+	return msgs
+}
+
+func TestDispatcher_SuspendResume(t *testing.T) {
+	handshakes := 0
+	ft := &fakeTransport{reply: ackAll, onHandshake: func(m *message.Message) {
+		handshakes++
+	}}
+	d, _ := connectTestDispatcher(t, ft)
+	sub, err := d.Subscribe("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = d.Suspend(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !d.Suspended() || d.Connected() || d.State() != StateSuspended {
+		t.Fatalf("expecting the session suspended got: %v", d.State())
+	}
+	if len(sentOn(ft, message.MetaDisconnect)) != 1 {
+		t.Fatal("expecting the server informed of the disconnect")
+	}
+	if err = d.Suspend(context.Background()); err != nil || len(sentOn(ft, message.MetaDisconnect)) != 1 {
+		t.Fatalf("expecting suspending again a no-op got: %v", err)
+	}
+	//the transport going down doesn't reconnect a suspended session
+	ft.onTransportDown(nil)
+	if d.State() != StateSuspended {
+		t.Fatalf("expecting the session still suspended got: %v", d.State())
+	}
+
+	//the publish resumes the session
+	if err = d.Publish("/bar", "baz"); err != nil {
+		t.Fatal(err)
+	}
+	if d.Suspended() || !d.Connected() {
+		t.Fatal("expecting the session resumed")
+	}
+	if handshakes != 2 {
+		t.Fatalf("expecting a new handshake got: %d", handshakes)
+	}
+	if subs := sentOn(ft, message.MetaSubscribe); len(subs) != 2 || subs[1].Subscription != "/foo" {
+		t.Fatalf("expecting the subscription sent again got: %v", subs)
+	}
+	if sub.State() == subscription.StateClosed {
+		t.Fatal("expecting the subscription kept")
+	}
+	if err = d.Resume(context.Background()); err != nil || handshakes != 2 {
+		t.Fatalf("expecting resuming an active session a no-op got: %v", err)
+	}
+}
+
+func TestDispatcher_SuspendUnsubscribe(t *testing.T) {
+	d, ft := newTestDispatcher(t, ackAll)
+	sub, err := d.Subscribe("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Suspend(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	//a suspended session has no server subscription to remove
+	if err = d.Unsubscribe(sub); err != nil {
+		t.Fatal(err)
+	}
+	if !d.Suspended() || len(sentOn(ft, message.MetaUnsubscribe)) != 0 {
+		t.Fatal("expecting the subscription removed locally")
+	}
+	if err = d.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if d.State() != StateDisconnected || len(sentOn(ft, message.MetaDisconnect)) != 1 {
+		t.Fatalf("expecting the suspended session disconnected without message got: %v", d.State())
+	}
+}
+
+func TestDispatcher_IdleSuspend(t *testing.T) {
+	ft := &fakeTransport{reply: ackAll}
+	d := NewDispatcher("fake://", transport.Options{}, message.Extensions{})
+	d.SetTransport(ft)
+	d.SetIdleSuspend(20*time.Millisecond, 50*time.Millisecond)
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Disconnect()
+
+	suspended := make(chan struct{}, 10)
+	resumed := make(chan struct{}, 10)
+	d.OnStateChange(func(from, to State) {
+		notify := resumed
+		if to == StateSuspended {
+			notify = suspended
+		} else if to != StateConnected {
+			return
+		}
+		select {
+		case notify <- struct{}{}:
+		default:
+		}
+	})
+	for _, ch := range []chan struct{}{suspended, resumed, suspended} {
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Fatal("expecting the idle session suspended then woken up")
+		}
+	}
+}
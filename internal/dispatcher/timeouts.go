@@ -0,0 +1,84 @@
+package dispatcher
+
+import (
+	"context"
+	"github.com/thesyncim/faye/internal/event"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"sync/atomic"
+	"time"
+)
+
+//ErrHandshakeTimeout is returned when the server doesn't answer the handshake in time, see SetHandshakeTimeout
+var ErrHandshakeTimeout error = &kindError{msg: "handshake timeout", kind: ErrTimeout}
+
+//ErrSubscribeTimeout is returned when the server doesn't confirm a subscribe in time, see SetSubscribeTimeout
+var ErrSubscribeTimeout error = &kindError{msg: "subscribe confirmation timeout", kind: ErrTimeout}
+
+//SetHandshakeTimeout bounds the wait for the handshake responses, zero applies the request timeout
+func (d *Dispatcher) SetHandshakeTimeout(timeout time.Duration) {
+	d.handshakeTimeout = timeout
+}
+
+//SetSubscribeTimeout bounds the wait for the subscribe confirmations, zero applies the request timeout
+func (d *Dispatcher) SetSubscribeTimeout(timeout time.Duration) {
+	d.subscribeTimeout = timeout
+}
+
+//SetRequestTimeout bounds the wait for the responses to the meta operations without a timeout of their own,
+//the handshake, the subscribes and the disconnect. zero waits forever, 5s for the disconnect.
+func (d *Dispatcher) SetRequestTimeout(timeout time.Duration) {
+	d.requestTimeout = timeout
+}
+
+//metaTimeout returns the timeout of a meta operation, the request timeout unless timeout is set
+func (d *Dispatcher) metaTimeout(timeout time.Duration) time.Duration {
+	if timeout > 0 {
+		return timeout
+	}
+	return d.requestTimeout
+}
+
+//disconnectWait bounds the wait for the publishes in flight and the disconnect response, see SetRequestTimeout
+func (d *Dispatcher) disconnectWait() time.Duration {
+	if d.requestTimeout > 0 {
+		return d.requestTimeout
+	}
+	return disconnectTimeout
+}
+
+//sendHandshake sends the handshake message and waits for the response until ctx is done or the handshake
+//timeout expires
+func (d *Dispatcher) sendHandshake(ctx context.Context, m *message.Message) (*message.Message, error) {
+	timeout := d.metaTimeout(d.handshakeTimeout)
+	if timeout <= 0 {
+		return transport.HandshakeCtx(ctx, d.transport, m)
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	resp, err := transport.HandshakeCtx(timeoutCtx, d.transport, m)
+	if err != nil && ctx.Err() == nil && timeoutCtx.Err() != nil {
+		return nil, ErrHandshakeTimeout
+	}
+	return resp, err
+}
+
+//subscribeDeadline returns the channel fired once the subscribe timeout elapsed, nil if there is none.
+//stop releases its timer.
+func (d *Dispatcher) subscribeDeadline() (<-chan time.Time, func()) {
+	timeout := d.metaTimeout(d.subscribeTimeout)
+	if timeout <= 0 {
+		return nil, func() {}
+	}
+	timer := d.clock().NewTimer(timeout)
+	return timer.C(), func() { timer.Stop() }
+}
+
+//metaTimedOut restores the connection after a meta operation timed out if the transport lost it meanwhile,
+//the connection is kept otherwise
+func (d *Dispatcher) metaTimedOut(err error) {
+	if d.transport.ConnectionState() == transport.StateConnected || atomic.LoadInt32(&d.disconnecting) == 1 {
+		return
+	}
+	d.onTransportDown(event.Event{Type: event.TransportDown, Err: err})
+}
@@ -0,0 +1,80 @@
+package dispatcher
+
+import (
+	"errors"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDispatcher_HandshakeTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	ft := &fakeTransport{onHandshake: func(m *message.Message) {
+		<-release
+	}}
+	d := NewDispatcher("fake://", transport.Options{}, message.Extensions{})
+	d.SetTransport(ft)
+	d.SetHandshakeTimeout(10 * time.Millisecond)
+	err := d.Start()
+	if err != ErrHandshakeTimeout || !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expecting ErrHandshakeTimeout got: %v", err)
+	}
+	if d.State() != StateUnconnected {
+		t.Fatalf("expecting the session unconnected got: %v", d.State())
+	}
+}
+
+func TestDispatcher_SubscribeTimeout(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(d *Dispatcher)
+		//connected is the state of the transport connection when the subscribe times out
+		connected bool
+	}{
+		{name: "subscribe timeout", configure: func(d *Dispatcher) { d.SetSubscribeTimeout(10 * time.Millisecond) }, connected: true},
+		{name: "request timeout", configure: func(d *Dispatcher) { d.SetRequestTimeout(10 * time.Millisecond) }, connected: true},
+		{name: "connection lost", configure: func(d *Dispatcher) { d.SetSubscribeTimeout(10 * time.Millisecond) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var handshakes int32
+			ft := &fakeTransport{onHandshake: func(m *message.Message) {
+				atomic.AddInt32(&handshakes, 1)
+			}}
+			d := NewDispatcher("fake://", transport.Options{RetryInterval: time.Millisecond}, message.Extensions{})
+			d.SetTransport(ft)
+			tt.configure(d)
+			if err := d.Start(); err != nil {
+				t.Fatal(err)
+			}
+			defer d.Disconnect()
+			if tt.connected {
+				ft.SetConnectionState(transport.StateConnected)
+			}
+			reconnected := make(chan struct{}, 1)
+			d.OnReconnect(func() {
+				reconnected <- struct{}{}
+			})
+
+			//the fake server never confirms the subscribes
+			if _, err := d.Subscribe("/foo"); err != ErrSubscribeTimeout || !errors.Is(err, ErrTimeout) {
+				t.Fatalf("expecting ErrSubscribeTimeout got: %v", err)
+			}
+			if tt.connected {
+				time.Sleep(20 * time.Millisecond)
+				if !d.Connected() || atomic.LoadInt32(&handshakes) != 1 {
+					t.Fatal("expecting the connection kept")
+				}
+				return
+			}
+			select {
+			case <-reconnected:
+			case <-time.After(time.Second):
+				t.Fatal("expecting the lost connection restored")
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package dispatcher
+
+//SetWorkers bounds the number of handlers started by HandleMessages and HandleRawMessages running at the same
+//time, 0 doesn't bound them. the messages of a subscription are still handled one at a time, in order,
+//it must be called before the handlers are started.
+func (d *Dispatcher) SetWorkers(n int) {
+	if n <= 0 {
+		d.workers = nil
+		return
+	}
+	d.workers = make(chan struct{}, n)
+}
+
+//work runs fn once a worker is available
+func (d *Dispatcher) work(fn func()) {
+	if d.workers == nil {
+		fn()
+		return
+	}
+	d.workers <- struct{}{}
+	defer func() { <-d.workers }()
+	fn()
+}
@@ -0,0 +1,90 @@
+package dispatcher
+
+import (
+	"github.com/thesyncim/faye/channel"
+	"github.com/thesyncim/faye/message"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDispatcher_Workers(t *testing.T) {
+	d, ft := newTestDispatcher(t, ackSubscriptions)
+	if err := d.SetChannelConfigs([]channel.Config{{Pattern: "/**", BufferSize: 10}}); err != nil {
+		t.Fatal(err)
+	}
+	d.SetWorkers(2)
+
+	var (
+		mu          sync.Mutex
+		running     int
+		maxRunning  int
+		handled     = map[string][]message.Data{}
+		release     = make(chan struct{})
+		fastHandled = make(chan struct{}, 10)
+	)
+	for _, name := range []string{"/slow", "/fast", "/other"} {
+		sub, err := d.Subscribe(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.HandleMessages(sub, func(channel string, msg message.Data) {
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			handled[channel] = append(handled[channel], msg)
+			mu.Unlock()
+			if channel == "/slow" {
+				<-release
+			}
+			if channel == "/fast" {
+				fastHandled <- struct{}{}
+			}
+			mu.Lock()
+			running--
+			mu.Unlock()
+		})
+	}
+
+	for i := 0; i < 3; i++ {
+		for _, name := range []string{"/slow", "/fast", "/other"} {
+			ft.deliver(&message.Message{Channel: name, Data: i})
+		}
+	}
+	//the slow handler holds a worker, the other subscriptions share the second one
+	for i := 0; i < 3; i++ {
+		select {
+		case <-fastHandled:
+		case <-time.After(time.Second):
+			t.Fatal("expecting the fast subscription handled while the slow one blocks")
+		}
+	}
+	close(release)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		mu.Lock()
+		done := len(handled["/slow"]) == 3 && len(handled["/other"]) == 3
+		mu.Unlock()
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expecting all the messages handled")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if maxRunning > 2 {
+		t.Fatalf("expecting at most 2 handlers running got: %d", maxRunning)
+	}
+	for name, msgs := range handled {
+		if expected := []message.Data{0, 1, 2}; !reflect.DeepEqual(msgs, expected) {
+			t.Fatalf("%s: expecting the messages handled in order got: %v", name, msgs)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package event
+
+import (
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/subscription"
+	"sync"
+	"time"
+)
+
+//Type identifies the kind of an Event
+type Type int
+
+const (
+	//Advice is published for every advice received from the server
+	Advice Type = iota
+	//TransportDown is published when the transport stops unexpectedly
+	TransportDown
+	//Error is published for asynchronous errors not tied to a pending operation
+	Error
+	//Disconnected is published once, when the client becomes terminally disconnected
+	Disconnected
+	//ReplayGap is published when the server can't replay the messages lost on Channel after MessageID
+	ReplayGap
+	//BeforeHandshake is published with the handshake Message before the outgoing extensions are applied
+	BeforeHandshake
+	//HandshakeComplete is published with the successful handshake response Message
+	HandshakeComplete
+	//ReconnectAttempt is published before every reconnect Attempt to Endpoint, made after Delay.
+	//Err is the error of the previous attempt, or the cause of the reconnection for the first one.
+	ReconnectAttempt
+	//MultipleClients is published with the Advice reporting another connection using the clientId of the client
+	MultipleClients
+	//Meta is published with every /meta/** Message received from the server
+	Meta
+	//ConnectionLost is published with the Err that brought the connection down, before reconnecting
+	ConnectionLost
+	//Reconnected is published once the connection to Endpoint is restored, after Attempt attempts
+	Reconnected
+	//StateChange is published when the client session moves From a state To another
+	StateChange
+	//SlowConsumer is published when the queue of the Subscription stayed full for Delay
+	SlowConsumer
+	//SubscriptionAdded is published once the server acknowledged the Subscription
+	SubscriptionAdded
+	//SubscriptionRemoved is published when the Subscription is removed, Err is the reason if not unsubscribed
+	SubscriptionRemoved
+	//MessageSent is published with every Message handed to the transport
+	MessageSent
+	//MessageReceived is published with every Message received, once the incoming extensions ran
+	MessageReceived
+)
+
+//Event is an internal notification, only the fields relevant to the Type are set
+type Event struct {
+	Type         Type
+	Time         time.Time
+	Err          error
+	Advice       *message.Advise
+	Message      *message.Message
+	Channel      string
+	MessageID    string
+	Attempt      int
+	Delay        time.Duration
+	Endpoint     string
+	From         int
+	To           int
+	Subscription *subscription.Subscription
+}
+
+//Handler consumes events
+type Handler func(e Event)
+
+//Bus dispatches events to the handlers registered for their type.
+//handlers run synchronously in the publisher goroutine, in registration order.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[Type][]*Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{handlers: map[Type][]*Handler{}}
+}
+
+//Subscribe registers the handler for the provided event type, the returned func removes it
+func (b *Bus) Subscribe(t Type, handler Handler) (unsubscribe func()) {
+	h := &handler
+	b.mu.Lock()
+	b.handlers[t] = append(b.handlers[t], h)
+	b.mu.Unlock()
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		handlers := b.handlers[t]
+		for i := range handlers {
+			if handlers[i] == h {
+				//copy so a concurrent Publish keeps iterating the old slice
+				b.handlers[t] = append(handlers[:i:i], handlers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+//Publish sends the event to all handlers registered for its type, Time is set if empty
+func (b *Bus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.mu.RLock()
+	handlers := b.handlers[e.Type]
+	b.mu.RUnlock()
+
+	for i := range handlers {
+		(*handlers[i])(e)
+	}
+}
@@ -0,0 +1,58 @@
+package event
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestBus_Publish(t *testing.T) {
+	b := NewBus()
+
+	var got []string
+	b.Subscribe(Error, func(e Event) {
+		got = append(got, "first:"+e.Err.Error())
+	})
+	b.Subscribe(Error, func(e Event) {
+		got = append(got, "second:"+e.Err.Error())
+	})
+	b.Subscribe(Disconnected, func(e Event) {
+		got = append(got, "disconnected")
+	})
+
+	b.Publish(Event{Type: Error, Err: errors.New("boom")})
+
+	expected := []string{"first:boom", "second:boom"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expecting: %v got: %v", expected, got)
+	}
+}
+
+func TestBus_Unsubscribe(t *testing.T) {
+	b := NewBus()
+
+	var calls int
+	unsubscribe := b.Subscribe(Advice, func(e Event) {
+		calls++
+	})
+	b.Publish(Event{Type: Advice})
+	unsubscribe()
+	b.Publish(Event{Type: Advice})
+
+	if calls != 1 {
+		t.Fatalf("expecting 1 call got: %d", calls)
+	}
+}
+
+func TestBus_PublishSetsTime(t *testing.T) {
+	b := NewBus()
+
+	var e Event
+	b.Subscribe(Error, func(ev Event) {
+		e = ev
+	})
+	b.Publish(Event{Type: Error})
+	if e.Time.IsZero() {
+		t.Fatal("expecting event time to be set")
+	}
+}
@@ -26,15 +26,36 @@ func (n *SubscriptionName) Match(channel string) bool {
 	return false
 }
 
+//expand returns the subscription names matching the channel: the wildcards of its parents and the channel itself,
+//e.g. /**, /foo/**, /foo/* and /foo/bar for /foo/bar
 func (n *SubscriptionName) expand() []string {
 	segments := strings.Split(n.n, "/")
-	num_segments := len(segments)
-	patterns := make([]string, num_segments+1)
-	patterns[0] = "/**"
-	for i := 1; i < len(segments); i = i + 2 {
-		patterns[i] = strings.Join(segments[:i+1], "/") + "/**"
+	patterns := make([]string, 0, len(segments)+1)
+	patterns = append(patterns, "/**")
+	for i := 2; i < len(segments); i++ {
+		patterns = append(patterns, strings.Join(segments[:i], "/")+"/**")
 	}
-	patterns[len(patterns)-2] = strings.Join(segments[:num_segments-1], "/") + "/*"
-	patterns[len(patterns)-1] = n.n
-	return patterns
+	return append(patterns, strings.Join(segments[:len(segments)-1], "/")+"/*", n.n)
+}
+
+//Covers reports whether every channel matched by the subscription name is also matched by pattern,
+//e.g. /chat/** covers /chat/foo, /chat/foo/bar and /chat/*
+func Covers(pattern string, name string) bool {
+	if pattern == name {
+		return true
+	}
+	p := strings.Split(pattern, "/")[1:]
+	n := strings.Split(name, "/")[1:]
+	for i := range p {
+		if p[i] == "**" {
+			return len(n) > i
+		}
+		if i >= len(n) || n[i] == "**" {
+			return false
+		}
+		if p[i] != "*" && p[i] != n[i] {
+			return false
+		}
+	}
+	return len(p) == len(n)
 }
@@ -0,0 +1,46 @@
+package store
+
+import "testing"
+
+func TestCovers(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{pattern: "/foo", name: "/foo", want: true},
+		{pattern: "/foo", name: "/bar", want: false},
+		{pattern: "/foo/*", name: "/foo/bar", want: true},
+		{pattern: "/foo/*", name: "/foo/*", want: true},
+		{pattern: "/foo/*", name: "/foo/bar/baz", want: false},
+		{pattern: "/foo/*", name: "/foo/**", want: false},
+		{pattern: "/foo/*", name: "/foo", want: false},
+		{pattern: "/foo/**", name: "/foo/bar/baz", want: true},
+		{pattern: "/foo/**", name: "/foo/*", want: true},
+		{pattern: "/foo/**", name: "/foo/**", want: true},
+		{pattern: "/foo/**", name: "/foo", want: false},
+		{pattern: "/**", name: "/foo", want: true},
+		{pattern: "/**", name: "/**", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.name, func(t *testing.T) {
+			if got := Covers(tt.pattern, tt.name); got != tt.want {
+				t.Errorf("Covers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubscriptionName_Match(t *testing.T) {
+	name := NewName("/foo/bar/baz")
+	for _, pattern := range []string{"/**", "/foo/**", "/foo/bar/**", "/foo/bar/*", "/foo/bar/baz"} {
+		if !name.Match(pattern) {
+			t.Errorf("expecting %s to match", pattern)
+		}
+	}
+	for _, pattern := range []string{"/*", "/foo/*", "/foo/bar", "/foo/bar/baz/**"} {
+		if name.Match(pattern) {
+			t.Errorf("expecting %s not to match", pattern)
+		}
+	}
+}
@@ -11,6 +11,8 @@ type SubscriptionsStore struct {
 
 	//cache for expanded channel names
 	cache map[string]*SubscriptionName
+	//onChange is called with the change of the number of subscriptions, see OnChange
+	onChange func(delta int)
 }
 
 func NewStore(size int) *SubscriptionsStore {
@@ -20,9 +22,25 @@ func NewStore(size int) *SubscriptionsStore {
 	}
 }
 
+//OnChange registers a function called with the change of the number of subscriptions on every Add and Remove,
+//the calls are serialized. it must not use the store.
+func (s *SubscriptionsStore) OnChange(onChange func(delta int)) {
+	s.mutex.Lock()
+	s.onChange = onChange
+	s.mutex.Unlock()
+}
+
+//changed reports the change of the number of subscriptions, mutex must be held
+func (s *SubscriptionsStore) changed(delta int) {
+	if s.onChange != nil && delta != 0 {
+		s.onChange(delta)
+	}
+}
+
 func (s *SubscriptionsStore) Add(sub *subscription.Subscription) {
 	s.mutex.Lock()
 	s.subs[sub.Name()] = append(s.subs[sub.Name()], sub)
+	s.changed(1)
 	s.mutex.Unlock()
 }
 
@@ -39,20 +57,25 @@ func (s *SubscriptionsStore) Match(channel string) []*subscription.Subscription
 		name = NewName(channel)
 		s.cache[channel] = name
 	}
-	for _, subs := range s.subs {
-		for i := range subs {
-			if name.Match(subs[i].Name()) {
-				matches = append(matches, subs[i])
-			}
+	//the subscriptions are indexed by name, only the names matching the channel are looked up
+	n := 0
+	for _, pattern := range name.patterns {
+		n += len(s.subs[pattern])
+	}
+	if n > 0 {
+		matches = make([]*subscription.Subscription, 0, n)
+		for _, pattern := range name.patterns {
+			matches = append(matches, s.subs[pattern]...)
 		}
 	}
 	s.mutex.Unlock()
 	return matches
 }
 
-func (s *SubscriptionsStore) Remove(sub *subscription.Subscription) {
-	close(sub.MsgChannel())
+//Remove removes the subscription and closes its channel, it returns false if it was already removed
+func (s *SubscriptionsStore) Remove(sub *subscription.Subscription) bool {
 	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	for channel, subs := range s.subs {
 		for i := range subs {
 			if subs[i] == sub {
@@ -60,31 +83,50 @@ func (s *SubscriptionsStore) Remove(sub *subscription.Subscription) {
 				subs = subs[:i+copy(subs[i:], subs[i+1:])]
 				if len(subs) == 0 {
 					delete(s.subs, channel)
+				} else {
+					s.subs[channel] = subs
 				}
-				goto end
+				sub.CloseMsgChannel()
+				s.changed(-1)
+				return true
 			}
 		}
 	}
-
-end:
-	s.mutex.Unlock()
+	return false
 }
 
-//RemoveAll removel all subscriptions and close all channels
+//RemoveAll removes all subscriptions and close all channels, the server is not notified
 func (s *SubscriptionsStore) RemoveAll() {
 	s.mutex.Lock()
+	removed := 0
 	for i := range s.subs {
 		//close all listeners
 		for j := range s.subs[i] {
-			s.subs[i][j].Unsubscribe()
-			close(s.subs[i][j].MsgChannel())
+			s.subs[i][j].CloseMsgChannel()
 		}
+		removed += len(s.subs[i])
 		delete(s.subs, i)
 	}
+	s.changed(-removed)
 	s.mutex.Unlock()
 }
 
 //Count return the number of subscriptions associated with the specified channel
 func (s *SubscriptionsStore) Count(channel string) int {
-	return len(s.Match(channel))
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.subs[channel])
+}
+
+//Covered returns the subscriptions whose channel is covered by the pattern, see Covers
+func (s *SubscriptionsStore) Covered(pattern string) []*subscription.Subscription {
+	var matches []*subscription.Subscription
+	s.mutex.Lock()
+	for channel, subs := range s.subs {
+		if Covers(pattern, channel) {
+			matches = append(matches, subs...)
+		}
+	}
+	s.mutex.Unlock()
+	return matches
 }
@@ -1,14 +1,16 @@
 package store
 
 import (
+	"github.com/thesyncim/faye/message"
 	"github.com/thesyncim/faye/subscription"
 	"reflect"
+	"strconv"
 	"testing"
 )
 
 var (
-	wildcardSubscription, _ = subscription.NewSubscription("a", "/wildcard/*", nil, nil, nil)
-	simpleSubscription, _   = subscription.NewSubscription("b", "/foo/bar", nil, nil, nil)
+	wildcardSubscription, _ = subscription.NewSubscription("/wildcard/*", nil, nil)
+	simpleSubscription, _   = subscription.NewSubscription("/foo/bar", nil, nil)
 )
 
 func TestStore_Add(t *testing.T) {
@@ -35,6 +37,7 @@ func TestStore_Add(t *testing.T) {
 				subs: map[string][]*subscription.Subscription{
 					"/wildcard/*": {wildcardSubscription},
 				},
+				cache: map[string]*SubscriptionName{},
 			},
 		},
 		{
@@ -48,6 +51,7 @@ func TestStore_Add(t *testing.T) {
 				subs: map[string][]*subscription.Subscription{
 					"/wildcard/*": {wildcardSubscription, wildcardSubscription, wildcardSubscription},
 				},
+				cache: map[string]*SubscriptionName{},
 			},
 		},
 	}
@@ -122,19 +126,98 @@ func TestStore_Match(t *testing.T) {
 }
 
 func TestStore_Remove(t *testing.T) {
+	newSub := func(name string) *subscription.Subscription {
+		sub, _ := subscription.NewSubscription(name, nil, make(chan *message.Message))
+		return sub
+	}
+	first, second, other := newSub("/foo"), newSub("/foo"), newSub("/bar")
+	store := NewStore(0)
+	store.Add(first)
+	store.Add(second)
+	store.Add(other)
+
 	type args struct {
 		sub *subscription.Subscription
 	}
 	tests := []struct {
-		name string
-		s    *SubscriptionsStore
-		args args
+		name    string
+		s       *SubscriptionsStore
+		args    args
+		count   map[string]int
+		removed bool
 	}{
-		// TODO: Add test cases.
+		{
+			name:    "remove one of two",
+			s:       store,
+			args:    args{sub: first},
+			count:   map[string]int{"/foo": 1, "/bar": 1},
+			removed: true,
+		},
+		{
+			name:    "remove last",
+			s:       store,
+			args:    args{sub: second},
+			count:   map[string]int{"/foo": 0, "/bar": 1},
+			removed: true,
+		},
+		{
+			name:  "remove twice",
+			s:     store,
+			args:  args{sub: second},
+			count: map[string]int{"/foo": 0, "/bar": 1},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			tt.s.Remove(tt.args.sub)
+			if got := tt.s.Remove(tt.args.sub); got != tt.removed {
+				t.Errorf("Remove() = %v, want %v", got, tt.removed)
+			}
+			for channel, count := range tt.count {
+				if got := tt.s.Count(channel); got != count {
+					t.Errorf("Count(%s) = %d, want %d", channel, got, count)
+				}
+			}
 		})
 	}
 }
+
+func TestStore_OnChange(t *testing.T) {
+	newSub := func(name string) *subscription.Subscription {
+		sub, _ := subscription.NewSubscription(name, nil, make(chan *message.Message))
+		return sub
+	}
+	var deltas []int
+	store := NewStore(0)
+	store.OnChange(func(delta int) {
+		deltas = append(deltas, delta)
+	})
+	first := newSub("/foo")
+	store.Add(first)
+	store.Add(newSub("/foo"))
+	store.Add(newSub("/bar"))
+	store.Remove(first)
+	store.Remove(first)
+	store.RemoveAll()
+	store.RemoveAll()
+
+	if expected := []int{1, 1, 1, -1, -2}; !reflect.DeepEqual(deltas, expected) {
+		t.Fatalf("expecting the changes %v got: %v", expected, deltas)
+	}
+}
+
+func BenchmarkStore_Match(b *testing.B) {
+	store := NewStore(0)
+	for i := 0; i < 1000; i++ {
+		sub, _ := subscription.NewSubscription("/foo/"+strconv.Itoa(i), nil, nil)
+		store.Add(sub)
+	}
+	wildcard, _ := subscription.NewSubscription("/foo/*", nil, nil)
+	store.Add(wildcard)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if len(store.Match("/foo/42")) != 2 {
+			b.Fatal("expecting 2 matches")
+		}
+	}
+}
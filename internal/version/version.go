@@ -0,0 +1,27 @@
+package version
+
+import (
+	"runtime"
+)
+
+//Version is the library version
+const Version = "0.1.0"
+
+//Name is the library name reported to servers
+const Name = "fayec"
+
+//ClientExt returns the ext.client block sent on handshake to identify the client
+func ClientExt() map[string]interface{} {
+	return map[string]interface{}{
+		"name":    Name,
+		"version": Version,
+		"go":      runtime.Version(),
+		"os":      runtime.GOOS,
+		"arch":    runtime.GOARCH,
+	}
+}
+
+//UserAgent returns the User-Agent header sent by the HTTP based transports, e.g. fayec/0.1.0 (go1.21.0; linux/amd64)
+func UserAgent() string {
+	return Name + "/" + Version + " (" + runtime.Version() + "; " + runtime.GOOS + "/" + runtime.GOARCH + ")"
+}
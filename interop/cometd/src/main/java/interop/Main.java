@@ -0,0 +1,43 @@
+package interop;
+
+import org.cometd.bayeux.Promise;
+import org.cometd.bayeux.server.BayeuxServer;
+import org.cometd.bayeux.server.ServerChannel;
+import org.cometd.bayeux.server.ServerMessage;
+import org.cometd.bayeux.server.ServerSession;
+import org.cometd.server.DefaultSecurityPolicy;
+import org.cometd.server.ext.AcknowledgedMessagesExtension;
+import org.cometd.server.http.jakarta.CometDServlet;
+import org.eclipse.jetty.server.Server;
+import org.eclipse.jetty.servlet.ServletContextHandler;
+import org.eclipse.jetty.servlet.ServletHolder;
+import org.eclipse.jetty.websocket.jakarta.server.config.JakartaWebSocketServletContainerInitializer;
+
+// Main serves CometD on :8080/cometd with the websocket and long-polling transports, the acknowledged messages
+// extension and the subscribes to /unauthorized denied, as the faye target does.
+public class Main {
+    public static void main(String[] args) throws Exception {
+        Server server = new Server(8080);
+        ServletContextHandler context = new ServletContextHandler(ServletContextHandler.SESSIONS);
+        context.setContextPath("/");
+        server.setHandler(context);
+        JakartaWebSocketServletContainerInitializer.configure(context, null);
+
+        ServletHolder cometd = context.addServlet(CometDServlet.class, "/cometd/*");
+        cometd.setInitParameter("timeout", "2000");
+        cometd.setInitParameter("ws.timeout", "2000");
+        cometd.setInitParameter("ws.cometdURLMapping", "/cometd/*");
+        cometd.setInitOrder(1);
+        server.start();
+
+        BayeuxServer bayeux = (BayeuxServer) context.getServletContext().getAttribute(BayeuxServer.ATTRIBUTE);
+        bayeux.addExtension(new AcknowledgedMessagesExtension());
+        bayeux.setSecurityPolicy(new DefaultSecurityPolicy() {
+            @Override
+            public void canSubscribe(BayeuxServer server, ServerSession session, ServerChannel channel, ServerMessage message, Promise<Boolean> promise) {
+                promise.succeed(!"/unauthorized".equals(channel.getId()));
+            }
+        });
+        server.join();
+    }
+}
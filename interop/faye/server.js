@@ -0,0 +1,23 @@
+var http = require('http'),
+    faye = require('faye');
+
+var server = http.createServer(),
+    bayeux = new faye.NodeAdapter({mount: '/faye', timeout: 2});
+
+var unauthorized = [
+    '/unauthorized',
+];
+
+bayeux.addExtension({
+    incoming: function (message, callback) {
+        if (message.channel === '/meta/subscribe') {
+            if (unauthorized.indexOf(message.subscription) >= 0) {
+                message.error = '403::unauthorized channel';
+            }
+        }
+        callback(message);
+    }
+});
+
+bayeux.attach(server);
+server.listen(8000);
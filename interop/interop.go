@@ -0,0 +1,136 @@
+//Package interop runs the client test matrix against real Bayeux servers, whose subtle differences the fixtures of
+//the conformance package don't cover: faye (Node), CometD (Java) and nginx terminating TLS in front of faye. the
+//servers are started with docker compose from the test of the package, built with the interop tag:
+//
+//	go test -tags interop ./interop
+//
+//each scenario runs against every target with each transport the target supports, see Run.
+package interop
+
+import (
+	"crypto/tls"
+	"fmt"
+	fayec "github.com/thesyncim/faye"
+	_ "github.com/thesyncim/faye/transport/streaming"
+	"strings"
+	"testing"
+	"time"
+)
+
+//timeout bounds the wait for the messages expected by the scenarios
+const timeout = 10 * time.Second
+
+//serverTimeout is the connect timeout the servers of docker-compose.yml are configured with, the scenarios outlive
+//it to check the connects are renewed as advised
+const serverTimeout = 2 * time.Second
+
+//Target is a Bayeux server of docker-compose.yml
+type Target struct {
+	//Name names the target in the test names
+	Name string
+	//Service is the compose service and Port its exposed port, e.g. 8000/tcp
+	Service string
+	Port    string
+	//Path is the mount path of the Bayeux endpoint
+	Path string
+	//TLS is set for the targets served over https and wss
+	TLS bool
+	//Transports are the client transports the server supports
+	Transports []string
+	//DeniedChannel is a channel the server rejects the subscribes to, empty if it rejects none
+	DeniedChannel string
+}
+
+//Targets are the servers of docker-compose.yml
+var Targets = []Target{
+	{
+		Name:          "faye",
+		Service:       "faye",
+		Port:          "8000/tcp",
+		Path:          "/faye",
+		Transports:    []string{"websocket", "long-polling"},
+		DeniedChannel: "/unauthorized",
+	},
+	{
+		Name:          "cometd",
+		Service:       "cometd",
+		Port:          "8080/tcp",
+		Path:          "/cometd",
+		Transports:    []string{"websocket", "long-polling"},
+		DeniedChannel: "/unauthorized",
+	},
+	{
+		Name:          "nginx-tls",
+		Service:       "nginx",
+		Port:          "8443/tcp",
+		Path:          "/faye",
+		TLS:           true,
+		Transports:    []string{"websocket", "long-polling"},
+		DeniedChannel: "/unauthorized",
+	},
+}
+
+//URL returns the endpoint of the target reached at addr with the transport
+func (t Target) URL(addr string, transport string) string {
+	scheme := "http"
+	if strings.HasPrefix(transport, "websocket") {
+		scheme = "ws"
+	}
+	if t.TLS {
+		scheme += "s"
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, addr, t.Path)
+}
+
+//Env is a target reached with a transport, the scenarios create their clients from it
+type Env struct {
+	Target    Target
+	Transport string
+	Endpoint  string
+	//TLSConfig trusts the certificate of the TLS targets
+	TLSConfig *tls.Config
+}
+
+//NewClient creates a client connected to the target with the transport of the env, opts are applied last. the
+//client is disconnected when the test ends
+func (e *Env) NewClient(t *testing.T, opts ...fayec.Option) *fayec.Client {
+	t.Helper()
+	opts = append([]fayec.Option{
+		fayec.WithTransportName(e.Transport),
+		fayec.WithChannelConfig(fayec.ChannelConfig{Pattern: "/**", BufferSize: 100}),
+	}, opts...)
+	if e.TLSConfig != nil {
+		opts = append(opts, fayec.WithTLSConfig(e.TLSConfig))
+	}
+	client, err := fayec.NewClient(e.Endpoint, opts...)
+	if err != nil {
+		t.Fatalf("%s: %v", e.Endpoint, err)
+	}
+	t.Cleanup(func() { client.Disconnect() })
+	return client
+}
+
+//Run runs the scenarios against the targets, addr returns the address the target is reached at, e.g. the port
+//mapped by docker
+func Run(t *testing.T, targets []Target, addr func(t *testing.T, target Target) string, tlsConfig *tls.Config) {
+	for _, target := range targets {
+		t.Run(target.Name, func(t *testing.T) {
+			host := addr(t, target)
+			for _, s := range Scenarios {
+				transports := s.Transports
+				if transports == nil {
+					transports = target.Transports
+				}
+				for _, transport := range transports {
+					e := &Env{Target: target, Transport: transport, Endpoint: target.URL(host, transport)}
+					if target.TLS {
+						e.TLSConfig = tlsConfig
+					}
+					t.Run(s.Name+"/"+transport, func(t *testing.T) {
+						s.Run(t, e)
+					})
+				}
+			}
+		})
+	}
+}
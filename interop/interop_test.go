@@ -0,0 +1,108 @@
+//go:build interop
+
+package interop
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/docker/go-connections/nat"
+	"github.com/testcontainers/testcontainers-go/modules/compose"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+//startup bounds the start of the servers, the images are built on the first run
+const startup = 5 * time.Minute
+
+func TestInterop(t *testing.T) {
+	tlsConfig := writeCertificate(t, filepath.Join("nginx", "certs"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), startup)
+	defer cancel()
+	stack, err := compose.NewDockerComposeWith(compose.WithStackFiles("docker-compose.yml"), compose.StackIdentifier("fayec-interop"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := stack.Down(context.Background(), compose.RemoveOrphans(true)); err != nil {
+			t.Log(err)
+		}
+	})
+	for _, target := range Targets {
+		stack.WaitForService(target.Service, wait.ForListeningPort(nat.Port(target.Port)).WithStartupTimeout(startup))
+	}
+	if err = stack.Up(ctx, compose.Wait(true)); err != nil {
+		t.Fatal(err)
+	}
+
+	Run(t, Targets, func(t *testing.T, target Target) string {
+		c, err := stack.ServiceContainer(context.Background(), target.Service)
+		if err != nil {
+			t.Fatal(err)
+		}
+		host, err := c.Host(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		port, err := c.MappedPort(context.Background(), nat.Port(target.Port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return net.JoinHostPort(host, port.Port())
+	}, tlsConfig)
+}
+
+//writeCertificate writes the self signed certificate of localhost served by nginx to dir, the returned config
+//trusts it
+func writeCertificate(t *testing.T, dir string) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err = os.WriteFile(filepath.Join(dir, "server.crt"), certPEM, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err = os.WriteFile(filepath.Join(dir, "server.key"), keyPEM, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(certPEM)
+	return &tls.Config{RootCAs: pool, ServerName: "localhost"}
+}
@@ -0,0 +1,231 @@
+package interop
+
+import (
+	"context"
+	fayec "github.com/thesyncim/faye"
+	"github.com/thesyncim/faye/message"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//Scenario is a behavior of the client checked against every target
+type Scenario struct {
+	Name string
+	//Transports overrides the transports of the targets the scenario runs with
+	Transports []string
+	Run        func(t *testing.T, e *Env)
+}
+
+//Scenarios is the test matrix run against every target
+var Scenarios = []Scenario{
+	{Name: "handshake", Run: testHandshake},
+	{Name: "staged handshake", Run: testStagedHandshake},
+	{Name: "advice", Run: testAdvice},
+	{Name: "publish subscribe", Run: testPubSub},
+	{Name: "wildcards", Run: testWildcards},
+	{Name: "denied subscribe", Run: testDeniedSubscribe},
+	{Name: "reconnect", Run: testReconnect},
+	{Name: "ack extension", Run: testAckExtension},
+	//the servers don't support http streaming, the client falls back to the first transport they advertise it can use
+	{Name: "long-polling fallback", Transports: []string{"http-streaming"}, Run: testFallback},
+}
+
+var (
+	//run keeps the channels of the runs sharing the servers apart
+	run      = strconv.FormatInt(time.Now().UnixNano(), 36)
+	channels int64
+)
+
+//uniqueChannel returns a channel no other scenario uses
+func uniqueChannel() string {
+	return "/interop/" + run + "/" + strconv.FormatInt(atomic.AddInt64(&channels, 1), 10)
+}
+
+func testHandshake(t *testing.T, e *Env) {
+	client := e.NewClient(t)
+	if client.ID() == "" {
+		t.Fatal("expecting a clientId")
+	}
+	info := client.ServerInfo()
+	if info.Version == "" || len(info.SupportedConnectionTypes) == 0 {
+		t.Fatalf("expecting the version and connection types of the server got: %+v", info)
+	}
+	if transport := client.Session().Transport; transport != e.Transport {
+		t.Fatalf("expecting transport %s got: %s", e.Transport, transport)
+	}
+}
+
+func testStagedHandshake(t *testing.T, e *Env) {
+	client := e.NewClient(t, fayec.WithStagedConnect())
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if _, err := client.Handshake(ctx); err != nil {
+		t.Fatal(err)
+	}
+	//the server may hold the first connect response until it has messages to deliver
+	go client.Connect(ctx)
+	roundTrip(t, client, client)
+}
+
+func testAdvice(t *testing.T, e *Env) {
+	client := e.NewClient(t)
+	roundTrip(t, client, client)
+	//the connects held by the server expire meanwhile and must be renewed as advised
+	time.Sleep(2*serverTimeout + 500*time.Millisecond)
+	advice := client.Advice()
+	if advice.Reconnect != message.ReconnectRetry || advice.Timeout <= 0 {
+		t.Fatalf("expecting the server to advise retrying with a timeout got: %+v", advice)
+	}
+	if state := client.State(); state != fayec.StateConnected {
+		t.Fatalf("expecting the client connected got: %v", state)
+	}
+	roundTrip(t, client, client)
+}
+
+func testPubSub(t *testing.T, e *Env) {
+	subscriber := e.NewClient(t)
+	publisher := e.NewClient(t)
+	roundTrip(t, subscriber, publisher)
+}
+
+func testWildcards(t *testing.T, e *Env) {
+	client := e.NewClient(t)
+	base := uniqueChannel()
+	one := subscribe(t, client, base+"/*")
+	all := subscribe(t, client, base+"/**")
+
+	publish(t, client, base+"/a", "a")
+	expect(t, one, "a")
+	expect(t, all, "a")
+	publish(t, client, base+"/a/b", "b")
+	expect(t, all, "b")
+	expectNone(t, one)
+}
+
+func testDeniedSubscribe(t *testing.T, e *Env) {
+	if e.Target.DeniedChannel == "" {
+		t.Skip("the server denies no channel")
+	}
+	client := e.NewClient(t)
+	if _, err := client.Subscribe(fayec.Channel(e.Target.DeniedChannel)); err == nil {
+		t.Fatalf("expecting the subscribe to %s denied", e.Target.DeniedChannel)
+	}
+	//the session goes on
+	roundTrip(t, client, client)
+}
+
+func testReconnect(t *testing.T, e *Env) {
+	var (
+		mu    sync.Mutex
+		conns []net.Conn
+	)
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+		if err == nil {
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+		return conn, err
+	}
+	subscriber := e.NewClient(t, fayec.WithNetDialContext(dial))
+	publisher := e.NewClient(t)
+	channel := uniqueChannel()
+	received := subscribe(t, subscriber, channel)
+	publish(t, publisher, channel, "before")
+	expect(t, received, "before")
+
+	mu.Lock()
+	for _, conn := range conns {
+		conn.Close()
+	}
+	mu.Unlock()
+
+	//published until delivered, the channel is subscribed again once the connection is restored
+	deadline := time.After(timeout)
+	for {
+		if err := publisher.Publish(fayec.Channel(channel), "after"); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case msg := <-received:
+			if msg.Data != "after" {
+				t.Fatalf("expecting after got: %v", msg.Data)
+			}
+			return
+		case <-time.After(200 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("expecting the delivery to resume once reconnected")
+		}
+	}
+}
+
+func testAckExtension(t *testing.T, e *Env) {
+	//negotiated with the servers supporting it, ignored by the others
+	subscriber := e.NewClient(t, fayec.WithAckExtension())
+	publisher := e.NewClient(t)
+	roundTrip(t, subscriber, publisher)
+}
+
+func testFallback(t *testing.T, e *Env) {
+	client := e.NewClient(t)
+	//websocket can't dial the http endpoint, the servers advertising it first are reached with long-polling too
+	if transport := client.Session().Transport; transport != "long-polling" {
+		t.Fatalf("expecting the client to fall back to long-polling got: %s", transport)
+	}
+	roundTrip(t, client, client)
+}
+
+//roundTrip expects a message published by publisher on a new channel to be delivered to subscriber
+func roundTrip(t *testing.T, subscriber, publisher *fayec.Client) {
+	t.Helper()
+	channel := uniqueChannel()
+	received := subscribe(t, subscriber, channel)
+	publish(t, publisher, channel, "hello world")
+	expect(t, received, "hello world")
+}
+
+//subscribe subscribes the client to the channel, the messages delivered are sent on the returned channel
+func subscribe(t *testing.T, client *fayec.Client, channel string) <-chan *message.Message {
+	t.Helper()
+	received := make(chan *message.Message, 100)
+	if _, err := client.SubscribeRaw(fayec.Channel(channel), func(msg *message.Message) {
+		received <- msg
+	}); err != nil {
+		t.Fatalf("subscribe %s: %v", channel, err)
+	}
+	return received
+}
+
+func publish(t *testing.T, client *fayec.Client, channel string, data string) {
+	t.Helper()
+	if err := client.Publish(fayec.Channel(channel), data); err != nil {
+		t.Fatalf("publish %s: %v", channel, err)
+	}
+}
+
+//expect waits for the delivery of data
+func expect(t *testing.T, received <-chan *message.Message, data string) {
+	t.Helper()
+	select {
+	case msg := <-received:
+		if msg.Data != data {
+			t.Fatalf("expecting %s got: %v", data, msg.Data)
+		}
+	case <-time.After(timeout):
+		t.Fatalf("expecting %s delivered", data)
+	}
+}
+
+func expectNone(t *testing.T, received <-chan *message.Message) {
+	t.Helper()
+	select {
+	case msg := <-received:
+		t.Fatalf("expecting no delivery got: %v", msg.Data)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -0,0 +1,63 @@
+package message
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+//BinaryExt is the ext key flagging the binary payloads, see BinaryData
+const BinaryExt = "binary"
+
+//BinaryData is a binary payload, e.g. the data of a publish set to message.BinaryData(b). json has no binary
+//type: it is sent base64 encoded and flagged in ext.binary, the deliveries flagged are decoded back to BinaryData.
+type BinaryData []byte
+
+//BinaryFrame is the ext.binary of the binary payloads. ID, Index and Count are set on the chunks of a payload
+//sent in several messages: the id of the payload, the position of the chunk and the number of chunks.
+type BinaryFrame struct {
+	Encoding string `json:"encoding"`
+	ID       string `json:"id,omitempty"`
+	Index    int    `json:"index,omitempty"`
+	Count    int    `json:"count,omitempty"`
+}
+
+//Chunked reports whether the frame is a chunk of a larger payload
+func (f BinaryFrame) Chunked() bool {
+	return f.Count > 1
+}
+
+//EncodeBinary replaces the BinaryData of m with its base64 encoding and flags it with the frame, the frame
+//encoding is set. it is a no-op if the data isn't binary.
+func EncodeBinary(m *Message, frame BinaryFrame) {
+	data, ok := m.Data.(BinaryData)
+	if !ok {
+		return
+	}
+	frame.Encoding = "base64"
+	m.Data = base64.StdEncoding.EncodeToString(data)
+	m.SetExt(BinaryExt, frame)
+}
+
+//DecodeBinary replaces the data of a message flagged as binary with the BinaryData decoded and returns its frame,
+//ok is false if the message isn't flagged
+func DecodeBinary(m *Message) (frame BinaryFrame, ok bool, err error) {
+	if _, isBinary := m.Data.(BinaryData); isBinary {
+		return BinaryFrame{}, false, nil
+	}
+	if _, found := m.extMap()[BinaryExt]; !found || m.GetExt(BinaryExt, &frame) != nil {
+		return BinaryFrame{}, false, nil
+	}
+	if frame.Encoding != "base64" {
+		return frame, true, fmt.Errorf("binary: unknown encoding `%s`", frame.Encoding)
+	}
+	encoded, isString := m.Data.(string)
+	if !isString {
+		return frame, true, fmt.Errorf("binary: data must be a string")
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return frame, true, fmt.Errorf("binary: %w", err)
+	}
+	m.Data = BinaryData(data)
+	return frame, true, nil
+}
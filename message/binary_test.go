@@ -0,0 +1,54 @@
+package message
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestBinaryData(t *testing.T) {
+	payload := []byte{0, 1, 2, 0xff, 'a'}
+	m := &Message{Channel: "/foo", Data: BinaryData(payload)}
+	EncodeBinary(m, BinaryFrame{ID: "1", Index: 1, Count: 2})
+	if _, ok := m.Data.(string); !ok {
+		t.Fatalf("expecting the data encoded got: %T", m.Data)
+	}
+
+	//through the wire
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received Message
+	if err = json.Unmarshal(b, &received); err != nil {
+		t.Fatal(err)
+	}
+	frame, ok, err := DecodeBinary(&received)
+	if err != nil || !ok {
+		t.Fatalf("expecting the binary data decoded got: %v %v", ok, err)
+	}
+	if data, _ := received.Data.(BinaryData); !bytes.Equal(data, payload) {
+		t.Fatalf("expecting %v got: %v", payload, received.Data)
+	}
+	if frame.ID != "1" || frame.Index != 1 || !frame.Chunked() {
+		t.Fatalf("expecting the chunk frame got: %+v", frame)
+	}
+
+	tests := []struct {
+		name    string
+		m       *Message
+		flagged bool
+	}{
+		{name: "not flagged", m: &Message{Channel: "/foo", Data: "AAE="}},
+		{name: "not a string", m: &Message{Channel: "/foo", Data: 1.0, Ext: map[string]interface{}{"binary": map[string]interface{}{"encoding": "base64"}}}, flagged: true},
+		{name: "unknown encoding", m: &Message{Channel: "/foo", Data: "AAE=", Ext: map[string]interface{}{"binary": map[string]interface{}{"encoding": "hex"}}}, flagged: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ok, err := DecodeBinary(tt.m)
+			if ok != tt.flagged || (err != nil) != tt.flagged {
+				t.Fatalf("expecting flagged %v got: %v %v", tt.flagged, ok, err)
+			}
+		})
+	}
+}
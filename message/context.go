@@ -0,0 +1,25 @@
+package message
+
+import (
+	"context"
+)
+
+//ClientInfo describes the client a message is sent or received by, extensions get it from the context
+type ClientInfo struct {
+	ClientID  string
+	Endpoint  string
+	Transport string
+}
+
+type clientInfoKey struct{}
+
+//ContextWithClientInfo returns a copy of ctx carrying the client info
+func ContextWithClientInfo(ctx context.Context, info ClientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoKey{}, info)
+}
+
+//ClientInfoFromContext returns the client info carried by ctx, ok is false if there is none
+func ClientInfoFromContext(ctx context.Context) (info ClientInfo, ok bool) {
+	info, ok = ctx.Value(clientInfoKey{}).(ClientInfo)
+	return info, ok
+}
@@ -0,0 +1,43 @@
+package message
+
+import (
+	"strconv"
+	"strings"
+)
+
+//Error is a Bayeux error, parsed from the error field of the responses in the code:args:description format,
+//e.g. 401::unknown client or 402:xj3sjdsjdsjad:Unknown Client ID. see GetError
+type Error struct {
+	//Code is the error code, 0 when the error doesn't follow the format
+	Code int
+	//Args are the comma separated arguments
+	Args []string
+	//Description is the error description, the whole error when it doesn't follow the format
+	Description string
+
+	raw string
+}
+
+//ParseError parses a Bayeux error
+func ParseError(s string) *Error {
+	e := &Error{Description: s, raw: s}
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) != 3 {
+		return e
+	}
+	code, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return e
+	}
+	e.Code = code
+	if parts[1] != "" {
+		e.Args = strings.Split(parts[1], ",")
+	}
+	e.Description = parts[2]
+	return e
+}
+
+//Error returns the error as sent by the server
+func (e *Error) Error() string {
+	return e.raw
+}
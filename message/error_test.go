@@ -0,0 +1,38 @@
+package message
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseError(t *testing.T) {
+	var tests = []struct {
+		in       string
+		expected Error
+	}{
+		{"401::unknown client", Error{Code: 401, Description: "unknown client"}},
+		{"402:xj3sjdsjdsjad:Unknown Client ID", Error{Code: 402, Args: []string{"xj3sjdsjdsjad"}, Description: "Unknown Client ID"}},
+		{"403:/foo,/bar:Subscription Failed", Error{Code: 403, Args: []string{"/foo", "/bar"}, Description: "Subscription Failed"}},
+		{"404:: descriptions may: contain colons", Error{Code: 404, Description: " descriptions may: contain colons"}},
+		{"not allowed", Error{Description: "not allowed"}},
+		{"abc::not a code", Error{Description: "abc::not a code"}},
+	}
+	for _, tt := range tests {
+		tt.expected.raw = tt.in
+		if got := ParseError(tt.in); !reflect.DeepEqual(*got, tt.expected) {
+			t.Fatalf("%s: expecting %+v got: %+v", tt.in, tt.expected, *got)
+		}
+	}
+}
+
+func TestMessage_GetError(t *testing.T) {
+	if err := (&Message{}).GetError(); err != nil {
+		t.Fatalf("expecting no error got: %v", err)
+	}
+	err := (&Message{Error: "401::unknown client"}).GetError()
+	var bayeux *Error
+	if !errors.As(err, &bayeux) || bayeux.Code != 401 || err.Error() != "401::unknown client" {
+		t.Fatalf("expecting the Bayeux error 401 got: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package message
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+//ErrExtNotFound is returned by GetExt when the ext of the message has no such key
+var ErrExtNotFound = errors.New("ext not found")
+
+//SetExt sets the key of the message ext to v, creating the ext when empty. an ext that isn't a map, e.g. a struct
+//set by an extension or the raw json kept by a codec, is converted through json first so its fields are kept,
+//one that doesn't encode to a json object is replaced
+func (m *Message) SetExt(key string, v interface{}) {
+	ext := m.extMap()
+	if ext == nil {
+		ext = map[string]interface{}{}
+	}
+	ext[key] = v
+	m.Ext = ext
+}
+
+//GetExt decodes the key of the message ext into out, going through json so out can be any type the value
+//decodes into, e.g. a struct for an ext received as a map. it returns ErrExtNotFound when the key isn't set
+func (m *Message) GetExt(key string, out interface{}) error {
+	ext := m.extMap()
+	v, ok := ext[key]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrExtNotFound, key)
+	}
+	raw, ok := v.(json.RawMessage)
+	if !ok {
+		var err error
+		if raw, err = json.Marshal(v); err != nil {
+			return fmt.Errorf("ext %s: %w", key, err)
+		}
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("ext %s: %w", key, err)
+	}
+	return nil
+}
+
+//DeleteExt removes the key from the message ext, dropping the ext once empty so it isn't sent
+func (m *Message) DeleteExt(key string) {
+	ext := m.extMap()
+	if ext == nil {
+		return
+	}
+	delete(ext, key)
+	if len(ext) == 0 {
+		m.Ext = nil
+		return
+	}
+	m.Ext = ext
+}
+
+//extMap returns the ext as a map, nil when it is empty or doesn't decode to a json object
+func (m *Message) extMap() map[string]interface{} {
+	switch ext := m.Ext.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		return ext
+	}
+	b, err := json.Marshal(m.Ext)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]interface{}
+	if json.Unmarshal(b, &fields) != nil {
+		return nil
+	}
+	return fields
+}
@@ -0,0 +1,94 @@
+package message
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMessage_SetExt(t *testing.T) {
+	type token struct {
+		Token string `json:"token"`
+	}
+	var tests = []struct {
+		name     string
+		ext      interface{}
+		expected map[string]interface{}
+	}{
+		{"empty", nil, map[string]interface{}{"replay": true}},
+		{"map", map[string]interface{}{"ack": 1}, map[string]interface{}{"ack": 1, "replay": true}},
+		{"struct", token{Token: "abc"}, map[string]interface{}{"token": "abc", "replay": true}},
+		{"raw", json.RawMessage(`{"token":"abc"}`), map[string]interface{}{"token": "abc", "replay": true}},
+		{"not an object", "abc", map[string]interface{}{"replay": true}},
+	}
+	for _, tt := range tests {
+		m := &Message{Ext: tt.ext}
+		m.SetExt("replay", true)
+		if !reflect.DeepEqual(m.Ext, tt.expected) {
+			t.Fatalf("%s: expecting %v got: %v", tt.name, tt.expected, m.Ext)
+		}
+	}
+}
+
+func TestMessage_GetExt(t *testing.T) {
+	type auth struct {
+		Token     string `json:"token"`
+		Timestamp int64  `json:"timestamp"`
+	}
+	m := &Message{}
+	m.SetExt("auth", map[string]interface{}{"token": "abc", "timestamp": 1})
+
+	var got auth
+	if err := m.GetExt("auth", &got); err != nil {
+		t.Fatal(err)
+	}
+	if expected := (auth{Token: "abc", Timestamp: 1}); got != expected {
+		t.Fatalf("expecting %+v got: %+v", expected, got)
+	}
+	if err := m.GetExt("replay", &got); !errors.Is(err, ErrExtNotFound) {
+		t.Fatalf("expecting ErrExtNotFound got: %v", err)
+	}
+	var n int
+	if err := m.GetExt("auth", &n); err == nil {
+		t.Fatal("expecting a decoding error")
+	}
+
+	//the helpers survive the json round trip of the message
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received Message
+	if err := json.Unmarshal(b, &received); err != nil {
+		t.Fatal(err)
+	}
+	got = auth{}
+	if err := received.GetExt("auth", &got); err != nil {
+		t.Fatal(err)
+	}
+	if expected := (auth{Token: "abc", Timestamp: 1}); got != expected {
+		t.Fatalf("expecting %+v got: %+v", expected, got)
+	}
+	got = auth{}
+	raw := &Message{Ext: json.RawMessage(`{"auth":{"token":"abc","timestamp":1}}`)}
+	if err := raw.GetExt("auth", &got); err != nil || got.Token != "abc" {
+		t.Fatalf("expecting the raw ext to decode got: %+v %v", got, err)
+	}
+}
+
+func TestMessage_DeleteExt(t *testing.T) {
+	m := &Message{}
+	m.DeleteExt("auth")
+	m.SetExt("auth", "abc")
+	m.SetExt("replay", true)
+
+	m.DeleteExt("auth")
+	if expected := map[string]interface{}{"replay": true}; !reflect.DeepEqual(m.Ext, expected) {
+		t.Fatalf("expecting %v got: %v", expected, m.Ext)
+	}
+	m.DeleteExt("replay")
+	if m.Ext != nil {
+		t.Fatalf("expecting the empty ext to be dropped got: %v", m.Ext)
+	}
+}
@@ -2,28 +2,41 @@ package message
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
+	"fmt"
 	"time"
 )
 
 type Extension func(message *Message)
 
-type Extensions struct {
-	In  []Extension
-	Out []Extension
-}
+//ContextExtension is an extension receiving the context of the operation that produced or received the message,
+//carrying its deadline, any trace context and the ClientInfo.
+type ContextExtension func(ctx context.Context, message *Message)
 
-func (e *Extensions) ApplyOutExtensions(m *Message) {
-	for i := range e.Out {
-		e.Out[i](m)
+//WithContext adapts the extension to a ContextExtension ignoring the context
+func (ext Extension) WithContext() ContextExtension {
+	return func(_ context.Context, m *Message) {
+		ext(m)
 	}
 }
 
-func (e *Extensions) ApplyInExtensions(m *Message) {
+type Extensions struct {
+	In  []ContextExtension
+	Out []ContextExtension
+}
+
+//Pipes adapts the extensions to Pipes run in order with the context of the operation, so they share a Pipeline
+//with the Pipes added to it. a panicking extension stops the chain, see Pipeline.Incoming
+func (e *Extensions) Pipes() []Pipe {
+	pipes := make([]Pipe, 0, len(e.In)+len(e.Out))
 	for i := range e.In {
-		e.In[i](m)
+		pipes = append(pipes, &extensionPipe{in: e.In[i]})
 	}
+	for i := range e.Out {
+		pipes = append(pipes, &extensionPipe{out: e.Out[i]})
+	}
+	return pipes
 }
 
 type Data = interface{}
@@ -44,13 +57,37 @@ type Message struct {
 	AuthSuccessful           bool        `json:"authSuccessful,omitempty"`
 	Error                    string      `json:"error,omitempty"`
 	Subscription             string      `json:"subscription,omitempty"`
+	//RawData is the data as received, kept by a Parser with KeepRawData so DecodeData doesn't encode it again
+	RawData json.RawMessage `json:"-"`
+}
+
+//DecodeData decodes the data into v, e.g. a pointer to a struct, with encoding/json. see DecodeDataWith
+func (m *Message) DecodeData(v interface{}) error {
+	return m.DecodeDataWith(json.Unmarshal, v)
 }
 
+//DecodeDataWith decodes the data into v with unmarshal: the RawData when the parser kept it, the data encoded
+//as json otherwise, e.g. when it was decoded by another codec
+func (m *Message) DecodeDataWith(unmarshal func(data []byte, v interface{}) error, v interface{}) error {
+	raw := m.RawData
+	if raw == nil {
+		var err error
+		if raw, err = json.Marshal(m.Data); err != nil {
+			return fmt.Errorf("data: %w", err)
+		}
+	}
+	if err := unmarshal(raw, v); err != nil {
+		return fmt.Errorf("data: %w", err)
+	}
+	return nil
+}
+
+//GetError returns the error of the message as an *Error, nil if it has none
 func (m *Message) GetError() error {
 	if m.Error == "" {
 		return nil
 	}
-	return errors.New(m.Error)
+	return ParseError(m.Error)
 }
 
 type Reconnect string
@@ -82,7 +119,7 @@ func (a *Advise) MarshalJSON() ([]byte, error) {
 	type jsonStruct struct {
 		Reconnect       string   `json:"reconnect,omitempty"`
 		Interval        int64    `json:"interval,omitempty"`
-		Timeout         int64    `json:"timeout,omitempty"`
+		Timeout         int64    `json:"timeout"` //a zero timeout asks the server to respond to /meta/connect immediately
 		MultipleClients bool     `json:"multiple-clients,omitempty"`
 		Hosts           []string `json:"hosts,omitempty"`
 	}
@@ -101,37 +138,26 @@ func (a *Advise) MarshalJSON() ([]byte, error) {
 }
 
 func (a *Advise) UnmarshalJSON(b []byte) error {
-	var raw map[string]interface{}
-	err := json.Unmarshal(b, &raw)
-	if err != nil {
-		return err
+	var raw struct {
+		Reconnect       Reconnect `json:"reconnect"`
+		Interval        *float64  `json:"interval"`
+		Timeout         *float64  `json:"timeout"`
+		MultipleClients bool      `json:"multiple-clients"`
+		Hosts           []string  `json:"hosts"`
 	}
-
-	reconnect, ok := raw["reconnect"]
-	if ok {
-		a.Reconnect = Reconnect(reconnect.(string))
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return fmt.Errorf("advice: %w", err)
 	}
 
-	interval, ok := raw["interval"]
-	if ok {
-		a.Interval = time.Duration(interval.(float64)) * time.Millisecond
+	a.Reconnect = raw.Reconnect
+	if raw.Interval != nil {
+		a.Interval = time.Duration(*raw.Interval) * time.Millisecond
 	}
-
-	timeout, ok := raw["timeout"]
-	if ok {
-		a.Timeout = time.Duration(timeout.(float64)) * time.Millisecond
+	if raw.Timeout != nil {
+		a.Timeout = time.Duration(*raw.Timeout) * time.Millisecond
 	}
-
-	mc, ok := raw["multiple-clients"]
-	if ok {
-		a.MultipleClients = mc.(bool)
-	}
-
-	hosts, ok := raw["hosts"]
-	if ok {
-		a.Hosts = hosts.([]string)
-	}
-
+	a.MultipleClients = raw.MultipleClients
+	a.Hosts = raw.Hosts
 	return nil
 }
 func IsEventDelivery(msg *Message) bool {
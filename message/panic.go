@@ -0,0 +1,29 @@
+package message
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+//PanicError is the error reported in place of a panic in a user callback, e.g. a message handler or an extension
+type PanicError struct {
+	//Value is the value passed to panic
+	Value interface{}
+	//Stack is the stack trace of the goroutine that panicked
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v\n\n%s", e.Value, e.Stack)
+}
+
+//CatchPanic calls fn and returns a *PanicError if it panics
+func CatchPanic(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	fn()
+	return nil
+}
@@ -0,0 +1,239 @@
+package message
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+//ErrMalformedMessage is returned by a strict Parser for the messages violating the Bayeux spec
+var ErrMalformedMessage = errors.New("malformed message")
+
+//ParseMode decides how a Parser handles the messages violating the Bayeux spec
+type ParseMode int
+
+const (
+	//Lenient coerces the common server quirks, e.g. numeric ids, and counts them. this is the default mode
+	Lenient ParseMode = iota
+	//Strict rejects the messages violating the spec with ErrMalformedMessage
+	Strict
+)
+
+//NumberMode decides how a Parser decodes the numbers of the message data
+type NumberMode int
+
+const (
+	//Float64 decodes the numbers as float64, like encoding/json. integers above 2^53 lose precision
+	Float64 NumberMode = iota
+	//UseNumber decodes the numbers as json.Number, keeping their text
+	UseNumber
+	//PreserveIntegers decodes the integers fitting an int64 as int64 and the other numbers as float64
+	PreserveIntegers
+)
+
+//Coercions counts the quirks coerced by a lenient Parser
+type Coercions struct {
+	//IDs counts the ids and client ids sent as numbers
+	IDs uint64
+	//Booleans counts the successful fields sent as strings
+	Booleans uint64
+	//Unwrapped counts the messages sent alone instead of in an array
+	Unwrapped uint64
+}
+
+//Parser decodes the messages received from the server, the zero value is a lenient parser
+type Parser struct {
+	Mode ParseMode
+	//Numbers decides how the numbers of the data are decoded
+	Numbers NumberMode
+	//KeepRawData keeps the data as received in Message.RawData, see Message.DecodeData
+	KeepRawData bool
+
+	ids, booleans, unwrapped uint64
+}
+
+//Coercions returns the number of quirks coerced so far
+func (p *Parser) Coercions() Coercions {
+	return Coercions{
+		IDs:       atomic.LoadUint64(&p.ids),
+		Booleans:  atomic.LoadUint64(&p.booleans),
+		Unwrapped: atomic.LoadUint64(&p.unwrapped),
+	}
+}
+
+//rawsPool holds the buffers the batches are split into, they aren't referenced once parsed
+var rawsPool = sync.Pool{New: func() interface{} { return new([]json.RawMessage) }}
+
+//Parse decodes a json array of messages. the messages rejected by a strict parser are left out and
+//their errors returned along with the valid messages.
+func (p *Parser) Parse(b []byte) ([]Message, error) {
+	var raws []json.RawMessage
+	if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '{' {
+		if p.Mode == Strict {
+			return nil, fmt.Errorf("%w: expecting an array of messages", ErrMalformedMessage)
+		}
+		atomic.AddUint64(&p.unwrapped, 1)
+		raws = []json.RawMessage{b}
+	} else {
+		buf := rawsPool.Get().(*[]json.RawMessage)
+		defer rawsPool.Put(buf)
+		//the raw messages are decoded into the buffers of the previous batch
+		raws = (*buf)[:0]
+		err := json.Unmarshal(b, &raws)
+		*buf = raws
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	msgs := make([]Message, 0, len(raws))
+	var errs []error
+	for i := range raws {
+		var m Message
+		if err := p.decode(raws[i], &m); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, errors.Join(errs...)
+}
+
+//decode decodes a single message, the fields servers get wrong are decoded apart and checked
+func (p *Parser) decode(raw json.RawMessage, m *Message) error {
+	type plain Message
+	wire := struct {
+		*plain
+		Id         json.RawMessage `json:"id,omitempty"`
+		ClientId   json.RawMessage `json:"clientId,omitempty"`
+		Successful json.RawMessage `json:"successful,omitempty"`
+		Data       json.RawMessage `json:"data,omitempty"`
+	}{plain: (*plain)(m)}
+	if err := json.Unmarshal(raw, &wire); err != nil {
+		return err
+	}
+	if len(wire.Data) > 0 {
+		var err error
+		if m.Data, err = p.DecodeData(wire.Data); err != nil {
+			return err
+		}
+		if p.KeepRawData {
+			m.RawData = wire.Data
+		}
+	}
+
+	var err error
+	if m.Id, err = p.decodeID("id", wire.Id); err != nil {
+		return err
+	}
+	if m.ClientId, err = p.decodeID("clientId", wire.ClientId); err != nil {
+		return err
+	}
+	if m.Successful, err = p.decodeBool("successful", wire.Successful); err != nil {
+		return err
+	}
+	if m.Channel == "" && p.Mode == Strict {
+		return fmt.Errorf("%w: missing channel", ErrMalformedMessage)
+	}
+	return nil
+}
+
+//decodeID decodes a string field, numbers are coerced by a lenient parser
+func (p *Parser) decodeID(field string, raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	if s, ok := plainString(raw); ok {
+		return s, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(raw, &n); err != nil || p.Mode == Strict {
+		return "", fmt.Errorf("%w: %s must be a string, got %s", ErrMalformedMessage, field, raw)
+	}
+	atomic.AddUint64(&p.ids, 1)
+	return n.String(), nil
+}
+
+//decodeBool decodes a boolean field, "true" and "false" strings are coerced by a lenient parser
+func (p *Parser) decodeBool(field string, raw json.RawMessage) (bool, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return false, nil
+	}
+	switch string(raw) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	var b bool
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil && p.Mode != Strict {
+		if b, err = strconv.ParseBool(s); err == nil {
+			atomic.AddUint64(&p.booleans, 1)
+			return b, nil
+		}
+	}
+	return false, fmt.Errorf("%w: %s must be a boolean, got %s", ErrMalformedMessage, field, raw)
+}
+
+//plainString returns the json string raw without its quotes, ok is false if it has escapes or non ascii
+//characters to decode
+func plainString(raw json.RawMessage) (s string, ok bool) {
+	if len(raw) < 2 || raw[0] != '"' || raw[len(raw)-1] != '"' {
+		return "", false
+	}
+	for _, c := range raw[1 : len(raw)-1] {
+		if c == '\\' || c == '"' || c < ' ' || c >= utf8.RuneSelf {
+			return "", false
+		}
+	}
+	return string(raw[1 : len(raw)-1]), true
+}
+
+//DecodeData decodes the message data according to the number mode
+func (p *Parser) DecodeData(raw json.RawMessage) (Data, error) {
+	var data Data
+	if p.Numbers == Float64 {
+		err := json.Unmarshal(raw, &data)
+		return data, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&data); err != nil {
+		return nil, err
+	}
+	if p.Numbers == PreserveIntegers {
+		data = preserveIntegers(data)
+	}
+	return data, nil
+}
+
+//preserveIntegers replaces the json.Number values of v with int64, or float64 for the other numbers
+func preserveIntegers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = preserveIntegers(v[k])
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = preserveIntegers(v[i])
+		}
+	}
+	return v
+}
@@ -0,0 +1,181 @@
+package message
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParser_Parse(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      ParseMode
+		input     string
+		want      []Message
+		err       bool
+		coercions Coercions
+	}{
+		{
+			name:  "conforming",
+			input: `[{"channel":"/meta/connect","id":"1","clientId":"abc","successful":true}]`,
+			want:  []Message{{Channel: "/meta/connect", Id: "1", ClientId: "abc", Successful: true}},
+		},
+		{
+			name:      "lenient coerces quirks",
+			input:     `{"channel":"/meta/connect","id":1,"clientId":42,"successful":"true"}`,
+			want:      []Message{{Channel: "/meta/connect", Id: "1", ClientId: "42", Successful: true}},
+			coercions: Coercions{IDs: 2, Booleans: 1, Unwrapped: 1},
+		},
+		{
+			name:  "lenient keeps messages without channel",
+			input: `[{"id":"1"}]`,
+			want:  []Message{{Id: "1"}},
+		},
+		{
+			name:  "strict rejects numeric ids",
+			mode:  Strict,
+			input: `[{"channel":"/foo","id":1},{"channel":"/foo","id":"2"}]`,
+			want:  []Message{{Channel: "/foo", Id: "2"}},
+			err:   true,
+		},
+		{
+			name:  "strict rejects missing channel",
+			mode:  Strict,
+			input: `[{"id":"1"}]`,
+			want:  []Message{},
+			err:   true,
+		},
+		{
+			name:  "strict rejects unwrapped messages",
+			mode:  Strict,
+			input: `{"channel":"/foo"}`,
+			err:   true,
+		},
+		{
+			name:  "strict rejects string booleans",
+			mode:  Strict,
+			input: `[{"channel":"/foo","successful":"true"}]`,
+			want:  []Message{},
+			err:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Parser{Mode: tt.mode}
+			got, err := p.Parse([]byte(tt.input))
+			if (err != nil) != tt.err {
+				t.Fatalf("Parse() error = %v, want error %v", err, tt.err)
+			}
+			if err != nil && !errors.Is(err, ErrMalformedMessage) {
+				t.Fatalf("expecting ErrMalformedMessage got: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Parse() = %+v, want %+v", got, tt.want)
+			}
+			if c := p.Coercions(); c != tt.coercions {
+				t.Fatalf("Coercions() = %+v, want %+v", c, tt.coercions)
+			}
+		})
+	}
+}
+
+func TestAdvise_UnmarshalJSON(t *testing.T) {
+	msgs, err := (&Parser{}).Parse([]byte(`[{"channel":"/meta/connect","advice":{"reconnect":"retry","interval":0,"timeout":45000,"hosts":["a","b"]}}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	advice := msgs[0].Advice
+	if advice.Reconnect != ReconnectRetry || advice.Timeout.Seconds() != 45 || !reflect.DeepEqual(advice.Hosts, []string{"a", "b"}) {
+		t.Fatalf("unexpected advice %+v", advice)
+	}
+
+	//wrong types are errors, not panics
+	if _, err = (&Parser{}).Parse([]byte(`[{"advice":{"interval":"soon"}}]`)); err == nil {
+		t.Fatal("expecting an error")
+	}
+}
+
+func TestParser_Numbers(t *testing.T) {
+	input := []byte(`[{"channel":"/foo","data":{"id":9007199254740993,"price":1.5,"list":[1]}}]`)
+	tests := []struct {
+		name string
+		mode NumberMode
+		want Data
+	}{
+		{
+			name: "float64",
+			mode: Float64,
+			want: map[string]interface{}{"id": float64(9007199254740992), "price": 1.5, "list": []interface{}{float64(1)}},
+		},
+		{
+			name: "json.Number",
+			mode: UseNumber,
+			want: map[string]interface{}{"id": json.Number("9007199254740993"), "price": json.Number("1.5"), "list": []interface{}{json.Number("1")}},
+		},
+		{
+			name: "preserve integers",
+			mode: PreserveIntegers,
+			want: map[string]interface{}{"id": int64(9007199254740993), "price": 1.5, "list": []interface{}{int64(1)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgs, err := (&Parser{Numbers: tt.mode}).Parse(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(msgs[0].Data, tt.want) {
+				t.Fatalf("Data = %#v, want %#v", msgs[0].Data, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessage_DecodeData(t *testing.T) {
+	type payload struct {
+		ID   int64  `json:"id"`
+		Text string `json:"text"`
+	}
+	input := []byte(`[{"channel":"/foo","data":{"id":9007199254740993,"text":"hello"}}]`)
+	tests := []struct {
+		name string
+		keep bool
+		want payload
+	}{
+		{"generic data", false, payload{ID: 9007199254740992, Text: "hello"}},
+		{"raw data", true, payload{ID: 9007199254740993, Text: "hello"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgs, err := (&Parser{KeepRawData: tt.keep}).Parse(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got payload
+			if err = msgs[0].DecodeData(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("expecting %+v got: %+v", tt.want, got)
+			}
+		})
+	}
+
+	var n int
+	if err := (&Message{Data: "text"}).DecodeData(&n); err == nil {
+		t.Fatal("expecting a decoding error")
+	}
+}
+
+func BenchmarkParser_Parse(b *testing.B) {
+	batch := []byte(`[{"channel":"/foo","id":"1","data":{"k":"v"}},{"channel":"/foo","id":"2","data":{"k":"v"}},` +
+		`{"channel":"/meta/connect","id":"3","successful":true,"clientId":"abc"}]`)
+	p := &Parser{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.Parse(batch); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+//ErrDropped is the outcome of a message dropped by a Pipe
+var ErrDropped = errors.New("message dropped by an extension")
+
+//Pipe is an extension in the style of the faye javascript client: it passes the message, modified or replaced,
+//to next to continue the chain, possibly later and from another goroutine, e.g. once a token is refreshed.
+//calling next with nil drops the message, next is called at most once.
+type Pipe interface {
+	Incoming(m *Message, next func(m *Message))
+	Outgoing(m *Message, next func(m *Message))
+}
+
+//AddedHook is implemented by the Pipes notified once they are added to a Pipeline, e.g. to start refreshing a token
+type AddedHook interface {
+	Added()
+}
+
+//RemovedHook is implemented by the Pipes notified once they are removed from a Pipeline, e.g. to stop the
+//goroutines started by Added
+type RemovedHook interface {
+	Removed()
+}
+
+//contextPipe is implemented by the pipes run with the context of the operation, see Extensions.Pipes
+type contextPipe interface {
+	incoming(ctx context.Context, m *Message, next func(m *Message))
+	outgoing(ctx context.Context, m *Message, next func(m *Message))
+}
+
+//extensionPipe adapts an extension of Extensions to a Pipe passing the message on once the extension ran
+type extensionPipe struct {
+	in, out ContextExtension
+}
+
+func (p *extensionPipe) Incoming(m *Message, next func(m *Message)) {
+	p.incoming(context.Background(), m, next)
+}
+
+func (p *extensionPipe) Outgoing(m *Message, next func(m *Message)) {
+	p.outgoing(context.Background(), m, next)
+}
+
+func (p *extensionPipe) incoming(ctx context.Context, m *Message, next func(m *Message)) {
+	if p.in != nil {
+		p.in(ctx, m)
+	}
+	next(m)
+}
+
+func (p *extensionPipe) outgoing(ctx context.Context, m *Message, next func(m *Message)) {
+	if p.out != nil {
+		p.out(ctx, m)
+	}
+	next(m)
+}
+
+//Pipeline is an ordered list of Pipes, which can be added and removed while messages flow through it
+type Pipeline struct {
+	mu    sync.RWMutex
+	pipes []Pipe
+}
+
+//Add appends pipe to the pipeline, the messages already in the pipeline don't go through it. pipe is notified
+//once added if it implements AddedHook
+func (p *Pipeline) Add(pipe Pipe) {
+	p.mu.Lock()
+	p.pipes = append(p.pipes, pipe)
+	p.mu.Unlock()
+	if hook, ok := pipe.(AddedHook); ok {
+		hook.Added()
+	}
+}
+
+//Remove removes the first occurrence of pipe, it returns false if pipe isn't part of the pipeline.
+//pipes are compared with ==, they are usually pointers. pipe is notified once removed if it implements RemovedHook
+func (p *Pipeline) Remove(pipe Pipe) bool {
+	p.mu.Lock()
+	removed := false
+	for i := range p.pipes {
+		if p.pipes[i] == pipe {
+			p.pipes = append(p.pipes[:i:i], p.pipes[i+1:]...)
+			removed = true
+			break
+		}
+	}
+	p.mu.Unlock()
+	if hook, ok := pipe.(RemovedHook); ok && removed {
+		hook.Removed()
+	}
+	return removed
+}
+
+//Len returns the number of pipes of the pipeline
+func (p *Pipeline) Len() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.pipes)
+}
+
+//Incoming passes m through the Incoming method of the pipes, then calls done with the resulting message.
+//done gets ErrDropped for a dropped message or a *PanicError for a panicking pipe. ctx is passed to the
+//extensions adapted by Extensions.Pipes
+func (p *Pipeline) Incoming(ctx context.Context, m *Message, done func(m *Message, err error)) {
+	p.run(ctx, m, false, done)
+}
+
+//Outgoing passes m through the Outgoing method of the pipes, see Incoming
+func (p *Pipeline) Outgoing(ctx context.Context, m *Message, done func(m *Message, err error)) {
+	p.run(ctx, m, true, done)
+}
+
+func (p *Pipeline) run(ctx context.Context, m *Message, outgoing bool, done func(m *Message, err error)) {
+	p.mu.RLock()
+	pipes := p.pipes
+	p.mu.RUnlock()
+	if len(pipes) == 0 {
+		done(m, nil)
+		return
+	}
+
+	var step func(i int, m *Message)
+	step = func(i int, m *Message) {
+		if m == nil {
+			done(nil, ErrDropped)
+			return
+		}
+		if i == len(pipes) {
+			done(m, nil)
+			return
+		}
+		var once sync.Once
+		next := func(m *Message) {
+			once.Do(func() { step(i+1, m) })
+		}
+		err := CatchPanic(func() {
+			cp, withContext := pipes[i].(contextPipe)
+			switch {
+			case withContext && outgoing:
+				cp.outgoing(ctx, m, next)
+			case withContext:
+				cp.incoming(ctx, m, next)
+			case outgoing:
+				pipes[i].Outgoing(m, next)
+			default:
+				pipes[i].Incoming(m, next)
+			}
+		})
+		if err != nil {
+			once.Do(func() { done(nil, err) })
+		}
+	}
+	step(0, m)
+}
+
+//Await runs m through run with ctx, e.g. Pipeline.Outgoing, and waits for the outcome until ctx is done
+func Await(ctx context.Context, m *Message, run func(ctx context.Context, m *Message, done func(m *Message, err error))) (*Message, error) {
+	type outcome struct {
+		m   *Message
+		err error
+	}
+	outcomes := make(chan outcome, 1)
+	run(ctx, m, func(m *Message, err error) {
+		outcomes <- outcome{m, err}
+	})
+	select {
+	case o := <-outcomes:
+		return o.m, o.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,129 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+//funcPipe adapts a function to both directions of a Pipe
+type funcPipe func(m *Message, next func(m *Message))
+
+func (p funcPipe) Incoming(m *Message, next func(m *Message)) { p(m, next) }
+func (p funcPipe) Outgoing(m *Message, next func(m *Message)) { p(m, next) }
+
+func TestPipeline(t *testing.T) {
+	appendData := func(s string) *funcPipe {
+		p := funcPipe(func(m *Message, next func(m *Message)) {
+			m.Data = m.Data.(string) + s
+			next(m)
+		})
+		return &p
+	}
+	async := funcPipe(func(m *Message, next func(m *Message)) {
+		go next(&Message{Channel: m.Channel, Data: m.Data.(string) + "-async"})
+	})
+	drop := funcPipe(func(m *Message, next func(m *Message)) {
+		next(nil)
+	})
+	panics := funcPipe(func(m *Message, next func(m *Message)) {
+		panic("boom")
+	})
+
+	a, b := appendData("-a"), appendData("-b")
+	tests := []struct {
+		name  string
+		pipes []Pipe
+		want  string
+		err   error
+	}{
+		{name: "empty", want: "m"},
+		{name: "ordered", pipes: []Pipe{a, b}, want: "m-a-b"},
+		{name: "async", pipes: []Pipe{a, &async, b}, want: "m-a-async-b"},
+		{name: "dropped", pipes: []Pipe{a, &drop, b}, err: ErrDropped},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p Pipeline
+			for i := range tt.pipes {
+				p.Add(tt.pipes[i])
+			}
+			m, err := Await(context.Background(), &Message{Data: "m"}, p.Outgoing)
+			if err != tt.err {
+				t.Fatalf("expecting error %v got: %v", tt.err, err)
+			}
+			if err == nil && m.Data != tt.want {
+				t.Fatalf("expecting %s got: %v", tt.want, m.Data)
+			}
+		})
+	}
+
+	var p Pipeline
+	p.Add(&panics)
+	var panicErr *PanicError
+	if _, err := Await(context.Background(), &Message{Data: "m"}, p.Incoming); !errors.As(err, &panicErr) {
+		t.Fatalf("expecting a *PanicError got: %v", err)
+	}
+	if !p.Remove(&panics) || p.Remove(&panics) {
+		t.Fatal("expecting the pipe to be removed once")
+	}
+}
+
+//hookedPipe records its Added and Removed notifications
+type hookedPipe struct {
+	funcPipe
+	hooks []string
+}
+
+func (p *hookedPipe) Added()   { p.hooks = append(p.hooks, "added") }
+func (p *hookedPipe) Removed() { p.hooks = append(p.hooks, "removed") }
+
+func TestPipeline_Extensions(t *testing.T) {
+	type key struct{}
+	var p Pipeline
+	exts := Extensions{
+		In: []ContextExtension{func(ctx context.Context, m *Message) {
+			m.Data = m.Data.(string) + "-" + ctx.Value(key{}).(string)
+		}},
+		Out: []ContextExtension{func(ctx context.Context, m *Message) {
+			m.Data = m.Data.(string) + "-out"
+		}},
+	}
+	for _, pipe := range exts.Pipes() {
+		p.Add(pipe)
+	}
+	hooked := &hookedPipe{funcPipe: func(m *Message, next func(m *Message)) {
+		next(&Message{Data: m.Data.(string) + "-pipe"})
+	}}
+	p.Add(hooked)
+
+	//the extensions run in the same pipeline, with the context of the operation
+	ctx := context.WithValue(context.Background(), key{}, "ctx")
+	m, err := Await(ctx, &Message{Data: "m"}, p.Incoming)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Data != "m-ctx-pipe" {
+		t.Fatalf("expecting m-ctx-pipe got: %v", m.Data)
+	}
+	if m, _ = Await(ctx, &Message{Data: "m"}, p.Outgoing); m.Data != "m-out-pipe" {
+		t.Fatalf("expecting m-out-pipe got: %v", m.Data)
+	}
+
+	p.Remove(hooked)
+	p.Remove(hooked)
+	if len(hooked.hooks) != 2 || hooked.hooks[0] != "added" || hooked.hooks[1] != "removed" {
+		t.Fatalf("expecting the pipe notified once added and removed got: %v", hooked.hooks)
+	}
+}
+
+func TestAwait_ContextDone(t *testing.T) {
+	var p Pipeline
+	p.Add(funcPipe(func(m *Message, next func(m *Message)) {}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Await(ctx, &Message{}, p.Outgoing); err != context.Canceled {
+		t.Fatalf("expecting context.Canceled got: %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+//Package metrics defines the instrumentation of the client, see fayec.WithMetrics and the prometheus adapter.
+package metrics
+
+import (
+	"time"
+)
+
+//Collector receives the measures of a client. the methods are called from the goroutines of the client and
+//must not block, a collector can be shared by many clients.
+type Collector interface {
+	//MessageSent counts a message sent to the server, every message of a batch is counted
+	MessageSent()
+	//MessageReceived counts a message received from the server
+	MessageReceived()
+	//PublishAcknowledged observes the latency of a publish, from the request to the server acknowledgement
+	PublishAcknowledged(latency time.Duration)
+	//Reconnected counts a connection restored after it was lost
+	Reconnected()
+	//AddSubscriptions adds delta, possibly negative, to the current number of subscriptions
+	AddSubscriptions(delta int)
+	//AddQueued adds delta, possibly negative, to the number of messages waiting in the outgoing queue
+	AddQueued(delta int)
+}
+
+//Nop discards the measures
+type Nop struct{}
+
+func (Nop) MessageSent()                              {}
+func (Nop) MessageReceived()                          {}
+func (Nop) PublishAcknowledged(latency time.Duration) {}
+func (Nop) Reconnected()                              {}
+func (Nop) AddSubscriptions(delta int)                {}
+func (Nop) AddQueued(delta int)                       {}
+
+var _ Collector = Nop{}
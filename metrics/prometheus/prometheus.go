@@ -0,0 +1,93 @@
+//Package prometheus exposes the metrics of the clients to prometheus:
+//
+//	collector, err := prometheus.New(prom.DefaultRegisterer)
+//	client, err := fayec.NewClient(url, fayec.WithMetrics(collector))
+package prometheus
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/thesyncim/faye/metrics"
+	"time"
+)
+
+const namespace = "fayec"
+
+//Collector is a metrics.Collector updating prometheus metrics, shared by the clients using it
+type Collector struct {
+	sent          prometheus.Counter
+	received      prometheus.Counter
+	publishes     prometheus.Histogram
+	reconnects    prometheus.Counter
+	subscriptions prometheus.Gauge
+	queued        prometheus.Gauge
+}
+
+var _ metrics.Collector = (*Collector)(nil)
+
+//New creates a collector and registers its metrics to reg, e.g. prometheus.DefaultRegisterer.
+//use prometheus.WrapRegistererWith to tell several collectors apart with labels.
+func New(reg prometheus.Registerer) (*Collector, error) {
+	c := &Collector{
+		sent: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_sent_total",
+			Help:      "Number of messages sent to the server.",
+		}),
+		received: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_received_total",
+			Help:      "Number of messages received from the server.",
+		}),
+		publishes: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "publish_latency_seconds",
+			Help:      "Latency of the publishes, from the request to the server acknowledgement.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		reconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "reconnects_total",
+			Help:      "Number of connections restored after they were lost.",
+		}),
+		subscriptions: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "subscriptions",
+			Help:      "Number of active subscriptions.",
+		}),
+		queued: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "queued_messages",
+			Help:      "Number of messages waiting in the outgoing queue while reconnecting.",
+		}),
+	}
+	for _, collector := range []prometheus.Collector{c.sent, c.received, c.publishes, c.reconnects, c.subscriptions, c.queued} {
+		if err := reg.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *Collector) MessageSent() {
+	c.sent.Inc()
+}
+
+func (c *Collector) MessageReceived() {
+	c.received.Inc()
+}
+
+func (c *Collector) PublishAcknowledged(latency time.Duration) {
+	c.publishes.Observe(latency.Seconds())
+}
+
+func (c *Collector) Reconnected() {
+	c.reconnects.Inc()
+}
+
+func (c *Collector) AddSubscriptions(delta int) {
+	c.subscriptions.Add(float64(delta))
+}
+
+func (c *Collector) AddQueued(delta int) {
+	c.queued.Add(float64(delta))
+}
@@ -0,0 +1,55 @@
+package prometheus
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollector(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	c, err := New(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.MessageSent()
+	c.MessageSent()
+	c.MessageReceived()
+	c.PublishAcknowledged(20 * time.Millisecond)
+	c.Reconnected()
+	c.AddSubscriptions(3)
+	c.AddSubscriptions(-1)
+	c.AddQueued(2)
+
+	expected := `
+# HELP fayec_messages_sent_total Number of messages sent to the server.
+# TYPE fayec_messages_sent_total counter
+fayec_messages_sent_total 2
+# HELP fayec_messages_received_total Number of messages received from the server.
+# TYPE fayec_messages_received_total counter
+fayec_messages_received_total 1
+# HELP fayec_reconnects_total Number of connections restored after they were lost.
+# TYPE fayec_reconnects_total counter
+fayec_reconnects_total 1
+# HELP fayec_subscriptions Number of active subscriptions.
+# TYPE fayec_subscriptions gauge
+fayec_subscriptions 2
+# HELP fayec_queued_messages Number of messages waiting in the outgoing queue while reconnecting.
+# TYPE fayec_queued_messages gauge
+fayec_queued_messages 2
+`
+	names := []string{"fayec_messages_sent_total", "fayec_messages_received_total", "fayec_reconnects_total", "fayec_subscriptions", "fayec_queued_messages"}
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), names...); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := testutil.GatherAndCount(reg, "fayec_publish_latency_seconds"); err != nil || n != 1 {
+		t.Fatalf("expecting the publish latency observed got: %d %v", n, err)
+	}
+
+	//the metrics are registered once
+	if _, err := New(reg); err == nil {
+		t.Fatal("expecting the duplicate registration to fail")
+	}
+}
@@ -0,0 +1,111 @@
+package fayec
+
+import (
+	"context"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/subscription"
+	"time"
+)
+
+//OperationKind identifies a client operation
+type OperationKind int
+
+const (
+	//OpSubscribe is a Subscribe, the middlewares can read the resulting Request.Subscription
+	OpSubscribe OperationKind = iota
+	//OpUnsubscribe is an Unsubscribe or UnsubscribeAll of the Request.Channel pattern
+	OpUnsubscribe
+	//OpPublish is a Publish or PublishWithTimeout
+	OpPublish
+)
+
+func (k OperationKind) String() string {
+	switch k {
+	case OpSubscribe:
+		return "subscribe"
+	case OpUnsubscribe:
+		return "unsubscribe"
+	case OpPublish:
+		return "publish"
+	default:
+		return "unknown"
+	}
+}
+
+//Request represents a client operation passed through the middlewares
+type Request struct {
+	Kind    OperationKind
+	Channel Channel
+	//Data is the published data, publish only
+	Data message.Data
+	//Timeout is the publish acknowledgement timeout, zero waits forever
+	Timeout time.Duration
+	//RequireAck waits for the publish acknowledgement even if the channel is configured to skip it
+	RequireAck bool
+
+	//Middlewares are run on the messages of the subscription, subscribe only, see WithSubscriptionMiddleware
+	Middlewares []subscription.Middleware
+	//ResubscribePolicy overrides the policy of the client for the subscription, subscribe only, see
+	//WithSubscriptionResubscribePolicy
+	ResubscribePolicy subscription.ResubscribePolicy
+	//Delivery is the delivery guarantee of the subscription, subscribe only, see WithDelivery
+	Delivery subscription.DeliveryMode
+	//PauseMode is what happens to the messages of the subscription while paused, subscribe only, see WithPauseMode
+	PauseMode subscription.PauseMode
+	//Lifetime removes the subscription once done, subscribe only, see WithLifetime
+	Lifetime context.Context
+
+	//Subscription is set by a successful subscribe
+	Subscription *subscription.Subscription
+}
+
+//Operation performs a client operation
+type Operation func(ctx context.Context, req *Request) error
+
+//Middleware wraps an operation, e.g. to retry, log or measure it, calling next to continue the chain
+type Middleware func(next Operation) Operation
+
+//chain wraps op with the middlewares, the first middleware is the outermost
+func chain(op Operation, middlewares []Middleware) Operation {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		op = middlewares[i](op)
+	}
+	return op
+}
+
+//operation performs the request on the dispatcher, it is the innermost operation of the chain
+func (c *Client) operation(ctx context.Context, req *Request) (err error) {
+	switch req.Kind {
+	case OpSubscribe:
+		req.Subscription, err = c.dispatcher.SubscribeDelivery(ctx, string(req.Channel), req.Delivery, req.Middlewares...)
+		if err == nil {
+			req.Subscription.SetResubscribePolicy(req.ResubscribePolicy)
+			req.Subscription.SetPauseMode(req.PauseMode)
+			if req.Lifetime != nil {
+				c.dispatcher.UnsubscribeOnDone(req.Lifetime, req.Subscription)
+			}
+		}
+	case OpUnsubscribe:
+		err = c.dispatcher.UnsubscribePattern(string(req.Channel))
+	case OpPublish:
+		if req.RequireAck {
+			err = c.dispatcher.PublishWithAck(ctx, string(req.Channel), req.Data, req.Timeout)
+		} else {
+			err = c.dispatcher.PublishCtx(ctx, string(req.Channel), req.Data, req.Timeout)
+		}
+	}
+	return err
+}
+
+//do runs the request through the middlewares
+func (c *Client) do(ctx context.Context, req *Request) error {
+	return c.op(ctx, req)
+}
+
+//WithMiddleware appends middlewares run around every Subscribe, Unsubscribe and Publish,
+//the first middleware provided is the outermost.
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(o *options) {
+		o.middlewares = append(o.middlewares, middlewares...)
+	}
+}
@@ -0,0 +1,47 @@
+package fayec
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next Operation) Operation {
+			return func(ctx context.Context, req *Request) error {
+				calls = append(calls, name+" "+req.Kind.String())
+				return next(ctx, req)
+			}
+		}
+	}
+	errPublish := errors.New("publish failed")
+	retry := func(next Operation) Operation {
+		return func(ctx context.Context, req *Request) error {
+			err := next(ctx, req)
+			if err != nil {
+				err = next(ctx, req)
+			}
+			return err
+		}
+	}
+
+	attempts := 0
+	op := chain(func(ctx context.Context, req *Request) error {
+		attempts++
+		if attempts == 1 {
+			return errPublish
+		}
+		return nil
+	}, []Middleware{trace("outer"), retry, trace("inner")})
+
+	if err := op(context.Background(), &Request{Kind: OpPublish, Channel: "/foo"}); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"outer publish", "inner publish", "inner publish"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("expecting %v got: %v", expected, calls)
+	}
+}
@@ -0,0 +1,24 @@
+package fayec
+
+import (
+	"fmt"
+	"net/http"
+)
+
+//ReadyHandler returns an http.Handler answering 200 while the client is connected and the subscriptions to the
+//required channels are active, 503 otherwise, e.g. to gate a Kubernetes readiness probe on the faye connection.
+func (c *Client) ReadyHandler(required ...Channel) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !c.dispatcher.Connected() {
+			http.Error(w, "not connected", http.StatusServiceUnavailable)
+			return
+		}
+		for _, ch := range required {
+			if !c.dispatcher.SubscriptionActive(string(ch)) {
+				http.Error(w, fmt.Sprintf("subscription `%s` not active", ch), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		w.Write([]byte("ready"))
+	})
+}
@@ -0,0 +1,42 @@
+package fayec
+
+import (
+	"github.com/thesyncim/faye/internal/dispatcher"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClient_ReadyHandler(t *testing.T) {
+	at := &ackTransport{}
+	d := dispatcher.NewDispatcher("fake://", transport.Options{}, message.Extensions{})
+	d.SetTransport(at)
+	c := &Client{dispatcher: d}
+	ready := c.ReadyHandler("/foo")
+
+	probe := func(expected int) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		ready.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+		if rec.Code != expected {
+			t.Fatalf("expecting status %d got: %d %s", expected, rec.Code, rec.Body)
+		}
+	}
+
+	//no handshake yet
+	probe(http.StatusServiceUnavailable)
+	at.clientID = "ack-client"
+	//the required subscription is missing
+	probe(http.StatusServiceUnavailable)
+	sub, err := d.Subscribe("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	probe(http.StatusOK)
+	if err = sub.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	probe(http.StatusServiceUnavailable)
+}
@@ -0,0 +1,66 @@
+package statestore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+//File is a Store keeping the state in a json file, replaced atomically on every save
+type File struct {
+	path string
+	mu   sync.Mutex
+}
+
+var _ Store = (*File)(nil)
+
+//NewFile creates a File store saving the state at path, its directory must exist
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+func (f *File) Load() (*State, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	b, err := os.ReadFile(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &State{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state State
+	if err = json.Unmarshal(b, &state); err != nil {
+		return nil, fmt.Errorf("statestore: %s: %w", f.path, err)
+	}
+	return &state, nil
+}
+
+func (f *File) Save(state *State) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("statestore: %w", err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	//written aside then renamed, a crash never leaves a truncated state
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(b); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
@@ -0,0 +1,67 @@
+//Package statestore persists the state of a client, so a restarted process resumes its subscriptions where it
+//left off, see fayec.NewClientFromState. Memory keeps it in the process, e.g. for the tests, File in a json file.
+package statestore
+
+import (
+	"github.com/thesyncim/faye/message"
+	"sync"
+)
+
+//State is the state of a client needed to resume it
+type State struct {
+	//Subscriptions are the channels subscribed
+	Subscriptions []string `json:"subscriptions,omitempty"`
+	//ReplayIDs are the ids of the last messages delivered by channel, the server replays the following ones
+	ReplayIDs map[string]string `json:"replayIds,omitempty"`
+	//Pending are the publishes not sent yet, waiting for the connection to be restored
+	Pending []*message.Message `json:"pending,omitempty"`
+}
+
+//Store saves and loads the state of a client, its methods are called concurrently
+type Store interface {
+	//Load returns the state saved, an empty state if none was
+	Load() (*State, error)
+	//Save replaces the state saved
+	Save(state *State) error
+}
+
+//Memory is a Store keeping the state in memory
+type Memory struct {
+	mu    sync.Mutex
+	state State
+}
+
+var _ Store = (*Memory)(nil)
+
+//NewMemory creates an empty Memory store
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Load() (*State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state.clone(), nil
+}
+
+func (m *Memory) Save(state *State) error {
+	m.mu.Lock()
+	m.state = *state.clone()
+	m.mu.Unlock()
+	return nil
+}
+
+//clone copies the state, the messages are shared
+func (s *State) clone() *State {
+	c := &State{
+		Subscriptions: append([]string(nil), s.Subscriptions...),
+		Pending:       append([]*message.Message(nil), s.Pending...),
+	}
+	if s.ReplayIDs != nil {
+		c.ReplayIDs = make(map[string]string, len(s.ReplayIDs))
+		for channel, id := range s.ReplayIDs {
+			c.ReplayIDs[channel] = id
+		}
+	}
+	return c
+}
@@ -0,0 +1,62 @@
+package statestore
+
+import (
+	"github.com/thesyncim/faye/message"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name  string
+		store Store
+	}{
+		{name: "memory", store: NewMemory()},
+		{name: "file", store: NewFile(filepath.Join(dir, "state.json"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, err := tt.store.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(state, &State{}) {
+				t.Fatalf("expecting an empty state got: %+v", state)
+			}
+			saved := &State{
+				Subscriptions: []string{"/foo", "/bar/*"},
+				ReplayIDs:     map[string]string{"/foo": "42"},
+				Pending:       []*message.Message{{Channel: "/foo", Data: "bar"}},
+			}
+			if err = tt.store.Save(saved); err != nil {
+				t.Fatal(err)
+			}
+			//the store keeps its own copy
+			saved.ReplayIDs["/foo"] = "43"
+			if state, err = tt.store.Load(); err != nil {
+				t.Fatal(err)
+			}
+			expected := &State{
+				Subscriptions: []string{"/foo", "/bar/*"},
+				ReplayIDs:     map[string]string{"/foo": "42"},
+				Pending:       []*message.Message{{Channel: "/foo", Data: "bar"}},
+			}
+			if !reflect.DeepEqual(state, expected) {
+				t.Fatalf("expecting %+v got: %+v", expected, state)
+			}
+		})
+	}
+}
+
+func TestFile_Corrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFile(path).Load(); err == nil {
+		t.Fatal("expecting an error")
+	}
+}
@@ -0,0 +1,112 @@
+package subscription
+
+//PauseMode decides what happens to the messages of a paused subscription, see Pause
+type PauseMode int
+
+const (
+	//PauseBuffer keeps queuing the messages while paused, up to the buffer of the channel config, the overflow
+	//policy of the channel applies beyond. this is the default mode
+	PauseBuffer PauseMode = iota
+	//PauseUnsubscribe unsubscribes the channel on the server once all its subscriptions are paused, and subscribes
+	//it again when one resumes. the messages published meanwhile are missed, unless replayed, see AtLeastOnce
+	PauseUnsubscribe
+)
+
+//Pauser advises the server that the subscription is paused or resumed, it is set by the client
+type Pauser func(sub *Subscription, paused bool) error
+
+//pausing is the pause state of a subscription, guarded by mu
+type pausing struct {
+	mode   PauseMode
+	pauser Pauser
+	paused bool
+	//onServer is set while the subscription is paused with PauseUnsubscribe
+	onServer bool
+	//resumed is closed by Resume
+	resumed chan struct{}
+}
+
+//SetPauseMode sets what happens to the messages received while the subscription is paused, PauseBuffer by
+//default. it applies to the next Pause
+func (s *Subscription) SetPauseMode(mode PauseMode) {
+	s.mu.Lock()
+	s.pause.mode = mode
+	s.mu.Unlock()
+}
+
+//SetPauser sets the function advising the server of the pauses in PauseUnsubscribe mode
+func (s *Subscription) SetPauser(pauser Pauser) {
+	s.mu.Lock()
+	s.pause.pauser = pauser
+	s.mu.Unlock()
+}
+
+//Pause stops calling the handlers until Resume, e.g. while the application catches up with an expensive
+//processing. the messages received meanwhile are handled according to the PauseMode. pausing a paused or
+//removed subscription does nothing
+func (s *Subscription) Pause() error {
+	s.mu.Lock()
+	if s.pause.paused || s.state >= StateUnsubscribing {
+		s.mu.Unlock()
+		return nil
+	}
+	p := &s.pause
+	p.paused = true
+	p.resumed = make(chan struct{})
+	p.onServer = p.mode == PauseUnsubscribe && p.pauser != nil
+	onServer, pauser := p.onServer, p.pauser
+	s.mu.Unlock()
+	if onServer {
+		return pauser(s, true)
+	}
+	return nil
+}
+
+//Resume calls the handlers again with the messages of a paused subscription, the ones queued first
+func (s *Subscription) Resume() error {
+	s.mu.Lock()
+	p := &s.pause
+	if !p.paused {
+		s.mu.Unlock()
+		return nil
+	}
+	p.paused = false
+	close(p.resumed)
+	onServer, pauser := p.onServer, p.pauser
+	p.onServer = false
+	s.mu.Unlock()
+	if onServer {
+		return pauser(s, false)
+	}
+	return nil
+}
+
+//Paused reports whether the subscription is paused
+func (s *Subscription) Paused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pause.paused
+}
+
+//PausedOnServer reports whether the subscription is paused in PauseUnsubscribe mode
+func (s *Subscription) PausedOnServer() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pause.onServer
+}
+
+//awaitResume waits while the subscription is paused, it returns false once the subscription is removed
+func (s *Subscription) awaitResume() bool {
+	s.mu.Lock()
+	paused, resumed := s.pause.paused, s.pause.resumed
+	s.mu.Unlock()
+	if !paused {
+		return true
+	}
+	select {
+	case <-resumed:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,151 @@
+package subscription
+
+import (
+	"github.com/thesyncim/faye/message"
+	"time"
+)
+
+//shaping limits the rate at which OnMessage and OnMessageErr deliver the messages, see Throttle, Debounce and Conflate
+type shaping struct {
+	throttle time.Duration
+	debounce time.Duration
+	key      func(msg *message.Message) string
+
+	//pending holds the messages received and not delivered yet, at most one per key
+	pending   []*message.Message
+	lastSent  time.Time
+	msgClosed bool
+}
+
+//Throttle makes the handlers process at most one message every interval, the latest one received meanwhile
+//(the latest of each key when conflating). 0 disables it. it must be set before the handlers run.
+func (s *Subscription) Throttle(interval time.Duration) {
+	s.mu.Lock()
+	s.shaping.throttle = interval
+	s.mu.Unlock()
+}
+
+//Debounce makes the handlers process a message only once no other message was received for quiet,
+//the previous ones are discarded (the previous ones of the same key when conflating). 0 disables it.
+//it must be set before the handlers run.
+func (s *Subscription) Debounce(quiet time.Duration) {
+	s.mu.Lock()
+	s.shaping.debounce = quiet
+	s.mu.Unlock()
+}
+
+//Conflate replaces the messages waiting for the handlers with the newer ones of the same key, e.g. the
+//latest price of each symbol, so a slow handler skips the stale updates. it must be set before the handlers run.
+func (s *Subscription) Conflate(key func(msg *message.Message) string) {
+	s.mu.Lock()
+	s.shaping.key = key
+	s.mu.Unlock()
+}
+
+//shaped reports whether the deliveries are shaped
+func (s *Subscription) shaped() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.shaping.throttle > 0 || s.shaping.debounce > 0 || s.shaping.key != nil
+}
+
+//nextShaped returns the next message according to the shaping, ok is false once the subscription is removed
+//and the pending messages are delivered
+func (s *Subscription) nextShaped() (msg *message.Message, ok bool) {
+	s.mu.Lock()
+	throttle, debounce := s.shaping.throttle, s.shaping.debounce
+	s.mu.Unlock()
+	sh := &s.shaping
+
+	s.drain()
+	if len(sh.pending) == 0 {
+		if !s.receive(nil) {
+			return nil, false
+		}
+	}
+	for received := debounce > 0; received; {
+		quiet := time.NewTimer(debounce)
+		received = s.receive(quiet.C)
+		quiet.Stop()
+	}
+	if wait := time.Until(sh.lastSent.Add(throttle)); throttle > 0 && wait > 0 {
+		window := time.NewTimer(wait)
+		for s.receive(window.C) {
+		}
+		window.Stop()
+	}
+	if s.ctx.Err() != nil || len(sh.pending) == 0 {
+		return nil, false
+	}
+	msg = sh.pending[0]
+	sh.pending = sh.pending[1:]
+	sh.lastSent = time.Now()
+	return msg, true
+}
+
+//receive waits for a message until timeout fires, it returns false on timeout, or once the subscription is removed.
+//once the message channel is closed only the timeout is waited for.
+func (s *Subscription) receive(timeout <-chan time.Time) bool {
+	msgCh := s.msgCh
+	if s.shaping.msgClosed {
+		if timeout == nil {
+			return false
+		}
+		msgCh = nil
+	}
+	if s.ctx.Err() != nil {
+		return false
+	}
+	select {
+	case <-s.ctx.Done():
+		return false
+	case <-timeout:
+		return false
+	case msg, ok := <-msgCh:
+		if !ok {
+			s.shaping.msgClosed = true
+			return false
+		}
+		s.merge(msg)
+		return true
+	}
+}
+
+//drain merges the messages already queued without waiting
+func (s *Subscription) drain() {
+	for !s.shaping.msgClosed {
+		select {
+		case msg, ok := <-s.msgCh:
+			if !ok {
+				s.shaping.msgClosed = true
+				return
+			}
+			s.merge(msg)
+		default:
+			return
+		}
+	}
+}
+
+//merge adds msg to the pending messages, replacing the one with the same key. without a key function all
+//the messages share the same key, errors are never replaced.
+func (s *Subscription) merge(msg *message.Message) {
+	sh := &s.shaping
+	if msg.GetError() == nil {
+		key := sh.keyOf(msg)
+		for i := range sh.pending {
+			if sh.pending[i].GetError() == nil && sh.keyOf(sh.pending[i]) == key {
+				sh.pending[i] = msg
+				return
+			}
+		}
+	}
+	sh.pending = append(sh.pending, msg)
+}
+
+func (sh *shaping) keyOf(msg *message.Message) string {
+	if sh.key == nil {
+		return ""
+	}
+	return sh.key(msg)
+}
@@ -0,0 +1,109 @@
+package subscription
+
+import (
+	"github.com/thesyncim/faye/message"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newShapedSubscription(t *testing.T, size int) (*Subscription, chan *message.Message) {
+	msgCh := make(chan *message.Message, size)
+	var sub *Subscription
+	sub, err := NewSubscription("/prices", func(*Subscription) error {
+		sub.SetState(StateClosed)
+		return nil
+	}, msgCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sub, msgCh
+}
+
+func price(symbol string, value int) *message.Message {
+	return &message.Message{Channel: "/prices", Data: map[string]interface{}{"symbol": symbol, "value": value}}
+}
+
+func TestSubscription_Conflate(t *testing.T) {
+	sub, msgCh := newShapedSubscription(t, 5)
+	sub.Conflate(func(msg *message.Message) string {
+		return msg.Data.(map[string]interface{})["symbol"].(string)
+	})
+	msgCh <- price("a", 1)
+	msgCh <- price("b", 1)
+	msgCh <- price("a", 2)
+	msgCh <- price("b", 2)
+	msgCh <- price("a", 3)
+	close(msgCh)
+
+	var handled []message.Data
+	err := sub.OnMessage(func(channel string, data message.Data) {
+		handled = append(handled, data)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []message.Data{price("a", 3).Data, price("b", 2).Data}
+	if !reflect.DeepEqual(handled, expected) {
+		t.Fatalf("expecting the latest of each key %v got: %v", expected, handled)
+	}
+}
+
+func TestSubscription_Throttle(t *testing.T) {
+	sub, msgCh := newShapedSubscription(t, 5)
+	sub.Throttle(50 * time.Millisecond)
+	msgCh <- price("a", 1)
+
+	var (
+		handled []message.Data
+		times   []time.Time
+	)
+	err := sub.OnMessage(func(channel string, data message.Data) {
+		handled = append(handled, data)
+		times = append(times, time.Now())
+		if len(handled) == 1 {
+			msgCh <- price("a", 2)
+			msgCh <- price("a", 3)
+			close(msgCh)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []message.Data{price("a", 1).Data, price("a", 3).Data}
+	if !reflect.DeepEqual(handled, expected) {
+		t.Fatalf("expecting %v got: %v", expected, handled)
+	}
+	if gap := times[1].Sub(times[0]); gap < 45*time.Millisecond {
+		t.Fatalf("expecting the deliveries throttled got a gap of %v", gap)
+	}
+}
+
+func TestSubscription_Debounce(t *testing.T) {
+	sub, msgCh := newShapedSubscription(t, 5)
+	sub.Debounce(30 * time.Millisecond)
+	msgCh <- price("a", 1)
+	msgCh <- price("a", 2)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		msgCh <- price("a", 3)
+	}()
+
+	start := time.Now()
+	var handled []message.Data
+	err := sub.OnMessage(func(channel string, data message.Data) {
+		handled = append(handled, data)
+		if err := sub.Unsubscribe(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []message.Data{price("a", 3).Data}; !reflect.DeepEqual(handled, expected) {
+		t.Fatalf("expecting only the last message %v got: %v", expected, handled)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Fatalf("expecting the delivery after the quiet period got: %v", elapsed)
+	}
+}
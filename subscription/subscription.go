@@ -1,19 +1,140 @@
 package subscription
 
 import (
-	"errors"
+	"context"
+	"fmt"
+	"github.com/thesyncim/faye/channel"
 	"github.com/thesyncim/faye/message"
-	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-var ErrInvalidChannelName = errors.New("invalid channel channel")
+var ErrInvalidChannelName = channel.ErrInvalidChannel
 
 type Unsubscriber func(subscription *Subscription) error
 
+//ErrorPolicy decides what happens to a subscription when its handler returns an error
+type ErrorPolicy int
+
+const (
+	//CancelOnError unsubscribes when the handler returns an error, this is the default policy
+	CancelOnError ErrorPolicy = iota
+	//PauseOnError stops consuming the messages, the subscription stays registered and
+	//the delivery resumes on the next call to OnMessageErr. messages received meanwhile are
+	//queued or dropped according to the channel config.
+	PauseOnError
+)
+
+//ResubscribePolicy decides what happens to a subscription when the server rejects its channel while it is
+//restored on a new session, e.g. after a reconnect: the authorization expired or the channel was deleted
+type ResubscribePolicy int
+
+const (
+	//ResubscribeDefault applies the policy of the client, this is the default of the subscriptions
+	ResubscribeDefault ResubscribePolicy = iota
+	//DropOnReject closes the subscription with the error, reported to the error handlers, this is the default
+	//policy of the client
+	DropOnReject
+	//FailOnReject terminates the client with the error, as if it gave up reconnecting
+	FailOnReject
+	//RetryOnReject keeps the subscription and subscribes again at the pace of the retry policy of the client,
+	//until the server accepts it, the policy gives up or the subscription is removed. every rejection is
+	//reported to the error handlers
+	RetryOnReject
+)
+
+//DeliveryMode is the delivery guarantee of a subscription
+type DeliveryMode int
+
+const (
+	//AtMostOnce delivers the messages as received, the ones published while the connection is lost are missed.
+	//this is the default mode
+	AtMostOnce DeliveryMode = iota
+	//AtLeastOnce requests the messages following the last one delivered when the channel is subscribed again,
+	//from servers supporting the replay extension, and drops the duplicates by message id
+	AtLeastOnce
+)
+
+//State represents the lifecycle of a subscription
+type State int32
+
+const (
+	//StatePending the subscription waits for the server confirmation
+	StatePending State = iota
+	//StateActive the server confirmed the subscription, messages are delivered
+	StateActive
+	//StateUnsubscribing the subscription was removed, the server confirmation is pending
+	StateUnsubscribing
+	//StateClosed the subscription was removed or torn down by the server, its message channel is closed
+	StateClosed
+)
+
+func (s State) String() string {
+	switch s {
+	case StatePending:
+		return "pending"
+	case StateActive:
+		return "active"
+	case StateUnsubscribing:
+		return "unsubscribing"
+	case StateClosed:
+		return "closed"
+	}
+	return fmt.Sprintf("State(%d)", int32(s))
+}
+
+//MarshalText encodes the state as its name, e.g. in the json of the Info
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
 type Subscription struct {
 	channel string
 	unsub   Unsubscriber
 	msgCh   chan *message.Message
+	//sending is held by the deliveries to msgCh, closing wakes the blocked ones before msgCh is closed, see Queue
+	sending   sync.RWMutex
+	closing   chan struct{}
+	closeOnce sync.Once
+
+	mu          sync.Mutex
+	errorPolicy ErrorPolicy
+	resubscribe ResubscribePolicy
+	delivery    DeliveryMode
+	err         error
+	state       State
+	done        chan struct{}
+	//closeErr is why the subscription was closed, see Close
+	closeErr error
+	onError  []func(err error)
+	//shaping settings are guarded by mu, its state is owned by the handler loop
+	shaping shaping
+	pause   pausing
+	filter  func(msg *message.Message) bool
+	//middlewares are run on the messages accepted by the filter, see Use
+	middlewares []Middleware
+
+	//ctx is canceled once the subscription is removed
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	created   time.Time
+	delivered int64
+}
+
+//Info is a snapshot of a subscription, see Subscription.Info
+type Info struct {
+	//Channel is the channel subscribed
+	Channel string
+	//State is the state of the subscription when the snapshot was taken
+	State State
+	//Created is when the subscription was created
+	Created time.Time
+	//Messages is the number of messages delivered to the subscription
+	Messages int64
+	//Paused is set while the subscription is paused, see Subscription.Pause
+	Paused bool
 }
 
 //todo error
@@ -21,47 +142,396 @@ func NewSubscription(chanel string, unsub Unsubscriber, msgCh chan *message.Mess
 	if !IsValidSubscriptionName(chanel) {
 		return nil, ErrInvalidChannelName
 	}
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Subscription{
 		channel: chanel,
 		unsub:   unsub,
 		msgCh:   msgCh,
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+		created: time.Now(),
 	}, nil
 }
 
+//State returns the current state of the subscription
+func (s *Subscription) State() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+//Info returns a snapshot of the subscription
+func (s *Subscription) Info() Info {
+	return Info{
+		Channel:  s.channel,
+		State:    s.State(),
+		Created:  s.created,
+		Messages: atomic.LoadInt64(&s.delivered),
+		Paused:   s.Paused(),
+	}
+}
+
+//CountDelivery counts a message delivered to the subscription, see Info
+func (s *Subscription) CountDelivery() {
+	atomic.AddInt64(&s.delivered, 1)
+}
+
+//SetState moves the subscription to state, a closed subscription stays closed
+func (s *Subscription) SetState(state State) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setState(state)
+}
+
+//setState moves the subscription to state, mu must be held
+func (s *Subscription) setState(state State) {
+	if s.state == StateClosed {
+		return
+	}
+	s.state = state
+	if state >= StateUnsubscribing {
+		s.cancel()
+	}
+	if state == StateClosed {
+		close(s.done)
+	}
+}
+
+//Close closes the subscription, see StateClosed. a non nil err tells why, e.g. the server rejected the
+//subscription again after a reconnect, it is passed to the OnError callbacks.
+func (s *Subscription) Close(err error) {
+	s.mu.Lock()
+	if s.state == StateClosed {
+		s.mu.Unlock()
+		return
+	}
+	s.closeErr = err
+	s.setState(StateClosed)
+	callbacks := s.onError
+	s.onError = nil
+	s.mu.Unlock()
+	if err == nil {
+		return
+	}
+	for i := range callbacks {
+		callbacks[i](err)
+	}
+}
+
+//OnError registers a callback called with the error closing the subscription, e.g. when it fails to resubscribe
+//after a reconnect or the client is terminally disconnected. it isn't called when the subscription is closed
+//by Unsubscribe or Disconnect, wait on Done to be notified of every close. f is called right away if the
+//subscription is already closed with an error.
+func (s *Subscription) OnError(f func(err error)) {
+	s.mu.Lock()
+	closed, err := s.state == StateClosed, s.closeErr
+	if !closed {
+		s.onError = append(s.onError, f)
+	}
+	s.mu.Unlock()
+	if closed && err != nil {
+		f(err)
+	}
+}
+
+//CloseErr returns the error the subscription was closed with, nil while it is open or if it was closed by
+//Unsubscribe or Disconnect
+func (s *Subscription) CloseErr() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closeErr
+}
+
+//Context returns a context canceled once the subscription is removed, e.g. by Unsubscribe or when the
+//lifetime of the subscription is done, so the work started by the handlers ends with the subscription
+func (s *Subscription) Context() context.Context {
+	return s.ctx
+}
+
+//next returns the next message delivered, waiting while the subscription is paused. ok is false once it is removed
+func (s *Subscription) next() (msg *message.Message, ok bool) {
+	if !s.awaitResume() {
+		return nil, false
+	}
+	if s.shaped() {
+		return s.nextShaped()
+	}
+	//select picks randomly among the ready cases
+	if s.ctx.Err() != nil {
+		return nil, false
+	}
+	select {
+	case <-s.ctx.Done():
+		return nil, false
+	case msg, ok = <-s.msgCh:
+		return msg, ok
+	}
+}
+
+//Done returns a channel closed when the subscription is closed, see StateClosed and CloseErr
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+//OnMessage calls onMessage with every message delivered until the subscription is removed, the messages
+//still queued are discarded. a panic in onMessage stops the delivery and is returned as a *message.PanicError.
 func (s *Subscription) OnMessage(onMessage func(channel string, msg message.Data)) error {
-	var inMsg *message.Message
-	for inMsg = range s.msgCh {
+	for inMsg, ok := s.next(); ok; inMsg, ok = s.next() {
+		if inMsg.GetError() != nil {
+			return inMsg.GetError()
+		}
+		if err := message.CatchPanic(func() { onMessage(inMsg.Channel, inMsg.Data) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//OnRawMessage is like OnMessage but passes the whole message, e.g. to read its id, ext or clientId.
+//the message may be shared with the other subscriptions of its channel and must not be modified.
+func (s *Subscription) OnRawMessage(onMessage func(msg *message.Message)) error {
+	for inMsg, ok := s.next(); ok; inMsg, ok = s.next() {
+		if inMsg.GetError() != nil {
+			return inMsg.GetError()
+		}
+		if err := message.CatchPanic(func() { onMessage(inMsg) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//OnMessageErr is like OnMessage but the handler can fail: the handler error is returned and recorded
+//(see Err), then the subscription is canceled or paused according to the ErrorPolicy. a panic in the handler
+//is handled as an error, a *message.PanicError.
+func (s *Subscription) OnMessageErr(onMessage func(channel string, msg message.Data) error) error {
+	for inMsg, ok := s.next(); ok; inMsg, ok = s.next() {
+		if inMsg.GetError() != nil {
+			return inMsg.GetError()
+		}
+		var err error
+		if panicErr := message.CatchPanic(func() { err = onMessage(inMsg.Channel, inMsg.Data) }); panicErr != nil {
+			err = panicErr
+		}
+		if err != nil {
+			return s.handlerError(err)
+		}
+	}
+	return nil
+}
+
+//OnTyped is like OnMessageErr but decodes the data of every message into a T with Message.DecodeData,
+//a message failing to decode is handled as a handler error
+func OnTyped[T any](s *Subscription, onMessage func(channel string, data T) error) error {
+	for inMsg, ok := s.next(); ok; inMsg, ok = s.next() {
 		if inMsg.GetError() != nil {
 			return inMsg.GetError()
 		}
-		onMessage(inMsg.Channel, inMsg.Data)
+		var data T
+		err := inMsg.DecodeData(&data)
+		if err == nil {
+			if panicErr := message.CatchPanic(func() { err = onMessage(inMsg.Channel, data) }); panicErr != nil {
+				err = panicErr
+			}
+		}
+		if err != nil {
+			return s.handlerError(err)
+		}
 	}
 	return nil
 }
 
+//handlerError records the handler error and applies the error policy
+func (s *Subscription) handlerError(err error) error {
+	s.mu.Lock()
+	s.err = err
+	policy := s.errorPolicy
+	s.mu.Unlock()
+	if policy == CancelOnError {
+		if unsubErr := s.Unsubscribe(); unsubErr != nil {
+			return fmt.Errorf("%v (unsubscribe: %v)", err, unsubErr)
+		}
+	}
+	return err
+}
+
+//SetFilter sets a predicate evaluated on every message received for the subscription before it is queued,
+//the messages it returns false for are discarded without reaching MsgChannel or the handlers. nil accepts all.
+func (s *Subscription) SetFilter(filter func(msg *message.Message) bool) {
+	s.mu.Lock()
+	s.filter = filter
+	s.mu.Unlock()
+}
+
+//Accepts reports whether the filter of the subscription accepts msg, see SetFilter
+func (s *Subscription) Accepts(msg *message.Message) bool {
+	s.mu.Lock()
+	filter := s.filter
+	s.mu.Unlock()
+	return filter == nil || filter(msg)
+}
+
+//Middleware transforms a message received for a subscription before it is queued, e.g. to validate, decrypt or
+//deduplicate it. it returns the message passed to the next middleware, nil drops it. an error drops it too and
+//is reported to the error handlers of the client. msg may be shared with the other subscriptions of its channel
+//and must not be modified, return a modified copy instead.
+type Middleware func(msg *message.Message) (*message.Message, error)
+
+//Filter returns a Middleware dropping the messages the predicate returns false for, e.g. to deliver only the
+//orders of a channel carrying several types of messages. unlike SetFilter the filters accumulate.
+func Filter(predicate func(msg *message.Message) bool) Middleware {
+	return func(msg *message.Message) (*message.Message, error) {
+		if !predicate(msg) {
+			return nil, nil
+		}
+		return msg, nil
+	}
+}
+
+//Use appends middlewares run in order on every message accepted by the filter of the subscription
+func (s *Subscription) Use(middlewares ...Middleware) {
+	s.mu.Lock()
+	s.middlewares = append(s.middlewares[:len(s.middlewares):len(s.middlewares)], middlewares...)
+	s.mu.Unlock()
+}
+
+//Process runs the middlewares of the subscription on msg, see Use. the message returned is nil if one dropped it
+func (s *Subscription) Process(msg *message.Message) (*message.Message, error) {
+	s.mu.Lock()
+	middlewares := s.middlewares
+	s.mu.Unlock()
+	for i := 0; i < len(middlewares) && msg != nil; i++ {
+		var err error
+		if msg, err = middlewares[i](msg); err != nil {
+			return nil, err
+		}
+	}
+	return msg, nil
+}
+
+//SetErrorPolicy sets what happens when the OnMessageErr handler returns an error, CancelOnError by default
+func (s *Subscription) SetErrorPolicy(policy ErrorPolicy) {
+	s.mu.Lock()
+	s.errorPolicy = policy
+	s.mu.Unlock()
+}
+
+//SetResubscribePolicy sets what happens when the server rejects the channel while the subscription is restored,
+//ResubscribeDefault applies the policy of the client
+func (s *Subscription) SetResubscribePolicy(policy ResubscribePolicy) {
+	s.mu.Lock()
+	s.resubscribe = policy
+	s.mu.Unlock()
+}
+
+//ResubscribePolicy returns the policy set with SetResubscribePolicy
+func (s *Subscription) ResubscribePolicy() ResubscribePolicy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.resubscribe
+}
+
+//SetDeliveryMode sets the delivery guarantee of the subscription, it is set by the client before subscribing
+func (s *Subscription) SetDeliveryMode(mode DeliveryMode) {
+	s.mu.Lock()
+	s.delivery = mode
+	s.mu.Unlock()
+}
+
+//DeliveryMode returns the delivery guarantee of the subscription
+func (s *Subscription) DeliveryMode() DeliveryMode {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.delivery
+}
+
+//Err returns the last error returned by the OnMessageErr handler
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
 func (s *Subscription) MsgChannel() chan *message.Message {
 	return s.msgCh
 }
 
+//Queue pushes msg to the message channel according to the overflow policy, channel.Block waits for room until
+//the channel is closed. it returns false if msg was dropped because the queue is full, the messages queued once
+//the channel is closed are discarded. it is safe to call while CloseMsgChannel runs
+func (s *Subscription) Queue(msg *message.Message, overflow channel.OverflowPolicy) bool {
+	s.sending.RLock()
+	defer s.sending.RUnlock()
+	select {
+	case <-s.closing:
+		return true
+	default:
+	}
+	switch {
+	case overflow == channel.Block:
+		select {
+		case s.msgCh <- msg:
+			s.CountDelivery()
+		case <-s.closing:
+		}
+		return true
+	case overflow == channel.DropOldest && cap(s.msgCh) > 0:
+		for {
+			select {
+			case s.msgCh <- msg:
+				s.CountDelivery()
+				return true
+			default:
+			}
+			//make room for the incoming message
+			select {
+			case <-s.msgCh:
+			default:
+			}
+		}
+	default:
+		select {
+		case s.msgCh <- msg:
+			s.CountDelivery()
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+//CloseMsgChannel closes the message channel once the deliveries in flight returned, the ones blocked on a full
+//queue give up. it is called when the subscription is removed
+func (s *Subscription) CloseMsgChannel() {
+	s.closeOnce.Do(func() {
+		close(s.closing)
+		s.sending.Lock()
+		close(s.msgCh)
+		s.sending.Unlock()
+	})
+}
+
 func (s *Subscription) Name() string {
 	return s.channel
 }
 
+//Channel returns the subscribed channel or wildcard pattern
+func (s *Subscription) Channel() channel.Channel {
+	return channel.Channel(s.channel)
+}
+
 //Unsubscribe ...
 func (s *Subscription) Unsubscribe() error {
 	return s.unsub(s)
 }
 
-//validChannelName channel specifies is the channel is in the format /foo/432/bar
-var validChannelName = regexp.MustCompile(`^\/(((([a-z]|[A-Z])|[0-9])|(\-|\_|\!|\~|\(|\)|\$|\@)))+(\/(((([a-z]|[A-Z])|[0-9])|(\-|\_|\!|\~|\(|\)|\$|\@)))+)*$`)
-
-var validChannelPattern = regexp.MustCompile(`^(\/(((([a-z]|[A-Z])|[0-9])|(\-|\_|\!|\~|\(|\)|\$|\@)))+)*\/\*{1,2}$`)
-
-func IsValidSubscriptionName(channel string) bool {
-	return validChannelName.MatchString(channel) || validChannelPattern.MatchString(channel)
+func IsValidSubscriptionName(name string) bool {
+	return channel.Channel(name).IsValid()
 }
 
 //isValidPublishName
-func IsValidPublishName(channel string) bool {
-	return validChannelName.MatchString(channel)
+func IsValidPublishName(name string) bool {
+	return channel.Channel(name).IsPublishable()
 }
@@ -1,7 +1,10 @@
 package subscription
 
 import (
+	"errors"
+	"github.com/thesyncim/faye/message"
 	"testing"
+	"time"
 )
 
 /*
@@ -81,3 +84,297 @@ func TestIsValidSubscriptionName(t *testing.T) {
 		})
 	}
 }
+
+func TestSubscription_OnMessageErr(t *testing.T) {
+	handlerErr := errors.New("handler failed")
+	for _, policy := range []ErrorPolicy{CancelOnError, PauseOnError} {
+		unsubscribed := false
+		msgCh := make(chan *message.Message, 2)
+		sub, err := NewSubscription("/foo", func(*Subscription) error {
+			unsubscribed = true
+			return nil
+		}, msgCh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sub.SetErrorPolicy(policy)
+		msgCh <- &message.Message{Channel: "/foo", Data: "a"}
+		msgCh <- &message.Message{Channel: "/foo", Data: "b"}
+
+		var handled []message.Data
+		err = sub.OnMessageErr(func(channel string, data message.Data) error {
+			handled = append(handled, data)
+			return handlerErr
+		})
+		if err != handlerErr || sub.Err() != handlerErr {
+			t.Fatalf("expecting the handler error got: %v, Err: %v", err, sub.Err())
+		}
+		if len(handled) != 1 {
+			t.Fatalf("expecting the delivery to stop after the error got: %v", handled)
+		}
+		if unsubscribed != (policy == CancelOnError) {
+			t.Fatalf("policy %v: unexpected unsubscribe %v", policy, unsubscribed)
+		}
+		if len(msgCh) != 1 {
+			t.Fatalf("expecting the remaining message queued got: %d", len(msgCh))
+		}
+	}
+}
+
+func TestOnTyped(t *testing.T) {
+	type greeting struct {
+		Text string `json:"text"`
+	}
+	msgCh := make(chan *message.Message, 2)
+	sub, err := NewSubscription("/foo", func(*Subscription) error { return nil }, msgCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgCh <- &message.Message{Channel: "/foo", Data: map[string]interface{}{"text": "hello"}}
+	msgCh <- &message.Message{Channel: "/foo", Data: "not a greeting"}
+
+	var handled []greeting
+	err = OnTyped(sub, func(channel string, g greeting) error {
+		handled = append(handled, g)
+		return nil
+	})
+	if err == nil || sub.Err() != err {
+		t.Fatalf("expecting the decoding error got: %v, Err: %v", err, sub.Err())
+	}
+	if len(handled) != 1 || handled[0].Text != "hello" {
+		t.Fatalf("expecting the greeting handled got: %+v", handled)
+	}
+}
+
+func TestSubscription_State(t *testing.T) {
+	sub, err := NewSubscription("/foo", nil, make(chan *message.Message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, state := range []State{StatePending, StateActive, StateUnsubscribing, StateClosed} {
+		sub.SetState(state)
+		if got := sub.State(); got != state {
+			t.Fatalf("State() = %v, want %v", got, state)
+		}
+		select {
+		case <-sub.Done():
+			if state != StateClosed {
+				t.Fatalf("Done closed in state %v", state)
+			}
+		default:
+			if state == StateClosed {
+				t.Fatal("expecting Done closed")
+			}
+		}
+	}
+
+	//a closed subscription stays closed
+	sub.SetState(StateActive)
+	sub.SetState(StateClosed)
+	if got := sub.State(); got != StateClosed {
+		t.Fatalf("State() = %v, want %v", got, StateClosed)
+	}
+}
+
+func TestSubscription_HandlerPanic(t *testing.T) {
+	msgCh := make(chan *message.Message, 1)
+	sub, err := NewSubscription("/foo", func(*Subscription) error { return nil }, msgCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlers := map[string]func() error{
+		"OnMessage": func() error {
+			return sub.OnMessage(func(channel string, msg message.Data) {
+				panic("bad handler")
+			})
+		},
+		"OnMessageErr": func() error {
+			return sub.OnMessageErr(func(channel string, msg message.Data) error {
+				panic("bad handler")
+			})
+		},
+	}
+	for name, handle := range handlers {
+		msgCh <- &message.Message{Channel: "/foo", Data: "a"}
+		var panicErr *message.PanicError
+		if err = handle(); !errors.As(err, &panicErr) || panicErr.Value != "bad handler" || len(panicErr.Stack) == 0 {
+			t.Fatalf("%s: expecting the panic as error got: %v", name, err)
+		}
+	}
+}
+
+func TestSubscription_Context(t *testing.T) {
+	msgCh := make(chan *message.Message, 2)
+	var sub *Subscription
+	sub, err := NewSubscription("/foo", func(*Subscription) error {
+		sub.SetState(StateUnsubscribing)
+		return nil
+	}, msgCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgCh <- &message.Message{Channel: "/foo", Data: "a"}
+	msgCh <- &message.Message{Channel: "/foo", Data: "b"}
+
+	var handled []message.Data
+	err = sub.OnMessage(func(channel string, data message.Data) {
+		handled = append(handled, data)
+		if err := sub.Unsubscribe(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(handled) != 1 {
+		t.Fatalf("expecting the queued messages discarded once unsubscribed got: %v", handled)
+	}
+	select {
+	case <-sub.Context().Done():
+	default:
+		t.Fatal("expecting the context canceled")
+	}
+}
+
+func TestSubscription_OnError(t *testing.T) {
+	revoked := errors.New("revoked")
+	var tests = []struct {
+		err error
+		//registeredAfter registers a callback once closed
+		registeredAfter bool
+	}{
+		{revoked, false},
+		{revoked, true},
+		//closed on purpose
+		{nil, false},
+		{nil, true},
+	}
+	for _, tt := range tests {
+		sub, err := NewSubscription("/foo", nil, make(chan *message.Message))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var reported []error
+		onError := func(err error) { reported = append(reported, err) }
+		if !tt.registeredAfter {
+			sub.OnError(onError)
+		}
+		sub.Close(tt.err)
+		//closing again doesn't report anything
+		sub.Close(errors.New("closed twice"))
+		if tt.registeredAfter {
+			sub.OnError(onError)
+		}
+
+		select {
+		case <-sub.Done():
+		default:
+			t.Fatal("expecting Done closed")
+		}
+		if sub.CloseErr() != tt.err {
+			t.Fatalf("expecting the close error %v got: %v", tt.err, sub.CloseErr())
+		}
+		if tt.err == nil && len(reported) != 0 {
+			t.Fatalf("expecting no error reported got: %v", reported)
+		} else if tt.err != nil && (len(reported) != 1 || reported[0] != tt.err) {
+			t.Fatalf("expecting %v reported once got: %v", tt.err, reported)
+		}
+	}
+}
+
+func TestSubscription_Filter(t *testing.T) {
+	sub, err := NewSubscription("/foo", func(*Subscription) error { return nil }, make(chan *message.Message, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	isOrder := func(msg *message.Message) bool {
+		data, _ := msg.Data.(map[string]interface{})
+		return data["type"] == "order"
+	}
+	large := func(msg *message.Message) bool {
+		data, _ := msg.Data.(map[string]interface{})
+		total, _ := data["total"].(float64)
+		return total >= 100
+	}
+	sub.Use(Filter(isOrder), Filter(large))
+	tests := []struct {
+		data     map[string]interface{}
+		accepted bool
+	}{
+		{data: map[string]interface{}{"type": "order", "total": 150.0}, accepted: true},
+		{data: map[string]interface{}{"type": "order", "total": 50.0}},
+		{data: map[string]interface{}{"type": "refund", "total": 150.0}},
+	}
+	for _, tt := range tests {
+		msg := &message.Message{Channel: "/foo", Data: tt.data}
+		got, err := sub.Process(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (got == msg) != tt.accepted || (got == nil) == tt.accepted {
+			t.Fatalf("expecting %v accepted %v got: %v", tt.data, tt.accepted, got)
+		}
+	}
+}
+
+func TestSubscription_PauseResume(t *testing.T) {
+	msgCh := make(chan *message.Message, 2)
+	sub, err := NewSubscription("/foo", func(*Subscription) error { return nil }, msgCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sub.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	handled := make(chan message.Data, 2)
+	go sub.OnMessage(func(channel string, data message.Data) {
+		handled <- data
+	})
+	msgCh <- &message.Message{Channel: "/foo", Data: "a"}
+	select {
+	case data := <-handled:
+		t.Fatalf("expecting no message handled while paused got: %v", data)
+	case <-time.After(20 * time.Millisecond):
+	}
+	if !sub.Paused() || !sub.Info().Paused {
+		t.Fatal("expecting the subscription paused")
+	}
+
+	if err = sub.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case data := <-handled:
+		if data != "a" {
+			t.Fatalf("expecting the queued message handled got: %v", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expecting the queued message handled once resumed")
+	}
+	sub.Close(nil)
+}
+
+func TestSubscription_PauseUnsubscribe(t *testing.T) {
+	sub, err := NewSubscription("/foo", func(*Subscription) error { return nil }, make(chan *message.Message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls []bool
+	sub.SetPauser(func(s *Subscription, paused bool) error {
+		calls = append(calls, paused)
+		return nil
+	})
+	//buffered by default
+	sub.Pause()
+	sub.Resume()
+	sub.SetPauseMode(PauseUnsubscribe)
+	sub.Pause()
+	if !sub.PausedOnServer() {
+		t.Fatal("expecting the subscription paused on the server")
+	}
+	sub.Pause()
+	sub.Resume()
+	if len(calls) != 2 || !calls[0] || calls[1] {
+		t.Fatalf("expecting the server advised of a pause and a resume got: %v", calls)
+	}
+}
@@ -164,7 +164,7 @@ func TestWildcardSubscription(t *testing.T) {
 
 	for _, channel := range []string{"/wildcard/foo", "/wildcard/bar"} {
 		for i := 0; i < 10; i++ {
-			err := client.Publish(channel, "hello world")
+			err := client.Publish(Channel(channel), "hello world")
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -0,0 +1,72 @@
+package transport
+
+import (
+	"context"
+	"github.com/thesyncim/faye/message"
+)
+
+//ContextTransport is implemented by the transports whose blocking calls can be canceled through a context,
+//e.g. to give up a handshake on shutdown. see HandshakeCtx, ConnectCtx and DisconnectCtx
+type ContextTransport interface {
+	Transport
+	//HandshakeCtx is like Handshake but returns the context error as soon as ctx is done
+	HandshakeCtx(ctx context.Context, msg *message.Message) (*message.Message, error)
+	//ConnectCtx is like Connect but returns the context error as soon as ctx is done
+	ConnectCtx(ctx context.Context, msg *message.Message) error
+	//DisconnectCtx is like Disconnect but returns the context error as soon as ctx is done
+	DisconnectCtx(ctx context.Context, msg *message.Message) error
+}
+
+//HandshakeCtx handshakes through t, canceled when ctx is done. transports not implementing ContextTransport
+//keep handshaking in background once the context error is returned.
+func HandshakeCtx(ctx context.Context, t Transport, msg *message.Message) (*message.Message, error) {
+	if ct, ok := t.(ContextTransport); ok {
+		return ct.HandshakeCtx(ctx, msg)
+	}
+	var resp *message.Message
+	err := withContext(ctx, func() (err error) {
+		resp, err = t.Handshake(msg)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+//ConnectCtx connects through t, canceled when ctx is done, see HandshakeCtx
+func ConnectCtx(ctx context.Context, t Transport, msg *message.Message) error {
+	if ct, ok := t.(ContextTransport); ok {
+		return ct.ConnectCtx(ctx, msg)
+	}
+	return withContext(ctx, func() error {
+		return t.Connect(msg)
+	})
+}
+
+//DisconnectCtx disconnects through t, canceled when ctx is done, see HandshakeCtx
+func DisconnectCtx(ctx context.Context, t Transport, msg *message.Message) error {
+	if ct, ok := t.(ContextTransport); ok {
+		return ct.DisconnectCtx(ctx, msg)
+	}
+	return withContext(ctx, func() error {
+		return t.Disconnect(msg)
+	})
+}
+
+//withContext runs fn and returns its error, or the context error if it is done first
+func withContext(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,37 @@
+package transport
+
+import (
+	"context"
+	"github.com/thesyncim/faye/message"
+	"testing"
+)
+
+//blockingTransport handshakes once release is closed
+type blockingTransport struct {
+	Transport
+	release chan struct{}
+}
+
+func (t *blockingTransport) Handshake(msg *message.Message) (*message.Message, error) {
+	<-t.release
+	return &message.Message{Channel: message.MetaHandshake, Successful: true}, nil
+}
+
+func TestHandshakeCtx(t *testing.T) {
+	bt := &blockingTransport{release: make(chan struct{})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := HandshakeCtx(ctx, bt, &message.Message{}); err != context.Canceled {
+		t.Fatalf("expecting context.Canceled got: %v", err)
+	}
+
+	close(bt.release)
+	resp, err := HandshakeCtx(context.Background(), bt, &message.Message{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Successful {
+		t.Fatal("expecting a successful handshake")
+	}
+}
@@ -0,0 +1,50 @@
+package transport
+
+import (
+	"github.com/thesyncim/faye/codec"
+	"github.com/thesyncim/faye/message"
+)
+
+//Decode decodes the batch of messages received from the server with the options Codec, or the Parser if not set.
+//the messages a strict parser rejects are left out and reported in the error along with the valid messages.
+func (o *Options) Decode(b []byte) ([]message.Message, error) {
+	return o.codec().Unmarshal(b)
+}
+
+//Encode encodes the messages sent to the server in a single batch with the options Codec
+func (o *Options) Encode(msgs []*message.Message) ([]byte, error) {
+	c := o.codec()
+	if m, ok := c.(codec.PointerMarshaler); ok {
+		return m.MarshalPointers(msgs)
+	}
+	payload := make([]message.Message, len(msgs))
+	for i := range msgs {
+		payload[i] = *msgs[i]
+	}
+	return c.Marshal(payload)
+}
+
+//DecodeData decodes the data of a message, e.g. after decompressing it, with the number mode of the options Parser
+func (o *Options) DecodeData(b []byte) (message.Data, error) {
+	return o.parser().DecodeData(b)
+}
+
+//IsJSON reports whether the messages are encoded as json, see codec.IsJSON
+func (o *Options) IsJSON() bool {
+	return codec.IsJSON(o.codec())
+}
+
+//codec returns the options Codec, json with the options Parser if not set
+func (o *Options) codec() codec.Codec {
+	if o.Codec == nil {
+		return codec.JSON{Parser: o.parser()}
+	}
+	return o.Codec
+}
+
+func (o *Options) parser() *message.Parser {
+	if o.Parser == nil {
+		return &message.Parser{}
+	}
+	return o.Parser
+}
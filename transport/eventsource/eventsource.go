@@ -0,0 +1,321 @@
+package eventsource
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/thesyncim/faye/clock"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const transportName = "eventsource"
+
+func init() {
+	transport.Register(transportName, New)
+}
+
+//New creates an eventsource transport, e.g. to inject it with fayec.WithTransport
+func New() transport.Transport {
+	return &EventSource{}
+}
+
+//ErrUnexpectedStatus is returned when the server responds with a non 200 status
+var ErrUnexpectedStatus = errors.New("unexpected http status")
+
+//ErrUnsupportedCodec is returned by Init when the options codec doesn't encode json, the events carry json batches
+var ErrUnsupportedCodec = errors.New("eventsource requires a json codec")
+
+//EventSource represents an eventsource transport for the faye protocol: the messages of the server are received
+//as Server-Sent Events on a stream opened at endpoint/clientId once connected, the messages of the client are
+//posted in their own request and the responses dispatched. when the server ends the stream it is opened again.
+type EventSource struct {
+	transport.Session
+
+	topts    *transport.Options
+	endpoint string
+	client   *http.Client
+
+	mu     sync.Mutex
+	advice *message.Advise
+	//retry is the reconnection time sent by the server, it overrides the advised interval
+	retry time.Duration
+	//cancel stops the stream
+	cancel context.CancelFunc
+
+	//closed is set by Disconnect so the stream can tell a requested close from a failure
+	closed int32
+	//streaming is set while the stream is running, so repeated connects don't open another one
+	streaming int32
+
+	onMsg           func(msg *message.Message)
+	onError         func(err error)
+	onTransportDown func(err error)
+	onTransportUp   func()
+}
+
+var (
+	_ transport.Transport = (*EventSource)(nil)
+	_ transport.Closer    = (*EventSource)(nil)
+)
+
+//Init initializes the transport with the provided options
+func (e *EventSource) Init(endpoint string, options *transport.Options) error {
+	if !options.IsJSON() {
+		return ErrUnsupportedCodec
+	}
+	e.topts = options
+	e.endpoint = endpoint
+	e.client = options.HTTPClient()
+	atomic.StoreInt32(&e.closed, 0)
+	e.SetConnectionState(transport.StateConnected)
+	return nil
+}
+
+//Name returns the transport name (eventsource)
+func (e *EventSource) Name() string {
+	return transportName
+}
+
+//Options return the transport Options
+func (e *EventSource) Options() *transport.Options {
+	return e.topts
+}
+
+//Handshake initiates a connection negotiation by sending a message to the /meta/handshake channel.
+func (e *EventSource) Handshake(msg *message.Message) (*message.Message, error) {
+	resp, err := e.post(context.Background(), []*message.Message{msg})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	e.SetHandshakeInfo(transport.HandshakeInfo{StatusCode: resp.StatusCode, Header: resp.Header})
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := e.topts.Decode(body)
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		return nil, errors.New("empty handshake response")
+	}
+	e.Observe(&msgs[0])
+	return &msgs[0], nil
+}
+
+//Connect opens the event stream of the clientId, unless it is running, and posts the connect message
+func (e *EventSource) Connect(msg *message.Message) error {
+	if atomic.CompareAndSwapInt32(&e.streaming, 0, 1) {
+		ctx, cancel := context.WithCancel(context.Background())
+		e.mu.Lock()
+		e.cancel = cancel
+		e.mu.Unlock()
+		go func() {
+			err := e.stream(ctx, e.endpoint+"/"+msg.ClientId)
+			atomic.StoreInt32(&e.streaming, 0)
+			cancel()
+			if err != nil && e.onTransportDown != nil {
+				e.onTransportDown(err)
+			}
+		}()
+	}
+	return e.SendMessage(msg)
+}
+
+//stream dispatches the events of the stream at url, opening it again when the server ends it, after the
+//reconnection time of the server or the advised interval
+func (e *EventSource) stream(ctx context.Context, url string) error {
+	for {
+		err := e.readStream(ctx, url)
+		if atomic.LoadInt32(&e.closed) == 1 {
+			return nil
+		}
+		if err != nil {
+			e.SetConnectionState(transport.StateDisconnected)
+			return err
+		}
+		e.mu.Lock()
+		interval, _ := e.topts.PollTiming(e.advice)
+		if e.retry > 0 {
+			interval = e.retry
+		}
+		e.mu.Unlock()
+		timer := clock.Or(e.topts.Clock).NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C():
+		}
+	}
+}
+
+//readStream opens the stream and dispatches the message batches of its events until it ends
+func (e *EventSource) readStream(ctx context.Context, url string) error {
+	headers, err := e.topts.RequestHeaders()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header = headers
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s", ErrUnexpectedStatus, resp.Status)
+	}
+
+	//the events are made of fields, one per line, and end with an empty line
+	var data bytes.Buffer
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch {
+		case line == "":
+			if data.Len() > 0 {
+				e.decodeAndDispatch(data.Bytes())
+				data.Reset()
+			}
+		case field == "data":
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+		case field == "retry":
+			if ms, err := strconv.Atoi(value); err == nil {
+				e.mu.Lock()
+				e.retry = time.Duration(ms) * time.Millisecond
+				e.mu.Unlock()
+			}
+		}
+		//the comments, event and id fields are ignored
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return scanner.Err()
+}
+
+//SendMessage posts the message, the server response is dispatched
+func (e *EventSource) SendMessage(m *message.Message) error {
+	return e.SendMessages([]*message.Message{m})
+}
+
+//SendMessages posts the messages in a single request, the server response is dispatched
+func (e *EventSource) SendMessages(msgs []*message.Message) error {
+	resp, err := e.post(context.Background(), msgs)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(body)) > 0 {
+		e.decodeAndDispatch(body)
+	}
+	return nil
+}
+
+//Disconnect stops the stream and informs the server to remove any client-related state.
+func (e *EventSource) Disconnect(m *message.Message) error {
+	e.stop()
+	err := e.SendMessage(m)
+	e.SetConnectionState(transport.StateDisconnected)
+	return err
+}
+
+//Close stops the stream without informing the server
+func (e *EventSource) Close() error {
+	e.stop()
+	e.SetConnectionState(transport.StateDisconnected)
+	return nil
+}
+
+//stop marks the transport closed and stops the stream
+func (e *EventSource) stop() {
+	atomic.StoreInt32(&e.closed, 1)
+	e.mu.Lock()
+	if e.cancel != nil {
+		e.cancel()
+	}
+	e.mu.Unlock()
+}
+
+//post sends the messages in a single request
+func (e *EventSource) post(ctx context.Context, msgs []*message.Message) (*http.Response, error) {
+	body, err := e.topts.Encode(msgs)
+	if err != nil {
+		return nil, err
+	}
+	req, err := e.topts.NewRequest(ctx, e.endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrUnexpectedStatus, resp.Status)
+	}
+	return resp, nil
+}
+
+//decodeAndDispatch dispatches the messages of a batch, decoding errors are reported
+func (e *EventSource) decodeAndDispatch(b []byte) {
+	batch, err := e.topts.Decode(b)
+	if err != nil && e.onError != nil {
+		e.onError(fmt.Errorf("decode: %w", err))
+	}
+	for i := range batch {
+		msg := &batch[i]
+		if msg.Channel == message.MetaConnect && msg.Advice != nil {
+			e.mu.Lock()
+			e.advice = msg.Advice
+			e.mu.Unlock()
+		}
+		e.Observe(msg)
+		e.onMsg(msg)
+	}
+}
+
+func (e *EventSource) SetOnMessageReceivedHandler(onMsg func(*message.Message)) {
+	e.onMsg = onMsg
+}
+
+func (e *EventSource) SetOnTransportUpHandler(onTransportUp func()) {
+	e.onTransportUp = onTransportUp
+}
+
+func (e *EventSource) SetOnTransportDownHandler(onTransportDown func(err error)) {
+	e.onTransportDown = onTransportDown
+}
+
+func (e *EventSource) SetOnErrorHandler(onError func(err error)) {
+	e.onError = onError
+}
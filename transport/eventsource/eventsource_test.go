@@ -0,0 +1,108 @@
+package eventsource
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+//eventSourceServer answers the posted messages and streams three messages on the event stream of clientId abc,
+//the second event spans two data lines
+func eventSourceServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			if r.URL.Path != "/abc" || r.Header.Get("Accept") != "text/event-stream" {
+				t.Errorf("unexpected stream request %s %v", r.URL.Path, r.Header)
+				return
+			}
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, ": comment\nretry: 10\n\ndata: [{\"channel\":\"/foo\",\"data\":\"a\"}]\n\n")
+			fmt.Fprint(w, "event: message\ndata: [{\"channel\":\"/foo\",\"data\":\"b\"},\ndata: {\"channel\":\"/foo\",\"data\":\"c\"}]\n\n")
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		var msgs []message.Message
+		if err := json.NewDecoder(r.Body).Decode(&msgs); err != nil {
+			t.Error(err)
+			return
+		}
+		enc := json.NewEncoder(w)
+		switch msgs[0].Channel {
+		case message.MetaHandshake:
+			enc.Encode([]message.Message{{Channel: message.MetaHandshake, Successful: true, ClientId: "abc"}})
+		default:
+			enc.Encode([]message.Message{{Channel: msgs[0].Channel, Id: msgs[0].Id, Successful: true}})
+		}
+	}))
+}
+
+func TestEventSource(t *testing.T) {
+	srv := eventSourceServer(t)
+	defer srv.Close()
+
+	e := &EventSource{}
+	defer e.Close()
+	received := make(chan *message.Message, 10)
+	e.SetOnMessageReceivedHandler(func(msg *message.Message) {
+		received <- msg
+	})
+	if err := e.Init(srv.URL, &transport.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := e.Handshake(&message.Message{Channel: message.MetaHandshake})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ClientId != "abc" || e.ClientID() != "abc" {
+		t.Fatalf("expecting clientId abc got: %s", resp.ClientId)
+	}
+
+	if err = e.Connect(&message.Message{Channel: message.MetaConnect, ClientId: "abc", Id: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	//the connect response is posted back, the deliveries are streamed
+	var (
+		streamed  []message.Data
+		connected bool
+	)
+	for !connected || len(streamed) < 3 {
+		select {
+		case msg := <-received:
+			if msg.Channel == message.MetaConnect {
+				if !msg.Successful {
+					t.Fatalf("expecting the connect acked got: %+v", msg)
+				}
+				connected = true
+				continue
+			}
+			streamed = append(streamed, msg.Data)
+		case <-time.After(time.Second):
+			t.Fatalf("expecting the streamed messages got: %v", streamed)
+		}
+	}
+	for i, expected := range []string{"a", "b", "c"} {
+		if streamed[i] != expected {
+			t.Fatalf("expecting %s got: %v", expected, streamed[i])
+		}
+	}
+
+	if err = e.SendMessage(&message.Message{Channel: "/foo", Id: "2", Data: "d"}); err != nil {
+		t.Fatal(err)
+	}
+	if ack := <-received; ack.Id != "2" || !ack.Successful {
+		t.Fatalf("expecting the publish ack got: %+v", ack)
+	}
+
+	if err = e.Disconnect(&message.Message{Channel: message.MetaDisconnect, ClientId: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	if e.ConnectionState() != transport.StateDisconnected {
+		t.Fatal("expecting the transport disconnected")
+	}
+}
@@ -0,0 +1,118 @@
+package transport
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"github.com/thesyncim/faye/internal/version"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+)
+
+//HTTPClient returns the http client the polling transports send their requests with.
+//all the requests of a client share its connection pool, so the held /meta/connect and the concurrent sends are
+//multiplexed over a single HTTP/2 connection when the server supports it. with H2C HTTP/2 is used with prior
+//knowledge on plain http endpoints, without the TLS negotiation.
+//responses are requested with Accept-Encoding: gzip and decompressed transparently.
+func (o *Options) HTTPClient() *http.Client {
+	dialContext := o.NetDialContext
+	if dialContext == nil {
+		dialContext = (&net.Dialer{Timeout: o.DialDeadline}).DialContext
+	}
+	rt := &http.Transport{
+		Proxy:             o.ProxyFunc(),
+		DialContext:       dialContext,
+		TLSClientConfig:   o.TLSConfig(),
+		ForceAttemptHTTP2: true,
+	}
+	if o.H2C {
+		rt.Protocols = new(http.Protocols)
+		rt.Protocols.SetHTTP2(true)
+		rt.Protocols.SetUnencryptedHTTP2(true)
+	}
+	return &http.Client{Transport: rt, Jar: o.CookieJar()}
+}
+
+//RequestHeaders returns a copy of the Headers with the ones returned by HeaderFunc, which take precedence,
+//and a default User-Agent. it is meant to be called for every connection or request so the headers are refreshed.
+func (o *Options) RequestHeaders() (http.Header, error) {
+	headers := o.Headers.Clone()
+	if headers == nil {
+		headers = http.Header{}
+	}
+	if o.HeaderFunc != nil {
+		extra, err := o.HeaderFunc()
+		if err != nil {
+			return nil, fmt.Errorf("request headers: %w", err)
+		}
+		for k, v := range extra {
+			headers[k] = v
+		}
+	}
+	if headers.Get("User-Agent") == "" {
+		headers.Set("User-Agent", version.UserAgent())
+	}
+	return headers, nil
+}
+
+//ProxyFunc returns the Proxy option, or http.ProxyFromEnvironment when not set so the HTTP_PROXY, HTTPS_PROXY
+//and NO_PROXY environment variables are honored. it is meant to be called from Transport.Init.
+func (o *Options) ProxyFunc() func(*http.Request) (*url.URL, error) {
+	if o.Proxy == nil {
+		return http.ProxyFromEnvironment
+	}
+	return o.Proxy
+}
+
+//CookieJar returns the Cookies jar, creating an in memory one on first use when not set.
+//the transports send all their requests with it, so session affinity cookies set by load balancers
+//or servers (e.g. BAYEUX_BROWSER) are replayed on every poll and after reconnecting.
+//it is meant to be called from Transport.Init.
+func (o *Options) CookieJar() http.CookieJar {
+	if o.Cookies == nil {
+		//cookiejar.New only fails on invalid options
+		o.Cookies, _ = cookiejar.New(nil)
+	}
+	return o.Cookies
+}
+
+//ContentType returns the media type of the encoded messages, see Encode
+func (o *Options) ContentType() string {
+	return o.codec().ContentType()
+}
+
+//NewRequest creates a polling request posting the messages encoded in body with the option headers,
+//the body is gzip compressed when it is at least GzipRequestThreshold bytes long.
+func (o *Options) NewRequest(ctx context.Context, endpoint string, body []byte) (*http.Request, error) {
+	encoding := ""
+	if o.GzipRequestThreshold > 0 && len(body) >= o.GzipRequestThreshold {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		body = buf.Bytes()
+		encoding = "gzip"
+	}
+
+	headers, err := o.RequestHeaders()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = headers
+	req.Header.Set("Content-Type", o.ContentType())
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	return req, nil
+}
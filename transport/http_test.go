@@ -0,0 +1,240 @@
+package transport
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+//multiplexHandler holds the first request until the second one arrives and records the connections used
+type multiplexHandler struct {
+	mu      sync.Mutex
+	protos  map[string]bool
+	remotes map[string]bool
+	second  chan struct{}
+	once    sync.Once
+}
+
+func newMultiplexHandler() *multiplexHandler {
+	return &multiplexHandler{protos: map[string]bool{}, remotes: map[string]bool{}, second: make(chan struct{})}
+}
+
+func (h *multiplexHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	h.protos[r.Proto] = true
+	h.remotes[r.RemoteAddr] = true
+	h.mu.Unlock()
+	if r.URL.Path == "/connect" {
+		<-h.second
+		return
+	}
+	h.once.Do(func() { close(h.second) })
+}
+
+func assertMultiplexed(t *testing.T, client *http.Client, url string, h *multiplexHandler) {
+	var wg sync.WaitGroup
+	for _, path := range []string{"/connect", "/send"} {
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			resp, err := client.Get(url + path)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+		}(path)
+	}
+	wg.Wait()
+
+	if len(h.protos) != 1 || !h.protos["HTTP/2.0"] {
+		t.Fatalf("expecting HTTP/2.0 requests got: %v", h.protos)
+	}
+	if len(h.remotes) != 1 {
+		t.Fatalf("expecting the requests multiplexed on a single connection got: %v", h.remotes)
+	}
+}
+
+func TestOptions_HTTPClientH2C(t *testing.T) {
+	h := newMultiplexHandler()
+	srv := httptest.NewUnstartedServer(h)
+	srv.Config.Protocols = new(http.Protocols)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	defer srv.Close()
+
+	assertMultiplexed(t, (&Options{H2C: true}).HTTPClient(), srv.URL, h)
+}
+
+func TestOptions_HTTPClientTLS(t *testing.T) {
+	h := newMultiplexHandler()
+	srv := httptest.NewUnstartedServer(h)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	opts := &Options{TLS: &tls.Config{RootCAs: roots}, ServerName: "example.com"}
+	assertMultiplexed(t, opts.HTTPClient(), srv.URL, h)
+}
+
+func TestOptions_HTTPClientNetDialContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	var dialed string
+	opts := &Options{NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = addr
+		var d net.Dialer
+		return d.DialContext(ctx, network, srv.Listener.Addr().String())
+	}}
+	resp, err := opts.HTTPClient().Get("http://faye.internal:8000/faye")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if dialed != "faye.internal:8000" {
+		t.Fatalf("expecting the connection created by NetDialContext got: %s", dialed)
+	}
+}
+
+func TestOptions_CookieJarAffinity(t *testing.T) {
+	var missing int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("BAYEUX_BROWSER"); err != nil {
+			missing++
+			http.SetCookie(w, &http.Cookie{Name: "BAYEUX_BROWSER", Value: "node-1", Path: "/"})
+		}
+	}))
+	defer srv.Close()
+
+	opts := &Options{}
+	//a client created after reconnecting keeps the affinity
+	for _, client := range []*http.Client{opts.HTTPClient(), opts.HTTPClient()} {
+		for i := 0; i < 2; i++ {
+			resp, err := client.Get(srv.URL + "/faye")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+		}
+	}
+	if missing != 1 {
+		t.Fatalf("expecting the affinity cookie replayed on every request, missing on %d", missing)
+	}
+}
+
+func TestOptions_Gzip(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			t.Errorf("expecting Accept-Encoding gzip got: %q", r.Header.Get("Accept-Encoding"))
+		}
+		body := io.Reader(r.Body)
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			body = zr
+		}
+		b, _ := io.ReadAll(body)
+
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		zw.Write(b)
+		zw.Close()
+	}))
+	defer srv.Close()
+
+	opts := &Options{GzipRequestThreshold: 10}
+	client := opts.HTTPClient()
+	for _, body := range []string{`[{}]`, `[{"channel":"/foo","data":"hello world"}]`} {
+		req, err := opts.NewRequest(context.Background(), srv.URL, []byte(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if compressed := req.Header.Get("Content-Encoding") == "gzip"; compressed != (len(body) >= 10) {
+			t.Fatalf("unexpected compression %v of %s", compressed, body)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		echo, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(echo) != body {
+			t.Fatalf("expecting the decompressed response %s got: %s", body, echo)
+		}
+	}
+}
+
+func TestOptions_HTTPClientProxy(t *testing.T) {
+	proxied := make(chan string, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied <- r.URL.String()
+	}))
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := &Options{Proxy: http.ProxyURL(proxyURL)}
+	resp, err := o.HTTPClient().Get("http://faye.invalid/bayeux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := <-proxied; got != "http://faye.invalid/bayeux" {
+		t.Fatalf("expecting the request sent through the proxy got: %s", got)
+	}
+
+	if (&Options{}).ProxyFunc() == nil {
+		t.Fatal("expecting the environment proxy by default")
+	}
+}
+
+func TestOptions_RequestHeaders(t *testing.T) {
+	token := "t1"
+	o := &Options{
+		Headers: http.Header{"Authorization": {"static"}, "X-App": {"app"}},
+		HeaderFunc: func() (http.Header, error) {
+			return http.Header{"Authorization": {"Bearer " + token}}, nil
+		},
+	}
+
+	for _, want := range []string{"Bearer t1", "Bearer t2"} {
+		headers, err := o.RequestHeaders()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := headers.Get("Authorization"); got != want {
+			t.Fatalf("expecting Authorization %s got: %s", want, got)
+		}
+		if headers.Get("X-App") != "app" || headers.Get("User-Agent") == "" {
+			t.Fatalf("expecting the static headers and a User-Agent got: %v", headers)
+		}
+		token = "t2"
+	}
+	if o.Headers.Get("Authorization") != "static" {
+		t.Fatal("expecting the Headers option left untouched")
+	}
+
+	o.HeaderFunc = func() (http.Header, error) {
+		return nil, errors.New("refresh failed")
+	}
+	if _, err := o.NewRequest(context.Background(), "http://faye.invalid", nil); err == nil {
+		t.Fatal("expecting the HeaderFunc error")
+	}
+}
@@ -0,0 +1,231 @@
+// Package inproc connects the clients to a fayeserver.Server running in the same process, without any network,
+// so the applications can test their subscriptions and publishes deterministically:
+//
+//	defer inproc.Listen("test", fayeserver.NewServer())()
+//	client, err := fayec.NewClient("inproc://test", fayec.WithTransportName("inproc"))
+package inproc
+
+import (
+	"errors"
+	"fmt"
+	"github.com/thesyncim/faye/fayeserver"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	transportName = "inproc"
+	scheme        = "inproc://"
+)
+
+// ErrNoServer is returned by Init when no server listens on the endpoint name
+var ErrNoServer = errors.New("no server listening")
+
+func init() {
+	transport.Register(transportName, New)
+}
+
+var (
+	serversMu sync.Mutex
+	servers   = map[string]*fayeserver.Server{}
+)
+
+// Listen makes the server reachable at inproc://name until the returned function is called
+func Listen(name string, s *fayeserver.Server) (stop func()) {
+	serversMu.Lock()
+	servers[name] = s
+	serversMu.Unlock()
+	return func() {
+		serversMu.Lock()
+		if servers[name] == s {
+			delete(servers, name)
+		}
+		serversMu.Unlock()
+	}
+}
+
+// New creates an in process transport, e.g. to inject it with fayec.WithTransport
+func New() transport.Transport {
+	return &Inproc{}
+}
+
+// Inproc represents an in process transport for the faye protocol
+type Inproc struct {
+	transport.Session
+
+	connMu sync.Mutex
+	//topts are the options of the last Init, guarded by connMu
+	topts *transport.Options
+	conn  *fayeserver.Conn
+	//reader is the connection the read loop is running on, guarded by connMu
+	reader *fayeserver.Conn
+	//closed is set by Close so the read loop can tell a requested close from a failure
+	closed int32
+
+	onMsg           func(msg *message.Message)
+	onError         func(err error)
+	onTransportDown func(err error)
+	onTransportUp   func()
+}
+
+var _ transport.Closer = (*Inproc)(nil)
+
+// Init connects to the server listening on the endpoint, inproc://name
+func (t *Inproc) Init(endpoint string, options *transport.Options) error {
+	serversMu.Lock()
+	server, ok := servers[strings.TrimPrefix(endpoint, scheme)]
+	serversMu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w on %s", ErrNoServer, endpoint)
+	}
+	conn := server.Dial()
+	t.connMu.Lock()
+	t.topts = options
+	previous := t.conn
+	t.conn = conn
+	t.connMu.Unlock()
+	if previous != nil {
+		previous.Close()
+	}
+	atomic.StoreInt32(&t.closed, 0)
+	t.SetConnectionState(transport.StateConnected)
+	return nil
+}
+
+// Name returns the transport name (inproc)
+func (t *Inproc) Name() string {
+	return transportName
+}
+
+// Options return the transport Options
+func (t *Inproc) Options() *transport.Options {
+	t.connMu.Lock()
+	defer t.connMu.Unlock()
+	return t.topts
+}
+
+// Handshake sends the handshake message and waits for the server response
+func (t *Inproc) Handshake(msg *message.Message) (*message.Message, error) {
+	if err := t.SendMessage(msg); err != nil {
+		return nil, err
+	}
+	data, err := t.connection().Read()
+	if err != nil {
+		return nil, err
+	}
+	resps, err := t.Options().Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(resps) == 0 {
+		return nil, errors.New("empty handshake response")
+	}
+	resp := &resps[0]
+	t.Observe(resp)
+	return resp, nil
+}
+
+// Connect starts dispatching the messages received and sends the connect message
+func (t *Inproc) Connect(msg *message.Message) error {
+	t.connMu.Lock()
+	conn := t.conn
+	start := t.reader != conn
+	t.reader = conn
+	t.connMu.Unlock()
+	if start {
+		go t.readWorker(conn)
+	}
+	return t.SendMessage(msg)
+}
+
+// readWorker dispatches the messages received on conn until it is closed, the transport goes down
+// unless it was closed by Close or replaced by a new connection
+func (t *Inproc) readWorker(conn *fayeserver.Conn) {
+	for {
+		data, err := conn.Read()
+		if err != nil {
+			t.connMu.Lock()
+			replaced := t.conn != conn
+			if t.reader == conn {
+				t.reader = nil
+			}
+			t.connMu.Unlock()
+			if replaced || atomic.LoadInt32(&t.closed) == 1 {
+				return
+			}
+			t.SetConnectionState(transport.StateDisconnected)
+			if t.onTransportDown != nil {
+				t.onTransportDown(err)
+			}
+			return
+		}
+		msgs, err := t.Options().Decode(data)
+		if err != nil && t.onError != nil {
+			t.onError(fmt.Errorf("decode: %w", err))
+		}
+		for i := range msgs {
+			t.Observe(&msgs[i])
+			t.onMsg(&msgs[i])
+		}
+	}
+}
+
+// Disconnect sends the disconnect message and closes the connection
+func (t *Inproc) Disconnect(msg *message.Message) error {
+	err := t.SendMessage(msg)
+	if closeErr := t.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Close closes the connection without informing the server
+func (t *Inproc) Close() error {
+	atomic.StoreInt32(&t.closed, 1)
+	t.SetConnectionState(transport.StateDisconnected)
+	conn := t.connection()
+	if conn == nil {
+		//never dialed
+		return nil
+	}
+	return conn.Close()
+}
+
+// SendMessage sends a message to the server
+func (t *Inproc) SendMessage(msg *message.Message) error {
+	return t.SendMessages([]*message.Message{msg})
+}
+
+// SendMessages sends the messages to the server in a single batch
+func (t *Inproc) SendMessages(msgs []*message.Message) error {
+	b, err := t.Options().Encode(msgs)
+	if err != nil {
+		return err
+	}
+	return t.connection().Write(b)
+}
+
+func (t *Inproc) connection() *fayeserver.Conn {
+	t.connMu.Lock()
+	defer t.connMu.Unlock()
+	return t.conn
+}
+
+func (t *Inproc) SetOnMessageReceivedHandler(onMsg func(msg *message.Message)) {
+	t.onMsg = onMsg
+}
+
+func (t *Inproc) SetOnTransportUpHandler(onTransportUp func()) {
+	t.onTransportUp = onTransportUp
+}
+
+func (t *Inproc) SetOnTransportDownHandler(onTransportDown func(err error)) {
+	t.onTransportDown = onTransportDown
+}
+
+func (t *Inproc) SetOnErrorHandler(onError func(err error)) {
+	t.onError = onError
+}
@@ -0,0 +1,64 @@
+package inproc
+
+import (
+	"errors"
+	"github.com/thesyncim/faye/fayeserver"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"testing"
+	"time"
+)
+
+func TestInproc(t *testing.T) {
+	defer Listen("test", fayeserver.NewServer())()
+
+	tr := New()
+	if err := tr.Init("inproc://unknown", &transport.Options{}); !errors.Is(err, ErrNoServer) {
+		t.Fatalf("expecting %v got: %v", ErrNoServer, err)
+	}
+	if err := tr.Init("inproc://test", &transport.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan *message.Message, 10)
+	tr.SetOnMessageReceivedHandler(func(msg *message.Message) {
+		received <- msg
+	})
+	resp, err := tr.Handshake(&message.Message{Channel: message.MetaHandshake, Version: "1.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Successful || tr.ClientID() == "" {
+		t.Fatalf("expecting a clientId got: %+v", resp)
+	}
+	if err = tr.Connect(&message.Message{Channel: message.MetaConnect, ClientId: tr.ClientID()}); err != nil {
+		t.Fatal(err)
+	}
+	err = tr.SendMessages([]*message.Message{
+		{Channel: message.MetaSubscribe, ClientId: tr.ClientID(), Subscription: "/foo", Id: "1"},
+		{Channel: "/foo", ClientId: tr.ClientID(), Data: "hello", Id: "2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var delivered bool
+	for acks := 0; acks < 2 || !delivered; {
+		select {
+		case msg := <-received:
+			switch {
+			case msg.Channel == "/foo" && msg.Data == "hello" && !msg.Successful:
+				delivered = true
+			case msg.Successful && (msg.Id == "1" || msg.Id == "2"):
+				acks++
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expecting the subscribe and publish acks and the delivery")
+		}
+	}
+	if subs := tr.Subscriptions(); len(subs) != 1 || subs[0] != "/foo" {
+		t.Fatalf("expecting /foo subscribed got: %v", subs)
+	}
+	if err = tr.Disconnect(&message.Message{Channel: message.MetaDisconnect, ClientId: tr.ClientID()}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,313 @@
+package longpolling
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+const transportName = "long-polling"
+
+func init() {
+	transport.Register(transportName, New)
+}
+
+//New creates a long-polling transport, e.g. to inject it with fayec.WithTransport
+func New() transport.Transport {
+	return &LongPolling{}
+}
+
+//ErrUnexpectedStatus is returned when the server responds with a non 200 status
+var ErrUnexpectedStatus = errors.New("unexpected http status")
+
+//LongPolling represents an http long-polling transport for the faye protocol: the messages are posted in batches
+//and the response carries the replies. the server holds the /meta/connect request until it has messages to
+//deliver or the advised timeout expires, the dispatcher sends the next connect once it returns. the other
+//messages share a second connection as the Bayeux two connection limit requires: the messages sent while a
+//request is in flight are queued and posted together once it returns, at most Options.MaxBatchSize at once.
+//it works behind the proxies and firewalls blocking websockets.
+type LongPolling struct {
+	transport.Session
+
+	topts    *transport.Options
+	endpoint string
+	client   *http.Client
+
+	mu     sync.Mutex
+	advice *message.Advise
+	//cancel aborts the connect request held by the server
+	cancel context.CancelFunc
+
+	//closed is set by Disconnect so a connect aborted on purpose is not reported as a failure
+	closed int32
+
+	//outgoing are the batches waiting for the request in flight, sending is set while one is
+	outMu    sync.Mutex
+	outgoing []*batch
+	sending  bool
+
+	onMsg           func(msg *message.Message)
+	onError         func(err error)
+	onTransportDown func(err error)
+	onTransportUp   func()
+}
+
+var (
+	_ transport.Transport = (*LongPolling)(nil)
+	_ transport.Closer    = (*LongPolling)(nil)
+)
+
+//Init initializes the transport with the provided options
+func (l *LongPolling) Init(endpoint string, options *transport.Options) error {
+	l.topts = options
+	l.endpoint = endpoint
+	l.client = options.HTTPClient()
+	atomic.StoreInt32(&l.closed, 0)
+	l.SetConnectionState(transport.StateConnected)
+	return nil
+}
+
+//Name returns the transport name (long-polling)
+func (l *LongPolling) Name() string {
+	return transportName
+}
+
+//Options return the transport Options
+func (l *LongPolling) Options() *transport.Options {
+	return l.topts
+}
+
+//Handshake initiates a connection negotiation by sending a message to the /meta/handshake channel.
+func (l *LongPolling) Handshake(msg *message.Message) (*message.Message, error) {
+	resp, err := l.post(context.Background(), []*message.Message{msg})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	l.SetHandshakeInfo(transport.HandshakeInfo{StatusCode: resp.StatusCode, Header: resp.Header})
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := l.topts.Decode(body)
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		return nil, errors.New("empty handshake response")
+	}
+	l.Observe(&msgs[0])
+	return &msgs[0], nil
+}
+
+//Connect posts the connect message in background, the server holds the request until it has messages to
+//deliver. the response is dispatched and a failed poll brings the transport down.
+func (l *LongPolling) Connect(msg *message.Message) error {
+	l.mu.Lock()
+	_, requestTimeout := l.topts.PollTiming(l.advice)
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	l.cancel = cancel
+	l.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		err := l.send(ctx, []*message.Message{msg})
+		if err == nil || atomic.LoadInt32(&l.closed) == 1 {
+			return
+		}
+		l.SetConnectionState(transport.StateDisconnected)
+		if l.onTransportDown != nil {
+			l.onTransportDown(err)
+		}
+	}()
+	return nil
+}
+
+//SendMessage posts the message, the server response is dispatched
+func (l *LongPolling) SendMessage(m *message.Message) error {
+	return l.SendMessages([]*message.Message{m})
+}
+
+//SendMessages posts the messages, along with the ones sent concurrently, and returns once the server response
+//is dispatched
+func (l *LongPolling) SendMessages(msgs []*message.Message) error {
+	b := &batch{msgs: msgs, done: make(chan error, 1)}
+	l.outMu.Lock()
+	l.outgoing = append(l.outgoing, b)
+	start := !l.sending
+	l.sending = true
+	l.outMu.Unlock()
+	if start {
+		go l.flush()
+	}
+	return <-b.done
+}
+
+//batch holds the messages of a SendMessages call, done receives the outcome of their request
+type batch struct {
+	msgs []*message.Message
+	done chan error
+}
+
+//flush posts the queued batches one request at a time until the queue is empty
+func (l *LongPolling) flush() {
+	for {
+		l.outMu.Lock()
+		batches := l.nextBatches()
+		if len(batches) == 0 {
+			l.sending = false
+			l.outMu.Unlock()
+			return
+		}
+		l.outMu.Unlock()
+
+		var msgs []*message.Message
+		for i := range batches {
+			msgs = append(msgs, batches[i].msgs...)
+		}
+		err := l.sendBatched(msgs)
+		for i := range batches {
+			batches[i].done <- err
+		}
+	}
+}
+
+//nextBatches dequeues the batches fitting in a request, at least one. outMu must be held
+func (l *LongPolling) nextBatches() []*batch {
+	limit := l.topts.MaxBatchSize
+	var n, count int
+	for n < len(l.outgoing) {
+		if n > 0 && limit > 0 && count+len(l.outgoing[n].msgs) > limit {
+			break
+		}
+		count += len(l.outgoing[n].msgs)
+		n++
+	}
+	batches := l.outgoing[:n:n]
+	l.outgoing = l.outgoing[n:]
+	return batches
+}
+
+//sendBatched posts the messages in requests of at most MaxBatchSize messages
+func (l *LongPolling) sendBatched(msgs []*message.Message) error {
+	limit := l.topts.MaxBatchSize
+	if limit <= 0 {
+		limit = len(msgs)
+	}
+	for len(msgs) > 0 {
+		n := limit
+		if n > len(msgs) {
+			n = len(msgs)
+		}
+		if err := l.send(context.Background(), msgs[:n]); err != nil {
+			return err
+		}
+		msgs = msgs[n:]
+	}
+	return nil
+}
+
+//Disconnect aborts the held connect and informs the server to remove any client-related state.
+func (l *LongPolling) Disconnect(m *message.Message) error {
+	l.stop()
+	err := l.SendMessage(m)
+	l.SetConnectionState(transport.StateDisconnected)
+	return err
+}
+
+//Close aborts the held connect without informing the server
+func (l *LongPolling) Close() error {
+	l.stop()
+	l.SetConnectionState(transport.StateDisconnected)
+	return nil
+}
+
+//stop marks the transport closed and aborts the held connect
+func (l *LongPolling) stop() {
+	atomic.StoreInt32(&l.closed, 1)
+	l.mu.Lock()
+	if l.cancel != nil {
+		l.cancel()
+	}
+	l.mu.Unlock()
+}
+
+//send posts the messages and dispatches the response
+func (l *LongPolling) send(ctx context.Context, msgs []*message.Message) error {
+	resp, err := l.post(ctx, msgs)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(body)) > 0 {
+		l.decodeAndDispatch(body)
+	}
+	return nil
+}
+
+//post sends the messages in a single request
+func (l *LongPolling) post(ctx context.Context, msgs []*message.Message) (*http.Response, error) {
+	body, err := l.topts.Encode(msgs)
+	if err != nil {
+		return nil, err
+	}
+	req, err := l.topts.NewRequest(ctx, l.endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrUnexpectedStatus, resp.Status)
+	}
+	return resp, nil
+}
+
+//decodeAndDispatch dispatches the messages of a batch, decoding errors are reported
+func (l *LongPolling) decodeAndDispatch(b []byte) {
+	batch, err := l.topts.Decode(b)
+	if err != nil && l.onError != nil {
+		l.onError(fmt.Errorf("decode: %w", err))
+	}
+	for i := range batch {
+		msg := &batch[i]
+		if msg.Channel == message.MetaConnect && msg.Advice != nil {
+			l.mu.Lock()
+			l.advice = msg.Advice
+			l.mu.Unlock()
+		}
+		l.Observe(msg)
+		l.onMsg(msg)
+	}
+}
+
+func (l *LongPolling) SetOnMessageReceivedHandler(onMsg func(*message.Message)) {
+	l.onMsg = onMsg
+}
+
+func (l *LongPolling) SetOnTransportUpHandler(onTransportUp func()) {
+	l.onTransportUp = onTransportUp
+}
+
+func (l *LongPolling) SetOnTransportDownHandler(onTransportDown func(err error)) {
+	l.onTransportDown = onTransportDown
+}
+
+func (l *LongPolling) SetOnErrorHandler(onError func(err error)) {
+	l.onError = onError
+}
@@ -0,0 +1,229 @@
+package longpolling
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/thesyncim/faye/codec/msgpack"
+	"github.com/thesyncim/faye/conformance"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//pollingServer handshakes, acks the publishes and answers every /meta/connect with a delivery,
+//holding the connects after the first until the client goes away
+func pollingServer(t *testing.T) *httptest.Server {
+	var connects int32
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msgs []message.Message
+		if err := json.NewDecoder(r.Body).Decode(&msgs); err != nil {
+			t.Error(err)
+			return
+		}
+		enc := json.NewEncoder(w)
+		switch msgs[0].Channel {
+		case message.MetaHandshake:
+			enc.Encode([]message.Message{{Channel: message.MetaHandshake, Successful: true, ClientId: "abc"}})
+		case message.MetaConnect:
+			if atomic.AddInt32(&connects, 1) > 1 {
+				<-r.Context().Done()
+				return
+			}
+			advice := &message.Advise{Reconnect: message.ReconnectRetry, Timeout: time.Second}
+			enc.Encode([]message.Message{
+				{Channel: "/foo", Data: "a"},
+				{Channel: message.MetaConnect, Id: msgs[0].Id, Successful: true, Advice: advice},
+			})
+		case "/fail":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			enc.Encode([]message.Message{{Channel: msgs[0].Channel, Id: msgs[0].Id, Successful: true}})
+		}
+	}))
+}
+
+func TestLongPolling(t *testing.T) {
+	srv := pollingServer(t)
+	defer srv.Close()
+
+	l := New().(*LongPolling)
+	received := make(chan *message.Message, 10)
+	l.SetOnMessageReceivedHandler(func(msg *message.Message) {
+		received <- msg
+	})
+	down := make(chan error, 1)
+	l.SetOnTransportDownHandler(func(err error) {
+		down <- err
+	})
+	if err := l.Init(srv.URL, &transport.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := l.Handshake(&message.Message{Channel: message.MetaHandshake, SupportedConnectionTypes: []string{l.Name()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ClientId != "abc" || l.ClientID() != "abc" {
+		t.Fatalf("expecting clientId abc got: %s", resp.ClientId)
+	}
+
+	if err = l.Connect(&message.Message{Channel: message.MetaConnect, ClientId: "abc", Id: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"/foo", message.MetaConnect} {
+		select {
+		case msg := <-received:
+			if msg.Channel != expected {
+				t.Fatalf("expecting %s got: %s", expected, msg.Channel)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expecting the polled message on %s", expected)
+		}
+	}
+
+	//the next connect is held by the server, messages are posted meanwhile
+	if err = l.Connect(&message.Message{Channel: message.MetaConnect, ClientId: "abc", Id: "2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = l.SendMessage(&message.Message{Channel: "/foo", Id: "3", Data: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if ack := <-received; ack.Id != "3" || !ack.Successful {
+		t.Fatalf("expecting the publish ack got: %+v", ack)
+	}
+	if err = l.SendMessage(&message.Message{Channel: "/fail", Id: "4"}); !errors.Is(err, ErrUnexpectedStatus) {
+		t.Fatalf("expecting %v got: %v", ErrUnexpectedStatus, err)
+	}
+
+	//aborting the held connect is not a failure
+	if err = l.Disconnect(&message.Message{Channel: message.MetaDisconnect, ClientId: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	if l.ConnectionState() != transport.StateDisconnected {
+		t.Fatal("expecting the transport disconnected")
+	}
+	select {
+	case err = <-down:
+		t.Fatalf("expecting no transport down got: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestLongPolling_Batching(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		sizes    []int
+		inFlight int32
+		overlap  int32
+	)
+	received := make(chan struct{})
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&inFlight, 1) > 1 {
+			atomic.StoreInt32(&overlap, 1)
+		}
+		defer atomic.AddInt32(&inFlight, -1)
+		var msgs []message.Message
+		if err := json.NewDecoder(r.Body).Decode(&msgs); err != nil {
+			t.Error(err)
+			return
+		}
+		mu.Lock()
+		sizes = append(sizes, len(msgs))
+		first := len(sizes) == 1
+		mu.Unlock()
+		if first {
+			//hold the first request so the next messages are queued
+			close(received)
+			<-release
+		}
+		acks := make([]message.Message, len(msgs))
+		for i := range msgs {
+			acks[i] = message.Message{Channel: msgs[i].Channel, Id: msgs[i].Id, Successful: true}
+		}
+		json.NewEncoder(w).Encode(acks)
+	}))
+	defer srv.Close()
+
+	l := New().(*LongPolling)
+	var acks int32
+	l.SetOnMessageReceivedHandler(func(msg *message.Message) {
+		atomic.AddInt32(&acks, 1)
+	})
+	if err := l.Init(srv.URL, &transport.Options{MaxBatchSize: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	send := func(id string) {
+		defer wg.Done()
+		if err := l.SendMessage(&message.Message{Channel: "/foo", Id: id}); err != nil {
+			t.Error(err)
+		}
+	}
+	wg.Add(1)
+	go send("0")
+	<-received
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		wg.Add(1)
+		go send(id)
+	}
+	for queued := 0; queued < 5; {
+		time.Sleep(time.Millisecond)
+		l.outMu.Lock()
+		queued = len(l.outgoing)
+		l.outMu.Unlock()
+	}
+	close(release)
+	wg.Wait()
+
+	if expected := []int{1, 2, 2, 1}; !reflect.DeepEqual(sizes, expected) {
+		t.Fatalf("expecting the queued messages posted in batches of 2 got: %v", sizes)
+	}
+	if atomic.LoadInt32(&overlap) == 1 {
+		t.Fatal("expecting a single request in flight")
+	}
+	if n := atomic.LoadInt32(&acks); n != 6 {
+		t.Fatalf("expecting 6 acks got: %d", n)
+	}
+}
+
+func TestLongPolling_Codec(t *testing.T) {
+	c := msgpack.New()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != c.ContentType() {
+			t.Errorf("expecting content type %s got: %s", c.ContentType(), ct)
+		}
+		body, _ := io.ReadAll(r.Body)
+		msgs, err := c.Unmarshal(body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		resp, _ := c.Marshal([]message.Message{{Channel: msgs[0].Channel, Successful: true, ClientId: "abc"}})
+		w.Write(resp)
+	}))
+	defer srv.Close()
+
+	l := New().(*LongPolling)
+	if err := l.Init(srv.URL, &transport.Options{Codec: c}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := l.Handshake(&message.Message{Channel: message.MetaHandshake})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ClientId != "abc" {
+		t.Fatalf("expecting clientId abc got: %s", resp.ClientId)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, New, "http")
+}
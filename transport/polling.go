@@ -0,0 +1,56 @@
+package transport
+
+import (
+	"github.com/thesyncim/faye/message"
+	"time"
+)
+
+const (
+	//DefaultPollRequestTimeout is the polling request timeout used when neither the options nor the advice set one
+	DefaultPollRequestTimeout = 60 * time.Second
+	//pollGrace is added to the server hold timeout so the request doesn't expire before the server responds
+	pollGrace = 10 * time.Second
+)
+
+//AdvicePolicy decides what happens when the server advice conflicts with the local polling limits
+type AdvicePolicy int
+
+const (
+	//PreferLocalLimits bounds the server advice by the local limits: the interval is raised to MinPollInterval
+	//and the configured PollRequestTimeout is kept even if the server may hold the request longer.
+	PreferLocalLimits AdvicePolicy = iota
+	//PreferAdvice follows the server advice: the advised interval is used even if below MinPollInterval
+	//and the request timeout is extended to cover the advised hold timeout.
+	PreferAdvice
+)
+
+//PollTiming returns the delay before the next poll and the client side timeout of the poll request,
+//resolving the server advice against the polling limits of the options
+func (o *Options) PollTiming(advice *message.Advise) (interval time.Duration, requestTimeout time.Duration) {
+	var hold time.Duration
+	if advice != nil {
+		interval = advice.Interval
+		hold = advice.Timeout
+	}
+
+	requestTimeout = o.PollRequestTimeout
+	needed := DefaultPollRequestTimeout
+	if hold > 0 {
+		needed = hold + pollGrace
+	}
+
+	switch o.AdviceConflict {
+	case PreferAdvice:
+		if requestTimeout < needed {
+			requestTimeout = needed
+		}
+	default:
+		if interval < o.MinPollInterval {
+			interval = o.MinPollInterval
+		}
+		if requestTimeout == 0 {
+			requestTimeout = needed
+		}
+	}
+	return interval, requestTimeout
+}
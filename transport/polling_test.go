@@ -0,0 +1,60 @@
+package transport
+
+import (
+	"github.com/thesyncim/faye/message"
+	"testing"
+	"time"
+)
+
+func TestOptions_PollTiming(t *testing.T) {
+	tests := []struct {
+		name           string
+		opts           Options
+		advice         *message.Advise
+		interval       time.Duration
+		requestTimeout time.Duration
+	}{
+		{
+			name:           "defaults without advice",
+			requestTimeout: DefaultPollRequestTimeout,
+		},
+		{
+			name:           "advice only",
+			advice:         &message.Advise{Interval: time.Second, Timeout: 45 * time.Second},
+			interval:       time.Second,
+			requestTimeout: 55 * time.Second,
+		},
+		{
+			name:           "local limits bound the advice",
+			opts:           Options{MinPollInterval: 2 * time.Second, PollRequestTimeout: 30 * time.Second},
+			advice:         &message.Advise{Interval: 0, Timeout: 45 * time.Second},
+			interval:       2 * time.Second,
+			requestTimeout: 30 * time.Second,
+		},
+		{
+			name:           "advice wins over local limits",
+			opts:           Options{MinPollInterval: 2 * time.Second, PollRequestTimeout: 30 * time.Second, AdviceConflict: PreferAdvice},
+			advice:         &message.Advise{Interval: 0, Timeout: 45 * time.Second},
+			interval:       0,
+			requestTimeout: 55 * time.Second,
+		},
+		{
+			name:           "advice within local limits",
+			opts:           Options{MinPollInterval: time.Second, PollRequestTimeout: 90 * time.Second, AdviceConflict: PreferAdvice},
+			advice:         &message.Advise{Interval: 5 * time.Second, Timeout: 45 * time.Second},
+			interval:       5 * time.Second,
+			requestTimeout: 90 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interval, requestTimeout := tt.opts.PollTiming(tt.advice)
+			if interval != tt.interval {
+				t.Errorf("interval = %v, want %v", interval, tt.interval)
+			}
+			if requestTimeout != tt.requestTimeout {
+				t.Errorf("requestTimeout = %v, want %v", requestTimeout, tt.requestTimeout)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package transport
+
+import (
+	"github.com/thesyncim/faye/message"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+//ConnectionState represents the state of the transport underlying connection
+type ConnectionState int32
+
+const (
+	//StateDisconnected the transport has no usable connection
+	StateDisconnected ConnectionState = iota
+	//StateConnected the transport connection is established
+	StateConnected
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case StateConnected:
+		return "connected"
+	default:
+		return "disconnected"
+	}
+}
+
+//HandshakeInfo describes the http response to the transport connection handshake, e.g. the websocket upgrade.
+//load balancers often communicate affinity and limits in its headers.
+type HandshakeInfo struct {
+	StatusCode  int
+	Header      http.Header
+	Subprotocol string
+}
+
+//Session tracks the protocol state observed by a transport: the clientId assigned by the server,
+//the subscriptions acknowledged by it, the connection state and the connection handshake response.
+//transports embed it and Observe every message received from the server.
+type Session struct {
+	mu            sync.Mutex
+	clientID      string
+	subscriptions map[string]struct{}
+	state         ConnectionState
+	handshake     HandshakeInfo
+}
+
+//Observe updates the session from a message received from the server
+func (s *Session) Observe(msg *message.Message) {
+	if !msg.Successful {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch msg.Channel {
+	case message.MetaHandshake:
+		//a new clientId invalidates the previous session subscriptions
+		s.clientID = msg.ClientId
+		s.subscriptions = nil
+	case message.MetaSubscribe:
+		if s.subscriptions == nil {
+			s.subscriptions = map[string]struct{}{}
+		}
+		s.subscriptions[msg.Subscription] = struct{}{}
+	case message.MetaUnsubscribe:
+		delete(s.subscriptions, msg.Subscription)
+	case message.MetaDisconnect:
+		s.clientID = ""
+		s.subscriptions = nil
+	}
+}
+
+//SetConnectionState updates the connection state
+func (s *Session) SetConnectionState(state ConnectionState) {
+	s.mu.Lock()
+	s.state = state
+	s.mu.Unlock()
+}
+
+//ClientID returns the clientId assigned by the server during the handshake
+func (s *Session) ClientID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.clientID
+}
+
+//Subscriptions returns the sorted list of channels the server acknowledged as subscribed
+func (s *Session) Subscriptions() []string {
+	s.mu.Lock()
+	subs := make([]string, 0, len(s.subscriptions))
+	for channel := range s.subscriptions {
+		subs = append(subs, channel)
+	}
+	s.mu.Unlock()
+	sort.Strings(subs)
+	return subs
+}
+
+//ConnectionState returns the state of the underlying connection
+func (s *Session) ConnectionState() ConnectionState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+//SetHandshakeInfo records the response to the connection handshake
+func (s *Session) SetHandshakeInfo(info HandshakeInfo) {
+	s.mu.Lock()
+	s.handshake = info
+	s.mu.Unlock()
+}
+
+//HandshakeInfo returns the response to the last connection handshake
+func (s *Session) HandshakeInfo() HandshakeInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info := s.handshake
+	info.Header = info.Header.Clone()
+	return info
+}
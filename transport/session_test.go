@@ -0,0 +1,87 @@
+package transport
+
+import (
+	"github.com/thesyncim/faye/message"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestSession_Observe(t *testing.T) {
+	tests := []struct {
+		name     string
+		msgs     []*message.Message
+		clientID string
+		subs     []string
+	}{
+		{
+			name: "handshake",
+			msgs: []*message.Message{
+				{Channel: message.MetaHandshake, Successful: true, ClientId: "abc"},
+			},
+			clientID: "abc",
+			subs:     []string{},
+		},
+		{
+			name: "subscribe and unsubscribe",
+			msgs: []*message.Message{
+				{Channel: message.MetaHandshake, Successful: true, ClientId: "abc"},
+				{Channel: message.MetaSubscribe, Successful: true, Subscription: "/foo"},
+				{Channel: message.MetaSubscribe, Successful: true, Subscription: "/bar/**"},
+				{Channel: message.MetaSubscribe, Successful: false, Subscription: "/denied"},
+				{Channel: message.MetaUnsubscribe, Successful: true, Subscription: "/foo"},
+			},
+			clientID: "abc",
+			subs:     []string{"/bar/**"},
+		},
+		{
+			name: "rehandshake clears subscriptions",
+			msgs: []*message.Message{
+				{Channel: message.MetaHandshake, Successful: true, ClientId: "abc"},
+				{Channel: message.MetaSubscribe, Successful: true, Subscription: "/foo"},
+				{Channel: message.MetaHandshake, Successful: true, ClientId: "def"},
+			},
+			clientID: "def",
+			subs:     []string{},
+		},
+		{
+			name: "disconnect",
+			msgs: []*message.Message{
+				{Channel: message.MetaHandshake, Successful: true, ClientId: "abc"},
+				{Channel: message.MetaSubscribe, Successful: true, Subscription: "/foo"},
+				{Channel: message.MetaDisconnect, Successful: true},
+			},
+			clientID: "",
+			subs:     []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s Session
+			for i := range tt.msgs {
+				s.Observe(tt.msgs[i])
+			}
+			if s.ClientID() != tt.clientID {
+				t.Errorf("ClientID() = %s, want %s", s.ClientID(), tt.clientID)
+			}
+			if !reflect.DeepEqual(s.Subscriptions(), tt.subs) {
+				t.Errorf("Subscriptions() = %v, want %v", s.Subscriptions(), tt.subs)
+			}
+		})
+	}
+}
+
+func TestSession_HandshakeInfo(t *testing.T) {
+	var s Session
+	header := http.Header{"X-Affinity": []string{"node-1"}}
+	s.SetHandshakeInfo(HandshakeInfo{StatusCode: http.StatusSwitchingProtocols, Header: header, Subprotocol: "bayeux"})
+
+	info := s.HandshakeInfo()
+	if info.StatusCode != http.StatusSwitchingProtocols || info.Subprotocol != "bayeux" {
+		t.Fatalf("unexpected handshake info: %+v", info)
+	}
+	info.Header.Set("X-Affinity", "node-2")
+	if got := s.HandshakeInfo().Header.Get("X-Affinity"); got != "node-1" {
+		t.Fatalf("expecting the recorded headers to be left untouched got: %s", got)
+	}
+}
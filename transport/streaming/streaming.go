@@ -0,0 +1,283 @@
+package streaming
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/thesyncim/faye/clock"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+const transportName = "http-streaming"
+
+func init() {
+	transport.Register(transportName, New)
+}
+
+//New creates a http streaming transport, e.g. to inject it with fayec.WithTransport
+func New() transport.Transport {
+	return &Streaming{}
+}
+
+//ErrUnexpectedStatus is returned when the server responds with a non 200 status
+var ErrUnexpectedStatus = errors.New("unexpected http status")
+
+//ErrUnsupportedCodec is returned by Init when the options codec doesn't encode json, the stream is split in json batches
+var ErrUnsupportedCodec = errors.New("http streaming requires a json codec")
+
+//Streaming represents an http streaming transport for the faye protocol: the response to /meta/connect is a
+//single long lived chunked response carrying many json message batches, the other messages are posted
+//in their own request. when the server ends the stream the connect is sent again.
+type Streaming struct {
+	transport.Session
+
+	topts    *transport.Options
+	endpoint string
+	client   *http.Client
+
+	mu     sync.Mutex
+	advice *message.Advise
+	//cancel stops the stream
+	cancel context.CancelFunc
+
+	//closed is set by Disconnect so the stream can tell a requested close from a failure
+	closed int32
+	//streaming is set while the stream is running, so repeated connects don't start another one
+	streaming int32
+
+	onMsg           func(msg *message.Message)
+	onError         func(err error)
+	onTransportDown func(err error)
+	onTransportUp   func()
+}
+
+var (
+	_ transport.Transport = (*Streaming)(nil)
+	_ transport.Closer    = (*Streaming)(nil)
+)
+
+//Init initializes the transport with the provided options
+func (s *Streaming) Init(endpoint string, options *transport.Options) error {
+	if !options.IsJSON() {
+		return ErrUnsupportedCodec
+	}
+	s.topts = options
+	s.endpoint = endpoint
+	s.client = options.HTTPClient()
+	atomic.StoreInt32(&s.closed, 0)
+	s.SetConnectionState(transport.StateConnected)
+	return nil
+}
+
+//Name returns the transport name (http-streaming)
+func (s *Streaming) Name() string {
+	return transportName
+}
+
+//Options return the transport Options
+func (s *Streaming) Options() *transport.Options {
+	return s.topts
+}
+
+//Handshake initiates a connection negotiation by sending a message to the /meta/handshake channel.
+func (s *Streaming) Handshake(msg *message.Message) (*message.Message, error) {
+	resp, err := s.post(context.Background(), []*message.Message{msg})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	s.SetHandshakeInfo(transport.HandshakeInfo{StatusCode: resp.StatusCode, Header: resp.Header})
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := s.topts.Decode(body)
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		return nil, errors.New("empty handshake response")
+	}
+	s.Observe(&msgs[0])
+	return &msgs[0], nil
+}
+
+//Connect starts the stream with the connect message, the messages received are dispatched until Disconnect
+func (s *Streaming) Connect(msg *message.Message) error {
+	if !atomic.CompareAndSwapInt32(&s.streaming, 0, 1) {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+	go func() {
+		err := s.stream(ctx, msg)
+		atomic.StoreInt32(&s.streaming, 0)
+		cancel()
+		if err != nil && s.onTransportDown != nil {
+			s.onTransportDown(err)
+		}
+	}()
+	return nil
+}
+
+//stream sends the connect message and dispatches the streamed batches, connecting again when the server
+//ends the stream, after the advised interval
+func (s *Streaming) stream(ctx context.Context, msg *message.Message) error {
+	for {
+		err := s.readStream(ctx, msg)
+		if atomic.LoadInt32(&s.closed) == 1 {
+			return nil
+		}
+		if err != nil {
+			s.SetConnectionState(transport.StateDisconnected)
+			return err
+		}
+		s.mu.Lock()
+		interval, _ := s.topts.PollTiming(s.advice)
+		s.mu.Unlock()
+		timer := clock.Or(s.topts.Clock).NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C():
+		}
+	}
+}
+
+//readStream posts the connect message and dispatches the message batches of the response until it ends
+func (s *Streaming) readStream(ctx context.Context, msg *message.Message) error {
+	resp, err := s.post(ctx, []*message.Message{msg})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var raw json.RawMessage
+		if err = dec.Decode(&raw); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		s.decodeAndDispatch(raw)
+	}
+}
+
+//SendMessage posts the message, the server response is dispatched
+func (s *Streaming) SendMessage(m *message.Message) error {
+	return s.SendMessages([]*message.Message{m})
+}
+
+//SendMessages posts the messages in a single request, the server response is dispatched
+func (s *Streaming) SendMessages(msgs []*message.Message) error {
+	resp, err := s.post(context.Background(), msgs)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(body)) > 0 {
+		s.decodeAndDispatch(body)
+	}
+	return nil
+}
+
+//Disconnect stops the stream and informs the server to remove any client-related state.
+func (s *Streaming) Disconnect(m *message.Message) error {
+	s.stop()
+	err := s.SendMessage(m)
+	s.SetConnectionState(transport.StateDisconnected)
+	return err
+}
+
+//Close stops the stream without informing the server
+func (s *Streaming) Close() error {
+	s.stop()
+	s.SetConnectionState(transport.StateDisconnected)
+	return nil
+}
+
+//stop marks the transport closed and stops the stream
+func (s *Streaming) stop() {
+	atomic.StoreInt32(&s.closed, 1)
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.mu.Unlock()
+}
+
+//post sends the messages in a single request
+func (s *Streaming) post(ctx context.Context, msgs []*message.Message) (*http.Response, error) {
+	body, err := s.topts.Encode(msgs)
+	if err != nil {
+		return nil, err
+	}
+	req, err := s.topts.NewRequest(ctx, s.endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrUnexpectedStatus, resp.Status)
+	}
+	return resp, nil
+}
+
+//decodeAndDispatch dispatches the messages of a batch, decoding errors are reported
+func (s *Streaming) decodeAndDispatch(b []byte) {
+	batch, err := s.topts.Decode(b)
+	if err != nil && s.onError != nil {
+		s.onError(fmt.Errorf("decode: %w", err))
+	}
+	s.dispatch(batch)
+}
+
+//dispatch observes and delivers the messages received from the server
+func (s *Streaming) dispatch(batch []message.Message) {
+	for i := range batch {
+		msg := &batch[i]
+		if msg.Channel == message.MetaConnect && msg.Advice != nil {
+			s.mu.Lock()
+			s.advice = msg.Advice
+			s.mu.Unlock()
+		}
+		s.Observe(msg)
+		s.onMsg(msg)
+	}
+}
+
+func (s *Streaming) SetOnMessageReceivedHandler(onMsg func(*message.Message)) {
+	s.onMsg = onMsg
+}
+
+func (s *Streaming) SetOnTransportUpHandler(onTransportUp func()) {
+	s.onTransportUp = onTransportUp
+}
+
+func (s *Streaming) SetOnTransportDownHandler(onTransportDown func(err error)) {
+	s.onTransportDown = onTransportDown
+}
+
+func (s *Streaming) SetOnErrorHandler(onError func(err error)) {
+	s.onError = onError
+}
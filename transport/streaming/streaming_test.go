@@ -0,0 +1,89 @@
+package streaming
+
+import (
+	"encoding/json"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+//streamingServer handshakes, acks the publishes and streams two batches on /meta/connect, holding the stream
+func streamingServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msgs []message.Message
+		if err := json.NewDecoder(r.Body).Decode(&msgs); err != nil {
+			t.Error(err)
+			return
+		}
+		enc := json.NewEncoder(w)
+		switch msgs[0].Channel {
+		case message.MetaHandshake:
+			enc.Encode([]message.Message{{Channel: message.MetaHandshake, Successful: true, ClientId: "abc"}})
+		case message.MetaConnect:
+			flusher := w.(http.Flusher)
+			enc.Encode([]message.Message{{Channel: "/foo", Data: "a"}})
+			flusher.Flush()
+			enc.Encode([]message.Message{{Channel: "/foo", Data: "b"}, {Channel: "/foo", Data: "c"}})
+			flusher.Flush()
+			<-r.Context().Done()
+		default:
+			enc.Encode([]message.Message{{Channel: msgs[0].Channel, Id: msgs[0].Id, Successful: true}})
+		}
+	}))
+}
+
+func TestStreaming(t *testing.T) {
+	srv := streamingServer(t)
+	defer srv.Close()
+
+	s := &Streaming{}
+	received := make(chan *message.Message, 10)
+	s.SetOnMessageReceivedHandler(func(msg *message.Message) {
+		received <- msg
+	})
+	if err := s.Init(srv.URL, &transport.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s.Handshake(&message.Message{Channel: message.MetaHandshake})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ClientId != "abc" || s.ClientID() != "abc" {
+		t.Fatalf("expecting clientId abc got: %s", resp.ClientId)
+	}
+	if s.HandshakeInfo().StatusCode != http.StatusOK {
+		t.Fatalf("expecting the handshake status got: %d", s.HandshakeInfo().StatusCode)
+	}
+
+	if err = s.Connect(&message.Message{Channel: message.MetaConnect, ClientId: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"a", "b", "c"} {
+		select {
+		case msg := <-received:
+			if msg.Data != expected {
+				t.Fatalf("expecting %s got: %v", expected, msg.Data)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expecting the streamed message %s", expected)
+		}
+	}
+
+	//messages sent while the stream is held get their own response
+	if err = s.SendMessage(&message.Message{Channel: "/foo", Id: "1", Data: "d"}); err != nil {
+		t.Fatal(err)
+	}
+	if ack := <-received; ack.Id != "1" || !ack.Successful {
+		t.Fatalf("expecting the publish ack got: %+v", ack)
+	}
+
+	if err = s.Disconnect(&message.Message{Channel: message.MetaDisconnect, ClientId: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	if s.ConnectionState() != transport.StateDisconnected {
+		t.Fatal("expecting the transport disconnected")
+	}
+}
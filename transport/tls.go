@@ -0,0 +1,22 @@
+package transport
+
+import (
+	"crypto/tls"
+)
+
+//TLSConfig returns the tls configuration to dial the server with, ServerName overrides the server name
+//of the TLS option so the certificate can be verified when dialing an ip address or through a tunnel.
+//it returns nil when neither is set, leaving the transport defaults.
+func (o *Options) TLSConfig() *tls.Config {
+	if o.ServerName == "" {
+		return o.TLS
+	}
+	var cfg *tls.Config
+	if o.TLS != nil {
+		cfg = o.TLS.Clone()
+	} else {
+		cfg = &tls.Config{}
+	}
+	cfg.ServerName = o.ServerName
+	return cfg
+}
@@ -0,0 +1,29 @@
+package transport
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestOptions_TLSConfig(t *testing.T) {
+	if cfg := (&Options{}).TLSConfig(); cfg != nil {
+		t.Fatalf("expecting nil config got: %v", cfg)
+	}
+
+	base := &tls.Config{ServerName: "dial.example.com", InsecureSkipVerify: true}
+	if cfg := (&Options{TLS: base}).TLSConfig(); cfg != base {
+		t.Fatal("expecting the TLS option without a server name override")
+	}
+
+	cfg := (&Options{TLS: base, ServerName: "cert.example.com"}).TLSConfig()
+	if cfg.ServerName != "cert.example.com" || !cfg.InsecureSkipVerify {
+		t.Fatalf("expecting the overridden server name on a copy of the TLS option got: %v", cfg.ServerName)
+	}
+	if base.ServerName != "dial.example.com" {
+		t.Fatal("expecting the TLS option to be left untouched")
+	}
+
+	if cfg := (&Options{ServerName: "cert.example.com"}).TLSConfig(); cfg.ServerName != "cert.example.com" {
+		t.Fatalf("expecting server name cert.example.com got: %v", cfg.ServerName)
+	}
+}
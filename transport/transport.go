@@ -1,23 +1,78 @@
 package transport
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/thesyncim/faye/clock"
+	"github.com/thesyncim/faye/codec"
 	"github.com/thesyncim/faye/message"
+	"net"
 	"net/http"
+	"net/url"
+	"sort"
+	"sync"
 	"time"
 )
 
 //Options represents the connection options to be used by a transport
 type Options struct {
 	Headers http.Header
+	//HeaderFunc, when set, returns headers added to Headers on every connection and polling request,
+	//e.g. an Authorization header refreshed before it expires. see RequestHeaders
+	HeaderFunc func() (http.Header, error)
+	//Cookies stores the cookies of the server responses, see CookieJar
 	Cookies http.CookieJar
 	TLS     *tls.Config
+	//ServerName overrides the TLS server name verified and sent as SNI, see TLSConfig
+	ServerName string
+	//NetDialContext, when set, creates the network connections of the transport, e.g. through a tunnel
+	NetDialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+	//Proxy returns the proxy to connect through, see ProxyFunc
+	Proxy func(*http.Request) (*url.URL, error)
 
 	MaxRetries    int
 	RetryInterval time.Duration
 	DialDeadline  time.Duration
-	ReadDeadline  time.Duration
+	//ReadDeadline bounds the wait for every frame read by the websocket transport, it must exceed the
+	//connect timeout advised by the server. 0 waits forever
+	ReadDeadline time.Duration
+	//WriteDeadline bounds every frame written by the websocket transport, 0 waits forever
 	WriteDeadline time.Duration
+
+	//KeepAliveInterval is the interval the websocket transport pings the server at, 0 doesn't ping.
+	//the transport goes down with ErrKeepAliveTimeout when the server doesn't answer within KeepAliveTimeout,
+	//a KeepAliveInterval if 0
+	KeepAliveInterval time.Duration
+	KeepAliveTimeout  time.Duration
+
+	//polling transports only, see PollTiming
+	PollRequestTimeout time.Duration
+	MinPollInterval    time.Duration
+	AdviceConflict     AdvicePolicy
+	//MaxBatchSize bounds the messages posted in a request by the long-polling transport, 0 doesn't bound them
+	MaxBatchSize int
+	//H2C speaks HTTP/2 with prior knowledge to plain http endpoints, see HTTPClient
+	H2C bool
+	//GzipRequestThreshold compresses the request bodies of at least this many bytes, 0 disables it. see NewRequest
+	GzipRequestThreshold int
+	//WebsocketCompression negotiates the permessage-deflate extension with the server, the frames are compressed
+	//when the server accepts it
+	WebsocketCompression bool
+	//Clock drives the timers of the client and the transports, nil uses the system clock
+	Clock clock.Clock
+	//Parser decodes the messages received, see Decode
+	Parser *message.Parser
+	//Codec encodes and decodes the batches of messages, nil uses json and the Parser. see Encode and Decode
+	Codec codec.Codec
+}
+
+//Closer is implemented by the transports able to close their connection without sending a /meta/disconnect,
+//so the client can send it as any other message and wait for the server response before closing
+type Closer interface {
+	//Close closes the connection, the transport can't be used afterwards
+	Close() error
 }
 
 //Transport represents the transport to be used to comunicate with the faye server
@@ -38,6 +93,8 @@ type Transport interface {
 	Disconnect(msg *message.Message) error
 	//SendMessage sens a message through the transport
 	SendMessage(msg *message.Message) error
+	//SendMessages sends the messages through the transport in a single frame
+	SendMessages(msgs []*message.Message) error
 
 	SetOnMessageReceivedHandler(onMsg func(msg *message.Message))
 
@@ -49,14 +106,70 @@ type Transport interface {
 
 	//handled by dispatcher
 	SetOnErrorHandler(onError func(err error))
+
+	//ClientID returns the clientId assigned by the server during the handshake
+	ClientID() string
+	//Subscriptions returns the channels the server acknowledged as subscribed
+	Subscriptions() []string
+	//ConnectionState returns the state of the underlying connection
+	ConnectionState() ConnectionState
+	//HandshakeInfo returns the http response to the connection handshake
+	HandshakeInfo() HandshakeInfo
 }
 
-var registeredTransports = map[string]Transport{}
+//ErrKeepAliveTimeout is the cause of the transport down when the server doesn't answer the keep-alive pings,
+//see Options.KeepAliveInterval
+var ErrKeepAliveTimeout = errors.New("keep-alive timeout")
+
+//ErrUnknownTransport is returned by New when no transport is registered with the name
+var ErrUnknownTransport = errors.New("unknown transport")
+
+//Factory creates a new instance of a transport, so every client gets its own
+type Factory func() Transport
+
+var (
+	registryMu           sync.RWMutex
+	registeredTransports = map[string]Factory{}
+)
+
+//Register makes the transport created by factory available by name, see New
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	registeredTransports[name] = factory
+	registryMu.Unlock()
+}
+
+//New creates a new instance of the transport registered with the name
+func New(name string) (Transport, error) {
+	registryMu.RLock()
+	factory, ok := registeredTransports[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w `%s`", ErrUnknownTransport, name)
+	}
+	return factory(), nil
+}
+
+//Names returns the names of the transports registered, sorted
+func Names() []string {
+	registryMu.RLock()
+	names := make([]string, 0, len(registeredTransports))
+	for name := range registeredTransports {
+		names = append(names, name)
+	}
+	registryMu.RUnlock()
+	sort.Strings(names)
+	return names
+}
 
+//RegisterTransport registers the transport instance under its name, every client using it by name shares it.
+//prefer Register with a factory.
 func RegisterTransport(t Transport) {
-	registeredTransports[t.Name()] = t //todo validate
+	Register(t.Name(), func() Transport { return t })
 }
 
+//GetTransport returns a transport registered with the name, nil if there is none. see New
 func GetTransport(name string) Transport {
-	return registeredTransports[name]
+	t, _ := New(name)
+	return t
 }
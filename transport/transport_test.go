@@ -0,0 +1,48 @@
+package transport
+
+import (
+	"errors"
+	"github.com/thesyncim/faye/message"
+	"testing"
+)
+
+//nopTransport is only used to exercise the registry
+type nopTransport struct {
+	Transport
+}
+
+func TestNew(t *testing.T) {
+	Register("nop", func() Transport { return &nopTransport{} })
+
+	a, err := New("nop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := New("nop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Fatal("expecting a new instance for every call")
+	}
+	if _, err = New("unknown"); !errors.Is(err, ErrUnknownTransport) {
+		t.Fatalf("expecting %v got: %v", ErrUnknownTransport, err)
+	}
+	if GetTransport("unknown") != nil {
+		t.Fatal("expecting no transport for an unknown name")
+	}
+}
+
+func BenchmarkOptions_Encode(b *testing.B) {
+	msgs := []*message.Message{
+		{Channel: "/foo", Id: "1", ClientId: "abc", Data: map[string]interface{}{"k": "v"}},
+		{Channel: "/foo", Id: "2", ClientId: "abc", Data: map[string]interface{}{"k": "v"}},
+	}
+	var o Options
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := o.Encode(msgs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -1,30 +1,53 @@
 package websocket
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/gorilla/websocket"
+	"github.com/thesyncim/faye/clock"
 	"github.com/thesyncim/faye/message"
 	"github.com/thesyncim/faye/transport"
-	"log"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 const transportName = "websocket"
 
+//controlDeadline bounds the writes of the pings and pongs when no WriteDeadline is set
+const controlDeadline = 5 * time.Second
+
 func init() {
-	transport.RegisterTransport(&Websocket{})
+	transport.Register(transportName, New)
+}
+
+//New creates a websocket transport, e.g. to inject it with fayec.WithTransport
+func New() transport.Transport {
+	return &Websocket{}
 }
 
-//Websocket represents an websocket transport for the faye protocol
+//Websocket represents an websocket transport for the faye protocol, the messages can be sent from many
+//goroutines: the writes to the connection are serialized and a single goroutine reads it
 type Websocket struct {
+	transport.Session
+
 	topts *transport.Options
 
 	connMu sync.Mutex
 	conn   *websocket.Conn
+	//writeMu serializes the writes, apart from connMu so Close can always close a connection stuck writing
+	writeMu sync.Mutex
 
-	advice atomic.Value //type message.Advise //todo move to dispatcher
-
-	stopCh chan error //todo replace wth context
+	//closed is set by Disconnect so the read loop can tell a requested close from a failure
+	closed int32
+	//envelope holds the message of SendMessage while it is encoded, guarded by writeMu
+	envelope [1]*message.Message
+	//reader is the connection the read loop is running on, so repeated connects don't start another one,
+	//guarded by connMu
+	reader *websocket.Conn
+	//seen is the time in unix nanoseconds a frame was last read from the connection, see keepAlive
+	seen int64
 
 	onMsg           func(msg *message.Message)
 	onError         func(err error)
@@ -32,7 +55,10 @@ type Websocket struct {
 	onTransportUp   func()
 }
 
-var _ transport.Transport = (*Websocket)(nil)
+var (
+	_ transport.ContextTransport = (*Websocket)(nil)
+	_ transport.Closer           = (*Websocket)(nil)
+)
 
 //Init initializes the transport with the provided options
 func (w *Websocket) Init(endpoint string, options *transport.Options) error {
@@ -41,42 +67,159 @@ func (w *Websocket) Init(endpoint string, options *transport.Options) error {
 	)
 	w.topts = options
 
-	w.stopCh = make(chan error)
-	w.conn, _, err = websocket.DefaultDialer.Dial(endpoint, options.Headers)
+	headers, err := options.RequestHeaders()
 	if err != nil {
 		return err
 	}
-
-	w.conn.SetPingHandler(func(appData string) error {
-		return w.conn.WriteJSON(make([]struct{}, 0))
-	})
+	dialer := *websocket.DefaultDialer
+	dialer.TLSClientConfig = options.TLSConfig()
+	dialer.NetDialContext = options.NetDialContext
+	dialer.Proxy = options.ProxyFunc()
+	if options.DialDeadline > 0 {
+		dialer.HandshakeTimeout = options.DialDeadline
+	}
+	dialer.Jar = options.CookieJar()
+	dialer.EnableCompression = options.WebsocketCompression
+	conn, resp, err := dialer.Dial(endpoint, headers)
 	if err != nil {
 		return err
 	}
+	//a new connection replaces the previous one, e.g. when the server advises to handshake again
+	w.connMu.Lock()
+	previous := w.conn
+	w.conn = conn
+	w.connMu.Unlock()
+	if previous != nil {
+		previous.Close()
+	}
+	w.SetHandshakeInfo(transport.HandshakeInfo{
+		StatusCode:  resp.StatusCode,
+		Header:      resp.Header,
+		Subprotocol: conn.Subprotocol(),
+	})
+	w.SetConnectionState(transport.StateConnected)
+
+	//the control frames can be written concurrently with the other frames
+	conn.SetPingHandler(func(appData string) error {
+		err := conn.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(w.controlDeadline()))
+		if err == websocket.ErrCloseSent {
+			return nil
+		}
+		return err
+	})
+	conn.SetPongHandler(func(string) error {
+		w.markSeen()
+		return nil
+	})
 	return nil
 }
 
+//controlDeadline returns how long the control frames can take to be written
+func (w *Websocket) controlDeadline() time.Duration {
+	if w.topts.WriteDeadline > 0 {
+		return w.topts.WriteDeadline
+	}
+	return controlDeadline
+}
+
+func (w *Websocket) clock() clock.Clock {
+	return clock.Or(w.topts.Clock)
+}
+
+//keepAliveTimeout returns how long the server has to answer a ping, a KeepAliveInterval if not set
+func (w *Websocket) keepAliveTimeout() time.Duration {
+	if w.topts.KeepAliveTimeout > 0 {
+		return w.topts.KeepAliveTimeout
+	}
+	return w.topts.KeepAliveInterval
+}
+
+//markSeen records that the server is alive
+func (w *Websocket) markSeen() {
+	atomic.StoreInt64(&w.seen, w.clock().Now().UnixNano())
+}
+
+//keepAlive pings the server on conn every KeepAliveInterval until stop is closed, conn is closed if the server
+//isn't seen within KeepAliveTimeout of a ping so the read loop fails with ErrKeepAliveTimeout
+func (w *Websocket) keepAlive(conn *websocket.Conn, stop <-chan struct{}, timedOut *int32) {
+	c := w.clock()
+	wait := func(d time.Duration) bool {
+		timer := c.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-timer.C():
+			return true
+		case <-stop:
+			return false
+		}
+	}
+	for wait(w.topts.KeepAliveInterval) {
+		sent := c.Now().UnixNano()
+		if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(w.controlDeadline())); err != nil {
+			//the read loop fails as well
+			return
+		}
+		if !wait(w.keepAliveTimeout()) {
+			return
+		}
+		if atomic.LoadInt64(&w.seen) < sent {
+			atomic.StoreInt32(timedOut, 1)
+			conn.Close()
+			return
+		}
+	}
+}
+
 //Init initializes the transport with the provided options
 func (w *Websocket) SetOnErrorHandler(onError func(err error)) {
 	w.onError = onError
 }
 
-func (w *Websocket) readWorker() error {
+//readWorker dispatches the messages received on conn until it fails, the error is nil
+//if the connection was closed by Disconnect or replaced by a new one
+func (w *Websocket) readWorker(conn *websocket.Conn) error {
+	var timedOut int32
+	if w.topts.KeepAliveInterval > 0 {
+		stop := make(chan struct{})
+		defer close(stop)
+		w.markSeen()
+		go w.keepAlive(conn, stop, &timedOut)
+	}
 	for {
-		select {
-		case err := <-w.stopCh:
-			return err
-		default:
+		if w.topts.ReadDeadline > 0 {
+			conn.SetReadDeadline(time.Now().Add(w.topts.ReadDeadline))
+		}
+		_, data, err := conn.ReadMessage()
+		if err == nil {
+			w.markSeen()
 		}
-		var payload []message.Message
-		err := w.conn.ReadJSON(&payload)
 		if err != nil {
-
+			w.connMu.Lock()
+			replaced := w.conn != conn
+			w.connMu.Unlock()
+			if replaced {
+				return nil
+			}
+			w.SetConnectionState(transport.StateDisconnected)
+			if atomic.LoadInt32(&w.closed) == 1 {
+				return nil
+			}
+			if atomic.LoadInt32(&timedOut) == 1 {
+				return transport.ErrKeepAliveTimeout
+			}
 			return err
 		}
-		//dispatch
-		msg := &payload[0]
-		w.onMsg(msg)
+		//a malformed frame is skipped, the connection is kept
+		payload, err := w.topts.Decode(data)
+		if err != nil && w.onError != nil {
+			w.onError(fmt.Errorf("decode: %w", err))
+		}
+		//servers batch the responses and the deliveries, each is dispatched on its own
+		for i := range payload {
+			msg := &payload[i]
+			w.Observe(msg)
+			w.onMsg(msg)
+		}
 	}
 }
 
@@ -86,23 +229,45 @@ func (w *Websocket) Name() string {
 }
 
 func (w *Websocket) SendMessage(m *message.Message) error {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+	//reconnection is driven by the dispatcher according to the server advice
+	w.envelope[0] = m
+	err := w.write(w.envelope[:])
+	w.envelope[0] = nil
+	return err
+}
+
+//SendMessages sends the messages in a single websocket frame
+func (w *Websocket) SendMessages(msgs []*message.Message) error {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+	return w.write(msgs)
+}
+
+//write sends the messages encoded with the options codec in a single frame, binary unless they are json.
+//writeMu must be held
+func (w *Websocket) write(msgs []*message.Message) error {
+	b, err := w.topts.Encode(msgs)
+	if err != nil {
+		return err
+	}
+	frame := websocket.BinaryMessage
+	if w.topts.IsJSON() {
+		frame = websocket.TextMessage
+	}
+	conn := w.current()
+	if w.topts.WriteDeadline > 0 {
+		conn.SetWriteDeadline(time.Now().Add(w.topts.WriteDeadline))
+	}
+	return conn.WriteMessage(frame, b)
+}
+
+//current returns the connection in use
+func (w *Websocket) current() *websocket.Conn {
 	w.connMu.Lock()
 	defer w.connMu.Unlock()
-	var payload []message.Message
-	payload = append(payload, *m)
-
-again: //todo move this to scheduler
-	err := w.conn.WriteJSON(payload)
-	if websocket.IsUnexpectedCloseError(err) {
-		advise := w.advice.Load().(*message.Advise)
-		if advise.Reconnect == message.ReconnectNone {
-			return err
-		}
-		//reconnect
-		//we should re-register again subscriptions again
-		goto again
-	}
-	return nil
+	return w.conn
 }
 
 //Options return the transport Options
@@ -118,21 +283,100 @@ func (w *Websocket) Handshake(msg *message.Message) (resp *message.Message, err
 		return nil, err
 	}
 
-	var hsResps []message.Message
-	if err = w.conn.ReadJSON(&hsResps); err != nil {
+	_, data, err := w.current().ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	hsResps, err := w.topts.Decode(data)
+	if err != nil {
 		return nil, err
 	}
+	if len(hsResps) == 0 {
+		return nil, errors.New("empty handshake response")
+	}
 
 	resp = &hsResps[0]
+	w.Observe(resp)
+	return resp, nil
+}
+
+//HandshakeCtx is like Handshake but interrupts the wait for the response when ctx is done,
+//the connection can't be used afterwards
+func (w *Websocket) HandshakeCtx(ctx context.Context, msg *message.Message) (resp *message.Message, err error) {
+	err = w.interruptible(ctx, func() (err error) {
+		resp, err = w.Handshake(msg)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
 	return resp, nil
 }
 
+//ConnectCtx is like Connect, failing with the context error if ctx is already done
+func (w *Websocket) ConnectCtx(ctx context.Context, msg *message.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return w.Connect(msg)
+}
+
+//DisconnectCtx is like Disconnect but interrupts the write of the disconnect message when ctx is done,
+//the connection is closed anyway
+func (w *Websocket) DisconnectCtx(ctx context.Context, msg *message.Message) error {
+	return w.interruptible(ctx, func() error {
+		return w.Disconnect(msg)
+	})
+}
+
+//interruptible runs fn, expiring the deadlines of the connection when ctx is done to unblock it
+func (w *Websocket) interruptible(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	conn := w.current()
+
+	stop := make(chan struct{})
+	interrupted := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetReadDeadline(time.Now())
+			conn.SetWriteDeadline(time.Now())
+			interrupted <- true
+		case <-stop:
+			interrupted <- false
+		}
+	}()
+	err := fn()
+	close(stop)
+	if <-interrupted {
+		return ctx.Err()
+	}
+	return err
+}
+
 //Init is called  after a client has discovered the server’s capabilities with a handshake exchange,
 //a connection is established by sending a message to the /meta/connect channel
 func (w *Websocket) Connect(msg *message.Message) error {
-	go func() {
-		log.Fatal(w.readWorker())
-	}()
+	w.connMu.Lock()
+	conn := w.conn
+	start := w.reader != conn
+	w.reader = conn
+	w.connMu.Unlock()
+	if start {
+		go func() {
+			err := w.readWorker(conn)
+			w.connMu.Lock()
+			if w.reader == conn {
+				w.reader = nil
+			}
+			w.connMu.Unlock()
+			if err != nil && w.onTransportDown != nil {
+				w.onTransportDown(err)
+			}
+		}()
+	}
 	return w.SendMessage(msg)
 }
 
@@ -147,9 +391,22 @@ func (w *Websocket) SetOnTransportUpHandler(onTransportUp func()) {
 //Disconnect closes all subscriptions and inform the server to remove any client-related state.
 //any subsequent method call to the client object will result in undefined behaviour.
 func (w *Websocket) Disconnect(m *message.Message) error {
-	w.stopCh <- nil
-	close(w.stopCh)
-	return w.SendMessage(m)
+	err := w.SendMessage(m)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+//Close closes the connection without informing the server
+func (w *Websocket) Close() error {
+	atomic.StoreInt32(&w.closed, 1)
+	conn := w.current()
+	if conn == nil {
+		//never dialed
+		return nil
+	}
+	return conn.Close()
 }
 
 func (w *Websocket) SetOnMessageReceivedHandler(onMsg func(*message.Message)) {
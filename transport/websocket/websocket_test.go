@@ -0,0 +1,314 @@
+package websocket
+
+import (
+	"errors"
+	"github.com/gorilla/websocket"
+	"github.com/thesyncim/faye/conformance"
+	"github.com/thesyncim/faye/fayeserver"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebsocket_ConcurrentSend(t *testing.T) {
+	srv := httptest.NewServer(fayeserver.NewServer())
+	defer srv.Close()
+
+	w := New()
+	if err := w.Init("ws"+strings.TrimPrefix(srv.URL, "http"), &transport.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	acks := make(chan *message.Message, 100)
+	w.SetOnMessageReceivedHandler(func(msg *message.Message) {
+		if msg.Channel != message.MetaConnect {
+			acks <- msg
+		}
+	})
+	if _, err := w.Handshake(&message.Message{Channel: message.MetaHandshake, Version: "1.0"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Connect(&message.Message{Channel: message.MetaConnect, ClientId: w.ClientID()}); err != nil {
+		t.Fatal(err)
+	}
+
+	const senders = 50
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			m := &message.Message{Channel: "/foo", ClientId: w.ClientID(), Data: i, Id: strconv.Itoa(i)}
+			if i%2 == 0 {
+				m = &message.Message{Channel: message.MetaSubscribe, ClientId: w.ClientID(), Subscription: "/bar/" + strconv.Itoa(i), Id: strconv.Itoa(i)}
+			}
+			if err := w.SendMessage(m); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < senders; i++ {
+		select {
+		case ack := <-acks:
+			if !ack.Successful {
+				t.Fatalf("expecting the message acknowledged got: %+v", ack)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expecting %d acks got: %d", senders, i)
+		}
+	}
+	if err := w.Disconnect(&message.Message{Channel: message.MetaDisconnect, ClientId: w.ClientID()}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//handshakeServer answers the handshake then calls serve with the connection
+func handshakeServer(t *testing.T, serve func(conn *websocket.Conn)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(rw, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		var handshake []message.Message
+		if err = conn.ReadJSON(&handshake); err != nil {
+			t.Error(err)
+			return
+		}
+		resp := []message.Message{{Channel: message.MetaHandshake, ClientId: "client", Successful: true}}
+		if err = conn.WriteJSON(resp); err != nil {
+			t.Error(err)
+			return
+		}
+		serve(conn)
+	}))
+}
+
+//connectTo handshakes with the server and starts the read loop, the messages received are passed to onMsg if not
+//nil and the transport down errors are sent to down
+func connectTo(t *testing.T, srv *httptest.Server, options *transport.Options, onMsg func(msg *message.Message), down chan<- error) transport.Transport {
+	w := New()
+	if err := w.Init("ws"+strings.TrimPrefix(srv.URL, "http"), options); err != nil {
+		t.Fatal(err)
+	}
+	if onMsg == nil {
+		onMsg = func(msg *message.Message) {}
+	}
+	w.SetOnMessageReceivedHandler(onMsg)
+	w.SetOnTransportDownHandler(func(err error) {
+		down <- err
+	})
+	if _, err := w.Handshake(&message.Message{Channel: message.MetaHandshake, Version: "1.0"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Connect(&message.Message{Channel: message.MetaConnect, ClientId: w.ClientID()}); err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestWebsocket_KeepAlive(t *testing.T) {
+	options := &transport.Options{KeepAliveInterval: 5 * time.Millisecond, KeepAliveTimeout: 20 * time.Millisecond}
+
+	//the server answers the pings while it reads
+	stop := make(chan struct{})
+	alive := handshakeServer(t, func(conn *websocket.Conn) {
+		go func() {
+			<-stop
+			conn.Close()
+		}()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	defer alive.Close()
+	down := make(chan error, 1)
+	w := connectTo(t, alive, options, nil, down)
+	select {
+	case err := <-down:
+		t.Fatalf("expecting the connection kept alive got: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	w.(*Websocket).Close()
+	close(stop)
+
+	//the silent server doesn't read the pings
+	release := make(chan struct{})
+	silent := handshakeServer(t, func(conn *websocket.Conn) {
+		<-release
+	})
+	defer silent.Close()
+	defer close(release)
+	connectTo(t, silent, options, nil, down)
+	select {
+	case err := <-down:
+		if !errors.Is(err, transport.ErrKeepAliveTimeout) {
+			t.Fatalf("expecting %v got: %v", transport.ErrKeepAliveTimeout, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expecting the transport down")
+	}
+}
+
+func TestWebsocket_CloseStalledWrite(t *testing.T) {
+	//the server stops reading, the writes block once the socket buffers are full
+	release := make(chan struct{})
+	srv := handshakeServer(t, func(conn *websocket.Conn) {
+		<-release
+	})
+	defer srv.Close()
+	defer close(release)
+	w := connectTo(t, srv, &transport.Options{}, nil, make(chan error, 1))
+
+	sent := make(chan error, 1)
+	go func() {
+		data := strings.Repeat("x", 1<<20)
+		for {
+			if err := w.SendMessage(&message.Message{Channel: "/foo", ClientId: w.ClientID(), Data: data}); err != nil {
+				sent <- err
+				return
+			}
+		}
+	}()
+	time.Sleep(100 * time.Millisecond)
+	closed := make(chan error, 1)
+	go func() {
+		closed <- w.(*Websocket).Close()
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("expecting Close not blocked by the stalled write")
+	}
+	select {
+	case err := <-sent:
+		if err == nil {
+			t.Fatal("expecting the stalled write failed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expecting the stalled write unblocked")
+	}
+}
+
+func TestWebsocket_Pong(t *testing.T) {
+	pong := make(chan string, 1)
+	srv := handshakeServer(t, func(conn *websocket.Conn) {
+		conn.SetPongHandler(func(appData string) error {
+			pong <- appData
+			return nil
+		})
+		if err := conn.WriteControl(websocket.PingMessage, []byte("hello"), time.Now().Add(time.Second)); err != nil {
+			t.Error(err)
+			return
+		}
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	defer srv.Close()
+	w := connectTo(t, srv, &transport.Options{}, nil, make(chan error, 1))
+	defer w.(*Websocket).Close()
+	select {
+	case appData := <-pong:
+		if appData != "hello" {
+			t.Fatalf("expecting the ping data echoed got: %s", appData)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expecting a pong")
+	}
+}
+
+func TestWebsocket_BatchedFrame(t *testing.T) {
+	srv := handshakeServer(t, func(conn *websocket.Conn) {
+		var connect []message.Message
+		if err := conn.ReadJSON(&connect); err != nil {
+			t.Error(err)
+			return
+		}
+		//the connect response and the deliveries held meanwhile in a single frame
+		batch := []message.Message{
+			{Channel: message.MetaConnect, Id: connect[0].Id, Successful: true},
+			{Channel: "/foo", Data: "a"},
+			{Channel: "/bar", Data: "b"},
+		}
+		if err := conn.WriteJSON(batch); err != nil {
+			t.Error(err)
+			return
+		}
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	defer srv.Close()
+	received := make(chan string, 3)
+	w := connectTo(t, srv, &transport.Options{}, func(msg *message.Message) {
+		received <- msg.Channel
+	}, make(chan error, 1))
+	defer w.(*Websocket).Close()
+	for _, expected := range []string{message.MetaConnect, "/foo", "/bar"} {
+		select {
+		case channel := <-received:
+			if channel != expected {
+				t.Fatalf("expecting a message on %s got: %s", expected, channel)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expecting a message on %s", expected)
+		}
+	}
+}
+
+func TestWebsocket_Compression(t *testing.T) {
+	data := strings.Repeat("compressible ", 1000)
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{EnableCompression: true}).Upgrade(rw, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		var handshake []message.Message
+		if err = conn.ReadJSON(&handshake); err != nil {
+			t.Error(err)
+			return
+		}
+		conn.WriteJSON([]message.Message{{Channel: message.MetaHandshake, ClientId: "client", Successful: true, Data: data}})
+	}))
+	defer srv.Close()
+
+	for _, enabled := range []bool{false, true} {
+		w := New().(*Websocket)
+		if err := w.Init("ws"+strings.TrimPrefix(srv.URL, "http"), &transport.Options{WebsocketCompression: enabled}); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := w.Handshake(&message.Message{Channel: message.MetaHandshake, Version: "1.0"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Data != data {
+			t.Fatal("expecting the data received intact")
+		}
+		extensions := w.HandshakeInfo().Header.Get("Sec-Websocket-Extensions")
+		if negotiated := strings.Contains(extensions, "permessage-deflate"); negotiated != enabled {
+			t.Fatalf("expecting permessage-deflate negotiated %v got: %q", enabled, extensions)
+		}
+		w.Close()
+	}
+}
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, New, "ws")
+}
@@ -0,0 +1,344 @@
+//Package websocketctx provides the websocket-ctx transport, a websocket transport built on github.com/coder/websocket
+//whose reads and writes honor the context of the operation. import it for its side effect to select it by name
+//with fayec.WithTransportName, or inject it with fayec.WithTransport(websocketctx.New()).
+package websocketctx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/coder/websocket"
+	"github.com/thesyncim/faye/clock"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const transportName = "websocket-ctx"
+
+func init() {
+	transport.Register(transportName, New)
+}
+
+//New creates a websocket-ctx transport, e.g. to inject it with fayec.WithTransport
+func New() transport.Transport {
+	return &Websocket{}
+}
+
+//Websocket represents a websocket transport for the faye protocol on a context aware connection: the reads and
+//writes of the ctx methods are interrupted as soon as the context is done, the others are bounded by the
+//ReadDeadline and WriteDeadline of the options. an interrupted read or write closes the connection.
+//the messages can be sent from many goroutines, a single goroutine reads the connection.
+type Websocket struct {
+	transport.Session
+
+	topts *transport.Options
+
+	connMu sync.Mutex
+	conn   *websocket.Conn
+
+	//closed is set by Close so the read loop can tell a requested close from a failure
+	closed int32
+	//reader is the connection the read loop is running on, so repeated connects don't start another one,
+	//guarded by connMu
+	reader *websocket.Conn
+
+	onMsg           func(msg *message.Message)
+	onError         func(err error)
+	onTransportDown func(err error)
+	onTransportUp   func()
+}
+
+var (
+	_ transport.ContextTransport = (*Websocket)(nil)
+	_ transport.Closer           = (*Websocket)(nil)
+)
+
+//Init dials the endpoint with the provided options, within the DialDeadline if set
+func (w *Websocket) Init(endpoint string, options *transport.Options) error {
+	w.topts = options
+	headers, err := options.RequestHeaders()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := withTimeout(context.Background(), options.DialDeadline)
+	defer cancel()
+	dialOpts := &websocket.DialOptions{
+		HTTPClient: options.HTTPClient(),
+		HTTPHeader: headers,
+	}
+	if options.WebsocketCompression {
+		dialOpts.CompressionMode = websocket.CompressionContextTakeover
+	}
+	conn, resp, err := websocket.Dial(ctx, endpoint, dialOpts)
+	if err != nil {
+		return err
+	}
+	//the size of the messages is left to the server
+	conn.SetReadLimit(-1)
+
+	//a new connection replaces the previous one, e.g. when the server advises to handshake again
+	w.connMu.Lock()
+	previous := w.conn
+	w.conn = conn
+	w.connMu.Unlock()
+	if previous != nil {
+		previous.CloseNow()
+	}
+	atomic.StoreInt32(&w.closed, 0)
+	w.SetHandshakeInfo(transport.HandshakeInfo{
+		StatusCode:  resp.StatusCode,
+		Header:      resp.Header,
+		Subprotocol: conn.Subprotocol(),
+	})
+	w.SetConnectionState(transport.StateConnected)
+	return nil
+}
+
+//withTimeout returns ctx bounded by timeout, ctx itself when timeout isn't positive
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+//Name returns the transport name (websocket-ctx)
+func (w *Websocket) Name() string {
+	return transportName
+}
+
+//Options return the transport Options
+func (w *Websocket) Options() *transport.Options {
+	return w.topts
+}
+
+//current returns the connection in use
+func (w *Websocket) current() *websocket.Conn {
+	w.connMu.Lock()
+	defer w.connMu.Unlock()
+	return w.conn
+}
+
+//write sends the messages encoded with the options codec in a single frame, binary unless they are json
+func (w *Websocket) write(ctx context.Context, msgs []*message.Message) error {
+	b, err := w.topts.Encode(msgs)
+	if err != nil {
+		return err
+	}
+	frame := websocket.MessageBinary
+	if w.topts.IsJSON() {
+		frame = websocket.MessageText
+	}
+	ctx, cancel := withTimeout(ctx, w.topts.WriteDeadline)
+	defer cancel()
+	return w.current().Write(ctx, frame, b)
+}
+
+//read returns the next frame read from conn
+func (w *Websocket) read(ctx context.Context, conn *websocket.Conn) ([]byte, error) {
+	ctx, cancel := withTimeout(ctx, w.topts.ReadDeadline)
+	defer cancel()
+	_, data, err := conn.Read(ctx)
+	return data, err
+}
+
+//SendMessage sends the message
+func (w *Websocket) SendMessage(m *message.Message) error {
+	return w.write(context.Background(), []*message.Message{m})
+}
+
+//SendMessages sends the messages in a single websocket frame
+func (w *Websocket) SendMessages(msgs []*message.Message) error {
+	return w.write(context.Background(), msgs)
+}
+
+//Handshake initiates a connection negotiation by sending a message to the /meta/handshake channel.
+func (w *Websocket) Handshake(msg *message.Message) (*message.Message, error) {
+	return w.HandshakeCtx(context.Background(), msg)
+}
+
+//HandshakeCtx is like Handshake but interrupts the write of the handshake and the wait for the response when
+//ctx is done, the connection can't be used afterwards
+func (w *Websocket) HandshakeCtx(ctx context.Context, msg *message.Message) (*message.Message, error) {
+	if err := w.write(ctx, []*message.Message{msg}); err != nil {
+		return nil, err
+	}
+	data, err := w.read(ctx, w.current())
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	resps, err := w.topts.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(resps) == 0 {
+		return nil, errors.New("empty handshake response")
+	}
+	w.Observe(&resps[0])
+	return &resps[0], nil
+}
+
+//Connect starts reading the connection and sends the message to the /meta/connect channel
+func (w *Websocket) Connect(msg *message.Message) error {
+	return w.ConnectCtx(context.Background(), msg)
+}
+
+//ConnectCtx is like Connect but interrupts the write of the connect message when ctx is done
+func (w *Websocket) ConnectCtx(ctx context.Context, msg *message.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	w.connMu.Lock()
+	conn := w.conn
+	start := w.reader != conn
+	w.reader = conn
+	w.connMu.Unlock()
+	if start {
+		go func() {
+			err := w.readWorker(conn)
+			w.connMu.Lock()
+			if w.reader == conn {
+				w.reader = nil
+			}
+			w.connMu.Unlock()
+			if err != nil && w.onTransportDown != nil {
+				w.onTransportDown(err)
+			}
+		}()
+	}
+	return w.write(ctx, []*message.Message{msg})
+}
+
+//Disconnect informs the server to remove any client-related state and closes the connection
+func (w *Websocket) Disconnect(m *message.Message) error {
+	return w.DisconnectCtx(context.Background(), m)
+}
+
+//DisconnectCtx is like Disconnect but interrupts the write of the disconnect message when ctx is done,
+//the connection is closed anyway
+func (w *Websocket) DisconnectCtx(ctx context.Context, m *message.Message) error {
+	err := w.write(ctx, []*message.Message{m})
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+//Close closes the connection without informing the server, closing it again is a no-op
+func (w *Websocket) Close() error {
+	atomic.StoreInt32(&w.closed, 1)
+	w.SetConnectionState(transport.StateDisconnected)
+	conn := w.current()
+	if conn == nil {
+		//never dialed
+		return nil
+	}
+	err := conn.CloseNow()
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+//readWorker dispatches the messages received on conn until it fails, the error is nil
+//if the connection was closed by Close or replaced by a new one
+func (w *Websocket) readWorker(conn *websocket.Conn) error {
+	var timedOut int32
+	if w.topts.KeepAliveInterval > 0 {
+		stop := make(chan struct{})
+		defer close(stop)
+		go w.keepAlive(conn, stop, &timedOut)
+	}
+	for {
+		data, err := w.read(context.Background(), conn)
+		if err != nil {
+			w.connMu.Lock()
+			replaced := w.conn != conn
+			w.connMu.Unlock()
+			if replaced {
+				return nil
+			}
+			w.SetConnectionState(transport.StateDisconnected)
+			if atomic.LoadInt32(&w.closed) == 1 {
+				return nil
+			}
+			if atomic.LoadInt32(&timedOut) == 1 {
+				return transport.ErrKeepAliveTimeout
+			}
+			return err
+		}
+		//a malformed frame is skipped, the connection is kept
+		payload, err := w.topts.Decode(data)
+		if err != nil && w.onError != nil {
+			w.onError(fmt.Errorf("decode: %w", err))
+		}
+		for i := range payload {
+			msg := &payload[i]
+			w.Observe(msg)
+			w.onMsg(msg)
+		}
+	}
+}
+
+//keepAlive pings the server on conn every KeepAliveInterval until stop is closed, conn is closed if the server
+//doesn't answer a ping within KeepAliveTimeout, a KeepAliveInterval if not set, so the read loop fails with
+//ErrKeepAliveTimeout
+func (w *Websocket) keepAlive(conn *websocket.Conn, stop <-chan struct{}, timedOut *int32) {
+	c := clock.Or(w.topts.Clock)
+	timeout := w.topts.KeepAliveTimeout
+	if timeout <= 0 {
+		timeout = w.topts.KeepAliveInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+	for {
+		timer := c.NewTimer(w.topts.KeepAliveInterval)
+		select {
+		case <-timer.C():
+		case <-stop:
+			timer.Stop()
+			return
+		}
+		pingCtx, pingCancel := context.WithTimeout(ctx, timeout)
+		err := conn.Ping(pingCtx)
+		pingCancel()
+		if err == nil {
+			continue
+		}
+		if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+			atomic.StoreInt32(timedOut, 1)
+			conn.CloseNow()
+		}
+		return
+	}
+}
+
+func (w *Websocket) SetOnMessageReceivedHandler(onMsg func(*message.Message)) {
+	w.onMsg = onMsg
+}
+
+func (w *Websocket) SetOnTransportUpHandler(onTransportUp func()) {
+	w.onTransportUp = onTransportUp
+}
+
+func (w *Websocket) SetOnTransportDownHandler(onTransportDown func(err error)) {
+	w.onTransportDown = onTransportDown
+}
+
+func (w *Websocket) SetOnErrorHandler(onError func(err error)) {
+	w.onError = onError
+}
@@ -0,0 +1,194 @@
+package websocketctx
+
+import (
+	"context"
+	"errors"
+	"github.com/coder/websocket"
+	"github.com/thesyncim/faye/conformance"
+	"github.com/thesyncim/faye/fayeserver"
+	"github.com/thesyncim/faye/message"
+	"github.com/thesyncim/faye/transport"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func wsURL(srv *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func TestWebsocket(t *testing.T) {
+	srv := httptest.NewServer(fayeserver.NewServer())
+	defer srv.Close()
+
+	w := New()
+	if err := w.Init(wsURL(srv), &transport.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	acks := make(chan *message.Message, 10)
+	w.SetOnMessageReceivedHandler(func(msg *message.Message) {
+		if msg.Channel != message.MetaConnect {
+			acks <- msg
+		}
+	})
+	if _, err := w.Handshake(&message.Message{Channel: message.MetaHandshake, Version: "1.0"}); err != nil {
+		t.Fatal(err)
+	}
+	if w.ClientID() == "" {
+		t.Fatal("expecting a clientId")
+	}
+	if err := w.Connect(&message.Message{Channel: message.MetaConnect, ClientId: w.ClientID()}); err != nil {
+		t.Fatal(err)
+	}
+	err := w.SendMessages([]*message.Message{
+		{Channel: message.MetaSubscribe, ClientId: w.ClientID(), Subscription: "/foo", Id: "1"},
+		{Channel: "/foo", ClientId: w.ClientID(), Data: "bar", Id: "2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	acked := map[string]bool{}
+	for len(acked) < 2 {
+		select {
+		case msg := <-acks:
+			if msg.Id == "1" || msg.Id == "2" {
+				if !msg.Successful {
+					t.Fatalf("expecting the message acknowledged got: %+v", msg)
+				}
+				acked[msg.Id] = true
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expecting the subscribe and the publish acknowledged got: %v", acked)
+		}
+	}
+	if err := w.Disconnect(&message.Message{Channel: message.MetaDisconnect, ClientId: w.ClientID()}); err != nil {
+		t.Fatal(err)
+	}
+	if w.(*Websocket).ConnectionState() != transport.StateDisconnected {
+		t.Fatal("expecting the transport disconnected")
+	}
+}
+
+//silentServer accepts the connections and never writes, until release is closed
+func silentServer(t *testing.T, release <-chan struct{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(rw, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.CloseNow()
+		<-release
+	}))
+}
+
+func TestWebsocket_HandshakeCtx(t *testing.T) {
+	release := make(chan struct{})
+	srv := silentServer(t, release)
+	defer srv.Close()
+	defer close(release)
+
+	w := New().(*Websocket)
+	if err := w.Init(wsURL(srv), &transport.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := w.HandshakeCtx(ctx, &message.Message{Channel: message.MetaHandshake}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expecting the context error got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expecting the handshake interrupted got: %v", elapsed)
+	}
+}
+
+func TestWebsocket_KeepAlive(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(rw, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.CloseNow()
+		ctx := r.Context()
+		if _, _, err = conn.Read(ctx); err != nil {
+			return
+		}
+		resp := `[{"channel":"/meta/handshake","clientId":"client","successful":true}]`
+		if err = conn.Write(ctx, websocket.MessageText, []byte(resp)); err != nil {
+			return
+		}
+		//the server stops reading, the pings aren't answered
+		<-ctx.Done()
+	}))
+	defer srv.Close()
+
+	w := New()
+	options := &transport.Options{KeepAliveInterval: 5 * time.Millisecond, KeepAliveTimeout: 20 * time.Millisecond}
+	if err := w.Init(wsURL(srv), options); err != nil {
+		t.Fatal(err)
+	}
+	w.SetOnMessageReceivedHandler(func(msg *message.Message) {})
+	down := make(chan error, 1)
+	w.SetOnTransportDownHandler(func(err error) {
+		down <- err
+	})
+	if _, err := w.Handshake(&message.Message{Channel: message.MetaHandshake}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Connect(&message.Message{Channel: message.MetaConnect, ClientId: w.ClientID()}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-down:
+		if !errors.Is(err, transport.ErrKeepAliveTimeout) {
+			t.Fatalf("expecting %v got: %v", transport.ErrKeepAliveTimeout, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expecting the transport down")
+	}
+}
+
+func TestWebsocket_Compression(t *testing.T) {
+	data := strings.Repeat("compressible ", 1000)
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(rw, r, &websocket.AcceptOptions{CompressionMode: websocket.CompressionContextTakeover})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.CloseNow()
+		if _, _, err = conn.Read(r.Context()); err != nil {
+			return
+		}
+		resp := `[{"channel":"/meta/handshake","clientId":"client","successful":true,"data":"` + data + `"}]`
+		conn.Write(r.Context(), websocket.MessageText, []byte(resp))
+	}))
+	defer srv.Close()
+
+	for _, enabled := range []bool{false, true} {
+		w := New().(*Websocket)
+		if err := w.Init(wsURL(srv), &transport.Options{WebsocketCompression: enabled}); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := w.Handshake(&message.Message{Channel: message.MetaHandshake})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Data != data {
+			t.Fatal("expecting the data received intact")
+		}
+		extensions := w.HandshakeInfo().Header.Get("Sec-Websocket-Extensions")
+		if negotiated := strings.Contains(extensions, "permessage-deflate"); negotiated != enabled {
+			t.Fatalf("expecting permessage-deflate negotiated %v got: %q", enabled, extensions)
+		}
+		w.Close()
+	}
+}
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, New, "ws")
+}
@@ -0,0 +1,9 @@
+package fayec
+
+import (
+	"github.com/thesyncim/faye/internal/version"
+)
+
+//Version is the fayec library version, it is reported to the server in the handshake ext.client block
+//and in the User-Agent header of the transports.
+const Version = version.Version